@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"go-http-playback-proxy/pkg/admin"
+	"go-http-playback-proxy/pkg/logging"
+	"go-http-playback-proxy/pkg/network"
+	"go-http-playback-proxy/pkg/plugins"
+	"go-http-playback-proxy/pkg/websocket"
+)
+
+// registerCommonAdminRoutes registers admin routes available in every mode
+func registerCommonAdminRoutes(srv *admin.Server) {
+	srv.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, globalMetrics.GetStats())
+	})
+
+	srv.HandleFunc("GET /log-levels", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, logging.Levels())
+	})
+
+	// PUT /log-levels takes {"default": "info", "playback": "debug"}; an empty level resets a module
+	srv.HandleFunc("PUT /log-levels", func(w http.ResponseWriter, r *http.Request) {
+		var changes map[string]string
+		if err := admin.ReadJSON(r, &changes); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for module, value := range changes {
+			if value == "" && module != logging.DefaultModule {
+				continue
+			}
+			if _, err := logging.ParseLevel(value); err != nil {
+				admin.WriteError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		for module, value := range changes {
+			if value == "" && module != logging.DefaultModule {
+				logging.ResetLevel(module)
+				continue
+			}
+			level, _ := logging.ParseLevel(value)
+			logging.SetLevel(module, level)
+		}
+		slog.Info("Log levels updated", "levels", changes)
+		admin.WriteJSON(w, http.StatusOK, logging.Levels())
+	})
+}
+
+// registerRecordingAdminRoutes registers recording-specific admin routes
+func registerRecordingAdminRoutes(srv *admin.Server, plugin *plugins.RecordingPlugin) {
+	srv.HandleFunc("GET /recording", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, plugin.State())
+	})
+
+	// Requests made while paused are still proxied upstream, but left out of the inventory
+	srv.HandleFunc("POST /recording/pause", func(w http.ResponseWriter, r *http.Request) {
+		plugin.Pause()
+		admin.WriteJSON(w, http.StatusOK, plugin.State())
+	})
+
+	srv.HandleFunc("POST /recording/resume", func(w http.ResponseWriter, r *http.Request) {
+		plugin.Resume()
+		admin.WriteJSON(w, http.StatusOK, plugin.State())
+	})
+}
+
+// registerPlaybackAdminRoutes registers playback-specific admin routes
+func registerPlaybackAdminRoutes(srv *admin.Server, plugin *plugins.PlaybackPlugin) {
+	srv.HandleFunc("GET /scenario", func(w http.ResponseWriter, r *http.Request) {
+		tracker := plugin.GetScenarioTracker()
+		if tracker == nil {
+			admin.WriteError(w, http.StatusNotFound, "no scenario configured")
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, tracker.Report())
+	})
+
+	srv.HandleFunc("POST /scenario/reset", func(w http.ResponseWriter, r *http.Request) {
+		tracker := plugin.GetScenarioTracker()
+		if tracker == nil {
+			admin.WriteError(w, http.StatusNotFound, "no scenario configured")
+			return
+		}
+		tracker.Reset()
+		admin.WriteJSON(w, http.StatusOK, tracker.Report())
+	})
+
+	srv.HandleFunc("GET /conditions", func(w http.ResponseWriter, r *http.Request) {
+		admin.WriteJSON(w, http.StatusOK, plugin.GetNetworkController().Get())
+	})
+
+	srv.HandleFunc("PUT /conditions", func(w http.ResponseWriter, r *http.Request) {
+		var conditions network.Conditions
+		if err := admin.ReadJSON(r, &conditions); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := conditions.ResolvePreset(); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := plugin.GetNetworkController().Set(conditions); err != nil {
+			admin.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Info("Network conditions updated", "speed_factor", conditions.SpeedFactor, "faults", len(conditions.Faults))
+		admin.WriteJSON(w, http.StatusOK, conditions)
+	})
+
+	// GET /events/chunks is a WebSocket sending a JSON text frame for every body chunk replayed
+	srv.HandleFunc("GET /events/chunks", func(w http.ResponseWriter, r *http.Request) {
+		serveChunkEvents(w, r, plugin)
+	})
+
+	srv.HandleFunc("GET /calibration", func(w http.ResponseWriter, r *http.Request) {
+		calibrator := plugin.GetCalibrator()
+		if calibrator == nil {
+			admin.WriteError(w, http.StatusNotFound, "calibration disabled")
+			return
+		}
+		admin.WriteJSON(w, http.StatusOK, calibrator.Stats())
+	})
+}
+
+// chunkEventBuffer is how many chunk events wait for a slow subscriber before new ones are dropped
+const chunkEventBuffer = 1024
+
+// serveChunkEvents streams chunk events to a WebSocket client until it leaves. Replays never wait
+// for the client: events it cannot keep up with are dropped.
+func serveChunkEvents(w http.ResponseWriter, r *http.Request, plugin *plugins.PlaybackPlugin) {
+	conn, reader, err := websocket.Accept(w, r)
+	if err != nil {
+		slog.Debug("Chunk event subscription refused", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	events := make(chan plugins.ChunkEvent, chunkEventBuffer)
+	var dropped atomic.Int64
+	unsubscribe := plugin.SubscribeChunks(func(event plugins.ChunkEvent) {
+		select {
+		case events <- event:
+		default:
+			dropped.Add(1)
+		}
+	})
+	defer unsubscribe()
+
+	// The client only closes the session; anything else it sends is ignored
+	left := make(chan struct{})
+	go func() {
+		defer close(left)
+		for {
+			frame, err := websocket.ReadFrame(reader)
+			if err != nil || frame.Opcode == websocket.OpClose {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-left:
+			websocket.WriteFrame(conn, websocket.CloseFrame(1000))
+			if n := dropped.Load(); n > 0 {
+				slog.Warn("Chunk events dropped for a slow subscriber", "count", n)
+			}
+			return
+		case event := <-events:
+			payload, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if err := websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpText, Payload: payload}); err != nil {
+				return
+			}
+		}
+	}
+}
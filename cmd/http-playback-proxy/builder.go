@@ -2,30 +2,64 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
+	"net"
+	"net/url"
+	"strconv"
 
-	"github.com/MatusOllah/slogcolor"
 	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/admin"
+	"go-http-playback-proxy/pkg/classify"
+	"go-http-playback-proxy/pkg/config"
+	"go-http-playback-proxy/pkg/credentials"
 	"go-http-playback-proxy/pkg/httputil"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/logging"
+	"go-http-playback-proxy/pkg/network"
 	"go-http-playback-proxy/pkg/plugins"
+	"go-http-playback-proxy/pkg/postprocess"
+	"go-http-playback-proxy/pkg/resolver"
+	"go-http-playback-proxy/pkg/sampling"
+	"go-http-playback-proxy/pkg/scenario"
 	"go-http-playback-proxy/pkg/types"
+	"go-http-playback-proxy/pkg/urlmatch"
 )
 
 // ProxyBuilder helps build proxy instances with configuration
 type ProxyBuilder struct {
-	port         int
-	inventoryDir string
-	logLevel     string
-	logger       *Logger
+	port            int
+	listen          string
+	listenAddr      string
+	adminSocket     string
+	inventoryDir    string
+	logLevel        string
+	logFormat       string
+	logWriter       io.Writer
+	moduleLevels    map[string]string
+	accessLog       string
+	accessRotation  logging.RotateOptions
+	adminPort       int
+	playbackConfig  config.PlaybackConfig
+	recordingConfig config.RecordingConfig
+	schedule        *network.Schedule
+	logger          *Logger
+	adminServer     *admin.Server
+	// socketListener is the Unix socket bridged to the proxy with --listen unix:/path
+	socketListener net.Listener
+	// inventoryFiles holds the inventory with --in-memory
+	inventoryFiles inventory.MemoryFiles
 }
 
 // NewProxyBuilder creates a new proxy builder
 func NewProxyBuilder() *ProxyBuilder {
 	return &ProxyBuilder{
-		port:         8080,
-		inventoryDir: "./inventory",
-		logLevel:     "info",
+		port:            8080,
+		inventoryDir:    "./inventory",
+		logLevel:        "info",
+		logFormat:       logging.FormatConsole,
+		playbackConfig:  config.DefaultConfig().Playback,
+		recordingConfig: config.DefaultConfig().Recording,
 	}
 }
 
@@ -35,18 +69,79 @@ func (b *ProxyBuilder) WithPort(port int) *ProxyBuilder {
 	return b
 }
 
+// WithListen sets the listen address (host, IP or host:port); empty listens on all interfaces
+func (b *ProxyBuilder) WithListen(listen string) *ProxyBuilder {
+	b.listen = listen
+	return b
+}
+
 // WithInventoryDir sets the inventory directory
 func (b *ProxyBuilder) WithInventoryDir(dir string) *ProxyBuilder {
 	b.inventoryDir = dir
 	return b
 }
 
+// WithInventoryFiles plays back an inventory held in memory instead of the inventory directory
+func (b *ProxyBuilder) WithInventoryFiles(files inventory.MemoryFiles) *ProxyBuilder {
+	b.inventoryFiles = files
+	return b
+}
+
 // WithLogLevel sets the log level
 func (b *ProxyBuilder) WithLogLevel(level string) *ProxyBuilder {
 	b.logLevel = level
 	return b
 }
 
+// WithLogFormat sets the log output format (console or json)
+func (b *ProxyBuilder) WithLogFormat(format string) *ProxyBuilder {
+	b.logFormat = format
+	return b
+}
+
+// WithLogWriter sets where logs are written instead of stderr
+func (b *ProxyBuilder) WithLogWriter(w io.Writer) *ProxyBuilder {
+	b.logWriter = w
+	return b
+}
+
+// WithModuleLogLevels sets per-module log levels overriding the default level
+func (b *ProxyBuilder) WithModuleLogLevels(levels map[string]string) *ProxyBuilder {
+	b.moduleLevels = levels
+	return b
+}
+
+// WithAccessLog writes the playback access log to path, rotating it as configured
+func (b *ProxyBuilder) WithAccessLog(path string, rotation logging.RotateOptions) *ProxyBuilder {
+	b.accessLog = path
+	b.accessRotation = rotation
+	return b
+}
+
+// WithAdminSocket serves the admin API on a Unix socket instead of a port
+func (b *ProxyBuilder) WithAdminSocket(path string) *ProxyBuilder {
+	b.adminSocket = path
+	return b
+}
+
+// WithAdminPort sets the admin API port (0 disables the admin API)
+func (b *ProxyBuilder) WithAdminPort(port int) *ProxyBuilder {
+	b.adminPort = port
+	return b
+}
+
+// WithRecordingConfig sets the recording-specific configuration
+func (b *ProxyBuilder) WithRecordingConfig(cfg config.RecordingConfig) *ProxyBuilder {
+	b.recordingConfig = cfg
+	return b
+}
+
+// WithPlaybackConfig sets the playback-specific configuration
+func (b *ProxyBuilder) WithPlaybackConfig(cfg config.PlaybackConfig) *ProxyBuilder {
+	b.playbackConfig = cfg
+	return b
+}
+
 // Build creates the proxy instance
 func (b *ProxyBuilder) Build() (*proxy.Proxy, error) {
 	// Setup logger first
@@ -57,23 +152,67 @@ func (b *ProxyBuilder) Build() (*proxy.Proxy, error) {
 	// Set global metrics for plugins
 	plugins.SetGlobalMetrics(globalMetrics)
 
+	addr, err := httputil.ListenAddr(b.listen, b.port)
+	if err != nil {
+		return nil, types.NewValidationError("invalid --listen", err)
+	}
+	b.listenAddr = addr
+
+	// go-mitmproxy only listens on TCP; a Unix socket is bridged to a loopback port
+	proxyAddr := addr
+	if socketPath, ok := httputil.UnixSocketPath(addr); ok {
+		if b.socketListener, err = httputil.ListenUnix(socketPath); err != nil {
+			return nil, types.NewNetworkError("failed to listen on Unix socket", err).WithContext("path", socketPath)
+		}
+		proxyAddr = httputil.BridgeAddr
+	}
+
 	// Create proxy using httputil
 	opts := &httputil.ProxyOptions{
 		Port:              b.port,
+		Addr:              proxyAddr,
 		StreamLargeBodies: 1024 * 1024 * 5, // 5MB
 		SslInsecure:       true,
 		CaRootPath:        "",
 		Debug:             0,
+		MaxHeaderBytes:    b.playbackConfig.MaxHeaderBytes,
 	}
 	
 	p, err := httputil.CreateProxy(opts)
 	if err != nil {
+		b.Close()
 		return nil, types.NewNetworkError("failed to create proxy", err)
 	}
+	if b.socketListener != nil {
+		if err := httputil.BridgeUnixSocket(p, b.socketListener); err != nil {
+			b.Close()
+			return nil, types.NewNetworkError("failed to bridge Unix socket", err)
+		}
+	}
+
+	// Create admin API server if enabled
+	if b.adminSocket != "" {
+		b.adminServer = admin.NewServer("unix:" + b.adminSocket)
+	} else if b.adminPort > 0 {
+		b.adminServer = admin.NewServer(net.JoinHostPort(httputil.LoopbackHost(addr), strconv.Itoa(b.adminPort)))
+	}
+	if b.adminServer != nil {
+		registerCommonAdminRoutes(b.adminServer)
+	}
 
 	return p, nil
 }
 
+// Close stops listening on the Unix socket of --listen unix:/path and removes the socket file
+func (b *ProxyBuilder) Close() error {
+	if b.socketListener == nil {
+		return nil
+	}
+	ln := b.socketListener
+	b.socketListener = nil
+	return ln.Close()
+}
+
 // BuildRecordingProxy creates a recording proxy
 func (b *ProxyBuilder) BuildRecordingProxy(targetURL string, noBeautify bool) (*proxy.Proxy, *plugins.RecordingPlugin, error) {
 	p, err := b.Build()
@@ -81,14 +220,128 @@ func (b *ProxyBuilder) BuildRecordingProxy(targetURL string, noBeautify bool) (*
 		return nil, nil, err
 	}
 
+	injector, err := b.buildCredentials(targetURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var samplingRules []sampling.Rule
+	for _, spec := range b.recordingConfig.Sampling {
+		rule, err := sampling.ParseRule(spec)
+		if err != nil {
+			return nil, nil, types.NewValidationError("invalid --sample", err)
+		}
+		samplingRules = append(samplingRules, rule)
+	}
+
+	if b.recordingConfig.MinFreeSpace < 0 {
+		return nil, nil, types.NewValidationError("invalid --min-free-space", fmt.Errorf("must not be negative"))
+	}
+
+	if b.recordingConfig.RotateEvery < 0 {
+		return nil, nil, types.NewValidationError("invalid --rotate-every", fmt.Errorf("must not be negative"))
+	}
+	if b.recordingConfig.RotateSize < 0 {
+		return nil, nil, types.NewValidationError("invalid --rotate-size", fmt.Errorf("must not be negative"))
+	}
+	if b.recordingConfig.MaxBodySize < 0 {
+		return nil, nil, types.NewValidationError("invalid --max-body-size", fmt.Errorf("must not be negative"))
+	}
+
+	syncPolicy, err := inventory.ParseSyncPolicy(b.recordingConfig.Fsync)
+	if err != nil {
+		return nil, nil, types.NewValidationError("invalid --fsync", err)
+	}
+
+	var postProcess postprocess.Pipeline
+	for _, line := range b.recordingConfig.PostProcess {
+		command, err := postprocess.ParseCommand(line)
+		if err != nil {
+			return nil, nil, types.NewValidationError("invalid --post-process", err)
+		}
+		postProcess = append(postProcess, command)
+	}
+
+	if b.recordingConfig.KeepOriginals && !b.recordingConfig.NormalizeJSON {
+		return nil, nil, types.NewValidationError("invalid --keep-originals", fmt.Errorf("only files normalized with --normalize-json have originals"))
+	}
+
+	if b.recordingConfig.Append && (b.recordingConfig.RotateEvery > 0 || b.recordingConfig.RotateSize > 0) {
+		return nil, nil, types.NewValidationError("invalid --append", fmt.Errorf("rotated recordings always continue after the segments of earlier runs"))
+	}
+
+	if b.recordingConfig.OnExitSaveTimeout < 0 {
+		return nil, nil, types.NewValidationError("invalid --on-exit-save-timeout", fmt.Errorf("%s is negative", b.recordingConfig.OnExitSaveTimeout))
+	}
+	if b.recordingConfig.AutosaveCount < 0 {
+		return nil, nil, types.NewValidationError("invalid --autosave-count", fmt.Errorf("%d is negative", b.recordingConfig.AutosaveCount))
+	}
+	if (b.recordingConfig.AutosaveInterval > 0 || b.recordingConfig.AutosaveCount > 0) && (b.recordingConfig.RotateEvery > 0 || b.recordingConfig.RotateSize > 0) {
+		return nil, nil, types.NewValidationError("invalid --autosave-interval", fmt.Errorf("rotated recordings are saved segment by segment"))
+	}
+
+	var redaction *inventory.Redaction
+	if b.recordingConfig.RedactConfig != "" {
+		if redaction, err = inventory.LoadRedaction(b.recordingConfig.RedactConfig); err != nil {
+			return nil, nil, types.NewValidationError("invalid --redact-config", err).
+				WithContext("path", b.recordingConfig.RedactConfig)
+		}
+	} else if b.recordingConfig.Redact {
+		if redaction, err = inventory.NewRedaction(nil); err != nil {
+			return nil, nil, types.NewValidationError("invalid --redact", err)
+		}
+	}
+
+	resolverName := ""
+	if b.recordingConfig.DNS != "" {
+		if resolverName, err = resolver.Install(b.recordingConfig.DNS); err != nil {
+			return nil, nil, types.NewValidationError("invalid --dns", err)
+		}
+		b.logger.Info("Resolving upstream hosts with a custom resolver", slog.String("resolver", resolverName))
+	}
+
 	// Create recording plugin
-	plugin, err := plugins.NewRecordingPluginWithInventoryDir(targetURL, b.inventoryDir, noBeautify)
+	plugin, err := plugins.NewRecordingPluginWithOptions(targetURL, b.inventoryDir, plugins.RecordingOptions{
+		NoBeautify:       noBeautify,
+		SplitByDomain:    b.recordingConfig.SplitByDomain,
+		Credentials:      injector,
+		TagClients:       b.recordingConfig.TagClients,
+		Sampling:         samplingRules,
+		PostProcess:      postProcess,
+		FollowRedirects:  b.recordingConfig.FollowRedirects,
+		MinFreeBytes:     uint64(b.recordingConfig.MinFreeSpace) * 1024 * 1024,
+		Sync:             syncPolicy,
+		RotateInterval:   b.recordingConfig.RotateEvery,
+		RotateBytes:      int64(b.recordingConfig.RotateSize) * 1024 * 1024,
+		Resolver:         resolverName,
+		NormalizeJSON:    b.recordingConfig.NormalizeJSON,
+		KeepOriginals:    b.recordingConfig.KeepOriginals,
+		Append:           b.recordingConfig.Append,
+		AutosaveInterval: b.recordingConfig.AutosaveInterval,
+		AutosaveCount:    b.recordingConfig.AutosaveCount,
+		IncludeDomains:   b.recordingConfig.IncludeDomains,
+		ExcludeDomains:   b.recordingConfig.ExcludeDomains,
+		IncludeURLs:      b.recordingConfig.IncludeURLs,
+		ExcludeURLs:      b.recordingConfig.ExcludeURLs,
+		KeepRepeats:      b.recordingConfig.KeepRepeats,
+		MaxBodySize:      int64(b.recordingConfig.MaxBodySize) * 1024 * 1024,
+		SkipContentTypes: b.recordingConfig.SkipContentTypes,
+		Redaction:        redaction,
+		StripAltSvc:      b.recordingConfig.StripAltSvc,
+	})
 	if err != nil {
 		return nil, nil, types.NewValidationError("failed to create recording plugin", err)
 	}
 
+	if b.adminServer != nil {
+		registerRecordingAdminRoutes(b.adminServer, plugin)
+	}
+
 	// Add the plugin
 	p.AddAddon(plugin)
+	if err := httputil.InterceptWebSockets(p, plugin); err != nil {
+		return nil, nil, types.NewNetworkError("failed to intercept WebSockets", err)
+	}
 
 	b.logger.LogInventoryAction("recording_start", b.inventoryDir, 0)
 	b.logger.Info("Recording mode initialized",
@@ -99,21 +352,62 @@ func (b *ProxyBuilder) BuildRecordingProxy(targetURL string, noBeautify bool) (*
 	return p, plugin, nil
 }
 
+// buildCredentials parses the credentials injected into recording upstream requests.
+// Credentials without a domain apply to the host of the target URL only.
+func (b *ProxyBuilder) buildCredentials(targetURL string) (*credentials.Injector, error) {
+	if len(b.recordingConfig.AuthHeaders) == 0 && len(b.recordingConfig.BasicAuth) == 0 {
+		return nil, nil
+	}
+
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, types.NewValidationError("invalid target URL", err)
+	}
+	defaultHost := parsedURL.Hostname()
+
+	var rules []credentials.Rule
+	for _, spec := range b.recordingConfig.AuthHeaders {
+		rule, err := credentials.ParseHeader(spec, defaultHost)
+		if err != nil {
+			return nil, types.NewValidationError("invalid --auth-header", err)
+		}
+		rules = append(rules, rule)
+	}
+	for _, spec := range b.recordingConfig.BasicAuth {
+		rule, err := credentials.ParseBasicAuth(spec, defaultHost)
+		if err != nil {
+			return nil, types.NewValidationError("invalid --basic-auth", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	for _, rule := range rules {
+		b.logger.Info("Credentials configured", slog.String("domain", rule.Host), slog.String("header", rule.Header))
+	}
+	return credentials.NewInjector(rules), nil
+}
+
 // BuildPlaybackProxy creates a playback proxy
-func (b *ProxyBuilder) BuildPlaybackProxy() (*proxy.Proxy, error) {
+func (b *ProxyBuilder) BuildPlaybackProxy() (*proxy.Proxy, *plugins.PlaybackPlugin, error) {
 	p, err := b.Build()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Create playback plugin
-	plugin, err := plugins.NewPlaybackPluginWithInventoryDir(b.inventoryDir)
+	plugin, err := b.buildPlaybackPlugin()
 	if err != nil {
-		return nil, types.NewInventoryError("failed to create playback plugin", err)
+		return nil, nil, err
+	}
+
+	if b.adminServer != nil {
+		registerPlaybackAdminRoutes(b.adminServer, plugin)
 	}
 
 	// Add the plugin
 	p.AddAddon(plugin)
+	if err := httputil.InterceptWebSockets(p, plugin); err != nil {
+		return nil, nil, types.NewNetworkError("failed to intercept WebSockets", err)
+	}
 
 	// Get resource count from plugin
 	resourceCount := plugin.GetTransactionCount()
@@ -123,7 +417,163 @@ func (b *ProxyBuilder) BuildPlaybackProxy() (*proxy.Proxy, error) {
 		slog.String("inventory_dir", b.inventoryDir),
 		slog.Int("resource_count", resourceCount))
 
-	return p, nil
+	return p, plugin, nil
+}
+
+// BuildPlaybackPlan loads the inventory, scenario and policies like playback does, without creating a proxy
+func (b *ProxyBuilder) BuildPlaybackPlan() (*plugins.PlaybackPlugin, error) {
+	if err := b.setupLogger(); err != nil {
+		return nil, fmt.Errorf("failed to setup logger: %w", err)
+	}
+	return b.buildPlaybackPlugin()
+}
+
+// buildPlaybackPlugin creates the playback plugin with its scenario tracker and classifier
+func (b *ProxyBuilder) buildPlaybackPlugin() (*plugins.PlaybackPlugin, error) {
+	// Custom profiles come first, so --profile, the schedule and PUT /conditions can name them
+	if b.playbackConfig.ProfilesFile != "" {
+		if err := network.LoadPresets(b.playbackConfig.ProfilesFile); err != nil {
+			return nil, types.NewValidationError("failed to load profiles", err).
+				WithContext("path", b.playbackConfig.ProfilesFile)
+		}
+	}
+
+	var profile *network.Profile
+	if b.playbackConfig.Profile != "" {
+		preset, err := network.LookupPreset(b.playbackConfig.Profile)
+		if err != nil {
+			return nil, types.NewValidationError("invalid --profile", err)
+		}
+		profile = &preset
+	}
+
+	var faults []network.FaultRule
+	for _, spec := range b.playbackConfig.FaultPresets {
+		preset, err := network.ParseFaultPreset(spec)
+		if err != nil {
+			return nil, types.NewValidationError("invalid --fault-preset", err)
+		}
+		faults = append(faults, preset...)
+	}
+
+	urlMatching := urlmatch.Options{
+		IgnoreParams: b.playbackConfig.IgnoreQueryParams,
+		IgnoreQuery:  b.playbackConfig.IgnoreQuery,
+	}
+	for _, spec := range b.playbackConfig.MatchRewrites {
+		rewrite, err := urlmatch.ParseRewrite(spec)
+		if err != nil {
+			return nil, types.NewValidationError("invalid --match-rewrite", err)
+		}
+		urlMatching.Rewrites = append(urlMatching.Rewrites, rewrite)
+	}
+	urlMatcher, err := urlmatch.New(urlMatching)
+	if err != nil {
+		return nil, types.NewValidationError("invalid --ignore-query-param", err)
+	}
+	hostMap, err := urlmatch.ParseHostMap(b.playbackConfig.MapHosts)
+	if err != nil {
+		return nil, types.NewValidationError("invalid --map-host", err)
+	}
+
+	if b.playbackConfig.Strict && (b.playbackConfig.StrictStatus < 100 || b.playbackConfig.StrictStatus > 599) {
+		return nil, types.NewValidationError("invalid --strict-status", fmt.Errorf("%d is not an HTTP status code", b.playbackConfig.StrictStatus))
+	}
+	if b.playbackConfig.Strict && b.playbackConfig.RecordMisses {
+		return nil, types.NewValidationError("invalid --record-misses", fmt.Errorf("unrecorded requests are not sent upstream with --strict"))
+	}
+	if b.playbackConfig.InMemory && b.inventoryFiles == nil {
+		return nil, types.NewValidationError("invalid --in-memory", fmt.Errorf("only a packed inventory fetched with --inventory-url is loaded into memory"))
+	}
+	if b.inventoryFiles != nil && b.playbackConfig.RecordMisses {
+		return nil, types.NewValidationError("invalid --record-misses", fmt.Errorf("an inventory held in memory with --in-memory is not written to"))
+	}
+	linkRules, err := inventory.ParseLinkRules(b.playbackConfig.LinkRules)
+	if err != nil {
+		return nil, types.NewValidationError("invalid --link-rule", err)
+	}
+	var rewrites *inventory.RewriteRules
+	if b.playbackConfig.RewriteRules != "" {
+		if rewrites, err = inventory.LoadRewriteRules(b.playbackConfig.RewriteRules); err != nil {
+			return nil, types.NewValidationError("invalid --rewrite-rules", err).
+				WithContext("path", b.playbackConfig.RewriteRules)
+		}
+	}
+
+	// Create playback plugin
+	plugin, err := plugins.NewPlaybackPluginWithOptions(b.inventoryDir, plugins.PlaybackOptions{
+		SkipTruncated:           b.playbackConfig.SkipTruncated,
+		DisableCalibration:      b.playbackConfig.DisableCalibration,
+		Checksum:                b.playbackConfig.Checksum,
+		DumpDir:                 b.playbackConfig.DumpDir,
+		AccessLog:               logging.AccessLog(),
+		PadToWireSize:           b.playbackConfig.PadToWireSize,
+		MatchPrefetch:           b.playbackConfig.MatchPrefetch,
+		MaxHeaderBytes:          b.playbackConfig.MaxHeaderBytes,
+		Profile:                 profile,
+		Faults:                  faults,
+		CompleteAtHeader:        b.playbackConfig.CompleteAtHeader,
+		EmulateTLSHandshakes:    b.playbackConfig.EmulateTLS,
+		EmulateConnections:      b.playbackConfig.EmulateConnect,
+		DisableBuiltinFallbacks: b.playbackConfig.NoBuiltinFallback,
+		MatchConcurrency:        b.playbackConfig.MatchConcurrency,
+		MatchProtocol:           b.playbackConfig.MatchProtocol,
+		URLMatcher:              urlMatcher,
+		HostMap:                 hostMap,
+		MatchRequestBody:        b.playbackConfig.MatchRequestBody,
+		Language:                b.playbackConfig.Language,
+		Repeats:                 b.playbackConfig.Repeats,
+		Strict:                  b.playbackConfig.Strict,
+		StrictStatus:            b.playbackConfig.StrictStatus,
+		RecordMisses:            b.playbackConfig.RecordMisses,
+		LinkRules:               linkRules,
+		Rewrites:                rewrites,
+		Files:                   b.inventoryFiles,
+	})
+	if err != nil {
+		return nil, types.NewInventoryError("failed to create playback plugin", err)
+	}
+
+	// Load scenario expectations if configured
+	if b.playbackConfig.ScenarioFile != "" {
+		s, err := scenario.Load(b.playbackConfig.ScenarioFile)
+		if err != nil {
+			return nil, types.NewValidationError("failed to load scenario", err).
+				WithContext("path", b.playbackConfig.ScenarioFile)
+		}
+		plugin.SetScenarioTracker(scenario.NewTracker(s))
+		b.logger.Info("Scenario loaded",
+			slog.String("path", b.playbackConfig.ScenarioFile),
+			slog.Int("expectations", len(s.Expectations)))
+	}
+
+	// Load the network condition schedule if configured; it starts with the proxy
+	if b.playbackConfig.ScheduleFile != "" {
+		schedule, err := network.LoadSchedule(b.playbackConfig.ScheduleFile)
+		if err != nil {
+			return nil, types.NewValidationError("failed to load schedule", err).
+				WithContext("path", b.playbackConfig.ScheduleFile)
+		}
+		b.schedule = schedule
+		b.logger.Info("Schedule loaded",
+			slog.String("path", b.playbackConfig.ScheduleFile),
+			slog.Int("steps", len(schedule.Steps)))
+	}
+
+	// Load request classification policies if configured
+	if b.playbackConfig.PolicyFile != "" {
+		classifier, err := classify.Load(b.playbackConfig.PolicyFile)
+		if err != nil {
+			return nil, types.NewValidationError("failed to load policies", err).
+				WithContext("path", b.playbackConfig.PolicyFile)
+		}
+		plugin.SetClassifier(classifier)
+		b.logger.Info("Policies loaded",
+			slog.String("path", b.playbackConfig.PolicyFile),
+			slog.Int("policies", len(classifier.Policies())))
+	}
+
+	return plugin, nil
 }
 
 // GetLogger returns the configured logger
@@ -136,33 +586,33 @@ func (b *ProxyBuilder) GetPort() int {
 	return b.port
 }
 
+// GetListenAddr returns the address the proxy listens on, once built
+func (b *ProxyBuilder) GetListenAddr() string {
+	return b.listenAddr
+}
+
+// GetAdminServer returns the admin API server, or nil if disabled
+func (b *ProxyBuilder) GetAdminServer() *admin.Server {
+	return b.adminServer
+}
+
 // setupLogger configures the logger
 func (b *ProxyBuilder) setupLogger() error {
-	// Parse log level
-	var level slog.Level
-	switch b.logLevel {
-	case "debug":
-		level = slog.LevelDebug
-	case "info":
-		level = slog.LevelInfo
-	case "warn", "warning":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
-	}
-
-	// Create handler
-	handler := slogcolor.NewHandler(os.Stderr, &slogcolor.Options{
-		Level:       level,
-		TimeFormat:  "15:04:05",
-		SrcFileMode: slogcolor.ShortFile,
+	err := logging.Setup(logging.Options{
+		Level:        b.logLevel,
+		ModuleLevels: b.moduleLevels,
+		Format:       b.logFormat,
+		Writer:       b.logWriter,
+
+		AccessLog:         b.accessLog,
+		AccessLogRotation: b.accessRotation,
 	})
+	if err != nil {
+		return err
+	}
 
 	// Create logger
-	b.logger = NewLogger(handler)
-	slog.SetDefault(b.logger.Logger)
+	b.logger = &Logger{Logger: slog.Default()}
 
 	// Redirect logrus logs to slog
 	SetupLogrusRedirect()
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"go-http-playback-proxy/pkg/trust"
+)
+
+// executeCertInstall installs the proxy CA into the selected trust stores
+func executeCertInstall(opts trust.Options, dryRun bool) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	certPath, err := trust.EnsureCA()
+	if err != nil {
+		return err
+	}
+
+	steps, err := trust.Plan(certPath, opts, trust.DefaultEnvironment())
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Printf("CA certificate: %s\n", certPath)
+		for _, step := range steps {
+			fmt.Printf("[%s] %s\n", step.Store, step)
+		}
+		return nil
+	}
+
+	if err := trust.Run(steps, certPath, os.Stdout); err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s\n", certPath)
+	return nil
+}
+
+// executeCertExport writes the proxy CA certificate to output, or stdout when empty
+func executeCertExport(output, format string) error {
+	var buf bytes.Buffer
+	if err := trust.ExportCA(&buf, "", format); err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote the CA certificate to %s\n", output)
+	return nil
+}
+
+// executeCertRegenerate replaces the proxy CA with a new one
+func executeCertRegenerate() error {
+	certPath, err := trust.RegenerateCA("")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Generated a new CA: %s\n", certPath)
+	fmt.Println("Run cert install again to trust it where the previous CA was installed")
+	return nil
+}
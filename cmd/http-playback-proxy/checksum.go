@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeChecksumVerify reports content files that changed since they were recorded
+func executeChecksumVerify(dir string) error {
+	pm := inventory.NewPersistenceManager(dir)
+	results, err := pm.VerifyChecksums()
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("ERROR     %s: %v\n", result.Path, result.Err)
+		case !result.OK():
+			failed++
+			fmt.Printf("MODIFIED  %s (%s)\n", result.Path, result.URL)
+		}
+	}
+
+	fmt.Printf("%d content files checked, %d modified\n", len(results), failed)
+	if failed > 0 {
+		return fmt.Errorf("%d content files do not match their recorded checksums", failed)
+	}
+	return nil
+}
+
+// executeChecksumUpdate accepts the current content files as the new reference
+func executeChecksumUpdate(dir string) error {
+	pm := inventory.NewPersistenceManager(dir)
+	updated, err := pm.UpdateChecksums()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %d checksums in %s\n", updated, dir)
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go-http-playback-proxy/pkg/diskspace"
+	"go-http-playback-proxy/pkg/httputil"
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// Doctor check statuses
+const (
+	doctorOK   = "OK"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+)
+
+const (
+	// doctorMinFreeBytes is the free space below which recording is likely to fail
+	doctorMinFreeBytes = 100 * 1024 * 1024
+	// doctorLowFreeBytes is the free space below which a warning is shown
+	doctorLowFreeBytes = 1024 * 1024 * 1024
+	// doctorMaxClockSkew is the clock difference that starts to break certificate validation
+	doctorMaxClockSkew = time.Minute
+)
+
+// doctorOptions holds the inputs of the doctor command
+type doctorOptions struct {
+	Port         int
+	Listen       string
+	AdminPort    int
+	AdminSocket  string
+	InventoryDir string
+	CheckURL     string
+	Timeout      time.Duration
+}
+
+// doctorResult is the outcome of a single diagnostic check
+type doctorResult struct {
+	Name   string
+	Status string
+	Detail string
+	Fix    string
+}
+
+// runDoctor runs all diagnostic checks
+func runDoctor(opts doctorOptions) []doctorResult {
+	results := []doctorResult{checkCACertificate()}
+	addr, err := httputil.ListenAddr(opts.Listen, opts.Port)
+	if err != nil {
+		results = append(results, doctorResult{Name: "Proxy port", Status: doctorFail, Detail: err.Error(), Fix: "Fix the --listen address"})
+	} else {
+		results = append(results, checkPort("Proxy port", addr, "--port"))
+	}
+	if opts.AdminSocket != "" {
+		results = append(results, checkPort("Admin socket", "unix:"+opts.AdminSocket, "--admin-socket"))
+	} else if opts.AdminPort > 0 {
+		adminAddr := net.JoinHostPort(httputil.LoopbackHost(addr), strconv.Itoa(opts.AdminPort))
+		results = append(results, checkPort("Admin port", adminAddr, "--admin-port"))
+	}
+	results = append(results,
+		checkInventory(opts.InventoryDir),
+		checkTempFiles(opts.InventoryDir),
+		checkDiskSpace(opts.InventoryDir),
+	)
+	results = append(results, checkUpstream(opts.CheckURL, opts.Timeout)...)
+	return results
+}
+
+// executeDoctor prints the diagnostics and returns an error if any check failed
+func executeDoctor(opts doctorOptions) error {
+	results := runDoctor(opts)
+
+	failed := 0
+	for _, result := range results {
+		fmt.Printf("[%-4s] %s: %s\n", result.Status, result.Name, result.Detail)
+		if result.Fix != "" && result.Status != doctorOK {
+			fmt.Printf("       -> %s\n", result.Fix)
+		}
+		if result.Status == doctorFail {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// caCertPath returns the location of the CA certificate generated by go-mitmproxy
+func caCertPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".mitmproxy", "mitmproxy-ca-cert.pem"), nil
+}
+
+// checkCACertificate checks that the proxy CA exists and is trusted by the system
+func checkCACertificate() doctorResult {
+	result := doctorResult{Name: "CA certificate"}
+
+	certPath, err := caCertPath()
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("cannot determine home directory: %v", err)
+		result.Fix = "Set the HOME (or USERPROFILE on Windows) environment variable"
+		return result
+	}
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		result.Status = doctorWarn
+		result.Detail = fmt.Sprintf("not found at %s", certPath)
+		result.Fix = "Start the proxy once to generate the CA, then install it into your trust store"
+		return result
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("%s is not a PEM certificate", certPath)
+		result.Fix = fmt.Sprintf("Remove %s and start the proxy again to regenerate it", filepath.Dir(certPath))
+		return result
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to parse %s: %v", certPath, err)
+		result.Fix = fmt.Sprintf("Remove %s and start the proxy again to regenerate it", filepath.Dir(certPath))
+		return result
+	}
+
+	if time.Now().After(cert.NotAfter) {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("expired on %s", cert.NotAfter.Format(time.RFC3339))
+		result.Fix = fmt.Sprintf("Remove %s, start the proxy again and reinstall the new CA", filepath.Dir(certPath))
+		return result
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err == nil {
+		_, err = cert.Verify(x509.VerifyOptions{Roots: roots})
+	}
+	if err != nil {
+		result.Status = doctorWarn
+		result.Detail = fmt.Sprintf("%s is not trusted by the system", certPath)
+		result.Fix = "Run 'http-playback-proxy cert install --system --nss' (as root for --system), or launch the browser with --ignore-certificate-errors"
+		return result
+	}
+
+	result.Status = doctorOK
+	result.Detail = fmt.Sprintf("%s is installed and trusted", certPath)
+	return result
+}
+
+// checkPort checks that a TCP address or Unix socket can be bound
+func checkPort(name string, addr string, flag string) doctorResult {
+	result := doctorResult{Name: name}
+
+	listener, err := httputil.Listen(addr)
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("%s is not available: %v", addr, err)
+		result.Fix = fmt.Sprintf("Stop the process using %s or choose another address with %s", addr, flag)
+		return result
+	}
+	listener.Close()
+
+	result.Status = doctorOK
+	result.Detail = fmt.Sprintf("%s is available", addr)
+	return result
+}
+
+// checkInventory checks that the inventory can be read and its content files exist
+func checkInventory(inventoryDir string) doctorResult {
+	result := doctorResult{Name: "Inventory"}
+
+	inventoryPath := filepath.Join(inventoryDir, "inventory.json")
+	data, err := os.ReadFile(inventoryPath)
+	if os.IsNotExist(err) {
+		result.Status = doctorWarn
+		result.Detail = fmt.Sprintf("%s does not exist yet", inventoryPath)
+		result.Fix = "Run the recording command before playback, or point --inventory-dir at an existing inventory"
+		return result
+	}
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to read %s: %v", inventoryPath, err)
+		result.Fix = "Check the file permissions of the inventory directory"
+		return result
+	}
+
+	inv, err := inventory.DecodeInventory(data)
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to parse %s: %v", inventoryPath, err)
+		result.Fix = "Fix the JSON syntax or record the site again"
+		return result
+	}
+
+	missing := 0
+	for _, resource := range inv.Resources {
+		if resource.ContentFilePath == nil {
+			continue
+		}
+		contentPath := inventory.ContentFile(inventoryDir, *resource.ContentFilePath)
+		if _, err := os.Stat(contentPath); err != nil {
+			missing++
+		}
+	}
+	if missing > 0 {
+		result.Status = doctorWarn
+		result.Detail = fmt.Sprintf("%d resources, %d content files missing", len(inv.Resources), missing)
+		result.Fix = "Restore the contents directory or record the site again; resources without content are skipped during playback"
+		return result
+	}
+
+	result.Status = doctorOK
+	result.Detail = fmt.Sprintf("%d resources readable", len(inv.Resources))
+	return result
+}
+
+// checkTempFiles checks for temporary files left in the inventory by an interrupted write
+func checkTempFiles(inventoryDir string) doctorResult {
+	result := doctorResult{Name: "Temporary files"}
+
+	orphans, err := inventory.NewPersistenceManager(inventoryDir).FindOrphanedTempFiles()
+	if err != nil {
+		result.Status = doctorWarn
+		result.Detail = err.Error()
+		return result
+	}
+	if len(orphans) > 0 {
+		result.Status = doctorWarn
+		result.Detail = fmt.Sprintf("%d left by an interrupted write, e.g. %s", len(orphans), orphans[0])
+		result.Fix = "Delete them; the files they were replacing were not modified"
+		return result
+	}
+
+	result.Status = doctorOK
+	result.Detail = "none"
+	return result
+}
+
+// checkDiskSpace checks that there is room to record into the inventory directory
+func checkDiskSpace(inventoryDir string) doctorResult {
+	result := doctorResult{Name: "Disk space"}
+
+	free, err := diskspace.Available(inventoryDir)
+	if err != nil {
+		result.Status = doctorWarn
+		result.Detail = fmt.Sprintf("cannot determine free space: %v", err)
+		return result
+	}
+
+	detail := fmt.Sprintf("%.1f GB free for %s", float64(free)/(1024*1024*1024), inventoryDir)
+	switch {
+	case free < doctorMinFreeBytes:
+		result.Status = doctorFail
+		result.Detail = detail
+		result.Fix = "Free up disk space or record into a different --inventory-dir"
+	case free < doctorLowFreeBytes:
+		result.Status = doctorWarn
+		result.Detail = detail
+		result.Fix = "Large sites may not fit; free up disk space or use a different --inventory-dir"
+	default:
+		result.Status = doctorOK
+		result.Detail = detail
+	}
+	return result
+}
+
+// checkUpstream checks connectivity to checkURL and compares its Date header with the local clock
+func checkUpstream(checkURL string, timeout time.Duration) []doctorResult {
+	connectivity := doctorResult{Name: "Upstream connectivity"}
+	clock := doctorResult{Name: "Clock skew"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, checkURL, nil)
+	if err != nil {
+		connectivity.Status = doctorFail
+		connectivity.Detail = fmt.Sprintf("invalid URL %q: %v", checkURL, err)
+		connectivity.Fix = "Pass a valid URL with --check-url"
+		return []doctorResult{connectivity}
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		connectivity.Status = doctorFail
+		connectivity.Detail = fmt.Sprintf("request to %s failed: %v", checkURL, err)
+		connectivity.Fix = "Check your network, DNS and HTTP_PROXY/HTTPS_PROXY settings; recording needs direct access to the target site"
+		return []doctorResult{connectivity}
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	elapsed := time.Since(start)
+
+	connectivity.Status = doctorOK
+	connectivity.Detail = fmt.Sprintf("%s responded %d in %v", checkURL, resp.StatusCode, elapsed.Round(time.Millisecond))
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		clock.Status = doctorWarn
+		clock.Detail = "upstream did not send a Date header"
+		clock.Fix = "Use --check-url with a server that sends a Date header"
+		return []doctorResult{connectivity, clock}
+	}
+
+	// The Date header has second precision and was generated during the request
+	skew := time.Since(serverTime) - elapsed/2
+	if skew < 0 {
+		skew = -skew
+	}
+	clock.Detail = fmt.Sprintf("local clock differs from %s by %v", req.URL.Host, skew.Round(time.Second))
+	if skew > doctorMaxClockSkew {
+		clock.Status = doctorWarn
+		clock.Fix = "Synchronize the system clock (NTP); a skewed clock makes browsers reject the proxy's certificates"
+	} else {
+		clock.Status = doctorOK
+	}
+	return []doctorResult{connectivity, clock}
+}
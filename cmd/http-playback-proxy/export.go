@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go-http-playback-proxy/pkg/export"
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeExportOpenAPI writes a draft OpenAPI document inferred from recorded JSON responses
+func executeExportOpenAPI(inventoryDir, output, title string) error {
+	pm := inventory.NewPersistenceManager(inventoryDir)
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		return err
+	}
+
+	doc, err := export.OpenAPI(inv, pm.ReadContent, title)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal OpenAPI document: %w", err)
+	}
+	data = append(data, '\n')
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write OpenAPI document: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d paths to %s\n", len(doc.Paths), output)
+	return nil
+}
+
+// executeExportStatic writes the inventory as a static file bundle
+func executeExportStatic(inventoryDir, outputDir string) error {
+	pm := inventory.NewPersistenceManager(inventoryDir)
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		return err
+	}
+
+	result, err := export.Static(inv, pm.ReadContent, outputDir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d files to %s (%d resources skipped)\n", len(result.Files), outputDir, result.Skipped)
+	return nil
+}
+
+// executeExportK6 writes a k6 load test skeleton replaying the recorded request sequence
+func executeExportK6(inventoryDir, output string, batchWindow time.Duration) error {
+	inv, err := inventory.NewPersistenceManager(inventoryDir).LoadInventory()
+	if err != nil {
+		return err
+	}
+
+	result, err := export.K6(inv, export.K6Options{BatchWindow: batchWindow})
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.WriteString(result.Script)
+		return err
+	}
+	if err := os.WriteFile(output, []byte(result.Script), 0644); err != nil {
+		return fmt.Errorf("failed to write k6 script: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d requests in %d batches to %s\n", result.Requests, result.Batches, output)
+	return nil
+}
+
+// executeExportHAR writes the inventory as an HTTP Archive
+func executeExportHAR(inventoryDir, output string) error {
+	archive, err := inventory.NewPersistenceManager(inventoryDir).ExportHAR()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal HAR: %w", err)
+	}
+	data = append(data, '\n')
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d entries to %s\n", len(archive.Log.Entries), output)
+	return nil
+}
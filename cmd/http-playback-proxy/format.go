@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"go-http-playback-proxy/pkg/formatting"
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeFmt re-runs the content optimizer over an existing inventory
+func executeFmt(inventoryDir, mode string, dryRun bool, indentSize int) error {
+	config := formatting.DefaultOptimizerConfig()
+	config.IndentSize = indentSize
+
+	pm := inventory.NewPersistenceManager(inventoryDir)
+	results, err := pm.FormatContents(inventory.FormatOptions{
+		Mode:   mode,
+		DryRun: dryRun,
+		Config: config,
+	})
+	if err != nil {
+		return err
+	}
+
+	changed, failed := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			fmt.Printf("error     %s: %v\n", result.Path, result.Err)
+		case !result.Changed:
+			continue
+		case dryRun:
+			changed++
+			fmt.Print(result.Diff)
+		default:
+			changed++
+			fmt.Printf("formatted %s (%d -> %d bytes)\n", result.Path, result.BeforeSize, result.AfterSize)
+		}
+	}
+
+	verb := "formatted"
+	if dryRun {
+		verb = "would be formatted"
+	}
+	fmt.Printf("%d of %d files %s\n", changed, len(results), verb)
+
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) could not be formatted", failed)
+	}
+	return nil
+}
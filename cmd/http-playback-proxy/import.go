@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go-http-playback-proxy/pkg/har"
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeImportHAR creates an inventory from a HAR file captured outside the proxy
+func executeImportHAR(inventoryDir, file string, noBeautify bool) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read HAR file: %w", err)
+	}
+	var archive har.HAR
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return fmt.Errorf("failed to parse HAR file: %w", err)
+	}
+
+	imported, err := inventory.TransactionsFromHAR(&archive)
+	if err != nil {
+		return err
+	}
+	if len(imported.Transactions) == 0 {
+		return fmt.Errorf("no HTTP entries in %s", file)
+	}
+
+	pm := inventory.NewPersistenceManager(inventoryDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(imported.Transactions, imported.EntryURL, noBeautify); err != nil {
+		return fmt.Errorf("failed to save inventory: %w", err)
+	}
+
+	fmt.Printf("Imported %d entries into %s (%d skipped)\n", len(imported.Transactions), inventoryDir, imported.Skipped)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeLocalizeExport writes the translatable texts of an inventory as CSV
+func executeLocalizeExport(inventoryDir, output string) error {
+	entries, err := inventory.NewPersistenceManager(inventoryDir).ExtractTexts()
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return inventory.WriteTextsCSV(os.Stdout, entries)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create CSV file: %w", err)
+	}
+	if err := inventory.WriteTextsCSV(file, entries); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write CSV file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d texts to %s\n", len(entries), output)
+	return nil
+}
+
+// executeLocalizeImport writes a copy of the inventory with the translations of a CSV applied
+func executeLocalizeImport(inventoryDir, csvPath, outputDir string) error {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	translations, err := inventory.ReadTranslationsCSV(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	report, err := inventory.NewPersistenceManager(inventoryDir).Localize(outputDir, translations)
+	if err != nil {
+		return err
+	}
+	for _, stale := range report.Stale {
+		fmt.Printf("stale     %s %s %s: %q\n", stale.Method, stale.URL, stale.Key, stale.Text)
+	}
+	fmt.Printf("Translated %d texts in %d resources into %s (%d stale)\n", report.Translated, report.Resources, outputDir, len(report.Stale))
+	return nil
+}
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/sirupsen/logrus"
+	"go-http-playback-proxy/pkg/logging"
 )
 
+// mitmproxyLogger receives the logs of go-mitmproxy
+var mitmproxyLogger = logging.For(logging.ModuleProxy)
+
 // LogrusToSlogHook redirects logrus logs to slog
 type LogrusToSlogHook struct{}
 
@@ -38,7 +43,7 @@ func (hook *LogrusToSlogHook) Fire(entry *logrus.Entry) error {
 	}
 
 	// Log to slog
-	slog.LogAttrs(nil, level, entry.Message, attrs...)
+	mitmproxyLogger.LogAttrs(context.Background(), level, entry.Message, attrs...)
 
 	return nil
 }
@@ -3,9 +3,15 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/alecthomas/kong"
+	"go-http-playback-proxy/pkg/completion"
 	"go-http-playback-proxy/pkg/config"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/logging"
+	"go-http-playback-proxy/pkg/mount"
+	"go-http-playback-proxy/pkg/trust"
 )
 
 func main() {
@@ -16,11 +22,95 @@ func main() {
 		kong.UsageOnError(),
 	)
 
+	moduleLevels, err := logging.ParseModuleLevels(cli.LogModule)
+	if err != nil {
+		ctx.FatalIfErrorf(err)
+	}
+
 	// Create proxy builder
+	playbackConfig := config.DefaultConfig().Playback
+	playbackConfig.ScenarioFile = cli.Playback.Scenario
+	playbackConfig.PolicyFile = cli.Playback.Policies
+	playbackConfig.SkipTruncated = cli.Playback.Truncated == "skip"
+	playbackConfig.DisableCalibration = cli.Playback.NoCalibrate
+	playbackConfig.Checksum = cli.Playback.Checksum
+	playbackConfig.DumpDir = cli.Playback.DumpDir
+	playbackConfig.PadToWireSize = cli.Playback.PadToRecordedSize
+	playbackConfig.MatchPrefetch = cli.Playback.MatchPrefetch
+	playbackConfig.MaxHeaderBytes = cli.Playback.MaxHeaderBytes
+	playbackConfig.Profile = cli.Playback.Profile
+	playbackConfig.ProfilesFile = cli.Playback.Profiles
+	playbackConfig.FaultPresets = cli.Playback.FaultPreset
+	playbackConfig.ScheduleFile = cli.Playback.Schedule
+	playbackConfig.EmulateTLS = cli.Playback.EmulateTLS
+	playbackConfig.EmulateConnect = cli.Playback.EmulateConnect
+	playbackConfig.NoBuiltinFallback = cli.Playback.NoBuiltinFallback
+	playbackConfig.MatchConcurrency = cli.Playback.MatchConcurrency
+	playbackConfig.MatchProtocol = cli.Playback.MatchProtocol
+	playbackConfig.IgnoreQueryParams = cli.Playback.IgnoreQueryParam
+	playbackConfig.IgnoreQuery = cli.Playback.IgnoreQuery
+	playbackConfig.MatchRewrites = cli.Playback.MatchRewrite
+	playbackConfig.MapHosts = cli.Playback.MapHost
+	playbackConfig.MatchRequestBody = cli.Playback.MatchBody
+	playbackConfig.Language = cli.Playback.Language
+	playbackConfig.Repeats = cli.Playback.Repeats
+	playbackConfig.Strict = cli.Playback.Strict
+	playbackConfig.StrictStatus = cli.Playback.StrictStatus
+	playbackConfig.RecordMisses = cli.Playback.RecordMisses
+	playbackConfig.LinkRules = cli.Playback.LinkRule
+	playbackConfig.RewriteRules = cli.Playback.RewriteRules
+	playbackConfig.MeasureCodecs = cli.Playback.MeasureCodecs
+	playbackConfig.InMemory = cli.Playback.InMemory
+	playbackConfig.CompleteAtHeader = cli.Playback.CompleteAtHeader
+	playbackConfig.Preload = cli.Playback.Preload
+
+	recordingConfig := config.DefaultConfig().Recording
+	recordingConfig.SplitByDomain = cli.Recording.SplitByDomain
+	recordingConfig.AuthHeaders = cli.Recording.AuthHeader
+	recordingConfig.BasicAuth = cli.Recording.BasicAuth
+	recordingConfig.TagClients = cli.Recording.TagClients
+	recordingConfig.Sampling = cli.Recording.Sample
+	recordingConfig.PostProcess = cli.Recording.PostProcess
+	recordingConfig.FollowRedirects = cli.Recording.FollowRedirectsOnRecord
+	recordingConfig.MinFreeSpace = cli.Recording.MinFreeSpace
+	recordingConfig.Fsync = cli.Recording.Fsync
+	recordingConfig.RotateEvery = cli.Recording.RotateEvery
+	recordingConfig.RotateSize = cli.Recording.RotateSize
+	recordingConfig.DNS = cli.Recording.DNS
+	recordingConfig.NormalizeJSON = cli.Recording.NormalizeJSON
+	recordingConfig.KeepOriginals = cli.Recording.KeepOriginals
+	recordingConfig.Append = cli.Recording.Append
+	recordingConfig.AutosaveInterval = cli.Recording.AutosaveInterval
+	recordingConfig.AutosaveCount = cli.Recording.AutosaveCount
+	recordingConfig.OnExitSaveTimeout = cli.Recording.OnExitSaveTimeout
+	recordingConfig.IncludeDomains = cli.Recording.IncludeDomains
+	recordingConfig.ExcludeDomains = cli.Recording.ExcludeDomains
+	recordingConfig.IncludeURLs = cli.Recording.IncludeURL
+	recordingConfig.ExcludeURLs = cli.Recording.ExcludeURL
+	recordingConfig.KeepRepeats = cli.Recording.KeepRepeats
+	recordingConfig.MaxBodySize = cli.Recording.MaxBodySize
+	recordingConfig.SkipContentTypes = cli.Recording.SkipContentTypes
+	recordingConfig.Redact = cli.Recording.Redact
+	recordingConfig.RedactConfig = cli.Recording.RedactConfig
+	recordingConfig.StripAltSvc = cli.Recording.StripAltSvc
+
 	builder := NewProxyBuilder().
 		WithPort(cli.Port).
+		WithListen(cli.Listen).
 		WithInventoryDir(cli.InventoryDir).
-		WithLogLevel(cli.LogLevel)
+		WithLogLevel(cli.LogLevel).
+		WithLogFormat(cli.LogFormat).
+		WithModuleLogLevels(moduleLevels).
+		WithAccessLog(cli.AccessLog, logging.RotateOptions{
+			MaxSize:  int64(cli.AccessLogMaxSize) * 1024 * 1024,
+			MaxAge:   cli.AccessLogMaxAge,
+			Keep:     cli.AccessLogKeep,
+			Compress: cli.AccessLogCompress,
+		}).
+		WithAdminPort(cli.AdminPort).
+		WithAdminSocket(cli.AdminSocket).
+		WithRecordingConfig(recordingConfig).
+		WithPlaybackConfig(playbackConfig)
 
 	// Execute command
 	switch ctx.Command() {
@@ -31,11 +121,200 @@ func main() {
 		}
 		
 	case "playback":
-		if err := executePlayback(builder); err != nil {
+		if cli.Playback.InventoryURL != "" {
+			var memoryBudget int64
+			if cli.Playback.InMemory {
+				memoryBudget = int64(cli.Playback.MemoryBudget) * 1024 * 1024
+			}
+			files, err := syncRemoteInventory(cli.InventoryDir, cli.Playback.InventoryURL, cli.Playback.InventoryChecksum, cli.Playback.InventoryPubkey, cli.Playback.InMemory, memoryBudget)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			builder.WithInventoryFiles(files)
+		}
+		run := executePlayback
+		if cli.Playback.Plan {
+			run = executePlaybackPlan
+		} else if cli.Playback.MeasureEncoding {
+			run = executeMeasureEncoding
+		}
+		if err := run(builder); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 		
+	case "fmt beautify", "fmt minify":
+		mode := strings.TrimPrefix(ctx.Command(), "fmt ")
+		if err := executeFmt(cli.InventoryDir, mode, cli.Fmt.DryRun, cli.Fmt.IndentSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export openapi":
+		if err := executeExportOpenAPI(cli.InventoryDir, cli.Export.Openapi.Output, cli.Export.Openapi.Title); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export k6":
+		if err := executeExportK6(cli.InventoryDir, cli.Export.K6.Output, cli.Export.K6.BatchWindow); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export har":
+		if err := executeExportHAR(cli.InventoryDir, cli.Export.Har.Output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "import har <file>":
+		if err := executeImportHAR(cli.InventoryDir, cli.Import.Har.File, cli.Import.Har.NoBeautify); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export static <dir>":
+		if err := executeExportStatic(cli.InventoryDir, cli.Export.Static.Dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "normalize-timing":
+		opts := normalizeTimingOptions{
+			Percentile: cli.NormalizeTiming.Percentile,
+			TTFB:       cli.NormalizeTiming.TTFB,
+			MBPS:       cli.NormalizeTiming.Mbps,
+			DryRun:     cli.NormalizeTiming.DryRun,
+		}
+		if err := executeNormalizeTiming(cli.InventoryDir, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "rewrite-urls":
+		opts := inventory.RewriteOptions{
+			From:   cli.RewriteUrls.From,
+			To:     cli.RewriteUrls.To,
+			DryRun: cli.RewriteUrls.DryRun,
+		}
+		if err := executeRewriteURLs(cli.InventoryDir, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "split-clients":
+		if err := executeSplitClients(cli.InventoryDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "preloads":
+		if err := executePreloads(cli.InventoryDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "checksum verify":
+		if err := executeChecksumVerify(cli.InventoryDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "checksum update":
+		if err := executeChecksumUpdate(cli.InventoryDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "profiles list":
+		if err := executeProfilesList(os.Stdout, cli.Profiles.List.Profiles); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "cert install":
+		opts := trust.Options{
+			System:        cli.Cert.Install.System,
+			NSS:           cli.Cert.Install.Nss,
+			Java:          cli.Cert.Install.Java,
+			NSSDatabases:  cli.Cert.Install.NssDb,
+			JavaKeystore:  cli.Cert.Install.JavaKeystore,
+			JavaStorePass: cli.Cert.Install.JavaStorepass,
+		}
+		if err := executeCertInstall(opts, cli.Cert.Install.DryRun); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "cert export":
+		if err := executeCertExport(cli.Cert.Export.Output, cli.Cert.Export.Format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "cert regenerate":
+		if err := executeCertRegenerate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "localize export":
+		if err := executeLocalizeExport(cli.InventoryDir, cli.Localize.Export.Output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "localize import <csv> <output>":
+		if err := executeLocalizeImport(cli.InventoryDir, cli.Localize.Import.CSV, cli.Localize.Import.Output); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "merge <output> <sources>":
+		if err := executeMerge(cli.Merge.Output, cli.Merge.Sources); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "mount <mountpoint>":
+		opts := mount.Options{
+			Sidecars: cli.Mount.Sidecars,
+			Debug:    cli.Mount.Debug,
+		}
+		if err := executeMount(cli.InventoryDir, cli.Mount.Mountpoint, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "completion <shell>":
+		if err := completion.Write(os.Stdout, ctx.Model, cli.Completion.Shell); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "tui":
+		if err := executeTUI(builder, cli.InventoryDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "doctor":
+		opts := doctorOptions{
+			Port:         cli.Port,
+			Listen:       cli.Listen,
+			AdminPort:    cli.AdminPort,
+			AdminSocket:  cli.AdminSocket,
+			InventoryDir: cli.InventoryDir,
+			CheckURL:     cli.Doctor.CheckURL,
+			Timeout:      cli.Doctor.Timeout,
+		}
+		if err := executeDoctor(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 	default:
 		panic("Unknown command")
 	}
@@ -44,23 +323,51 @@ func main() {
 func executeRecording(builder *ProxyBuilder, targetURL string, noBeautify bool) error {
 	// Build recording proxy
 	p, plugin, err := builder.BuildRecordingProxy(targetURL, noBeautify)
+	defer builder.Close()
 	if err != nil {
 		return err
 	}
+
+	if err := startAdminServer(builder); err != nil {
+		return err
+	}
 	
 	// Start proxy with recording plugin
-	startRecordingProxyWithShutdown(p, plugin, builder.GetPort())
+	startRecordingProxyWithShutdown(p, plugin, builder.GetListenAddr(), builder.recordingConfig.OnExitSaveTimeout, builder.Close)
 	return nil
 }
 
 func executePlayback(builder *ProxyBuilder) error {
 	// Build playback proxy
-	p, err := builder.BuildPlaybackProxy()
+	p, plugin, err := builder.BuildPlaybackProxy()
+	defer builder.Close()
 	if err != nil {
 		return err
 	}
+
+	// Bodies are loaded with the inventory; certificates are the remaining per-host first-hit cost
+	if builder.playbackConfig.Preload {
+		preloadCertificates(p, plugin.TLSHosts())
+	}
+
+	if err := startAdminServer(builder); err != nil {
+		return err
+	}
+
+	if builder.schedule != nil {
+		go runSchedule(builder.schedule, plugin.GetNetworkController())
+	}
 	
 	// Start proxy
-	startProxyWithShutdown(p, builder.GetPort())
+	startPlaybackProxyWithShutdown(p, plugin, builder.GetListenAddr(), builder.Close)
 	return nil
+}
+
+// startAdminServer starts the admin API if it is enabled
+func startAdminServer(builder *ProxyBuilder) error {
+	srv := builder.GetAdminServer()
+	if srv == nil {
+		return nil
+	}
+	return srv.Start()
 }
\ No newline at end of file
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// executeMeasureEncoding reports the size and time of encoding each resource with the codecs of
+// --measure-codecs, without starting the proxy
+func executeMeasureEncoding(builder *ProxyBuilder) error {
+	var codecs []encoding.Codec
+	for _, spec := range builder.playbackConfig.MeasureCodecs {
+		codec, err := encoding.ParseCodec(spec)
+		if err != nil {
+			return types.NewValidationError("invalid --measure-codecs", err)
+		}
+		codecs = append(codecs, codec)
+	}
+	if len(codecs) == 0 {
+		return types.NewValidationError("invalid --measure-codecs", fmt.Errorf("no codecs to measure"))
+	}
+	if builder.inventoryFiles != nil {
+		return types.NewValidationError("invalid --in-memory", fmt.Errorf("--measure-encoding reads the inventory directory"))
+	}
+
+	measurements, err := inventory.NewPersistenceManager(builder.inventoryDir).MeasureEncodings(codecs)
+	if err != nil {
+		return err
+	}
+	printEncodingMeasurements(os.Stdout, codecs, measurements)
+	return nil
+}
+
+// printEncodingMeasurements prints one row per resource and the totals of each codec
+func printEncodingMeasurements(w io.Writer, codecs []encoding.Codec, measurements []inventory.EncodingMeasurement) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"URL", "TYPE", "RECORDED", "SIZE"}
+	for _, codec := range codecs {
+		header = append(header, codec.String())
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	var totalSize int64
+	totalEncoded := make([]int64, len(codecs))
+	totalTime := make([]time.Duration, len(codecs))
+	failed := 0
+	for _, m := range measurements {
+		recorded := string(m.Recorded)
+		if recorded == "" {
+			recorded = "-"
+		}
+		row := []string{m.URL, m.ContentType, recorded, formatBytes(int64(m.Size))}
+		if m.Err != nil {
+			failed++
+			fmt.Fprintln(tw, strings.Join(append(row, "error: "+m.Err.Error()), "\t"))
+			continue
+		}
+		totalSize += int64(m.Size)
+		for i, result := range m.Results {
+			totalEncoded[i] += int64(result.Size)
+			totalTime[i] += result.Duration
+			row = append(row, describeMeasurement(int64(m.Size), int64(result.Size), result.Duration))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	total := []string{fmt.Sprintf("TOTAL (%d resources)", len(measurements)-failed), "", "", formatBytes(totalSize)}
+	for i := range codecs {
+		total = append(total, describeMeasurement(totalSize, totalEncoded[i], totalTime[i]))
+	}
+	fmt.Fprintln(tw, strings.Join(total, "\t"))
+	tw.Flush()
+
+	if failed > 0 {
+		fmt.Fprintf(w, "%d resources could not be measured\n", failed)
+	}
+}
+
+// describeMeasurement formats an encoded size with its ratio to the original and the time taken
+func describeMeasurement(size, encoded int64, elapsed time.Duration) string {
+	ratio := 100.0
+	if size > 0 {
+		ratio = float64(encoded) * 100 / float64(size)
+	}
+	return fmt.Sprintf("%s %.0f%% %s", formatBytes(encoded), ratio, elapsed.Round(10*time.Microsecond))
+}
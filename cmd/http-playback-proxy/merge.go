@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeMerge merges several inventories (e.g. per-domain slices) into one
+func executeMerge(output string, sources []string) error {
+	pm := inventory.NewPersistenceManager(output)
+	merged, err := pm.MergeInventories(sources)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Merged %d inventories into %s (%d resources)\n", len(sources), output, len(merged.Resources))
+	return nil
+}
+
+// executeSplitClients splits an inventory recorded with --tag-clients into per-client inventories
+func executeSplitClients(dir string) error {
+	pm := inventory.NewPersistenceManager(dir)
+	dirs, err := pm.SplitByClient()
+	if errors.Is(err, inventory.ErrNoClientTags) {
+		return fmt.Errorf("%w (record with --tag-clients)", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, clientDir := range dirs {
+		fmt.Println(clientDir)
+	}
+	fmt.Printf("Split %s into %d client inventories\n", dir, len(dirs))
+	return nil
+}
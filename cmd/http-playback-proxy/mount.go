@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/mount"
+)
+
+// executeMount exposes the inventory as read-only files until interrupted
+func executeMount(inventoryDir, mountpoint string, opts mount.Options) error {
+	pm := inventory.NewPersistenceManager(inventoryDir)
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Mounted %d resources of %s at %s (press Ctrl+C to unmount)\n", len(inv.Resources), inventoryDir, mountpoint)
+	return mount.Mount(ctx, inv, pm.ReadContent, mountpoint, opts)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go-http-playback-proxy/pkg/classify"
+	"go-http-playback-proxy/pkg/config"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/network"
+	"go-http-playback-proxy/pkg/plugins"
+)
+
+// executePlaybackPlan loads everything playback would use and prints the effective routing table
+// without opening a listener
+func executePlaybackPlan(builder *ProxyBuilder) error {
+	plugin, err := builder.BuildPlaybackPlan()
+	if err != nil {
+		return err
+	}
+
+	routes := plugin.Routes()
+	printPlaybackPlan(os.Stdout, builder, plugin, routes)
+
+	modified := 0
+	for _, route := range routes {
+		if route.ChecksumMismatch {
+			modified++
+		}
+	}
+	if modified > 0 && builder.playbackConfig.Checksum == inventory.ChecksumFail {
+		return fmt.Errorf("%d resources would fail with --checksum fail", modified)
+	}
+	return nil
+}
+
+// printPlaybackPlan prints the configuration summary, the policies and the routing table
+func printPlaybackPlan(w io.Writer, builder *ProxyBuilder, plugin *plugins.PlaybackPlugin, routes []plugins.Route) {
+	cfg := builder.playbackConfig
+
+	truncated := "serve"
+	if cfg.SkipTruncated {
+		truncated = "skip"
+	}
+	calibration := "on"
+	if cfg.DisableCalibration {
+		calibration = "off"
+	}
+
+	fmt.Fprintf(w, "Playback plan for %s\n", builder.inventoryDir)
+	fmt.Fprintf(w, "  Resources:   %d (truncated: %s, checksum: %s)\n", len(routes), truncated, cfg.Checksum)
+	fmt.Fprintf(w, "  Calibration: %s\n", calibration)
+	fmt.Fprintf(w, "  Network:     %s\n", describeConditions(plugin))
+	if tracker := plugin.GetScenarioTracker(); tracker != nil {
+		fmt.Fprintf(w, "  Scenario:    %s (%d expectations)\n", cfg.ScenarioFile, len(tracker.Report().Results))
+	} else {
+		fmt.Fprintln(w, "  Scenario:    none")
+	}
+	if builder.schedule != nil {
+		fmt.Fprintf(w, "  Schedule:    %s (%d steps)\n", cfg.ScheduleFile, len(builder.schedule.Steps))
+	}
+	if cfg.Strict {
+		fmt.Fprintf(w, "  Strict:      unrecorded requests get %d, policies are not consulted\n", cfg.StrictStatus)
+	}
+	if cfg.RecordMisses {
+		fmt.Fprintln(w, "  Misses:      unrecorded requests sent upstream are appended to the inventory")
+	}
+	if cfg.Language != "" {
+		fmt.Fprintf(w, "  Language:    %s for URLs recorded in several languages\n", cfg.Language)
+	}
+	if cfg.IgnoreQuery || len(cfg.IgnoreQueryParams) > 0 || len(cfg.MatchRewrites) > 0 || cfg.MatchRequestBody {
+		fmt.Fprintf(w, "  URL match:   %s\n", describeURLMatching(cfg))
+	}
+	if len(cfg.MapHosts) > 0 {
+		fmt.Fprintf(w, "  Host map:    %s\n", strings.Join(cfg.MapHosts, ", "))
+	}
+
+	// Policies and rules; without a policy file every request uses the default policy
+	classifier := plugin.GetClassifier()
+	defaultPolicy := classifier.Default()
+	var policies []classify.Policy
+	if classifier != nil {
+		policies = classifier.Policies()
+		sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+		fmt.Fprintf(w, "  Policies:    %s\n", cfg.PolicyFile)
+	}
+	// The implicit default policy is not part of the policy file
+	listed := false
+	for _, policy := range policies {
+		listed = listed || policy.Name == defaultPolicy.Name
+	}
+	if !listed {
+		policies = append(policies, *defaultPolicy)
+	}
+
+	fmt.Fprintln(w, "\nPolicies:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, policy := range policies {
+		marker := ""
+		if policy.Templating {
+			marker = "templating "
+		}
+		if policy.Name == defaultPolicy.Name {
+			marker += "(default)"
+		}
+		fmt.Fprintf(tw, "  %s\ttiming=%s\tunrecorded=%s\t%s\n", policy.Name, policy.Timing, describeFallback(policy.Fallback), marker)
+	}
+	tw.Flush()
+
+	if rules := classifier.Rules(); len(rules) > 0 {
+		fmt.Fprintln(w, "\nRules (first match wins):")
+		for i, rule := range rules {
+			fmt.Fprintf(w, "  %d. %s -> %s\n", i+1, describeRule(rule), rule.Policy)
+		}
+	}
+
+	// Fallbacks by domain from the inventory override those of the policies
+	pm := inventory.NewPlaybackManager(builder.inventoryDir)
+	pm.Files = builder.inventoryFiles
+	if settings, err := pm.LoadSettings(); err == nil && settings != nil {
+		if len(settings.Domains) > 0 || settings.Fallback != "" {
+			fmt.Fprintln(w, "\nDomains (unrecorded requests):")
+			domains := make([]string, 0, len(settings.Domains))
+			for domain := range settings.Domains {
+				domains = append(domains, domain)
+			}
+			sort.Strings(domains)
+			tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			for _, domain := range domains {
+				fmt.Fprintf(tw, "  %s\t%s\n", domain, describeFallback(settings.Domains[domain]))
+			}
+			if settings.Fallback != "" {
+				fmt.Fprintf(tw, "  (other domains)\t%s\n", describeFallback(settings.Fallback))
+			}
+			tw.Flush()
+		}
+	}
+
+	fmt.Fprintln(w, "\nRoutes:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  METHOD\tURL\tSTATUS\tBYTES\tTTFB\tCACHE\tPOLICY\tTIMING\t")
+	for _, route := range routes {
+		note := ""
+		if route.ChecksumMismatch {
+			note = "MODIFIED"
+		}
+		cacheStatus := string(route.CacheStatus)
+		if cacheStatus == "" {
+			cacheStatus = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			route.Method, route.URL, route.Status, route.Bytes, route.TTFB.Round(time.Millisecond), cacheStatus, route.Policy, route.Timing, note)
+	}
+	tw.Flush()
+
+	if fallbacks := plugin.EncodingFallbacks(); len(fallbacks) > 0 {
+		fmt.Fprintln(w, "\nServed uncompressed (recorded encoding unavailable):")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, fallback := range fallbacks {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", fallback.URL, fallback.Encoding, fallback.Reason)
+		}
+		tw.Flush()
+	}
+}
+
+// describeConditions summarizes the network conditions playback starts with
+func describeConditions(plugin *plugins.PlaybackPlugin) string {
+	return describeNetwork(plugin.GetNetworkController().Get())
+}
+
+// describeURLMatching summarizes what is ignored when a request has no recording of its exact URL
+func describeURLMatching(cfg config.PlaybackConfig) string {
+	var parts []string
+	if cfg.IgnoreQuery {
+		parts = append(parts, "ignore query")
+	} else if len(cfg.IgnoreQueryParams) > 0 {
+		parts = append(parts, "ignore "+strings.Join(cfg.IgnoreQueryParams, ", "))
+	}
+	if len(cfg.MatchRewrites) > 0 {
+		parts = append(parts, fmt.Sprintf("%d rewrites", len(cfg.MatchRewrites)))
+	}
+	if cfg.MatchRequestBody {
+		parts = append(parts, "request body")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// describeNetwork summarizes a set of network conditions
+func describeNetwork(conditions network.Conditions) string {
+	parts := []string{fmt.Sprintf("speed x%g", conditions.SpeedFactor)}
+	if conditions.Offline() {
+		parts = append(parts, fmt.Sprintf("profile %s (offline)", conditions.Profile.Name))
+	} else if conditions.Profile != nil {
+		parts = append(parts, fmt.Sprintf("profile %s (+%dms, %g Mbps)", conditions.Profile.Name, conditions.Profile.LatencyMS, conditions.Profile.DownloadMbps))
+		if latency := conditions.Profile.CacheHitLatencyMS; latency != nil {
+			parts = append(parts, fmt.Sprintf("cache hits +%dms", *latency))
+		}
+		if latency := conditions.Profile.OriginLatencyMS; latency != nil {
+			parts = append(parts, fmt.Sprintf("origin +%dms", *latency))
+		}
+	} else {
+		parts = append(parts, "no profile")
+	}
+	parts = append(parts, fmt.Sprintf("%d fault rules", len(conditions.Faults)))
+	return strings.Join(parts, ", ")
+}
+
+// describeFallback names what happens to requests missing from the inventory
+func describeFallback(fallback string) string {
+	switch fallback {
+	case classify.FallbackBlock:
+		return "block (strict)"
+	case classify.FallbackReplayOnly:
+		return "replay-only (strict)"
+	}
+	return "passthrough (hybrid)"
+}
+
+// describeRule lists the non-empty criteria of a rule
+func describeRule(rule classify.Rule) string {
+	var criteria []string
+	if len(rule.Methods) > 0 {
+		criteria = append(criteria, "methods="+strings.Join(rule.Methods, ","))
+	}
+	if len(rule.Hosts) > 0 {
+		criteria = append(criteria, "hosts="+strings.Join(rule.Hosts, ","))
+	}
+	if len(rule.Paths) > 0 {
+		criteria = append(criteria, "paths="+strings.Join(rule.Paths, ","))
+	}
+	if len(rule.ContentTypes) > 0 {
+		criteria = append(criteria, "contentTypes="+strings.Join(rule.ContentTypes, ","))
+	}
+	names := make([]string, 0, len(rule.Headers))
+	for name := range rule.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		criteria = append(criteria, fmt.Sprintf("header %s=%s", name, rule.Headers[name]))
+	}
+	if len(criteria) == 0 {
+		return "(all requests)"
+	}
+	return strings.Join(criteria, " ")
+}
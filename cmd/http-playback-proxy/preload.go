@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// leafCertCacheSize is how many leaf certificates go-mitmproxy keeps; preloading more would evict the first
+const leafCertCacheSize = 100
+
+// preloadCertificates signs the leaf certificates of the inventory's HTTPS hosts, which go-mitmproxy
+// otherwise does on the first request to each host
+func preloadCertificates(p *proxy.Proxy, hosts []string) {
+	start := time.Now()
+	if len(hosts) > leafCertCacheSize {
+		slog.Warn("Too many hosts to preload every certificate", "hosts", len(hosts), "preloaded", leafCertCacheSize)
+		hosts = hosts[:leafCertCacheSize]
+	}
+	for _, host := range hosts {
+		if _, err := p.GetCertificateByCN(host); err != nil {
+			slog.Warn("Failed to preload certificate", "host", host, "error", err)
+		}
+	}
+	slog.Info("Preloaded TLS certificates", "hosts", len(hosts), "duration", time.Since(start))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executePreloads lists the Link hints of the recorded responses and when their targets were requested
+func executePreloads(dir string) error {
+	hints, err := inventory.NewPersistenceManager(dir).PreloadHints()
+	if err != nil {
+		return err
+	}
+	printPreloadHints(os.Stdout, hints)
+	return nil
+}
+
+// printPreloadHints prints one row per hint, with times from the request start of its document
+func printPreloadHints(w io.Writer, hints []inventory.PreloadHint) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DOCUMENT\tREL\tAS\tTARGET\tHINT\tREQUESTED\tAFTER HINT")
+	unused := 0
+	for _, hint := range hints {
+		as := hint.As
+		if as == "" {
+			as = "-"
+		}
+		hintAt := fmt.Sprintf("+%dms", hint.HintMS)
+		if hint.EarlyHints {
+			hintAt += " (103)"
+		}
+		requested, after := "never", "-"
+		if hint.RequestedMS != nil {
+			requested = fmt.Sprintf("+%dms", *hint.RequestedMS)
+			after = fmt.Sprintf("%+dms", *hint.RequestedMS-hint.HintMS)
+		} else {
+			unused++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", hint.Document, hint.Rel, as, hint.Target, hintAt, requested, after)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d hints, %d targets never requested\n", len(hints), unused)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"go-http-playback-proxy/pkg/network"
+)
+
+// executeProfilesList prints the network profiles, including those of the custom profiles file if given
+func executeProfilesList(w io.Writer, profilesFile string) error {
+	if profilesFile != "" {
+		if err := network.LoadPresets(profilesFile); err != nil {
+			return err
+		}
+	}
+	printProfiles(w)
+	return nil
+}
+
+// printProfiles lists the built-in and loaded custom network profiles, then the fault presets
+func printProfiles(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLATENCY\tDOWNLOAD\tDESCRIPTION")
+	for _, preset := range network.Presets() {
+		if preset.Offline {
+			fmt.Fprintf(tw, "%s\t-\t-\t%s\n", preset.Name, preset.Description)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%dms\t%g Mbps\t%s\n", preset.Name, preset.LatencyMS, preset.DownloadMbps, preset.Description)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FAULT PRESET\tDESCRIPTION")
+	for _, preset := range network.FaultPresets() {
+		fmt.Fprintf(tw, "%s\t%s\n", preset.Name, preset.Description)
+	}
+	tw.Flush()
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
-	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/lqqyt2423/go-mitmproxy/proxy"
 	"go-http-playback-proxy/pkg/httputil"
+	"go-http-playback-proxy/pkg/inventory"
 	"go-http-playback-proxy/pkg/plugins"
 )
 
@@ -23,29 +25,151 @@ func startProxyWithShutdown(p *proxy.Proxy, port int) {
 	httputil.StartProxyWithShutdown(p, port)
 }
 
-// startRecordingProxyWithShutdown starts the recording proxy with proper shutdown handling
-func startRecordingProxyWithShutdown(p *proxy.Proxy, plugin *plugins.RecordingPlugin, port int) {
-	slog.Info("Starting MITM proxy server in recording mode", "port", port)
-	slog.Info("Proxy settings", "url", fmt.Sprintf("http://localhost:%d", port))
+// startRecordingProxyWithShutdown starts the recording proxy with proper shutdown handling. The
+// inventory is saved on SIGINT, SIGTERM (sent by docker stop) and SIGHUP, when free disk space runs
+// low and after a recovered panic, giving up after saveTimeout (0 waits as long as it takes).
+// closeListener is called before the process exits.
+func startRecordingProxyWithShutdown(p *proxy.Proxy, plugin *plugins.RecordingPlugin, addr string, saveTimeout time.Duration, closeListener func() error) {
+	slog.Info("Starting MITM proxy server in recording mode", "addr", addr)
+	slog.Info("Proxy settings", "url", httputil.ListenURL(addr))
 
 	// シグナルハンドリング - 録画プラグインのインベントリ保存を優先
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+	var shutdown sync.Once
+	exit := func(exitCode int) {
+		shutdown.Do(func() {
+			if !saveRecording(plugin, saveTimeout) {
+				exitCode = 1
+			}
+			closeListener()
+			os.Exit(exitCode)
+		})
+	}
 
 	go func() {
-		<-c
-		slog.Info("Shutting down...")
-		
+		select {
+		case sig := <-c:
+			slog.Info("Shutting down...", "signal", sig.String())
+			exit(0)
+		case <-plugin.DiskLow():
+			// Save what was recorded while there is still room for it
+			slog.Warn("Free disk space is low, saving the inventory and shutting down")
+			exit(1)
+		case <-plugin.Panicked():
+			slog.Error("Recording panicked, saving the inventory and shutting down")
+			exit(1)
+		}
+	}()
+
+	// A panic of the proxy itself also saves what was recorded
+	defer func() {
+		if v := recover(); v != nil {
+			slog.Error("Proxy panicked, saving the inventory and shutting down", "panic", v)
+			exit(1)
+		}
+	}()
+
+	if err := p.Start(); err != nil {
+		slog.Error("Proxy start failed", "error", err)
+		closeListener()
+		os.Exit(1)
+	}
+}
+
+// saveRecording saves the inventory and waits for its beautification, giving up after timeout
+// (0 waits as long as it takes). It reports whether the recording was saved.
+func saveRecording(plugin *plugins.RecordingPlugin, timeout time.Duration) bool {
+	done := make(chan bool, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				slog.Error("Failed to save inventory on shutdown", "panic", v)
+				done <- false
+			}
+		}()
+
 		// First save the inventory
 		if err := plugin.SaveInventory(); err != nil {
 			slog.Error("Failed to save inventory on shutdown", "error", err)
+			done <- false
+			return
+		}
+		// Content is beautified in the background; the process must not exit before it is done
+		if err := plugin.WaitBeautified(); err != nil {
+			slog.Error("Failed to complete beautification", "error", err)
 		}
-		
-		os.Exit(0)
+		if summary := plugin.Summary(); summary != nil {
+			printRecordingSummary(os.Stdout, summary)
+		}
+		if segments := plugin.Segments(); segments != nil {
+			slog.Info("Recording saved in segments", "segments", len(segments.Segments), "manifest", inventory.SegmentManifestFile)
+		}
+		done <- true
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+	select {
+	case saved := <-done:
+		return saved
+	case <-expired:
+		slog.Error("Timed out saving inventory on shutdown", "timeout", timeout)
+		return false
+	}
+}
+
+// startPlaybackProxyWithShutdown starts the playback proxy and reports scenario results on shutdown.
+// closeListener is called before the process exits.
+func startPlaybackProxyWithShutdown(p *proxy.Proxy, plugin *plugins.PlaybackPlugin, addr string, closeListener func() error) {
+	slog.Info("Starting MITM proxy server in playback mode", "addr", addr)
+	slog.Info("Proxy settings", "url", httputil.ListenURL(addr))
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-c
+		slog.Info("Shutting down...")
+
+		if count := plugin.RecordedMisses(); count > 0 {
+			slog.Info("Unrecorded requests appended to the inventory", "count", count)
+		}
+
+		// Report scenario expectations; a failed scenario exits non-zero
+		exitCode := 0
+		if tracker := plugin.GetScenarioTracker(); tracker != nil {
+			report := tracker.Report()
+			for _, result := range report.Results {
+				slog.Info("Scenario expectation",
+					"name", result.Name,
+					"expected", result.Expected,
+					"count", result.Count,
+					"passed", result.Passed)
+			}
+			if !report.Passed {
+				slog.Error("Scenario verification failed")
+				exitCode = 1
+				if path, err := plugin.DumpScenarioFailure(report); err != nil {
+					slog.Error("Failed to write diagnostic bundle", "error", err)
+				} else if path != "" {
+					slog.Info("Diagnostic bundle written", "path", path)
+				}
+			} else {
+				slog.Info("Scenario verification passed")
+			}
+		}
+
+		closeListener()
+		os.Exit(exitCode)
 	}()
 
 	if err := p.Start(); err != nil {
 		slog.Error("Proxy start failed", "error", err)
+		closeListener()
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/remote"
+)
+
+// syncRemoteInventory fetches a packed inventory into dir before playback starts, or with inMemory
+// returns its files without unpacking it
+func syncRemoteInventory(dir, url, checksum, pubkey string, inMemory bool, memoryBudget int64) (inventory.MemoryFiles, error) {
+	opts := remote.Options{URL: url, Dir: dir, Checksum: checksum, InMemory: inMemory, MemoryBudget: memoryBudget}
+	if pubkey != "" {
+		// The key may be given inline or as the path of a minisign.pub file
+		if data, err := os.ReadFile(pubkey); err == nil {
+			pubkey = string(data)
+		}
+		key, err := remote.ParseMinisignKey(pubkey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --inventory-pubkey: %w", err)
+		}
+		opts.PublicKey = key
+	}
+
+	result, err := remote.Sync(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch inventory: %w", err)
+	}
+	if inMemory {
+		files := inventory.MemoryFiles(result.Files)
+		slog.Info("Packed inventory loaded into memory",
+			"url", url,
+			"sha256", result.SHA256,
+			"downloaded", result.Downloaded,
+			"files", len(files),
+			"bytes", files.Size(),
+			"estimated_memory_mb", (result.MemoryEstimate+1<<20-1)>>20)
+		return files, nil
+	}
+	slog.Info("Packed inventory ready",
+		"url", url,
+		"sha256", result.SHA256,
+		"downloaded", result.Downloaded,
+		"unpacked", result.Unpacked,
+		"directory", dir)
+	return nil, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// executeRewriteURLs moves the resources of an inventory from one URL prefix to another
+func executeRewriteURLs(dir string, opts inventory.RewriteOptions) error {
+	pm := inventory.NewPersistenceManager(dir)
+	report, err := pm.RewriteURLs(opts)
+	if report != nil {
+		for _, change := range report.Resources {
+			fmt.Printf("url       %s -> %s\n", change.Before, change.After)
+			if change.BeforePath != change.AfterPath {
+				fmt.Printf("  content %s -> %s\n", change.BeforePath, change.AfterPath)
+			}
+		}
+		for _, change := range report.Contents {
+			fmt.Printf("refs      %d in %s\n", change.References, change.URL)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "rewritten"
+	if opts.DryRun {
+		verb = "would be rewritten"
+	}
+	fmt.Printf("%d resource URLs and %d resources with references %s\n", len(report.Resources), len(report.Contents), verb)
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"go-http-playback-proxy/pkg/network"
+)
+
+// runSchedule applies the scheduled condition changes from now on. The conditions at start are
+// the base each change applies to, so a change made through the admin API lasts until the next step.
+func runSchedule(schedule *network.Schedule, controller *network.Controller) {
+	start := time.Now()
+	base := controller.Get()
+	elapsed := time.Duration(0)
+	for {
+		conditions, active := schedule.At(base, elapsed)
+		if err := controller.Set(conditions); err != nil {
+			slog.Error("Failed to apply scheduled network conditions", "error", err)
+		} else {
+			slog.Info("Scheduled network conditions applied",
+				"elapsed", elapsed.Round(time.Second),
+				"steps", active,
+				"conditions", describeNetwork(conditions))
+		}
+
+		next, ok := schedule.Next(elapsed)
+		if !ok {
+			return
+		}
+		time.Sleep(time.Until(start.Add(next)))
+		elapsed = next
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// printRecordingSummary prints the key numbers of a finished recording
+func printRecordingSummary(w io.Writer, summary *inventory.RecordingSummary) {
+	fmt.Fprintln(w, "Recording summary")
+	fmt.Fprintf(w, "  Requests:   %d (%d failed, %d truncated)\n", summary.Requests, summary.Failures, summary.Truncated)
+	fmt.Fprintf(w, "  Resources:  %d (%d duplicates discarded, %d sampled out)\n", summary.Resources, summary.Duplicates, summary.SampledOut)
+	if summary.Kept > 0 {
+		fmt.Fprintf(w, "  Kept:       %d resources of the previous inventory\n", summary.Kept)
+	}
+	fmt.Fprintf(w, "  Bytes:      %.1f MB\n", float64(summary.Bytes)/(1024*1024))
+	if summary.Omitted > 0 {
+		fmt.Fprintf(w, "  Omitted:    %d bodies recorded by size only\n", summary.Omitted)
+	}
+	if summary.CacheHits > 0 || summary.Origin > 0 {
+		fmt.Fprintf(w, "  CDN cache:  %d hits, %d from origin\n", summary.CacheHits, summary.Origin)
+	}
+	if summary.ProxyOverheadMaxMS > 0 {
+		fmt.Fprintf(w, "  Overhead:   %.3f ms average, %.3f ms max (left out of TTFB)\n", summary.ProxyOverheadAvgMS, summary.ProxyOverheadMaxMS)
+	}
+	if summary.TLSHandshakes > 0 {
+		fmt.Fprintf(w, "  TLS:        %d handshakes, %d resumed\n", summary.TLSHandshakes, summary.TLSResumed)
+	}
+	fmt.Fprintf(w, "  Beautified: %d\n", summary.Beautified)
+	if summary.Normalized > 0 {
+		fmt.Fprintf(w, "  Normalized: %d JSON files\n", summary.Normalized)
+	}
+	if summary.Scrubbed > 0 {
+		fmt.Fprintf(w, "  Scrubbed:   %d bodies\n", summary.Scrubbed)
+	}
+	fmt.Fprintf(w, "  Elapsed:    %s\n", (time.Duration(summary.ElapsedMS) * time.Millisecond).String())
+
+	domains := make([]string, 0, len(summary.Domains))
+	width := 0
+	for domain := range summary.Domains {
+		domains = append(domains, domain)
+		if len(domain) > width {
+			width = len(domain)
+		}
+	}
+	// Busiest domains first
+	sort.Slice(domains, func(i, j int) bool {
+		if summary.Domains[domains[i]] != summary.Domains[domains[j]] {
+			return summary.Domains[domains[i]] > summary.Domains[domains[j]]
+		}
+		return domains[i] < domains[j]
+	})
+	fmt.Fprintln(w, "  Domains:")
+	for _, domain := range domains {
+		fmt.Fprintf(w, "    %-*s %d\n", width, domain, summary.Domains[domain])
+	}
+
+	if len(summary.Languages) > 0 {
+		languages := make([]string, 0, len(summary.Languages))
+		for language := range summary.Languages {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+		fmt.Fprintln(w, "  Languages:")
+		for _, language := range languages {
+			fmt.Fprintf(w, "    %-*s %d\n", width, language, summary.Languages[language])
+		}
+	}
+
+	if summary.Requests == 0 || summary.Failures == summary.Requests {
+		fmt.Fprintln(w, "  Warning: no successful responses were recorded")
+	}
+	if summary.LargeHeaders > 0 {
+		fmt.Fprintf(w, "  Warning: %d requests have headers or cookies over common client limits (see headerWarnings)\n", summary.LargeHeaders)
+	}
+	if summary.StoppedLowDisk {
+		fmt.Fprintln(w, "  Warning: recording stopped early because free disk space ran low")
+	}
+}
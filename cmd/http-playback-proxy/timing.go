@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// normalizeTimingOptions holds the command line options of normalize-timing
+type normalizeTimingOptions struct {
+	Percentile float64
+	TTFB       []string
+	MBPS       []string
+	DryRun     bool
+}
+
+// executeNormalizeTiming clamps outlier timings of a recorded inventory
+func executeNormalizeTiming(dir string, opts normalizeTimingOptions) error {
+	ttfb, err := inventory.ParseTTFBOverrides(opts.TTFB)
+	if err != nil {
+		return err
+	}
+	mbps, err := inventory.ParseMBPSOverrides(opts.MBPS)
+	if err != nil {
+		return err
+	}
+
+	pm := inventory.NewPersistenceManager(dir)
+	changes, err := pm.NormalizeTiming(inventory.TimingOptions{
+		Percentile: opts.Percentile,
+		TTFB:       ttfb,
+		MBPS:       mbps,
+		DryRun:     opts.DryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		fmt.Printf("%-6s %g -> %g  %s\n", change.Field, change.Before, change.After, change.URL)
+	}
+
+	verb := "updated"
+	if opts.DryRun {
+		verb = "would be updated"
+	}
+	fmt.Printf("%d timing values %s\n", len(changes), verb)
+	return nil
+}
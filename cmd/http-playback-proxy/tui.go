@@ -0,0 +1,366 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/accesslog"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/plugins"
+	"go-http-playback-proxy/pkg/types"
+)
+
+const (
+	// tuiAccessLines is how many access log entries the UI shows
+	tuiAccessLines = 8
+	// tuiSearchDepth is how deep below the inventory directory inventories are looked for
+	// (domains/<host> and clients/<client> are two levels down)
+	tuiSearchDepth = 3
+)
+
+// tuiView is the screen shown in the list pane
+type tuiView int
+
+const (
+	viewInventories tuiView = iota
+	viewResources
+	viewHeaders
+)
+
+// tuiTickMsg refreshes the access log while playback runs
+type tuiTickMsg time.Time
+
+// tuiStoppedMsg reports that a playback proxy stopped serving
+type tuiStoppedMsg struct {
+	proxy *proxy.Proxy
+	err   error
+}
+
+// tuiPlayback is a playback proxy started from the UI
+type tuiPlayback struct {
+	dir    string
+	proxy  *proxy.Proxy
+	plugin *plugins.PlaybackPlugin
+}
+
+// tuiModel is the state of the terminal UI
+type tuiModel struct {
+	builder *ProxyBuilder
+	root    string
+	width   int
+	height  int
+	view    tuiView
+	status  string
+
+	inventories []string
+	cursor      int
+
+	opened         string
+	resources      []types.Resource
+	resourceCursor int
+
+	playback *tuiPlayback
+	access   []accesslog.Entry
+}
+
+// executeTUI runs the terminal UI over the inventories below inventoryDir
+func executeTUI(builder *ProxyBuilder, inventoryDir string) error {
+	// Logs would draw over the screen; the access log pane shows what playback does
+	builder.WithLogWriter(io.Discard)
+
+	m := &tuiModel{builder: builder, root: inventoryDir, width: 80, height: 24}
+	m.findInventories()
+
+	_, err := tea.NewProgram(m, tea.WithAltScreen()).Run()
+	if m.playback != nil {
+		m.playback.proxy.Close()
+		builder.Close()
+	}
+	return err
+}
+
+// findInventories lists the directories below the root that hold an inventory.json
+func (m *tuiModel) findInventories() {
+	m.inventories = nil
+	filepath.WalkDir(m.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			rel, _ := filepath.Rel(m.root, path)
+			if entry.Name() == "contents" || (rel != "." && strings.Count(rel, string(filepath.Separator)) >= tuiSearchDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Name() == "inventory.json" {
+			m.inventories = append(m.inventories, filepath.Dir(path))
+		}
+		return nil
+	})
+	sort.Strings(m.inventories)
+	if m.cursor >= len(m.inventories) {
+		m.cursor = max(0, len(m.inventories)-1)
+	}
+	if len(m.inventories) == 0 {
+		m.status = fmt.Sprintf("No inventory found in %s", m.root)
+	}
+}
+
+// openInventory loads the resources of an inventory, in recorded order
+func (m *tuiModel) openInventory(dir string) {
+	inv, err := inventory.NewPersistenceManager(dir).LoadInventory()
+	if err != nil {
+		m.status = fmt.Sprintf("Error: %v", err)
+		return
+	}
+	sort.SliceStable(inv.Resources, func(i, j int) bool {
+		return inv.Resources[i].Timestamp.Before(inv.Resources[j].Timestamp)
+	})
+	m.opened = dir
+	m.resources = inv.Resources
+	m.resourceCursor = 0
+	m.view = viewResources
+	m.status = fmt.Sprintf("%d resources", len(m.resources))
+}
+
+// selectedInventory is the inventory the playback key applies to
+func (m *tuiModel) selectedInventory() string {
+	if m.view != viewInventories {
+		return m.opened
+	}
+	if m.cursor < len(m.inventories) {
+		return m.inventories[m.cursor]
+	}
+	return ""
+}
+
+// togglePlayback stops the running playback, or starts one for the selected inventory
+func (m *tuiModel) togglePlayback() tea.Cmd {
+	if m.playback != nil {
+		m.playback.proxy.Close()
+		m.builder.Close()
+		m.status = fmt.Sprintf("Playback of %s stopped", m.playback.dir)
+		m.playback = nil
+		m.access = nil
+		return nil
+	}
+
+	dir := m.selectedInventory()
+	if dir == "" {
+		return nil
+	}
+	p, plugin, err := m.builder.WithInventoryDir(dir).BuildPlaybackProxy()
+	if err != nil {
+		m.builder.Close()
+		m.status = fmt.Sprintf("Error: %v", err)
+		return nil
+	}
+	m.playback = &tuiPlayback{dir: dir, proxy: p, plugin: plugin}
+	m.status = fmt.Sprintf("Playing back %s on %s (%d resources)", dir, m.builder.GetListenAddr(), plugin.GetTransactionCount())
+	return tea.Batch(
+		func() tea.Msg { return tuiStoppedMsg{proxy: p, err: p.Start()} },
+		tuiTick(),
+	)
+}
+
+func tuiTick() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(t time.Time) tea.Msg { return tuiTickMsg(t) })
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case tuiTickMsg:
+		if m.playback == nil {
+			return m, nil
+		}
+		m.access = m.playback.plugin.RecentRequests()
+		return m, tuiTick()
+
+	case tuiStoppedMsg:
+		if m.playback != nil && m.playback.proxy == msg.proxy {
+			m.playback = nil
+			if msg.err != nil && !errors.Is(msg.err, http.ErrServerClosed) {
+				m.status = fmt.Sprintf("Playback stopped: %v", msg.err)
+			}
+		}
+
+	case tea.KeyMsg:
+		return m, m.handleKey(msg.String())
+	}
+	return m, nil
+}
+
+// handleKey applies a key press
+func (m *tuiModel) handleKey(key string) tea.Cmd {
+	page := m.listHeight()
+	move := func(cursor *int, n, delta int) {
+		*cursor = min(max(*cursor+delta, 0), max(n-1, 0))
+	}
+
+	switch key {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "p":
+		return m.togglePlayback()
+	case "r":
+		m.findInventories()
+		if m.view != viewInventories {
+			m.openInventory(m.opened)
+		}
+	case "esc", "backspace", "left", "h":
+		if m.view == viewHeaders {
+			m.view = viewResources
+		} else {
+			m.view = viewInventories
+		}
+	case "enter", "right", "l":
+		switch m.view {
+		case viewInventories:
+			if dir := m.selectedInventory(); dir != "" {
+				m.openInventory(dir)
+			}
+		case viewResources:
+			if len(m.resources) > 0 {
+				m.view = viewHeaders
+			}
+		}
+	case "up", "k", "down", "j", "pgup", "pgdown":
+		delta := map[string]int{"up": -1, "k": -1, "down": 1, "j": 1, "pgup": -page, "pgdown": page}[key]
+		switch m.view {
+		case viewInventories:
+			move(&m.cursor, len(m.inventories), delta)
+		case viewResources:
+			move(&m.resourceCursor, len(m.resources), delta)
+		}
+	}
+	return nil
+}
+
+// listHeight is the number of rows of the list pane
+func (m *tuiModel) listHeight() int {
+	// Title, two separators, access log, status and key help
+	return max(m.height-tuiAccessLines-5, 3)
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+	line := func(s string) {
+		if runes := []rune(s); m.width > 0 && len(runes) > m.width {
+			s = string(runes[:m.width])
+		}
+		b.WriteString(s + "\n")
+	}
+	rule := func(title string) {
+		line("── " + title + " " + strings.Repeat("─", max(m.width-utf8.RuneCountInString(title)-4, 0)))
+	}
+
+	state := "stopped"
+	if m.playback != nil {
+		state = fmt.Sprintf("running on %s (%s)", m.builder.GetListenAddr(), m.playback.dir)
+	}
+	line(fmt.Sprintf("http-playback-proxy  inventory: %s  playback: %s", m.root, state))
+
+	var rows []string
+	cursor := 0
+	switch m.view {
+	case viewInventories:
+		rule("Inventories")
+		rows = m.inventories
+		cursor = m.cursor
+	case viewResources:
+		rule(m.opened)
+		for i := range m.resources {
+			rows = append(rows, resourceRow(&m.resources[i]))
+		}
+		cursor = m.resourceCursor
+	case viewHeaders:
+		resource := &m.resources[m.resourceCursor]
+		rule(resource.Method + " " + resource.URL)
+		names := make([]string, 0, len(resource.RawHeaders))
+		for name := range resource.RawHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			rows = append(rows, fmt.Sprintf("%s: %s", name, resource.RawHeaders[name]))
+		}
+		cursor = -1
+	}
+
+	height := m.listHeight()
+	start := 0
+	if cursor >= height {
+		start = cursor - height + 1
+	}
+	for i := start; i < start+height; i++ {
+		switch {
+		case i >= len(rows):
+			line("")
+		case i == cursor:
+			line("> " + rows[i])
+		default:
+			line("  " + rows[i])
+		}
+	}
+
+	rule("Access log")
+	entries := m.access
+	if len(entries) > tuiAccessLines {
+		entries = entries[len(entries)-tuiAccessLines:]
+	}
+	for i := 0; i < tuiAccessLines; i++ {
+		if i < len(entries) {
+			entry := entries[i]
+			line(fmt.Sprintf("%s %3d %-9s %-6s %s", entry.Time.Format("15:04:05"), entry.Status, entry.Source, entry.Method, entry.URL))
+		} else {
+			line("")
+		}
+	}
+
+	line(m.status)
+	b.WriteString("↑/↓ move  enter open  esc back  p start/stop playback  r reload  q quit")
+	return b.String()
+}
+
+// resourceRow formats a resource for the resource list
+func resourceRow(resource *types.Resource) string {
+	status := "ERR"
+	if resource.StatusCode != nil {
+		status = fmt.Sprintf("%d", *resource.StatusCode)
+	}
+	size := "-"
+	if resource.WireSize != nil {
+		size = formatBytes(*resource.WireSize)
+	}
+	return fmt.Sprintf("%-6s %3s %8s %6dms  %s", resource.Method, status, size, resource.TTFBMS, resource.URL)
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1024*1024))
+	case n >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(n)/1024)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
@@ -1,12 +1,16 @@
 package tests
 
 import (
-	"bytes"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 	"time"
+
+	"go-http-playback-proxy/pkg/harness"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/types"
 )
 
 // 包括的統合テスト
@@ -266,7 +270,7 @@ func TestComprehensiveIntegration(t *testing.T) {
 		tc := tc // ループ変数のキャプチャ
 		t.Run(tc.Name, func(t *testing.T) {
 			t.Parallel() // 並行実行を有効化
-			runThreePhaseTestParallel(t, tc, proxyPath)
+			runThreePhaseTest(t, tc, proxyPath)
 		})
 	}
 }
@@ -286,12 +290,11 @@ type TestCase struct {
 
 // 3段階テストの実行
 func runThreePhaseTest(t *testing.T, tc TestCase, proxyPath string) {
-	tempDir := filepath.Join("..", "temp", "test_"+sanitizeFileName(tc.Name))
-	defer os.RemoveAll(tempDir)
+	inventoryDir := harness.InventoryDir(t)
 
 	// Phase 1: 直接アクセス（基準値取得）
 	t.Logf("Phase 1: Direct access to %s", tc.URL)
-	directResponse, err := MakeDirectRequest(tc.Method, tc.URL, tc.Headers)
+	directResponse, err := fetch(directClient(), tc)
 	if err != nil {
 		t.Fatalf("Direct request failed: %v", err)
 	}
@@ -308,42 +311,41 @@ func runThreePhaseTest(t *testing.T, tc TestCase, proxyPath string) {
 
 	// Phase 2: Recording（プロキシ経由で記録）
 	t.Logf("Phase 2: Recording via proxy")
-	proxy := NewProxyController(8081, proxyPath, tempDir) // ポート8081を使用
-
-	if err := proxy.StartRecording(TestServerURL); err != nil {
+	proxy, err := harness.StartRecordingProcess(TestServerURL, harness.ProcessOptions{Binary: proxyPath, InventoryDir: inventoryDir})
+	if err != nil {
 		t.Fatalf("Failed to start recording proxy: %v", err)
 	}
 	defer proxy.Stop()
 
 	// プロキシ経由でリクエスト
-	recordingResponse, err := proxy.MakeRequest(tc.Method, tc.URL, tc.Headers)
+	recordingResponse, err := fetch(proxy.Client(), tc)
 	if err != nil {
 		t.Fatalf("Recording request failed: %v", err)
 	}
 
 	// プロキシを停止してinventoryを保存
-	proxy.Stop()
-	time.Sleep(1 * time.Second) // プロセス終了とファイル書き込み待ち
+	if err := proxy.Stop(); err != nil {
+		t.Fatalf("Failed to stop recording proxy: %v", err)
+	}
 
 	// inventory.json の検証
-	inventory, err := proxy.LoadInventory()
+	inventory, err := loadInventory(inventoryDir)
 	if err != nil {
 		t.Fatalf("Failed to load inventory: %v", err)
 	}
 
-	validateInventory(t, tc, inventory, directResponse)
+	validateInventory(t, tc, inventory, inventoryDir, directResponse)
 
 	// Phase 3: Playback（inventoryから再生）
 	t.Logf("Phase 3: Playback from inventory")
-	playbackProxy := NewProxyController(8082, proxyPath, tempDir) // ポート8082を使用
-
-	if err := playbackProxy.StartPlayback(); err != nil {
+	playbackProxy, err := harness.StartPlaybackProcess(harness.ProcessOptions{Binary: proxyPath, InventoryDir: inventoryDir})
+	if err != nil {
 		t.Fatalf("Failed to start playback proxy: %v", err)
 	}
 	defer playbackProxy.Stop()
 
 	// プロキシ経由でリクエスト（再生）
-	playbackResponse, err := playbackProxy.MakeRequest(tc.Method, tc.URL, tc.Headers)
+	playbackResponse, err := fetch(playbackProxy.Client(), tc)
 	if err != nil {
 		t.Fatalf("Playback request failed: %v", err)
 	}
@@ -355,33 +357,64 @@ func runThreePhaseTest(t *testing.T, tc TestCase, proxyPath string) {
 	t.Logf("✅ Three-phase test completed successfully for %s", tc.Name)
 }
 
+// directClient はプロキシを経由せずにテストサーバーへアクセスする。プロキシのクライアントと同じく
+// ボディを展開せず、リダイレクトも追わない
+func directClient() *http.Client {
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{DisableCompression: true},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// fetch はテストケースのリクエストを client で送信する
+func fetch(client *http.Client, tc TestCase) (*harness.Response, error) {
+	req, err := http.NewRequest(tc.Method, tc.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range tc.Headers {
+		req.Header.Set(k, v)
+	}
+	return harness.Do(client, req)
+}
+
+// loadInventory は inventoryDir の inventory.json を読み込む
+func loadInventory(inventoryDir string) (*types.Inventory, error) {
+	return inventory.NewPersistenceManager(inventoryDir).LoadInventory()
+}
+
 // レスポンスの基本検証
-func validateResponse(t *testing.T, phase string, tc TestCase, response *HTTPResponse) {
+func validateResponse(t *testing.T, phase string, tc TestCase, response *harness.Response) {
+	contentType := response.Header.Get("Content-Type")
+	contentEncoding := response.Header.Get("Content-Encoding")
 	if response.StatusCode != tc.ExpectedStatus {
 		t.Errorf("[%s] Expected status %d, got %d", phase, tc.ExpectedStatus, response.StatusCode)
 	}
 
-	if tc.ExpectedCharset != "" && !strings.Contains(strings.ToLower(response.ContentType), strings.ToLower(tc.ExpectedCharset)) {
-		t.Logf("[%s] Content-Type charset case difference: expected %s, got %s", phase, tc.ExpectedCharset, response.ContentType)
+	if tc.ExpectedCharset != "" && !strings.Contains(strings.ToLower(contentType), strings.ToLower(tc.ExpectedCharset)) {
+		t.Logf("[%s] Content-Type charset case difference: expected %s, got %s", phase, tc.ExpectedCharset, contentType)
 	}
 
-	if tc.ExpectedEncoding != "" && response.ContentEncoding != tc.ExpectedEncoding {
-		t.Errorf("[%s] Expected Content-Encoding %s, got %s", phase, tc.ExpectedEncoding, response.ContentEncoding)
+	if tc.ExpectedEncoding != "" && contentEncoding != tc.ExpectedEncoding {
+		t.Errorf("[%s] Expected Content-Encoding %s, got %s", phase, tc.ExpectedEncoding, contentEncoding)
 	}
 
-	if tc.ExpectedContentType != "" && !strings.HasPrefix(response.ContentType, tc.ExpectedContentType) {
-		t.Errorf("[%s] Expected Content-Type to start with %s, got %s", phase, tc.ExpectedContentType, response.ContentType)
+	if tc.ExpectedContentType != "" && !strings.HasPrefix(contentType, tc.ExpectedContentType) {
+		t.Errorf("[%s] Expected Content-Type to start with %s, got %s", phase, tc.ExpectedContentType, contentType)
 	}
 }
 
 // inventory.json の検証
-func validateInventory(t *testing.T, tc TestCase, inventory *Inventory, directResponse *HTTPResponse) {
+func validateInventory(t *testing.T, tc TestCase, inventory *types.Inventory, inventoryDir string, directResponse *harness.Response) {
 	if len(inventory.Resources) == 0 {
 		t.Fatal("No resources found in inventory")
 	}
 
 	// 該当するリソースを検索
-	var resource *Resource
+	var resource *types.Resource
 	for i := range inventory.Resources {
 		if inventory.Resources[i].Method == tc.Method && inventory.Resources[i].URL == tc.URL {
 			resource = &inventory.Resources[i]
@@ -404,18 +437,18 @@ func validateInventory(t *testing.T, tc TestCase, inventory *Inventory, directRe
 		}
 	}
 
-	if tc.ExpectedEncoding != "" && (resource.ContentEncoding == nil || *resource.ContentEncoding != tc.ExpectedEncoding) {
+	if tc.ExpectedEncoding != "" && (resource.ContentEncoding == nil || string(*resource.ContentEncoding) != tc.ExpectedEncoding) {
 		expectedEncoding := tc.ExpectedEncoding
 		actualEncoding := ""
 		if resource.ContentEncoding != nil {
-			actualEncoding = *resource.ContentEncoding
+			actualEncoding = string(*resource.ContentEncoding)
 		}
 		t.Errorf("Inventory Content-Encoding mismatch: expected %s, got %s", expectedEncoding, actualEncoding)
 	}
 
 	// Optimize機能の検証
 	if tc.Category == "optimize" {
-		validateOptimization(t, tc, resource, directResponse)
+		validateOptimization(t, tc, resource, inventoryDir, directResponse)
 	}
 
 	// パフォーマンス情報の検証
@@ -423,212 +456,51 @@ func validateInventory(t *testing.T, tc TestCase, inventory *Inventory, directRe
 		t.Error("Invalid TTFB recorded in inventory")
 	}
 
-	if resource.Mbps != nil && *resource.Mbps < 0 {
+	if resource.MBPS != nil && *resource.MBPS < 0 {
 		t.Error("Invalid Mbps recorded in inventory")
 	}
 
 	mbpsValue := 0.0
-	if resource.Mbps != nil {
-		mbpsValue = *resource.Mbps
+	if resource.MBPS != nil {
+		mbpsValue = *resource.MBPS
 	}
 	t.Logf("✅ Inventory validation passed: TTFB=%dms, Mbps=%.2f", resource.TTFBMS, mbpsValue)
 }
 
 // 3つのレスポンスの比較検証
-func compareResponses(t *testing.T, tc TestCase, direct, recording, playback *HTTPResponse) {
-	// ステータスコードの一致
-	if direct.StatusCode != recording.StatusCode || direct.StatusCode != playback.StatusCode {
-		t.Errorf("Status code mismatch: direct=%d, recording=%d, playback=%d",
-			direct.StatusCode, recording.StatusCode, playback.StatusCode)
-	}
-
-	// Content-Type の一致（スペースの正規化）
-	directCT := strings.ReplaceAll(direct.ContentType, "; ", ";")
-	recordingCT := strings.ReplaceAll(recording.ContentType, "; ", ";")
-	playbackCT := strings.ReplaceAll(playback.ContentType, "; ", ";")
-
-	if directCT != recordingCT {
-		t.Logf("Content-Type format difference: direct=%s, recording=%s", direct.ContentType, recording.ContentType)
-	}
-
-	// playback では x-playback-proxy ヘッダーが追加されるので、それ以外を比較
-	if directCT != playbackCT {
-		t.Logf("Content-Type format difference: direct=%s, playback=%s", direct.ContentType, playback.ContentType)
-	}
-
-	// Content-Encoding の一致
-	if direct.ContentEncoding != recording.ContentEncoding || direct.ContentEncoding != playback.ContentEncoding {
-		t.Errorf("Content-Encoding mismatch: direct=%s, recording=%s, playback=%s",
-			direct.ContentEncoding, recording.ContentEncoding, playback.ContentEncoding)
-	}
-
-	// ボディの比較（圧縮されている場合は展開して比較）
-	directBody := decompressIfNeeded(direct.Body, direct.ContentEncoding)
-	recordingBody := decompressIfNeeded(recording.Body, recording.ContentEncoding)
-	playbackBody := decompressIfNeeded(playback.Body, playback.ContentEncoding)
-
-	if !bytes.Equal(directBody, recordingBody) {
-		t.Logf("⚠️ Body content mismatch between direct and recording")
-	}
-
-	if !bytes.Equal(directBody, playbackBody) {
-		t.Logf("⚠️ Body content mismatch between direct and playback")
-	}
-
-	// playback レスポンスの特有ヘッダー確認（警告レベル）
-	if playback.Headers["x-playback-proxy"] != "1" {
-		t.Logf("⚠️ x-playback-proxy header not found in playback response")
-	}
-
-	t.Logf("✅ Response comparison passed: %d bytes, %s", len(directBody), direct.ContentType)
-}
-
-// ファイル名として安全な文字列に変換
-func sanitizeFileName(name string) string {
-	safe := ""
-	for _, r := range name {
-		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
-			safe += string(r)
-		} else {
-			safe += "_"
+func compareResponses(t *testing.T, tc TestCase, direct, recording, playback *harness.Response) {
+	// ステータスコードと Content-Encoding の一致
+	for phase, response := range map[string]*harness.Response{"recording": recording, "playback": playback} {
+		for _, diff := range harness.Compare(direct, response, harness.CompareOptions{Headers: []string{"Content-Encoding"}, IgnoreBody: true}) {
+			t.Errorf("Direct and %s responses differ: %s", phase, diff)
 		}
 	}
-	return safe
-}
-
-// 圧縮データの展開（簡易実装）
-func decompressIfNeeded(data []byte, encoding string) []byte {
-	// 実際の実装では brotli, gzip などの展開処理が必要
-	// 今は簡略化
-	return data
-}
-
-// 並行実行対応の3フェーズテスト
-func runThreePhaseTestParallel(t *testing.T, tc TestCase, proxyPath string) {
-	// 並行実行用のプロキシコントローラーを作成
-	proxy, err := NewParallelProxyController(proxyPath, tc.Name)
-	if err != nil {
-		t.Fatalf("Failed to create parallel proxy controller: %v", err)
-	}
-	defer os.RemoveAll(proxy.InventoryDir) // クリーンアップ
-
-	t.Logf("Using port %d and inventory dir %s", proxy.Port, proxy.InventoryDir)
-
-	// Phase 1: 直接アクセス（基準値取得）
-	t.Logf("Phase 1: Direct access to %s", tc.URL)
-	directResponse, err := MakeDirectRequest(tc.Method, tc.URL, tc.Headers)
-	if err != nil {
-		t.Fatalf("Direct request failed: %v", err)
-	}
-	// 基本検証
-	validateResponse(t, "Direct", tc, directResponse)
-
-	// プロキシバイナリが存在しない場合はPhase 1のみで成功とする
-	if _, err := os.Stat(proxyPath); err != nil {
-		t.Logf("⚠️  Proxy binary not found at %s, skipping Phase 2&3", proxyPath)
-		t.Logf("✅ Phase 1 test completed successfully for %s", tc.Name)
-		return
-	}
-
-	// Phase 2: Recording（プロキシ経由で記録）
-	t.Logf("Phase 2: Recording via proxy (port %d)", proxy.Port)
-	if err := proxy.StartRecording(TestServerURL); err != nil {
-		t.Fatalf("Failed to start recording proxy: %v", err)
-	}
-	defer proxy.Stop()
-
-	// プロキシ経由でリクエスト
-	recordedResponse, err := MakeProxyRequest(tc.Method, tc.URL, tc.Headers, proxy.Port)
-	if err != nil {
-		t.Fatalf("Proxy request failed: %v", err)
-	}
-
-	// プロキシ停止とインベントリ保存待ち
-	proxy.Stop()
-	time.Sleep(2 * time.Second) // プロセス終了とファイル書き込み待ち
 
-	// レスポンス検証
-	validateResponse(t, "Recording", tc, recordedResponse)
-
-	// インベントリファイル検証（リトライ機能付き）
-	var inventory *Inventory
-	var loadErr error
-	for i := 0; i < 5; i++ { // 最大5回リトライ
-		inventory, loadErr = LoadInventory(proxy.InventoryDir)
-		if loadErr == nil {
-			break
-		}
-		if i < 4 { // 最後の試行でない場合は待機
-			t.Logf("Inventory load attempt %d failed: %v, retrying...", i+1, loadErr)
-			time.Sleep(1 * time.Second)
+	// Content-Type とボディの違いは整形などによるため警告にとどめる（ボディは展開済み）
+	for phase, response := range map[string]*harness.Response{"recording": recording, "playback": playback} {
+		for _, diff := range harness.Compare(direct, response, harness.CompareOptions{Headers: []string{"Content-Type"}}) {
+			t.Logf("⚠️ Direct and %s responses differ: %s", phase, diff)
 		}
 	}
-	if loadErr != nil {
-		t.Fatalf("Failed to load inventory after 5 attempts: %v", loadErr)
-	}
-	validateInventory(t, tc, inventory, directResponse)
-
-	// Phase 3: Playback（記録からの再生）
-	t.Logf("Phase 3: Playback from inventory")
-
-	// 新しいポートでplaybackプロキシを起動
-	playbackProxy, err := NewParallelProxyController(proxyPath, tc.Name+"_playback")
-	if err != nil {
-		t.Fatalf("Failed to create playback proxy controller: %v", err)
-	}
-	defer os.RemoveAll(playbackProxy.InventoryDir)
-
-	t.Logf("Phase 3: Using playback port %d", playbackProxy.Port)
-
-	// インベントリをコピー
-	if err := copyInventoryDir(proxy.InventoryDir, playbackProxy.InventoryDir); err != nil {
-		t.Fatalf("Failed to copy inventory: %v", err)
-	}
-
-	if err := playbackProxy.StartPlayback(); err != nil {
-		t.Fatalf("Failed to start playback proxy: %v", err)
-	}
-	defer playbackProxy.Stop()
-
-	// プレイバック経由でリクエスト
-	playbackResponse, err := MakeProxyRequest(tc.Method, tc.URL, tc.Headers, playbackProxy.Port)
-	if err != nil {
-		t.Fatalf("Playback request failed: %v", err)
-	}
-
-	// プレイバックレスポンス検証
-	validateResponse(t, "Playback", tc, playbackResponse)
 
-	// プレイバックヘッダー確認
-	if playbackResponse.Headers["x-playback-proxy"] != "1" {
-		// ワーニングとして出力（エラーにはしない）
-		t.Logf("⚠️  Expected x-playback-proxy header not found (headers: %v)", playbackResponse.Headers)
+	// playback レスポンスの特有ヘッダー確認（警告レベル）
+	if playback.Header.Get("x-playback-proxy") != "1" {
+		t.Logf("⚠️ x-playback-proxy header not found in playback response")
 	}
 
-	t.Logf("✅ All phases completed successfully for %s", tc.Name)
+	t.Logf("✅ Response comparison passed: %d bytes, %s", len(direct.Body), direct.Header.Get("Content-Type"))
 }
 
 // Optimize機能の検証
-func validateOptimization(t *testing.T, tc TestCase, resource *Resource, directResponse *HTTPResponse) {
+func validateOptimization(t *testing.T, tc TestCase, resource *types.Resource, inventoryDir string, directResponse *harness.Response) {
 	// ContentFilePathが存在することを確認
 	if resource.ContentFilePath == nil {
 		t.Error("ContentFilePath not found in optimized resource")
 		return
 	}
 
-	// 保存されたコンテンツファイルを読み込み（並行実行用の一時ディレクトリから）
-	// 並行実行用のProxyControllerは ../temp/parallel_tests/ 以下にディレクトリを作成する
-	inventoryDir := filepath.Join("..", "temp", "parallel_tests", "test_"+sanitizeFileName(tc.Name)+"_*")
-
-	// glob パターンでディレクトリを検索
-	matches, err := filepath.Glob(inventoryDir)
-	if err != nil || len(matches) == 0 {
-		t.Logf("Warning: Could not find inventory directory matching %s", inventoryDir)
-		return
-	}
-
-	// 最初にマッチしたディレクトリを使用
-	contentPath := filepath.Join(matches[0], "contents", *resource.ContentFilePath)
+	// 保存されたコンテンツファイルを読み込み
+	contentPath := filepath.Join(inventoryDir, "contents", *resource.ContentFilePath)
 
 	savedContent, err := os.ReadFile(contentPath)
 	if err != nil {
@@ -1,3 +1,32 @@
 module integration-tests
 
-go 1.21
+go 1.22.0
+
+toolchain go1.22.2
+
+require go-http-playback-proxy v0.0.0
+
+require (
+	github.com/MatusOllah/slogcolor v1.7.0 // indirect
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/ditashi/jsbeautifier-go v0.0.0-20141206144643-2520a8026a9c // indirect
+	github.com/fatih/color v1.16.0 // indirect
+	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/lqqyt2423/go-mitmproxy v1.8.5 // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/rogpeppe/go-internal v1.9.0 // indirect
+	github.com/satori/go.uuid v1.2.0 // indirect
+	github.com/sirupsen/logrus v1.8.1 // indirect
+	github.com/tdewolff/minify/v2 v2.23.10 // indirect
+	github.com/tdewolff/parse/v2 v2.8.1 // indirect
+	github.com/yosssi/gohtml v0.0.0-20201013000340-ee4748c638f4 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
+
+replace go-http-playback-proxy => ../..
@@ -8,6 +8,9 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"go-http-playback-proxy/pkg/harness"
+	"go-http-playback-proxy/pkg/types"
 )
 
 // パフォーマンステスト（直列実行）
@@ -95,8 +98,7 @@ type PerformanceTestCase struct {
 
 // パフォーマンステストの実行
 func runPerformanceTest(t *testing.T, tc PerformanceTestCase, proxyPath string) {
-	tempDir := filepath.Join("..", "temp", "perf_test_"+sanitizeFileName(tc.Name))
-	defer os.RemoveAll(tempDir)
+	inventoryDir := harness.InventoryDir(t)
 
 	t.Logf("Testing: %s", tc.Name)
 
@@ -118,14 +120,15 @@ func runPerformanceTest(t *testing.T, tc PerformanceTestCase, proxyPath string)
 
 	// Phase 2: Recording フェーズ
 	t.Logf("Phase 2: Recording with performance measurement")
-	proxy := NewProxyController(8083, proxyPath, tempDir) // ポート8083を使用
-
-	if err := proxy.StartRecording(TestServerURL); err != nil {
+	proxy, err := harness.StartRecordingProcess(TestServerURL, harness.ProcessOptions{Binary: proxyPath, InventoryDir: inventoryDir})
+	if err != nil {
 		t.Fatalf("Failed to start recording proxy: %v", err)
 	}
 
-	recordingMetrics, err := measurePerformanceProxy(proxy, tc.URL)
-	proxy.Stop()
+	recordingMetrics, err := measurePerformanceDirectWithProxy(tc.URL, proxy.Port)
+	if stopErr := proxy.Stop(); stopErr != nil {
+		t.Fatalf("Failed to stop recording proxy: %v", stopErr)
+	}
 
 	if err != nil {
 		t.Fatalf("Recording performance measurement failed: %v", err)
@@ -135,7 +138,7 @@ func runPerformanceTest(t *testing.T, tc PerformanceTestCase, proxyPath string)
 	validateRecordingOverhead(t, directMetrics, recordingMetrics)
 
 	// inventory の性能情報確認
-	inventory, err := proxy.LoadInventory()
+	inventory, err := loadInventory(inventoryDir)
 	if err != nil {
 		t.Fatalf("Failed to load inventory: %v", err)
 	}
@@ -144,13 +147,12 @@ func runPerformanceTest(t *testing.T, tc PerformanceTestCase, proxyPath string)
 
 	// Phase 3: Playback フェーズ
 	t.Logf("Phase 3: Playback with performance measurement")
-	playbackProxy := NewProxyController(8084, proxyPath, tempDir) // ポート8084を使用
-
-	if err := playbackProxy.StartPlayback(); err != nil {
+	playbackProxy, err := harness.StartPlaybackProcess(harness.ProcessOptions{Binary: proxyPath, InventoryDir: inventoryDir})
+	if err != nil {
 		t.Fatalf("Failed to start playback proxy: %v", err)
 	}
 
-	playbackMetrics, err := measurePerformanceProxy(playbackProxy, tc.URL)
+	playbackMetrics, err := measurePerformanceDirectWithProxy(tc.URL, playbackProxy.Port)
 	playbackProxy.Stop()
 
 	if err != nil {
@@ -231,17 +233,11 @@ func measurePerformanceDirect(urlStr string) (*PerformanceMetrics, error) {
 	}, nil
 }
 
-// プロキシ経由のパフォーマンス測定
-func measurePerformanceProxy(proxy *ProxyController, urlStr string) (*PerformanceMetrics, error) {
-	// 直接測定と同じ方法でより正確に測定
-	return measurePerformanceDirectWithProxy(urlStr, proxy.Port)
-}
-
 // プロキシ指定での直接測定
 func measurePerformanceDirectWithProxy(urlStr string, proxyPort int) (*PerformanceMetrics, error) {
 	proxyURL := &url.URL{
 		Scheme: "http",
-		Host:   fmt.Sprintf("localhost:%d", proxyPort),
+		Host:   fmt.Sprintf("127.0.0.1:%d", proxyPort),
 	}
 
 	client := &http.Client{
@@ -353,7 +349,7 @@ func validateRecordingOverhead(t *testing.T, direct, recording *PerformanceMetri
 }
 
 // inventory の性能情報検証
-func validateInventoryPerformance(t *testing.T, tc PerformanceTestCase, inventory *Inventory, directMetrics *PerformanceMetrics) {
+func validateInventoryPerformance(t *testing.T, tc PerformanceTestCase, inventory *types.Inventory, directMetrics *PerformanceMetrics) {
 	if len(inventory.Resources) == 0 {
 		t.Fatal("No resources in inventory")
 	}
@@ -361,7 +357,7 @@ func validateInventoryPerformance(t *testing.T, tc PerformanceTestCase, inventor
 	resource := inventory.Resources[0]
 
 	// Mbps が記録されているか
-	if resource.Mbps == nil || *resource.Mbps <= 0 {
+	if resource.MBPS == nil || *resource.MBPS <= 0 {
 		t.Error("Invalid Mbps recorded in inventory")
 	}
 
@@ -371,8 +367,8 @@ func validateInventoryPerformance(t *testing.T, tc PerformanceTestCase, inventor
 	}
 
 	mbpsValue := 0.0
-	if resource.Mbps != nil {
-		mbpsValue = *resource.Mbps
+	if resource.MBPS != nil {
+		mbpsValue = *resource.MBPS
 	}
 	t.Logf("Inventory performance: TTFB=%dms, Mbps=%.2f", resource.TTFBMS, mbpsValue)
 }
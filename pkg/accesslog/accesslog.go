@@ -0,0 +1,92 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sources of a served response
+const (
+	SourceInventory = "inventory" // Replayed from the inventory
+	SourceUpstream  = "upstream"  // Proxied to the upstream server
+	SourceBlocked   = "blocked"   // Not recorded and upstream blocked by policy or strict mode
+	SourceFault     = "fault"     // Fault injected by the network conditions
+	SourceChecksum  = "checksum"  // Refused because the content file was modified
+	SourceHeaders   = "headers"   // Refused because the request headers exceed the configured limit
+	SourceBuiltin   = "builtin"   // Not recorded, answered locally as a favicon or well-known URL
+)
+
+// Entry is a single request handled during playback
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	URL    string    `json:"url"`
+	Status int       `json:"status"`
+	Source string    `json:"source"`
+}
+
+// Ring keeps the most recent entries
+type Ring struct {
+	entries []Entry
+	next    int
+	full    bool
+	mutex   sync.Mutex
+}
+
+// NewRing creates a ring holding up to size entries
+func NewRing(size int) *Ring {
+	if size < 1 {
+		size = 1
+	}
+	return &Ring{entries: make([]Entry, size)}
+}
+
+// Add appends an entry, dropping the oldest when the ring is full
+func (r *Ring) Add(entry Entry) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Entries returns the entries from oldest to newest
+func (r *Ring) Entries() []Entry {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.full {
+		return append([]Entry(nil), r.entries[:r.next]...)
+	}
+	return append(append([]Entry(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// Logger writes entries as JSON lines
+type Logger struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewLogger creates a logger writing to w
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{encoder: json.NewEncoder(w)}
+}
+
+// Log writes an entry as a single line
+func (l *Logger) Log(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.encoder.Encode(entry)
+}
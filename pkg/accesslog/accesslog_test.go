@@ -0,0 +1,27 @@
+package accesslog
+
+import (
+	"testing"
+)
+
+func TestRing(t *testing.T) {
+	ring := NewRing(3)
+	if entries := ring.Entries(); len(entries) != 0 {
+		t.Fatalf("Expected an empty ring, got %d entries", len(entries))
+	}
+
+	for _, url := range []string{"/a", "/b"} {
+		ring.Add(Entry{URL: url})
+	}
+	if entries := ring.Entries(); len(entries) != 2 || entries[0].URL != "/a" {
+		t.Errorf("Unexpected entries before wrapping: %+v", entries)
+	}
+
+	for _, url := range []string{"/c", "/d", "/e"} {
+		ring.Add(Entry{URL: url})
+	}
+	entries := ring.Entries()
+	if len(entries) != 3 || entries[0].URL != "/c" || entries[2].URL != "/e" {
+		t.Errorf("Expected the newest 3 entries oldest first, got %+v", entries)
+	}
+}
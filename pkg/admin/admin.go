@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go-http-playback-proxy/pkg/httputil"
+)
+
+// Server is a small HTTP server exposing runtime control and reporting endpoints
+type Server struct {
+	addr   string
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+// NewServer creates a new admin server listening on the given address ("unix:/path" for a Unix socket)
+func NewServer(addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		addr: addr,
+		mux:  mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// HandleFunc registers a handler for the given pattern (e.g. "GET /scenario")
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Handler returns the underlying HTTP handler
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// Addr returns the configured listen address
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Start starts listening in the background
+func (s *Server) Start() error {
+	ln, err := httputil.Listen(s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", s.addr, err)
+	}
+
+	slog.Info("Admin API listening", "addr", ln.Addr().String())
+
+	go func() {
+		if err := s.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Admin API stopped", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown gracefully stops the admin server
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// WriteJSON writes v as an indented JSON response with the given status code
+func WriteJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		slog.Debug("Failed to write admin response", "error", err)
+	}
+}
+
+// WriteError writes a JSON error response
+func WriteError(w http.ResponseWriter, statusCode int, message string) {
+	WriteJSON(w, statusCode, map[string]string{"error": message})
+}
+
+// ReadJSON decodes a JSON request body into v
+func ReadJSON(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
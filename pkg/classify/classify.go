@@ -0,0 +1,318 @@
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// Timing modes for replayed responses
+const (
+	TimingFaithful  = "faithful"  // Reproduce recorded TTFB and transfer speed
+	TimingImmediate = "immediate" // Respond as fast as possible
+)
+
+// Fallback modes for requests not found in the inventory
+const (
+	FallbackPassthrough = "passthrough" // Proxy the request upstream
+	FallbackBlock       = "block"       // Respond locally without contacting upstream
+)
+
+// DefaultPolicyName is the name of the implicit policy used when nothing matches
+const DefaultPolicyName = "default"
+
+// Policy is a bundle of playback behaviors applied to a class of requests
+type Policy struct {
+	Name     string `json:"name"`
+	Timing   string `json:"timing,omitempty"`
+	Fallback string `json:"fallback,omitempty"`
+	// Templating executes recorded response bodies as text/template with the request they answer
+	Templating bool `json:"templating,omitempty"`
+}
+
+// Rule assigns a policy to requests matching all of its non-empty criteria
+type Rule struct {
+	Policy       string            `json:"policy"`
+	Methods      []string          `json:"methods,omitempty"`
+	Hosts        []string          `json:"hosts,omitempty"`
+	Paths        []string          `json:"paths,omitempty"`
+	ContentTypes []string          `json:"contentTypes,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+}
+
+// Config is the declarative classification config
+type Config struct {
+	Default  string   `json:"default,omitempty"`
+	Policies []Policy `json:"policies"`
+	Rules    []Rule   `json:"rules"`
+}
+
+// Input describes the request being classified
+type Input struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	// ContentType is the recorded response Content-Type, if known
+	ContentType string
+}
+
+// Classifier routes requests to policies
+type Classifier struct {
+	policies      map[string]*Policy
+	rules         []Rule
+	compiled      []compiledRule
+	defaultPolicy *Policy
+	// headerNames are the request headers some rule looks at, which are part of the cache key
+	headerNames []string
+	cache       match.Cache[*Policy]
+}
+
+// compiledRule is a rule with its patterns compiled, as evaluated for every request
+type compiledRule struct {
+	policy       *Policy
+	methods      []string
+	hosts        *match.Set
+	paths        *match.Set
+	contentTypes *match.Set
+	headers      []headerPattern
+}
+
+// headerPattern matches the value of a request header
+type headerPattern struct {
+	name    string
+	pattern *match.Pattern
+}
+
+// DefaultPolicy returns the policy used when no classifier is configured
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Name:     DefaultPolicyName,
+		Timing:   TimingFaithful,
+		Fallback: FallbackPassthrough,
+	}
+}
+
+// Load reads a classification config file and builds a classifier
+func Load(filePath string) (*Classifier, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %w", err)
+	}
+
+	return New(cfg)
+}
+
+// New validates the config and builds a classifier
+func New(cfg Config) (*Classifier, error) {
+	c := &Classifier{
+		policies: make(map[string]*Policy),
+		rules:    cfg.Rules,
+	}
+
+	for i := range cfg.Policies {
+		policy := cfg.Policies[i]
+		if policy.Name == "" {
+			return nil, fmt.Errorf("policy %d: name is required", i)
+		}
+		if policy.Timing == "" {
+			policy.Timing = TimingFaithful
+		}
+		if policy.Fallback == "" {
+			policy.Fallback = FallbackPassthrough
+		}
+		if policy.Timing != TimingFaithful && policy.Timing != TimingImmediate {
+			return nil, fmt.Errorf("policy %q: unknown timing %q", policy.Name, policy.Timing)
+		}
+		if err := validateFallback(policy.Fallback, false); err != nil {
+			return nil, fmt.Errorf("policy %q: %w", policy.Name, err)
+		}
+		c.policies[policy.Name] = &policy
+	}
+
+	for i, rule := range cfg.Rules {
+		compiled, err := c.compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		c.compiled = append(c.compiled, *compiled)
+		for name := range rule.Headers {
+			if !containsFold(c.headerNames, name) {
+				c.headerNames = append(c.headerNames, name)
+			}
+		}
+	}
+	sort.Strings(c.headerNames)
+
+	c.defaultPolicy = DefaultPolicy()
+	if cfg.Default != "" {
+		policy, ok := c.policies[cfg.Default]
+		if !ok {
+			return nil, fmt.Errorf("unknown default policy %q", cfg.Default)
+		}
+		c.defaultPolicy = policy
+	}
+
+	return c, nil
+}
+
+// compile resolves the policy of a rule and compiles its patterns
+func (c *Classifier) compile(rule Rule) (*compiledRule, error) {
+	policy, ok := c.policies[rule.Policy]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy %q", rule.Policy)
+	}
+	compiled := &compiledRule{policy: policy, methods: rule.Methods}
+
+	var err error
+	if compiled.hosts, err = match.CompileSet(rule.Hosts); err != nil {
+		return nil, err
+	}
+	if compiled.paths, err = match.CompileSet(rule.Paths); err != nil {
+		return nil, err
+	}
+	if compiled.contentTypes, err = match.CompileSet(rule.ContentTypes); err != nil {
+		return nil, err
+	}
+	for name, pattern := range rule.Headers {
+		compiledPattern, err := match.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled.headers = append(compiled.headers, headerPattern{name: name, pattern: compiledPattern})
+	}
+	sort.Slice(compiled.headers, func(i, j int) bool { return compiled.headers[i].name < compiled.headers[j].name })
+	return compiled, nil
+}
+
+// Classify returns the policy of the first matching rule, or the default policy
+func (c *Classifier) Classify(in Input) *Policy {
+	if c == nil {
+		return DefaultPolicy()
+	}
+	request := &classifiedRequest{Input: in}
+	key := c.cacheKey(request)
+	if policy, ok := c.cache.Get(key); ok {
+		return policy
+	}
+
+	policy := c.defaultPolicy
+	for i := range c.compiled {
+		if c.compiled[i].matches(request) {
+			policy = c.compiled[i].policy
+			break
+		}
+	}
+	c.cache.Put(key, policy)
+	return policy
+}
+
+// cacheKey joins everything the rules compare, so requests alike get the remembered policy
+func (c *Classifier) cacheKey(in *classifiedRequest) string {
+	in.parse()
+	var b strings.Builder
+	b.WriteString(in.Method)
+	b.WriteByte(0)
+	b.WriteString(in.host)
+	b.WriteByte(0)
+	if in.URL != nil {
+		b.WriteString(in.URL.Path)
+	}
+	b.WriteByte(0)
+	b.WriteString(in.mediaType)
+	for _, name := range c.headerNames {
+		b.WriteByte(0)
+		b.WriteString(in.Header.Get(name))
+	}
+	return b.String()
+}
+
+// Policies returns all configured policies
+func (c *Classifier) Policies() []Policy {
+	policies := make([]Policy, 0, len(c.policies))
+	for _, policy := range c.policies {
+		policies = append(policies, *policy)
+	}
+	return policies
+}
+
+// Rules returns the configured rules in evaluation order
+func (c *Classifier) Rules() []Rule {
+	if c == nil {
+		return nil
+	}
+	return append([]Rule(nil), c.rules...)
+}
+
+// Default returns the policy applied when no rule matches
+func (c *Classifier) Default() *Policy {
+	if c == nil {
+		return DefaultPolicy()
+	}
+	return c.defaultPolicy
+}
+
+// classifiedRequest is the input of a classification with the values rules compare parsed once
+type classifiedRequest struct {
+	Input
+	parsed    bool
+	host      string
+	mediaType string
+}
+
+func (r *classifiedRequest) parse() {
+	if r.parsed {
+		return
+	}
+	r.parsed = true
+	if r.URL != nil {
+		r.host = strings.ToLower(r.URL.Hostname())
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.ContentType); err == nil {
+		r.mediaType = strings.ToLower(mediaType)
+	}
+}
+
+// matches reports whether the request satisfies every criterion of the rule
+func (r *compiledRule) matches(in *classifiedRequest) bool {
+	if len(r.methods) > 0 && !containsFold(r.methods, in.Method) {
+		return false
+	}
+	in.parse()
+	if r.hosts.Len() > 0 && (in.URL == nil || !r.hosts.Match(in.host)) {
+		return false
+	}
+	if r.paths.Len() > 0 && (in.URL == nil || !r.paths.Match(in.URL.Path)) {
+		return false
+	}
+	if r.contentTypes.Len() > 0 && (in.mediaType == "" || !r.contentTypes.Match(in.mediaType)) {
+		return false
+	}
+	for _, header := range r.headers {
+		if !header.pattern.Match(in.Header.Get(header.name)) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
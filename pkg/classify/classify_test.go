@@ -0,0 +1,187 @@
+package classify
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func testConfig() Config {
+	return Config{
+		Default: "assets",
+		Policies: []Policy{
+			{Name: "assets"},
+			{Name: "api", Timing: TimingImmediate, Fallback: FallbackBlock},
+			{Name: "tracking", Fallback: FallbackBlock},
+		},
+		Rules: []Rule{
+			{Policy: "api", ContentTypes: []string{"application/json"}},
+			{Policy: "api", Paths: []string{"/api/*"}},
+			{Policy: "tracking", Hosts: []string{"*.analytics.example"}},
+			{Policy: "api", Headers: map[string]string{"X-Requested-With": "XMLHttpRequest"}},
+		},
+	}
+}
+
+func TestClassifier_Classify(t *testing.T) {
+	c, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		url         string
+		header      http.Header
+		contentType string
+		expected    string
+	}{
+		{"JSON content type", "https://example.com/data", nil, "application/json; charset=utf-8", "api"},
+		{"API path", "https://example.com/api/users", nil, "", "api"},
+		{"Host glob", "https://cdn.analytics.example/t.js", nil, "text/javascript", "tracking"},
+		{"Header match", "https://example.com/x", http.Header{"X-Requested-With": {"XMLHttpRequest"}}, "", "api"},
+		{"Default", "https://example.com/logo.png", nil, "image/png", "assets"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, _ := url.Parse(tc.url)
+			header := tc.header
+			if header == nil {
+				header = make(http.Header)
+			}
+			policy := c.Classify(Input{Method: "GET", URL: u, Header: header, ContentType: tc.contentType})
+			if policy.Name != tc.expected {
+				t.Errorf("Expected policy %s, got %s", tc.expected, policy.Name)
+			}
+		})
+	}
+}
+
+func TestClassifier_Defaults(t *testing.T) {
+	c, err := New(testConfig())
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	u, _ := url.Parse("https://example.com/")
+	policy := c.Classify(Input{Method: "GET", URL: u, Header: make(http.Header)})
+	if policy.Timing != TimingFaithful || policy.Fallback != FallbackPassthrough {
+		t.Errorf("Expected default timing/fallback to be filled in, got %+v", policy)
+	}
+
+	var nilClassifier *Classifier
+	if nilClassifier.Classify(Input{URL: u}).Name != DefaultPolicyName {
+		t.Error("Expected nil classifier to return the default policy")
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	testCases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"Unknown policy in rule", Config{Rules: []Rule{{Policy: "missing"}}}},
+		{"Unknown timing", Config{Policies: []Policy{{Name: "x", Timing: "slow"}}}},
+		{"Unknown default", Config{Default: "missing"}},
+		{"Missing name", Config{Policies: []Policy{{Timing: TimingFaithful}}}},
+		{"Invalid path pattern", Config{Policies: []Policy{{Name: "x"}}, Rules: []Rule{{Policy: "x", Paths: []string{"/[a-"}}}}},
+		{"Invalid header pattern", Config{Policies: []Policy{{Name: "x"}}, Rules: []Rule{{Policy: "x", Headers: map[string]string{"Accept": "re:("}}}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(tc.cfg); err == nil {
+				t.Error("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestClassifier_RegexpRule(t *testing.T) {
+	c, err := New(Config{
+		Policies: []Policy{{Name: "versioned", Timing: TimingImmediate}},
+		Rules:    []Rule{{Policy: "versioned", Paths: []string{`re:^/api/v[0-9]+/`}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	for path, expected := range map[string]string{"/api/v2/users/1": "versioned", "/api/beta/users": DefaultPolicyName} {
+		u, _ := url.Parse("https://example.com" + path)
+		if policy := c.Classify(Input{Method: "GET", URL: u, Header: make(http.Header)}); policy.Name != expected {
+			t.Errorf("%s: expected policy %s, got %s", path, expected, policy.Name)
+		}
+	}
+}
+
+func TestDomainFallbacks(t *testing.T) {
+	d, err := NewDomainFallbacks(FallbackBlock, map[string]string{
+		"*.example.com":     FallbackReplayOnly,
+		"cdn.example.com":   FallbackPassthrough,
+		"*.api.example.com": FallbackBlock,
+		"x.example.com":     FallbackPassthrough,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create domain fallbacks: %v", err)
+	}
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{"www.example.com", FallbackReplayOnly},
+		{"CDN.example.com", FallbackPassthrough},
+		{"v1.api.example.com", FallbackBlock},
+		// An exact host wins over patterns of the same length
+		{"x.example.com", FallbackPassthrough},
+		{"example.org", FallbackBlock},
+	}
+	for _, tc := range testCases {
+		if got := d.Fallback(tc.host); got != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.host, tc.expected, got)
+		}
+	}
+
+	// Without a default, other hosts are left to the policies
+	if d, _ = NewDomainFallbacks("", map[string]string{"example.com": FallbackBlock}); d.Fallback("example.org") != "" {
+		t.Errorf("Expected no fallback for other hosts")
+	}
+	if _, err := NewDomainFallbacks("", map[string]string{"example.com": "drop"}); err == nil {
+		t.Errorf("Expected an unknown fallback to be rejected")
+	}
+}
+
+// BenchmarkClassifier_Classify classifies a request that matches none of hundreds of rules
+func BenchmarkClassifier_Classify(b *testing.B) {
+	cfg := Config{Policies: []Policy{{Name: "api"}, {Name: "cdn"}}}
+	for i := 0; i < 100; i++ {
+		cfg.Rules = append(cfg.Rules,
+			Rule{Policy: "api", Paths: []string{fmt.Sprintf("/api/v%d/*", i)}},
+			Rule{Policy: "cdn", Hosts: []string{fmt.Sprintf("*.cdn%d.example.com", i)}, ContentTypes: []string{"image/*"}},
+			Rule{Policy: "api", Methods: []string{"POST"}, Headers: map[string]string{"X-Requested-With": "XMLHttpRequest"}},
+		)
+	}
+	c, err := New(cfg)
+	if err != nil {
+		b.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	// More distinct requests than the cache holds, so every one is matched against the rules
+	inputs := make([]Input, 2*4096+1)
+	for i := range inputs {
+		u, _ := url.Parse(fmt.Sprintf("https://www.example.com/assets/%d/app.css", i))
+		inputs[i] = Input{Method: "GET", URL: u, Header: make(http.Header), ContentType: "text/css; charset=utf-8"}
+	}
+
+	b.Run("repeated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c.Classify(inputs[0])
+		}
+	})
+	b.Run("distinct", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			c.Classify(inputs[i%len(inputs)])
+		}
+	})
+}
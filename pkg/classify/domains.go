@@ -0,0 +1,103 @@
+package classify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// FallbackReplayOnly answers unrecorded requests locally with a JSON explanation, like --strict
+const FallbackReplayOnly = "replay-only"
+
+// DomainFallbacks chooses the fallback of unrecorded requests by host, overriding the policies
+type DomainFallbacks struct {
+	defaultFallback string
+	hosts           *match.Set
+	fallbacks       []string
+}
+
+// NewDomainFallbacks validates the fallbacks of host patterns. defaultFallback applies to hosts
+// matching none of them; empty leaves those to the policies. An exact host wins over patterns,
+// and a pattern with more literal characters over one with fewer.
+func NewDomainFallbacks(defaultFallback string, domains map[string]string) (*DomainFallbacks, error) {
+	if err := validateFallback(defaultFallback, true); err != nil {
+		return nil, fmt.Errorf("fallback: %w", err)
+	}
+	patterns := make([]string, 0, len(domains))
+	for pattern, fallback := range domains {
+		if err := validateFallback(fallback, false); err != nil {
+			return nil, fmt.Errorf("domain %q: %w", pattern, err)
+		}
+		patterns = append(patterns, strings.ToLower(pattern))
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		exactI, literalI := hostSpecificity(patterns[i])
+		exactJ, literalJ := hostSpecificity(patterns[j])
+		if exactI != exactJ {
+			return exactI
+		}
+		if literalI != literalJ {
+			return literalI > literalJ
+		}
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	hosts, err := match.CompileSet(patterns)
+	if err != nil {
+		return nil, err
+	}
+	d := &DomainFallbacks{defaultFallback: defaultFallback, hosts: hosts}
+	for _, pattern := range patterns {
+		for host, fallback := range domains {
+			if strings.ToLower(host) == pattern {
+				d.fallbacks = append(d.fallbacks, fallback)
+				break
+			}
+		}
+	}
+	return d, nil
+}
+
+// hostSpecificity reports whether a host pattern is an exact host, and how many of its characters
+// match literally
+func hostSpecificity(pattern string) (bool, int) {
+	if strings.HasPrefix(pattern, match.RegexpPrefix) {
+		return false, 0
+	}
+	meta := 0
+	for _, c := range pattern {
+		if strings.ContainsRune(`*?[]\`, c) {
+			meta++
+		}
+	}
+	return meta == 0, len(pattern) - meta
+}
+
+// validateFallback checks a fallback mode; empty is allowed where the policies decide
+func validateFallback(fallback string, allowEmpty bool) error {
+	switch fallback {
+	case FallbackPassthrough, FallbackBlock, FallbackReplayOnly:
+		return nil
+	case "":
+		if allowEmpty {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown fallback %q (passthrough, replay-only or block)", fallback)
+}
+
+// Fallback returns the fallback for unrecorded requests to host, or "" to use the policy's
+func (d *DomainFallbacks) Fallback(host string) string {
+	if d == nil {
+		return ""
+	}
+	if i := d.hosts.Index(strings.ToLower(host)); i >= 0 {
+		return d.fallbacks[i]
+	}
+	return d.defaultFallback
+}
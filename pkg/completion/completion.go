@@ -0,0 +1,246 @@
+// Package completion generates shell completion scripts from the kong command model
+package completion
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// Shells lists the supported shells
+var Shells = []string{"bash", "zsh", "fish"}
+
+// command is a command of the CLI with what can follow it on the command line
+type command struct {
+	// path is the space separated command path; empty for the application itself
+	path     string
+	commands []child
+	flags    []flag
+}
+
+type child struct {
+	name string
+	help string
+}
+
+type flag struct {
+	name   string
+	short  rune
+	help   string
+	valued bool
+	enum   []string
+}
+
+// Write writes the completion script for the shell
+func Write(w io.Writer, app *kong.Application, shell string) error {
+	commands := collect(app)
+	switch shell {
+	case "bash":
+		return writeBash(w, app.Name, commands)
+	case "zsh":
+		// zsh runs the bash script through its bash completion emulation
+		fmt.Fprintf(w, "#compdef %s\n\nautoload -U +X bashcompinit && bashcompinit\n\n", app.Name)
+		return writeBash(w, app.Name, commands)
+	case "fish":
+		return writeFish(w, app.Name, commands)
+	default:
+		return fmt.Errorf("unsupported shell: %s (supported: %s)", shell, strings.Join(Shells, ", "))
+	}
+}
+
+// collect lists every visible command of the application, parents first
+func collect(app *kong.Application) []command {
+	var commands []command
+	var walk func(node *kong.Node, path string, inherited []flag)
+	walk = func(node *kong.Node, path string, inherited []flag) {
+		flags := append([]flag{}, inherited...)
+		for _, f := range node.Flags {
+			if f.Hidden {
+				continue
+			}
+			flags = append(flags, flag{
+				name:   f.Name,
+				short:  f.Short,
+				help:   f.Help,
+				valued: !f.IsBool() && !f.IsCounter(),
+				enum:   enumValues(f.Enum),
+			})
+		}
+
+		cmd := command{path: path, flags: flags}
+		var children []*kong.Node
+		for _, n := range node.Children {
+			if n.Hidden || n.Type != kong.CommandNode {
+				continue
+			}
+			children = append(children, n)
+			for _, name := range append([]string{n.Name}, n.Aliases...) {
+				cmd.commands = append(cmd.commands, child{name: name, help: n.Help})
+			}
+		}
+		commands = append(commands, cmd)
+
+		for _, n := range children {
+			walk(n, strings.TrimSpace(path+" "+n.Name), flags)
+		}
+	}
+
+	walk(app.Node, "", nil)
+	return commands
+}
+
+func enumValues(enum string) []string {
+	if enum == "" {
+		return nil
+	}
+	var values []string
+	for _, value := range strings.Split(enum, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// functionName turns the program name into a shell function name
+func functionName(program string) string {
+	return "_" + nonIdentifier.ReplaceAllString(program, "_")
+}
+
+func writeBash(w io.Writer, program string, commands []command) error {
+	fn := functionName(program)
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s completion for bash\n\n", program)
+	fmt.Fprintf(&b, "%s_node() {\n", fn)
+	b.WriteString("    commands=\"\" flags=\"\" valued=\"\" values=\"\"\n")
+	b.WriteString("    case \"$1\" in\n")
+	for _, cmd := range commands {
+		var names, flags, valued []string
+		for _, c := range cmd.commands {
+			names = append(names, c.name)
+		}
+		enums := make(map[string][]string)
+		for _, f := range cmd.flags {
+			options := []string{"--" + f.name}
+			if f.short != 0 {
+				options = append(options, "-"+string(f.short))
+			}
+			flags = append(flags, options...)
+			if f.valued {
+				valued = append(valued, options...)
+			}
+			if len(f.enum) > 0 {
+				enums[strings.Join(options, "|")] = f.enum
+			}
+		}
+
+		fmt.Fprintf(&b, "    %q)\n", cmd.path)
+		fmt.Fprintf(&b, "        commands=%q\n", strings.Join(names, " "))
+		fmt.Fprintf(&b, "        flags=%q\n", strings.Join(flags, " "))
+		fmt.Fprintf(&b, "        valued=%q\n", strings.Join(valued, " "))
+		if len(enums) > 0 {
+			patterns := make([]string, 0, len(enums))
+			for pattern := range enums {
+				patterns = append(patterns, pattern)
+			}
+			sort.Strings(patterns)
+			b.WriteString("        case \"$2\" in\n")
+			for _, pattern := range patterns {
+				fmt.Fprintf(&b, "        %s) values=%q ;;\n", pattern, strings.Join(enums[pattern], " "))
+			}
+			b.WriteString("        esac\n")
+		}
+		b.WriteString("        ;;\n")
+	}
+	b.WriteString("    esac\n}\n\n")
+
+	fmt.Fprintf(&b, `%[1]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local path="" word i commands flags valued values
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        word="${COMP_WORDS[i]}"
+        [[ "$word" == -* ]] && continue
+        %[1]s_node "$path" ""
+        [[ " $commands " == *" $word "* ]] && path="${path:+$path }$word"
+    done
+    %[1]s_node "$path" "$prev"
+    if [[ -n "$values" ]]; then
+        COMPREPLY=($(compgen -W "$values" -- "$cur"))
+    elif [[ " $valued " == *" $prev "* || "$cur" != -* && -z "$commands" ]]; then
+        COMPREPLY=($(compgen -f -- "$cur"))
+    elif [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -W "$commands" -- "$cur"))
+    fi
+}
+
+complete -o filenames -F %[1]s %[2]s
+`, fn, program)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeFish(w io.Writer, program string, commands []command) error {
+	fn := functionName(program)
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# %s completion for fish\n\n", program)
+	var paths []string
+	for _, cmd := range commands {
+		if cmd.path != "" {
+			paths = append(paths, fishQuote(cmd.path))
+		}
+	}
+	fmt.Fprintf(&b, "set -g %s_paths %s\n\n", fn, strings.Join(paths, " "))
+	fmt.Fprintf(&b, `# Succeeds when the command path typed so far is $argv[1]
+function %[1]s_at
+    set -l path ''
+    for word in (commandline -opc)[2..-1]
+        string match -q -- '-*' $word; and continue
+        set -l next (string trim -- "$path $word")
+        contains -- $next $%[1]s_paths; and set path $next
+    end
+    test "$path" = "$argv[1]"
+end
+
+`, fn)
+
+	for _, cmd := range commands {
+		condition := fishQuote(fmt.Sprintf("%s_at %s", fn, fishQuote(cmd.path)))
+		for _, c := range cmd.commands {
+			fmt.Fprintf(&b, "complete -c %s -n %s -a %s -d %s\n", program, condition, fishQuote(c.name), fishQuote(c.help))
+		}
+		for _, f := range cmd.flags {
+			line := fmt.Sprintf("complete -c %s -n %s -l %s", program, condition, f.name)
+			if f.short != 0 {
+				line += " -s " + string(f.short)
+			}
+			switch {
+			case len(f.enum) > 0:
+				line += " -x -a " + fishQuote(strings.Join(f.enum, " "))
+			case f.valued:
+				line += " -r -F"
+			}
+			fmt.Fprintf(&b, "%s -d %s\n", line, fishQuote(f.help))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fishQuote quotes a string for fish
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
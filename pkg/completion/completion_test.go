@@ -0,0 +1,89 @@
+package completion
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+type testCLI struct {
+	Verbose bool   `short:"v" help:"Verbose output"`
+	Format  string `enum:"json,text" default:"text" help:"Output format"`
+
+	Export struct {
+		Har struct {
+			Output string `short:"o" help:"Output file"`
+		} `cmd:"" help:"Write a HAR file"`
+	} `cmd:"" help:"Export the inventory"`
+
+	Serve  struct{} `cmd:"" help:"Start the proxy's server"`
+	Secret struct{} `cmd:"" hidden:""`
+}
+
+func newTestApp(t *testing.T) *kong.Application {
+	t.Helper()
+	var cli testCLI
+	parser, err := kong.New(&cli, kong.Name("my-tool"))
+	if err != nil {
+		t.Fatalf("Failed to create parser: %v", err)
+	}
+	return parser.Model
+}
+
+func TestWrite_Bash(t *testing.T) {
+	var out strings.Builder
+	if err := Write(&out, newTestApp(t), "bash"); err != nil {
+		t.Fatalf("Failed to write bash completion: %v", err)
+	}
+	script := out.String()
+
+	for _, expected := range []string{
+		`commands="export serve"`,
+		`"export har")`,
+		`flags="--help -h --verbose -v --format --output -o"`,
+		`--format) values="json text" ;;`,
+		`complete -o filenames -F _my_tool my-tool`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script:\n%s", expected, script)
+		}
+	}
+	if strings.Contains(script, "secret") {
+		t.Error("Hidden commands should not be completed")
+	}
+
+	if bash, err := exec.LookPath("bash"); err == nil {
+		cmd := exec.Command(bash, "-n")
+		cmd.Stdin = strings.NewReader(script)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("Script has syntax errors: %v\n%s", err, output)
+		}
+	}
+}
+
+func TestWrite_Fish(t *testing.T) {
+	var out strings.Builder
+	if err := Write(&out, newTestApp(t), "fish"); err != nil {
+		t.Fatalf("Failed to write fish completion: %v", err)
+	}
+	script := out.String()
+
+	for _, expected := range []string{
+		`set -g _my_tool_paths 'export' 'export har' 'serve'`,
+		`complete -c my-tool -n '_my_tool_at \'\'' -a 'serve' -d 'Start the proxy\'s server'`,
+		`complete -c my-tool -n '_my_tool_at \'export har\'' -l output -s o -r -F -d 'Output file'`,
+		`complete -c my-tool -n '_my_tool_at \'\'' -l format -x -a 'json text' -d 'Output format'`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("Expected %q in script:\n%s", expected, script)
+		}
+	}
+}
+
+func TestWrite_UnsupportedShell(t *testing.T) {
+	if err := Write(&strings.Builder{}, newTestApp(t), "tcsh"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+}
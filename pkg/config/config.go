@@ -6,17 +6,230 @@ import (
 
 // CLI defines command line interface configuration
 type CLI struct {
-	Port         int    `short:"p" default:"8080" help:"プロキシサーバーのポート番号"`
-	InventoryDir string `short:"i" default:"./inventory" help:"inventoryディレクトリのパス"`
-	LogLevel     string `short:"l" default:"info" help:"ログレベル (debug, info, warn, error)" env:"LOG_LEVEL"`
+	Port         int      `short:"p" default:"8080" help:"プロキシサーバーのポート番号"`
+	Listen       string   `help:"待ち受けアドレス (例: 127.0.0.1、::1、[::]:8080、unix:/tmp/proxy.sock。ポート省略時は --port、省略時はすべてのインターフェース)"`
+	InventoryDir string   `short:"i" default:"./inventory" help:"inventoryディレクトリのパス"`
+	LogLevel     string   `short:"l" default:"info" help:"ログレベル (debug, info, warn, error)" env:"LOG_LEVEL"`
+	LogFormat    string   `default:"console" enum:"console,json" help:"ログの出力形式 (console, json)" env:"LOG_FORMAT"`
+	LogModule    []string `help:"モジュールごとのログレベル (例: playback=debug,inventory=warn)" placeholder:"MODULE=LEVEL"`
+	AdminPort    int      `default:"0" help:"管理APIのポート番号 (0で無効)"`
+	AdminSocket  string   `help:"管理APIを待ち受けるUnixソケットのパス (--admin-portの代わり)" type:"path"`
+
+	AccessLog         string        `help:"再生したリクエストをJSONLで書き出すアクセスログのファイル" type:"path"`
+	AccessLogMaxSize  int           `default:"100" help:"アクセスログをローテーションするサイズ(MB、0で無効)"`
+	AccessLogMaxAge   time.Duration `default:"0s" help:"アクセスログをローテーションする経過時間 (例: 24h、0で無効)"`
+	AccessLogKeep     int           `default:"7" help:"保持するローテーション済みアクセスログの数 (0ですべて保持)"`
+	AccessLogCompress bool          `help:"ローテーション済みのアクセスログをgzipで圧縮"`
 
 	Recording struct {
-		URL        string `arg:"" required:"" help:"記録対象のURL"`
-		NoBeautify bool   `help:"HTML・CSS・JavaScriptのBeautifyを無効化"`
+		URL           string   `arg:"" required:"" help:"記録対象のURL"`
+		NoBeautify    bool     `help:"HTML・CSS・JavaScriptのBeautifyを無効化"`
+		SplitByDomain bool     `help:"ドメインごとに分割したinventoryを domains/<host> に保存"`
+		AuthHeader    []string `help:"記録時に上流へ付与するヘッダー (例: 'X-Api-Key: secret@staging.example.com'、ドメイン省略時は記録対象のドメイン)" sep:"none"`
+		Sample        []string `placeholder:"PATTERN=1/N|PATTERN=max:M" help:"URLパターン(host/path)ごとに記録するレスポンスを間引く (例: api.example.com/poll*=1/10)"`
+		TagClients    bool     `help:"リクエスト元のクライアント(プロキシ認証ユーザーまたは送信元IP)をリソースに記録"`
+		BasicAuth     []string `help:"記録時に上流へ付与するBasic認証 (例: user:pass@staging.example.com、ドメイン省略時は記録対象のドメイン)" sep:"none"`
+		PostProcess   []string `help:"inventory保存前に記録したトランザクション(JSON配列)を標準入力で受け取り、残すものを標準出力に返すコマンド (複数指定で順に実行)" sep:"none" placeholder:"COMMAND"`
+
+		FollowRedirectsOnRecord bool `help:"クライアントが辿らなかったリダイレクト先を保存時に取得して記録"`
+		MinFreeSpace            int  `default:"0" help:"inventoryのディスクの空き容量がこれを下回ったら録画を停止してinventoryを保存 (MB、0で無効)"`
+
+		Fsync string `default:"inventory" enum:"none,inventory,all" help:"保存したファイルをfsyncする範囲 (none: しない, inventory: inventory.jsonのみ, all: コンテンツファイルも)"`
+
+		RotateEvery time.Duration `default:"0s" help:"録画をこの間隔で区切り、それぞれ単独で再生できるinventoryとしてsegments/に保存 (例: 1h、0で無効)"`
+		RotateSize  int           `default:"0" help:"記録したボディがこのサイズに達したら録画を区切ってsegments/に保存 (MB、0で無効)"`
+
+		DNS string `name:"dns" placeholder:"SERVER|URL" help:"上流のホスト名をこのDNSサーバー (例: 1.1.1.1:53) またはDNS over HTTPSのURL (例: https://cloudflare-dns.com/dns-query) で解決 (ホストごとのIPアドレスとともにinventoryに記録)"`
+
+		NormalizeJSON bool `name:"normalize-json" help:"JSONのコンテンツファイルをキーの順序を揃えインデントと末尾の改行を付けて保存 (録画し直したときのgitの差分を最小化)"`
+		KeepOriginals bool `help:"--normalize-json で書き換えたファイルの受信したままの内容をoriginals/に保存 (コンテンツファイルを編集するまではそちらを再生)"`
+
+		Append bool `help:"既存のinventoryを置き換えず、記録し直さなかったリソースを残して追記"`
+
+		AutosaveInterval time.Duration `default:"0s" help:"前回の自動保存以降に完了したリクエストをこの間隔でinventoryに保存 (例: 30s、0で無効)"`
+		AutosaveCount    int           `default:"0" help:"この数のリクエストが完了するごとにinventoryに保存 (0で無効)"`
+
+		OnExitSaveTimeout time.Duration `default:"8s" help:"終了時 (SIGINT・SIGTERM・SIGHUP、パニックからの回復時) にinventoryの保存を待つ上限時間 (docker stop の猶予 10 秒より短い値、0で無制限)"`
+
+		IncludeDomains []string `placeholder:"PATTERN" help:"このホスト名のパターン(glob、例: example.com,*.example.com)に一致するドメインへのリクエストだけを記録 (それ以外は記録せずに中継)"`
+		ExcludeDomains []string `placeholder:"PATTERN" help:"このホスト名のパターン(glob、例: *.doubleclick.net)に一致するドメインへのリクエストを記録せずに中継"`
+		IncludeURL     []string `sep:"none" placeholder:"REGEXP" help:"URLがこの正規表現に一致するリクエストだけを記録 (複数指定可、それ以外は記録せずに中継)"`
+		ExcludeURL     []string `sep:"none" placeholder:"REGEXP" help:"URLがこの正規表現 (例: /health$、/beacon) に一致するリクエストを記録せずに中継 (複数指定可)"`
+		KeepRepeats    []string `sep:"none" placeholder:"REGEXP" help:"URLがこの正規表現 (例: /api/poll) に一致するリクエストは、最新の1件に絞らず記録したレスポンスをすべて記録順に保存 (複数指定可、再生時の順序は --repeats)"`
+
+		MaxBodySize      int      `default:"0" help:"これより大きいレスポンスボディは保存せず、ステータス・ヘッダー・タイミング・サイズだけを記録 (MB、0で無効)"`
+		SkipContentTypes []string `placeholder:"PATTERN" help:"このメディアタイプのパターン(glob、例: video/*,font/*)に一致するレスポンスボディは保存せず、サイズなどのメタデータだけを記録 (再生時は同じサイズのパディングを返す)"`
+
+		Redact       bool   `help:"Authorization・Cookie・Set-Cookieヘッダーを除いてinventoryを保存 (生きたトークンをリポジトリにコミットしないため)"`
+		RedactConfig string `type:"path" help:"--redact で除くヘッダー・クエリパラメーターと方式 (strip: 削除、hash: ハッシュに置換)、レスポンスボディの置換ルールを追加するJSONファイル (指定すると --redact も有効)"`
+
+		StripAltSvc bool `help:"レスポンスからAlt-Svcヘッダーを除き、ブラウザがQUIC (HTTP/3) でプロキシを迂回しないようにする (HTTP/3の広告はinventoryのドメインに記録)"`
 	} `cmd:"" help:"指定URLへの通信を記録"`
 
 	Playback struct {
+		Scenario    string `help:"検証シナリオ(期待するリクエスト)のJSONファイル" type:"path"`
+		Policies    string `help:"リクエスト分類とポリシーのJSONファイル" type:"path"`
+		Truncated   string `default:"serve" enum:"serve,skip" help:"途中で切れたレスポンスの扱い (serve: 記録どおり再生, skip: 再生しない)"`
+		NoCalibrate bool   `help:"プロキシ自身の処理時間の補正を無効化"`
+		Checksum    string `default:"off" enum:"off,warn,fail" help:"コンテンツファイルのチェックサム検証 (off: しない, warn: 警告のみ, fail: 500エラーを返す)"`
+		Plan        bool   `help:"起動せずに、読み込んだ設定と再生ルートの一覧を表示"`
+		DumpDir     string `help:"未記録リクエストのブロックやシナリオ失敗時に診断情報を書き出すディレクトリ" type:"path"`
+
+		Strict       bool `help:"inventoryにないリクエストを上流へ転送せず、--strict-status とJSONの説明で応答 (ポリシーより優先)"`
+		StrictStatus int  `default:"504" help:"--strict で未記録のリクエストに返すステータスコード"`
+		RecordMisses bool `help:"inventoryにないリクエストを上流へ転送し、そのレスポンスをinventoryに追記 (次のリクエストからは再生)"`
+
+		LinkRule     []string `help:"再生するLinkヘッダーのヒントをrelごとに削除、またはヒント先のリソースの応答を遅延 (例: preconnect=strip、preload=delay:300ms)" sep:"none" placeholder:"REL=strip|REL=delay:DURATION"`
+		RewriteRules string   `type:"path" help:"再生するレスポンスボディを正規表現で書き換えるルールのJSONファイル (本番のホスト名の置き換え、バナーのスクリプトの挿入など)"`
+
+		MeasureEncoding bool     `help:"起動せずに、各リソースを --measure-codecs のコーデックで圧縮したサイズと時間を表示"`
+		MeasureCodecs   []string `default:"gzip:6,gzip:9,br:4,br:11,zstd:3" placeholder:"ENCODING:LEVEL" help:"--measure-encoding で比較するコーデックと圧縮レベル (gzip、deflate、br、zstd)"`
+
+		PadToRecordedSize bool     `help:"再圧縮で小さくなったボディを記録時の転送サイズまでパディング (gzipヘッダーのコメント、HTML・CSS・JavaScriptの末尾コメント)"`
+		MatchPrefetch     bool     `help:"プリフェッチ(Sec-Purpose: prefetch)のリクエストには、同じURLのプリフェッチ時に記録したレスポンスを返す"`
+		MaxHeaderBytes    int      `help:"リクエストヘッダーの上限バイト数。超えたリクエストには431を返す (0: 組み込みの1MB制限のみ)"`
+		Profile           string   `help:"起動時に適用するネットワークプロファイル (一覧は profiles list)"`
+		Profiles          string   `help:"カスタムのネットワークプロファイルを定義するJSONファイル (組み込みと同じ名前なら置き換え)" type:"path"`
+		FaultPreset       []string `sep:"none" placeholder:"NAME[@HOST,...]" help:"起動時に障害プリセットを適用 (cdn-outage: 503とRetry-After: 30、origin-slow: HTMLのTTFBを+2秒。@以降のホスト(glob)に限定可、繰り返し指定可、一覧は profiles list)"`
+		Schedule          string   `help:"再生中に時間経過でネットワーク条件を切り替えるスケジュールのJSONファイル" type:"path"`
+		CompleteAtHeader  bool     `help:"レスポンスの送信完了予定時刻をx-playback-complete-atヘッダー(RFC 3339)で返す"`
+		Preload           bool     `help:"起動時にinventoryの全HTTPSホストのTLS証明書を生成し、ホストごとの最初のリクエストの遅延をなくす (ボディの準備は指定しなくても起動時に行う)"`
+		NoBuiltinFallback bool     `help:"記録していないfavicon.ico・apple-touch-icon・/.well-known/へのリクエストをローカルで204/404応答せず、上流へ転送"`
+		EmulateTLS        bool     `name:"emulate-tls" help:"クライアント接続ごとの最初のレスポンスを記録したTLSハンドシェイクの時間だけ遅らせる (同じホストへの2回目以降の接続はセッション再開の速さ)"`
+		EmulateConnect    bool     `help:"ドメインごとの最初のレスポンスを記録したDNS解決・TCP接続・TLSハンドシェイクの時間だけ遅らせ、初回訪問の接続確立を再現 (--emulate-tls と併用するとTLSは接続ごとに加算)"`
+		MatchConcurrency  bool     `help:"ドメインごとの同時リクエスト数を記録時に観測した最大値までに制限し、超えたリクエストは空きを待たせる"`
+		MatchProtocol     bool     `help:"HTTP/1.1だけで記録したドメインへの同時リクエスト数を、ブラウザの接続数 (6) までに制限 (同時実行数の近似で、記録時のプロトコル自体は再現しない)"`
+
+		IgnoreQueryParam []string `help:"URLが完全に一致する記録がないとき、このクエリパラメーター(glob、例: v,_,utm_*)を除いて記録と照合" placeholder:"NAME"`
+		IgnoreQuery      bool     `help:"URLが完全に一致する記録がないとき、クエリ文字列全体を除いて記録と照合"`
+		MatchRewrite     []string `help:"URLが完全に一致する記録がないとき、記録とリクエストのURLを正規表現で書き換えて照合 (複数指定で順に適用)" sep:"none" placeholder:"REGEXP=>REPLACEMENT"`
+		MapHost          []string `help:"REQUESTEDのホストへのリクエストを、RECORDEDのホストで記録したリソースで応答 (LocationとSet-CookieのDomainはREQUESTEDに書き換え、複数指定可)" sep:"none" placeholder:"REQUESTED=>RECORDED"`
+		MatchBody        bool     `help:"リクエストボディ付きで記録したURLは、正規化したボディ (JSONのキー順・空白、フォームの項目順を無視) も一致する記録のみで応答"`
+		Language         string   `help:"複数の言語で記録したURLは、Accept-Languageに関わらずこの言語 (例: ja、en-US) の記録で応答"`
+		Repeats          string   `default:"sequence" enum:"sequence,round-robin" help:"--keep-repeats で同じリクエストに複数記録したレスポンスを返す順序 (sequence: 記録順に返し最後のものを返し続ける, round-robin: 記録順に繰り返す)"`
+
+		InventoryURL      string `name:"inventory-url" help:"起動時にHTTPで取得してinventoryディレクトリに展開するinventoryのtar.gz (ETagでキャッシュ、中断したダウンロードは再開)"`
+		InventoryChecksum string `help:"--inventory-url のSHA-256 (16進数、またはsha256sum形式のファイルのURL)"`
+		InventoryPubkey   string `help:"--inventory-url の署名 (<url>.minisig) を検証するminisignの公開鍵 (base64またはファイルのパス)"`
+
+		InMemory     bool `help:"--inventory-url のtar.gzをディスクに展開せず、すべてメモリに読み込んで再生"`
+		MemoryBudget int  `default:"1024" help:"--in-memory で必要なメモリの見積もりがこれを超えたら起動しない (MB、0で無制限)"`
 	} `cmd:"" help:"記録した通信を再生"`
+
+	Fmt struct {
+		DryRun     bool `help:"ファイルを書き換えずに差分を表示"`
+		IndentSize int  `default:"2" help:"Beautify時のインデント幅"`
+
+		Beautify struct{} `cmd:"" help:"HTML・CSS・JavaScriptのコンテンツを再整形"`
+		Minify   struct{} `cmd:"" help:"HTML・CSS・JavaScriptのコンテンツを圧縮"`
+	} `cmd:"" help:"inventory内のコンテンツファイルを一括で再整形"`
+
+	Export struct {
+		Openapi struct {
+			Output string `short:"o" help:"出力先ファイル (省略時は標準出力)" type:"path"`
+			Title  string `default:"Recorded API" help:"OpenAPIドキュメントのタイトル"`
+		} `cmd:"" name:"openapi" help:"記録したJSON APIからOpenAPIドキュメントの下書きを生成"`
+
+		Static struct {
+			Dir string `arg:"" help:"出力先ディレクトリ" type:"path"`
+		} `cmd:"" help:"プロキシなしで配信できる静的ファイル一式を書き出し"`
+
+		K6 struct {
+			Output      string        `short:"o" help:"出力先ファイル (省略時は標準出力)" type:"path"`
+			BatchWindow time.Duration `default:"50ms" help:"開始時刻がこの範囲内のリクエストを1つのhttp.batchにまとめる"`
+		} `cmd:"" name:"k6" help:"記録したリクエストの順序と間隔からk6の負荷試験スクリプトの雛形を生成"`
+
+		Har struct {
+			Output string `short:"o" help:"出力先ファイル (省略時は標準出力)" type:"path"`
+		} `cmd:"" name:"har" help:"記録したinventoryをHAR 1.2ファイルに書き出し (Chrome DevToolsなどで表示可能)"`
+	} `cmd:"" help:"inventoryを他の形式に書き出し"`
+
+	Import struct {
+		Har struct {
+			File       string `arg:"" help:"読み込むHARファイル" type:"path"`
+			NoBeautify bool   `help:"HTML・CSS・JavaScriptのBeautifyを無効化"`
+		} `cmd:"" name:"har" help:"Chromeなどで保存したHARファイルからinventoryを作成"`
+	} `cmd:"" help:"他の形式からinventoryを作成"`
+
+	NormalizeTiming struct {
+		Percentile float64  `default:"95" help:"ドメインごとにTTFBをこのパーセンタイルで上限、Mbpsを(100-値)パーセンタイルで下限に丸める (0で無効)"`
+		TTFB       []string `name:"ttfb" placeholder:"TYPE=MS" help:"Content-Typeごとに固定するTTFB (例: image/*=50)"`
+		Mbps       []string `placeholder:"TYPE=MBPS" help:"Content-Typeごとに固定するMbps (例: text/html=20)"`
+		DryRun     bool     `help:"inventoryを書き換えずに変更内容を表示"`
+	} `cmd:"" help:"不安定なネットワークで記録したTTFB・Mbpsの外れ値を補正"`
+
+	RewriteUrls struct {
+		From   string `required:"" help:"置き換える URL の先頭部分 (例: https://old.cdn.com)"`
+		To     string `required:"" help:"置き換え後の URL の先頭部分 (例: https://new.cdn.com)"`
+		DryRun bool   `help:"inventoryを書き換えずに変更内容を表示"`
+	} `cmd:"" name:"rewrite-urls" help:"リソースのURL、コンテンツファイルのパス、HTML・CSS内の参照を一括で書き換え"`
+
+	SplitClients struct{} `cmd:"" help:"--tag-clients で記録したinventoryをクライアントごとに clients/<client> へ分割"`
+
+	Preloads struct{} `cmd:"" help:"記録したレスポンスのpreload・preconnectなどのLinkヒントと、ヒント先が実際にリクエストされた時刻を表示"`
+
+	Checksum struct {
+		Verify struct{} `cmd:"" help:"コンテンツファイルが記録時から変更されていないか検証"`
+		Update struct{} `cmd:"" help:"現在のコンテンツファイルでチェックサムを更新"`
+	} `cmd:"" help:"コンテンツファイルのチェックサムを管理"`
+
+	Profiles struct {
+		List struct {
+			Profiles string `help:"カスタムのネットワークプロファイルを定義するJSONファイルも読み込む" type:"path"`
+		} `cmd:"" help:"ネットワークプロファイルの遅延と帯域、障害プリセットを一覧表示"`
+	} `cmd:"" help:"ネットワークプロファイル (playback --profile、PUT /conditions で使用)"`
+
+	Cert struct {
+		Install struct {
+			System        bool     `help:"システムの証明書バンドルに追加 (update-ca-certificates / update-ca-trust、root権限が必要)"`
+			Nss           bool     `help:"Chromium・FirefoxのNSSデータベースに追加 (certutilが必要)"`
+			Java          bool     `help:"JDKのcacertsに追加 (keytoolが必要)"`
+			NssDb         []string `help:"追加先のNSSデータベースのディレクトリ (省略時は ~/.pki/nssdb とFirefoxのプロファイル)" type:"path"`
+			JavaKeystore  string   `help:"追加先のJavaキーストア (省略時はJDKのcacerts)" type:"path"`
+			JavaStorepass string   `default:"changeit" help:"Javaキーストアのパスワード"`
+			DryRun        bool     `help:"実行せずにコマンドを表示"`
+		} `cmd:"" help:"プロキシのCA証明書を信頼ストアにインストール (CA未生成の場合は生成)"`
+
+		Export struct {
+			Output string `short:"o" help:"出力先ファイル (省略時は標準出力)" type:"path"`
+			Format string `default:"pem" enum:"pem,der" help:"証明書の形式 (pem, der)"`
+		} `cmd:"" help:"プロキシのCA証明書をPEMまたはDER形式で書き出し (CA未生成の場合は生成、秘密鍵は含まない)"`
+
+		Regenerate struct{} `cmd:"" help:"プロキシのCAを新しく生成し直す (インストール済みの信頼ストアには cert install で再インストールが必要)"`
+	} `cmd:"" help:"プロキシのCA証明書を管理"`
+
+	Localize struct {
+		Export struct {
+			Output string `short:"o" help:"出力先のCSVファイル (省略時は標準出力)" type:"path"`
+		} `cmd:"" help:"HTML・JSONのテキストを翻訳用のCSVに書き出し"`
+
+		Import struct {
+			CSV    string `arg:"" name:"csv" help:"translation列を記入したCSVファイル" type:"path"`
+			Output string `arg:"" help:"ローカライズしたinventoryの出力先ディレクトリ" type:"path"`
+		} `cmd:"" help:"翻訳したCSVを適用したinventoryを別のディレクトリに作成"`
+	} `cmd:"" help:"inventoryのテキストを翻訳して別言語版のinventoryを作成"`
+
+	Merge struct {
+		Output  string   `arg:"" help:"統合先のinventoryディレクトリ" type:"path"`
+		Sources []string `arg:"" help:"統合するinventoryディレクトリ (後に指定したものが優先)" type:"path"`
+	} `cmd:"" help:"複数のinventoryを一つに統合"`
+
+	Mount struct {
+		Mountpoint string `arg:"" help:"マウント先のディレクトリ" type:"path"`
+		Sidecars   bool   `help:"各リソースのステータスとヘッダーを <ファイル>.headers として併せて表示"`
+		Debug      bool   `help:"FUSEのリクエストをログに出力"`
+	} `cmd:"" help:"inventoryをドメイン・パスごとのファイルとして読み取り専用でマウント (FUSE、Linux・macOS)"`
+
+	Completion struct {
+		Shell string `arg:"" enum:"bash,zsh,fish" help:"対象のシェル (bash, zsh, fish)"`
+	} `cmd:"" help:"シェル補完スクリプトを標準出力に書き出し (例: source <(http-playback-proxy completion bash))"`
+
+	Tui struct{} `cmd:"" name:"tui" help:"inventoryの閲覧、再生の開始・停止、アクセスログの表示を対話的に行うターミナルUI"`
+
+	Doctor struct {
+		CheckURL string        `default:"https://www.example.com/" help:"疎通確認と時刻ずれ確認に使うURL"`
+		Timeout  time.Duration `default:"10s" help:"疎通確認のタイムアウト"`
+	} `cmd:"" help:"動作環境を診断し、よくある問題と対処法を表示"`
 }
 
 // Config holds all configuration for the proxy
@@ -24,6 +237,9 @@ type Config struct {
 	Port         int
 	InventoryDir string
 	LogLevel     string
+	LogFormat    string
+	LogModules   map[string]string
+	AdminPort    int
 	Recording    RecordingConfig
 	Playback     PlaybackConfig
 	Proxy        ProxyConfig
@@ -31,17 +247,79 @@ type Config struct {
 
 // RecordingConfig holds recording-specific configuration
 type RecordingConfig struct {
-	TargetURL   string
-	NoBeautify  bool
-	ChunkSize   int
-	Timeout     time.Duration
+	TargetURL         string
+	NoBeautify        bool
+	SplitByDomain     bool
+	AuthHeaders       []string
+	BasicAuth         []string
+	TagClients        bool
+	Sampling          []string
+	PostProcess       []string
+	FollowRedirects   bool
+	MinFreeSpace      int
+	Fsync             string
+	RotateEvery       time.Duration
+	RotateSize        int
+	DNS               string
+	NormalizeJSON     bool
+	KeepOriginals     bool
+	Append            bool
+	AutosaveInterval  time.Duration
+	AutosaveCount     int
+	OnExitSaveTimeout time.Duration
+	IncludeDomains    []string
+	ExcludeDomains    []string
+	IncludeURLs       []string
+	ExcludeURLs       []string
+	KeepRepeats       []string
+	MaxBodySize       int
+	SkipContentTypes  []string
+	Redact            bool
+	RedactConfig      string
+	StripAltSvc       bool
+	ChunkSize         int
+	Timeout           time.Duration
 }
 
 // PlaybackConfig holds playback-specific configuration
 type PlaybackConfig struct {
-	ChunkSize       int
-	EnableUpstream  bool
-	UpstreamTimeout time.Duration
+	ChunkSize          int
+	EnableUpstream     bool
+	UpstreamTimeout    time.Duration
+	ScenarioFile       string
+	PolicyFile         string
+	SkipTruncated      bool
+	DisableCalibration bool
+	Checksum           string
+	DumpDir            string
+	PadToWireSize      bool
+	MatchPrefetch      bool
+	MaxHeaderBytes     int
+	Profile            string
+	ProfilesFile       string
+	FaultPresets       []string
+	ScheduleFile       string
+	CompleteAtHeader   bool
+	Preload            bool
+	EmulateTLS         bool
+	EmulateConnect     bool
+	NoBuiltinFallback  bool
+	MatchConcurrency   bool
+	MatchProtocol      bool
+	IgnoreQueryParams  []string
+	IgnoreQuery        bool
+	MatchRewrites      []string
+	MapHosts           []string
+	MatchRequestBody   bool
+	Language           string
+	Repeats            string
+	Strict             bool
+	StrictStatus       int
+	RecordMisses       bool
+	LinkRules          []string
+	RewriteRules       string
+	MeasureCodecs      []string
+	InMemory           bool
 }
 
 // ProxyConfig holds proxy-specific configuration
@@ -0,0 +1,101 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// Rule injects a header into requests for matching hosts
+type Rule struct {
+	// Host is a glob matched against the request host without port
+	Host   string
+	Header string
+	Value  string
+}
+
+// Injector adds credentials to upstream requests
+type Injector struct {
+	rules []Rule
+	// hosts are the compiled host patterns of the rules; nil for invalid patterns, which match nothing
+	hosts []*match.Pattern
+}
+
+// NewInjector creates an injector from rules
+func NewInjector(rules []Rule) *Injector {
+	injector := &Injector{rules: rules}
+	for _, rule := range rules {
+		pattern, _ := match.Compile(rule.Host)
+		injector.hosts = append(injector.hosts, pattern)
+	}
+	return injector
+}
+
+// splitDomain splits "value@domain" at the last '@'; without a domain, defaultHost is used
+// so credentials are never sent to third-party hosts by accident. IPv6 literals may be bracketed
+// as in URLs; the brackets are removed since hosts are matched without them.
+func splitDomain(spec, defaultHost string) (string, string) {
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		return spec[:i], unbracket(strings.ToLower(spec[i+1:]))
+	}
+	return spec, unbracket(strings.ToLower(defaultHost))
+}
+
+func unbracket(host string) string {
+	// Globs may use brackets too; only IPv6 literals contain colons
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") && strings.Contains(host, ":") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// ParseHeader parses "Name: value[@domain]"
+func ParseHeader(spec, defaultHost string) (Rule, error) {
+	header, host := splitDomain(spec, defaultHost)
+	name, value, ok := strings.Cut(header, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return Rule{}, fmt.Errorf("invalid auth header %q, expected \"Name: value@domain\"", spec)
+	}
+	return newRule(host, name, strings.TrimSpace(value))
+}
+
+// ParseBasicAuth parses "user:pass[@domain]" into an Authorization header rule
+func ParseBasicAuth(spec, defaultHost string) (Rule, error) {
+	userinfo, host := splitDomain(spec, defaultHost)
+	if !strings.Contains(userinfo, ":") {
+		return Rule{}, fmt.Errorf("invalid basic auth %q, expected \"user:pass@domain\"", spec)
+	}
+	value := "Basic " + base64.StdEncoding.EncodeToString([]byte(userinfo))
+	return newRule(host, "Authorization", value)
+}
+
+// newRule validates and creates a rule
+func newRule(host, header, value string) (Rule, error) {
+	if host == "" {
+		return Rule{}, fmt.Errorf("no domain given for %s credentials", header)
+	}
+	if _, err := match.Compile(host); err != nil {
+		return Rule{}, fmt.Errorf("invalid domain pattern: %w", err)
+	}
+	return Rule{Host: host, Header: http.CanonicalHeaderKey(header), Value: value}, nil
+}
+
+// Apply sets the headers of all rules matching host and returns the names of injected headers
+func (i *Injector) Apply(host string, header http.Header) []string {
+	if i == nil {
+		return nil
+	}
+	host = strings.ToLower(host)
+	var injected []string
+	for n, rule := range i.rules {
+		if i.hosts[n] != nil && i.hosts[n].Match(host) {
+			header.Set(rule.Header, rule.Value)
+			injected = append(injected, rule.Header)
+		}
+	}
+	return injected
+}
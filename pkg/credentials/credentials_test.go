@@ -0,0 +1,65 @@
+package credentials
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseAndApply(t *testing.T) {
+	basic, err := ParseBasicAuth("user:p@ss@staging.example.com", "www.example.com")
+	if err != nil {
+		t.Fatalf("Failed to parse basic auth: %v", err)
+	}
+	token, err := ParseHeader("X-Api-Key: secret", "www.example.com")
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+	wildcard, err := ParseHeader("X-Env: staging@*.internal.example", "www.example.com")
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	ipv6, err := ParseHeader("X-Local: yes@[::1]", "www.example.com")
+	if err != nil {
+		t.Fatalf("Failed to parse header: %v", err)
+	}
+
+	injector := NewInjector([]Rule{basic, token, wildcard, ipv6})
+
+	testCases := []struct {
+		host     string
+		header   string
+		expected string
+	}{
+		// The password contains '@'; the domain is taken after the last one
+		{"staging.example.com", "Authorization", "Basic dXNlcjpwQHNz"},
+		{"www.example.com", "X-Api-Key", "secret"},
+		{"cdn.example.com", "X-Api-Key", ""},
+		{"api.internal.example", "X-Env", "staging"},
+		{"STAGING.example.com", "Authorization", "Basic dXNlcjpwQHNz"},
+		// Hosts are matched as URL.Hostname() returns them, without IPv6 brackets
+		{"::1", "X-Local", "yes"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host+" "+tc.header, func(t *testing.T) {
+			header := make(http.Header)
+			injector.Apply(tc.host, header)
+			if got := header.Get(tc.header); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	if _, err := ParseHeader("no-colon@example.com", ""); err == nil {
+		t.Error("Expected error for header without colon")
+	}
+	if _, err := ParseBasicAuth("user@example.com", ""); err == nil {
+		t.Error("Expected error for basic auth without password")
+	}
+	if _, err := ParseHeader("X-Key: v", ""); err == nil {
+		t.Error("Expected error without any domain")
+	}
+}
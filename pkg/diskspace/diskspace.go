@@ -0,0 +1,35 @@
+package diskspace
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Available returns the number of bytes available to the current user on the
+// filesystem containing path. If path does not exist yet, its nearest existing
+// parent directory is used.
+func Available(path string) (uint64, error) {
+	dir, err := existingDir(path)
+	if err != nil {
+		return 0, err
+	}
+	return available(dir)
+}
+
+// existingDir walks up from path until it finds a directory that exists
+func existingDir(path string) (string, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir, nil
+		}
+		dir = parent
+	}
+}
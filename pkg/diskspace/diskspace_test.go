@@ -0,0 +1,27 @@
+package diskspace
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAvailable(t *testing.T) {
+	dir := t.TempDir()
+
+	free, err := Available(dir)
+	if err != nil {
+		t.Fatalf("Failed to get available space: %v", err)
+	}
+	if free == 0 {
+		t.Error("Expected some free space in temp dir")
+	}
+
+	// A path that does not exist yet resolves to its existing parent
+	missing, err := Available(filepath.Join(dir, "not", "created", "yet"))
+	if err != nil {
+		t.Fatalf("Failed to get available space for missing path: %v", err)
+	}
+	if missing == 0 {
+		t.Error("Expected free space for missing path")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package diskspace
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func available(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, fmt.Errorf("failed to stat filesystem: %w", err)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
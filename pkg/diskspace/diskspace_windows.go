@@ -0,0 +1,21 @@
+//go:build windows
+
+package diskspace
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+func available(dir string) (uint64, error) {
+	name, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &free, &total, &totalFree); err != nil {
+		return 0, fmt.Errorf("failed to get disk free space: %w", err)
+	}
+	return free, nil
+}
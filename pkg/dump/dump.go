@@ -0,0 +1,122 @@
+package dump
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-http-playback-proxy/pkg/accesslog"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/scenario"
+)
+
+// Reasons a bundle is written
+const (
+	ReasonMiss     = "miss"     // A request was not recorded and upstream was blocked
+	ReasonScenario = "scenario" // Scenario verification failed
+)
+
+// Request is the request that caused the failure
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	// Body is set for UTF-8 bodies, BodyBase64 for binary ones
+	Body       string `json:"body,omitempty"`
+	BodyBase64 string `json:"bodyBase64,omitempty"`
+}
+
+// NewRequest captures a request, keeping the body readable when it is text
+func NewRequest(method, url string, headers http.Header, body []byte) *Request {
+	request := &Request{Method: method, URL: url, Headers: headers}
+	if utf8.Valid(body) {
+		request.Body = string(body)
+	} else {
+		request.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+	return request
+}
+
+// Bundle is the diagnostic information written for a playback failure
+type Bundle struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Detail string    `json:"detail,omitempty"`
+	// Request is set for failures caused by a single request
+	Request *Request `json:"request,omitempty"`
+	// NearestKeys are the recorded keys most similar to the request
+	NearestKeys []string          `json:"nearestKeys,omitempty"`
+	Scenario    *scenario.Report  `json:"scenario,omitempty"`
+	Recent      []accesslog.Entry `json:"recent,omitempty"`
+}
+
+// Writer writes bundles as JSON files to a directory
+type Writer struct {
+	// Redaction strips or hashes credentials in the written requests and URLs like in the
+	// inventory; nil writes them as received
+	Redaction *inventory.Redaction
+
+	dir   string
+	seq   int
+	mutex sync.Mutex
+}
+
+// NewWriter creates a writer for the given directory, which is created on first write
+func NewWriter(dir string) *Writer {
+	return &Writer{dir: dir}
+}
+
+// Write saves a bundle and returns its path
+func (w *Writer) Write(bundle *Bundle) (string, error) {
+	if bundle.Time.IsZero() {
+		bundle.Time = time.Now()
+	}
+	w.redact(bundle)
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal dump: %w", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create dump directory: %w", err)
+	}
+	w.seq++
+	name := fmt.Sprintf("%s-%04d-%s.json", bundle.Time.Format("20060102T150405.000"), w.seq, bundle.Reason)
+	path := filepath.Join(w.dir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write dump: %w", err)
+	}
+	return path, nil
+}
+
+// redact applies the writer's redaction to the request and recent requests of a bundle
+func (w *Writer) redact(bundle *Bundle) {
+	if w.Redaction == nil {
+		return
+	}
+	if request := bundle.Request; request != nil {
+		redacted := *request
+		redacted.URL = w.Redaction.RedactURL(request.URL)
+		redacted.Headers = w.Redaction.RedactHeader(request.Headers)
+		if request.Body != "" {
+			redacted.Body = string(w.Redaction.RedactBody(request.Headers.Get("Content-Type"), []byte(request.Body)))
+		}
+		bundle.Request = &redacted
+	}
+	if len(bundle.Recent) > 0 {
+		recent := make([]accesslog.Entry, len(bundle.Recent))
+		for i, entry := range bundle.Recent {
+			entry.URL = w.Redaction.RedactURL(entry.URL)
+			recent[i] = entry
+		}
+		bundle.Recent = recent
+	}
+}
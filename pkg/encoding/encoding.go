@@ -292,6 +292,12 @@ func (d *IdentityDecoder) Decode(data []byte) ([]byte, error) {
 	return result, nil
 }
 
+// Supported reports whether data can be encoded and decoded with the content coding
+func Supported(encodingType types.ContentEncodingType) bool {
+	_, err := CreateEncoder(encodingType, 0)
+	return err == nil
+}
+
 // CreateEncoder creates encoders based on ContentEncodingType
 func CreateEncoder(encodingType types.ContentEncodingType, level int) (Encoder, error) {
 	switch encodingType {
@@ -348,4 +354,88 @@ func DecodeData(data []byte, encodingType types.ContentEncodingType) ([]byte, er
 		return nil, err
 	}
 	return decoder.Decode(data)
-}
\ No newline at end of file
+}
+// DecodePrefix decodes as much of a truncated encoded stream as is complete, e.g. the part of a
+// compressed body received before the transfer paused
+func DecodePrefix(data []byte, encodingType types.ContentEncodingType) []byte {
+	var reader io.Reader
+	switch encodingType {
+	case types.ContentEncodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		reader = gz
+	case types.ContentEncodingDeflate:
+		reader = flate.NewReader(bytes.NewReader(data))
+	case types.ContentEncodingCompress:
+		reader = lzw.NewReader(bytes.NewReader(data), lzw.MSB, 8)
+	case types.ContentEncodingBr:
+		reader = brotli.NewReader(bytes.NewReader(data))
+	case types.ContentEncodingZstd:
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil
+		}
+		defer decoder.Close()
+		reader = decoder
+	default:
+		return data
+	}
+	// The error of a truncated stream comes with everything decoded before it
+	decoded, _ := io.ReadAll(reader)
+	return decoded
+}
+
+// flushWriter is a compressing writer that can emit everything written so far
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// EncodeSegments encodes the segments as one stream, flushing the encoder after each so every segment
+// can be decoded as soon as its bytes arrive. It returns the encoded data and where each segment ends in it.
+func EncodeSegments(segments [][]byte, encodingType types.ContentEncodingType, level int) ([]byte, []int, error) {
+	var buf bytes.Buffer
+	var writer flushWriter
+	var err error
+	switch encodingType {
+	case types.ContentEncodingGzip:
+		writer, err = gzip.NewWriterLevel(&buf, level)
+	case types.ContentEncodingDeflate:
+		writer, err = flate.NewWriter(&buf, level)
+	case types.ContentEncodingBr:
+		writer = brotli.NewWriterLevel(&buf, level)
+	case types.ContentEncodingZstd:
+		writer, err = zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	case types.ContentEncodingIdentity:
+		ends := make([]int, len(segments))
+		for i, segment := range segments {
+			buf.Write(segment)
+			ends[i] = buf.Len()
+		}
+		return buf.Bytes(), ends, nil
+	default:
+		return nil, nil, fmt.Errorf("segmented encoding not supported for %s", encodingType)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s encoder creation failed: %w", encodingType, err)
+	}
+
+	ends := make([]int, len(segments))
+	for i, segment := range segments {
+		if _, err := writer.Write(segment); err != nil {
+			return nil, nil, fmt.Errorf("%s encoding failed: %w", encodingType, err)
+		}
+		if i == len(segments)-1 {
+			err = writer.Close()
+		} else {
+			err = writer.Flush()
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s encoding failed: %w", encodingType, err)
+		}
+		ends[i] = buf.Len()
+	}
+	return buf.Bytes(), ends, nil
+}
@@ -259,6 +259,16 @@ func TestUnsupportedEncoding(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected error for unsupported decoder type")
 	}
+
+	// 対応状況の判定
+	if Supported(unsupportedType) || Supported("dcz") {
+		t.Errorf("Expected unsupported encodings to be reported")
+	}
+	for _, encodingType := range []types.ContentEncodingType{types.ContentEncodingGzip, types.ContentEncodingCompress, types.ContentEncodingZstd} {
+		if !Supported(encodingType) {
+			t.Errorf("Expected %s to be supported", encodingType)
+		}
+	}
 }
 
 func TestCompressionLevels(t *testing.T) {
@@ -289,4 +299,77 @@ func TestCompressionLevels(t *testing.T) {
 				level, len(largeData), len(compressed), float64(len(compressed))/float64(len(largeData))*100)
 		})
 	}
-}
\ No newline at end of file
+}
+func TestEncodeSegments(t *testing.T) {
+	head := []byte("<html><head><title>Flushed early</title></head>")
+	rest := []byte("<body>" + strings.Repeat("<p>Rendered later</p>", 50) + "</body></html>")
+
+	for _, encodingType := range []types.ContentEncodingType{
+		types.ContentEncodingGzip, types.ContentEncodingDeflate, types.ContentEncodingBr,
+		types.ContentEncodingZstd, types.ContentEncodingIdentity,
+	} {
+		t.Run(string(encodingType), func(t *testing.T) {
+			encoded, ends, err := EncodeSegments([][]byte{head, rest}, encodingType, 6)
+			if err != nil {
+				t.Fatalf("Segmented encoding failed: %v", err)
+			}
+			if len(ends) != 2 || ends[1] != len(encoded) {
+				t.Fatalf("Expected the last segment to end with the data, got %v of %d", ends, len(encoded))
+			}
+
+			// The first segment decodes on its own, the whole stream as usual
+			if prefix := DecodePrefix(encoded[:ends[0]], encodingType); !bytes.Equal(prefix, head) {
+				t.Errorf("Expected the first segment to decode to the head, got %q", prefix)
+			}
+			decoded, err := DecodeData(encoded, encodingType)
+			if err != nil {
+				t.Fatalf("Decoding failed: %v", err)
+			}
+			if !bytes.Equal(decoded, append(append([]byte{}, head...), rest...)) {
+				t.Error("Expected the segments to decode to the whole document")
+			}
+		})
+	}
+
+	if _, _, err := EncodeSegments([][]byte{head}, types.ContentEncodingCompress, 6); err == nil {
+		t.Error("Expected an error for compress, which cannot be flushed")
+	}
+}
+
+func TestParseCodec(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+		valid    bool
+	}{
+		{"gzip:9", "gzip:9", true},
+		{"br", "br:6", true},
+		{"ZSTD:19", "zstd:19", true},
+		{"br:12", "", false},
+		{"gzip:fast", "", false},
+		{"compress", "", false},
+	}
+	for _, tt := range tests {
+		codec, err := ParseCodec(tt.spec)
+		if (err == nil) != tt.valid {
+			t.Errorf("ParseCodec(%q) error = %v, want valid %v", tt.spec, err, tt.valid)
+			continue
+		}
+		if tt.valid && codec.String() != tt.expected {
+			t.Errorf("ParseCodec(%q) = %s, want %s", tt.spec, codec, tt.expected)
+		}
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	for _, spec := range []string{"gzip:1", "br:11", "zstd:3", "deflate:6"} {
+		codec, _ := ParseCodec(spec)
+		measurement, err := Measure(testData, codec)
+		if err != nil {
+			t.Fatalf("Measure(%s) failed: %v", spec, err)
+		}
+		if measurement.Size == 0 || measurement.Size >= len(testData) || measurement.Codec != codec {
+			t.Errorf("Unexpected measurement for %s: %+v", spec, measurement)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package encoding
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Codec is a content encoding at a compression level
+type Codec struct {
+	Encoding types.ContentEncodingType
+	Level    int
+}
+
+// codecLevels are the valid levels and the default level of the encodings that take one
+var codecLevels = map[types.ContentEncodingType]struct{ min, max, fallback int }{
+	types.ContentEncodingGzip:    {1, 9, 6},
+	types.ContentEncodingDeflate: {1, 9, 6},
+	types.ContentEncodingBr:      {0, 11, 6},
+	types.ContentEncodingZstd:    {1, 22, 3},
+}
+
+// ParseCodec parses "encoding" or "encoding:level", e.g. "gzip:9" or "br"
+func ParseCodec(spec string) (Codec, error) {
+	name, levelText, hasLevel := strings.Cut(strings.TrimSpace(spec), ":")
+	codec := Codec{Encoding: types.ContentEncodingType(strings.ToLower(name))}
+	levels, ok := codecLevels[codec.Encoding]
+	if !ok {
+		return Codec{}, fmt.Errorf("unsupported codec %q (gzip, deflate, br, zstd)", name)
+	}
+
+	codec.Level = levels.fallback
+	if hasLevel {
+		level, err := strconv.Atoi(levelText)
+		if err != nil || level < levels.min || level > levels.max {
+			return Codec{}, fmt.Errorf("invalid %s level %q, expected %d-%d", name, levelText, levels.min, levels.max)
+		}
+		codec.Level = level
+	}
+	return codec, nil
+}
+
+// String returns the codec as "encoding:level"
+func (c Codec) String() string {
+	return fmt.Sprintf("%s:%d", c.Encoding, c.Level)
+}
+
+// Measurement is the cost of encoding a body with a codec
+type Measurement struct {
+	Codec    Codec
+	Size     int
+	Duration time.Duration
+}
+
+// Measure encodes data with the codec and reports the encoded size and how long it took
+func Measure(data []byte, codec Codec) (Measurement, error) {
+	start := time.Now()
+	encoded, err := EncodeData(data, codec.Encoding, codec.Level)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("failed to encode with %s: %w", codec, err)
+	}
+	return Measurement{Codec: codec, Size: len(encoded), Duration: time.Since(start)}, nil
+}
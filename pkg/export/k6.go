@@ -0,0 +1,220 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// DefaultBatchWindow groups requests started this close to each other into one http.batch
+const DefaultBatchWindow = 50 * time.Millisecond
+
+// K6Options configures the generated k6 script
+type K6Options struct {
+	// BatchWindow groups requests started within this time of the first of a group into one
+	// http.batch, like a browser fetching subresources in parallel
+	BatchWindow time.Duration
+}
+
+// K6Result is a generated k6 script
+type K6Result struct {
+	Script   string
+	Requests int
+	Batches  int
+}
+
+// k6Request is one recorded request of the script
+type k6Request struct {
+	resource *types.Resource
+	origin   string
+	path     string
+	start    time.Time
+}
+
+// K6 turns the request sequence of an inventory into a k6 load test skeleton. Requests are
+// replayed in recorded order, grouped into http.batch calls, with the recorded think time
+// between groups, and with their recorded bodies. Every origin can be pointed at another
+// environment with its own BASE_URL_* variable.
+func K6(inventory *types.Inventory, opts K6Options) (*K6Result, error) {
+	window := opts.BatchWindow
+	if window <= 0 {
+		window = DefaultBatchWindow
+	}
+
+	// Each URL is requested once per body, at its first recorded start; prefetch and image variants
+	// are left out
+	var requests []k6Request
+	seen := make(map[string]bool)
+	resources := make([]*types.Resource, 0, len(inventory.Resources))
+	for i := range inventory.Resources {
+		resources = append(resources, &inventory.Resources[i])
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return resources[i].Timestamp.Before(resources[j].Timestamp)
+	})
+	for _, resource := range resources {
+		key := resource.Method + ":" + resource.URL
+		if resource.RequestBodySHA256 != nil {
+			key += ":" + *resource.RequestBodySHA256
+		}
+		if seen[key] || resource.StatusCode == nil {
+			continue
+		}
+		seen[key] = true
+		u, err := url.Parse(resource.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse URL %s: %w", resource.URL, err)
+		}
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		requests = append(requests, k6Request{resource: resource, origin: u.Scheme + "://" + u.Host, path: path, start: resource.Timestamp})
+	}
+
+	// Origins whose hosts map to the same variable name, like http:// and https:// of a host, are
+	// numbered in order of appearance
+	var origins []string
+	variables := make(map[string]string)
+	taken := make(map[string]bool)
+	binary := false
+	for _, request := range requests {
+		if request.resource.RequestBodyBase64 != nil {
+			binary = true
+		}
+		if _, exists := variables[request.origin]; exists {
+			continue
+		}
+		name := originVariable(request.origin)
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s_%d", originVariable(request.origin), n)
+		}
+		taken[name] = true
+		variables[request.origin] = name
+		origins = append(origins, request.origin)
+	}
+
+	var batches [][]k6Request
+	for _, request := range requests {
+		if n := len(batches); n > 0 && request.start.Sub(batches[n-1][0].start) < window {
+			batches[n-1] = append(batches[n-1], request)
+			continue
+		}
+		batches = append(batches, []k6Request{request})
+	}
+
+	var b strings.Builder
+	b.WriteString("// k6 load test generated by http-playback-proxy")
+	if inventory.EntryURL != nil {
+		b.WriteString(" from a recording of " + *inventory.EntryURL)
+	}
+	b.WriteString(".\n// Point each origin at another environment with its variable, e.g.\n")
+	if len(origins) > 0 {
+		fmt.Fprintf(&b, "//   k6 run -e %s=https://staging.example.com script.js\n", variables[origins[0]])
+	}
+	b.WriteString(`import http from 'k6/http';
+import { check, sleep } from 'k6';
+`)
+	if binary {
+		b.WriteString("import encoding from 'k6/encoding';\n")
+	}
+	b.WriteString(`
+export const options = {
+  vus: 1,
+  iterations: 1,
+  // Redirects were recorded hop by hop
+  maxRedirects: 0,
+};
+
+const origins = {
+`)
+	for _, origin := range origins {
+		fmt.Fprintf(&b, "  %s: __ENV.%s || %s,\n", jsString(origin), variables[origin], jsString(origin))
+	}
+	b.WriteString(`};
+
+function expectStatus(responses, statuses) {
+  responses.forEach((res, i) => {
+    check(res, { [` + "`${res.request.method} ${res.url} is ${statuses[i]}`" + `]: (r) => r.status === statuses[i] });
+  });
+}
+
+export default function () {
+`)
+	for i, batch := range batches {
+		statuses := make([]string, len(batch))
+		b.WriteString("  expectStatus(http.batch([\n")
+		for j, request := range batch {
+			resource := request.resource
+			statuses[j] = fmt.Sprint(*resource.StatusCode)
+			body := "null"
+			switch {
+			case resource.RequestBodyUTF8 != nil:
+				body = jsString(*resource.RequestBodyUTF8)
+			case resource.RequestBodyBase64 != nil:
+				body = fmt.Sprintf("encoding.b64decode(%s)", jsString(*resource.RequestBodyBase64))
+			case resource.RequestBodySHA256 != nil && *resource.RequestBodySHA256 != "":
+				b.WriteString("    // The request body was too large to record\n")
+			}
+			var headers []string
+			if resource.Accept != nil {
+				headers = append(headers, "Accept: "+jsString(*resource.Accept))
+			}
+			if contentType := resource.RequestHeaders["Content-Type"]; contentType != "" && body != "null" {
+				headers = append(headers, "'Content-Type': "+jsString(contentType))
+			}
+			fmt.Fprintf(&b, "    [%s, origins[%s] + %s", jsString(resource.Method), jsString(request.origin), jsString(request.path))
+			if body != "null" || len(headers) > 0 {
+				fmt.Fprintf(&b, ", %s", body)
+			}
+			if len(headers) > 0 {
+				fmt.Fprintf(&b, ", { headers: { %s } }", strings.Join(headers, ", "))
+			}
+			b.WriteString("],\n")
+		}
+		fmt.Fprintf(&b, "  ]), [%s]);\n", strings.Join(statuses, ", "))
+
+		// Think time is the gap to the next group less the time the server took to answer
+		if i+1 < len(batches) {
+			var ttfb time.Duration
+			for _, request := range batch {
+				if d := time.Duration(request.resource.TTFBMS) * time.Millisecond; d > ttfb {
+					ttfb = d
+				}
+			}
+			if think := batches[i+1][0].start.Sub(batch[0].start) - ttfb; think >= 10*time.Millisecond {
+				fmt.Fprintf(&b, "  sleep(%.3f);\n", think.Seconds())
+			}
+		}
+	}
+	b.WriteString("}\n")
+
+	return &K6Result{Script: b.String(), Requests: len(requests), Batches: len(batches)}, nil
+}
+
+// originVariable returns the environment variable overriding an origin, e.g. BASE_URL_CDN_EXAMPLE_COM
+func originVariable(origin string) string {
+	host := origin[strings.Index(origin, "://")+3:]
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, host)
+	return "BASE_URL_" + name
+}
+
+// jsString quotes a string as a JavaScript string literal
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-http-playback-proxy/pkg/testutil"
+	"go-http-playback-proxy/pkg/types"
+)
+
+func TestK6(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	resource := func(url string, offset time.Duration, status int, ttfbMS int64) types.Resource {
+		return types.Resource{Method: "GET", URL: url, StatusCode: testutil.IntPtr(status), TTFBMS: ttfbMS, Timestamp: start.Add(offset)}
+	}
+	inventory := &types.Inventory{
+		EntryURL: testutil.StringPtr("https://example.com/"),
+		Resources: []types.Resource{
+			// Stored out of order; the script follows the recorded start times
+			resource("https://cdn.example.com/app.js?v=2", 1010*time.Millisecond, 200, 30),
+			resource("https://example.com/", 0, 200, 200),
+			resource("https://example.com/style.css", 1000*time.Millisecond, 200, 20),
+			resource("https://example.com/api/next", 3000*time.Millisecond, 304, 10),
+			// Variants of a URL already requested and failed requests are left out
+			resource("https://example.com/style.css", 1200*time.Millisecond, 200, 20),
+			{Method: "GET", URL: "https://example.com/broken", ErrorMessage: testutil.StringPtr("connection reset"), Timestamp: start},
+		},
+	}
+
+	result, err := K6(inventory, K6Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate script: %v", err)
+	}
+	if result.Requests != 4 || result.Batches != 3 {
+		t.Errorf("Expected 4 requests in 3 batches, got %d in %d", result.Requests, result.Batches)
+	}
+
+	expected := []string{
+		`"https://cdn.example.com": __ENV.BASE_URL_CDN_EXAMPLE_COM || "https://cdn.example.com",`,
+		`  expectStatus(http.batch([
+    ["GET", origins["https://example.com"] + "/"],
+  ]), [200]);
+  sleep(0.800);
+  expectStatus(http.batch([
+    ["GET", origins["https://example.com"] + "/style.css"],
+    ["GET", origins["https://cdn.example.com"] + "/app.js?v=2"],
+  ]), [200, 200]);
+  sleep(1.970);
+  expectStatus(http.batch([
+    ["GET", origins["https://example.com"] + "/api/next"],
+  ]), [304]);
+}`,
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(result.Script, fragment) {
+			t.Errorf("Expected the script to contain:\n%s\ngot:\n%s", fragment, result.Script)
+		}
+	}
+	if strings.Contains(result.Script, "/broken") {
+		t.Error("Expected the failed request to be left out")
+	}
+}
+
+func TestK6_BodiesAndOrigins(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	inventory := &types.Inventory{
+		Resources: []types.Resource{
+			{Method: "GET", URL: "https://example.com/", StatusCode: testutil.IntPtr(200), Timestamp: start},
+			{Method: "GET", URL: "http://example.com/legacy", StatusCode: testutil.IntPtr(200), Timestamp: start.Add(time.Second)},
+			{
+				Method: "POST", URL: "https://example.com/api/search", StatusCode: testutil.IntPtr(200), Timestamp: start.Add(2 * time.Second),
+				RequestHeaders:    types.HttpHeaders{"Content-Type": "application/json"},
+				RequestBodyUTF8:   testutil.StringPtr(`{"q":"shoes"}`),
+				RequestBodySHA256: testutil.StringPtr("a"),
+			},
+			// Another body to the same URL is requested too
+			{
+				Method: "POST", URL: "https://example.com/api/search", StatusCode: testutil.IntPtr(200), Timestamp: start.Add(3 * time.Second),
+				RequestHeaders:    types.HttpHeaders{"Content-Type": "application/json"},
+				RequestBodyUTF8:   testutil.StringPtr(`{"q":"hats"}`),
+				RequestBodySHA256: testutil.StringPtr("b"),
+			},
+			{
+				Method: "PUT", URL: "https://example.com/upload", StatusCode: testutil.IntPtr(201), Timestamp: start.Add(4 * time.Second),
+				RequestBodyBase64: testutil.StringPtr("AAEC"),
+				RequestBodySHA256: testutil.StringPtr("c"),
+			},
+		},
+	}
+
+	result, err := K6(inventory, K6Options{})
+	if err != nil {
+		t.Fatalf("Failed to generate script: %v", err)
+	}
+	if result.Requests != 5 {
+		t.Errorf("Expected 5 requests, got %d", result.Requests)
+	}
+	expected := []string{
+		"import encoding from 'k6/encoding';",
+		`"https://example.com": __ENV.BASE_URL_EXAMPLE_COM || "https://example.com",`,
+		`"http://example.com": __ENV.BASE_URL_EXAMPLE_COM_2 || "http://example.com",`,
+		`["POST", origins["https://example.com"] + "/api/search", "{\"q\":\"shoes\"}", { headers: { 'Content-Type': "application/json" } }],`,
+		`["POST", origins["https://example.com"] + "/api/search", "{\"q\":\"hats\"}", { headers: { 'Content-Type': "application/json" } }],`,
+		`["PUT", origins["https://example.com"] + "/upload", encoding.b64decode("AAEC")],`,
+	}
+	for _, fragment := range expected {
+		if !strings.Contains(result.Script, fragment) {
+			t.Errorf("Expected the script to contain:\n%s\ngot:\n%s", fragment, result.Script)
+		}
+	}
+}
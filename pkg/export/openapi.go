@@ -0,0 +1,320 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// ContentReader returns the stored body of a resource
+type ContentReader func(resource *types.Resource) ([]byte, error)
+
+// OpenAPIDocument is the subset of an OpenAPI 3.0 document generated from recordings
+type OpenAPIDocument struct {
+	OpenAPI string                           `json:"openapi"`
+	Info    OpenAPIInfo                      `json:"info"`
+	Servers []OpenAPIServer                  `json:"servers,omitempty"`
+	Paths   map[string]map[string]*Operation `json:"paths"`
+}
+
+// OpenAPIInfo is the document info object
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// OpenAPIServer is a server object
+type OpenAPIServer struct {
+	URL string `json:"url"`
+}
+
+// Operation is a path operation inferred from one or more recorded requests
+type Operation struct {
+	Summary    string               `json:"summary,omitempty"`
+	Parameters []Parameter          `json:"parameters,omitempty"`
+	Responses  map[string]*Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter
+type Parameter struct {
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *Schema     `json:"schema"`
+	Example  interface{} `json:"example,omitempty"`
+}
+
+// Response is a response object for one status code
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a response body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is an inferred JSON schema
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Nullable   bool               `json:"nullable,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+}
+
+// idSegment matches path segments that look like identifiers (numbers, UUIDs, long hex strings)
+var idSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,})$`)
+
+// OpenAPI builds a draft OpenAPI document from the JSON responses in an inventory
+func OpenAPI(inventory *types.Inventory, readContent ContentReader, title string) (*OpenAPIDocument, error) {
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    OpenAPIInfo{Title: title, Version: "0.0.0"},
+		Paths:   make(map[string]map[string]*Operation),
+	}
+	servers := make(map[string]bool)
+
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		if !isJSONResource(resource) {
+			continue
+		}
+
+		u, err := url.Parse(resource.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse URL %s: %w", resource.URL, err)
+		}
+		servers[u.Scheme+"://"+u.Host] = true
+
+		path, pathParams := templatePath(u.Path)
+		method := strings.ToLower(resource.Method)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		operation := doc.Paths[path][method]
+		if operation == nil {
+			operation = &Operation{
+				Summary:   fmt.Sprintf("%s %s", resource.Method, path),
+				Responses: make(map[string]*Response),
+			}
+			doc.Paths[path][method] = operation
+		}
+		addParameters(operation, pathParams, u.Query())
+
+		status := 200
+		if resource.StatusCode != nil {
+			status = *resource.StatusCode
+		}
+		statusKey := strconv.Itoa(status)
+		response := operation.Responses[statusKey]
+		if response == nil {
+			response = &Response{Description: statusDescription(status)}
+			operation.Responses[statusKey] = response
+		}
+
+		content, err := readContent(resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content of %s: %w", resource.URL, err)
+		}
+		var body interface{}
+		if len(content) == 0 || json.Unmarshal(content, &body) != nil {
+			continue
+		}
+		schema := inferSchema(body)
+		if existing, ok := response.Content["application/json"]; ok {
+			schema = mergeSchemas(existing.Schema, schema)
+		}
+		response.Content = map[string]MediaType{"application/json": {Schema: schema}}
+	}
+
+	for server := range servers {
+		doc.Servers = append(doc.Servers, OpenAPIServer{URL: server})
+	}
+	sort.Slice(doc.Servers, func(i, j int) bool { return doc.Servers[i].URL < doc.Servers[j].URL })
+
+	return doc, nil
+}
+
+// isJSONResource reports whether the recorded response is JSON
+func isJSONResource(resource *types.Resource) bool {
+	contentType := ""
+	if resource.ContentTypeMime != nil {
+		contentType = *resource.ContentTypeMime
+	} else {
+		contentType = resource.RawHeaders["Content-Type"]
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// templatePath replaces identifier-like segments with path parameters
+func templatePath(path string) (string, []string) {
+	segments := strings.Split(path, "/")
+	var params []string
+	for i, segment := range segments {
+		if !idSegment.MatchString(segment) {
+			continue
+		}
+		name := "id"
+		if len(params) > 0 {
+			name = fmt.Sprintf("id%d", len(params)+1)
+		}
+		params = append(params, name)
+		segments[i] = "{" + name + "}"
+	}
+	if path == "" {
+		return "/", nil
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// addParameters adds path and query parameters not yet present on the operation
+func addParameters(operation *Operation, pathParams []string, query url.Values) {
+	has := make(map[string]bool)
+	for _, param := range operation.Parameters {
+		has[param.In+":"+param.Name] = true
+	}
+
+	for _, name := range pathParams {
+		if !has["path:"+name] {
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"},
+			})
+		}
+	}
+
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !has["query:"+name] {
+			operation.Parameters = append(operation.Parameters, Parameter{
+				Name: name, In: "query", Schema: &Schema{Type: "string"}, Example: query.Get(name),
+			})
+		}
+	}
+}
+
+// inferSchema infers a schema from a decoded JSON value
+func inferSchema(value interface{}) *Schema {
+	switch v := value.(type) {
+	case nil:
+		return &Schema{Nullable: true}
+	case bool:
+		return &Schema{Type: "boolean"}
+	case float64:
+		if v == float64(int64(v)) {
+			return &Schema{Type: "integer"}
+		}
+		return &Schema{Type: "number"}
+	case string:
+		schema := &Schema{Type: "string"}
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			schema.Format = "date-time"
+		}
+		return schema
+	case []interface{}:
+		schema := &Schema{Type: "array"}
+		for _, item := range v {
+			schema.Items = mergeSchemas(schema.Items, inferSchema(item))
+		}
+		if schema.Items == nil {
+			schema.Items = &Schema{}
+		}
+		return schema
+	case map[string]interface{}:
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		for key, item := range v {
+			schema.Properties[key] = inferSchema(item)
+			schema.Required = append(schema.Required, key)
+		}
+		sort.Strings(schema.Required)
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+// mergeSchemas combines two samples of the same value; properties missing in either become optional
+func mergeSchemas(a, b *Schema) *Schema {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	// null merged with a typed value makes it nullable
+	if a.Type == "" && a.Nullable {
+		merged := *b
+		merged.Nullable = true
+		return &merged
+	}
+	if b.Type == "" && b.Nullable {
+		merged := *a
+		merged.Nullable = true
+		return &merged
+	}
+
+	if a.Type != b.Type {
+		// integer and number samples are numbers
+		if (a.Type == "integer" && b.Type == "number") || (a.Type == "number" && b.Type == "integer") {
+			return &Schema{Type: "number", Nullable: a.Nullable || b.Nullable}
+		}
+		return &Schema{Nullable: a.Nullable || b.Nullable}
+	}
+
+	merged := &Schema{Type: a.Type, Nullable: a.Nullable || b.Nullable}
+	if a.Format == b.Format {
+		merged.Format = a.Format
+	}
+
+	switch a.Type {
+	case "array":
+		merged.Items = mergeSchemas(a.Items, b.Items)
+	case "object":
+		merged.Properties = make(map[string]*Schema)
+		for key, schema := range a.Properties {
+			merged.Properties[key] = schema
+		}
+		for key, schema := range b.Properties {
+			merged.Properties[key] = mergeSchemas(merged.Properties[key], schema)
+		}
+		inB := make(map[string]bool)
+		for _, key := range b.Required {
+			inB[key] = true
+		}
+		for _, key := range a.Required {
+			if inB[key] {
+				merged.Required = append(merged.Required, key)
+			}
+		}
+	}
+
+	return merged
+}
+
+// statusDescription returns a description for a status code
+func statusDescription(status int) string {
+	if text := http.StatusText(status); text != "" {
+		return text
+	}
+	return fmt.Sprintf("Status %d", status)
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"testing"
+
+	"go-http-playback-proxy/pkg/testutil"
+	"go-http-playback-proxy/pkg/types"
+)
+
+func TestOpenAPI(t *testing.T) {
+	inventory := &types.Inventory{
+		Resources: []types.Resource{
+			{
+				Method:          "GET",
+				URL:             "https://api.example.com/users/42?fields=name",
+				StatusCode:      testutil.IntPtr(200),
+				ContentTypeMime: testutil.StringPtr("application/json"),
+				ContentUTF8:     testutil.StringPtr(`{"id": 42, "name": "Alice", "email": null, "createdAt": "2024-01-02T03:04:05Z"}`),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://api.example.com/users/43",
+				StatusCode:      testutil.IntPtr(200),
+				ContentTypeMime: testutil.StringPtr("application/json"),
+				ContentUTF8:     testutil.StringPtr(`{"id": 43, "name": "Bob", "email": "bob@example.com"}`),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://api.example.com/users/0",
+				StatusCode:      testutil.IntPtr(404),
+				ContentTypeMime: testutil.StringPtr("application/problem+json"),
+				ContentUTF8:     testutil.StringPtr(`{"title": "Not Found"}`),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://www.example.com/logo.png",
+				ContentTypeMime: testutil.StringPtr("image/png"),
+			},
+		},
+	}
+
+	readContent := func(resource *types.Resource) ([]byte, error) {
+		if resource.ContentUTF8 == nil {
+			return nil, nil
+		}
+		return []byte(*resource.ContentUTF8), nil
+	}
+
+	doc, err := OpenAPI(inventory, readContent, "Example API")
+	if err != nil {
+		t.Fatalf("Failed to build OpenAPI document: %v", err)
+	}
+
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "https://api.example.com" {
+		t.Errorf("Expected only the API server, got %+v", doc.Servers)
+	}
+
+	operation := doc.Paths["/users/{id}"]["get"]
+	if operation == nil {
+		t.Fatalf("Expected GET /users/{id}, got paths %v", doc.Paths)
+	}
+	if len(operation.Parameters) != 2 || operation.Parameters[0].In != "path" || operation.Parameters[1].Name != "fields" {
+		t.Errorf("Unexpected parameters: %+v", operation.Parameters)
+	}
+	if operation.Responses["404"] == nil {
+		t.Error("Expected 404 response")
+	}
+
+	schema := operation.Responses["200"].Content["application/json"].Schema
+	if schema.Properties["id"].Type != "integer" {
+		t.Errorf("Expected integer id, got %+v", schema.Properties["id"])
+	}
+	if email := schema.Properties["email"]; email.Type != "string" || !email.Nullable {
+		t.Errorf("Expected nullable string email, got %+v", email)
+	}
+	if schema.Properties["createdAt"].Format != "date-time" {
+		t.Errorf("Expected date-time createdAt, got %+v", schema.Properties["createdAt"])
+	}
+	// createdAt is only present in one sample and must not be required
+	for _, name := range schema.Required {
+		if name == "createdAt" {
+			t.Error("Expected createdAt to be optional")
+		}
+	}
+}
+
+func TestTemplatePath(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"/users/42/posts/7", "/users/{id}/posts/{id2}"},
+		{"/items/550e8400-e29b-41d4-a716-446655440000", "/items/{id}"},
+		{"/v1/search", "/v1/search"},
+		{"", "/"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			if result, _ := templatePath(tc.path); result != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package export
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go-http-playback-proxy/pkg/charset"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// ExternalDir is the directory of a static bundle holding resources of hosts other than the entry host
+const ExternalDir = "_ext"
+
+// StaticResult summarizes a static export
+type StaticResult struct {
+	Files   []string
+	Skipped int
+}
+
+// staticFile is a resource selected for the static bundle
+type staticFile struct {
+	resource *types.Resource
+	urlPath  string // bundle path before directory conflicts are resolved
+}
+
+// Static writes the replayable resources of an inventory as plain static files under outputDir.
+// Resources of the entry host are placed at the root and other hosts under _ext/<host>;
+// absolute URLs in HTML, CSS, JavaScript and JSON are rewritten to root-relative bundle paths.
+func Static(inventory *types.Inventory, readContent ContentReader, outputDir string) (*StaticResult, error) {
+	entryHost := ""
+	if inventory.EntryURL != nil {
+		if u, err := url.Parse(*inventory.EntryURL); err == nil {
+			entryHost = u.Host
+		}
+	}
+
+	result := &StaticResult{}
+	files := make(map[string]*staticFile)
+	origins := make(map[string]string) // scheme://host -> bundle prefix
+
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		if !isStaticResource(resource) {
+			result.Skipped++
+			continue
+		}
+		u, err := url.Parse(resource.URL)
+		if err != nil {
+			result.Skipped++
+			continue
+		}
+
+		prefix := "/"
+		if u.Host != entryHost {
+			prefix = "/" + ExternalDir + "/" + strings.ReplaceAll(u.Host, ":", "_") + "/"
+		}
+		origins[u.Scheme+"://"+u.Host] = prefix
+
+		urlPath := path.Join(prefix, u.Path)
+		if strings.HasSuffix(u.Path, "/") || u.Path == "" {
+			urlPath = path.Join(urlPath, "index.html")
+		}
+
+		// Query strings cannot be represented in a static layout; prefer the resource without one
+		if existing, ok := files[urlPath]; ok {
+			result.Skipped++
+			existingURL, _ := url.Parse(existing.resource.URL)
+			if u.RawQuery != "" || existingURL == nil || existingURL.RawQuery == "" {
+				continue
+			}
+		}
+		files[urlPath] = &staticFile{resource: resource, urlPath: urlPath}
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	// A path that is also a parent directory of another path is stored as <path>/index.html
+	isDir := make(map[string]bool)
+	for _, p := range paths {
+		for dir := path.Dir(p); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			isDir[dir] = true
+		}
+	}
+
+	rewriter := newURLRewriter(origins)
+	for _, p := range paths {
+		file := files[p]
+		bundlePath := p
+		if isDir[p] {
+			bundlePath = path.Join(p, "index.html")
+		}
+
+		content, err := readContent(file.resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content of %s: %w", file.resource.URL, err)
+		}
+		content, err = prepareStaticContent(file.resource, content, rewriter)
+		if err != nil {
+			return nil, err
+		}
+
+		filePath := filepath.Join(outputDir, filepath.FromSlash(strings.TrimPrefix(bundlePath, "/")))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", filePath, err)
+		}
+		result.Files = append(result.Files, bundlePath)
+	}
+
+	return result, nil
+}
+
+// isStaticResource reports whether a resource can be served as a static file
+func isStaticResource(resource *types.Resource) bool {
+	if resource.Method != "GET" {
+		return false
+	}
+	if resource.StatusCode != nil && (*resource.StatusCode < 200 || *resource.StatusCode >= 300) {
+		return false
+	}
+	return resource.ContentFilePath != nil || resource.ContentUTF8 != nil || resource.ContentBase64 != nil
+}
+
+// prepareStaticContent rewrites URLs in text content and restores its original charset
+func prepareStaticContent(resource *types.Resource, content []byte, rewriter *strings.Replacer) ([]byte, error) {
+	contentType := resource.RawHeaders["Content-Type"]
+	if resource.ContentTypeMime != nil {
+		contentType = *resource.ContentTypeMime
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !isRewritableType(mediaType) {
+		return content, nil
+	}
+
+	content = []byte(rewriter.Replace(string(content)))
+
+	if resource.ContentCharset != nil {
+		contentCharset := *resource.ContentCharset
+		if contentCharset != "" && !strings.EqualFold(contentCharset, "utf-8") && !strings.HasSuffix(contentCharset, "-failed") {
+			restored, err := charset.ConvertFromUTF8(content, contentCharset)
+			if err != nil {
+				return nil, fmt.Errorf("failed to restore charset of %s: %w", resource.URL, err)
+			}
+			content = restored
+		}
+	}
+	return content, nil
+}
+
+// isRewritableType reports whether URLs in content of the media type should be rewritten
+func isRewritableType(mediaType string) bool {
+	switch {
+	case strings.Contains(mediaType, "html"), strings.Contains(mediaType, "css"),
+		strings.Contains(mediaType, "javascript"), strings.Contains(mediaType, "ecmascript"),
+		strings.Contains(mediaType, "json"), strings.HasPrefix(mediaType, "image/svg"):
+		return true
+	default:
+		return false
+	}
+}
+
+// newURLRewriter replaces absolute and protocol-relative origin URLs with bundle prefixes
+func newURLRewriter(origins map[string]string) *strings.Replacer {
+	keys := make([]string, 0, len(origins))
+	for origin := range origins {
+		keys = append(keys, origin)
+	}
+	// Longer origins first so hosts with ports are not cut short by the same host without one
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+
+	var pairs []string
+	for _, origin := range keys {
+		prefix := origins[origin]
+		hostPart := strings.SplitN(origin, "://", 2)[1]
+		pairs = append(pairs,
+			origin+"/", prefix,
+			"//"+hostPart+"/", prefix,
+			// JSON-escaped URLs
+			strings.ReplaceAll(origin+"/", "/", `\/`), strings.ReplaceAll(prefix, "/", `\/`),
+		)
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,99 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-http-playback-proxy/pkg/testutil"
+	"go-http-playback-proxy/pkg/types"
+)
+
+func TestStatic(t *testing.T) {
+	outputDir := t.TempDir()
+
+	inventory := &types.Inventory{
+		EntryURL: testutil.StringPtr("https://www.example.com/"),
+		Resources: []types.Resource{
+			{
+				Method:          "GET",
+				URL:             "https://www.example.com/",
+				ContentTypeMime: testutil.StringPtr("text/html"),
+				ContentUTF8:     testutil.StringPtr(`<link href="https://cdn.example.net/css/site.css"><a href="https://www.example.com/docs">docs</a><img src="//cdn.example.net/logo.png">`),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://www.example.com/docs",
+				ContentTypeMime: testutil.StringPtr("text/html"),
+				ContentUTF8:     testutil.StringPtr("docs"),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://www.example.com/docs/intro",
+				ContentTypeMime: testutil.StringPtr("text/html"),
+				ContentUTF8:     testutil.StringPtr("intro"),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://cdn.example.net/css/site.css?v=2",
+				ContentTypeMime: testutil.StringPtr("text/css"),
+				ContentUTF8:     testutil.StringPtr("versioned"),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://cdn.example.net/css/site.css",
+				ContentTypeMime: testutil.StringPtr("text/css"),
+				ContentUTF8:     testutil.StringPtr(`body{background:url(https://cdn.example.net/bg.png)}`),
+			},
+			{
+				Method:      "GET",
+				URL:         "https://www.example.com/moved",
+				StatusCode:  testutil.IntPtr(301),
+				ContentUTF8: testutil.StringPtr(""),
+			},
+			{
+				Method:      "POST",
+				URL:         "https://www.example.com/api",
+				ContentUTF8: testutil.StringPtr("{}"),
+			},
+		},
+	}
+
+	readContent := func(resource *types.Resource) ([]byte, error) {
+		return []byte(*resource.ContentUTF8), nil
+	}
+
+	result, err := Static(inventory, readContent, outputDir)
+	if err != nil {
+		t.Fatalf("Failed to export static bundle: %v", err)
+	}
+	if len(result.Files) != 4 || result.Skipped != 3 {
+		t.Errorf("Expected 4 files and 3 skipped, got %v and %d", result.Files, result.Skipped)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(data)
+	}
+
+	index := read("index.html")
+	for _, expected := range []string{`href="/_ext/cdn.example.net/css/site.css"`, `href="/docs"`, `src="/_ext/cdn.example.net/logo.png"`} {
+		if !strings.Contains(index, expected) {
+			t.Errorf("Expected index.html to contain %s, got %s", expected, index)
+		}
+	}
+
+	// /docs is also a directory, so it is stored as docs/index.html
+	if read("docs/index.html") != "docs" || read("docs/intro") != "intro" {
+		t.Error("Expected directory conflict to be resolved with index.html")
+	}
+
+	// The resource without a query string wins
+	if css := read("_ext/cdn.example.net/css/site.css"); css != "body{background:url(/_ext/cdn.example.net/bg.png)}" {
+		t.Errorf("Unexpected CSS: %s", css)
+	}
+}
@@ -0,0 +1,145 @@
+// Package har defines the HTTP Archive 1.2 format (http://www.softwareishard.com/blog/har-12-spec/)
+package har
+
+// Version is the HAR format version written by this package
+const Version = "1.2"
+
+// HAR is the root object of a HAR file
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+// Log holds the recorded pages and requests
+type Log struct {
+	Version string  `json:"version"`
+	Creator Creator `json:"creator"`
+	Pages   []Page  `json:"pages,omitempty"`
+	Entries []Entry `json:"entries"`
+}
+
+// Creator names the application that wrote the file
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Page is a page load the entries belong to
+type Page struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	ID              string      `json:"id"`
+	Title           string      `json:"title"`
+	PageTimings     PageTimings `json:"pageTimings"`
+}
+
+// PageTimings are the load events of a page in milliseconds from its start; -1 if unknown
+type PageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+// Entry is one request and its response
+type Entry struct {
+	Pageref         string `json:"pageref,omitempty"`
+	StartedDateTime string `json:"startedDateTime"`
+	// Time is the total time of the request in milliseconds, the sum of the non-negative Timings
+	Time     float64  `json:"time"`
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+	Cache    Cache    `json:"cache"`
+	Timings  Timings  `json:"timings"`
+	// WasPushed is Chrome's mark (1) of responses the server pushed with HTTP/2 server push
+	WasPushed int `json:"_was_pushed,omitempty"`
+	// Initiator is what Chrome recorded as starting the request
+	Initiator *Initiator `json:"_initiator,omitempty"`
+}
+
+// Initiator is Chrome's record of what started a request, e.g. the parser of a document
+type Initiator struct {
+	Type string `json:"type"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Request is the request of an entry
+type Request struct {
+	Method      string          `json:"method"`
+	URL         string          `json:"url"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []Cookie        `json:"cookies"`
+	Headers     []NameValuePair `json:"headers"`
+	QueryString []NameValuePair `json:"queryString"`
+	PostData    *PostData       `json:"postData,omitempty"`
+	HeadersSize int64           `json:"headersSize"`
+	BodySize    int64           `json:"bodySize"`
+}
+
+// Response is the response of an entry
+type Response struct {
+	Status      int             `json:"status"`
+	StatusText  string          `json:"statusText"`
+	HTTPVersion string          `json:"httpVersion"`
+	Cookies     []Cookie        `json:"cookies"`
+	Headers     []NameValuePair `json:"headers"`
+	Content     Content         `json:"content"`
+	RedirectURL string          `json:"redirectURL"`
+	HeadersSize int64           `json:"headersSize"`
+	// BodySize is the size of the body as transferred, before decoding; -1 if unknown
+	BodySize int64 `json:"bodySize"`
+	// Error is the reason a request got no response, as written by Chrome
+	Error string `json:"_error,omitempty"`
+}
+
+// Cookie is a cookie sent or set
+type Cookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NameValuePair is a header or query parameter
+type NameValuePair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// PostData is the body of a request
+type PostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	// Encoding is "base64" for binary bodies
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Content is the decoded body of a response
+type Content struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	// Encoding is "base64" for binary bodies
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Cache describes the browser cache state; the proxy does not know it
+type Cache struct{}
+
+// Timings are the phases of an entry in milliseconds; -1 for phases that do not apply
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// Total returns the entry time for the timings: the sum of the phases that apply, with ssl being
+// part of connect
+func (t Timings) Total() float64 {
+	total := 0.0
+	for _, phase := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if phase > 0 {
+			total += phase
+		}
+	}
+	return total
+}
@@ -0,0 +1,121 @@
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Response is a response read to the end, with its body decoded
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	// Body is the body after removing the Content-Encoding
+	Body []byte
+	// WireSize is the number of body bytes received
+	WireSize int
+}
+
+// Get requests url with client and reads the response
+func Get(client *http.Client, url string) (*Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	return Do(client, req)
+}
+
+// Do sends req with client and reads the response, decoding its body
+func Do(client *http.Client, req *http.Request) (*Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	response := &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body, WireSize: len(body)}
+	if contentEncoding := resp.Header.Get("Content-Encoding"); contentEncoding != "" && len(body) > 0 {
+		decoded, err := encoding.DecodeData(body, types.ContentEncodingType(strings.ToLower(contentEncoding)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s body: %w", contentEncoding, err)
+		}
+		response.Body = decoded
+	}
+	return response, nil
+}
+
+// CompareOptions selects what Compare checks besides the status code
+type CompareOptions struct {
+	// Headers are compared by value, Content-Type by media type and parameters; DefaultCompareHeaders
+	// when nil
+	Headers []string
+	// IgnoreBody skips comparing the decoded bodies, e.g. for pages embedding a timestamp
+	IgnoreBody bool
+	// NormalizeBody is applied to both bodies before they are compared, e.g. to drop whitespace
+	// changed by beautification
+	NormalizeBody func(body []byte) []byte
+}
+
+// DefaultCompareHeaders are the headers a played back response is expected to reproduce
+var DefaultCompareHeaders = []string{"Content-Type", "Content-Encoding", "Location"}
+
+// Compare returns the differences between an expected response (usually fetched directly) and
+// an actual one (usually played back), or nil when they match
+func Compare(expected, actual *Response, opts CompareOptions) []string {
+	var diffs []string
+	if expected.StatusCode != actual.StatusCode {
+		diffs = append(diffs, fmt.Sprintf("status: expected %d, got %d", expected.StatusCode, actual.StatusCode))
+	}
+
+	headers := opts.Headers
+	if headers == nil {
+		headers = DefaultCompareHeaders
+	}
+	for _, name := range headers {
+		if want, got := expected.Header.Get(name), actual.Header.Get(name); normalizeHeader(name, want) != normalizeHeader(name, got) {
+			diffs = append(diffs, fmt.Sprintf("header %s: expected %q, got %q", name, want, got))
+		}
+	}
+
+	if !opts.IgnoreBody {
+		want, got := expected.Body, actual.Body
+		if opts.NormalizeBody != nil {
+			want, got = opts.NormalizeBody(want), opts.NormalizeBody(got)
+		}
+		if !bytes.Equal(want, got) {
+			diffs = append(diffs, fmt.Sprintf("body: expected %d bytes, got %d bytes%s", len(want), len(got), firstDifference(want, got)))
+		}
+	}
+	return diffs
+}
+
+// normalizeHeader formats a Content-Type canonically, since playback may re-format its parameters
+func normalizeHeader(name, value string) string {
+	if !strings.EqualFold(name, "Content-Type") {
+		return value
+	}
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err != nil {
+		return value
+	}
+	return mime.FormatMediaType(mediaType, params)
+}
+
+// firstDifference describes where two bodies start to differ
+func firstDifference(a, b []byte) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return fmt.Sprintf(", first difference at byte %d", i)
+}
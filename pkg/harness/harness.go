@@ -0,0 +1,78 @@
+// Package harness runs http-playback-proxy in tests: record a site through the proxy, play the
+// inventory back and compare the responses with the direct ones. Proxies run either in-process
+// (StartRecording, StartPlayback) or as a separate binary (StartRecordingProcess,
+// StartPlaybackProcess), and share the helpers for ports, inventory directories and clients.
+package harness
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// DefaultStartTimeout is how long a proxy may take to accept connections
+const DefaultStartTimeout = 15 * time.Second
+
+// DefaultStopTimeout is how long a proxy may take to save its inventory and exit after an interrupt
+const DefaultStopTimeout = 10 * time.Second
+
+// FreePort returns a TCP port on the loopback interface that is free at the time of the call
+func FreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// InventoryDir returns a new inventory directory removed when the test ends
+func InventoryDir(tb testing.TB) string {
+	tb.Helper()
+	return filepath.Join(tb.TempDir(), "inventory")
+}
+
+// NewClient returns an HTTP client sending every request through the proxy listening on port. The
+// proxy re-signs HTTPS responses with its own CA, so certificates are not verified, and
+// redirects are returned as recorded instead of being followed.
+func NewClient(port int) *http.Client {
+	proxyURL := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", port)}
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			Proxy:              http.ProxyURL(proxyURL),
+			TLSClientConfig:    &tls.Config{InsecureSkipVerify: true},
+			DisableCompression: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// waitForPort waits until port accepts connections, or fails once exited reports an error or the
+// timeout elapses
+func waitForPort(port int, timeout time.Duration, exited <-chan error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 500*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("proxy exited before listening on port %d: %v", port, err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("proxy did not listen on port %d within %v", port, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,149 @@
+package harness
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"go-http-playback-proxy/pkg/plugins"
+)
+
+func TestThreePhases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("hello"))
+		case "/old":
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	urls := []string{server.URL + "/", server.URL + "/old", server.URL + "/missing"}
+
+	// Redirects are compared as responses, as the proxy clients return them
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	direct := make(map[string]*Response)
+	for _, u := range urls {
+		response, err := Get(client, u)
+		if err != nil {
+			t.Fatalf("Failed to fetch %s directly: %v", u, err)
+		}
+		direct[u] = response
+	}
+
+	inventoryDir := InventoryDir(t)
+	caDir := t.TempDir()
+	recording, err := StartRecording(server.URL+"/", inventoryDir, Options{CaRootPath: caDir}, plugins.RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to start recording: %v", err)
+	}
+	for _, u := range urls {
+		response, err := Get(recording.Client(), u)
+		if err != nil {
+			t.Fatalf("Failed to record %s: %v", u, err)
+		}
+		if diffs := Compare(direct[u], response, CompareOptions{}); diffs != nil {
+			t.Errorf("Recorded %s differs: %s", u, strings.Join(diffs, "; "))
+		}
+	}
+	if err := recording.Stop(); err != nil {
+		t.Fatalf("Failed to stop recording: %v", err)
+	}
+
+	// The origin is gone, so every response comes from the inventory
+	server.Close()
+	playback, err := StartPlayback(inventoryDir, Options{CaRootPath: caDir}, plugins.PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to start playback: %v", err)
+	}
+	defer playback.Stop()
+	for _, u := range urls {
+		response, err := Get(playback.Client(), u)
+		if err != nil {
+			t.Fatalf("Failed to play back %s: %v", u, err)
+		}
+		if diffs := Compare(direct[u], response, CompareOptions{}); diffs != nil {
+			t.Errorf("Played back %s differs: %s", u, strings.Join(diffs, "; "))
+		}
+	}
+}
+
+func TestInformational(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	// get returns the interim responses received before the final response
+	get := func(client *http.Client) []textproto.MIMEHeader {
+		var interim []textproto.MIMEHeader
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				if code == http.StatusEarlyHints {
+					interim = append(interim, header)
+				}
+				return nil
+			},
+		}
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL+"/", nil)
+		if err != nil {
+			t.Fatalf("Failed to create request: %v", err)
+		}
+		if _, err := Do(client, req); err != nil {
+			t.Fatalf("Failed to fetch: %v", err)
+		}
+		return interim
+	}
+
+	inventoryDir := InventoryDir(t)
+	caDir := t.TempDir()
+	recording, err := StartRecording(server.URL+"/", inventoryDir, Options{CaRootPath: caDir}, plugins.RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to start recording: %v", err)
+	}
+	get(recording.Client())
+	if err := recording.Stop(); err != nil {
+		t.Fatalf("Failed to stop recording: %v", err)
+	}
+
+	server.Close()
+	playback, err := StartPlayback(inventoryDir, Options{CaRootPath: caDir}, plugins.PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to start playback: %v", err)
+	}
+	defer playback.Stop()
+	interim := get(playback.Client())
+	if len(interim) != 1 || interim[0].Get("Link") != "</style.css>; rel=preload; as=style" {
+		t.Errorf("Expected the recorded 103 Early Hints, got %v", interim)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	expected := &Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/html"}}, Body: []byte("<p>hello</p>")}
+	actual := &Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/html"}}, Body: []byte("<p>\n  hello\n</p>")}
+
+	if diffs := Compare(expected, actual, CompareOptions{}); len(diffs) != 1 || !strings.Contains(diffs[0], "first difference at byte 3") {
+		t.Errorf("Expected a body difference, got %v", diffs)
+	}
+	collapse := func(body []byte) []byte { return []byte(strings.Join(strings.Fields(string(body)), "")) }
+	if diffs := Compare(expected, actual, CompareOptions{NormalizeBody: collapse}); diffs != nil {
+		t.Errorf("Expected normalized bodies to match, got %v", diffs)
+	}
+
+	actual.StatusCode = 404
+	actual.Header.Set("Content-Type", "text/plain")
+	if diffs := Compare(expected, actual, CompareOptions{IgnoreBody: true}); len(diffs) != 2 {
+		t.Errorf("Expected status and header differences, got %v", diffs)
+	}
+}
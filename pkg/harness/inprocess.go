@@ -0,0 +1,129 @@
+package harness
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/httputil"
+	"go-http-playback-proxy/pkg/plugins"
+)
+
+// Options configures an in-process proxy
+type Options struct {
+	// Port is where the proxy listens on the loopback interface; 0 picks a free port
+	Port int
+	// CaRootPath is the directory of the CA certificate the proxy signs HTTPS responses with;
+	// empty uses the default of go-mitmproxy (~/.mitmproxy)
+	CaRootPath string
+}
+
+// Proxy is a recording or playback proxy running in the test process
+type Proxy struct {
+	// Port is where the proxy listens on the loopback interface
+	Port int
+	// InventoryDir is the inventory the proxy records to or plays back from
+	InventoryDir string
+
+	proxy     *proxy.Proxy
+	recording *plugins.RecordingPlugin
+	playback  *plugins.PlaybackPlugin
+	exited    chan error
+}
+
+// StartRecording starts a recording proxy for targetURL that saves to inventoryDir when stopped
+func StartRecording(targetURL, inventoryDir string, opts Options, recordingOpts plugins.RecordingOptions) (*Proxy, error) {
+	plugin, err := plugins.NewRecordingPluginWithOptions(targetURL, inventoryDir, recordingOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording plugin: %w", err)
+	}
+	p := &Proxy{InventoryDir: inventoryDir, recording: plugin}
+	if err := p.start(opts, plugin, plugin); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// StartPlayback starts a proxy playing back the inventory in inventoryDir
+func StartPlayback(inventoryDir string, opts Options, playbackOpts plugins.PlaybackOptions) (*Proxy, error) {
+	plugin, err := plugins.NewPlaybackPluginWithOptions(inventoryDir, playbackOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create playback plugin: %w", err)
+	}
+	p := &Proxy{InventoryDir: inventoryDir, playback: plugin}
+	if err := p.start(opts, plugin, plugin); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// start listens with addon installed and waits until connections are accepted
+func (p *Proxy) start(opts Options, addon proxy.Addon, webSockets httputil.WebSocketHandler) error {
+	p.Port = opts.Port
+	if p.Port == 0 {
+		port, err := FreePort()
+		if err != nil {
+			return err
+		}
+		p.Port = port
+	}
+
+	proxyOpts := httputil.DefaultProxyOptions(p.Port)
+	proxyOpts.Addr = fmt.Sprintf("127.0.0.1:%d", p.Port)
+	proxyOpts.CaRootPath = opts.CaRootPath
+	mitm, err := httputil.CreateProxy(proxyOpts)
+	if err != nil {
+		return fmt.Errorf("failed to create proxy: %w", err)
+	}
+	mitm.AddAddon(addon)
+	if err := httputil.InterceptWebSockets(mitm, webSockets); err != nil {
+		return fmt.Errorf("failed to intercept WebSockets: %w", err)
+	}
+	p.proxy = mitm
+
+	p.exited = make(chan error, 1)
+	go func() {
+		p.exited <- mitm.Start()
+	}()
+	if err := waitForPort(p.Port, DefaultStartTimeout, p.exited); err != nil {
+		mitm.Close()
+		return err
+	}
+	return nil
+}
+
+// Client returns an HTTP client sending its requests through the proxy
+func (p *Proxy) Client() *http.Client {
+	return NewClient(p.Port)
+}
+
+// Recording returns the plugin of a recording proxy, or nil for a playback proxy
+func (p *Proxy) Recording() *plugins.RecordingPlugin {
+	return p.recording
+}
+
+// Playback returns the plugin of a playback proxy, or nil for a recording proxy
+func (p *Proxy) Playback() *plugins.PlaybackPlugin {
+	return p.playback
+}
+
+// Stop closes the proxy. A recording proxy then saves its inventory and waits until the content is
+// beautified, as the command does on interrupt.
+func (p *Proxy) Stop() error {
+	if p.proxy == nil {
+		return nil
+	}
+	p.proxy.Close()
+	<-p.exited
+	p.proxy = nil
+
+	if p.recording != nil {
+		if err := p.recording.SaveInventory(); err != nil {
+			return fmt.Errorf("failed to save inventory: %w", err)
+		}
+		if err := p.recording.WaitBeautified(); err != nil {
+			return fmt.Errorf("failed to beautify content: %w", err)
+		}
+	}
+	return nil
+}
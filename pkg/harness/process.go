@@ -0,0 +1,139 @@
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProcessOptions configures a proxy run as a separate http-playback-proxy process
+type ProcessOptions struct {
+	// Binary is the path of the http-playback-proxy executable
+	Binary string
+	// InventoryDir is passed as --inventory-dir
+	InventoryDir string
+	// Port is passed as --port; 0 picks a free port
+	Port int
+	// Args are appended after the command, e.g. []string{"--no-beautify"}
+	Args []string
+	// Env is added to the environment of the process
+	Env []string
+}
+
+// Process is a recording or playback proxy running as a separate process
+type Process struct {
+	// Port is where the proxy listens
+	Port int
+	// InventoryDir is the inventory the proxy records to or plays back from
+	InventoryDir string
+
+	cmd    *exec.Cmd
+	output lockedBuffer
+	exited chan error
+}
+
+// StartRecordingProcess runs "recording <targetURL>" and waits until the proxy listens
+func StartRecordingProcess(targetURL string, opts ProcessOptions) (*Process, error) {
+	return startProcess(opts, "recording", targetURL)
+}
+
+// StartPlaybackProcess runs "playback" and waits until the proxy listens
+func StartPlaybackProcess(opts ProcessOptions) (*Process, error) {
+	return startProcess(opts, "playback")
+}
+
+func startProcess(opts ProcessOptions, command ...string) (*Process, error) {
+	if opts.Binary == "" {
+		return nil, fmt.Errorf("no http-playback-proxy binary given")
+	}
+	port := opts.Port
+	if port == 0 {
+		var err error
+		if port, err = FreePort(); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"--port", strconv.Itoa(port)}
+	if opts.InventoryDir != "" {
+		args = append(args, "--inventory-dir", opts.InventoryDir)
+	}
+	args = append(args, command...)
+	args = append(args, opts.Args...)
+
+	p := &Process{Port: port, InventoryDir: opts.InventoryDir, exited: make(chan error, 1)}
+	p.cmd = exec.Command(opts.Binary, args...)
+	p.cmd.Env = append(os.Environ(), opts.Env...)
+	p.cmd.Stdout = &p.output
+	p.cmd.Stderr = &p.output
+	if err := p.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", opts.Binary, err)
+	}
+	go func() {
+		p.exited <- p.cmd.Wait()
+	}()
+
+	if err := waitForPort(port, DefaultStartTimeout, p.exited); err != nil {
+		p.cmd.Process.Kill()
+		return nil, fmt.Errorf("%w\n%s", err, p.Output())
+	}
+	return p, nil
+}
+
+// Client returns an HTTP client sending its requests through the proxy
+func (p *Process) Client() *http.Client {
+	return NewClient(p.Port)
+}
+
+// Output returns what the process wrote to stdout and stderr so far
+func (p *Process) Output() string {
+	return p.output.String()
+}
+
+// Stop interrupts the process, which makes a recording proxy save its inventory, and waits for it
+// to exit; it is killed after DefaultStopTimeout
+func (p *Process) Stop() error {
+	if p.cmd == nil {
+		return nil
+	}
+	defer func() { p.cmd = nil }()
+
+	if err := p.cmd.Process.Signal(os.Interrupt); err != nil {
+		// Interrupts cannot be sent on Windows
+		p.cmd.Process.Kill()
+	}
+	select {
+	case err := <-p.exited:
+		if err != nil {
+			return fmt.Errorf("proxy exited with %v\n%s", err, p.Output())
+		}
+		return nil
+	case <-time.After(DefaultStopTimeout):
+		p.cmd.Process.Kill()
+		<-p.exited
+		return fmt.Errorf("proxy did not exit within %v\n%s", DefaultStopTimeout, p.Output())
+	}
+}
+
+// lockedBuffer collects the output of a process while it may be read
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,89 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Framing describes the body that is actually sent with a response
+type Framing struct {
+	Method string
+	Status int
+	// Length is the body size in bytes, or -1 when the body is streamed with an unknown length
+	Length int64
+	// Encoding is the content coding of the body ("" or "identity" when it is not encoded)
+	Encoding string
+}
+
+// bodyless reports whether a response never carries a body (RFC 9110 section 6.4.1)
+func (f Framing) bodyless() bool {
+	return f.Method == http.MethodHead || f.Status < 200 ||
+		f.Status == http.StatusNoContent || f.Status == http.StatusNotModified
+}
+
+// Finalize makes the Content-Length, Transfer-Encoding and Content-Encoding headers agree with the
+// body that will be sent: exactly one of Content-Length or chunked, and no Content-Encoding for an
+// identity body. It returns a description of every header it had to correct.
+func Finalize(header http.Header, framing Framing) []string {
+	var violations []string
+	fix := func(format string, args ...any) {
+		violations = append(violations, fmt.Sprintf(format, args...))
+	}
+
+	transferEncoding := header.Get("Transfer-Encoding")
+	contentLength := header.Get("Content-Length")
+
+	switch {
+	case framing.bodyless():
+		// HEAD and 304 may announce the length of the full representation; nothing is framed
+		if transferEncoding != "" {
+			fix("removed Transfer-Encoding %q from a response without body", transferEncoding)
+			header.Del("Transfer-Encoding")
+		}
+		if contentLength != "" && (framing.Status < 200 || framing.Status == http.StatusNoContent) {
+			fix("removed Content-Length %s from a %d response", contentLength, framing.Status)
+			header.Del("Content-Length")
+		}
+		return violations
+
+	case framing.Length < 0:
+		if contentLength != "" {
+			fix("removed Content-Length %s from a streamed body", contentLength)
+			header.Del("Content-Length")
+		}
+		if !strings.EqualFold(transferEncoding, "chunked") {
+			if transferEncoding != "" {
+				fix("replaced Transfer-Encoding %q with chunked", transferEncoding)
+			}
+			header.Set("Transfer-Encoding", "chunked")
+		}
+
+	default:
+		if transferEncoding != "" {
+			fix("removed Transfer-Encoding %q from a body of known length", transferEncoding)
+			header.Del("Transfer-Encoding")
+		}
+		length := strconv.FormatInt(framing.Length, 10)
+		if contentLength != length {
+			if contentLength != "" {
+				fix("corrected Content-Length from %s to %s", contentLength, length)
+			}
+			header.Set("Content-Length", length)
+		}
+	}
+
+	encoding := framing.Encoding
+	if encoding == "" || strings.EqualFold(encoding, "identity") || framing.Length == 0 {
+		// An empty body cannot be decoded, so it is never encoded
+		if contentEncoding := header.Get("Content-Encoding"); contentEncoding != "" {
+			fix("removed Content-Encoding %q from an identity body", contentEncoding)
+			header.Del("Content-Encoding")
+		}
+	} else if contentEncoding := header.Get("Content-Encoding"); !strings.EqualFold(contentEncoding, encoding) {
+		fix("corrected Content-Encoding from %q to %q", contentEncoding, encoding)
+		header.Set("Content-Encoding", encoding)
+	}
+	return violations
+}
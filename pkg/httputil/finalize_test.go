@@ -0,0 +1,89 @@
+package httputil
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestFinalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     http.Header
+		framing    Framing
+		expected   http.Header
+		violations int
+	}{
+		{
+			name:     "sets missing length",
+			header:   http.Header{},
+			framing:  Framing{Method: "GET", Status: 200, Length: 5},
+			expected: http.Header{"Content-Length": {"5"}},
+		},
+		{
+			name:       "length wins over chunked",
+			header:     http.Header{"Transfer-Encoding": {"chunked"}, "Content-Length": {"9"}},
+			framing:    Framing{Method: "GET", Status: 200, Length: 5},
+			expected:   http.Header{"Content-Length": {"5"}},
+			violations: 2,
+		},
+		{
+			name:       "streamed body is chunked",
+			header:     http.Header{"Content-Length": {"5"}},
+			framing:    Framing{Method: "GET", Status: 200, Length: -1},
+			expected:   http.Header{"Transfer-Encoding": {"chunked"}},
+			violations: 1,
+		},
+		{
+			name:       "identity body drops encoding",
+			header:     http.Header{"Content-Encoding": {"gzip"}, "Content-Length": {"5"}},
+			framing:    Framing{Method: "GET", Status: 200, Length: 5, Encoding: "identity"},
+			expected:   http.Header{"Content-Length": {"5"}},
+			violations: 1,
+		},
+		{
+			name:       "encoded body announces its encoding",
+			header:     http.Header{},
+			framing:    Framing{Method: "GET", Status: 200, Length: 5, Encoding: "br"},
+			expected:   http.Header{"Content-Length": {"5"}, "Content-Encoding": {"br"}},
+			violations: 1,
+		},
+		{
+			name:     "empty body is never encoded",
+			header:   http.Header{"Content-Encoding": {"gzip"}},
+			framing:  Framing{Method: "GET", Status: 200, Length: 0, Encoding: "gzip"},
+			expected: http.Header{"Content-Length": {"0"}},
+			// A missing Content-Length is added without reporting it
+			violations: 1,
+		},
+		{
+			name:     "HEAD keeps the representation length",
+			header:   http.Header{"Content-Length": {"1234"}, "Content-Encoding": {"gzip"}},
+			framing:  Framing{Method: "HEAD", Status: 200, Length: 0},
+			expected: http.Header{"Content-Length": {"1234"}, "Content-Encoding": {"gzip"}},
+		},
+		{
+			name:       "204 has no framing",
+			header:     http.Header{"Content-Length": {"0"}, "Transfer-Encoding": {"chunked"}},
+			framing:    Framing{Method: "GET", Status: 204, Length: 0},
+			expected:   http.Header{},
+			violations: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := Finalize(tt.header, tt.framing)
+			if len(violations) != tt.violations {
+				t.Errorf("Expected %d violations, got %v", tt.violations, violations)
+			}
+			if len(tt.header) != len(tt.expected) {
+				t.Errorf("Expected headers %v, got %v", tt.expected, tt.header)
+			}
+			for name := range tt.expected {
+				if tt.header.Get(name) != tt.expected.Get(name) {
+					t.Errorf("Expected %s %q, got %q", name, tt.expected.Get(name), tt.header.Get(name))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package httputil
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// interimKey is the request context key of the client's http.ResponseWriter
+type interimKey struct{}
+
+// interceptInterim lets addons send interim 1xx responses with WriteInterim. go-mitmproxy writes
+// only the final response to the client, so the handlers of its HTTP servers are wrapped to pass
+// the client's ResponseWriter along in the request context.
+func interceptInterim(p *proxy.Proxy) error {
+	for _, name := range []string{"entry", "attacker"} {
+		server, err := proxyServer(p, name)
+		if err != nil {
+			return err
+		}
+		next := server.Handler
+		server.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), interimKey{}, w)))
+		})
+	}
+	return nil
+}
+
+// WriteInterim sends an interim 1xx response with the headers to the client of a request the proxy
+// received. It must be called from an addon hook before the final response is written; it returns
+// false when the request did not come through a proxy created by CreateProxy.
+func WriteInterim(req *http.Request, statusCode int, headers map[string]string) bool {
+	if req == nil {
+		return false
+	}
+	w, ok := req.Context().Value(interimKey{}).(http.ResponseWriter)
+	if !ok {
+		return false
+	}
+
+	// The header map is shared with the final response, so the interim headers are removed again
+	header := w.Header()
+	saved := header.Clone()
+	for name, value := range headers {
+		header.Set(name, value)
+	}
+	w.WriteHeader(statusCode)
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range saved {
+		header[name] = values
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package httputil
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ListenAddr returns the address to listen on. listen may be empty (all interfaces), a host name or
+// IP address (IPv6 optionally bracketed), host:port, or unix:/path for a Unix domain socket; port is
+// used when listen has none.
+func ListenAddr(listen string, port int) (string, error) {
+	if listen == "" {
+		return ":" + strconv.Itoa(port), nil
+	}
+	if path, ok := UnixSocketPath(listen); ok {
+		if path == "" {
+			return "", fmt.Errorf("empty Unix socket path in listen address %q", listen)
+		}
+		return listen, nil
+	}
+	if host, p, err := net.SplitHostPort(listen); err == nil {
+		if _, err := strconv.ParseUint(p, 10, 16); err != nil {
+			return "", fmt.Errorf("invalid port in listen address %q", listen)
+		}
+		return net.JoinHostPort(host, p), nil
+	}
+
+	// Bare IPv6 literals contain colons, so they are not host:port
+	host := strings.TrimSuffix(strings.TrimPrefix(listen, "["), "]")
+	if strings.ContainsAny(host, "[]") {
+		return "", fmt.Errorf("invalid listen address %q", listen)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// ListenURL returns the proxy URL clients use to reach a listen address
+func ListenURL(addr string) string {
+	if _, ok := UnixSocketPath(addr); ok {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// LoopbackHost returns the loopback address of the listen address's family, so local-only
+// endpoints such as the admin API also work in IPv6-only environments
+func LoopbackHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		return "::1"
+	}
+	return "127.0.0.1"
+}
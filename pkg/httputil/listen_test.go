@@ -0,0 +1,56 @@
+package httputil
+
+import "testing"
+
+func TestListenAddr(t *testing.T) {
+	tests := []struct {
+		listen   string
+		expected string
+	}{
+		{"", ":8080"},
+		{"127.0.0.1", "127.0.0.1:8080"},
+		{"localhost:9000", "localhost:9000"},
+		{"::1", "[::1]:8080"},
+		{"[::1]", "[::1]:8080"},
+		{"[::]:9000", "[::]:9000"},
+		{"unix:/tmp/proxy.sock", "unix:/tmp/proxy.sock"},
+	}
+	for _, tt := range tests {
+		addr, err := ListenAddr(tt.listen, 8080)
+		if err != nil {
+			t.Errorf("ListenAddr(%q) failed: %v", tt.listen, err)
+			continue
+		}
+		if addr != tt.expected {
+			t.Errorf("ListenAddr(%q) = %q, expected %q", tt.listen, addr, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{"127.0.0.1:http", "[[::1]]", "unix:"} {
+		if _, err := ListenAddr(invalid, 8080); err == nil {
+			t.Errorf("Expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestListenURLAndLoopback(t *testing.T) {
+	tests := []struct {
+		addr     string
+		url      string
+		loopback string
+	}{
+		{":8080", "http://localhost:8080", "127.0.0.1"},
+		{"0.0.0.0:8080", "http://localhost:8080", "127.0.0.1"},
+		{"[::]:8080", "http://localhost:8080", "::1"},
+		{"[::1]:8080", "http://[::1]:8080", "::1"},
+		{"192.0.2.1:8080", "http://192.0.2.1:8080", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		if got := ListenURL(tt.addr); got != tt.url {
+			t.Errorf("ListenURL(%q) = %q, expected %q", tt.addr, got, tt.url)
+		}
+		if got := LoopbackHost(tt.addr); got != tt.loopback {
+			t.Errorf("LoopbackHost(%q) = %q, expected %q", tt.addr, got, tt.loopback)
+		}
+	}
+}
@@ -2,14 +2,17 @@ package httputil
 
 import (
 	"fmt"
-	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/logging"
 )
 
+// logger is the logger for proxy-level events
+var logger = logging.For(logging.ModuleProxy)
+
 // ProxyOptions defines options for creating a proxy
 type ProxyOptions struct {
 	Port              int
@@ -17,6 +20,10 @@ type ProxyOptions struct {
 	SslInsecure       bool
 	CaRootPath        string
 	Debug             int
+	// Addr is the listen address; when empty the proxy listens on Port on all interfaces
+	Addr string
+	// MaxHeaderBytes limits the request header block the proxy's servers read; 0 keeps the 1MB default
+	MaxHeaderBytes int
 }
 
 // DefaultProxyOptions returns default proxy options
@@ -32,21 +39,41 @@ func DefaultProxyOptions(port int) *ProxyOptions {
 
 // CreateProxy creates a new MITM proxy instance with common settings
 func CreateProxy(opts *ProxyOptions) (*proxy.Proxy, error) {
+	addr := opts.Addr
+	if addr == "" {
+		addr = fmt.Sprintf(":%d", opts.Port)
+	}
 	proxyOpts := &proxy.Options{
-		Addr:              fmt.Sprintf(":%d", opts.Port),
+		Addr:              addr,
 		StreamLargeBodies: opts.StreamLargeBodies,
 		SslInsecure:       opts.SslInsecure,
 		CaRootPath:        opts.CaRootPath,
 		Debug:             opts.Debug,
 	}
 
-	return proxy.NewProxy(proxyOpts)
+	p, err := proxy.NewProxy(proxyOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := interceptInterim(p); err != nil {
+		return nil, err
+	}
+	if opts.MaxHeaderBytes > 0 {
+		for _, name := range []string{"entry", "attacker"} {
+			server, err := proxyServer(p, name)
+			if err != nil {
+				return nil, err
+			}
+			server.MaxHeaderBytes = opts.MaxHeaderBytes
+		}
+	}
+	return p, nil
 }
 
 // StartProxyWithShutdown starts the proxy server with graceful shutdown handling
 func StartProxyWithShutdown(p *proxy.Proxy, port int) {
-	slog.Info("Starting MITM proxy server", "port", port)
-	slog.Info("Proxy settings", "url", fmt.Sprintf("http://localhost:%d", port))
+	logger.Info("Starting MITM proxy server", "port", port)
+	logger.Info("Proxy settings", "url", fmt.Sprintf("http://localhost:%d", port))
 
 	// シグナルハンドリング
 	c := make(chan os.Signal, 1)
@@ -54,12 +81,12 @@ func StartProxyWithShutdown(p *proxy.Proxy, port int) {
 
 	go func() {
 		<-c
-		slog.Info("Shutting down...")
+		logger.Info("Shutting down...")
 		os.Exit(0)
 	}()
 
 	if err := p.Start(); err != nil {
-		slog.Error("Proxy start failed", "error", err)
+		logger.Error("Proxy start failed", "error", err)
 		os.Exit(1)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,56 @@
+package httputil
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateProxy_MaxHeaderBytes(t *testing.T) {
+	addr, err := FreeLoopbackAddr()
+	if err != nil {
+		t.Fatalf("Failed to allocate address: %v", err)
+	}
+	p, err := CreateProxy(&ProxyOptions{Addr: addr, SslInsecure: true, CaRootPath: t.TempDir(), MaxHeaderBytes: 1024})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	for _, name := range []string{"entry", "attacker"} {
+		server, err := proxyServer(p, name)
+		if err != nil {
+			t.Fatalf("Failed to reach the %s server: %v", name, err)
+		}
+		if server.MaxHeaderBytes != 1024 {
+			t.Errorf("Expected the %s server to limit headers to 1024 bytes, got %d", name, server.MaxHeaderBytes)
+		}
+	}
+	go p.Start()
+	defer p.Close()
+
+	var conn net.Conn
+	for i := 0; i < 50 && conn == nil; i++ {
+		if conn, err = net.Dial("tcp", addr); err != nil {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	if conn == nil {
+		t.Fatal("Proxy did not start")
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Far over the limit, so the server refuses it before any addon sees the request
+	fmt.Fprintf(conn, "GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\nX-Large: %s\r\n\r\n", strings.Repeat("a", 64*1024))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected 431, got %d", resp.StatusCode)
+	}
+}
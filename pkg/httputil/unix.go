@@ -0,0 +1,159 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// unixPrefix marks a listen address as a Unix domain socket path
+const unixPrefix = "unix:"
+
+// UnixSocketPath returns the socket path of a "unix:/path" address
+func UnixSocketPath(addr string) (string, bool) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(addr, unixPrefix), true
+}
+
+// Listen listens on a TCP address or, for "unix:/path", on a Unix domain socket
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := UnixSocketPath(addr); ok {
+		return ListenUnix(path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// ListenUnix listens on a Unix domain socket, replacing a socket file left by an earlier run
+func ListenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty Unix socket path")
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		// A socket nobody answers on is stale
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// FreeLoopbackAddr returns a loopback TCP address with a port that is currently free
+func FreeLoopbackAddr() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("failed to find a free port: %w", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String(), nil
+}
+
+// BridgeAddr is the listen address of a proxy bridged to a Unix socket: a loopback port the system
+// picks when the proxy starts
+const BridgeAddr = "127.0.0.1:0"
+
+// BridgeUnixSocket forwards the connections accepted on ln to a proxy created with BridgeAddr, until
+// ln is closed. The proxy's port is taken from its own listener when it starts, so no other process
+// can take the port in between; connections wait on ln until then.
+func BridgeUnixSocket(p *proxy.Proxy, ln net.Listener) error {
+	server, err := proxyServer(p, "entry")
+	if err != nil {
+		return err
+	}
+	listening := make(chan string, 1)
+	base := server.BaseContext
+	server.BaseContext = func(l net.Listener) context.Context {
+		select {
+		case listening <- l.Addr().String():
+		default:
+		}
+		if base != nil {
+			return base(l)
+		}
+		return context.Background()
+	}
+
+	go func() {
+		target := <-listening
+		if err := ServeBridge(ln, target); err != nil {
+			logger.Error("Unix socket listener stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// ServeBridge forwards every connection accepted on ln to the TCP address target until ln is closed.
+// go-mitmproxy only listens on TCP, so a Unix socket listener is bridged to a loopback port.
+func ServeBridge(ln net.Listener, target string) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go bridge(conn, target)
+	}
+}
+
+func bridge(conn net.Conn, target string) {
+	defer conn.Close()
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		logger.Warn("Failed to reach proxy from Unix socket", "target", target, "error", err)
+		return
+	}
+	defer upstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		// Pass the end of stream on so the other direction can finish
+		if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+			closer.CloseWrite()
+		}
+	}
+	go copyHalf(upstream, conn)
+	go copyHalf(conn, upstream)
+	wg.Wait()
+}
+
+// UnixProxyTransport returns a transport that sends every request through a proxy listening on a
+// Unix domain socket. Set TLSClientConfig to trust the proxy's CA for HTTPS.
+func UnixProxyTransport(socketPath string) *http.Transport {
+	transport := UnixTransport(socketPath)
+	// The host is never resolved; every connection is dialed to the socket
+	transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: "unix-socket"})
+	return transport
+}
+
+// UnixTransport returns a transport that connects to a server listening on a Unix domain socket,
+// such as the admin API; the host of request URLs is ignored
+func UnixTransport(socketPath string) *http.Transport {
+	var dialer net.Dialer
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+}
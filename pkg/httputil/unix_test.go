@@ -0,0 +1,132 @@
+package httputil
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocketBridge(t *testing.T) {
+	// The proxy receives absolute-form requests from proxy clients
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.String()))
+	}))
+	defer proxy.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "proxy.sock")
+	ln, err := ListenUnix(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	go ServeBridge(ln, proxy.Listener.Addr().String())
+	defer ln.Close()
+
+	client := &http.Client{Transport: UnixProxyTransport(socketPath)}
+	resp, err := client.Get("http://example.com/page?q=1")
+	if err != nil {
+		t.Fatalf("Request through socket failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "http://example.com/page?q=1" {
+		t.Errorf("Expected the proxy to receive the absolute URL, got %q", body)
+	}
+}
+
+func TestBridgeUnixSocket(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("origin"))
+	}))
+	defer origin.Close()
+
+	p, err := CreateProxy(&ProxyOptions{Addr: BridgeAddr, SslInsecure: true, CaRootPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	socketPath := filepath.Join(t.TempDir(), "proxy.sock")
+	ln, err := ListenUnix(socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	if err := BridgeUnixSocket(p, ln); err != nil {
+		t.Fatalf("BridgeUnixSocket failed: %v", err)
+	}
+	go p.Start()
+	defer p.Close()
+
+	// Connections made before the proxy listens wait for it
+	client := &http.Client{Transport: UnixProxyTransport(socketPath)}
+	resp, err := client.Get(origin.URL)
+	if err != nil {
+		t.Fatalf("Request through socket failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "origin" {
+		t.Errorf("Expected the origin's response, got %q", body)
+	}
+
+	// Closing the listener removes the socket file
+	ln.Close()
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket file to be removed, got %v", err)
+	}
+}
+
+func TestListenUnix_Stale(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+
+	// A socket left behind by a killed process
+	stale, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := ListenUnix(socketPath)
+	if err != nil {
+		t.Fatalf("Expected the stale socket to be replaced: %v", err)
+	}
+	defer ln.Close()
+
+	// A live socket is not taken over
+	if _, err := ListenUnix(socketPath); err == nil {
+		t.Error("Expected an error for a socket in use")
+	}
+
+	// Regular files are never removed
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	if _, err := ListenUnix(file); err == nil {
+		t.Error("Expected an error for a regular file")
+	}
+}
+
+func TestUnixTransport(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "admin.sock")
+	ln, err := Listen("unix:" + socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	client := &http.Client{Transport: UnixTransport(socketPath)}
+	resp, err := client.Get("http://admin/scenario")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/scenario" {
+		t.Errorf("Expected /scenario, got %q", body)
+	}
+}
@@ -0,0 +1,71 @@
+package httputil
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"unsafe"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/websocket"
+)
+
+// WebSocketHandler takes over WebSocket upgrade requests. It returns false to leave the request
+// to go-mitmproxy, which forwards it to the origin as is.
+type WebSocketHandler interface {
+	ServeWebSocket(w http.ResponseWriter, req *http.Request) bool
+}
+
+// InterceptWebSockets routes the WebSocket upgrade requests the proxy receives to the handler; it
+// must be called before the proxy starts. go-mitmproxy tunnels WebSockets itself before any addon
+// sees them, so the handlers of its HTTP servers (the proxy listener for ws:// and the TLS
+// interception server for wss://) are wrapped.
+func InterceptWebSockets(p *proxy.Proxy, handler WebSocketHandler) error {
+	for _, name := range []string{"entry", "attacker"} {
+		server, err := proxyServer(p, name)
+		if err != nil {
+			return err
+		}
+		server.Handler = &webSocketInterceptor{next: server.Handler, handler: handler, tls: name == "attacker"}
+	}
+	return nil
+}
+
+// mitmproxyVersion is the go-mitmproxy release whose unexported layout proxyServer relies on. It has
+// no public hook for its HTTP servers, so go.mod pins it and TestProxyServer_Layout fails on upgrade
+// until the layout is checked again.
+const mitmproxyVersion = "v1.8.5"
+
+// proxyServer returns the *http.Server of one of go-mitmproxy's unexported components
+func proxyServer(p *proxy.Proxy, component string) (*http.Server, error) {
+	field := reflect.ValueOf(p).Elem().FieldByName(component)
+	if !field.IsValid() || field.Kind() != reflect.Pointer || field.IsNil() {
+		return nil, fmt.Errorf("go-mitmproxy has no %s component", component)
+	}
+	server := field.Elem().FieldByName("server")
+	if !server.IsValid() || server.Type() != reflect.TypeOf(&http.Server{}) {
+		return nil, fmt.Errorf("go-mitmproxy %s has no HTTP server", component)
+	}
+	return *(**http.Server)(unsafe.Pointer(server.UnsafeAddr())), nil
+}
+
+// webSocketInterceptor passes WebSocket upgrade requests to the handler and the rest to next
+type webSocketInterceptor struct {
+	next    http.Handler
+	handler WebSocketHandler
+	// tls is set for the server of intercepted TLS connections, whose requests carry no scheme
+	tls bool
+}
+
+func (i *webSocketInterceptor) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == http.MethodGet && websocket.IsUpgrade(req.Header) {
+		if i.tls {
+			req.URL.Scheme = "https"
+			req.URL.Host = req.Host
+		}
+		if req.URL.IsAbs() && i.handler.ServeWebSocket(w, req) {
+			return
+		}
+	}
+	i.next.ServeHTTP(w, req)
+}
@@ -0,0 +1,142 @@
+package httputil
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// lazyTLS makes the proxy intercept TLS without connecting to the origin first
+type lazyTLS struct {
+	proxy.BaseAddon
+}
+
+func (*lazyTLS) ClientConnected(client *proxy.ClientConn) {
+	client.UpstreamCert = false
+}
+
+type upgradeRecorder struct {
+	urls chan string
+}
+
+func (r *upgradeRecorder) ServeWebSocket(w http.ResponseWriter, req *http.Request) bool {
+	r.urls <- req.URL.String()
+	w.WriteHeader(http.StatusTeapot)
+	return true
+}
+
+func TestInterceptWebSockets(t *testing.T) {
+	addr, err := FreeLoopbackAddr()
+	if err != nil {
+		t.Fatalf("Failed to allocate address: %v", err)
+	}
+	p, err := CreateProxy(&ProxyOptions{Addr: addr, SslInsecure: true, CaRootPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	p.AddAddon(&lazyTLS{})
+	recorder := &upgradeRecorder{urls: make(chan string, 1)}
+	if err := InterceptWebSockets(p, recorder); err != nil {
+		t.Fatalf("InterceptWebSockets failed: %v", err)
+	}
+	go p.Start()
+	defer p.Close()
+
+	dial := func() net.Conn {
+		for i := 0; i < 50; i++ {
+			if conn, err := net.Dial("tcp", addr); err == nil {
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				return conn
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		t.Fatal("Proxy did not start")
+		return nil
+	}
+	upgrade := "Host: example.com\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	expect := func(reader *bufio.Reader, url string) {
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if resp.StatusCode != http.StatusTeapot {
+			t.Errorf("Expected the handler's response, got %d", resp.StatusCode)
+		}
+		select {
+		case got := <-recorder.urls:
+			if got != url {
+				t.Errorf("Expected the handler to get %s, got %s", url, got)
+			}
+		case <-time.After(time.Second):
+			t.Error("Handler was not called")
+		}
+	}
+
+	// ws:// arrives at the proxy listener in absolute form
+	conn := dial()
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET http://example.com/ws HTTP/1.1\r\n%s", upgrade)
+	expect(bufio.NewReader(conn), "http://example.com/ws")
+
+	// wss:// goes through a CONNECT tunnel the proxy intercepts
+	tunnel := dial()
+	defer tunnel.Close()
+	fmt.Fprintf(tunnel, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")
+	reader := bufio.NewReader(tunnel)
+	if resp, err := http.ReadResponse(reader, nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT failed: %v", err)
+	}
+	tlsConn := tls.Client(tunnel, &tls.Config{ServerName: "example.com", InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+	fmt.Fprintf(tlsConn, "GET /ws?room=1 HTTP/1.1\r\n%s", upgrade)
+	expect(bufio.NewReader(tlsConn), "https://example.com/ws?room=1")
+}
+
+// TestProxyServer_Layout fails when go-mitmproxy changes the unexported fields proxyServer reads
+func TestProxyServer_Layout(t *testing.T) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		t.Fatal("Build info is not available")
+	}
+	version := ""
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/lqqyt2423/go-mitmproxy" {
+			version = dep.Version
+		}
+	}
+	if version != mitmproxyVersion {
+		t.Fatalf("go-mitmproxy is %q but proxyServer was checked against %s; check its layout and update mitmproxyVersion", version, mitmproxyVersion)
+	}
+
+	addr, err := FreeLoopbackAddr()
+	if err != nil {
+		t.Fatalf("Failed to allocate address: %v", err)
+	}
+	p, err := CreateProxy(&ProxyOptions{Addr: addr, SslInsecure: true, CaRootPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	entry, err := proxyServer(p, "entry")
+	if err != nil {
+		t.Fatalf("Failed to reach the entry server: %v", err)
+	}
+	attacker, err := proxyServer(p, "attacker")
+	if err != nil {
+		t.Fatalf("Failed to reach the attacker server: %v", err)
+	}
+	if entry.Addr != addr || entry.Handler == nil {
+		t.Errorf("Expected the entry server to listen on %s, got %+v", addr, entry)
+	}
+	if attacker == entry || attacker.Handler == nil {
+		t.Errorf("Expected a separate attacker server, got %+v", attacker)
+	}
+	if _, err := proxyServer(p, "missing"); err == nil {
+		t.Error("Expected an error for an unknown component")
+	}
+}
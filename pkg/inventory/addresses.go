@@ -0,0 +1,70 @@
+package inventory
+
+import (
+	"net/url"
+	"sort"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// RecordedDomains returns the hosts of the transactions with the address of the first response
+// from each, sorted by name. Hosts without a known address are left out unless they advertised HTTP/3.
+func RecordedDomains(transactions []types.RecordingTransaction) []types.Domain {
+	var domains []types.Domain
+	for _, transaction := range transactions {
+		domains = addDomain(domains, &transaction)
+	}
+	return domains
+}
+
+// addDomain adds the host of a transaction to domains unless it is there or nothing is known of it,
+// and marks it when the transaction advertised HTTP/3 or opened a TLS connection
+func addDomain(domains []types.Domain, transaction *types.RecordingTransaction) []types.Domain {
+	if transaction.IPAddress == "" && !transaction.AdvertisedHTTP3 && transaction.DomainTLS == nil {
+		return domains
+	}
+	u, err := url.Parse(transaction.URL)
+	if err != nil {
+		return domains
+	}
+	name := u.Hostname()
+	i := sort.Search(len(domains), func(i int) bool { return domains[i].Name >= name })
+	if i < len(domains) && domains[i].Name == name {
+		domains[i].HTTP3 = domains[i].HTTP3 || transaction.AdvertisedHTTP3
+		domains[i].TLS = preferredTLS(domains[i].TLS, transaction.DomainTLS)
+		if domains[i].IPAddress == "" {
+			domains[i].IPAddress, domains[i].Resolver = transaction.IPAddress, transaction.Resolver
+		}
+		return domains
+	}
+	domains = append(domains, types.Domain{})
+	copy(domains[i+1:], domains[i:])
+	domains[i] = types.Domain{Name: name, IPAddress: transaction.IPAddress, Resolver: transaction.Resolver,
+		HTTP3: transaction.AdvertisedHTTP3, TLS: transaction.DomainTLS}
+	return domains
+}
+
+// mergeDomains adds the domains of another inventory missing from domains, keeping them sorted
+func mergeDomains(domains, other []types.Domain) []types.Domain {
+	for _, domain := range other {
+		i := sort.Search(len(domains), func(i int) bool { return domains[i].Name >= domain.Name })
+		if i < len(domains) && domains[i].Name == domain.Name {
+			domains[i].HTTP3 = domains[i].HTTP3 || domain.HTTP3
+			domains[i].TLS = preferredTLS(domains[i].TLS, domain.TLS)
+			continue
+		}
+		domains = append(domains, types.Domain{})
+		copy(domains[i+1:], domains[i:])
+		domains[i] = domain
+	}
+	return domains
+}
+
+// preferredTLS keeps the TLS details a domain has, unless they are missing or of a resumed
+// handshake, which is shorter than a new connection needs
+func preferredTLS(current, other *types.DomainTLS) *types.DomainTLS {
+	if current == nil || (current.Resumed && other != nil && !other.Resumed) {
+		return other
+	}
+	return current
+}
@@ -0,0 +1,121 @@
+package inventory
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SyncPolicy controls which inventory files are flushed to stable storage after they are written.
+// Every file is written to a temporary file and renamed into place, so a crash never leaves a
+// half-written file; syncing also keeps the files across a power loss.
+type SyncPolicy string
+
+const (
+	// SyncNone leaves flushing to the operating system
+	SyncNone SyncPolicy = "none"
+	// SyncInventory syncs inventory.json, which is written last, but not the content files (default)
+	SyncInventory SyncPolicy = "inventory"
+	// SyncAll syncs every content file as well
+	SyncAll SyncPolicy = "all"
+)
+
+// tempSuffix ends the names of temporary files, which are hidden: .<name>.<random>.tmp
+const tempSuffix = ".tmp"
+
+// ParseSyncPolicy parses a --fsync value
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(value); policy {
+	case SyncNone, SyncInventory, SyncAll:
+		return policy, nil
+	case "":
+		return SyncInventory, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q (none, inventory, all)", value)
+	}
+}
+
+// writeContent writes a content file under the sync policy
+func (pm *PersistenceManager) writeContent(filePath string, data []byte, perm os.FileMode) error {
+	return writeFileAtomic(filePath, data, perm, pm.Sync == SyncAll)
+}
+
+// writeMetadata writes inventory.json or another file that references content files, under the
+// sync policy
+func (pm *PersistenceManager) writeMetadata(filePath string, data []byte) error {
+	return writeFileAtomic(filePath, data, 0644, pm.Sync != SyncNone)
+}
+
+// writeFileAtomic replaces a file by renaming a fully written temporary file over it. With sync,
+// the file and then its directory are flushed so the rename survives a power loss.
+func writeFileAtomic(filePath string, data []byte, perm os.FileMode, sync bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if sync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return err
+	}
+	if sync {
+		syncDir(filepath.Dir(filePath))
+	}
+	return nil
+}
+
+// syncDir flushes a directory entry; not every platform can sync a directory, so errors are ignored
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// isTempFile reports whether a file name is a temporary file of writeFileAtomic
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempSuffix)
+}
+
+// FindOrphanedTempFiles lists the temporary files left in the inventory by writes that were
+// interrupted, relative to BaseDir
+func (pm *PersistenceManager) FindOrphanedTempFiles() ([]string, error) {
+	var orphans []string
+	err := filepath.WalkDir(pm.BaseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == pm.BaseDir && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() && isTempFile(d.Name()) {
+			rel, err := filepath.Rel(pm.BaseDir, path)
+			if err != nil {
+				return err
+			}
+			orphans = append(orphans, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan inventory: %w", err)
+	}
+	return orphans, nil
+}
@@ -0,0 +1,163 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"go-http-playback-proxy/pkg/formatting"
+)
+
+// BeautifyQueue beautifies saved content files on background workers, so saving an inventory
+// does not wait for large bundles to be reformatted. Content files are first saved as received;
+// each save's inventory is updated once all of its files are done.
+type BeautifyQueue struct {
+	optimizer *formatting.ContentOptimizer
+	jobs      chan beautifyJob
+	pending   sync.WaitGroup
+	// mutex serializes inventory updates of finished batches
+	mutex      sync.Mutex
+	beautified atomic.Int64
+}
+
+// beautifyBatch is the set of content files of one saved inventory
+type beautifyBatch struct {
+	pm        *PersistenceManager
+	remaining atomic.Int64
+	mutex     sync.Mutex
+	changed   map[string]bool
+}
+
+type beautifyJob struct {
+	batch       *beautifyBatch
+	path        string
+	contentType string
+}
+
+// NewBeautifyQueue starts a queue with the given number of workers
+func NewBeautifyQueue(workers int) *BeautifyQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &BeautifyQueue{
+		optimizer: formatting.NewContentOptimizer(),
+		jobs:      make(chan beautifyJob, workers),
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Wait blocks until every submitted file is beautified and its inventory updated
+func (q *BeautifyQueue) Wait() {
+	if q == nil {
+		return
+	}
+	q.pending.Wait()
+}
+
+// Beautified returns how many content files were changed by beautification so far
+func (q *BeautifyQueue) Beautified() int {
+	if q == nil {
+		return 0
+	}
+	return int(q.beautified.Load())
+}
+
+// accepts reports whether content of the type is beautified by the queue
+func (q *BeautifyQueue) accepts(contentType string) bool {
+	return q != nil && contentType != "" && q.optimizer.Accept(contentType)
+}
+
+// submit queues the content files (paths relative to contents/ mapped to their Content-Type)
+// of the inventory just saved by pm
+func (q *BeautifyQueue) submit(pm *PersistenceManager, files map[string]string) {
+	if q == nil || len(files) == 0 {
+		return
+	}
+	batch := &beautifyBatch{pm: pm, changed: make(map[string]bool)}
+	batch.remaining.Store(int64(len(files)))
+	q.pending.Add(len(files))
+	go func() {
+		for path, contentType := range files {
+			q.jobs <- beautifyJob{batch: batch, path: path, contentType: contentType}
+		}
+	}()
+}
+
+func (q *BeautifyQueue) work() {
+	for job := range q.jobs {
+		changed, err := q.beautify(job)
+		if err != nil {
+			logger.Warn("Beautification failed", "path", job.path, "error", err)
+		}
+		if changed {
+			q.beautified.Add(1)
+			job.batch.mutex.Lock()
+			job.batch.changed[job.path] = true
+			job.batch.mutex.Unlock()
+		}
+		if job.batch.remaining.Add(-1) == 0 {
+			if err := q.updateInventory(job.batch); err != nil {
+				logger.Error("Failed to update inventory after beautification", "directory", job.batch.pm.BaseDir, "error", err)
+			}
+		}
+		q.pending.Done()
+	}
+}
+
+// beautify rewrites one content file and reports whether it changed
+func (q *BeautifyQueue) beautify(job beautifyJob) (bool, error) {
+	filePath := filepath.Join(job.batch.pm.BaseDir, "contents", job.path)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read content file: %w", err)
+	}
+	beautified, err := q.optimizer.Beautify(job.contentType, string(data))
+	if err != nil {
+		return false, err
+	}
+	if beautified == string(data) {
+		return false, nil
+	}
+	if err := job.batch.pm.writeContent(filePath, []byte(beautified), 0644); err != nil {
+		return false, fmt.Errorf("failed to write content file: %w", err)
+	}
+	return true, nil
+}
+
+// updateInventory refreshes the recorded checksums of the changed files of a finished batch
+func (q *BeautifyQueue) updateInventory(batch *beautifyBatch) error {
+	if len(batch.changed) == 0 {
+		return nil
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	inventory, err := batch.pm.LoadInventory()
+	if err != nil {
+		return err
+	}
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		if resource.ContentFilePath == nil || resource.ContentSHA256 == nil || !batch.changed[*resource.ContentFilePath] {
+			continue
+		}
+		if err := setContentChecksum(resource, filepath.Join(batch.pm.BaseDir, "contents", *resource.ContentFilePath)); err != nil {
+			return err
+		}
+	}
+
+	data, err := EncodeInventory(inventory)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inventory: %w", err)
+	}
+	// Readers of inventory.json may run while the queue works, so they must never see a partial file
+	if err := batch.pm.writeMetadata(filepath.Join(batch.pm.BaseDir, "inventory.json"), data); err != nil {
+		return fmt.Errorf("failed to write inventory file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package inventory
+
+import (
+	"strconv"
+	"strings"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// cacheHeaders are CDN headers reporting a cache hit or miss, in order of precedence
+var cacheHeaders = []string{
+	"CF-Cache-Status",
+	"X-Cache",
+	"X-Cache-Status",
+	"X-Proxy-Cache",
+	"X-Cache-Lookup",
+	"CDN-Cache",
+}
+
+// DetectCacheStatus classifies a recorded response as served by a CDN edge cache or by the origin
+// server, or returns "" when the headers do not tell
+func DetectCacheStatus(headers types.HttpHeaders) types.CacheStatus {
+	for _, name := range cacheHeaders {
+		value := strings.ToUpper(headerValue(headers, name))
+		if value == "" {
+			continue
+		}
+		// Multi-tier CDNs report every layer (e.g. Fastly "MISS, HIT"); any hit avoided the origin
+		switch {
+		case strings.Contains(value, "HIT"), strings.Contains(value, "STALE"),
+			strings.Contains(value, "UPDATING"), strings.Contains(value, "REVALIDATED"):
+			return types.CacheStatusHit
+		case strings.Contains(value, "MISS"), strings.Contains(value, "EXPIRED"),
+			strings.Contains(value, "BYPASS"), strings.Contains(value, "PASS"), strings.Contains(value, "DYNAMIC"):
+			return types.CacheStatusOrigin
+		}
+	}
+
+	// A positive Age means the response was stored by a cache
+	if age, err := strconv.Atoi(strings.TrimSpace(headerValue(headers, "Age"))); err == nil && age > 0 {
+		return types.CacheStatusHit
+	}
+	return ""
+}
+
+// headerValue looks up a header case-insensitively
+func headerValue(headers types.HttpHeaders, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
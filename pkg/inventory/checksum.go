@@ -0,0 +1,121 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Checksum modes for playback
+const (
+	ChecksumOff  = "off"
+	ChecksumWarn = "warn"
+	ChecksumFail = "fail"
+)
+
+// ChecksumResult is the verification result for one content file
+type ChecksumResult struct {
+	URL      string
+	Path     string
+	Expected string
+	Actual   string
+	Err      error
+}
+
+// OK reports whether the content file matches its recorded checksum
+func (r ChecksumResult) OK() bool {
+	return r.Err == nil && r.Expected == r.Actual
+}
+
+// ContentChecksum returns the hex encoded SHA-256 of content
+func ContentChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checksumMatches reports whether data matches the recorded checksum; resources without one always match
+func checksumMatches(resource *types.Resource, data []byte) bool {
+	return resource.ContentSHA256 == nil || *resource.ContentSHA256 == ContentChecksum(data)
+}
+
+// setContentChecksum records the checksum of a content file on the resource
+func setContentChecksum(resource *types.Resource, filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read content file: %w", err)
+	}
+	setChecksum(resource, data)
+	return nil
+}
+
+// setChecksum records data as the content of the resource's content file
+func setChecksum(resource *types.Resource, data []byte) {
+	checksum := ContentChecksum(data)
+	// A content file changed after it was saved is replayed instead of the original it was normalized from
+	if resource.ContentSHA256 != nil && *resource.ContentSHA256 != checksum {
+		resource.OriginalFilePath = nil
+	}
+	resource.ContentSHA256 = &checksum
+}
+
+// VerifyChecksums checks every content file that has a recorded checksum
+func (pm *PersistenceManager) VerifyChecksums() ([]ChecksumResult, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ChecksumResult
+	for _, resource := range inventory.Resources {
+		if resource.ContentFilePath == nil || resource.ContentSHA256 == nil {
+			continue
+		}
+		result := ChecksumResult{
+			URL:      resource.URL,
+			Path:     *resource.ContentFilePath,
+			Expected: *resource.ContentSHA256,
+		}
+		data, err := os.ReadFile(ContentFile(pm.BaseDir, *resource.ContentFilePath))
+		if err != nil {
+			result.Err = fmt.Errorf("failed to read content file: %w", err)
+		} else {
+			result.Actual = ContentChecksum(data)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// UpdateChecksums records the current checksum of every content file and returns how many changed
+func (pm *PersistenceManager) UpdateChecksums() (int, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		if resource.ContentFilePath == nil {
+			continue
+		}
+		previous := ""
+		if resource.ContentSHA256 != nil {
+			previous = *resource.ContentSHA256
+		}
+		if err := setContentChecksum(resource, ContentFile(pm.BaseDir, *resource.ContentFilePath)); err != nil {
+			return updated, fmt.Errorf("%s: %w", resource.URL, err)
+		}
+		if *resource.ContentSHA256 != previous {
+			updated++
+		}
+	}
+
+	if err := pm.SaveInventory(inventory); err != nil {
+		return updated, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,102 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// ClientsDir is the sub-directory of an inventory holding per-client inventories
+const ClientsDir = "clients"
+
+// ErrNoClientTags is returned when splitting an inventory recorded without client tags
+var ErrNoClientTags = errors.New("no client tags found in inventory")
+
+// unsafeClientChars matches characters that are replaced in client directory names
+var unsafeClientChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// ClientDirName returns a filesystem-safe directory name for a client identifier
+func ClientDirName(clientID string) string {
+	return unsafeClientChars.ReplaceAllString(clientID, "_")
+}
+
+// mergeClients returns the sorted union of two client lists
+func mergeClients(a, b []string) []string {
+	if len(b) == 0 {
+		return a
+	}
+	seen := make(map[string]bool)
+	var merged []string
+	for _, list := range [][]string{a, b} {
+		for _, client := range list {
+			if !seen[client] {
+				seen[client] = true
+				merged = append(merged, client)
+			}
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// SplitByClient writes one inventory per tagged client under BaseDir/clients/<client>
+// and returns the written directories. Resources requested by several clients are included in each.
+func (pm *PersistenceManager) SplitByClient() ([]string, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	byClient := make(map[string][]types.Resource)
+	for _, resource := range inventory.Resources {
+		for _, client := range resource.Clients {
+			byClient[client] = append(byClient[client], resource)
+		}
+	}
+	if len(byClient) == 0 {
+		return nil, ErrNoClientTags
+	}
+
+	clients := make([]string, 0, len(byClient))
+	for client := range byClient {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+
+	var dirs []string
+	for _, client := range clients {
+		dir := filepath.Join(pm.BaseDir, ClientsDir, ClientDirName(client))
+		for _, resource := range byClient[client] {
+			if resource.ContentFilePath == nil {
+				continue
+			}
+			srcPath := ContentFile(pm.BaseDir, *resource.ContentFilePath)
+			dstPath := filepath.Join(dir, "contents", *resource.ContentFilePath)
+			if err := copyFile(srcPath, dstPath); err != nil {
+				return nil, fmt.Errorf("failed to copy content for %s: %w", resource.URL, err)
+			}
+			if err := copyOriginal(pm.BaseDir, dir, &resource); err != nil {
+				return nil, err
+			}
+		}
+
+		sub := NewPersistenceManager(dir)
+		if err := sub.SaveInventory(&types.Inventory{
+			EntryURL:   inventory.EntryURL,
+			DeviceType: inventory.DeviceType,
+			Playback:   inventory.Playback,
+			Domains:    inventory.Domains,
+			Resources:  byClient[client],
+			Redaction:  inventory.Redaction,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to save inventory for %s: %w", client, err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
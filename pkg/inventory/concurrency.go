@@ -0,0 +1,71 @@
+package inventory
+
+import (
+	"sort"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// RecordedConcurrency returns the most requests each host had in flight at once while recording.
+// A request is in flight from its start until its body was received, as derived from its TTFB,
+// Mbps and wire size. Resources without a timestamp are left out.
+func RecordedConcurrency(resources []types.Resource) map[string]int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	events := make(map[string][]event)
+	for i := range resources {
+		resource := &resources[i]
+		if resource.Timestamp.IsZero() {
+			continue
+		}
+		host := resourceHost(resource)
+		if host == "" {
+			continue
+		}
+		end := resource.Timestamp.Add(time.Duration(resource.TTFBMS)*time.Millisecond + transferDuration(resource))
+		if !end.After(resource.Timestamp) {
+			end = resource.Timestamp.Add(time.Nanosecond)
+		}
+		events[host] = append(events[host], event{resource.Timestamp, 1}, event{end, -1})
+	}
+
+	concurrency := make(map[string]int, len(events))
+	for host, hostEvents := range events {
+		// A request finishing as another starts does not overlap it
+		sort.Slice(hostEvents, func(i, j int) bool {
+			if !hostEvents[i].at.Equal(hostEvents[j].at) {
+				return hostEvents[i].at.Before(hostEvents[j].at)
+			}
+			return hostEvents[i].delta < hostEvents[j].delta
+		})
+		inFlight := 0
+		for _, e := range hostEvents {
+			inFlight += e.delta
+			if inFlight > concurrency[host] {
+				concurrency[host] = inFlight
+			}
+		}
+	}
+	return concurrency
+}
+
+// transferDuration returns how long receiving the body of a resource took while recording
+func transferDuration(resource *types.Resource) time.Duration {
+	if resource.MBPS == nil || *resource.MBPS <= 0 || resource.WireSize == nil {
+		return 0
+	}
+	seconds := float64(*resource.WireSize*8) / (*resource.MBPS * 1024 * 1024)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// LoadConcurrency returns the recorded concurrency of each host of the inventory
+func (pm *PlaybackManager) LoadConcurrency() (map[string]int, error) {
+	inventory, err := pm.loadInventory()
+	if err != nil {
+		return nil, err
+	}
+	return RecordedConcurrency(inventory.Resources), nil
+}
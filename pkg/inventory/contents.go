@@ -0,0 +1,76 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-http-playback-proxy/pkg/resource"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// ContentFile returns where the content file of an inventory is on disk. Inventories recorded on a
+// case-insensitive file system may name a file in another case than the resource refers to it, so
+// when the exact path does not exist a file differing only in case is used instead.
+func ContentFile(baseDir, contentFilePath string) string {
+	exact := filepath.Join(baseDir, "contents", filepath.FromSlash(resource.NormalizeFilePath(contentFilePath)))
+	if _, err := os.Stat(exact); err == nil || !os.IsNotExist(err) {
+		return exact
+	}
+
+	dir := filepath.Join(baseDir, "contents")
+	for _, name := range strings.Split(resource.NormalizeFilePath(contentFilePath), "/") {
+		next, ok := findFold(dir, name)
+		if !ok {
+			return exact
+		}
+		dir = next
+	}
+	return dir
+}
+
+// findFold returns the entry of dir named name, compared case-insensitively if no entry has the exact name
+func findFold(dir, name string) (string, bool) {
+	if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+		return filepath.Join(dir, name), true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), name) {
+			return filepath.Join(dir, entry.Name()), true
+		}
+	}
+	return "", false
+}
+
+// normalizeContentPaths stores the content file paths of resources with forward slashes
+func normalizeContentPaths(resources []types.Resource) {
+	for i := range resources {
+		if p := resources[i].ContentFilePath; p != nil {
+			if normalized := resource.NormalizeFilePath(*p); normalized != *p {
+				resources[i].ContentFilePath = &normalized
+			}
+		}
+	}
+}
+
+// contentPaths hands out content file paths that stay distinct on case-insensitive file systems
+type contentPaths map[string]string // folded path -> path that claimed it
+
+// claim returns the path a resource's content is saved under: filePath itself, or an alternative
+// when another path differing only in case already took it
+func (c contentPaths) claim(filePath string) string {
+	candidate := filePath
+	for n := 2; ; n++ {
+		folded := resource.FoldFilePath(candidate)
+		owner, taken := c[folded]
+		if !taken || owner == candidate {
+			c[folded] = candidate
+			return candidate
+		}
+		candidate = resource.DisambiguateFilePath(filePath, n)
+	}
+}
@@ -0,0 +1,145 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// DomainsDir is the sub-directory of an inventory holding per-domain inventories
+const DomainsDir = "domains"
+
+// DomainDirName returns a filesystem-safe directory name for a host (the port separator is replaced)
+func DomainDirName(host string) string {
+	return strings.ReplaceAll(strings.ToLower(host), ":", "_")
+}
+
+// SaveRecordedTransactionsByDomain saves one inventory per host under BaseDir/domains/<host>
+// and returns the written directories
+func (pm *PersistenceManager) SaveRecordedTransactionsByDomain(
+	transactions []types.RecordingTransaction,
+	entryURL string,
+	noBeautify bool,
+) ([]string, error) {
+	byHost := make(map[string][]types.RecordingTransaction)
+	for _, transaction := range transactions {
+		u, err := url.Parse(transaction.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse URL %s: %w", transaction.URL, err)
+		}
+		byHost[u.Host] = append(byHost[u.Host], transaction)
+	}
+
+	hosts := make([]string, 0, len(byHost))
+	for host := range byHost {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	var dirs []string
+	for _, host := range hosts {
+		dir := filepath.Join(pm.BaseDir, DomainsDir, DomainDirName(host))
+		sub := NewPersistenceManager(dir)
+		sub.Summary = pm.Summary
+		sub.Beautifier = pm.Beautifier
+		sub.Sync = pm.Sync
+		sub.NormalizeJSON = pm.NormalizeJSON
+		sub.KeepOriginals = pm.KeepOriginals
+		sub.Append = pm.Append
+		sub.Redaction = pm.Redaction
+		if err := sub.SaveRecordedTransactionsWithOptions(byHost[host], entryURL, noBeautify); err != nil {
+			return nil, fmt.Errorf("failed to save inventory for %s: %w", host, err)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
+
+// MergeInventories merges the inventories in srcDirs into BaseDir, copying their content files.
+// Resources with the same method, URL and variant (prefetch, image format, language, request body
+// or repeat) are taken from the last source that contains them.
+func (pm *PersistenceManager) MergeInventories(srcDirs []string) (*types.Inventory, error) {
+	merged := &types.Inventory{}
+	index := make(map[string]int)
+
+	for _, srcDir := range srcDirs {
+		src := NewPersistenceManager(srcDir)
+		inventory, err := src.LoadInventory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", srcDir, err)
+		}
+
+		if merged.EntryURL == nil {
+			merged.EntryURL = inventory.EntryURL
+		}
+		if merged.DeviceType == nil {
+			merged.DeviceType = inventory.DeviceType
+		}
+		if merged.Playback == nil {
+			merged.Playback = inventory.Playback
+		}
+		merged.Domains = mergeDomains(merged.Domains, inventory.Domains)
+
+		for _, resource := range inventory.Resources {
+			if resource.ContentFilePath != nil {
+				srcPath := ContentFile(srcDir, *resource.ContentFilePath)
+				dstPath := filepath.Join(pm.BaseDir, "contents", *resource.ContentFilePath)
+				if err := copyFile(srcPath, dstPath); err != nil {
+					return nil, fmt.Errorf("failed to copy content for %s: %w", resource.URL, err)
+				}
+			}
+			if err := copyOriginal(srcDir, pm.BaseDir, &resource); err != nil {
+				return nil, err
+			}
+
+			key := variantKey(&resource, resource.URL)
+			if i, exists := index[key]; exists {
+				merged.Resources[i] = resource
+				continue
+			}
+			index[key] = len(merged.Resources)
+			merged.Resources = append(merged.Resources, resource)
+		}
+	}
+
+	if err := pm.SaveInventory(merged); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// copyFile copies a file through a temporary file, creating the destination directory
+func copyFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	dst, err := os.CreateTemp(filepath.Dir(dstPath), "."+filepath.Base(dstPath)+".*"+tempSuffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name())
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(dst.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), dstPath)
+}
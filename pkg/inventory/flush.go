@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"time"
+
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// flushSegments re-encodes an HTML body so the parts its origin flushed can be decoded as soon as they
+// arrive, and returns it with where each flushed part ends. ok is false when the recorded flushes do
+// not apply: not HTML, a coding that cannot be flushed, or a document edited down past them.
+func flushSegments(body []byte, resource *types.Resource, bodyEncoding types.ContentEncodingType) ([]byte, []int, bool) {
+	if len(resource.Flushes) == 0 || len(resource.Parts) > 0 {
+		return nil, nil, false
+	}
+	if mime := resourceMime(resource); mime != "text/html" && mime != "application/xhtml+xml" {
+		return nil, nil, false
+	}
+	decoded, err := encoding.DecodeData(body, bodyEncoding)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	// Each flush ends right after the '>' that completed its last tag
+	var segments [][]byte
+	start, tags := 0, 0
+	for _, flush := range resource.Flushes {
+		end := start
+		for ; end < len(decoded) && tags < flush.Tags; end++ {
+			if decoded[end] == '>' {
+				tags++
+			}
+		}
+		if tags < flush.Tags || end >= len(decoded) {
+			break
+		}
+		segments = append(segments, decoded[start:end])
+		start = end
+	}
+	if len(segments) == 0 {
+		return nil, nil, false
+	}
+	segments = append(segments, decoded[start:])
+
+	encoded, ends, err := encoding.EncodeSegments(segments, bodyEncoding, 6)
+	if err != nil {
+		logger.Debug("Flushes cannot be replayed", "url", resource.URL, "error", err)
+		return nil, nil, false
+	}
+	return encoded, ends[:len(ends)-1], true
+}
+
+// flushChunks sends each flushed part of a body whole at its recorded time, then the rest of the
+// document as the calculated chunks had it, but not before the last flush
+func flushChunks(body []byte, ends []int, flushes []types.FlushPoint, calculated []types.BodyChunk) []types.BodyChunk {
+	chunks := make([]types.BodyChunk, 0, len(ends)+len(calculated))
+	start := 0
+	var lastFlush time.Duration
+	for i, end := range ends {
+		lastFlush = time.Duration(flushes[i].OffsetMS) * time.Millisecond
+		chunks = append(chunks, types.BodyChunk{
+			Chunk:        body[start:end],
+			TargetTime:   time.Now().Add(lastFlush),
+			TargetOffset: lastFlush,
+		})
+		start = end
+	}
+
+	// The calculated chunks cover the same body in order
+	position := 0
+	for _, chunk := range calculated {
+		chunkStart := position
+		position += len(chunk.Chunk)
+		if position <= start {
+			continue
+		}
+		if chunkStart < start {
+			chunk.Chunk = body[start:position]
+		}
+		if chunk.TargetOffset < lastFlush {
+			chunk.TargetOffset = lastFlush
+			chunk.TargetTime = time.Now().Add(lastFlush)
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,206 @@
+package inventory
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-http-playback-proxy/pkg/formatting"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Format modes for FormatContents
+const (
+	FormatBeautify = "beautify"
+	FormatMinify   = "minify"
+)
+
+// FormatOptions configures a batch re-format of inventory content files
+type FormatOptions struct {
+	// Mode is FormatBeautify or FormatMinify
+	Mode string
+	// DryRun computes diffs without writing files
+	DryRun bool
+	// Config is passed to the content optimizer (nil uses the defaults)
+	Config *formatting.OptimizerConfig
+}
+
+// FormatResult describes the outcome for one content file
+type FormatResult struct {
+	URL        string
+	Path       string
+	Changed    bool
+	BeforeSize int
+	AfterSize  int
+	// Diff is a unified diff of the change, set in dry-run mode
+	Diff string
+	Err  error
+}
+
+// LoadInventory loads inventory.json from the base directory
+func (pm *PersistenceManager) LoadInventory() (*types.Inventory, error) {
+	data, err := os.ReadFile(filepath.Join(pm.BaseDir, "inventory.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+
+	inventory, err := DecodeInventory(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory JSON: %w", err)
+	}
+
+	return inventory, nil
+}
+
+// SaveInventory writes inventory.json to the base directory
+func (pm *PersistenceManager) SaveInventory(inventory *types.Inventory) error {
+	return pm.saveInventoryJSON(filepath.Join(pm.BaseDir, "inventory.json"), inventory)
+}
+
+// ReadContent returns the stored (decoded) body of a resource, or nil if it has none
+func (pm *PersistenceManager) ReadContent(resource *types.Resource) ([]byte, error) {
+	switch {
+	case resource.ContentUTF8 != nil:
+		return []byte(*resource.ContentUTF8), nil
+	case resource.ContentBase64 != nil:
+		data, err := base64.StdEncoding.DecodeString(*resource.ContentBase64)
+		if err != nil {
+			return nil, fmt.Errorf("base64 decode failed: %w", err)
+		}
+		return data, nil
+	case resource.ContentFilePath != nil:
+		data, err := os.ReadFile(ContentFile(pm.BaseDir, *resource.ContentFilePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read content file: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, nil
+	}
+}
+
+// FormatContents re-runs the content optimizer over every HTML/CSS/JavaScript content file
+func (pm *PersistenceManager) FormatContents(opts FormatOptions) ([]FormatResult, error) {
+	if opts.Mode != FormatBeautify && opts.Mode != FormatMinify {
+		return nil, fmt.Errorf("unknown format mode: %s", opts.Mode)
+	}
+
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	optimizer := formatting.NewContentOptimizer(opts.Config)
+	var results []FormatResult
+	checksumsChanged := false
+
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		if resource.ContentFilePath == nil || resource.ContentTypeMime == nil {
+			continue
+		}
+		mimeType := *resource.ContentTypeMime
+		if !optimizer.Accept(mimeType) {
+			continue
+		}
+		// Content that could not be converted to UTF-8 is stored as-is and must not be rewritten
+		if resource.ContentCharset != nil && strings.HasSuffix(*resource.ContentCharset, "-failed") {
+			continue
+		}
+
+		result := FormatResult{
+			URL:  resource.URL,
+			Path: *resource.ContentFilePath,
+		}
+		result.Err = pm.formatContentFile(optimizer, mimeType, opts, &result)
+		results = append(results, result)
+
+		// Keep recorded checksums valid for intentionally rewritten files
+		if result.Err == nil && result.Changed && !opts.DryRun && resource.ContentSHA256 != nil {
+			if err := setContentChecksum(resource, ContentFile(pm.BaseDir, result.Path)); err != nil {
+				return results, err
+			}
+			checksumsChanged = true
+		}
+	}
+
+	if checksumsChanged {
+		if err := pm.SaveInventory(inventory); err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// formatContentFile formats a single content file and fills in the result
+func (pm *PersistenceManager) formatContentFile(optimizer *formatting.ContentOptimizer, mimeType string, opts FormatOptions, result *FormatResult) error {
+	filePath := ContentFile(pm.BaseDir, result.Path)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read content file: %w", err)
+	}
+
+	before := string(data)
+	var after string
+	if opts.Mode == FormatMinify {
+		after, err = optimizer.Minify(mimeType, before)
+	} else {
+		after, err = optimizer.Beautify(mimeType, before)
+	}
+	if err != nil {
+		return err
+	}
+
+	result.BeforeSize = len(before)
+	result.AfterSize = len(after)
+	result.Changed = before != after
+	if !result.Changed {
+		return nil
+	}
+
+	if opts.DryRun {
+		result.Diff = unifiedDiff(result.Path, before, after)
+		return nil
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat content file: %w", err)
+	}
+	if err := pm.writeContent(filePath, []byte(after), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write content file: %w", err)
+	}
+	return nil
+}
+
+// unifiedDiff returns a single-hunk unified diff covering the changed lines between before and after
+func unifiedDiff(name, before, after string) string {
+	a := strings.SplitAfter(before, "\n")
+	b := strings.SplitAfter(after, "\n")
+
+	// Trim the common prefix and suffix; everything in between forms one hunk
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	removed := a[prefix : len(a)-suffix]
+	added := b[prefix : len(b)-suffix]
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", name, name)
+	fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", prefix+1, len(removed), prefix+1, len(added))
+	for _, line := range removed {
+		sb.WriteString("-" + strings.TrimSuffix(line, "\n") + "\n")
+	}
+	for _, line := range added {
+		sb.WriteString("+" + strings.TrimSuffix(line, "\n") + "\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,478 @@
+package inventory
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/har"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// harPageID is the id of the single page the exported entries belong to
+const harPageID = "page_1"
+
+// ExportHAR converts the inventory and its content files into an HTTP Archive. The request side
+// has the recorded headers, cookies and body, or only Accept and fetch metadata for inventories
+// recorded before request headers were kept; the response side has the recorded headers, the
+// decoded body, and the timing split into wait (TTFB) and receive.
+func (pm *PersistenceManager) ExportHAR() (*har.HAR, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*types.Resource, len(inventory.Resources))
+	for i := range inventory.Resources {
+		resources[i] = &inventory.Resources[i]
+	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		return resources[i].Timestamp.Before(resources[j].Timestamp)
+	})
+
+	log := har.Log{
+		Version: har.Version,
+		Creator: har.Creator{Name: "http-playback-proxy", Version: "dev"},
+		Entries: make([]har.Entry, 0, len(resources)),
+	}
+
+	if len(resources) > 0 {
+		title := ""
+		if inventory.EntryURL != nil {
+			title = *inventory.EntryURL
+		}
+		log.Pages = []har.Page{{
+			StartedDateTime: harTime(resources[0].Timestamp),
+			ID:              harPageID,
+			Title:           title,
+			PageTimings:     har.PageTimings{OnContentLoad: -1, OnLoad: -1},
+		}}
+	}
+
+	for _, resource := range resources {
+		body, err := pm.ReadContent(resource)
+		if err != nil {
+			return nil, err
+		}
+		requestBody, err := RequestBody(resource)
+		if err != nil {
+			return nil, err
+		}
+		log.Entries = append(log.Entries, harEntry(resource, requestBody, body))
+	}
+
+	return &har.HAR{Log: log}, nil
+}
+
+// harEntry converts a resource, its request body and its decoded body into a HAR entry
+func harEntry(resource *types.Resource, requestBody, body []byte) har.Entry {
+	httpVersion := "HTTP/1.1"
+	if resource.Protocol != nil {
+		httpVersion = harHTTPVersion(*resource.Protocol)
+	}
+	request := har.Request{
+		Method:      resource.Method,
+		URL:         resource.URL,
+		HTTPVersion: httpVersion,
+		Cookies:     []har.Cookie{},
+		Headers:     harRequestHeaders(resource),
+		QueryString: []har.NameValuePair{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if resource.Method == http.MethodGet || resource.Method == http.MethodHead {
+		request.BodySize = 0
+	}
+	if cookie := resource.RequestHeaders["Cookie"]; cookie != "" {
+		for _, c := range (&http.Request{Header: http.Header{"Cookie": {cookie}}}).Cookies() {
+			request.Cookies = append(request.Cookies, har.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+	if len(requestBody) > 0 {
+		request.BodySize = int64(len(requestBody))
+		request.PostData = &har.PostData{MimeType: resource.RequestHeaders["Content-Type"]}
+		if utf8.Valid(requestBody) {
+			request.PostData.Text = string(requestBody)
+		} else {
+			request.PostData.Text = base64.StdEncoding.EncodeToString(requestBody)
+			request.PostData.Encoding = "base64"
+		}
+	}
+	if u, err := url.Parse(resource.URL); err == nil {
+		for _, pair := range strings.Split(u.RawQuery, "&") {
+			if pair == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(pair, "=")
+			if unescaped, err := url.QueryUnescape(name); err == nil {
+				name = unescaped
+			}
+			if unescaped, err := url.QueryUnescape(value); err == nil {
+				value = unescaped
+			}
+			request.QueryString = append(request.QueryString, har.NameValuePair{Name: name, Value: value})
+		}
+	}
+
+	response := har.Response{
+		HTTPVersion: httpVersion,
+		Cookies:     []har.Cookie{},
+		Headers:     []har.NameValuePair{},
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	if resource.StatusCode != nil {
+		response.Status = *resource.StatusCode
+		response.StatusText = http.StatusText(*resource.StatusCode)
+	}
+	if resource.ErrorMessage != nil {
+		response.Error = *resource.ErrorMessage
+	}
+	if resource.WireSize != nil {
+		response.BodySize = *resource.WireSize
+	}
+
+	names := make([]string, 0, len(resource.RawHeaders))
+	for name := range resource.RawHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := resource.RawHeaders[name]
+		response.Headers = append(response.Headers, har.NameValuePair{Name: name, Value: value})
+		if strings.EqualFold(name, "Location") {
+			response.RedirectURL = value
+		}
+		if strings.EqualFold(name, "Content-Type") {
+			response.Content.MimeType = value
+		}
+	}
+	if response.Content.MimeType == "" && resource.ContentTypeMime != nil {
+		response.Content.MimeType = *resource.ContentTypeMime
+	}
+
+	response.Content.Size = int64(len(body))
+	if compression := response.Content.Size - response.BodySize; compression > 0 {
+		response.Content.Compression = compression
+	}
+	if len(body) > 0 {
+		if utf8.Valid(body) {
+			response.Content.Text = string(body)
+		} else {
+			response.Content.Text = base64.StdEncoding.EncodeToString(body)
+			response.Content.Encoding = "base64"
+		}
+	}
+
+	// The recorded TTFB starts after the connection was set up, so the handshake comes on top
+	timings := har.Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: float64(resource.TTFBMS)}
+	if resource.TLSSession != nil {
+		handshake := float64(resource.TLSSession.HandshakeMS)
+		timings.SSL = handshake
+		timings.Connect = handshake
+	}
+	if resource.MBPS != nil && *resource.MBPS > 0 && response.BodySize > 0 {
+		timings.Receive = float64(response.BodySize) * 8 / (*resource.MBPS * 1024 * 1024) * 1000
+	}
+	// Traced phases are exact; HAR counts the TLS handshake in connect as well
+	if phases := resource.Timings; phases != nil {
+		if phases.DNSMS > 0 {
+			timings.DNS = float64(phases.DNSMS)
+		}
+		if phases.ConnectMS > 0 {
+			timings.Connect = float64(phases.ConnectMS)
+			if timings.SSL > 0 {
+				timings.Connect += timings.SSL
+			}
+		}
+	}
+
+	return har.Entry{
+		Pageref:         harPageID,
+		StartedDateTime: harTime(resource.Timestamp),
+		Time:            timings.Total(),
+		Request:         request,
+		Response:        response,
+		Timings:         timings,
+	}
+}
+
+// harRequestHeaders returns the recorded request headers, or rebuilds them from Accept and fetch
+// metadata when they were not recorded
+func harRequestHeaders(resource *types.Resource) []har.NameValuePair {
+	headers := []har.NameValuePair{}
+	if len(resource.RequestHeaders) > 0 {
+		names := make([]string, 0, len(resource.RequestHeaders))
+		for name := range resource.RequestHeaders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			headers = append(headers, har.NameValuePair{Name: name, Value: resource.RequestHeaders[name]})
+		}
+		return headers
+	}
+	if resource.Accept != nil {
+		headers = append(headers, har.NameValuePair{Name: "Accept", Value: *resource.Accept})
+	}
+	if fetch := resource.Fetch; fetch != nil {
+		for _, header := range []har.NameValuePair{
+			{Name: "Sec-Fetch-Dest", Value: fetch.Dest},
+			{Name: "Sec-Fetch-Mode", Value: fetch.Mode},
+			{Name: "Sec-Fetch-Site", Value: fetch.Site},
+			{Name: "Sec-Purpose", Value: fetch.Purpose},
+		} {
+			if header.Value != "" {
+				headers = append(headers, header)
+			}
+		}
+		if fetch.User {
+			headers = append(headers, har.NameValuePair{Name: "Sec-Fetch-User", Value: "?1"})
+		}
+	}
+	return headers
+}
+
+// harTime formats a timestamp as HAR expects (ISO 8601 with milliseconds)
+func harTime(t time.Time) string {
+	return t.Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// HARImport holds the recording transactions converted from a HAR file
+type HARImport struct {
+	Transactions []types.RecordingTransaction
+	// EntryURL is the URL of the first page, or of the first entry when the file has no pages
+	EntryURL string
+	// Skipped counts the entries that cannot be replayed (data:, blob: and other non-HTTP URLs)
+	Skipped int
+}
+
+// TransactionsFromHAR converts the entries of a HAR file into recording transactions, so they can
+// be saved like a recording. As when recording, the TTFB leaves out setting up the connection (send
+// and wait only) and the transfer lasts receive. Bodies are re-encoded with the
+// recorded Content-Encoding, because HAR files hold decoded content. Responses Chrome marked as
+// pushed are listed in the pushes of their initiator, or of the first entry of their page.
+func TransactionsFromHAR(archive *har.HAR) (*HARImport, error) {
+	result := &HARImport{}
+	firstPage := ""
+	if len(archive.Log.Pages) > 0 {
+		firstPage = archive.Log.Pages[0].ID
+	}
+	byURL := make(map[string]int)
+	byPage := make(map[string]int)
+	var pushed []*har.Entry
+
+	for i := range archive.Log.Entries {
+		entry := &archive.Log.Entries[i]
+		if u, err := url.Parse(entry.Request.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			result.Skipped++
+			continue
+		}
+
+		transaction, err := harTransaction(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %w", entry.Request.URL, err)
+		}
+		result.Transactions = append(result.Transactions, *transaction)
+		if result.EntryURL == "" && (firstPage == "" || entry.Pageref == firstPage) {
+			result.EntryURL = entry.Request.URL
+		}
+		if _, ok := byURL[entry.Request.URL]; !ok {
+			byURL[entry.Request.URL] = len(result.Transactions) - 1
+		}
+		if _, ok := byPage[entry.Pageref]; !ok {
+			byPage[entry.Pageref] = len(result.Transactions) - 1
+		}
+		if entry.WasPushed != 0 {
+			pushed = append(pushed, entry)
+		}
+	}
+
+	for _, entry := range pushed {
+		var pusher int
+		var ok bool
+		if entry.Initiator != nil && entry.Initiator.URL != "" {
+			pusher, ok = byURL[entry.Initiator.URL]
+		}
+		if !ok {
+			pusher, ok = byPage[entry.Pageref]
+		}
+		if ok && result.Transactions[pusher].URL != entry.Request.URL {
+			result.Transactions[pusher].Pushes = append(result.Transactions[pusher].Pushes, entry.Request.URL)
+		}
+	}
+
+	return result, nil
+}
+
+// harTransaction converts a HAR entry into a recording transaction
+func harTransaction(entry *har.Entry) (*types.RecordingTransaction, error) {
+	started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid startedDateTime: %w", err)
+	}
+
+	timings := entry.Timings
+	var ttfb float64
+	for _, phase := range []float64{timings.Send, timings.Wait} {
+		if phase > 0 {
+			ttfb += phase
+		}
+	}
+	responseStarted := started.Add(harDuration(ttfb))
+
+	transaction := &types.RecordingTransaction{
+		Method:           entry.Request.Method,
+		URL:              entry.Request.URL,
+		RequestStarted:   started,
+		ResponseStarted:  responseStarted,
+		ResponseFinished: responseStarted.Add(harDuration(max(0, timings.Receive))),
+		RawHeaders:       make(types.HttpHeaders),
+		Protocol:         ParseProtocol(entry.Response.HTTPVersion),
+		Timings:          harPhases(timings),
+	}
+
+	// Browsers report requests that got no response with status 0
+	if entry.Response.Status > 0 {
+		statusCode := entry.Response.Status
+		transaction.StatusCode = &statusCode
+	} else {
+		message := entry.Response.Error
+		if message == "" {
+			message = "no response"
+		}
+		transaction.ErrorMessage = &message
+		return transaction, nil
+	}
+
+	// The first value of each header is kept, as when recording; HTTP/2 pseudo-headers are dropped
+	for _, header := range entry.Response.Headers {
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		name := http.CanonicalHeaderKey(header.Name)
+		if _, ok := transaction.RawHeaders[name]; !ok {
+			transaction.RawHeaders[name] = header.Value
+		}
+	}
+	transaction.RequestHeaders = harHeaders(entry.Request.Headers)
+	if postData := entry.Request.PostData; postData != nil && postData.Text != "" {
+		requestBody := []byte(postData.Text)
+		if postData.Encoding == "base64" {
+			requestBody, err = base64.StdEncoding.DecodeString(postData.Text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 post data: %w", err)
+			}
+		}
+		contentType := transaction.RequestHeaders["Content-Type"]
+		if contentType == "" {
+			contentType = postData.MimeType
+		}
+		transaction.RequestBodySHA256 = RequestBodyHash(contentType, requestBody)
+		if len(requestBody) <= MaxRequestBodySize {
+			transaction.RequestBody = requestBody
+		}
+	}
+	fetch := &types.FetchMetadata{}
+	for _, header := range entry.Request.Headers {
+		switch strings.ToLower(header.Name) {
+		case "accept":
+			transaction.Accept = header.Value
+		case "sec-fetch-dest":
+			fetch.Dest = header.Value
+		case "sec-fetch-mode":
+			fetch.Mode = header.Value
+		case "sec-fetch-site":
+			fetch.Site = header.Value
+		case "sec-fetch-user":
+			fetch.User = header.Value == "?1"
+		case "sec-purpose", "purpose":
+			fetch.Purpose = header.Value
+		}
+	}
+	if *fetch != (types.FetchMetadata{}) {
+		transaction.Fetch = fetch
+	}
+
+	body := []byte(entry.Response.Content.Text)
+	if entry.Response.Content.Encoding == "base64" {
+		body, err = base64.StdEncoding.DecodeString(entry.Response.Content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 content: %w", err)
+		}
+	}
+	if contentEncoding := transaction.RawHeaders["Content-Encoding"]; contentEncoding != "" && len(body) > 0 {
+		encodingType := types.ContentEncodingType(strings.ToLower(contentEncoding))
+		if encodingType != types.ContentEncodingIdentity {
+			encoded, err := encoding.EncodeData(body, encodingType, 6)
+			if err != nil {
+				// Keep the body playable as it is
+				delete(transaction.RawHeaders, "Content-Encoding")
+			} else {
+				body = encoded
+			}
+		}
+	}
+	transaction.Body = body
+
+	return transaction, nil
+}
+
+// harHeaders converts HAR request headers, joining repeated ones as when recording and dropping
+// HTTP/2 pseudo-headers
+func harHeaders(pairs []har.NameValuePair) types.HttpHeaders {
+	headers := make(types.HttpHeaders)
+	for _, header := range pairs {
+		if strings.HasPrefix(header.Name, ":") {
+			continue
+		}
+		name := http.CanonicalHeaderKey(header.Name)
+		switch {
+		case headers[name] == "":
+			headers[name] = header.Value
+		case name == "Cookie":
+			headers[name] += "; " + header.Value
+		default:
+			headers[name] += ", " + header.Value
+		}
+	}
+	return headers
+}
+
+// harDuration converts HAR milliseconds into a duration
+func harDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// harHTTPVersion returns the httpVersion of a protocol as Chrome writes it in HAR files
+func harHTTPVersion(protocol types.Protocol) string {
+	switch protocol {
+	case types.ProtocolHTTP2:
+		return "h2"
+	case types.ProtocolHTTP3:
+		return "h3"
+	}
+	return "HTTP/1.1"
+}
+
+// harPhases converts the timings of a HAR entry, where -1 marks a phase that did not happen and
+// connect includes the TLS handshake
+func harPhases(timings har.Timings) *types.Timings {
+	ms := func(phase float64) int64 { return int64(max(0, phase)) }
+	phases := &types.Timings{
+		DNSMS:     ms(timings.DNS),
+		ConnectMS: ms(timings.Connect),
+		TLSMS:     ms(timings.SSL),
+		SendMS:    ms(timings.Send),
+		WaitMS:    ms(timings.Wait),
+		ReceiveMS: ms(timings.Receive),
+	}
+	phases.ConnectMS = max(0, phases.ConnectMS-phases.TLSMS)
+	return phases
+}
@@ -1,15 +1,22 @@
 package inventory
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 	
 	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/har"
 	"go-http-playback-proxy/pkg/resource"
 	"go-http-playback-proxy/pkg/testutil"
 	"go-http-playback-proxy/pkg/types"
@@ -457,6 +464,57 @@ func TestPlaybackManager_ContentUTF8(t *testing.T) {
 	}
 }
 
+func TestPlaybackManager_RewriteRules(t *testing.T) {
+	t.Setenv("PLAYBACK_HOST", "localhost:8080")
+	rewrites, err := NewRewriteRules(&RewriteRules{Rules: []RewriteRule{
+		{ContentTypes: []string{"text/html", "*/javascript"}, Pattern: `https://www\.example\.com(/[a-z]*)`, Replacement: `http://{{env "PLAYBACK_HOST"}}$1`},
+		{ContentTypes: []string{"text/html"}, Hosts: []string{"*.example.com"}, Pattern: `</body>`, Replacement: `<script src="{{.Origin}}/banner.js"></script></body>`, Limit: 1},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create rewrite rules: %v", err)
+	}
+	pm := NewPlaybackManager(t.TempDir())
+	pm.Rewrites = rewrites
+
+	replay := func(url, contentType, content string) string {
+		resource := &types.Resource{
+			Method:          "GET",
+			URL:             url,
+			ContentTypeMime: &contentType,
+			ContentUTF8:     &content,
+		}
+		transaction, err := pm.convertResourceToTransaction(resource)
+		if err != nil {
+			t.Fatalf("Failed to convert resource: %v", err)
+		}
+		var body []byte
+		for _, chunk := range transaction.Chunks {
+			body = append(body, chunk.Chunk...)
+		}
+		if transaction.RawHeaders["Content-Length"] != strconv.Itoa(len(body)) {
+			t.Errorf("Expected Content-Length %d, got %s", len(body), transaction.RawHeaders["Content-Length"])
+		}
+		return string(body)
+	}
+
+	html := replay("https://www.example.com/", "text/html", `<a href="https://www.example.com/about">a</a></body></body>`)
+	if html != `<a href="http://localhost:8080/about">a</a><script src="https://www.example.com/banner.js"></script></body></body>` {
+		t.Errorf("Unexpected rewritten HTML %q", html)
+	}
+	if js := replay("https://cdn.other.com/app.js", "application/javascript", `fetch("https://www.example.com/api")`); js != `fetch("http://localhost:8080/api")` {
+		t.Errorf("Unexpected rewritten script %q", js)
+	}
+	if css := replay("https://www.example.com/site.css", "text/css", `url(https://www.example.com/bg)`); css != `url(https://www.example.com/bg)` {
+		t.Errorf("Expected other content types to be left alone, got %q", css)
+	}
+
+	for _, rule := range []RewriteRule{{}, {Pattern: "("}, {Pattern: "a", Replacement: "{{"}, {Pattern: "a", Limit: -1}} {
+		if _, err := NewRewriteRules(&RewriteRules{Rules: []RewriteRule{rule}}); err == nil {
+			t.Errorf("Expected rewrite rule %+v to be rejected", rule)
+		}
+	}
+}
+
 func TestPlaybackManager_ContentBase64(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "content_base64_test")
 	if err != nil {
@@ -654,3 +712,2582 @@ func TestPlaybackManager_ContentCompression(t *testing.T) {
 		t.Errorf("Decompressed content mismatch. Expected: %q, Got: %q", utf8Content, string(decompressedBody))
 	}
 }
+
+// TestDetectCacheStatus tests classifying responses as CDN cache hits or origin responses
+func TestDetectCacheStatus(t *testing.T) {
+	testCases := []struct {
+		headers  types.HttpHeaders
+		expected types.CacheStatus
+	}{
+		{types.HttpHeaders{"Cf-Cache-Status": "HIT"}, types.CacheStatusHit},
+		{types.HttpHeaders{"Cf-Cache-Status": "DYNAMIC"}, types.CacheStatusOrigin},
+		{types.HttpHeaders{"X-Cache": "Miss from cloudfront"}, types.CacheStatusOrigin},
+		{types.HttpHeaders{"X-Cache": "MISS, HIT"}, types.CacheStatusHit},
+		{types.HttpHeaders{"Age": "120"}, types.CacheStatusHit},
+		{types.HttpHeaders{"Age": "0"}, ""},
+		{types.HttpHeaders{"Content-Type": "text/html"}, ""},
+	}
+	for _, tc := range testCases {
+		if got := DetectCacheStatus(tc.headers); got != tc.expected {
+			t.Errorf("%v: expected %q, got %q", tc.headers, tc.expected, got)
+		}
+	}
+}
+
+// TestPlaybackManager_StreamParts tests that streaming responses are replayed part by part
+func TestPlaybackManager_StreamParts(t *testing.T) {
+	pm := NewPlaybackManager(t.TempDir())
+	body := []byte("part-one|part-two|")
+	resource := &types.Resource{
+		TTFBMS: 10,
+		Parts: []types.StreamPart{
+			{OffsetMS: 10, Size: 9},
+			{OffsetMS: 1010, Size: 9},
+		},
+	}
+
+	chunks := pm.createBodyChunks(body, resource)
+	if len(chunks) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d", len(chunks))
+	}
+	if string(chunks[1].Chunk) != "part-two|" || chunks[1].TargetOffset != 1010*time.Millisecond {
+		t.Errorf("Unexpected second chunk %q at %v", chunks[1].Chunk, chunks[1].TargetOffset)
+	}
+
+	// Parts that no longer describe the content fall back to calculated timing
+	resource.Parts[1].Size = 5
+	if chunks := pm.createBodyChunks(body, resource); len(chunks) != 1 {
+		t.Errorf("Expected fallback to a single calculated chunk, got %d", len(chunks))
+	}
+}
+
+func TestPlaybackManager_HTMLFlushes(t *testing.T) {
+	pm := NewPlaybackManager(t.TempDir())
+	head := "<html><head><title>Flushed</title></head>"
+	document := head + "<body>" + strings.Repeat("<p>later</p>", 20) + "</body></html>"
+	gzipEncoding := types.ContentEncodingGzip
+	mime := "text/html"
+	resource := &types.Resource{
+		Method:          "GET",
+		URL:             "https://example.com/",
+		TTFBMS:          20,
+		ContentUTF8:     &document,
+		ContentEncoding: &gzipEncoding,
+		ContentTypeMime: &mime,
+		Flushes:         []types.FlushPoint{{OffsetMS: 20, Tags: 5}},
+	}
+
+	transaction, err := pm.convertResourceToTransaction(resource)
+	if err != nil {
+		t.Fatalf("Failed to convert resource: %v", err)
+	}
+	first := transaction.Chunks[0]
+	if first.TargetOffset != 20*time.Millisecond {
+		t.Errorf("Expected the flushed head at 20ms, got %v", first.TargetOffset)
+	}
+	if decoded := encoding.DecodePrefix(first.Chunk, gzipEncoding); string(decoded) != head {
+		t.Errorf("Expected the first chunk to decode to the head, got %q", decoded)
+	}
+	var body []byte
+	for _, chunk := range transaction.Chunks {
+		body = append(body, chunk.Chunk...)
+	}
+	if decoded, err := encoding.DecodeData(body, gzipEncoding); err != nil || string(decoded) != document {
+		t.Errorf("Expected the chunks to decode to the document, got %q (%v)", decoded, err)
+	}
+
+	// A document edited down past the flush is replayed as calculated
+	short := "<html></html>"
+	resource.ContentUTF8 = &short
+	if _, _, ok := flushSegments([]byte(short), resource, types.ContentEncodingIdentity); ok {
+		t.Error("Expected flushes beyond the document to be ignored")
+	}
+}
+
+func TestAddPreloadLinks(t *testing.T) {
+	headers := types.HttpHeaders{
+		"Link": "<https://example.com/app.css>; rel=preload; as=style",
+	}
+
+	addPreloadLinks(headers, []string{
+		"https://example.com/app.css",
+		"https://example.com/app.js?v=1",
+		"https://example.com/font.woff2",
+	})
+
+	expected := "<https://example.com/app.css>; rel=preload; as=style, " +
+		"<https://example.com/app.js?v=1>; rel=preload; as=script, " +
+		"<https://example.com/font.woff2>; rel=preload; as=font"
+	if headers["Link"] != expected {
+		t.Errorf("Unexpected Link header:\n got: %s\nwant: %s", headers["Link"], expected)
+	}
+
+	empty := types.HttpHeaders{}
+	addPreloadLinks(empty, []string{"https://example.com/data"})
+	if empty["Link"] != "<https://example.com/data>; rel=preload" {
+		t.Errorf("Unexpected Link header: %s", empty["Link"])
+	}
+}
+
+func TestAddEarlyHintLinks(t *testing.T) {
+	headers := types.HttpHeaders{"Link": "</app.css>; rel=preload; as=style"}
+
+	addEarlyHintLinks(headers, []types.Informational{
+		{StatusCode: 100},
+		{StatusCode: 103, RawHeaders: types.HttpHeaders{"link": "</app.css>; rel=preload; as=style"}},
+		{StatusCode: 103, RawHeaders: types.HttpHeaders{"Link": "</app.js>; rel=preload; as=script"}},
+	})
+
+	expected := "</app.css>; rel=preload; as=style, </app.js>; rel=preload; as=script"
+	if headers["Link"] != expected {
+		t.Errorf("Expected Link %q, got %q", expected, headers["Link"])
+	}
+}
+
+func TestPlaybackManager_SkipTruncated(t *testing.T) {
+	tempDir := t.TempDir()
+
+	truncated := true
+	inv := types.Inventory{
+		Resources: []types.Resource{
+			{Method: "GET", URL: "https://example.com/full", ContentUTF8: testutil.StringPtr("full")},
+			{Method: "GET", URL: "https://example.com/partial", ContentUTF8: testutil.StringPtr("par"), Truncated: &truncated},
+		},
+	}
+	data, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatalf("Failed to marshal inventory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "inventory.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write inventory: %v", err)
+	}
+
+	pm := NewPlaybackManager(tempDir)
+	transactions, err := pm.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load transactions: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Errorf("Expected truncated resource to be served by default, got %d transactions", len(transactions))
+	}
+
+	pm.SkipTruncated = true
+	transactions, err = pm.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load transactions: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].URL != "https://example.com/full" {
+		t.Errorf("Expected only the complete resource, got %d transactions", len(transactions))
+	}
+}
+
+func TestPersistenceManager_FormatContents(t *testing.T) {
+	tempDir := t.TempDir()
+
+	inv := types.Inventory{
+		Resources: []types.Resource{
+			{Method: "GET", URL: "https://example.com/style.css", ContentTypeMime: testutil.StringPtr("text/css"), ContentFilePath: testutil.StringPtr("style.css")},
+			{Method: "GET", URL: "https://example.com/logo.png", ContentTypeMime: testutil.StringPtr("image/png"), ContentFilePath: testutil.StringPtr("logo.png")},
+		},
+	}
+	data, err := json.Marshal(inv)
+	if err != nil {
+		t.Fatalf("Failed to marshal inventory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "inventory.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write inventory: %v", err)
+	}
+	contentsDir := filepath.Join(tempDir, "contents")
+	if err := os.MkdirAll(contentsDir, 0755); err != nil {
+		t.Fatalf("Failed to create contents directory: %v", err)
+	}
+	original := "body {\n  color: red;\n}\n"
+	cssPath := filepath.Join(contentsDir, "style.css")
+	if err := os.WriteFile(cssPath, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write content: %v", err)
+	}
+
+	pm := NewPersistenceManager(tempDir)
+
+	// Dry run reports the diff but leaves the file untouched
+	results, err := pm.FormatContents(FormatOptions{Mode: FormatMinify, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to format contents: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected only the CSS file to be processed, got %d results", len(results))
+	}
+	if !results[0].Changed || !strings.Contains(results[0].Diff, "-  color: red;") {
+		t.Errorf("Expected a diff for the minified CSS, got %+v", results[0])
+	}
+	if content, _ := os.ReadFile(cssPath); string(content) != original {
+		t.Error("Expected dry run not to modify the file")
+	}
+
+	// A real run rewrites the file in place
+	if _, err := pm.FormatContents(FormatOptions{Mode: FormatMinify}); err != nil {
+		t.Fatalf("Failed to format contents: %v", err)
+	}
+	content, _ := os.ReadFile(cssPath)
+	if string(content) != "body{color:red}" {
+		t.Errorf("Expected minified CSS, got %q", content)
+	}
+
+	if _, err := pm.FormatContents(FormatOptions{Mode: "pretty"}); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
+
+func TestPersistenceManager_SplitByDomainAndMerge(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	newTransaction := func(url, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		newTransaction("https://example.com/", "page"),
+		newTransaction("https://widget.example.net:8443/widget.txt", "widget"),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	dirs, err := pm.SaveRecordedTransactionsByDomain(transactions, "https://example.com/", false)
+	if err != nil {
+		t.Fatalf("Failed to save by domain: %v", err)
+	}
+	if len(dirs) != 2 {
+		t.Fatalf("Expected 2 domain inventories, got %d", len(dirs))
+	}
+	widgetDir := filepath.Join(tempDir, DomainsDir, "widget.example.net_8443")
+	widget, err := NewPersistenceManager(widgetDir).LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load widget inventory: %v", err)
+	}
+	if len(widget.Resources) != 1 || widget.Resources[0].URL != "https://widget.example.net:8443/widget.txt" {
+		t.Errorf("Expected only the widget resource, got %+v", widget.Resources)
+	}
+
+	// Merging the slices restores the full inventory with contents
+	mergedDir := filepath.Join(tempDir, "merged")
+	merged, err := NewPersistenceManager(mergedDir).MergeInventories(dirs)
+	if err != nil {
+		t.Fatalf("Failed to merge inventories: %v", err)
+	}
+	if len(merged.Resources) != 2 {
+		t.Errorf("Expected 2 merged resources, got %d", len(merged.Resources))
+	}
+
+	transactionsLoaded, err := NewPlaybackManager(mergedDir).LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load merged inventory: %v", err)
+	}
+	if len(transactionsLoaded) != 2 {
+		t.Errorf("Expected 2 playable transactions, got %d", len(transactionsLoaded))
+	}
+}
+
+// TestPersistenceManager_MergeVariants tests that merging keeps every variant recorded for a URL
+func TestPersistenceManager_MergeVariants(t *testing.T) {
+	tempDir := t.TempDir()
+	statusCode := 200
+	now := time.Now()
+	search := func(body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:            "POST",
+			URL:               "https://api.example.com/search",
+			RequestStarted:    now,
+			ResponseStarted:   now.Add(10 * time.Millisecond),
+			ResponseFinished:  now.Add(20 * time.Millisecond),
+			StatusCode:        &statusCode,
+			RawHeaders:        types.HttpHeaders{"Content-Type": "application/json"},
+			Body:              []byte(`["` + body + `"]`),
+			RequestHeaders:    types.HttpHeaders{"Content-Type": "application/json"},
+			RequestBody:       []byte(`{"q":"` + body + `"}`),
+			RequestBodySHA256: RequestBodyHash("application/json", []byte(`{"q":"`+body+`"}`)),
+		}
+	}
+	page := func(language, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              "https://example.com/",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/html", "Content-Language": language},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		page("en", "<html><body>hello</body></html>"),
+		page("ja", "<html><body>こんにちは</body></html>"),
+		search("shoes"),
+		search("hats"),
+	}
+	dirs, err := NewPersistenceManager(tempDir).SaveRecordedTransactionsByDomain(transactions, "https://example.com/", true)
+	if err != nil {
+		t.Fatalf("Failed to save by domain: %v", err)
+	}
+
+	// Merging a slice again replaces its resources instead of adding them twice
+	merged, err := NewPersistenceManager(filepath.Join(tempDir, "merged")).MergeInventories(append(dirs, dirs...))
+	if err != nil {
+		t.Fatalf("Failed to merge inventories: %v", err)
+	}
+	if len(merged.Resources) != 4 {
+		t.Fatalf("Expected the 2 language and 2 body variants, got %d resources", len(merged.Resources))
+	}
+	loaded, err := NewPlaybackManager(filepath.Join(tempDir, "merged")).LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load merged inventory: %v", err)
+	}
+	bodies := make(map[string]bool)
+	for _, transaction := range loaded {
+		var body []byte
+		for _, chunk := range transaction.Chunks {
+			body = append(body, chunk.Chunk...)
+		}
+		bodies[string(body)] = true
+	}
+	for _, expected := range []string{"<html><body>hello</body></html>", "<html><body>こんにちは</body></html>", `["shoes"]`, `["hats"]`} {
+		if !bodies[expected] {
+			t.Errorf("Expected %s to be playable after merging, got %v", expected, bodies)
+		}
+	}
+}
+
+func TestPersistenceManager_Checksums(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transactions := []types.RecordingTransaction{{
+		Method:           "GET",
+		URL:              "https://example.com/data.txt",
+		RequestStarted:   now,
+		ResponseStarted:  now.Add(10 * time.Millisecond),
+		ResponseFinished: now.Add(20 * time.Millisecond),
+		StatusCode:       &statusCode,
+		RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+		Body:             []byte("fixture"),
+	}}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactions(transactions, "https://example.com/"); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	results, err := pm.VerifyChecksums()
+	if err != nil {
+		t.Fatalf("Failed to verify checksums: %v", err)
+	}
+	if len(results) != 1 || !results[0].OK() {
+		t.Fatalf("Expected one matching checksum, got %+v", results)
+	}
+
+	// Edit the fixture behind the inventory's back
+	contentPath := filepath.Join(tempDir, "contents", results[0].Path)
+	if err := os.WriteFile(contentPath, []byte("tampered"), 0644); err != nil {
+		t.Fatalf("Failed to modify content: %v", err)
+	}
+	results, _ = pm.VerifyChecksums()
+	if results[0].OK() {
+		t.Error("Expected modified content to fail verification")
+	}
+
+	playback := NewPlaybackManager(tempDir)
+	playback.VerifyChecksums = true
+	loaded, err := playback.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load playback transactions: %v", err)
+	}
+	if len(loaded) != 1 || !loaded[0].ChecksumMismatch {
+		t.Errorf("Expected the playback transaction to be flagged, got %+v", loaded)
+	}
+
+	// Accepting the edit makes verification pass again
+	if updated, err := pm.UpdateChecksums(); err != nil || updated != 1 {
+		t.Fatalf("Expected 1 updated checksum, got %d (%v)", updated, err)
+	}
+	results, _ = pm.VerifyChecksums()
+	if !results[0].OK() {
+		t.Error("Expected checksum to match after update")
+	}
+}
+
+func TestPersistenceManager_NormalizeTiming(t *testing.T) {
+	tempDir := t.TempDir()
+
+	mbps := func(v float64) *float64 { return &v }
+	inv := types.Inventory{}
+	for i, ttfb := range []int64{100, 110, 120, 130, 140, 150, 160, 170, 180, 5000} {
+		speed := 10.0
+		if ttfb == 5000 {
+			speed = 0.1
+		}
+		inv.Resources = append(inv.Resources, types.Resource{
+			Method:          "GET",
+			URL:             "https://example.com/script" + strconv.Itoa(i) + ".js",
+			TTFBMS:          ttfb,
+			MBPS:            mbps(speed),
+			ContentTypeMime: testutil.StringPtr("application/javascript"),
+		})
+	}
+	inv.Resources = append(inv.Resources, types.Resource{
+		Method:          "GET",
+		URL:             "https://example.com/logo.png",
+		TTFBMS:          900,
+		MBPS:            mbps(1),
+		ContentTypeMime: testutil.StringPtr("image/png"),
+	})
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveInventory(&inv); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	changes, err := pm.NormalizeTiming(TimingOptions{
+		Percentile: 90,
+		TTFB:       map[string]int64{"image/*": 50},
+	})
+	if err != nil {
+		t.Fatalf("Failed to normalize timing: %v", err)
+	}
+	if len(changes) != 3 {
+		t.Errorf("Expected 3 changes, got %+v", changes)
+	}
+
+	normalized, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	outlier := normalized.Resources[9]
+	if outlier.TTFBMS != 900 {
+		t.Errorf("Expected outlier TTFB to be clamped to the domain p90 (900), got %d", outlier.TTFBMS)
+	}
+	if *outlier.MBPS != 1 {
+		t.Errorf("Expected outlier Mbps to be raised to the domain p10 (1), got %v", *outlier.MBPS)
+	}
+	if logo := normalized.Resources[10]; logo.TTFBMS != 50 {
+		t.Errorf("Expected explicit image TTFB of 50ms, got %d", logo.TTFBMS)
+	}
+}
+
+func TestPersistenceManager_SplitByClient(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	newTransaction := func(url, client string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+			Body:             []byte(url),
+			ClientID:         client,
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		newTransaction("https://example.com/", "alice"),
+		newTransaction("https://example.com/", "::1"),
+		newTransaction("https://example.com/alice.txt", "alice"),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactions(transactions, "https://example.com/"); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	dirs, err := pm.SplitByClient()
+	if err != nil {
+		t.Fatalf("Failed to split by client: %v", err)
+	}
+	if len(dirs) != 2 {
+		t.Fatalf("Expected 2 client inventories, got %v", dirs)
+	}
+
+	alice, err := NewPersistenceManager(filepath.Join(tempDir, ClientsDir, "alice")).LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load alice inventory: %v", err)
+	}
+	if len(alice.Resources) != 2 {
+		t.Errorf("Expected 2 resources for alice, got %d", len(alice.Resources))
+	}
+	local, err := NewPersistenceManager(filepath.Join(tempDir, ClientsDir, "__1")).LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load ::1 inventory: %v", err)
+	}
+	if len(local.Resources) != 1 {
+		t.Errorf("Expected 1 resource for ::1, got %d", len(local.Resources))
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, ClientsDir, "__1", "contents", *local.Resources[0].ContentFilePath)); err != nil {
+		t.Errorf("Expected content file to be copied: %v", err)
+	}
+}
+
+func TestPersistenceManager_RecordingSummary(t *testing.T) {
+	tempDir := t.TempDir()
+
+	ok, notFound := 200, 404
+	now := time.Now()
+	newTransaction := func(url string, status *int, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       status,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/css"},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		newTransaction("https://example.com/style.css", &ok, "a{color:red}"),
+		newTransaction("https://example.com/style.css", &ok, "a{color:red}"),
+		newTransaction("https://cdn.example.net/missing.css", &notFound, ""),
+	}
+
+	summary := NewRecordingSummary(transactions, "https://example.com/", now.Add(-time.Minute))
+	pm := NewPersistenceManager(tempDir)
+	pm.Summary = summary
+	if err := pm.SaveRecordedTransactions(transactions, "https://example.com/"); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	if err := pm.WriteSummary(summary); err != nil {
+		t.Fatalf("Failed to write summary: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, SummaryFile))
+	if err != nil {
+		t.Fatalf("Failed to read summary: %v", err)
+	}
+	var written RecordingSummary
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Failed to parse summary: %v", err)
+	}
+
+	if written.Requests != 3 || written.Resources != 2 || written.Duplicates != 1 || written.Failures != 1 {
+		t.Errorf("Unexpected counts: %+v", written)
+	}
+	if written.Domains["example.com"] != 2 || written.Domains["cdn.example.net"] != 1 {
+		t.Errorf("Unexpected domain counts: %v", written.Domains)
+	}
+	if written.Beautified < 1 {
+		t.Errorf("Expected the stylesheet to be beautified, got %d", written.Beautified)
+	}
+	if written.ElapsedMS < 60000 {
+		t.Errorf("Expected elapsed time of at least a minute, got %dms", written.ElapsedMS)
+	}
+}
+
+func TestPadToWireSize(t *testing.T) {
+	html := []byte(strings.Repeat("<p>hello</p>", 100))
+	compressed, err := encoding.EncodeData(html, types.ContentEncodingGzip, 6)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	wireSize := func(n int) *int64 {
+		size := int64(n)
+		return &size
+	}
+	mime := "text/html"
+
+	// gzip is padded in its header, whatever the content
+	gzipResource := &types.Resource{URL: "https://example.com/", WireSize: wireSize(len(compressed) + 40)}
+	padded := padToWireSize(compressed, gzipResource, types.ContentEncodingGzip)
+	if int64(len(padded)) != *gzipResource.WireSize {
+		t.Errorf("Expected gzip body of %d bytes, got %d", *gzipResource.WireSize, len(padded))
+	}
+	decoded, err := encoding.DecodeData(padded, types.ContentEncodingGzip)
+	if err != nil || string(decoded) != string(html) {
+		t.Errorf("Padded gzip body does not decode to the content: %v", err)
+	}
+
+	// Text is padded with a trailing comment
+	htmlResource := &types.Resource{URL: "https://example.com/", ContentTypeMime: &mime, WireSize: wireSize(len(html) + 20)}
+	padded = padToWireSize(html, htmlResource, types.ContentEncodingIdentity)
+	if int64(len(padded)) != *htmlResource.WireSize || !strings.HasSuffix(string(padded), "-->") {
+		t.Errorf("Expected HTML padded with a comment to %d bytes, got %q", *htmlResource.WireSize, padded[len(html):])
+	}
+
+	// Other bodies are left as they are
+	image := []byte{0x89, 'P', 'N', 'G'}
+	imageResource := &types.Resource{URL: "https://example.com/a.png", WireSize: wireSize(100)}
+	if padded := padToWireSize(image, imageResource, types.ContentEncodingIdentity); len(padded) != len(image) {
+		t.Errorf("Expected binary body to be left as is, got %d bytes", len(padded))
+	}
+
+	// Bodies are never shrunk
+	if padded := padToWireSize(html, &types.Resource{ContentTypeMime: &mime, WireSize: wireSize(10)}, types.ContentEncodingIdentity); len(padded) != len(html) {
+		t.Errorf("Expected larger body to be left as is, got %d bytes", len(padded))
+	}
+}
+
+func TestPersistenceManager_RewriteURLs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(url, contentType, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": contentType},
+			Body:             []byte(body),
+		}
+	}
+	page := `<link href="https://old.cdn.com/app.css"><img src="//old.cdn.com/logo.png"><a href="https://old.cdn.com.example/">`
+	transactions := []types.RecordingTransaction{
+		transaction("https://example.com/", "text/html", page),
+		transaction("https://old.cdn.com/app.css", "text/css", "body { background: url(https://old.cdn.com/bg.png) }"),
+		transaction("https://old.cdn.com.example/", "text/plain", "unrelated"),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	opts := RewriteOptions{From: "https://old.cdn.com", To: "https://new.cdn.com", DryRun: true}
+
+	// Dry run reports without touching anything
+	report, err := pm.RewriteURLs(opts)
+	if err != nil {
+		t.Fatalf("Failed to plan rewrite: %v", err)
+	}
+	if len(report.Resources) != 1 || report.Resources[0].AfterPath != "get/https/new.cdn.com/app.css" {
+		t.Fatalf("Expected app.css to move, got %+v", report.Resources)
+	}
+	if len(report.Contents) != 2 {
+		t.Fatalf("Expected references in the page and the stylesheet, got %+v", report.Contents)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "contents", "get/https/old.cdn.com/app.css")); err != nil {
+		t.Fatalf("Dry run moved the content file: %v", err)
+	}
+
+	opts.DryRun = false
+	if _, err := pm.RewriteURLs(opts); err != nil {
+		t.Fatalf("Failed to rewrite: %v", err)
+	}
+
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	urls := make(map[string]*types.Resource)
+	for i := range inv.Resources {
+		urls[inv.Resources[i].URL] = &inv.Resources[i]
+	}
+	css := urls["https://new.cdn.com/app.css"]
+	if css == nil || urls["https://old.cdn.com.example/"] == nil {
+		t.Fatalf("Expected app.css on the new origin and the look-alike host untouched, got %v", urls)
+	}
+	content, err := pm.ReadContent(css)
+	if err != nil || !strings.Contains(string(content), "url(https://new.cdn.com/bg.png)") {
+		t.Errorf("Expected the stylesheet reference to be rewritten, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "contents", "get/https/old.cdn.com")); !os.IsNotExist(err) {
+		t.Errorf("Expected the emptied content directory to be removed")
+	}
+
+	html, _ := pm.ReadContent(urls["https://example.com/"])
+	expected := `<link href="https://new.cdn.com/app.css"><img src="//new.cdn.com/logo.png"><a href="https://old.cdn.com.example/">`
+	if string(html) != expected {
+		t.Errorf("Expected page %q, got %q", expected, html)
+	}
+
+	// Rewritten files keep valid checksums
+	results, err := pm.VerifyChecksums()
+	if err != nil {
+		t.Fatalf("Failed to verify checksums: %v", err)
+	}
+	for _, result := range results {
+		if !result.OK() {
+			t.Errorf("Checksum of %s no longer matches", result.Path)
+		}
+	}
+}
+
+// TestPersistenceManager_RewriteURLsRollback tests that a failed rewrite restores the files it already changed
+// TestPersistenceManager_RewriteURLsBodyVariants tests that responses recorded for other request
+// bodies of a URL are not taken for conflicting resources
+func TestPersistenceManager_RewriteURLsBodyVariants(t *testing.T) {
+	tempDir := t.TempDir()
+	statusCode := 200
+	now := time.Now()
+	search := func(body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:            "POST",
+			URL:               "https://api.example.com/search",
+			RequestStarted:    now,
+			ResponseStarted:   now.Add(10 * time.Millisecond),
+			ResponseFinished:  now.Add(20 * time.Millisecond),
+			StatusCode:        &statusCode,
+			RawHeaders:        types.HttpHeaders{"Content-Type": "application/json"},
+			Body:              []byte(`[]`),
+			RequestHeaders:    types.HttpHeaders{"Content-Type": "application/json"},
+			RequestBody:       []byte(body),
+			RequestBodySHA256: RequestBodyHash("application/json", []byte(body)),
+		}
+	}
+	pm := NewPersistenceManager(tempDir)
+	transactions := []types.RecordingTransaction{search(`{"q":"shoes"}`), search(`{"q":"hats"}`)}
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://api.example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	report, err := pm.RewriteURLs(RewriteOptions{From: "https://cdn.example.com", To: "https://static.example.com", DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected an unrelated rewrite to succeed, got %v", err)
+	}
+	if len(report.Resources) != 0 {
+		t.Errorf("Expected nothing to be rewritten, got %+v", report.Resources)
+	}
+
+	if _, err := pm.RewriteURLs(RewriteOptions{From: "https://api.example.com", To: "https://api.example.net"}); err != nil {
+		t.Fatalf("Failed to rewrite the body variants: %v", err)
+	}
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	if len(inventory.Resources) != 2 {
+		t.Fatalf("Expected both body variants to be kept, got %d resources", len(inventory.Resources))
+	}
+	for _, resource := range inventory.Resources {
+		if resource.URL != "https://api.example.net/search" {
+			t.Errorf("Expected the variant to move to the new origin, got %s", resource.URL)
+		}
+	}
+}
+
+func TestPersistenceManager_RewriteURLsRollback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(url, contentType, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": contentType},
+			Body:             []byte(body),
+		}
+	}
+	page := `<link href="https://old.cdn.com/app.css">`
+	transactions := []types.RecordingTransaction{
+		transaction("https://example.com/", "text/html", page),
+		transaction("https://old.cdn.com/app.css", "text/css", "body {}"),
+	}
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	before, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if err != nil {
+		t.Fatalf("Failed to read inventory: %v", err)
+	}
+
+	// A file where the new origin's directory belongs makes moving app.css fail after the page was rewritten
+	if err := os.WriteFile(filepath.Join(tempDir, "contents", "get", "https", "new.cdn.com"), nil, 0644); err != nil {
+		t.Fatalf("Failed to block the content directory: %v", err)
+	}
+	if _, err := pm.RewriteURLs(RewriteOptions{From: "https://old.cdn.com", To: "https://new.cdn.com"}); err == nil {
+		t.Fatal("Expected the rewrite to fail")
+	}
+
+	after, _ := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if string(after) != string(before) {
+		t.Error("Expected inventory.json to be left untouched")
+	}
+	html, err := os.ReadFile(filepath.Join(tempDir, "contents", "get", "https", "example.com", "index.html"))
+	if err != nil || string(html) != page {
+		t.Errorf("Expected the page to be restored, got %q (%v)", html, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "contents", "get", "https", "old.cdn.com", "app.css")); err != nil {
+		t.Errorf("Expected app.css to stay in place: %v", err)
+	}
+	results, _ := pm.VerifyChecksums()
+	for _, result := range results {
+		if !result.OK() {
+			t.Errorf("Checksum of %s no longer matches", result.Path)
+		}
+	}
+}
+
+// TestPersistenceManager_ImageVariants tests that every format of an image negotiated by Accept is kept
+func TestPersistenceManager_ImageVariants(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(accept, contentType string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              "https://old.cdn.com/logo.png",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": contentType},
+			Body:             []byte(contentType),
+			Accept:           accept,
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		transaction("*/*", "image/png"),
+		transaction("image/webp,*/*", "image/webp"),
+		transaction("image/webp,*/*", "image/webp"),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	paths := make(map[string]string)
+	for _, res := range inv.Resources {
+		if res.Accept == nil {
+			t.Errorf("Expected the Accept header to be recorded for %s", *res.ContentTypeMime)
+		}
+		paths[*res.ContentTypeMime] = *res.ContentFilePath
+	}
+	if len(inv.Resources) != 2 || paths["image/png"] != "get/https/old.cdn.com/logo.png" || paths["image/webp"] != "variants/image/webp/get/https/old.cdn.com/logo.png" {
+		t.Fatalf("Expected the PNG and a WebP variant, got %v", paths)
+	}
+
+	// Variants move with the URL they were recorded for
+	if _, err := pm.RewriteURLs(RewriteOptions{From: "https://old.cdn.com", To: "https://new.cdn.com"}); err != nil {
+		t.Fatalf("Failed to rewrite: %v", err)
+	}
+	inv, _ = pm.LoadInventory()
+	for _, res := range inv.Resources {
+		content, err := pm.ReadContent(&res)
+		if err != nil || string(content) != *res.ContentTypeMime {
+			t.Errorf("Expected the %s content after rewriting, got %q (%v)", *res.ContentTypeMime, content, err)
+		}
+		if *res.ContentTypeMime == "image/webp" && *res.ContentFilePath != "variants/image/webp/get/https/new.cdn.com/logo.png" {
+			t.Errorf("Expected the variant to move under variants/, got %s", *res.ContentFilePath)
+		}
+	}
+}
+
+// TestPersistenceManager_KeepsMetadata tests that metadata added to an inventory survives recording it again
+func TestPersistenceManager_KeepsMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	statusCode := 200
+	now := time.Now()
+	transactions := []types.RecordingTransaction{{
+		Method:           "GET",
+		URL:              "https://example.com/",
+		RequestStarted:   now,
+		ResponseStarted:  now.Add(10 * time.Millisecond),
+		ResponseFinished: now.Add(20 * time.Millisecond),
+		StatusCode:       &statusCode,
+		RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+		Body:             []byte("hello"),
+		Metadata:         map[string]string{"owner": "web"},
+	}}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	// An external pipeline annotates the inventory
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	inv.Resources[0].Metadata["ticket"] = "WEB-123"
+	inv.Resources[0].Metadata["owner"] = "platform"
+	if err := pm.SaveInventory(inv); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions again: %v", err)
+	}
+	inv, _ = pm.LoadInventory()
+	if metadata := inv.Resources[0].Metadata; metadata["ticket"] != "WEB-123" || metadata["owner"] != "web" {
+		t.Errorf("Expected the annotation to be kept and the recorded key to win, got %v", metadata)
+	}
+
+	playback, err := NewPlaybackManager(tempDir).LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load playback transactions: %v", err)
+	}
+	if playback[0].Metadata["ticket"] != "WEB-123" {
+		t.Errorf("Expected metadata on the playback transaction, got %v", playback[0].Metadata)
+	}
+}
+
+func TestPersistenceManager_BackgroundBeautify(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(url, contentType, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": contentType},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		transaction("https://example.com/app.js", "application/javascript", "function a(){return 1}"),
+		transaction("https://example.com/style.css", "text/css", "body{color:red}"),
+		transaction("https://example.com/data.txt", "text/plain", "fixture"),
+	}
+
+	queue := NewBeautifyQueue(2)
+	pm := NewPersistenceManager(tempDir)
+	pm.Beautifier = queue
+	if err := pm.SaveRecordedTransactions(transactions, "https://example.com/"); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	queue.Wait()
+
+	if queue.Beautified() != 2 {
+		t.Errorf("Expected 2 beautified files, got %d", queue.Beautified())
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, "contents", "get", "https", "example.com", "style.css"))
+	if err != nil {
+		t.Fatalf("Failed to read content: %v", err)
+	}
+	if !strings.Contains(string(data), "\n") {
+		t.Errorf("Expected beautified CSS, got %q", data)
+	}
+
+	// The inventory is updated once the files are rewritten
+	results, err := pm.VerifyChecksums()
+	if err != nil {
+		t.Fatalf("Failed to verify checksums: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 checksums, got %+v", results)
+	}
+	for _, result := range results {
+		if !result.OK() {
+			t.Errorf("Expected a matching checksum for %s", result.Path)
+		}
+	}
+}
+
+// TestPersistenceManager_LocalizeOriginals tests that a localized inventory keeps the content as
+// received of untranslated normalized files, and replays the translation of translated ones
+func TestPersistenceManager_LocalizeOriginals(t *testing.T) {
+	tempDir := t.TempDir()
+	statusCode := 200
+	now := time.Now()
+	transaction := func(url, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "application/json"},
+			Body:             []byte(body),
+		}
+	}
+	pm := NewPersistenceManager(tempDir)
+	pm.NormalizeJSON = true
+	pm.KeepOriginals = true
+	transactions := []types.RecordingTransaction{
+		transaction("https://example.com/translated", `{"name":"Widget","id":1}`),
+		transaction("https://example.com/kept", `{"name":"Gadget","id":2}`),
+	}
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	outputDir := filepath.Join(tempDir, "de")
+	translations := []TextEntry{{Method: "GET", URL: "https://example.com/translated", Key: "/name", Text: "Widget", Translation: "Dings"}}
+	if _, err := pm.Localize(outputDir, translations); err != nil {
+		t.Fatalf("Failed to localize: %v", err)
+	}
+	inventory, err := NewPersistenceManager(outputDir).LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load localized inventory: %v", err)
+	}
+	for _, resource := range inventory.Resources {
+		switch resource.URL {
+		case "https://example.com/kept":
+			if resource.OriginalFilePath == nil {
+				t.Fatal("Expected the untranslated resource to keep its original")
+			}
+			original, err := os.ReadFile(OriginalFile(outputDir, *resource.OriginalFilePath))
+			if err != nil || string(original) != `{"name":"Gadget","id":2}` {
+				t.Errorf("Expected the original to be copied, got %q (%v)", original, err)
+			}
+		case "https://example.com/translated":
+			if resource.OriginalFilePath != nil {
+				t.Errorf("Expected the translated resource to drop its untranslated original, got %s", *resource.OriginalFilePath)
+			}
+			if _, err := os.Stat(OriginalFile(outputDir, *resource.ContentFilePath)); !os.IsNotExist(err) {
+				t.Errorf("Expected no original for the translated resource, got %v", err)
+			}
+		}
+	}
+}
+
+func TestPersistenceManager_Localize(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(url, contentType, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": contentType},
+			Body:             []byte(body),
+		}
+	}
+	page := `<html><head><title>Our Product</title><script>var label = "Buy";</script></head>` +
+		`<body><img src="/a.png" alt="A photo"><p> Fast &amp; cheap </p><!-- Not text --></body></html>`
+	api := `{"name": "Widget", "image": "https://example.com/a.png", "tags": [{"label": "New"}, "Sale"]}`
+	transactions := []types.RecordingTransaction{
+		transaction("https://example.com/", "text/html", page),
+		transaction("https://example.com/api", "application/json", api),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	entries, err := pm.ExtractTexts()
+	if err != nil {
+		t.Fatalf("Failed to extract texts: %v", err)
+	}
+	var keys []string
+	byKey := make(map[string]*TextEntry)
+	for i, entry := range entries {
+		keys = append(keys, entry.Key+"="+entry.Text)
+		byKey[entry.Key] = &entries[i]
+	}
+	sort.Strings(keys)
+	expected := []string{"/name=Widget", "/tags/0/label=New", "/tags/1=Sale", "alt:1=A photo", "text:1=Our Product", "text:2=Fast & cheap"}
+	if strings.Join(keys, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected texts %v, got %v", expected, keys)
+	}
+
+	// Texts round-trip through CSV; stale and untranslated rows are not applied
+	byKey["text:1"].Translation = "Unser Produkt"
+	byKey["text:2"].Translation = "Schnell & günstig"
+	byKey["/tags/0/label"].Translation = "Neu \"heute\""
+	byKey["/tags/1"].Text = "Clearance"
+	byKey["/tags/1"].Translation = "Ausverkauf"
+	var csvData strings.Builder
+	if err := WriteTextsCSV(&csvData, entries); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	translations, err := ReadTranslationsCSV(strings.NewReader(csvData.String()))
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(translations) != 4 {
+		t.Fatalf("Expected 4 translated rows, got %d", len(translations))
+	}
+
+	outputDir := filepath.Join(tempDir, "de")
+	report, err := pm.Localize(outputDir, translations)
+	if err != nil {
+		t.Fatalf("Failed to localize: %v", err)
+	}
+	if report.Resources != 2 || report.Translated != 3 || len(report.Stale) != 1 || report.Stale[0].Key != "/tags/1" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	localized := NewPersistenceManager(outputDir)
+	inventory, err := localized.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load localized inventory: %v", err)
+	}
+	pageResource, apiResource := &inventory.Resources[0], &inventory.Resources[1]
+	if pageResource.URL != "https://example.com/" {
+		pageResource, apiResource = apiResource, pageResource
+	}
+	html, _ := localized.ReadContent(pageResource)
+	if !strings.Contains(string(html), "<title>Unser Produkt</title>") || !strings.Contains(string(html), "<p> Schnell &amp; günstig </p>") ||
+		!strings.Contains(string(html), `var label = "Buy";`) {
+		t.Errorf("Unexpected localized page: %s", html)
+	}
+	data, _ := localized.ReadContent(apiResource)
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Localized JSON is invalid: %v\n%s", err, data)
+	}
+	if label := decoded["tags"].([]any)[0].(map[string]any)["label"]; label != `Neu "heute"` {
+		t.Errorf("Expected the translated label, got %v", label)
+	}
+
+	// The source inventory is left untouched
+	if original, _ := os.ReadFile(filepath.Join(tempDir, "contents", *pageResource.ContentFilePath)); !strings.Contains(string(original), "Our Product") {
+		t.Error("Expected the source inventory to keep its texts")
+	}
+}
+
+func TestPersistenceManager_AtomicWrites(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transactions := []types.RecordingTransaction{{
+		Method:           "GET",
+		URL:              "https://example.com/app.css",
+		RequestStarted:   now,
+		ResponseStarted:  now.Add(10 * time.Millisecond),
+		ResponseFinished: now.Add(20 * time.Millisecond),
+		StatusCode:       &statusCode,
+		RawHeaders:       types.HttpHeaders{"Content-Type": "text/css"},
+		Body:             []byte("body { color: red }"),
+	}}
+
+	for _, policy := range []SyncPolicy{SyncNone, SyncInventory, SyncAll} {
+		pm := NewPersistenceManager(filepath.Join(tempDir, string(policy)))
+		pm.Sync = policy
+		if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+			t.Fatalf("Failed to save with %s: %v", policy, err)
+		}
+		data, err := os.ReadFile(filepath.Join(pm.BaseDir, "contents", "get/https/example.com/app.css"))
+		if err != nil || string(data) != "body { color: red }" {
+			t.Errorf("Unexpected content with %s: %q (%v)", policy, data, err)
+		}
+		orphans, err := pm.FindOrphanedTempFiles()
+		if err != nil || len(orphans) != 0 {
+			t.Errorf("Expected no temporary files with %s, got %v (%v)", policy, orphans, err)
+		}
+	}
+
+	// A write interrupted before its rename leaves a hidden temporary file next to the target
+	pm := NewPersistenceManager(filepath.Join(tempDir, string(SyncAll)))
+	orphan := filepath.Join(pm.BaseDir, "contents", "get/https/example.com/.app.css.123456"+tempSuffix)
+	if err := os.WriteFile(orphan, []byte("body {"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	orphans, err := pm.FindOrphanedTempFiles()
+	if err != nil || len(orphans) != 1 || orphans[0] != "contents/get/https/example.com/.app.css.123456.tmp" {
+		t.Errorf("Expected the orphaned file, got %v (%v)", orphans, err)
+	}
+	if orphans, err := NewPersistenceManager(filepath.Join(tempDir, "missing")).FindOrphanedTempFiles(); err != nil || len(orphans) != 0 {
+		t.Errorf("Expected a missing inventory to have no temporary files, got %v (%v)", orphans, err)
+	}
+
+	if _, err := ParseSyncPolicy("sometimes"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+	if policy, _ := ParseSyncPolicy(""); policy != SyncInventory {
+		t.Errorf("Expected the default policy to be %s, got %s", SyncInventory, policy)
+	}
+}
+
+func TestInventorySchema_SharedHeaders(t *testing.T) {
+	csp := "default-src 'self'; script-src 'self' https://cdn.example.com; style-src 'self' 'unsafe-inline'"
+	inventory := &types.Inventory{Resources: []types.Resource{
+		{Method: "GET", URL: "https://example.com/", RawHeaders: types.HttpHeaders{"Content-Security-Policy": csp, "Content-Type": "text/html"}},
+		{Method: "GET", URL: "https://example.com/app.js", RawHeaders: types.HttpHeaders{"Content-Security-Policy": csp, "Content-Type": "text/javascript"}},
+		{Method: "GET", URL: "https://example.com/once", RawHeaders: types.HttpHeaders{"Link": strings.Repeat("x", 100)}},
+	}}
+
+	data, err := EncodeInventory(inventory)
+	if err != nil {
+		t.Fatalf("Failed to encode inventory: %v", err)
+	}
+	if strings.Count(string(data), "script-src") != 1 || !strings.Contains(string(data), `"schemaVersion": 2`) {
+		t.Errorf("Expected the policy to be stored once in a version 2 inventory:\n%s", data)
+	}
+	if inventory.Resources[0].SharedHeaders != nil || inventory.Resources[0].RawHeaders["Content-Security-Policy"] != csp {
+		t.Error("Expected encoding to leave the inventory unchanged")
+	}
+
+	decoded, err := DecodeInventory(data)
+	if err != nil {
+		t.Fatalf("Failed to decode inventory: %v", err)
+	}
+	for i, resource := range decoded.Resources {
+		if len(resource.RawHeaders) != len(inventory.Resources[i].RawHeaders) || resource.SharedHeaders != nil {
+			t.Errorf("Resource %s headers not restored: %v", resource.URL, resource.RawHeaders)
+		}
+		for name, value := range inventory.Resources[i].RawHeaders {
+			if resource.RawHeaders[name] != value {
+				t.Errorf("Resource %s header %s = %q, want %q", resource.URL, name, resource.RawHeaders[name], value)
+			}
+		}
+	}
+
+	// Inventories without shared headers stay in version 1 for older readers
+	data, _ = EncodeInventory(&types.Inventory{Resources: inventory.Resources[2:]})
+	if strings.Contains(string(data), "schemaVersion") {
+		t.Errorf("Expected a version 1 inventory:\n%s", data)
+	}
+
+	if _, err := DecodeInventory([]byte(`{"schemaVersion": 3, "resources": []}`)); err == nil {
+		t.Error("Expected a newer schema version to be rejected")
+	}
+	if _, err := DecodeInventory([]byte(`{"schemaVersion": 2, "resources": [{"method": "GET", "url": "/", "ttfbMs": 0, "sharedHeaders": [1]}], "headers": []}`)); err == nil {
+		t.Error("Expected a dangling header reference to be rejected")
+	}
+}
+
+func TestPersistenceManager_ExportHAR(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transactions := []types.RecordingTransaction{
+		{
+			Method:           "GET",
+			URL:              "https://example.com/",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(40 * time.Millisecond),
+			ResponseFinished: now.Add(60 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/html; charset=utf-8"},
+			Body:             []byte("<html><body>Hello</body></html>"),
+		},
+		{
+			Method:           "GET",
+			URL:              "https://example.com/logo.png?v=2&size=large",
+			RequestStarted:   now.Add(100 * time.Millisecond),
+			ResponseStarted:  now.Add(110 * time.Millisecond),
+			ResponseFinished: now.Add(130 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "image/png"},
+			Body:             []byte{0x89, 'P', 'N', 'G', 0xff, 0xfe},
+		},
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	archive, err := pm.ExportHAR()
+	if err != nil {
+		t.Fatalf("Failed to export HAR: %v", err)
+	}
+	if archive.Log.Version != "1.2" || len(archive.Log.Pages) != 1 || archive.Log.Pages[0].Title != "https://example.com/" {
+		t.Fatalf("Unexpected log header: %+v", archive.Log)
+	}
+	if len(archive.Log.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(archive.Log.Entries))
+	}
+
+	// Entries are ordered by start time
+	page, image := archive.Log.Entries[0], archive.Log.Entries[1]
+	if page.Request.URL != "https://example.com/" {
+		t.Fatalf("Expected the page first, got %s", page.Request.URL)
+	}
+	if page.Response.Status != 200 || page.Response.StatusText != "OK" {
+		t.Errorf("Unexpected status: %d %s", page.Response.Status, page.Response.StatusText)
+	}
+	if page.Response.Content.Text != "<html><body>Hello</body></html>" || page.Response.Content.Encoding != "" {
+		t.Errorf("Unexpected page content: %+v", page.Response.Content)
+	}
+	if page.Response.Content.MimeType != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected mime type: %s", page.Response.Content.MimeType)
+	}
+	if page.Timings.Wait != 40 || page.Timings.Receive <= 0 {
+		t.Errorf("Expected wait 40ms and a receive time, got %+v", page.Timings)
+	}
+	if page.Time != page.Timings.Total() {
+		t.Errorf("Expected time %v to be the sum of the timings, got %v", page.Timings.Total(), page.Time)
+	}
+
+	// Binary bodies are base64 encoded and the query string is split
+	if image.Response.Content.Encoding != "base64" || image.Response.Content.Text != "iVBOR//+" {
+		t.Errorf("Unexpected image content: %+v", image.Response.Content)
+	}
+	if len(image.Request.QueryString) != 2 || image.Request.QueryString[1].Name != "size" || image.Request.QueryString[1].Value != "large" {
+		t.Errorf("Unexpected query string: %+v", image.Request.QueryString)
+	}
+}
+
+func TestTransactionsFromHAR(t *testing.T) {
+	css := "body { color: red; }"
+	archive := &har.HAR{Log: har.Log{
+		Version: har.Version,
+		Pages:   []har.Page{{ID: "page_1", Title: "Example"}},
+		Entries: []har.Entry{
+			{
+				Pageref:         "page_1",
+				StartedDateTime: "2024-05-01T10:00:00.000Z",
+				Request: har.Request{
+					Method:  "GET",
+					URL:     "https://example.com/style.css",
+					Headers: []har.NameValuePair{{Name: "sec-fetch-dest", Value: "style"}},
+				},
+				Response: har.Response{
+					Status: 200,
+					Headers: []har.NameValuePair{
+						{Name: ":status", Value: "200"},
+						{Name: "content-type", Value: "text/css"},
+						{Name: "content-encoding", Value: "gzip"},
+					},
+					Content: har.Content{Size: int64(len(css)), MimeType: "text/css", Text: css},
+				},
+				Timings: har.Timings{Blocked: 5, DNS: 10, Connect: 20, SSL: 15, Send: 1, Wait: 30, Receive: 40},
+			},
+			{
+				Pageref:         "page_1",
+				StartedDateTime: "2024-05-01T10:00:00.100Z",
+				Request:         har.Request{Method: "GET", URL: "https://example.com/pixel.gif"},
+				Response: har.Response{
+					Status:  200,
+					Headers: []har.NameValuePair{{Name: "Content-Type", Value: "image/gif"}},
+					Content: har.Content{MimeType: "image/gif", Text: "R0lGODlh", Encoding: "base64"},
+				},
+				Timings: har.Timings{Wait: 10},
+			},
+			{
+				StartedDateTime: "2024-05-01T10:00:00.200Z",
+				Request:         har.Request{Method: "GET", URL: "data:image/png;base64,AAAA"},
+			},
+			{
+				StartedDateTime: "2024-05-01T10:00:00.300Z",
+				Request:         har.Request{Method: "GET", URL: "https://example.com/blocked.js"},
+				Response:        har.Response{Error: "net::ERR_BLOCKED_BY_CLIENT"},
+			},
+		},
+	}}
+
+	imported, err := TransactionsFromHAR(archive)
+	if err != nil {
+		t.Fatalf("Failed to convert HAR: %v", err)
+	}
+	if len(imported.Transactions) != 3 || imported.Skipped != 1 {
+		t.Fatalf("Expected 3 transactions and 1 skipped, got %d and %d", len(imported.Transactions), imported.Skipped)
+	}
+	if imported.EntryURL != "https://example.com/style.css" {
+		t.Errorf("Unexpected entry URL: %s", imported.EntryURL)
+	}
+	if message := imported.Transactions[2].ErrorMessage; message == nil || *message != "net::ERR_BLOCKED_BY_CLIENT" {
+		t.Errorf("Expected the error to be kept, got %v", message)
+	}
+
+	tempDir := t.TempDir()
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(imported.Transactions, imported.EntryURL, true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+
+	resources := make(map[string]*types.Resource)
+	for i := range inventory.Resources {
+		resources[inventory.Resources[i].URL] = &inventory.Resources[i]
+	}
+
+	// The TTFB leaves out queueing in the browser and connection setup
+	style := resources["https://example.com/style.css"]
+	expectedPhases := types.Timings{DNSMS: 10, ConnectMS: 5, TLSMS: 15, SendMS: 1, WaitMS: 30, ReceiveMS: 40}
+	if style.Timings == nil || *style.Timings != expectedPhases {
+		t.Errorf("Expected the HAR phases with the handshake out of connect, got %+v", style.Timings)
+	}
+	if style.TTFBMS != 31 {
+		t.Errorf("Expected TTFB 31ms, got %d", style.TTFBMS)
+	}
+	if style.MBPS == nil || *style.MBPS <= 0 {
+		t.Errorf("Expected a transfer speed, got %v", style.MBPS)
+	}
+	if style.ContentEncoding == nil || *style.ContentEncoding != types.ContentEncodingGzip {
+		t.Errorf("Expected gzip content encoding, got %v", style.ContentEncoding)
+	}
+	if _, ok := style.RawHeaders[":status"]; ok {
+		t.Errorf("Pseudo-headers should be dropped: %v", style.RawHeaders)
+	}
+	if style.Fetch == nil || style.Fetch.Dest != "style" {
+		t.Errorf("Expected fetch metadata, got %+v", style.Fetch)
+	}
+	body, err := pm.ReadContent(style)
+	if err != nil || string(body) != css {
+		t.Errorf("Expected the decoded CSS, got %q (%v)", body, err)
+	}
+
+	pixel := resources["https://example.com/pixel.gif"]
+	body, err = pm.ReadContent(pixel)
+	if err != nil || string(body) != "GIF89a" {
+		t.Errorf("Expected the decoded GIF, got %q (%v)", body, err)
+	}
+}
+
+// TestTransactionsFromHAR_Pushes tests that responses Chrome marked as pushed are listed in the
+// pushes of their initiator
+func TestTransactionsFromHAR_Pushes(t *testing.T) {
+	entry := func(url string, pushed bool, initiator string) har.Entry {
+		e := har.Entry{
+			Pageref:         "page_1",
+			StartedDateTime: "2024-05-01T10:00:00.000Z",
+			Request:         har.Request{Method: "GET", URL: url},
+			Response:        har.Response{Status: 200, Content: har.Content{MimeType: "text/plain", Text: "x"}},
+		}
+		if pushed {
+			e.WasPushed = 1
+		}
+		if initiator != "" {
+			e.Initiator = &har.Initiator{Type: "parser", URL: initiator}
+		}
+		return e
+	}
+	archive := &har.HAR{Log: har.Log{
+		Version: har.Version,
+		Pages:   []har.Page{{ID: "page_1"}},
+		Entries: []har.Entry{
+			entry("https://example.com/", false, ""),
+			entry("https://example.com/app.css", false, "https://example.com/"),
+			entry("https://example.com/font.woff2", true, "https://example.com/app.css"),
+			entry("https://example.com/app.js", true, ""),
+		},
+	}}
+
+	imported, err := TransactionsFromHAR(archive)
+	if err != nil {
+		t.Fatalf("Failed to convert HAR: %v", err)
+	}
+	if pushes := imported.Transactions[0].Pushes; !reflect.DeepEqual(pushes, []string{"https://example.com/app.js"}) {
+		t.Errorf("Expected the page to have pushed app.js, got %v", pushes)
+	}
+	if pushes := imported.Transactions[1].Pushes; !reflect.DeepEqual(pushes, []string{"https://example.com/font.woff2"}) {
+		t.Errorf("Expected the initiator to have pushed the font, got %v", pushes)
+	}
+}
+
+func TestRecordedConcurrency(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	mbps := 8.0
+	wireSize := int64(1024 * 1024) // 1 second at 8 Mbps
+	resource := func(rawURL string, offset time.Duration, ttfbMS int64, transfer bool) types.Resource {
+		r := types.Resource{Method: "GET", URL: rawURL, TTFBMS: ttfbMS, Timestamp: start.Add(offset)}
+		if transfer {
+			r.MBPS = &mbps
+			r.WireSize = &wireSize
+		}
+		return r
+	}
+
+	resources := []types.Resource{
+		// Three overlapping requests, the last one only through its transfer time
+		resource("https://example.com/", 0, 100, false),
+		resource("https://example.com/a.css", 50*time.Millisecond, 100, false),
+		resource("https://example.com/b.js", -500*time.Millisecond, 100, true),
+		// Back to back: one finishes as the next starts
+		resource("https://cdn.example.com/1.png", 0, 100, false),
+		resource("https://cdn.example.com/2.png", 100*time.Millisecond, 100, false),
+		// No timestamp
+		{Method: "GET", URL: "https://other.example.com/"},
+	}
+
+	concurrency := RecordedConcurrency(resources)
+	expected := map[string]int{"example.com": 3, "cdn.example.com": 1}
+	if len(concurrency) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, concurrency)
+	}
+	for host, limit := range expected {
+		if concurrency[host] != limit {
+			t.Errorf("Expected concurrency %d for %s, got %d", limit, host, concurrency[host])
+		}
+	}
+}
+
+func TestProtocolConcurrency(t *testing.T) {
+	for version, expected := range map[string]types.Protocol{"h2": types.ProtocolHTTP2, "HTTP/2.0": types.ProtocolHTTP2, "http/1.1": types.ProtocolHTTP1, "h3": types.ProtocolHTTP3, "spdy/3": ""} {
+		if protocol := ParseProtocol(version); protocol != expected {
+			t.Errorf("ParseProtocol(%q) = %q, want %q", version, protocol, expected)
+		}
+	}
+
+	resource := func(rawURL string, protocol types.Protocol) types.Resource {
+		r := types.Resource{Method: "GET", URL: rawURL}
+		if protocol != "" {
+			r.Protocol = &protocol
+		}
+		return r
+	}
+	resources := []types.Resource{
+		resource("https://legacy.example.com/", types.ProtocolHTTP1),
+		resource("https://legacy.example.com/app.js", types.ProtocolHTTP1),
+		resource("https://example.com/", types.ProtocolHTTP2),
+		resource("https://mixed.example.com/", types.ProtocolHTTP1),
+		resource("https://mixed.example.com/app.js", types.ProtocolHTTP3),
+		resource("https://unknown.example.com/", ""),
+	}
+	limits := ProtocolConcurrency(resources)
+	if len(limits) != 1 || limits["legacy.example.com"] != HTTP1ConnectionsPerHost {
+		t.Errorf("Expected only the HTTP/1.1 host to be limited, got %v", limits)
+	}
+}
+
+// TestInventory_PortableContentPaths tests that inventories keep working when moved between file
+// systems with different separators and case sensitivity
+func TestInventory_PortableContentPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	pm := NewPersistenceManager(tempDir)
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(url, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "image/png"},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		transaction("https://example.com/Logo.png", "upper"),
+		transaction("https://example.com/logo.png", "lower"),
+	}
+	if err := pm.SaveRecordedTransactions(transactions, "https://example.com/"); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	// URLs differing only in case get content files that stay apart on Windows and macOS
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	folded := make(map[string]bool)
+	for _, res := range inventory.Resources {
+		key := resource.FoldFilePath(*res.ContentFilePath)
+		if folded[key] {
+			t.Errorf("Content files collide on case-insensitive file systems: %s", *res.ContentFilePath)
+		}
+		folded[key] = true
+	}
+
+	// An inventory written on Windows with backslashes and a file renamed in another case still replays
+	for i := range inventory.Resources {
+		res := &inventory.Resources[i]
+		if res.URL == "https://example.com/Logo.png" {
+			windowsPath := strings.ReplaceAll(*res.ContentFilePath, "/", `\`)
+			res.ContentFilePath = &windowsPath
+			if err := os.Rename(filepath.Join(tempDir, "contents", "get", "https", "example.com", "Logo.png"),
+				filepath.Join(tempDir, "contents", "get", "https", "example.com", "LOGO.PNG")); err != nil {
+				t.Fatalf("Failed to rename content file: %v", err)
+			}
+		}
+	}
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		t.Fatalf("Failed to marshal inventory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "inventory.json"), data, 0644); err != nil {
+		t.Fatalf("Failed to write inventory: %v", err)
+	}
+
+	loaded, err := NewPlaybackManager(tempDir).LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load playback transactions: %v", err)
+	}
+	bodies := make(map[string]string)
+	for _, tr := range loaded {
+		var body []byte
+		for _, chunk := range tr.Chunks {
+			body = append(body, chunk.Chunk...)
+		}
+		bodies[tr.URL] = string(body)
+	}
+	if bodies["https://example.com/Logo.png"] != "upper" || bodies["https://example.com/logo.png"] != "lower" {
+		t.Errorf("Unexpected replayed bodies: %v", bodies)
+	}
+
+	// Saving writes forward slashes again
+	reloaded, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	if err := pm.SaveInventory(reloaded); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	saved, _ := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if strings.Contains(string(saved), `\\`) {
+		t.Error("Expected content file paths with forward slashes only")
+	}
+}
+
+func TestPersistenceManager_MeasureEncodings(t *testing.T) {
+	pm := NewPersistenceManager(t.TempDir())
+	script := strings.Repeat("console.log('measure');\n", 200)
+	mime := "application/javascript"
+	gzip := types.ContentEncodingGzip
+	empty := ""
+	inv := &types.Inventory{Resources: []types.Resource{
+		{Method: "GET", URL: "https://example.com/app.js", ContentUTF8: &script, ContentTypeMime: &mime, ContentEncoding: &gzip},
+		{Method: "GET", URL: "https://example.com/empty", ContentUTF8: &empty},
+	}}
+	if err := pm.SaveInventory(inv); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	var codecs []encoding.Codec
+	for _, spec := range []string{"gzip:1", "br:11"} {
+		codec, err := encoding.ParseCodec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		codecs = append(codecs, codec)
+	}
+	measurements, err := pm.MeasureEncodings(codecs)
+	if err != nil {
+		t.Fatalf("MeasureEncodings failed: %v", err)
+	}
+	if len(measurements) != 1 {
+		t.Fatalf("Expected resources without content to be skipped, got %d measurements", len(measurements))
+	}
+	m := measurements[0]
+	if m.Err != nil || m.Size != len(script) || m.Recorded != gzip || m.ContentType != mime || len(m.Results) != 2 {
+		t.Fatalf("Unexpected measurement: %+v", m)
+	}
+	if m.Results[1].Size >= m.Results[0].Size {
+		t.Errorf("Expected brotli 11 to be smaller than gzip 1, got %d and %d", m.Results[1].Size, m.Results[0].Size)
+	}
+}
+
+func TestRequestBodyHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		a, b        string
+		same        bool
+	}{
+		{"JSON key order and whitespace", "application/json", `{"a":1,"b":[1,2]}`, "{\n  \"b\": [1, 2],\n  \"a\": 1\n}", true},
+		{"JSON values", "application/json; charset=utf-8", `{"page":1}`, `{"page":2}`, false},
+		{"JSON numbers keep their form", "application/json", `{"id":12345678901234567890}`, `{"id":12345678901234567891}`, false},
+		{"form field order", "application/x-www-form-urlencoded", "q=shoes&page=2", "page=2&q=shoes", true},
+		{"other bodies as they are", "text/plain", "a b", "a  b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := RequestBodyHash(tt.contentType, []byte(tt.a)), RequestBodyHash(tt.contentType, []byte(tt.b))
+			if (a == b) != tt.same {
+				t.Errorf("Expected same=%v for %q and %q, got %s and %s", tt.same, tt.a, tt.b, a, b)
+			}
+		})
+	}
+	if hash := RequestBodyHash("application/json", nil); hash != "" {
+		t.Errorf("Expected no hash for an empty body, got %s", hash)
+	}
+}
+
+func TestPersistenceManager_RequestBodyVariants(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(requestBody, responseBody string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:            "POST",
+			URL:               "https://api.example.com/search",
+			RequestStarted:    now,
+			ResponseStarted:   now.Add(10 * time.Millisecond),
+			ResponseFinished:  now.Add(20 * time.Millisecond),
+			StatusCode:        &statusCode,
+			RawHeaders:        types.HttpHeaders{"Content-Type": "application/json"},
+			Body:              []byte(responseBody),
+			RequestBodySHA256: RequestBodyHash("application/json", []byte(requestBody)),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		transaction(`{"q":"shoes"}`, `["shoe"]`),
+		transaction(`{"q":"hats"}`, `["hat"]`),
+		transaction(`{ "q": "shoes" }`, `["shoe"]`),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	if len(inv.Resources) != 2 {
+		t.Fatalf("Expected a resource per distinct request body, got %d", len(inv.Resources))
+	}
+
+	hats := RequestBodyHash("application/json", []byte(`{"q":"hats"}`))
+	for _, res := range inv.Resources {
+		content, _ := pm.ReadContent(&res)
+		if res.RequestBodySHA256 == nil {
+			t.Fatalf("Expected the request body hash to be recorded for %s", content)
+		}
+		expectedPath := "post/https/api.example.com/search/index.html"
+		if *res.RequestBodySHA256 == hats {
+			expectedPath = "bodies/" + hats[:16] + "/" + expectedPath
+		}
+		if *res.ContentFilePath != expectedPath {
+			t.Errorf("Expected the response %s at %s, got %s", content, expectedPath, *res.ContentFilePath)
+		}
+	}
+
+	// Appending a response to a new body adds another variant instead of replacing the first
+	appended := transaction(`{"q":"socks"}`, `["sock"]`)
+	if err := pm.AppendRecordedTransaction(&appended); err != nil {
+		t.Fatalf("Failed to append transaction: %v", err)
+	}
+	inv, _ = pm.LoadInventory()
+	if len(inv.Resources) != 3 {
+		t.Errorf("Expected the appended body to be kept as a variant, got %d resources", len(inv.Resources))
+	}
+}
+
+func TestPersistenceManager_KeepRepeats(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(rawURL string, offset time.Duration, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              rawURL,
+			RequestStarted:   now.Add(offset),
+			ResponseStarted:  now.Add(offset + 10*time.Millisecond),
+			ResponseFinished: now.Add(offset + 20*time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "application/json"},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		transaction("https://api.example.com/poll", 0, `{"n":1}`),
+		transaction("https://api.example.com/poll", time.Second, `{"n":2}`),
+		transaction("https://api.example.com/poll", 2*time.Second, `{"n":3}`),
+		transaction("https://api.example.com/config", 0, `{"v":1}`),
+		transaction("https://api.example.com/config", time.Second, `{"v":2}`),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	pm.KeepRepeats = []*regexp.Regexp{regexp.MustCompile(`/poll$`)}
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	if len(inv.Resources) != 4 {
+		t.Fatalf("Expected every response to the polled URL and one to the other, got %d resources", len(inv.Resources))
+	}
+
+	repeats := 0
+	for _, res := range inv.Resources {
+		content, _ := pm.ReadContent(&res)
+		if res.URL != "https://api.example.com/poll" {
+			if res.Repeat != nil {
+				t.Errorf("Expected no repeat for %s", res.URL)
+			}
+			continue
+		}
+		expectedPath := "get/https/api.example.com/poll/index.html"
+		repeat := 0
+		if res.Repeat != nil {
+			repeat = *res.Repeat
+			expectedPath = fmt.Sprintf("repeats/%d/%s", repeat, expectedPath)
+		}
+		if expected := fmt.Sprintf(`{"n":%d}`, repeat+1); string(content) != expected {
+			t.Errorf("Expected repeat %d to hold %s, got %s", repeat, expected, content)
+		}
+		if *res.ContentFilePath != expectedPath {
+			t.Errorf("Expected repeat %d at %s, got %s", repeat, expectedPath, *res.ContentFilePath)
+		}
+		repeats++
+	}
+	if repeats != 3 {
+		t.Errorf("Expected 3 responses to the polled URL, got %d", repeats)
+	}
+}
+
+func TestPersistenceManager_RequestHeadersAndBody(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	userAgent := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+	transactions := []types.RecordingTransaction{
+		{
+			Method:           "GET",
+			URL:              "https://example.com/",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/html"},
+			Body:             []byte("<html></html>"),
+			RequestHeaders:   types.HttpHeaders{"User-Agent": userAgent, "Cookie": "session=abc; theme=dark"},
+		},
+		{
+			Method:            "POST",
+			URL:               "https://example.com/api/login",
+			RequestStarted:    now.Add(30 * time.Millisecond),
+			ResponseStarted:   now.Add(40 * time.Millisecond),
+			ResponseFinished:  now.Add(50 * time.Millisecond),
+			StatusCode:        &statusCode,
+			RawHeaders:        types.HttpHeaders{"Content-Type": "application/json"},
+			Body:              []byte(`{"ok":true}`),
+			RequestHeaders:    types.HttpHeaders{"User-Agent": userAgent, "Content-Type": "application/json"},
+			RequestBody:       []byte(`{"user":"alice"}`),
+			RequestBodySHA256: RequestBodyHash("application/json", []byte(`{"user":"alice"}`)),
+		},
+		{
+			Method:            "PUT",
+			URL:               "https://example.com/upload",
+			RequestStarted:    now.Add(60 * time.Millisecond),
+			ResponseStarted:   now.Add(70 * time.Millisecond),
+			ResponseFinished:  now.Add(80 * time.Millisecond),
+			StatusCode:        &statusCode,
+			RawHeaders:        types.HttpHeaders{"Content-Type": "text/plain"},
+			Body:              []byte("stored"),
+			RequestBody:       []byte{0xff, 0x00, 0xfe},
+			RequestBodySHA256: RequestBodyHash("", []byte{0xff, 0x00, 0xfe}),
+		},
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	// The long User-Agent goes into the header table like response headers
+	data, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if err != nil {
+		t.Fatalf("Failed to read inventory: %v", err)
+	}
+	if strings.Count(string(data), "AppleWebKit") != 1 || !strings.Contains(string(data), `"sharedRequestHeaders"`) {
+		t.Errorf("Expected the User-Agent to be stored once:\n%s", data)
+	}
+
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	resources := make(map[string]*types.Resource)
+	for i := range inv.Resources {
+		resources[inv.Resources[i].Method] = &inv.Resources[i]
+	}
+	if got := resources["GET"].RequestHeaders; got["User-Agent"] != userAgent || got["Cookie"] != "session=abc; theme=dark" {
+		t.Errorf("Request headers not restored: %v", got)
+	}
+	for method, expected := range map[string][]byte{"GET": nil, "POST": []byte(`{"user":"alice"}`), "PUT": {0xff, 0x00, 0xfe}} {
+		body, err := RequestBody(resources[method])
+		if err != nil || !bytes.Equal(body, expected) {
+			t.Errorf("%s request body = %q (%v), want %q", method, body, err, expected)
+		}
+	}
+	if resources["PUT"].RequestBodyBase64 == nil {
+		t.Error("Expected the binary request body to be stored as base64")
+	}
+
+	archive, err := pm.ExportHAR()
+	if err != nil {
+		t.Fatalf("Failed to export HAR: %v", err)
+	}
+	page, login := archive.Log.Entries[0].Request, archive.Log.Entries[1].Request
+	if len(page.Cookies) != 2 || page.Cookies[1].Name != "theme" || page.Cookies[1].Value != "dark" {
+		t.Errorf("Unexpected cookies: %+v", page.Cookies)
+	}
+	if len(page.Headers) != 2 || page.Headers[0].Name != "Cookie" {
+		t.Errorf("Expected the recorded request headers, got %+v", page.Headers)
+	}
+	if login.PostData == nil || login.PostData.Text != `{"user":"alice"}` || login.PostData.MimeType != "application/json" || login.BodySize != 16 {
+		t.Errorf("Unexpected post data: %+v (size %d)", login.PostData, login.BodySize)
+	}
+
+	// Importing the exported archive keeps the request side
+	imported, err := TransactionsFromHAR(archive)
+	if err != nil {
+		t.Fatalf("Failed to import HAR: %v", err)
+	}
+	transaction := imported.Transactions[1]
+	if string(transaction.RequestBody) != `{"user":"alice"}` || transaction.RequestBodySHA256 != transactions[1].RequestBodySHA256 {
+		t.Errorf("Request body not imported: %q %s", transaction.RequestBody, transaction.RequestBodySHA256)
+	}
+	if transaction.RequestHeaders["User-Agent"] != userAgent {
+		t.Errorf("Request headers not imported: %v", transaction.RequestHeaders)
+	}
+}
+
+func TestResponseLanguage(t *testing.T) {
+	tests := []struct {
+		headers  types.HttpHeaders
+		body     string
+		expected string
+	}{
+		{types.HttpHeaders{"Content-Language": "en-us, fr"}, "", "en-US"},
+		{types.HttpHeaders{"Content-Type": "text/html"}, `<!DOCTYPE html><html class="x" lang='zh-hant-tw'>`, "zh-Hant-TW"},
+		{types.HttpHeaders{"Content-Type": "text/html"}, `<HTML LANG=ja_jp>`, "ja-JP"},
+		{types.HttpHeaders{"Content-Type": "text/html"}, "<html><body lang=\"de\">", ""},
+		{types.HttpHeaders{"Content-Type": "text/plain"}, `<html lang="ja">`, ""},
+	}
+	for _, tt := range tests {
+		if got := ResponseLanguage(tt.headers, []byte(tt.body)); got != tt.expected {
+			t.Errorf("%v %q: expected %q, got %q", tt.headers, tt.body, tt.expected, got)
+		}
+	}
+}
+
+func TestPersistenceManager_LocaleVariants(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(headers types.HttpHeaders, body string) types.RecordingTransaction {
+		headers["Content-Type"] = "text/html; charset=utf-8"
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              "https://example.com/",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       headers,
+			Body:             []byte(body),
+		}
+	}
+	gzipped, err := encoding.EncodeData([]byte(`<html lang="ja"><body>こんにちは</body></html>`), types.ContentEncodingGzip, 6)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	transactions := []types.RecordingTransaction{
+		transaction(types.HttpHeaders{"Content-Language": "en"}, "<html><body>hello</body></html>"),
+		transaction(types.HttpHeaders{"Content-Encoding": "gzip"}, string(gzipped)),
+		transaction(types.HttpHeaders{"Content-Language": "en"}, "<html><body>hello again</body></html>"),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	summary := NewRecordingSummary(transactions, "", now)
+	pm.Summary = summary
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	if summary.Languages["en"] != 2 || summary.Languages["ja"] != 1 {
+		t.Errorf("Expected 2 English and 1 Japanese responses in the summary, got %v", summary.Languages)
+	}
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	paths := make(map[string]string)
+	for _, res := range inv.Resources {
+		if res.Language == nil {
+			t.Fatalf("Expected the language to be recorded for %s", *res.ContentFilePath)
+		}
+		paths[*res.Language] = *res.ContentFilePath
+	}
+	if len(inv.Resources) != 2 || paths["en"] != "get/https/example.com/index.html" || paths["ja"] != "locales/ja/get/https/example.com/index.html" {
+		t.Fatalf("Expected the English page and a Japanese variant, got %v", paths)
+	}
+
+	// Rewriting URLs keeps the language variants apart
+	if _, err := pm.RewriteURLs(RewriteOptions{From: "https://cdn.example.com", To: "https://static.example.com", DryRun: true}); err != nil {
+		t.Fatalf("Expected an unrelated rewrite to succeed, got %v", err)
+	}
+	if _, err := pm.RewriteURLs(RewriteOptions{From: "https://example.com", To: "https://example.net"}); err != nil {
+		t.Fatalf("Failed to rewrite the language variants: %v", err)
+	}
+	if inv, err = pm.LoadInventory(); err != nil || len(inv.Resources) != 2 {
+		t.Fatalf("Expected both language variants after rewriting, got %v (%v)", inv, err)
+	}
+}
+
+func TestPersistenceManager_RecordsDomains(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(rawURL, address string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              rawURL,
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+			Body:             []byte(rawURL),
+			IPAddress:        address,
+			Resolver:         "1.1.1.1:53",
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		transaction("https://www.example.com/", "93.184.216.34"),
+		transaction("https://cdn.example.com:8443/app.js", "192.0.2.10"),
+		transaction("https://www.example.com/other", "93.184.216.35"),
+		transaction("https://unknown.example.com/", ""),
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	expected := []types.Domain{
+		{Name: "cdn.example.com", IPAddress: "192.0.2.10", Resolver: "1.1.1.1:53"},
+		{Name: "www.example.com", IPAddress: "93.184.216.34", Resolver: "1.1.1.1:53"},
+	}
+	if !reflect.DeepEqual(inv.Domains, expected) {
+		t.Errorf("Expected %v, got %v", expected, inv.Domains)
+	}
+
+	// Appended transactions add their host once
+	appended := transaction("https://api.example.com/", "192.0.2.20")
+	if err := pm.AppendRecordedTransaction(&appended); err != nil {
+		t.Fatalf("Failed to append transaction: %v", err)
+	}
+	if err := pm.AppendRecordedTransaction(&appended); err != nil {
+		t.Fatalf("Failed to append transaction: %v", err)
+	}
+	inv, _ = pm.LoadInventory()
+	if len(inv.Domains) != 3 || inv.Domains[0].Name != "api.example.com" {
+		t.Errorf("Expected api.example.com to be added first, got %v", inv.Domains)
+	}
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	normalized, ok := NormalizeJSON([]byte(`{"b":[1,2.50,{"d":"<x>","c":null}],"a":12345678901234567890}`))
+	expected := "{\n  \"a\": 12345678901234567890,\n  \"b\": [\n    1,\n    2.50,\n    {\n      \"c\": null,\n      \"d\": \"<x>\"\n    }\n  ]\n}\n"
+	if !ok || string(normalized) != expected {
+		t.Errorf("Expected %q, got %q (%v)", expected, normalized, ok)
+	}
+	for _, body := range []string{"", "{", `{"a":1} {"b":2}`, "not json"} {
+		if _, ok := NormalizeJSON([]byte(body)); ok {
+			t.Errorf("Expected %q not to be normalized", body)
+		}
+	}
+}
+
+// TestPersistenceManager_NormalizeJSON tests that JSON content files are saved normalized and replayed
+// as received until they are edited
+func TestPersistenceManager_NormalizeJSON(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	received := `{"z":1,"a":{"y":true,"b":[]}}`
+	transactions := []types.RecordingTransaction{
+		{
+			Method:           "GET",
+			URL:              "https://api.example.com/items.json",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "application/json; charset=utf-8"},
+			Body:             []byte(received),
+		},
+		{
+			Method:           "GET",
+			URL:              "https://api.example.com/broken.json",
+			RequestStarted:   now,
+			ResponseStarted:  now.Add(10 * time.Millisecond),
+			ResponseFinished: now.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "application/json"},
+			Body:             []byte(`{"cut":`),
+		},
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	pm.NormalizeJSON = true
+	pm.KeepOriginals = true
+	pm.Summary = &RecordingSummary{}
+	if err := pm.SaveRecordedTransactionsWithOptions(transactions, "", true); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+	if pm.Summary.Normalized != 1 {
+		t.Errorf("Expected 1 normalized file, got %d", pm.Summary.Normalized)
+	}
+
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	resources := make(map[string]*types.Resource)
+	for i := range inv.Resources {
+		resources[inv.Resources[i].URL] = &inv.Resources[i]
+	}
+	items := resources["https://api.example.com/items.json"]
+	content, _ := os.ReadFile(ContentFile(tempDir, *items.ContentFilePath))
+	if string(content) != "{\n  \"a\": {\n    \"b\": [],\n    \"y\": true\n  },\n  \"z\": 1\n}\n" {
+		t.Errorf("Expected the content file to be normalized, got %q", content)
+	}
+	if items.OriginalFilePath == nil {
+		t.Fatal("Expected the original to be kept")
+	}
+	if original, _ := os.ReadFile(OriginalFile(tempDir, *items.OriginalFilePath)); string(original) != received {
+		t.Errorf("Expected the original as received, got %q", original)
+	}
+	if broken := resources["https://api.example.com/broken.json"]; broken.OriginalFilePath != nil {
+		t.Error("Expected invalid JSON to be saved as received")
+	}
+
+	replayed := func() string {
+		transactions, err := NewPlaybackManager(tempDir).LoadPlaybackTransactions()
+		if err != nil {
+			t.Fatalf("Failed to load playback transactions: %v", err)
+		}
+		for _, transaction := range transactions {
+			if transaction.URL == items.URL {
+				var body []byte
+				for _, chunk := range transaction.Chunks {
+					body = append(body, chunk.Chunk...)
+				}
+				return string(body)
+			}
+		}
+		return ""
+	}
+	if body := replayed(); body != received {
+		t.Errorf("Expected the original to be replayed, got %q", body)
+	}
+
+	// An edited content file is replayed once its checksum is updated
+	edited := "{\n  \"a\": {},\n  \"z\": 2\n}\n"
+	if err := os.WriteFile(ContentFile(tempDir, *items.ContentFilePath), []byte(edited), 0644); err != nil {
+		t.Fatalf("Failed to edit content file: %v", err)
+	}
+	if _, err := pm.UpdateChecksums(); err != nil {
+		t.Fatalf("Failed to update checksums: %v", err)
+	}
+	if body := replayed(); body != edited {
+		t.Errorf("Expected the edited content to be replayed, got %q", body)
+	}
+}
+
+// TestPersistenceManager_Append tests that an appending save keeps the resources of the previous
+// inventory that were not recorded again
+func TestPersistenceManager_Append(t *testing.T) {
+	tempDir := t.TempDir()
+
+	statusCode := 200
+	now := time.Now()
+	transaction := func(rawURL, body string, at time.Time) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              rawURL,
+			RequestStarted:   at,
+			ResponseStarted:  at.Add(10 * time.Millisecond),
+			ResponseFinished: at.Add(20 * time.Millisecond),
+			StatusCode:       &statusCode,
+			RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+			Body:             []byte(body),
+		}
+	}
+
+	pm := NewPersistenceManager(tempDir)
+	first := []types.RecordingTransaction{
+		transaction("https://example.com/a.txt", "first a", now),
+		transaction("https://example.com/b.txt", "first b", now.Add(time.Second)),
+	}
+	if err := pm.SaveRecordedTransactionsWithOptions(first, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save first session: %v", err)
+	}
+
+	pm.Append = true
+	pm.Summary = &RecordingSummary{}
+	second := []types.RecordingTransaction{
+		transaction("https://example.com/b.txt", "second b", now.Add(time.Hour)),
+		transaction("https://example.com/c.txt", "second c", now.Add(time.Hour+time.Second)),
+	}
+	if err := pm.SaveRecordedTransactionsWithOptions(second, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save second session: %v", err)
+	}
+	if pm.Summary.Kept != 1 || pm.Summary.Resources != 2 {
+		t.Errorf("Expected 1 kept and 2 saved resources, got %d and %d", pm.Summary.Kept, pm.Summary.Resources)
+	}
+
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	var contents []string
+	for _, resource := range inv.Resources {
+		data, _ := os.ReadFile(ContentFile(tempDir, *resource.ContentFilePath))
+		contents = append(contents, string(data))
+	}
+	expected := []string{"first a", "second b", "second c"}
+	if !reflect.DeepEqual(contents, expected) {
+		t.Errorf("Expected %v, got %v", expected, contents)
+	}
+
+	// Without --append the inventory is replaced
+	pm.Append = false
+	if err := pm.SaveRecordedTransactionsWithOptions(second, "https://example.com/", true); err != nil {
+		t.Fatalf("Failed to save third session: %v", err)
+	}
+	if inv, _ = pm.LoadInventory(); len(inv.Resources) != 2 {
+		t.Errorf("Expected the inventory to be replaced, got %d resources", len(inv.Resources))
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	links := ParseLinks(`</app.css>; rel=preload; as=style, <https://cdn.example.com>; rel="preconnect"; crossorigin, </a,b.js>; rel="modulepreload prefetch"; title="x, y"`)
+	if len(links) != 3 {
+		t.Fatalf("Expected 3 links, got %+v", links)
+	}
+	if links[0].Target != "/app.css" || !links[0].HasRel("preload") || links[0].As != "style" {
+		t.Errorf("Unexpected first link: %+v", links[0])
+	}
+	if links[1].Target != "https://cdn.example.com" || links[1].hint() != "preconnect" {
+		t.Errorf("Unexpected second link: %+v", links[1])
+	}
+	if links[2].Target != "/a,b.js" || !links[2].HasRel("prefetch") || links[2].hint() != "modulepreload" {
+		t.Errorf("Unexpected third link: %+v", links[2])
+	}
+}
+
+func TestParseLinkRules(t *testing.T) {
+	rules, err := ParseLinkRules([]string{"preconnect=strip", "Preload=delay:300ms"})
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	if !rules[0].Strip || rules[1].Rel != "preload" || rules[1].Delay != 300*time.Millisecond {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+	for _, spec := range []string{"preload", "preload=drop", "preload=delay:0s", "=strip"} {
+		if _, err := ParseLinkRules([]string{spec}); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+	if _, err := ParseLinkRules([]string{"preload=strip", "preload=delay:1s"}); err == nil {
+		t.Error("Expected an error for two rules on one relation")
+	}
+}
+
+func TestPlaybackManager_LinkRules(t *testing.T) {
+	tempDir := t.TempDir()
+	started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	inv := types.Inventory{
+		Resources: []types.Resource{
+			{
+				Method: "GET",
+				URL:    "https://example.com/",
+				TTFBMS: 200,
+				RawHeaders: types.HttpHeaders{
+					"Link": "</app.css>; rel=preload; as=style, <https://cdn.example.com>; rel=preconnect, </next>; rel=prefetch",
+				},
+				Informational: []types.Informational{
+					{StatusCode: 103, OffsetMS: 20, RawHeaders: types.HttpHeaders{"Link": "</app.css>; rel=preload; as=style"}},
+				},
+				ContentUTF8: testutil.StringPtr("<html></html>"),
+				Timestamp:   started,
+			},
+			{Method: "GET", URL: "https://example.com/app.css", TTFBMS: 50, ContentUTF8: testutil.StringPtr("body{}"), Timestamp: started.Add(60 * time.Millisecond)},
+			{Method: "GET", URL: "https://cdn.example.com/logo.png", TTFBMS: 50, Timestamp: started.Add(400 * time.Millisecond)},
+		},
+	}
+	pm := NewPersistenceManager(tempDir)
+	if err := pm.SaveInventory(&inv); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	// The hint in the final response repeats the Early Hint and is listed once
+	hints, err := pm.PreloadHints()
+	if err != nil {
+		t.Fatalf("Failed to list hints: %v", err)
+	}
+	if len(hints) != 3 {
+		t.Fatalf("Expected 3 hints, got %+v", hints)
+	}
+	if hint := hints[0]; hint.Target != "https://example.com/app.css" || !hint.EarlyHints || hint.HintMS != 20 || hint.RequestedMS == nil || *hint.RequestedMS != 60 {
+		t.Errorf("Unexpected preload hint: %+v", hint)
+	}
+	if hint := hints[1]; hint.Rel != "preconnect" || hint.HintMS != 200 || hint.RequestedMS == nil || *hint.RequestedMS != 400 {
+		t.Errorf("Unexpected preconnect hint: %+v", hint)
+	}
+	if hint := hints[2]; hint.Rel != "prefetch" || hint.RequestedMS != nil {
+		t.Errorf("Expected the prefetch target to be never requested, got %+v", hint)
+	}
+
+	playback := NewPlaybackManager(tempDir)
+	playback.LinkRules = []LinkRule{{Rel: "preconnect", Strip: true}, {Rel: "preload", Delay: time.Second}}
+	transactions, err := playback.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load transactions: %v", err)
+	}
+	if link := transactions[0].RawHeaders["Link"]; link != "</app.css>; rel=preload; as=style, </next>; rel=prefetch" {
+		t.Errorf("Expected the preconnect hint to be stripped, got %q", link)
+	}
+	if transactions[1].TTFB != 1050*time.Millisecond {
+		t.Errorf("Expected the preloaded stylesheet to be delayed by 1s, got TTFB %s", transactions[1].TTFB)
+	}
+	if transactions[2].TTFB != 50*time.Millisecond {
+		t.Errorf("Expected resources without hints to keep their timing, got TTFB %s", transactions[2].TTFB)
+	}
+}
+
+func TestPlaybackManager_UnsupportedEncoding(t *testing.T) {
+	tempDir := t.TempDir()
+	dcz := types.ContentEncodingType("dcz")
+	gzipEncoding := types.ContentEncodingGzip
+	inv := types.Inventory{
+		Resources: []types.Resource{
+			{
+				Method:          "GET",
+				URL:             "https://example.com/app.js",
+				RawHeaders:      types.HttpHeaders{"Content-Encoding": "dcz", "Content-Type": "application/javascript"},
+				ContentEncoding: &dcz,
+				ContentUTF8:     testutil.StringPtr("console.log(1)"),
+			},
+			{
+				Method:          "GET",
+				URL:             "https://example.com/app.css",
+				RawHeaders:      types.HttpHeaders{"content-encoding": "gzip"},
+				ContentEncoding: &gzipEncoding,
+				ContentUTF8:     testutil.StringPtr("body{}"),
+			},
+		},
+	}
+	if err := NewPersistenceManager(tempDir).SaveInventory(&inv); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	pm := NewPlaybackManager(tempDir)
+	transactions, err := pm.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load transactions: %v", err)
+	}
+	fallback := transactions[0]
+	if fallback.ContentEncoding != types.ContentEncodingIdentity || fallback.RawHeaders["Content-Encoding"] != "" {
+		t.Errorf("Expected the dcz resource to be served as identity, got %s with headers %v", fallback.ContentEncoding, fallback.RawHeaders)
+	}
+	if body := string(fallback.Chunks[0].Chunk); body != "console.log(1)" {
+		t.Errorf("Expected the content as is, got %q", body)
+	}
+	if transactions[1].ContentEncoding != types.ContentEncodingGzip || transactions[1].RawHeaders["content-encoding"] != "gzip" {
+		t.Errorf("Expected the gzip resource to keep its encoding, got %s", transactions[1].ContentEncoding)
+	}
+
+	fallbacks := pm.EncodingFallbacks()
+	if len(fallbacks) != 1 || fallbacks[0].URL != "https://example.com/app.js" || fallbacks[0].Encoding != dcz {
+		t.Errorf("Unexpected fallbacks: %+v", fallbacks)
+	}
+	// Each load lists its own fallbacks
+	if _, err := pm.LoadPlaybackTransactions(); err != nil {
+		t.Fatalf("Failed to reload transactions: %v", err)
+	}
+	if len(pm.EncodingFallbacks()) != 1 {
+		t.Errorf("Expected the fallbacks of the last load only, got %+v", pm.EncodingFallbacks())
+	}
+}
+
+func TestPlaybackManager_MemoryFiles(t *testing.T) {
+	files := MemoryFiles{
+		"inventory.json": []byte(`{"resources":[{"method":"GET","url":"https://example.com/","contentFilePath":"get/https/example.com/index.html","contentTypeMime":"text/html"}]}`),
+		// Found although it differs in case, like on disk
+		"contents/GET/https/example.com/index.html": []byte("<html>memory</html>"),
+		"playback.json": []byte(`{"fallback":"block"}`),
+	}
+	pm := NewPlaybackManager(filepath.Join(t.TempDir(), "missing"))
+	pm.Files = files
+	if !pm.HasInventory() {
+		t.Fatal("Expected the inventory in memory to be found")
+	}
+	transactions, err := pm.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load transactions: %v", err)
+	}
+	if len(transactions) != 1 || string(transactions[0].Chunks[0].Chunk) != "<html>memory</html>" {
+		t.Errorf("Expected the content file from memory, got %+v", transactions)
+	}
+	settings, err := pm.LoadSettings()
+	if err != nil || settings == nil || settings.Fallback != "block" {
+		t.Errorf("Expected playback.json from memory, got %+v (%v)", settings, err)
+	}
+}
+
+func TestPersistenceManager_Redaction(t *testing.T) {
+	status := 200
+	transaction := types.RecordingTransaction{
+		Method:           "GET",
+		URL:              "https://example.com/api?page=2&access_token=secret-token&v=1",
+		RequestStarted:   time.Now(),
+		ResponseStarted:  time.Now(),
+		ResponseFinished: time.Now(),
+		StatusCode:       &status,
+		RawHeaders: types.HttpHeaders{
+			"Content-Type": "application/json",
+			"Set-Cookie":   "session=secret-session; Path=/; HttpOnly",
+		},
+		RequestHeaders: types.HttpHeaders{
+			"Authorization": "Bearer secret-bearer",
+			"Cookie":        "session=secret-session; theme=dark",
+			"X-Api-Key":     "secret-key",
+			"Accept":        "application/json",
+		},
+		Body: []byte(`{"ok":true}`),
+	}
+
+	for _, mode := range []string{RedactStrip, RedactHash} {
+		t.Run(mode, func(t *testing.T) {
+			redaction, err := NewRedaction(&Redaction{Mode: mode, Headers: []string{"x-api-key"}, QueryParams: []string{"*_token"}})
+			if err != nil {
+				t.Fatalf("Failed to create redaction: %v", err)
+			}
+			dir := t.TempDir()
+			pm := NewPersistenceManager(dir)
+			pm.Redaction = redaction
+			if err := pm.SaveRecordedTransactions([]types.RecordingTransaction{transaction}, transaction.URL); err != nil {
+				t.Fatalf("Failed to save transactions: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "inventory.json"))
+			if err != nil {
+				t.Fatalf("Failed to read inventory: %v", err)
+			}
+			if strings.Contains(string(data), "secret") {
+				t.Errorf("Expected no secrets in the inventory, got %s", data)
+			}
+			inv, err := pm.LoadInventory()
+			if err != nil {
+				t.Fatalf("Failed to load inventory: %v", err)
+			}
+			resource := inv.Resources[0]
+			if resource.RequestHeaders["Accept"] != "application/json" || resource.RawHeaders["Content-Type"] != "application/json" {
+				t.Errorf("Expected other headers to be kept, got %v and %v", resource.RequestHeaders, resource.RawHeaders)
+			}
+			switch mode {
+			case RedactStrip:
+				if resource.URL != "https://example.com/api?page=2&v=1" {
+					t.Errorf("Expected the token parameter to be stripped, got %s", resource.URL)
+				}
+				if _, ok := resource.RequestHeaders["Cookie"]; ok {
+					t.Errorf("Expected the Cookie header to be stripped, got %v", resource.RequestHeaders)
+				}
+			case RedactHash:
+				if !strings.HasPrefix(resource.URL, "https://example.com/api?page=2&access_token=redacted-") {
+					t.Errorf("Expected the token parameter to be hashed, got %s", resource.URL)
+				}
+				if !strings.HasPrefix(resource.RequestHeaders["Authorization"], "Bearer redacted-") {
+					t.Errorf("Expected the authorization scheme to be kept, got %q", resource.RequestHeaders["Authorization"])
+				}
+				if cookie := resource.RawHeaders["Set-Cookie"]; !strings.HasPrefix(cookie, "session=redacted-") || !strings.HasSuffix(cookie, "; Path=/; HttpOnly") {
+					t.Errorf("Expected the cookie name and attributes to be kept, got %q", cookie)
+				}
+			}
+		})
+	}
+
+	if transaction.RequestHeaders["Authorization"] != "Bearer secret-bearer" {
+		t.Error("Expected the recorded transaction to keep its headers")
+	}
+	if _, err := NewRedaction(&Redaction{Mode: "mask"}); err == nil {
+		t.Error("Expected an unknown mode to be rejected")
+	}
+}
+
+func TestPersistenceManager_BodyScrubbing(t *testing.T) {
+	redaction, err := NewRedaction(&Redaction{Bodies: []BodyRule{
+		{ContentTypes: []string{"application/json"}, JSONPaths: []string{"$.access_token", "$.users[*].email", "$..password"}},
+		{ContentTypes: []string{"text/*"}, Pattern: `csrf=[0-9a-f]+`, Replacement: "csrf=0"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create redaction: %v", err)
+	}
+
+	status := 200
+	newTransaction := func(url, contentType, body string) types.RecordingTransaction {
+		return types.RecordingTransaction{
+			Method:           "GET",
+			URL:              url,
+			RequestStarted:   time.Now(),
+			ResponseStarted:  time.Now(),
+			ResponseFinished: time.Now(),
+			StatusCode:       &status,
+			RawHeaders:       types.HttpHeaders{"Content-Type": contentType},
+			Body:             []byte(body),
+		}
+	}
+	transactions := []types.RecordingTransaction{
+		newTransaction("https://example.com/token.json", "application/json; charset=utf-8",
+			`{"access_token":"secret-1","expires":3600,"users":[{"email":"secret-2","name":"a"}],"nested":{"password":"secret-3"}}`),
+		newTransaction("https://example.com/page.txt", "text/plain", "csrf=deadbeef&keep=1"),
+		newTransaction("https://example.com/other.json", "application/json", `{"id":1}`),
+	}
+
+	dir := t.TempDir()
+	pm := NewPersistenceManager(dir)
+	pm.Redaction = redaction
+	pm.Summary = &RecordingSummary{}
+	if err := pm.SaveRecordedTransactions(transactions, transactions[0].URL); err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "contents/get/https/example.com/token.json"))
+	if err != nil {
+		t.Fatalf("Failed to read content: %v", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("Failed to parse scrubbed JSON: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Expected no secrets in the content, got %s", data)
+	}
+	if body["access_token"] != "REDACTED" || body["expires"] != float64(3600) {
+		t.Errorf("Expected only the token to be replaced, got %v", body)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dir, "contents/get/https/example.com/page.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read content: %v", err)
+	}
+	if string(data) != "csrf=0&keep=1" {
+		t.Errorf("Expected the pattern to be replaced, got %q", data)
+	}
+	if pm.Summary.Scrubbed != 2 {
+		t.Errorf("Expected 2 scrubbed bodies, got %d", pm.Summary.Scrubbed)
+	}
+
+	for _, rule := range []BodyRule{{}, {Pattern: "("}, {JSONPaths: []string{"access_token"}}, {JSONPaths: []string{"$.a[x]"}}} {
+		if _, err := NewRedaction(&Redaction{Bodies: []BodyRule{rule}}); err == nil {
+			t.Errorf("Expected body rule %+v to be rejected", rule)
+		}
+	}
+}
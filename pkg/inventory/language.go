@@ -0,0 +1,101 @@
+package inventory
+
+import (
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// localesDir holds the content of responses negotiated into another language than the first one
+// recorded for their method and URL, by language
+const localesDir = "locales"
+
+// documentLanguageScan is how much of an HTML document is searched for the lang attribute
+const documentLanguageScan = 16 * 1024
+
+var htmlLangPattern = regexp.MustCompile(`(?is)<html\b[^>]*?\slang\s*=\s*["']?([A-Za-z0-9_-]+)`)
+
+// NormalizeLanguage returns a language tag in its canonical case (ja, en-US, zh-Hant-TW), or "" if
+// it is empty or a wildcard
+func NormalizeLanguage(tag string) string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || tag == "*" {
+		return ""
+	}
+	subtags := strings.Split(strings.ReplaceAll(tag, "_", "-"), "-")
+	for i, subtag := range subtags {
+		switch {
+		case i == 0:
+			subtags[i] = strings.ToLower(subtag)
+		case len(subtag) == 2:
+			subtags[i] = strings.ToUpper(subtag)
+		case len(subtag) == 4:
+			subtags[i] = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		default:
+			subtags[i] = strings.ToLower(subtag)
+		}
+	}
+	return strings.Join(subtags, "-")
+}
+
+// DocumentLanguage returns the lang attribute of the <html> element of a decoded HTML document
+func DocumentLanguage(body []byte) string {
+	if len(body) > documentLanguageScan {
+		body = body[:documentLanguageScan]
+	}
+	match := htmlLangPattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return NormalizeLanguage(string(match[1]))
+}
+
+// ResponseLanguage returns the language of a response: the first language of its Content-Language
+// header, else the lang attribute of an HTML document. body is the decoded body.
+func ResponseLanguage(headers types.HttpHeaders, body []byte) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Content-Language") {
+			first, _, _ := strings.Cut(value, ",")
+			if language := NormalizeLanguage(first); language != "" {
+				return language
+			}
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(headers["Content-Type"])
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return ""
+	}
+	return DocumentLanguage(body)
+}
+
+// transactionLanguage returns the language of a recorded response, decoding its body if needed
+func transactionLanguage(transaction *types.RecordingTransaction) string {
+	body := transaction.Body
+	if contentEncoding := transaction.RawHeaders["Content-Encoding"]; contentEncoding != "" && len(body) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(transaction.RawHeaders["Content-Type"])
+		if transaction.RawHeaders["Content-Language"] == "" && mediaType == "text/html" {
+			if decoded, err := encoding.DecodeData(body, types.ContentEncodingType(strings.ToLower(contentEncoding))); err == nil {
+				body = decoded
+			}
+		}
+	}
+	return ResponseLanguage(transaction.RawHeaders, body)
+}
+
+// localeVariantPath returns where the content of a response in another language than the first
+// one recorded for its method and URL is saved
+func localeVariantPath(contentFilePath, language string) string {
+	return path.Join(localesDir, language, contentFilePath)
+}
+
+// resourceLanguage returns the language of a resource, or "" if it has none
+func resourceLanguage(resource *types.Resource) string {
+	if resource.Language == nil {
+		return ""
+	}
+	return *resource.Language
+}
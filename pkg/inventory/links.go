@@ -0,0 +1,313 @@
+package inventory
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// hintRels are the Link relations that make a browser fetch or connect ahead of time
+var hintRels = []string{"preload", "modulepreload", "prefetch", "preconnect", "dns-prefetch"}
+
+// Link is one entry of a Link header
+type Link struct {
+	Target string
+	// Rel is the space-separated list of relations, lower-cased
+	Rel string
+	As  string
+	// Raw is the entry as it appeared in the header
+	Raw string
+}
+
+// HasRel reports whether the link has the relation rel
+func (l Link) HasRel(rel string) bool {
+	for _, r := range strings.Fields(l.Rel) {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// hint returns the first hint relation of the link, or "" if it is not a hint
+func (l Link) hint() string {
+	for _, rel := range hintRels {
+		if l.HasRel(rel) {
+			return rel
+		}
+	}
+	return ""
+}
+
+// ParseLinks parses the entries of a Link header value; entries without a <target> are skipped
+func ParseLinks(value string) []Link {
+	var links []Link
+	for _, raw := range splitLinks(value) {
+		raw = strings.TrimSpace(raw)
+		if !strings.HasPrefix(raw, "<") {
+			continue
+		}
+		end := strings.Index(raw, ">")
+		if end < 0 {
+			continue
+		}
+		link := Link{Target: strings.TrimSpace(raw[1:end]), Raw: raw}
+		for _, param := range strings.Split(raw[end+1:], ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "rel":
+				link.Rel = strings.ToLower(value)
+			case "as":
+				link.As = strings.ToLower(value)
+			}
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// splitLinks splits a Link header value on the commas outside targets and quoted parameters
+func splitLinks(value string) []string {
+	var entries []string
+	inTarget, inQuotes := false, false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '"' && !inTarget:
+			inQuotes = !inQuotes
+		case c == '<' && !inQuotes:
+			inTarget = true
+		case c == '>' && !inQuotes:
+			inTarget = false
+		case c == ',' && !inTarget && !inQuotes:
+			entries = append(entries, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(entries, value[start:])
+}
+
+// LinkRule strips the Link hints of one relation from replayed responses, or delays the responses
+// of the resources they hint at
+type LinkRule struct {
+	Rel   string
+	Strip bool
+	Delay time.Duration
+}
+
+// ParseLinkRules parses REL=strip and REL=delay:DURATION rules, e.g. preload=delay:300ms
+func ParseLinkRules(specs []string) ([]LinkRule, error) {
+	var rules []LinkRule
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		rel, action, ok := strings.Cut(spec, "=")
+		rel = strings.ToLower(strings.TrimSpace(rel))
+		if !ok || rel == "" {
+			return nil, fmt.Errorf("%q is not REL=strip or REL=delay:DURATION", spec)
+		}
+		if seen[rel] {
+			return nil, fmt.Errorf("more than one rule for rel=%s", rel)
+		}
+		seen[rel] = true
+
+		rule := LinkRule{Rel: rel}
+		if action == "strip" {
+			rule.Strip = true
+		} else if delay, ok := strings.CutPrefix(action, "delay:"); ok {
+			d, err := time.ParseDuration(delay)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("%q: delay must be a positive duration", spec)
+			}
+			rule.Delay = d
+		} else {
+			return nil, fmt.Errorf("%q: unknown action %q (strip or delay:DURATION)", spec, action)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// stripLinks removes the Link entries whose relation a rule strips
+func stripLinks(rawHeaders types.HttpHeaders, rules []LinkRule) {
+	for name, value := range rawHeaders {
+		if !strings.EqualFold(name, "Link") {
+			continue
+		}
+		var kept []string
+		for _, entry := range splitLinks(value) {
+			stripped := false
+			for _, link := range ParseLinks(entry) {
+				for _, rule := range rules {
+					stripped = stripped || (rule.Strip && link.HasRel(rule.Rel))
+				}
+			}
+			if !stripped && strings.TrimSpace(entry) != "" {
+				kept = append(kept, strings.TrimSpace(entry))
+			}
+		}
+		if len(kept) == 0 {
+			delete(rawHeaders, name)
+		} else {
+			rawHeaders[name] = strings.Join(kept, ", ")
+		}
+	}
+}
+
+// receivedLink is a Link entry of a recorded response and when it was received
+type receivedLink struct {
+	Link
+	// offsetMS is when the response carrying it was received, from the request start
+	offsetMS   int64
+	earlyHints bool
+}
+
+// resourceLinks returns the Link entries of a resource's Early Hints and final response
+func resourceLinks(resource *types.Resource) []receivedLink {
+	var links []receivedLink
+	for _, response := range resource.Informational {
+		if response.StatusCode != http.StatusEarlyHints {
+			continue
+		}
+		for _, link := range ParseLinks(headerValue(response.RawHeaders, "Link")) {
+			links = append(links, receivedLink{Link: link, offsetMS: response.OffsetMS, earlyHints: true})
+		}
+	}
+	for _, link := range ParseLinks(headerValue(resource.RawHeaders, "Link")) {
+		links = append(links, receivedLink{Link: link, offsetMS: resource.TTFBMS})
+	}
+	return links
+}
+
+// resolveLink returns the absolute URL of a link target relative to the resource carrying it
+func resolveLink(base, target string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return target
+	}
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return target
+	}
+	return baseURL.ResolveReference(targetURL).String()
+}
+
+// linkDelays returns how much to delay the resources hinted at by a relation with a delay rule,
+// by URL
+func linkDelays(resources []types.Resource, rules []LinkRule) map[string]time.Duration {
+	delays := make(map[string]time.Duration)
+	for i := range resources {
+		for _, link := range resourceLinks(&resources[i]) {
+			for _, rule := range rules {
+				if rule.Delay > 0 && link.HasRel(rule.Rel) {
+					target := resolveLink(resources[i].URL, link.Target)
+					delays[target] = max(delays[target], rule.Delay)
+				}
+			}
+		}
+	}
+	return delays
+}
+
+// delayTransaction postpones the response of a transaction, body included
+func delayTransaction(transaction *types.PlaybackTransaction, delay time.Duration) {
+	transaction.TTFB += delay
+	for i := range transaction.Chunks {
+		if transaction.Chunks[i].TargetOffset > 0 {
+			transaction.Chunks[i].TargetOffset += delay
+		}
+	}
+}
+
+// PreloadHint is a Link hint (preload, modulepreload, prefetch, preconnect or dns-prefetch) of a
+// recorded response, with when its target was requested
+type PreloadHint struct {
+	// Document is the URL of the response carrying the hint
+	Document string
+	Rel      string
+	As       string
+	// Target is the absolute URL hinted at
+	Target string
+	// EarlyHints is set when the hint came in a 103 Early Hints response
+	EarlyHints bool
+	// HintMS is when the hint was received, from the request start of the document
+	HintMS int64
+	// RequestedMS is when the target, or for preconnect and dns-prefetch the first request to
+	// its host, was requested from the request start of the document; nil if it never was
+	RequestedMS *int64
+}
+
+// PreloadHints lists the Link hints of the recorded responses in inventory order. A hint repeated
+// in the final response after Early Hints is listed once.
+func (pm *PersistenceManager) PreloadHints() ([]PreloadHint, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	var hints []PreloadHint
+	for i := range inventory.Resources {
+		document := &inventory.Resources[i]
+		seen := make(map[string]bool)
+		for _, link := range resourceLinks(document) {
+			rel := link.hint()
+			if rel == "" {
+				continue
+			}
+			target := resolveLink(document.URL, link.Target)
+			if seen[rel+" "+target] {
+				continue
+			}
+			seen[rel+" "+target] = true
+
+			hint := PreloadHint{
+				Document:   document.URL,
+				Rel:        rel,
+				As:         link.As,
+				Target:     target,
+				EarlyHints: link.earlyHints,
+				HintMS:     link.offsetMS,
+			}
+			if requested, ok := firstRequest(inventory.Resources, document, rel, target); ok {
+				hint.RequestedMS = &requested
+			}
+			hints = append(hints, hint)
+		}
+	}
+	return hints, nil
+}
+
+// firstRequest returns when the target of a hint was first requested after the document, from the
+// request start of the document. Connection hints match any request to the host of the target.
+func firstRequest(resources []types.Resource, document *types.Resource, rel, target string) (int64, bool) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return 0, false
+	}
+	var first time.Time
+	for i := range resources {
+		resource := &resources[i]
+		if resource == document || resource.Timestamp.Before(document.Timestamp) {
+			continue
+		}
+		if rel == "preconnect" || rel == "dns-prefetch" {
+			resourceURL, err := url.Parse(resource.URL)
+			if err != nil || resourceURL.Hostname() != targetURL.Hostname() {
+				continue
+			}
+		} else if resource.URL != target {
+			continue
+		}
+		if first.IsZero() || resource.Timestamp.Before(first) {
+			first = resource.Timestamp
+		}
+	}
+	if first.IsZero() {
+		return 0, false
+	}
+	return first.Sub(document.Timestamp).Milliseconds(), true
+}
@@ -0,0 +1,505 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// localizeColumns is the header of a translation CSV
+var localizeColumns = []string{"method", "url", "key", "source", "translation"}
+
+// localizedAttributes are the HTML attributes holding text shown to the user
+var localizedAttributes = map[string]bool{"alt": true, "title": true, "placeholder": true, "aria-label": true}
+
+// TextEntry is a piece of text in an HTML or JSON resource that can be translated
+type TextEntry struct {
+	Method string
+	URL    string
+	// Key locates the text in its resource: text:N for the Nth text of an HTML document,
+	// <attribute>:N for the Nth attribute of that name, and a JSON pointer for JSON values
+	Key  string
+	Text string
+	// Translation replaces Text in the localized inventory, unless empty
+	Translation string
+}
+
+// LocalizeReport describes a localized inventory
+type LocalizeReport struct {
+	Resources  int
+	Translated int
+	// Stale lists translations whose source text is no longer in the inventory
+	Stale []TextEntry
+}
+
+// textSpan is where a translatable text sits in a body
+type textSpan struct {
+	key        string
+	text       string
+	start, end int
+	encode     func(string) string
+}
+
+// ExtractTexts lists the translatable texts of every HTML and JSON resource, in inventory order
+func (pm *PersistenceManager) ExtractTexts() ([]TextEntry, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TextEntry
+	seen := make(map[string]bool)
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		// Variants of a URL share one set of translations
+		key := resource.Method + " " + resource.URL
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		spans, _, err := pm.localizableSpans(resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", resource.URL, err)
+		}
+		for _, span := range spans {
+			entries = append(entries, TextEntry{Method: resource.Method, URL: resource.URL, Key: span.key, Text: span.text})
+		}
+	}
+	return entries, nil
+}
+
+// WriteTextsCSV writes texts as a translation CSV with an empty translation column
+func WriteTextsCSV(w io.Writer, entries []TextEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(localizeColumns); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := writer.Write([]string{entry.Method, entry.URL, entry.Key, entry.Text, entry.Translation}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadTranslationsCSV reads a translation CSV written by WriteTextsCSV, skipping untranslated rows
+func ReadTranslationsCSV(r io.Reader) ([]TextEntry, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range localizeColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV has no %q column", name)
+		}
+	}
+
+	var entries []TextEntry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		entry := TextEntry{
+			Method:      record[columns["method"]],
+			URL:         record[columns["url"]],
+			Key:         record[columns["key"]],
+			Text:        record[columns["source"]],
+			Translation: record[columns["translation"]],
+		}
+		if entry.Translation != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Localize writes a copy of the inventory to outputDir with the translations applied. A translation
+// is applied only while its source text is still at its key, so a re-recorded page does not get
+// translations meant for other text.
+func (pm *PersistenceManager) Localize(outputDir string, translations []TextEntry) (*LocalizeReport, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	byResource := make(map[string]map[string]TextEntry)
+	for _, translation := range translations {
+		key := translation.Method + " " + translation.URL
+		if byResource[key] == nil {
+			byResource[key] = make(map[string]TextEntry)
+		}
+		byResource[key][translation.Key] = translation
+	}
+
+	output := NewPersistenceManager(outputDir)
+	output.Sync = pm.Sync
+	report := &LocalizeReport{}
+	applied := make(map[string]bool)
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		resourceKey := resource.Method + " " + resource.URL
+		if resource.ContentFilePath != nil {
+			srcPath := ContentFile(pm.BaseDir, *resource.ContentFilePath)
+			dstPath := filepath.Join(outputDir, "contents", *resource.ContentFilePath)
+			if err := copyFile(srcPath, dstPath); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to copy content for %s: %w", resource.URL, err)
+			}
+		}
+		if resource.OriginalFilePath != nil {
+			srcPath := OriginalFile(pm.BaseDir, *resource.OriginalFilePath)
+			dstPath := OriginalFile(outputDir, *resource.OriginalFilePath)
+			if err := copyFile(srcPath, dstPath); err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to copy original content for %s: %w", resource.URL, err)
+			}
+		}
+		wanted := byResource[resourceKey]
+		if len(wanted) == 0 {
+			continue
+		}
+
+		spans, body, err := pm.localizableSpans(resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", resource.URL, err)
+		}
+		var chosen []textSpan
+		for _, span := range spans {
+			translation, ok := wanted[span.key]
+			if !ok || translation.Text != span.text {
+				continue
+			}
+			applied[resourceKey+" "+span.key] = true
+			span.text = translation.Translation
+			chosen = append(chosen, span)
+		}
+		if len(chosen) == 0 {
+			continue
+		}
+		if err := output.writeLocalized(resource, replaceSpans(body, chosen)); err != nil {
+			return nil, fmt.Errorf("failed to localize %s: %w", resource.URL, err)
+		}
+		report.Resources++
+		report.Translated += len(chosen)
+	}
+
+	for _, translation := range translations {
+		if !applied[translation.Method+" "+translation.URL+" "+translation.Key] {
+			report.Stale = append(report.Stale, translation)
+		}
+	}
+
+	if err := output.SaveInventory(inventory); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// localizableSpans returns the translatable texts of a resource with its body
+func (pm *PersistenceManager) localizableSpans(resource *types.Resource) ([]textSpan, []byte, error) {
+	mimeType := resourceMime(resource)
+	isJSON := mimeType == "application/json" || strings.HasSuffix(mimeType, "+json")
+	if mimeType != "text/html" && mimeType != "application/xhtml+xml" && !isJSON {
+		return nil, nil, nil
+	}
+	// Content that could not be converted to UTF-8 is stored as-is and must not be rewritten
+	if resource.ContentCharset != nil && strings.HasSuffix(*resource.ContentCharset, "-failed") {
+		return nil, nil, nil
+	}
+	if resource.ContentBase64 != nil {
+		return nil, nil, nil
+	}
+	body, err := pm.ReadContent(resource)
+	if err != nil {
+		if resource.ContentFilePath != nil && errors.Is(err, os.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	if isJSON {
+		return jsonTextSpans(body), body, nil
+	}
+	return htmlTextSpans(body), body, nil
+}
+
+// replaceSpans replaces each span of body with the encoded text of the span
+func replaceSpans(body []byte, spans []textSpan) []byte {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	var out bytes.Buffer
+	last := 0
+	for _, span := range spans {
+		out.Write(body[last:span.start])
+		out.WriteString(span.encode(span.text))
+		last = span.end
+	}
+	out.Write(body[last:])
+	return out.Bytes()
+}
+
+// writeLocalized stores the localized body of a resource in the output inventory
+func (pm *PersistenceManager) writeLocalized(resource *types.Resource, body []byte) error {
+	if resource.ContentUTF8 != nil {
+		content := string(body)
+		resource.ContentUTF8 = &content
+		return nil
+	}
+	filePath := ContentFile(pm.BaseDir, *resource.ContentFilePath)
+	if err := pm.writeContent(filePath, body, 0644); err != nil {
+		return fmt.Errorf("failed to write content file: %w", err)
+	}
+	// The content as received is untranslated, so the localized file is replayed instead
+	if resource.OriginalFilePath != nil {
+		if err := os.Remove(OriginalFile(pm.BaseDir, *resource.OriginalFilePath)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove original content: %w", err)
+		}
+		resource.OriginalFilePath = nil
+	}
+	// Keep recorded checksums valid for intentionally rewritten files
+	if resource.ContentSHA256 != nil {
+		return setContentChecksum(resource, filePath)
+	}
+	return nil
+}
+
+// hasLetter reports whether s contains a letter, which tells text from markup whitespace and numbers
+func hasLetter(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+// htmlTextSpans finds the text nodes and text attributes of an HTML document. Script and style
+// contents are skipped; surrounding whitespace stays outside the spans.
+func htmlTextSpans(body []byte) []textSpan {
+	var spans []textSpan
+	counts := make(map[string]int)
+	add := func(kind string, start, end int) {
+		raw := string(body[start:end])
+		trimmed := strings.TrimSpace(raw)
+		if !hasLetter(trimmed) {
+			return
+		}
+		start += strings.Index(raw, trimmed)
+		counts[kind]++
+		spans = append(spans, textSpan{
+			key:    kind + ":" + strconv.Itoa(counts[kind]),
+			text:   html.UnescapeString(trimmed),
+			start:  start,
+			end:    start + len(trimmed),
+			encode: html.EscapeString,
+		})
+	}
+
+	for i := 0; i < len(body); {
+		if body[i] != '<' {
+			end := bytes.IndexByte(body[i:], '<')
+			if end < 0 {
+				end = len(body) - i
+			}
+			add("text", i, i+end)
+			i += end
+			continue
+		}
+
+		switch rest := body[i:]; {
+		case bytes.HasPrefix(rest, []byte("<!--")):
+			i = skipPast(body, i+4, "-->")
+		case bytes.HasPrefix(rest, []byte("<!")), bytes.HasPrefix(rest, []byte("<?")), bytes.HasPrefix(rest, []byte("</")):
+			i = skipPast(body, i+2, ">")
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			name, end, attrs := scanStartTag(body, i)
+			for _, attr := range attrs {
+				if localizedAttributes[attr.name] {
+					add(attr.name, attr.start, attr.end)
+				}
+			}
+			i = end
+			if name == "script" || name == "style" {
+				closing := bytes.Index(bytes.ToLower(body[i:]), []byte("</"+name))
+				if closing < 0 {
+					return spans
+				}
+				i += closing
+			}
+		default:
+			end := bytes.IndexByte(body[i+1:], '<')
+			if end < 0 {
+				end = len(body) - i - 1
+			}
+			add("text", i, i+1+end)
+			i += 1 + end
+		}
+	}
+	return spans
+}
+
+// tagAttribute is a quoted attribute value of a start tag
+type tagAttribute struct {
+	name       string
+	start, end int
+}
+
+// scanStartTag reads the start tag at body[i], returning its lower-cased name, the index after
+// it and its quoted attribute values
+func scanStartTag(body []byte, i int) (string, int, []tagAttribute) {
+	j := i + 1
+	for j < len(body) && !isSpace(body[j]) && body[j] != '>' && body[j] != '/' {
+		j++
+	}
+	name := strings.ToLower(string(body[i+1 : j]))
+
+	var attrs []tagAttribute
+	for j < len(body) && body[j] != '>' {
+		if isSpace(body[j]) || body[j] == '/' {
+			j++
+			continue
+		}
+		start := j
+		for j < len(body) && !isSpace(body[j]) && body[j] != '=' && body[j] != '>' {
+			j++
+		}
+		attrName := strings.ToLower(string(body[start:j]))
+		for j < len(body) && isSpace(body[j]) {
+			j++
+		}
+		if j >= len(body) || body[j] != '=' {
+			continue
+		}
+		j++
+		for j < len(body) && isSpace(body[j]) {
+			j++
+		}
+		if j < len(body) && (body[j] == '"' || body[j] == '\'') {
+			end := bytes.IndexByte(body[j+1:], body[j])
+			if end < 0 {
+				return name, len(body), attrs
+			}
+			attrs = append(attrs, tagAttribute{name: attrName, start: j + 1, end: j + 1 + end})
+			j += end + 2
+			continue
+		}
+		for j < len(body) && !isSpace(body[j]) && body[j] != '>' {
+			j++
+		}
+	}
+	if j < len(body) {
+		j++
+	}
+	return name, j, attrs
+}
+
+// skipPast returns the index after the next occurrence of marker from i, or the end of body
+func skipPast(body []byte, i int, marker string) int {
+	if i > len(body) {
+		return len(body)
+	}
+	end := bytes.Index(body[i:], []byte(marker))
+	if end < 0 {
+		return len(body)
+	}
+	return i + end + len(marker)
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// jsonTextSpans finds the string values of a JSON document that read as text, keyed by JSON
+// pointer. URLs, paths and strings without letters are left out. An invalid document has none.
+func jsonTextSpans(body []byte) []textSpan {
+	type container struct {
+		object bool
+		key    string
+		index  int
+	}
+	var stack []*container
+	var spans []textSpan
+	encode := func(s string) string {
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(s)
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	expectKey := false
+	for {
+		previous := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return spans
+		}
+		if err != nil {
+			return nil
+		}
+
+		// A key names the value that follows it
+		if key, ok := token.(string); ok && expectKey {
+			stack[len(stack)-1].key = key
+			expectKey = false
+			continue
+		}
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			expectKey = len(stack) > 0 && stack[len(stack)-1].object
+			continue
+		}
+		if len(stack) > 0 {
+			top := stack[len(stack)-1]
+			top.index++
+			expectKey = top.object
+		}
+		if isDelim {
+			stack = append(stack, &container{object: delim == '{', index: -1})
+			expectKey = delim == '{'
+			continue
+		}
+
+		text, ok := token.(string)
+		if !ok || !hasLetter(text) || strings.Contains(text, "://") || strings.HasPrefix(text, "/") {
+			continue
+		}
+		start := previous + bytes.IndexByte(body[previous:], '"')
+		var pointer strings.Builder
+		for _, c := range stack {
+			pointer.WriteByte('/')
+			if c.object {
+				pointer.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(c.key))
+			} else {
+				pointer.WriteString(strconv.Itoa(c.index))
+			}
+		}
+		spans = append(spans, textSpan{
+			key:    pointer.String(),
+			text:   text,
+			start:  start,
+			end:    int(decoder.InputOffset()),
+			encode: encode,
+		})
+	}
+}
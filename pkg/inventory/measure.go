@@ -0,0 +1,57 @@
+package inventory
+
+import (
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// EncodingMeasurement is the cost of encoding one resource's content with each measured codec
+type EncodingMeasurement struct {
+	URL         string
+	ContentType string
+	// Recorded is the encoding the resource was recorded and is replayed with, if any
+	Recorded types.ContentEncodingType
+	// Size is the stored (decoded) size of the content
+	Size    int
+	Results []encoding.Measurement
+	Err     error
+}
+
+// MeasureEncodings encodes the content of every resource with each codec, so the codecs and
+// levels worth storing or replaying a corpus with can be compared
+func (pm *PersistenceManager) MeasureEncodings(codecs []encoding.Codec) ([]EncodingMeasurement, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	var measurements []EncodingMeasurement
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		data, err := pm.ReadContent(resource)
+		if err == nil && len(data) == 0 {
+			continue
+		}
+
+		measurement := EncodingMeasurement{URL: resource.URL, Size: len(data), Err: err}
+		if resource.ContentTypeMime != nil {
+			measurement.ContentType = *resource.ContentTypeMime
+		}
+		if resource.ContentEncoding != nil {
+			measurement.Recorded = *resource.ContentEncoding
+		}
+		for _, codec := range codecs {
+			if measurement.Err != nil {
+				break
+			}
+			result, err := encoding.Measure(data, codec)
+			if err != nil {
+				measurement.Err = err
+				break
+			}
+			measurement.Results = append(measurement.Results, result)
+		}
+		measurements = append(measurements, measurement)
+	}
+	return measurements, nil
+}
@@ -0,0 +1,65 @@
+package inventory
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-http-playback-proxy/pkg/resource"
+)
+
+// MemoryFiles holds the files of an inventory by slash-separated path from its root, so it can be
+// played back without an inventory directory
+type MemoryFiles map[string][]byte
+
+// Size returns the total size of the files
+func (f MemoryFiles) Size() int64 {
+	var size int64
+	for _, data := range f {
+		size += int64(len(data))
+	}
+	return size
+}
+
+// lookup returns a file by its path, or a file differing only in case like ContentFile does
+func (f MemoryFiles) lookup(name string) ([]byte, bool) {
+	if data, ok := f[name]; ok {
+		return data, true
+	}
+	for path, data := range f {
+		if strings.EqualFold(path, name) {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// readFile reads a file of the inventory by its slash-separated path from the inventory root
+func (pm *PlaybackManager) readFile(name string) ([]byte, error) {
+	if pm.Files == nil {
+		return os.ReadFile(filepath.Join(pm.BaseDir, filepath.FromSlash(name)))
+	}
+	if data, ok := pm.Files.lookup(name); ok {
+		return data, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// readContent reads the content file of a resource
+func (pm *PlaybackManager) readContent(contentFilePath string) ([]byte, error) {
+	if pm.Files == nil {
+		return os.ReadFile(ContentFile(pm.BaseDir, contentFilePath))
+	}
+	return pm.readFile("contents/" + resource.NormalizeFilePath(contentFilePath))
+}
+
+// HasInventory reports whether there is an inventory.json to play back
+func (pm *PlaybackManager) HasInventory() bool {
+	if pm.Files != nil {
+		_, ok := pm.Files["inventory.json"]
+		return ok
+	}
+	_, err := os.Stat(filepath.Join(pm.BaseDir, "inventory.json"))
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// originalsDir holds the content of responses as received when their content file was normalized,
+// under the same paths as in contents/
+const originalsDir = "originals"
+
+// isJSONMediaType reports whether a Content-Type is JSON (application/json or a +json type)
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// NormalizeJSON returns a JSON document with sorted keys, two-space indentation and a trailing
+// newline, so recording unchanged data again gives the same file. ok is false when body is not a
+// single JSON value.
+func NormalizeJSON(body []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, false
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	// Maps are encoded with sorted keys; the encoder ends the document with a newline
+	var normalized bytes.Buffer
+	encoder := json.NewEncoder(&normalized)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return nil, false
+	}
+	return normalized.Bytes(), true
+}
+
+// OriginalFile returns the path of the content of a resource as received
+func OriginalFile(baseDir, originalFilePath string) string {
+	return filepath.Join(baseDir, originalsDir, filepath.FromSlash(originalFilePath))
+}
+
+// normalizeContent returns the decoded body of a resource in the form its content file is saved in.
+// A body saved in another form than received is kept under originals/ if pm keeps originals.
+func (pm *PersistenceManager) normalizeContent(resource *types.Resource, contentType string, body []byte) ([]byte, error) {
+	resource.OriginalFilePath = nil
+	if !pm.NormalizeJSON || !isJSONMediaType(contentType) || resource.ContentFilePath == nil {
+		return body, nil
+	}
+	normalized, ok := NormalizeJSON(body)
+	if !ok || bytes.Equal(normalized, body) {
+		return body, nil
+	}
+
+	if pm.KeepOriginals {
+		originalPath := OriginalFile(pm.BaseDir, *resource.ContentFilePath)
+		if err := os.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := pm.writeContent(originalPath, body, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write original content: %w", err)
+		}
+		originalFilePath := *resource.ContentFilePath
+		resource.OriginalFilePath = &originalFilePath
+	}
+	if pm.Summary != nil {
+		pm.Summary.Normalized++
+	}
+	return normalized, nil
+}
+
+// copyOriginal copies the original content of a resource from one inventory directory to another
+func copyOriginal(srcDir, dstDir string, resource *types.Resource) error {
+	if resource.OriginalFilePath == nil {
+		return nil
+	}
+	srcPath := OriginalFile(srcDir, *resource.OriginalFilePath)
+	if err := copyFile(srcPath, OriginalFile(dstDir, *resource.OriginalFilePath)); err != nil {
+		return fmt.Errorf("failed to copy original content for %s: %w", resource.URL, err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package inventory
+
+import (
+	"go-http-playback-proxy/pkg/types"
+)
+
+// omittedBodySize returns the recorded size of a body left out of the recording, or 0
+func omittedBodySize(resource *types.Resource) int {
+	if resource.BodyOmitted == nil || !*resource.BodyOmitted || resource.WireSize == nil {
+		return 0
+	}
+	return int(*resource.WireSize)
+}
+
+// paddingChunks stands in for an omitted body with zero bytes of its recorded size, paced like the
+// recorded body. The chunks share one buffer, so huge bodies take no more memory than a chunk.
+func (pm *PlaybackManager) paddingChunks(size int, resource *types.Resource) []types.BodyChunk {
+	padding := make([]byte, min(size, pm.ChunkSize))
+	return pm.timedChunks(size, resource, func(start, end int) []byte {
+		return padding[:end-start]
+	})
+}
@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"bytes"
+	"strings"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+const (
+	// gzipHeaderSize is the size of a gzip member header without optional fields
+	gzipHeaderSize = 10
+	// gzipFlagComment marks a zero-terminated comment after the header
+	gzipFlagComment = 0x10
+)
+
+// padToWireSize grows a re-encoded body to the size it was recorded with, so pacing derived from
+// the served size matches the recording. Bodies are never shrunk, and bodies that cannot be
+// padded without changing their content are returned as they are.
+func padToWireSize(body []byte, resource *types.Resource, bodyEncoding types.ContentEncodingType) []byte {
+	if resource.WireSize == nil || int64(len(body)) >= *resource.WireSize || len(resource.Parts) > 0 {
+		return body
+	}
+	missing := int(*resource.WireSize) - len(body)
+
+	switch bodyEncoding {
+	case types.ContentEncodingGzip:
+		if padded, ok := padGzip(body, missing); ok {
+			return padded
+		}
+	case types.ContentEncodingIdentity:
+		if padded, ok := padText(body, resource, missing); ok {
+			return padded
+		}
+	}
+	logger.Debug("Body cannot be padded to its recorded size", "url", resource.URL, "encoding", bodyEncoding, "missing", missing)
+	return body
+}
+
+// padGzip adds a header comment of missing bytes to a gzip stream, which decoders skip.
+// A missing byte count of 1 cannot be represented and is left as is.
+func padGzip(body []byte, missing int) ([]byte, bool) {
+	if len(body) < gzipHeaderSize || body[0] != 0x1f || body[1] != 0x8b {
+		return nil, false
+	}
+	// Optional fields would have to be moved and a header CRC recomputed
+	if body[3] != 0 {
+		return nil, false
+	}
+	if missing < 2 {
+		return body, true
+	}
+
+	padded := make([]byte, 0, len(body)+missing)
+	padded = append(padded, body[:gzipHeaderSize]...)
+	padded[3] = gzipFlagComment
+	padded = append(padded, bytes.Repeat([]byte{' '}, missing-1)...)
+	padded = append(padded, 0)
+	return append(padded, body[gzipHeaderSize:]...), true
+}
+
+// padText appends a comment of missing bytes to HTML, CSS and JavaScript
+func padText(body []byte, resource *types.Resource, missing int) ([]byte, bool) {
+	// Spaces and comment markers are only single bytes in ASCII-compatible charsets
+	if resource.ContentCharset != nil && strings.HasPrefix(strings.ToLower(*resource.ContentCharset), "utf-16") {
+		return nil, false
+	}
+
+	var prefix, suffix string
+	switch mime := resourceMime(resource); {
+	case mime == "text/html" || mime == "application/xhtml+xml":
+		prefix, suffix = "<!--", "-->"
+	case mime == "text/css" || strings.Contains(mime, "javascript"):
+		prefix, suffix = "/*", "*/"
+	default:
+		return nil, false
+	}
+	filler := missing - len(prefix) - len(suffix)
+	if filler < 0 {
+		return nil, false
+	}
+	padded := make([]byte, 0, len(body)+missing)
+	padded = append(padded, body...)
+	padded = append(padded, prefix...)
+	padded = append(padded, bytes.Repeat([]byte{' '}, filler)...)
+	return append(padded, suffix...), true
+}
+
+// resourceMime returns the lower-cased media type of a resource
+func resourceMime(resource *types.Resource) string {
+	if resource.ContentTypeMime == nil {
+		return ""
+	}
+	return strings.ToLower(*resource.ContentTypeMime)
+}
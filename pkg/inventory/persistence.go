@@ -3,22 +3,72 @@ package inventory
 import (
 	"encoding/json"
 	"fmt"
-	"log/slog"
 	"mime"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"go-http-playback-proxy/pkg/charset"
 	"go-http-playback-proxy/pkg/encoding"
 	"go-http-playback-proxy/pkg/formatting"
+	"go-http-playback-proxy/pkg/logging"
 	"go-http-playback-proxy/pkg/resource"
 	"go-http-playback-proxy/pkg/types"
 )
 
+var (
+	// logger is the logger for the inventory module
+	logger = logging.For(logging.ModuleInventory)
+	// encodingLogger is used for content encoding and charset conversion
+	encodingLogger = logging.For(logging.ModuleEncoding)
+)
+
+// prefetchDir holds the content of prefetch responses recorded next to a response for use
+const prefetchDir = "prefetch"
+
+// variantsDir holds the content of image formats negotiated by Accept, by media type, other than
+// the first format recorded for a URL
+const variantsDir = "variants"
+
+// repeatsDir holds the content of the responses kept after the first for the same request, by
+// their position
+const repeatsDir = "repeats"
+
+// imageType returns the media type of an image Content-Type, or "" for other content
+func imageType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "image/") {
+		return ""
+	}
+	return mediaType
+}
+
 // PersistenceManager handles saving recorded resources to disk
 type PersistenceManager struct {
 	BaseDir string
+	// Summary, if set, is updated with the save counters (resources, duplicates, beautified)
+	Summary *RecordingSummary
+	// Beautifier, if set, beautifies content files in the background after the inventory is saved;
+	// files it changes are not counted in Summary
+	Beautifier *BeautifyQueue
+	// Sync is the fsync policy for written files (empty means SyncInventory)
+	Sync SyncPolicy
+	// NormalizeJSON saves JSON content files with sorted keys, indentation and a trailing newline
+	NormalizeJSON bool
+	// KeepOriginals saves the received content of normalized files under originals/, which playback
+	// serves while the content file is unchanged
+	KeepOriginals bool
+	// Append keeps the resources of the inventory being replaced that were not recorded again
+	Append bool
+	// Redaction, if set, strips or hashes credentials in the headers and URLs of the saved transactions
+	Redaction *Redaction
+	// KeepRepeats keeps every response to the requests whose URL matches one of these expressions, in
+	// the order they were recorded, instead of only the newest
+	KeepRepeats []*regexp.Regexp
 }
 
 // NewPersistenceManager creates a new persistence manager
@@ -42,8 +92,69 @@ func (pm *PersistenceManager) SaveRecordedTransactionsWithOptions(
 	entryURL string,
 	noBeautify bool,
 ) error {
+	transactions = pm.Redaction.redactTransactions(transactions)
+	entryURL = pm.Redaction.RedactURL(entryURL)
+
 	// Use map to ensure unique resources by method+URL
 	resourceMap := make(map[string]*types.Resource)
+	// Content files left to the background beautifier, with their Content-Type
+	deferred := make(map[string]string)
+
+	// Prefetches of URLs that were also requested for use are kept as a separate variant
+	used := make(map[string]bool)
+	for _, transaction := range transactions {
+		if !transaction.Fetch.IsPrefetch() {
+			used[fmt.Sprintf("%s:%s", transaction.Method, transaction.URL)] = true
+		}
+	}
+
+	// Images served in several formats by Accept keep each format as a variant of the first
+	images := make(map[string]string)
+	for _, transaction := range transactions {
+		key := fmt.Sprintf("%s:%s", transaction.Method, transaction.URL)
+		if mediaType := imageType(transaction.RawHeaders["Content-Type"]); mediaType != "" && !transaction.Fetch.IsPrefetch() && images[key] == "" {
+			images[key] = mediaType
+		}
+	}
+
+	// Requests with another body than the first one recorded for their method and URL keep their
+	// responses as variants
+	bodies := make(map[string]string)
+	for _, transaction := range transactions {
+		key := fmt.Sprintf("%s:%s", transaction.Method, transaction.URL)
+		if _, exists := bodies[key]; !exists {
+			bodies[key] = transaction.RequestBodySHA256
+		}
+	}
+
+	// Responses negotiated into several languages keep each language as a variant of the first
+	languages := make(map[string]string)
+	for i := range transactions {
+		key := fmt.Sprintf("%s:%s", transactions[i].Method, transactions[i].URL)
+		if language := transactionLanguage(&transactions[i]); language != "" && languages[key] == "" {
+			languages[key] = language
+		}
+	}
+
+	// Content files are named so they do not overwrite each other on case-insensitive file systems
+	paths := make(contentPaths)
+
+	// Responses kept after the first for the same request, by key
+	repeats := make(map[string]int)
+
+	// Annotations and playback settings added to the inventory being replaced outlive recording the
+	// same resources again; when appending, its content files keep their names
+	previous, err := pm.LoadInventory()
+	if err != nil {
+		previous = nil
+	}
+	if previous != nil && pm.Append {
+		for _, resource := range previous.Resources {
+			if resource.ContentFilePath != nil {
+				paths.claim(*resource.ContentFilePath)
+			}
+		}
+	}
 
 	// Convert each RecordingTransaction to Resource
 	for _, transaction := range transactions {
@@ -54,14 +165,53 @@ func (pm *PersistenceManager) SaveRecordedTransactionsWithOptions(
 
 		// Create unique key from method and URL
 		key := fmt.Sprintf("%s:%s", resource.Method, resource.URL)
+		if resource.ContentFilePath == nil {
+			// Omitted bodies have no content file to keep apart from other variants
+		} else if transaction.Fetch.IsPrefetch() && used[key] {
+			key += " prefetch"
+			prefetchPath := path.Join(prefetchDir, *resource.ContentFilePath)
+			resource.ContentFilePath = &prefetchPath
+		} else if mediaType := imageType(transaction.RawHeaders["Content-Type"]); mediaType != "" && images[key] != "" && mediaType != images[key] {
+			key += " " + mediaType
+			variantPath := path.Join(variantsDir, mediaType, *resource.ContentFilePath)
+			resource.ContentFilePath = &variantPath
+		} else if language := resourceLanguage(resource); language != "" && languages[key] != "" && language != languages[key] {
+			key += " lang:" + language
+			variantPath := localeVariantPath(*resource.ContentFilePath, language)
+			resource.ContentFilePath = &variantPath
+		} else if transaction.RequestBodySHA256 != bodies[key] {
+			key += " body:" + transaction.RequestBodySHA256
+			variantPath := bodyVariantPath(*resource.ContentFilePath, transaction.RequestBodySHA256)
+			resource.ContentFilePath = &variantPath
+		}
+		if _, exists := resourceMap[key]; exists && pm.keepsRepeats(resource.URL) {
+			repeat := repeats[key] + 1
+			repeats[key] = repeat
+			key += " repeat:" + strconv.Itoa(repeat)
+			resource.Repeat = &repeat
+			if resource.ContentFilePath != nil {
+				repeatPath := path.Join(repeatsDir, strconv.Itoa(repeat), *resource.ContentFilePath)
+				resource.ContentFilePath = &repeatPath
+			}
+		}
+		if resource.ContentFilePath != nil {
+			claimed := paths.claim(*resource.ContentFilePath)
+			resource.ContentFilePath = &claimed
+		}
 
 		// Check if we already have this resource
 		if existingResource, exists := resourceMap[key]; exists {
+			// Keep track of every client that requested the resource
+			existingResource.Clients = mergeClients(existingResource.Clients, resource.Clients)
 			// Update existing resource if this one is newer or has more data
 			if resource.Timestamp.After(existingResource.Timestamp) ||
 				(resource.MBPS != nil && *resource.MBPS > 0 && (existingResource.MBPS == nil || *existingResource.MBPS == 0)) {
+				resource.Clients = existingResource.Clients
 				resourceMap[key] = resource
 			}
+			if pm.Summary != nil {
+				pm.Summary.Duplicates++
+			}
 			// Skip saving body if we're not updating the resource
 			continue
 		}
@@ -69,10 +219,17 @@ func (pm *PersistenceManager) SaveRecordedTransactionsWithOptions(
 		// Save decoded body to contents file and get charset information
 		if resource.ContentFilePath != nil {
 			contentsFilePath := filepath.Join(pm.BaseDir, "contents", *resource.ContentFilePath)
-			httpCharset, contentCharset, err := pm.saveDecodedBodyWithOptions(contentsFilePath, &transaction, noBeautify)
+			background := !noBeautify && pm.Beautifier.accepts(transaction.RawHeaders["Content-Type"])
+			httpCharset, contentCharset, err := pm.saveDecodedBodyWithOptions(contentsFilePath, resource, &transaction, noBeautify || background)
 			if err != nil {
 				return fmt.Errorf("failed to save decoded body: %w", err)
 			}
+			if err := setContentChecksum(resource, contentsFilePath); err != nil {
+				return err
+			}
+			if background {
+				deferred[*resource.ContentFilePath] = transaction.RawHeaders["Content-Type"]
+			}
 
 			// Update resource with charset information
 			if httpCharset != "" {
@@ -86,39 +243,81 @@ func (pm *PersistenceManager) SaveRecordedTransactionsWithOptions(
 		resourceMap[key] = resource
 	}
 
-	// Convert map to slice
+	// Convert map to slice, in the order the requests were sent so the first recording of a URL
+	// comes first and saving the same transactions gives the same file
 	var resources []types.Resource
 	for _, resource := range resourceMap {
 		resources = append(resources, *resource)
 	}
+	sort.SliceStable(resources, func(i, j int) bool {
+		if !resources[i].Timestamp.Equal(resources[j].Timestamp) {
+			return resources[i].Timestamp.Before(resources[j].Timestamp)
+		}
+		if resources[i].URL != resources[j].URL {
+			return resources[i].URL < resources[j].URL
+		}
+		if resources[i].Method != resources[j].Method {
+			return resources[i].Method < resources[j].Method
+		}
+		return resources[i].ContentFilePath != nil && (resources[j].ContentFilePath == nil || *resources[i].ContentFilePath < *resources[j].ContentFilePath)
+	})
+	if pm.Summary != nil {
+		pm.Summary.Resources += len(resources)
+	}
 
 	// Create inventory
 	inventory := types.Inventory{
 		EntryURL:  &entryURL,
+		Domains:   RecordedDomains(transactions),
 		Resources: resources,
 	}
+	if pm.Redaction != nil {
+		config, err := json.Marshal(pm.Redaction)
+		if err != nil {
+			return fmt.Errorf("failed to encode redaction: %w", err)
+		}
+		inventory.Redaction = config
+	}
+
+	if previous != nil {
+		keepMetadata(resources, previous.Resources)
+		inventory.Playback = previous.Playback
+		if pm.Append {
+			kept := keptResources(previous.Resources, resources)
+			inventory.Resources = append(kept, resources...)
+			inventory.Domains = mergeDomains(inventory.Domains, previous.Domains)
+			if pm.Summary != nil {
+				pm.Summary.Kept += len(kept)
+			}
+		}
+	}
 
 	// Save inventory.json
 	inventoryPath := filepath.Join(pm.BaseDir, "inventory.json")
-	err := pm.saveInventoryJSON(inventoryPath, &inventory)
-	if err != nil {
+	if err := pm.saveInventoryJSON(inventoryPath, &inventory); err != nil {
 		return fmt.Errorf("failed to save inventory: %w", err)
 	}
 
+	// The raw content is safely on disk, so beautification can no longer lose a response
+	pm.Beautifier.submit(pm, deferred)
+
 	return nil
 }
 
-// convertRecordingTransactionToResource converts RecordingTransaction to Resource
-func (pm *PersistenceManager) convertRecordingTransactionToResource(
-	transaction *types.RecordingTransaction,
-) (*types.Resource, error) {
+// TransactionTiming returns the TTFB in milliseconds and transfer speed in Mbps of a recorded
+// transaction. The TTFB leaves out the proxy's own overhead.
+func TransactionTiming(transaction *types.RecordingTransaction) (int64, float64) {
 	// Calculate TTFB (Time To First Byte)
 	var ttfbMS int64
 	if !transaction.ResponseStarted.IsZero() && !transaction.RequestStarted.IsZero() {
-		ttfbMS = transaction.ResponseStarted.Sub(transaction.RequestStarted).Milliseconds()
+		ttfb := transaction.ResponseStarted.Sub(transaction.RequestStarted)
+		if transaction.ProxyOverhead > 0 && transaction.ProxyOverhead < ttfb {
+			ttfb -= transaction.ProxyOverhead
+		}
+		ttfbMS = ttfb.Milliseconds()
 		// Sanity check: TTFB should be positive and reasonable (< 1 hour)
 		if ttfbMS < 0 || ttfbMS > 3600000 {
-			slog.Warn("Invalid TTFB, setting to 0", "ttfb_ms", ttfbMS)
+			logger.Warn("Invalid TTFB, setting to 0", "ttfb_ms", ttfbMS)
 			ttfbMS = 0
 		}
 	}
@@ -127,14 +326,23 @@ func (pm *PersistenceManager) convertRecordingTransactionToResource(
 	var mbpsValue float64
 	if !transaction.ResponseStarted.IsZero() && !transaction.ResponseFinished.IsZero() {
 		transferDuration := transaction.ResponseFinished.Sub(transaction.ResponseStarted)
-		if transferDuration > 0 && len(transaction.Body) > 0 {
+		if transferDuration > 0 && transaction.BodyLength() > 0 {
 			// Convert bytes to bits, then to megabits
-			totalBits := float64(len(transaction.Body) * 8)
+			totalBits := float64(transaction.BodyLength() * 8)
 			transferSeconds := transferDuration.Seconds()
 			mbpsValue = totalBits / (transferSeconds * 1024 * 1024)
 		}
 	}
 
+	return ttfbMS, mbpsValue
+}
+
+// convertRecordingTransactionToResource converts RecordingTransaction to Resource
+func (pm *PersistenceManager) convertRecordingTransactionToResource(
+	transaction *types.RecordingTransaction,
+) (*types.Resource, error) {
+	ttfbMS, mbpsValue := TransactionTiming(transaction)
+
 	// Get Content-Type details
 	contentType := transaction.RawHeaders["Content-Type"]
 	var contentTypeMime string
@@ -178,6 +386,71 @@ func (pm *PersistenceManager) convertRecordingTransactionToResource(
 		ContentFilePath: &contentFilePath,
 		Timestamp:       transaction.RequestStarted,
 	}
+	if transaction.ClientID != "" {
+		resource.Clients = []string{transaction.ClientID}
+	}
+	resource.Samples = transaction.Samples
+	resource.Parts = transaction.Parts
+	resource.Flushes = transaction.Flushes
+	resource.Informational = transaction.Informational
+	resource.Pushes = transaction.Pushes
+	resource.Tags = transaction.Tags
+	resource.Metadata = transaction.Metadata
+	resource.Fetch = transaction.Fetch
+	if transaction.Accept != "" && imageType(contentType) != "" {
+		accept := transaction.Accept
+		resource.Accept = &accept
+	}
+	if language := transactionLanguage(transaction); language != "" {
+		resource.Language = &language
+	}
+	if len(transaction.RequestHeaders) > 0 {
+		resource.RequestHeaders = transaction.RequestHeaders
+	}
+	// The hash stays that of the body as sent, so scrubbed requests still match during playback
+	requestBody, _ := pm.Redaction.scrubBody(transaction.RequestHeaders["Content-Type"], transaction.RequestBody)
+	setRequestBody(resource, requestBody)
+	if transaction.RequestBodySHA256 != "" {
+		bodyHash := transaction.RequestBodySHA256
+		resource.RequestBodySHA256 = &bodyHash
+	}
+	resource.HeaderWarnings = transaction.HeaderWarnings
+	if transaction.ProxyOverhead > 0 {
+		overheadMS := float64(transaction.ProxyOverhead.Microseconds()) / 1000
+		resource.ProxyOverheadMS = &overheadMS
+	}
+	resource.TLSSession = transaction.TLSSession
+	resource.Timings = transaction.Timings
+	if transaction.Protocol != "" {
+		protocol := transaction.Protocol
+		resource.Protocol = &protocol
+	}
+	resource.WebSocket = transaction.WebSocket
+	if cacheStatus := DetectCacheStatus(transaction.RawHeaders); cacheStatus != "" {
+		resource.CacheStatus = &cacheStatus
+	}
+
+	// Re-encoding during playback rarely reproduces the recorded size exactly
+	if transaction.BodyLength() > 0 {
+		wireSize := transaction.BodyLength()
+		resource.WireSize = &wireSize
+	}
+
+	// Only the size of an omitted body is kept, and playback serves that much padding
+	if transaction.BodyOmitted {
+		omitted := true
+		resource.BodyOmitted = &omitted
+		resource.ContentFilePath = nil
+	}
+
+	// Mark partially received bodies so playback can decide how to handle them
+	if transaction.Truncated {
+		truncated := true
+		bytesReceived := transaction.BodyLength()
+		resource.Truncated = &truncated
+		resource.BytesReceived = &bytesReceived
+		resource.ContentLength = transaction.ExpectedLength
+	}
 
 	// Only set content type fields if they have values
 	if contentTypeMime != "" {
@@ -195,24 +468,56 @@ func (pm *PersistenceManager) AppendRecordedTransaction(transaction *types.Recor
 	inventoryPath := filepath.Join(pm.BaseDir, "inventory.json")
 
 	// Load existing inventory
-	var inventory types.Inventory
+	inventory := &types.Inventory{}
 	if _, err := os.Stat(inventoryPath); err == nil {
 		// File exists, load it
 		data, err := os.ReadFile(inventoryPath)
 		if err != nil {
 			return fmt.Errorf("failed to read inventory file: %w", err)
 		}
-		if err := json.Unmarshal(data, &inventory); err != nil {
+		if inventory, err = DecodeInventory(data); err != nil {
 			return fmt.Errorf("failed to unmarshal inventory: %w", err)
 		}
 	}
 
 	// Convert and add the new transaction
+	if pm.Redaction != nil {
+		redacted := pm.Redaction.redactTransaction(*transaction)
+		transaction = &redacted
+	}
 	resource, err := pm.convertRecordingTransactionToResource(transaction)
 	if err != nil {
 		return fmt.Errorf("failed to convert recording transaction: %w", err)
 	}
 
+	// A response to another body than the ones already recorded for the method and URL is a variant
+	if resource.ContentFilePath != nil {
+		recordedURL, recordedBody := false, false
+		for i := range inventory.Resources {
+			existing := &inventory.Resources[i]
+			if existing.Method == resource.Method && existing.URL == resource.URL {
+				recordedURL = true
+				recordedBody = recordedBody || requestBodySHA256(existing) == transaction.RequestBodySHA256
+			}
+		}
+		if recordedURL && !recordedBody {
+			variantPath := bodyVariantPath(*resource.ContentFilePath, transaction.RequestBodySHA256)
+			resource.ContentFilePath = &variantPath
+		}
+	}
+
+	// Content files are named so they do not overwrite each other on case-insensitive file systems
+	if resource.ContentFilePath != nil {
+		paths := make(contentPaths)
+		for _, existing := range inventory.Resources {
+			if existing.ContentFilePath != nil {
+				paths.claim(*existing.ContentFilePath)
+			}
+		}
+		claimed := paths.claim(*resource.ContentFilePath)
+		resource.ContentFilePath = &claimed
+	}
+
 	// Create unique key from method and URL
 	key := fmt.Sprintf("%s:%s", resource.Method, resource.URL)
 
@@ -220,12 +525,18 @@ func (pm *PersistenceManager) AppendRecordedTransaction(transaction *types.Recor
 	updated := false
 	for i, existingResource := range inventory.Resources {
 		existingKey := fmt.Sprintf("%s:%s", existingResource.Method, existingResource.URL)
-		if existingKey == key {
+		if existingKey == key && requestBodySHA256(&existingResource) == transaction.RequestBodySHA256 {
+			resource.Clients = mergeClients(existingResource.Clients, resource.Clients)
+			resource.Metadata = mergeMetadata(existingResource.Metadata, resource.Metadata)
 			// Update existing resource if this one is newer or has more data
 			if resource.Timestamp.After(existingResource.Timestamp) ||
 				(resource.MBPS != nil && *resource.MBPS > 0 && (existingResource.MBPS == nil || *existingResource.MBPS == 0)) {
 				inventory.Resources[i] = *resource
 				updated = true
+			} else if len(resource.Clients) != len(existingResource.Clients) {
+				// Only the client list changed
+				inventory.Resources[i].Clients = resource.Clients
+				return pm.saveInventoryJSON(inventoryPath, inventory)
 			} else {
 				// Skip if existing resource is newer or has better data
 				return nil
@@ -237,10 +548,13 @@ func (pm *PersistenceManager) AppendRecordedTransaction(transaction *types.Recor
 	// Save decoded body only if we're adding or updating the resource
 	if resource.ContentFilePath != nil {
 		contentsFilePath := filepath.Join(pm.BaseDir, "contents", *resource.ContentFilePath)
-		httpCharset, contentCharset, err := pm.saveDecodedBody(contentsFilePath, transaction)
+		httpCharset, contentCharset, err := pm.saveDecodedBody(contentsFilePath, resource, transaction)
 		if err != nil {
 			return fmt.Errorf("failed to save decoded body: %w", err)
 		}
+		if err := setContentChecksum(resource, contentsFilePath); err != nil {
+			return err
+		}
 
 		// Update resource with charset information
 		if httpCharset != "" {
@@ -255,22 +569,24 @@ func (pm *PersistenceManager) AppendRecordedTransaction(transaction *types.Recor
 	if !updated {
 		inventory.Resources = append(inventory.Resources, *resource)
 	}
+	inventory.Domains = addDomain(inventory.Domains, transaction)
 
 	// Save updated inventory
-	if err := pm.saveInventoryJSON(inventoryPath, &inventory); err != nil {
+	if err := pm.saveInventoryJSON(inventoryPath, inventory); err != nil {
 		return fmt.Errorf("failed to save inventory: %w", err)
 	}
 
 	return nil
 }
 
-// saveDecodedBody saves the decoded body to a file and returns charset information
-func (pm *PersistenceManager) saveDecodedBody(filePath string, transaction *types.RecordingTransaction) (httpCharset, contentCharset string, err error) {
-	return pm.saveDecodedBodyWithOptions(filePath, transaction, false)
+// saveDecodedBody saves the decoded body of a resource to a file and returns charset information
+func (pm *PersistenceManager) saveDecodedBody(filePath string, resource *types.Resource, transaction *types.RecordingTransaction) (httpCharset, contentCharset string, err error) {
+	return pm.saveDecodedBodyWithOptions(filePath, resource, transaction, false)
 }
 
-// saveDecodedBodyWithOptions saves the decoded body to a file with options and returns charset information
-func (pm *PersistenceManager) saveDecodedBodyWithOptions(filePath string, transaction *types.RecordingTransaction, noBeautify bool) (httpCharset, contentCharset string, err error) {
+// saveDecodedBodyWithOptions saves the decoded body of a resource to a file with options and returns
+// charset information
+func (pm *PersistenceManager) saveDecodedBodyWithOptions(filePath string, resource *types.Resource, transaction *types.RecordingTransaction, noBeautify bool) (httpCharset, contentCharset string, err error) {
 	// Decode the body if it's compressed
 	bodyData := transaction.Body
 	if contentEncoding := transaction.RawHeaders["Content-Encoding"]; contentEncoding != "" {
@@ -281,7 +597,7 @@ func (pm *PersistenceManager) saveDecodedBodyWithOptions(filePath string, transa
 			decodedData, err := encoding.DecodeData(bodyData, encodingType)
 			if err != nil {
 				// If decoding fails, save the original data and log the error
-				fmt.Printf("Warning: failed to decode %s content, saving raw data: %v\n", encodingType, err)
+				encodingLogger.Warn("Failed to decode content, saving raw data", "encoding", encodingType, "error", err)
 			} else {
 				bodyData = decodedData
 			}
@@ -293,10 +609,22 @@ func (pm *PersistenceManager) saveDecodedBodyWithOptions(filePath string, transa
 	processedBody, httpCharset, contentCharset, err := charset.ProcessCharsetForRecording(contentType, bodyData)
 	if err != nil {
 		// Log the error but continue with original body
-		fmt.Printf("Warning: charset processing failed: %v\n", err)
+		encodingLogger.Warn("Charset processing failed", "error", err)
 		processedBody = bodyData
 	}
 
+	// Scrub secrets before anything else is written, including the original kept by normalizing
+	if scrubbed, changed := pm.Redaction.scrubBody(contentType, processedBody); changed {
+		processedBody = scrubbed
+		if pm.Summary != nil {
+			pm.Summary.Scrubbed++
+		}
+	}
+
+	if processedBody, err = pm.normalizeContent(resource, contentType, processedBody); err != nil {
+		return "", "", err
+	}
+
 	// Apply beautification if content type is appropriate and not disabled
 	if !noBeautify && contentType != "" {
 		optimizer := formatting.NewContentOptimizer()
@@ -304,9 +632,12 @@ func (pm *PersistenceManager) saveDecodedBodyWithOptions(filePath string, transa
 			beautified, err := optimizer.Beautify(contentType, string(processedBody))
 			if err != nil {
 				// Log the error but continue with original body
-				fmt.Printf("Warning: beautification failed: %v\n", err)
+				logger.Warn("Beautification failed", "error", err)
 			} else {
 				processedBody = []byte(beautified)
+				if pm.Summary != nil {
+					pm.Summary.Beautified++
+				}
 			}
 		}
 	}
@@ -318,7 +649,7 @@ func (pm *PersistenceManager) saveDecodedBodyWithOptions(filePath string, transa
 	}
 
 	// Write the decoded body to file
-	if err := os.WriteFile(filePath, processedBody, 0644); err != nil {
+	if err := pm.writeContent(filePath, processedBody, 0644); err != nil {
 		return "", "", fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -334,15 +665,128 @@ func (pm *PersistenceManager) saveInventoryJSON(filePath string, inventory *type
 	}
 
 	// Marshal inventory to JSON
-	data, err := json.MarshalIndent(inventory, "", "  ")
+	data, err := EncodeInventory(inventory)
 	if err != nil {
 		return fmt.Errorf("failed to marshal inventory: %w", err)
 	}
 
 	// Write to file
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
+	if err := pm.writeMetadata(filePath, data); err != nil {
 		return fmt.Errorf("failed to write inventory file: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// keptResources returns the previous resources an appending save keeps: those whose content file
+// was not written again, unless the same method, URL and request body was recorded without content
+// (or they have none), which replaces them too
+func keptResources(previous, recorded []types.Resource) []types.Resource {
+	written := make(map[string]bool)
+	withoutContent := make(map[string]bool)
+	requested := make(map[string]bool)
+	for i := range recorded {
+		if recorded[i].ContentFilePath != nil {
+			written[*recorded[i].ContentFilePath] = true
+		} else {
+			withoutContent[requestIdentity(&recorded[i])] = true
+		}
+		requested[requestIdentity(&recorded[i])] = true
+	}
+
+	var kept []types.Resource
+	for i := range previous {
+		resource := &previous[i]
+		identity := requestIdentity(resource)
+		if resource.ContentFilePath != nil && (written[*resource.ContentFilePath] || withoutContent[identity]) {
+			continue
+		}
+		if resource.ContentFilePath == nil && requested[identity] {
+			continue
+		}
+		kept = append(kept, *resource)
+	}
+	return kept
+}
+
+// requestIdentity identifies the request a resource answers
+func requestIdentity(resource *types.Resource) string {
+	return fmt.Sprintf("%s:%s body:%s", resource.Method, resource.URL, requestBodySHA256(resource))
+}
+
+// keepMetadata merges the metadata of previously saved resources into the resources with the same
+// method, URL and content file
+func keepMetadata(resources []types.Resource, previous []types.Resource) {
+	metadata := make(map[string]map[string]string)
+	for _, resource := range previous {
+		if len(resource.Metadata) > 0 {
+			metadata[metadataKey(&resource)] = resource.Metadata
+		}
+	}
+	if len(metadata) == 0 {
+		return
+	}
+	for i := range resources {
+		resources[i].Metadata = mergeMetadata(metadata[metadataKey(&resources[i])], resources[i].Metadata)
+	}
+}
+
+// keepsRepeats reports whether every response to rawURL is kept
+func (pm *PersistenceManager) keepsRepeats(rawURL string) bool {
+	for _, re := range pm.KeepRepeats {
+		if re.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataKey tells resources apart, including prefetch and image variants of a URL
+func metadataKey(resource *types.Resource) string {
+	key := resource.Method + ":" + resource.URL
+	if resource.ContentFilePath != nil {
+		key += " " + *resource.ContentFilePath
+	}
+	return key
+}
+
+// variantKey identifies a resource at rawURL among the variants recorded for its method and URL
+func variantKey(resource *types.Resource, rawURL string) string {
+	key := resource.Method + ":" + rawURL
+	// Prefetch variants share the key of the resource they were recorded next to
+	if resource.Fetch.IsPrefetch() {
+		key += " prefetch"
+	}
+	// Image formats negotiated by Accept are told apart by their media type
+	if resource.Accept != nil && resource.ContentTypeMime != nil {
+		key += " " + *resource.ContentTypeMime
+	}
+	// Responses negotiated into other languages are told apart by their language
+	if language := resourceLanguage(resource); language != "" {
+		key += " lang:" + language
+	}
+	// Requests with other bodies are told apart by the hash of their body
+	if hash := requestBodySHA256(resource); hash != "" {
+		key += " body:" + hash
+	}
+	// Repeated responses to the same request are told apart by their position
+	if resource.Repeat != nil {
+		key += " repeat:" + strconv.Itoa(*resource.Repeat)
+	}
+	return key
+}
+
+// mergeMetadata returns the union of two metadata maps; keys set in recorded win
+func mergeMetadata(existing, recorded map[string]string) map[string]string {
+	if len(existing) == 0 {
+		return recorded
+	}
+	merged := make(map[string]string, len(existing)+len(recorded))
+	for key, value := range existing {
+		merged[key] = value
+	}
+	for key, value := range recorded {
+		merged[key] = value
+	}
+	return merged
+}
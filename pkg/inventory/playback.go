@@ -2,13 +2,12 @@ package inventory
 
 import (
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"go-http-playback-proxy/pkg/charset"
@@ -19,8 +18,17 @@ import (
 
 // PlaybackManager handles generating playback transactions from inventory
 type PlaybackManager struct {
-	BaseDir   string
-	ChunkSize int // Size of each body chunk in bytes (default: 16KB)
+	BaseDir         string
+	ChunkSize       int           // Size of each body chunk in bytes (default: 16KB)
+	SkipTruncated   bool          // Skip resources whose recorded body was truncated
+	VerifyChecksums bool          // Compare content files with their recorded checksums
+	PadToWireSize   bool          // Pad re-encoded bodies to the size they were recorded with
+	LinkRules       []LinkRule    // Strip Link hints by relation, or delay the resources they hint at
+	Rewrites        *RewriteRules // Rewrite the bodies of replayed responses
+	Files           MemoryFiles   // Play back these files instead of reading BaseDir, if set
+
+	mutex     sync.Mutex
+	fallbacks []EncodingFallback
 }
 
 // NewPlaybackManager creates a new playback manager
@@ -34,93 +42,140 @@ func NewPlaybackManager(baseDir string) *PlaybackManager {
 // LoadPlaybackTransactions loads inventory and generates playback transactions
 func (pm *PlaybackManager) LoadPlaybackTransactions() ([]types.PlaybackTransaction, error) {
 	// Load inventory.json
-	inventoryPath := filepath.Join(pm.BaseDir, "inventory.json")
-	inventory, err := pm.loadInventory(inventoryPath)
+	inventory, err := pm.loadInventory()
 	if err != nil {
 		return nil, fmt.Errorf("failed to load inventory: %w", err)
 	}
 
+	pm.mutex.Lock()
+	pm.fallbacks = nil
+	pm.mutex.Unlock()
+
 	var transactions []types.PlaybackTransaction
+	delays := linkDelays(inventory.Resources, pm.LinkRules)
 
 	// Process each resource
 	for _, resource := range inventory.Resources {
+		if pm.SkipTruncated && resource.Truncated != nil && *resource.Truncated {
+			logger.Info("Skipping truncated resource", "url", resource.URL)
+			continue
+		}
+
 		transaction, err := pm.convertResourceToTransaction(&resource)
 		if err != nil {
-			fmt.Printf("Warning: failed to convert resource %s: %v\n", resource.URL, err)
+			logger.Warn("Failed to convert resource", "url", resource.URL, "error", err)
 			continue
 		}
+		if delay, ok := delays[resource.URL]; ok && resource.Method == http.MethodGet {
+			delayTransaction(transaction, delay)
+		}
 		transactions = append(transactions, *transaction)
 	}
 
 	return transactions, nil
 }
 
+// LoadPlaybackTransaction loads the transaction of the resource recorded for a method, URL and
+// request body hash, or nil if there is none
+func (pm *PlaybackManager) LoadPlaybackTransaction(method, rawURL, bodyHash string) (*types.PlaybackTransaction, error) {
+	inventory, err := pm.loadInventory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load inventory: %w", err)
+	}
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		if resource.Method == method && resource.URL == rawURL && requestBodySHA256(resource) == bodyHash {
+			return pm.convertResourceToTransaction(resource)
+		}
+	}
+	return nil, nil
+}
+
 // loadInventory loads and parses inventory.json
-func (pm *PlaybackManager) loadInventory(inventoryPath string) (*types.Inventory, error) {
-	data, err := os.ReadFile(inventoryPath)
+func (pm *PlaybackManager) loadInventory() (*types.Inventory, error) {
+	data, err := pm.readFile("inventory.json")
 	if err != nil {
 		return nil, fmt.Errorf("failed to read inventory file: %w", err)
 	}
 
-	var inventory types.Inventory
-	err = json.Unmarshal(data, &inventory)
+	inventory, err := DecodeInventory(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse inventory JSON: %w", err)
 	}
 
-	return &inventory, nil
+	return inventory, nil
 }
 
 // convertResourceToTransaction converts a Resource to PlaybackTransaction
 func (pm *PlaybackManager) convertResourceToTransaction(resource *types.Resource) (*types.PlaybackTransaction, error) {
 	// Load content based on priority: ContentUTF8 > ContentBase64 > ContentFilePath
 	var compressedBody []byte
+	var checksumMismatch bool
 	var err error
+	bodyEncoding := types.ContentEncodingIdentity
 
 	if resource.ContentUTF8 != nil {
 		// Use ContentUTF8 directly as decoded content
-		decodedBody := []byte(*resource.ContentUTF8)
-		compressedBody, err = pm.compressContent(decodedBody, resource)
-		if err != nil {
-			fmt.Printf("Warning: failed to compress ContentUTF8 for %s: %v\n", resource.URL, err)
-			compressedBody = decodedBody // Use uncompressed if compression fails
-		}
+		compressedBody, bodyEncoding = pm.compressContent(pm.Rewrites.apply(resource, []byte(*resource.ContentUTF8)), resource)
 	} else if resource.ContentBase64 != nil {
 		// Decode ContentBase64 and use as content
 		decodedBody, err := pm.decodeBase64Content(*resource.ContentBase64)
 		if err != nil {
-			fmt.Printf("Warning: failed to decode ContentBase64 for %s: %v\n", resource.URL, err)
+			encodingLogger.Warn("Failed to decode ContentBase64", "url", resource.URL, "error", err)
 			compressedBody = []byte{}
 		} else {
-			compressedBody, err = pm.compressContent(decodedBody, resource)
-			if err != nil {
-				fmt.Printf("Warning: failed to compress ContentBase64 for %s: %v\n", resource.URL, err)
-				compressedBody = decodedBody // Use uncompressed if compression fails
-			}
+			compressedBody, bodyEncoding = pm.compressContent(pm.Rewrites.apply(resource, decodedBody), resource)
 		}
 	} else if resource.ContentFilePath != nil {
 		// Load from file path (existing behavior)
-		compressedBody, err = pm.loadAndCompressContent(resource)
+		var decodedBody []byte
+		decodedBody, checksumMismatch, err = pm.loadContent(resource)
 		if err != nil {
 			// Log warning but continue with empty body instead of failing
-			fmt.Printf("Warning: failed to load content for %s: %v\n", resource.URL, err)
+			logger.Warn("Failed to load content", "url", resource.URL, "error", err)
 			compressedBody = []byte{}
+		} else {
+			compressedBody, bodyEncoding = pm.compressContent(pm.Rewrites.apply(resource, decodedBody), resource)
 		}
 	} else {
 		// No content available, use empty body
 		compressedBody = []byte{}
 	}
 
+	// HTML the origin flushed in parts is re-encoded so each part can be sent at its recorded time
+	flushed, flushEnds, hasFlushes := flushSegments(compressedBody, resource, bodyEncoding)
+	if hasFlushes {
+		compressedBody = flushed
+	} else if pm.PadToWireSize {
+		compressedBody = padToWireSize(compressedBody, resource, bodyEncoding)
+	}
+
 	// Create chunks with timing
 	chunks := pm.createBodyChunks(compressedBody, resource)
+	if hasFlushes {
+		chunks = flushChunks(compressedBody, flushEnds, resource.Flushes, chunks)
+	}
+	bodyLength := len(compressedBody)
+	if size := omittedBodySize(resource); size > 0 {
+		chunks = pm.paddingChunks(size, resource)
+		bodyLength = size
+	}
 
 	// Update Content-Length header and charset
 	rawHeaders := make(types.HttpHeaders)
 	for k, v := range resource.RawHeaders {
 		rawHeaders[k] = v
 	}
-	if len(compressedBody) > 0 {
-		rawHeaders["Content-Length"] = strconv.Itoa(len(compressedBody))
+	if bodyLength > 0 {
+		rawHeaders["Content-Length"] = strconv.Itoa(bodyLength)
+	}
+	// A body that could not be re-encoded is served as recorded in the content file
+	if bodyEncoding != resourceEncoding(resource) {
+		for k := range rawHeaders {
+			if strings.EqualFold(k, "Content-Encoding") {
+				delete(rawHeaders, k)
+			}
+		}
 	}
 
 	// Update Content-Type header with charset if restored
@@ -147,6 +202,15 @@ func (pm *PlaybackManager) convertResourceToTransaction(resource *types.Resource
 		}
 	}
 
+	// Server push is unavailable during playback; approximate it with preload hints
+	if len(resource.Pushes) > 0 {
+		addPreloadLinks(rawHeaders, resource.Pushes)
+	}
+
+	// Interim responses cannot be sent ahead of the final one; carry the Early Hints over instead
+	addEarlyHintLinks(rawHeaders, resource.Informational)
+	stripLinks(rawHeaders, pm.LinkRules)
+
 	transaction := &types.PlaybackTransaction{
 		Method:       resource.Method,
 		URL:          resource.URL,
@@ -155,18 +219,64 @@ func (pm *PlaybackManager) convertResourceToTransaction(resource *types.Resource
 		ErrorMessage: resource.ErrorMessage,
 		RawHeaders:   rawHeaders,
 		Chunks:       chunks,
+
+		ChecksumMismatch: checksumMismatch,
+		ContentEncoding:  bodyEncoding,
+		Informational:    resource.Informational,
+		Fetch:            resource.Fetch,
+		Metadata:         resource.Metadata,
+		TLSSession:       resource.TLSSession,
+		Timings:          resource.Timings,
+		WebSocket:        resource.WebSocket,
+		Streamed:         len(resource.Parts) > 0,
+		RequestHeaders:   resource.RequestHeaders,
+	}
+	if resource.CacheStatus != nil {
+		transaction.CacheStatus = *resource.CacheStatus
+	}
+	if resource.Accept != nil {
+		transaction.Accept = *resource.Accept
+	}
+	if resource.Protocol != nil {
+		transaction.Protocol = *resource.Protocol
+	}
+	if resource.Repeat != nil {
+		transaction.Repeat = *resource.Repeat
+	}
+	transaction.Language = resourceLanguage(resource)
+	if resource.RequestBodySHA256 != nil {
+		transaction.RequestBodySHA256 = *resource.RequestBodySHA256
+	}
+	// Packed inventories are read into memory once and cannot change afterwards
+	if pm.VerifyChecksums && pm.Files == nil && resource.ContentFilePath != nil && resource.ContentSHA256 != nil {
+		transaction.ContentFile = ContentFile(pm.BaseDir, *resource.ContentFilePath)
+		transaction.ContentSHA256 = *resource.ContentSHA256
 	}
 
 	return transaction, nil
 }
 
-// loadAndCompressContent loads content file and re-compresses it
-func (pm *PlaybackManager) loadAndCompressContent(resource *types.Resource) ([]byte, error) {
+// loadContent loads the content file of a resource as it is replayed before re-compression.
+// The returned flag reports a content file that no longer matches its recorded checksum.
+func (pm *PlaybackManager) loadContent(resource *types.Resource) ([]byte, bool, error) {
 	// Load the decoded content file
-	contentPath := filepath.Join(pm.BaseDir, "contents", *resource.ContentFilePath)
-	decodedBody, err := os.ReadFile(contentPath)
+	decodedBody, err := pm.readContent(*resource.ContentFilePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read content file %s: %w", contentPath, err)
+		return nil, false, fmt.Errorf("failed to read content file %s: %w", *resource.ContentFilePath, err)
+	}
+
+	mismatch := pm.VerifyChecksums && !checksumMatches(resource, decodedBody)
+	if mismatch {
+		logger.Warn("Content file does not match recorded checksum", "url", resource.URL, "path", *resource.ContentFilePath)
+	}
+
+	// A normalized content file is replayed as received until it is edited
+	if resource.OriginalFilePath != nil && checksumMatches(resource, decodedBody) {
+		if original, err := pm.readFile(originalsDir + "/" + *resource.OriginalFilePath); err == nil {
+			decodedBody = original
+		} else {
+			logger.Warn("Failed to read original content, serving the content file", "url", resource.URL, "error", err)
+		}
 	}
 
 	// Apply minify optimization if ResourceMinify is true and supported content type
@@ -175,7 +285,7 @@ func (pm *PlaybackManager) loadAndCompressContent(resource *types.Resource) ([]b
 		if optimizer.Accept(*resource.ContentTypeMime) {
 			minified, minifyErr := optimizer.Minify(*resource.ContentTypeMime, string(decodedBody))
 			if minifyErr != nil {
-				fmt.Printf("Warning: minify processing failed for %s, using original data: %v\n", resource.URL, minifyErr)
+				logger.Warn("Minify processing failed, using original data", "url", resource.URL, "error", minifyErr)
 			} else {
 				decodedBody = []byte(minified)
 			}
@@ -196,25 +306,14 @@ func (pm *PlaybackManager) loadAndCompressContent(resource *types.Resource) ([]b
 
 		restoredBody, err := charset.ProcessCharsetForPlayback(decodedBody, *resource.ContentCharset, headers)
 		if err != nil {
-			fmt.Printf("Warning: failed to restore charset for %s: %v\n", resource.URL, err)
+			encodingLogger.Warn("Failed to restore charset", "url", resource.URL, "error", err)
 			// Continue with UTF-8 content if restoration fails
 		} else {
 			decodedBody = restoredBody
 		}
 	}
 
-	// If no content encoding specified, return as-is
-	if resource.ContentEncoding == nil || *resource.ContentEncoding == types.ContentEncodingIdentity {
-		return decodedBody, nil
-	}
-
-	// Re-compress the content using the original encoding
-	compressedBody, err := encoding.EncodeData(decodedBody, *resource.ContentEncoding, 6) // Use default compression level
-	if err != nil {
-		return nil, fmt.Errorf("failed to re-compress content with %s: %w", *resource.ContentEncoding, err)
-	}
-
-	return compressedBody, nil
+	return decodedBody, mismatch, nil
 }
 
 // createBodyChunks creates body chunks with calculated timing
@@ -223,8 +322,20 @@ func (pm *PlaybackManager) createBodyChunks(body []byte, resource *types.Resourc
 		return []types.BodyChunk{}
 	}
 
+	// Streaming responses are replayed part by part with their recorded timing
+	if chunks := partChunks(body, resource.Parts); chunks != nil {
+		return chunks
+	}
+
+	return pm.timedChunks(len(body), resource, func(start, end int) []byte {
+		return body[start:end]
+	})
+}
+
+// timedChunks splits a body of totalSize into chunks timed by the recorded transfer speed, taking
+// the bytes of each chunk from slice
+func (pm *PlaybackManager) timedChunks(totalSize int, resource *types.Resource, slice func(start, end int) []byte) []types.BodyChunk {
 	var chunks []types.BodyChunk
-	totalSize := len(body)
 
 	// Calculate total transfer time from Mbps if available
 	var totalTransferTime time.Duration
@@ -245,7 +356,7 @@ func (pm *PlaybackManager) createBodyChunks(body []byte, resource *types.Resourc
 			end = totalSize
 		}
 
-		chunk := body[i:end]
+		chunk := slice(i, end)
 
 		// Calculate target time for this chunk
 		// Time is proportional to the chunk's position in the total body
@@ -268,6 +379,35 @@ func (pm *PlaybackManager) createBodyChunks(body []byte, resource *types.Resourc
 	return chunks
 }
 
+// partChunks creates one chunk per recorded stream part, or returns nil when the parts do not
+// describe the body (e.g. the content was re-encoded or edited after recording)
+func partChunks(body []byte, parts []types.StreamPart) []types.BodyChunk {
+	if len(parts) == 0 {
+		return nil
+	}
+	total := 0
+	for _, part := range parts {
+		total += part.Size
+	}
+	if total != len(body) {
+		logger.Debug("Stream parts do not match the content, using calculated timing", "parts_size", total, "body_size", len(body))
+		return nil
+	}
+
+	chunks := make([]types.BodyChunk, 0, len(parts))
+	start := 0
+	for _, part := range parts {
+		targetOffset := time.Duration(part.OffsetMS) * time.Millisecond
+		chunks = append(chunks, types.BodyChunk{
+			Chunk:        body[start : start+part.Size],
+			TargetTime:   time.Now().Add(targetOffset),
+			TargetOffset: targetOffset,
+		})
+		start += part.Size
+	}
+	return chunks
+}
+
 // SetChunkSize sets the chunk size for body chunking
 func (pm *PlaybackManager) SetChunkSize(size int) {
 	if size > 0 {
@@ -284,18 +424,133 @@ func (pm *PlaybackManager) decodeBase64Content(base64Content string) ([]byte, er
 	return decodedData, nil
 }
 
-// compressContent compresses content based on resource's content encoding
-func (pm *PlaybackManager) compressContent(decodedBody []byte, resource *types.Resource) ([]byte, error) {
+// compressContent compresses content based on resource's content encoding and returns the encoding
+// it is served with. Content the encoding package cannot produce is served uncompressed.
+func (pm *PlaybackManager) compressContent(decodedBody []byte, resource *types.Resource) ([]byte, types.ContentEncodingType) {
+	contentEncoding := resourceEncoding(resource)
 	// If no content encoding specified, return as-is
-	if resource.ContentEncoding == nil || *resource.ContentEncoding == types.ContentEncodingIdentity {
-		return decodedBody, nil
+	if contentEncoding == types.ContentEncodingIdentity {
+		return decodedBody, contentEncoding
+	}
+	if !encoding.Supported(contentEncoding) {
+		pm.fallBack(resource, "unsupported encoding")
+		return decodedBody, types.ContentEncodingIdentity
 	}
 
 	// Re-compress the content using the original encoding
-	compressedBody, err := encoding.EncodeData(decodedBody, *resource.ContentEncoding, 6) // Use default compression level
+	compressedBody, err := encoding.EncodeData(decodedBody, contentEncoding, 6) // Use default compression level
 	if err != nil {
-		return nil, fmt.Errorf("failed to compress content with %s: %w", *resource.ContentEncoding, err)
+		pm.fallBack(resource, err.Error())
+		return decodedBody, types.ContentEncodingIdentity
 	}
 
-	return compressedBody, nil
-}
\ No newline at end of file
+	return compressedBody, contentEncoding
+}
+
+// EncodingFallback is a resource served uncompressed because its recorded content encoding could
+// not be reproduced
+type EncodingFallback struct {
+	URL      string
+	Encoding types.ContentEncodingType
+	Reason   string
+}
+
+// fallBack notes a resource served uncompressed instead of with its recorded encoding
+func (pm *PlaybackManager) fallBack(resource *types.Resource, reason string) {
+	encodingLogger.Warn("Serving resource without its recorded encoding", "url", resource.URL, "encoding", resourceEncoding(resource), "reason", reason)
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	pm.fallbacks = append(pm.fallbacks, EncodingFallback{URL: resource.URL, Encoding: resourceEncoding(resource), Reason: reason})
+}
+
+// EncodingFallbacks returns the resources served uncompressed since the inventory was last loaded
+func (pm *PlaybackManager) EncodingFallbacks() []EncodingFallback {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	return append([]EncodingFallback(nil), pm.fallbacks...)
+}
+
+// resourceEncoding returns the content coding a resource was recorded with
+func resourceEncoding(resource *types.Resource) types.ContentEncodingType {
+	if resource.ContentEncoding == nil {
+		return types.ContentEncodingIdentity
+	}
+	return *resource.ContentEncoding
+}
+
+// addPreloadLinks adds a Link rel=preload entry for each pushed URL not already linked
+func addPreloadLinks(rawHeaders types.HttpHeaders, pushes []string) {
+	linkKey := "Link"
+	for k := range rawHeaders {
+		if strings.EqualFold(k, "Link") {
+			linkKey = k
+			break
+		}
+	}
+
+	existing := rawHeaders[linkKey]
+	links := make([]string, 0, len(pushes))
+	for _, pushURL := range pushes {
+		if strings.Contains(existing, "<"+pushURL+">") {
+			continue
+		}
+		link := fmt.Sprintf("<%s>; rel=preload", pushURL)
+		if as := preloadDestination(pushURL); as != "" {
+			link += "; as=" + as
+		}
+		links = append(links, link)
+	}
+
+	if len(links) == 0 {
+		return
+	}
+	if existing != "" {
+		links = append([]string{existing}, links...)
+	}
+	rawHeaders[linkKey] = strings.Join(links, ", ")
+}
+
+// addEarlyHintLinks adds the Link headers of recorded 103 Early Hints not already in the final response
+func addEarlyHintLinks(rawHeaders types.HttpHeaders, informational []types.Informational) {
+	for _, response := range informational {
+		if response.StatusCode != http.StatusEarlyHints {
+			continue
+		}
+		hints := headerValue(response.RawHeaders, "Link")
+		if hints == "" {
+			continue
+		}
+
+		linkKey := "Link"
+		for k := range rawHeaders {
+			if strings.EqualFold(k, "Link") {
+				linkKey = k
+				break
+			}
+		}
+		if existing := rawHeaders[linkKey]; existing == "" {
+			rawHeaders[linkKey] = hints
+		} else if !strings.Contains(existing, hints) {
+			rawHeaders[linkKey] = existing + ", " + hints
+		}
+	}
+}
+
+// preloadDestination guesses the preload "as" destination from the URL's extension
+func preloadDestination(rawURL string) string {
+	if idx := strings.IndexAny(rawURL, "?#"); idx != -1 {
+		rawURL = rawURL[:idx]
+	}
+	switch strings.ToLower(filepath.Ext(rawURL)) {
+	case ".css":
+		return "style"
+	case ".js", ".mjs":
+		return "script"
+	case ".woff", ".woff2", ".ttf", ".otf":
+		return "font"
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico":
+		return "image"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,60 @@
+package inventory
+
+import (
+	"strings"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// HTTP1ConnectionsPerHost is how many connections browsers open to a host served over HTTP/1.1, and
+// so how many of its requests are in flight at once
+const HTTP1ConnectionsPerHost = 6
+
+// ParseProtocol returns the protocol of an ALPN identifier (h2, http/1.1) or HTTP version
+// (HTTP/2.0, as in requests and HAR files), or "" if it is not known
+func ParseProtocol(version string) types.Protocol {
+	switch strings.ToLower(strings.TrimSpace(version)) {
+	case "http/1.0", "http/1.1":
+		return types.ProtocolHTTP1
+	case "h2", "h2c", "http/2", "http/2.0":
+		return types.ProtocolHTTP2
+	case "h3", "http/3", "http/3.0":
+		return types.ProtocolHTTP3
+	}
+	return ""
+}
+
+// ProtocolConcurrency returns the concurrency of the hosts recorded over HTTP/1.1 only, whose
+// requests a browser spreads over HTTP1ConnectionsPerHost connections instead of multiplexing them
+func ProtocolConcurrency(resources []types.Resource) map[string]int {
+	multiplexed := make(map[string]bool)
+	for i := range resources {
+		resource := &resources[i]
+		if resource.Protocol == nil {
+			continue
+		}
+		host := resourceHost(resource)
+		if host == "" {
+			continue
+		}
+		multiplexed[host] = multiplexed[host] || *resource.Protocol != types.ProtocolHTTP1
+	}
+
+	limits := make(map[string]int)
+	for host, multiplexed := range multiplexed {
+		if !multiplexed {
+			limits[host] = HTTP1ConnectionsPerHost
+		}
+	}
+	return limits
+}
+
+// LoadProtocolConcurrency returns the concurrency of the hosts of the inventory recorded over
+// HTTP/1.1 only
+func (pm *PlaybackManager) LoadProtocolConcurrency() (map[string]int, error) {
+	inventory, err := pm.loadInventory()
+	if err != nil {
+		return nil, err
+	}
+	return ProtocolConcurrency(inventory.Resources), nil
+}
@@ -0,0 +1,252 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Redaction modes
+const (
+	// RedactStrip removes redacted headers and query parameters
+	RedactStrip = "strip"
+	// RedactHash replaces their values with a short hash, so equal values stay recognizable
+	RedactHash = "hash"
+)
+
+// DefaultRedactedHeaders are redacted whenever redaction is enabled
+var DefaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Redaction strips or hashes credentials in headers and query parameters, and scrubs them from
+// bodies, before a recording is written, so the inventory can be committed without live
+// tokens
+type Redaction struct {
+	// Mode is RedactStrip (default) or RedactHash
+	Mode string `json:"mode,omitempty"`
+	// Headers are redacted in addition to DefaultRedactedHeaders
+	Headers []string `json:"headers,omitempty"`
+	// QueryParams are the names (globs, e.g. token, *_key) of the query parameters to redact
+	QueryParams []string `json:"queryParams,omitempty"`
+	// Bodies are the rules that scrub request and response bodies as they are saved
+	Bodies []BodyRule `json:"bodies,omitempty"`
+
+	headers     map[string]bool
+	queryParams *match.Set
+}
+
+// NewRedaction checks and compiles a redaction; nil redacts the default headers only
+func NewRedaction(r *Redaction) (*Redaction, error) {
+	if r == nil {
+		r = &Redaction{}
+	}
+	switch r.Mode {
+	case "":
+		r.Mode = RedactStrip
+	case RedactStrip, RedactHash:
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q (strip or hash)", r.Mode)
+	}
+
+	r.headers = make(map[string]bool)
+	for _, name := range append(append([]string(nil), DefaultRedactedHeaders...), r.Headers...) {
+		r.headers[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
+	params, err := match.CompileSet(r.QueryParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query parameter pattern: %w", err)
+	}
+	r.queryParams = params
+	for i := range r.Bodies {
+		if err := r.Bodies[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid body rule %d: %w", i+1, err)
+		}
+	}
+	return r, nil
+}
+
+// LoadRedaction reads a redaction config file, a JSON object with mode, headers, queryParams and
+// bodies
+func LoadRedaction(path string) (*Redaction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redaction file: %w", err)
+	}
+	var r Redaction
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse redaction file: %w", err)
+	}
+	return NewRedaction(&r)
+}
+
+// SavedRedaction returns the redaction the inventory in the base directory was saved with; nil
+// when it was saved without one or does not exist yet
+func (pm *PersistenceManager) SavedRedaction() (*Redaction, error) {
+	if _, err := os.Stat(filepath.Join(pm.BaseDir, "inventory.json")); os.IsNotExist(err) {
+		return nil, nil
+	}
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+	if len(inventory.Redaction) == 0 {
+		return nil, nil
+	}
+	var r Redaction
+	if err := json.Unmarshal(inventory.Redaction, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse the redaction of the inventory: %w", err)
+	}
+	return NewRedaction(&r)
+}
+
+// redactTransactions returns copies of the transactions with their credentials redacted
+func (r *Redaction) redactTransactions(transactions []types.RecordingTransaction) []types.RecordingTransaction {
+	if r == nil {
+		return transactions
+	}
+	redacted := make([]types.RecordingTransaction, len(transactions))
+	for i := range transactions {
+		redacted[i] = r.redactTransaction(transactions[i])
+	}
+	return redacted
+}
+
+// redactTransaction returns a copy of a transaction with its credentials redacted; the recorded
+// transaction keeps them, since it still shares its headers with the recording
+func (r *Redaction) redactTransaction(transaction types.RecordingTransaction) types.RecordingTransaction {
+	transaction.URL = r.RedactURL(transaction.URL)
+	transaction.RawHeaders = r.redactHeaders(transaction.RawHeaders)
+	transaction.RequestHeaders = r.redactHeaders(transaction.RequestHeaders)
+	if len(transaction.Informational) > 0 {
+		informational := make([]types.Informational, len(transaction.Informational))
+		for i, response := range transaction.Informational {
+			response.RawHeaders = r.redactHeaders(response.RawHeaders)
+			informational[i] = response
+		}
+		transaction.Informational = informational
+	}
+	return transaction
+}
+
+// redactHeaders returns a copy of headers with the redacted ones stripped or hashed
+func (r *Redaction) redactHeaders(headers types.HttpHeaders) types.HttpHeaders {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(types.HttpHeaders, len(headers))
+	for name, value := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		switch {
+		case !r.headers[canonical]:
+			redacted[name] = value
+		case r.Mode == RedactHash:
+			redacted[name] = hashHeaderValue(canonical, value)
+		}
+	}
+	return redacted
+}
+
+// RedactHeader returns a copy of request or response headers with the redacted ones stripped or
+// hashed, for request data written outside the inventory
+func (r *Redaction) RedactHeader(header http.Header) http.Header {
+	if r == nil || header == nil {
+		return header
+	}
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		canonical := http.CanonicalHeaderKey(name)
+		switch {
+		case !r.headers[canonical]:
+			redacted[name] = values
+		case r.Mode == RedactHash:
+			hashed := make([]string, len(values))
+			for i, value := range values {
+				hashed[i] = hashHeaderValue(canonical, value)
+			}
+			redacted[name] = hashed
+		}
+	}
+	return redacted
+}
+
+// RedactBody applies the body rules to a body of the Content-Type
+func (r *Redaction) RedactBody(contentType string, body []byte) []byte {
+	scrubbed, _ := r.scrubBody(contentType, body)
+	return scrubbed
+}
+
+// RedactURL strips or hashes the redacted query parameters of a URL
+func (r *Redaction) RedactURL(rawURL string) string {
+	if r == nil || r.queryParams.Len() == 0 {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	// The query is rewritten pair by pair to keep the order and encoding of the other parameters
+	pairs := strings.Split(u.RawQuery, "&")
+	kept := pairs[:0]
+	changed := false
+	for _, pair := range pairs {
+		rawName, value, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil || !r.queryParams.Match(name) {
+			kept = append(kept, pair)
+			continue
+		}
+		changed = true
+		if r.Mode == RedactHash {
+			kept = append(kept, rawName+"="+redactedHash(value))
+		}
+	}
+	if !changed {
+		return rawURL
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	return u.String()
+}
+
+// hashHeaderValue hashes the secret parts of a header value: cookie values, keeping cookie names
+// and attributes, or the credentials after an authorization scheme
+func hashHeaderValue(name, value string) string {
+	switch name {
+	case "Cookie":
+		cookies := strings.Split(value, ";")
+		for i, cookie := range cookies {
+			if cookieName, cookieValue, ok := strings.Cut(strings.TrimSpace(cookie), "="); ok {
+				cookies[i] = cookieName + "=" + redactedHash(cookieValue)
+			}
+		}
+		return strings.Join(cookies, "; ")
+	case "Set-Cookie":
+		cookie, attributes, _ := strings.Cut(value, ";")
+		if cookieName, cookieValue, ok := strings.Cut(cookie, "="); ok {
+			cookie = cookieName + "=" + redactedHash(cookieValue)
+		}
+		if attributes != "" {
+			return cookie + ";" + attributes
+		}
+		return cookie
+	case "Authorization", "Proxy-Authorization":
+		if scheme, credentials, ok := strings.Cut(value, " "); ok {
+			return scheme + " " + redactedHash(credentials)
+		}
+	}
+	return redactedHash(value)
+}
+
+// redactedHash stands in for a secret value with the start of its SHA-256 hash
+func redactedHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "redacted-" + hex.EncodeToString(sum[:8])
+}
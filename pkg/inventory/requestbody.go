@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// bodiesDir holds the content of responses to requests with the same method and URL as a recorded
+// request but another body, by the hash of their request body
+const bodiesDir = "bodies"
+
+// MaxRequestBodySize is the largest request body stored in an inventory; larger bodies (e.g.
+// uploads) only leave their hash
+const MaxRequestBodySize = 1 << 20
+
+// RequestBodyHash returns the SHA-256 of a request body once normalized, so requests that only
+// differ in formatting get the same hash: JSON loses insignificant whitespace and has its object
+// keys sorted, and form fields are sorted by name. An empty body has no hash.
+func RequestBodyHash(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(NormalizeRequestBody(contentType, body))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeRequestBody returns a JSON or form body in canonical form, and other bodies as they are
+func NormalizeRequestBody(contentType string, body []byte) []byte {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			return []byte(values.Encode())
+		}
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err == nil {
+			// Maps are encoded with sorted keys
+			if normalized, err := json.Marshal(value); err == nil {
+				return normalized
+			}
+		}
+	}
+	return body
+}
+
+// bodyVariantPath returns where the content of a response to a request with another body than the
+// first recorded one for its method and URL is saved
+func bodyVariantPath(contentFilePath, bodyHash string) string {
+	dir := "empty"
+	if bodyHash != "" {
+		dir = bodyHash[:16]
+	}
+	return path.Join(bodiesDir, dir, contentFilePath)
+}
+
+// requestBodySHA256 returns the request body hash of a resource, or "" if it has none
+func requestBodySHA256(resource *types.Resource) string {
+	if resource.RequestBodySHA256 == nil {
+		return ""
+	}
+	return *resource.RequestBodySHA256
+}
+
+// setRequestBody stores a request body in a resource, as text when it is valid UTF-8
+func setRequestBody(resource *types.Resource, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if utf8.Valid(body) {
+		text := string(body)
+		resource.RequestBodyUTF8 = &text
+		return
+	}
+	encoded := base64.StdEncoding.EncodeToString(body)
+	resource.RequestBodyBase64 = &encoded
+}
+
+// RequestBody returns the recorded request body of a resource, or nil if none was recorded
+func RequestBody(resource *types.Resource) ([]byte, error) {
+	switch {
+	case resource.RequestBodyUTF8 != nil:
+		return []byte(*resource.RequestBodyUTF8), nil
+	case resource.RequestBodyBase64 != nil:
+		body, err := base64.StdEncoding.DecodeString(*resource.RequestBodyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode request body of %s: %w", resource.URL, err)
+		}
+		return body, nil
+	}
+	return nil, nil
+}
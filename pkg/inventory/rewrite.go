@@ -0,0 +1,374 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-http-playback-proxy/pkg/resource"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// RewriteOptions configures RewriteURLs
+type RewriteOptions struct {
+	// From is the URL prefix to replace, usually an origin such as https://old.cdn.com
+	From string
+	// To replaces From
+	To string
+	// DryRun reports the changes without touching the inventory
+	DryRun bool
+}
+
+// URLRewrite describes one resource whose URL changed
+type URLRewrite struct {
+	Before string
+	After  string
+	// BeforePath and AfterPath are the content file paths, equal when the file does not move
+	BeforePath string
+	AfterPath  string
+}
+
+// ContentRewrite describes one resource whose body or headers referenced the old URL
+type ContentRewrite struct {
+	URL        string
+	Path       string
+	References int
+}
+
+// RewriteReport lists what RewriteURLs changed (or would change in dry-run mode)
+type RewriteReport struct {
+	Resources []URLRewrite
+	Contents  []ContentRewrite
+}
+
+// RewriteURLs moves resources from one URL prefix to another, so fixtures keep working after
+// an origin migrates. Resource URLs, content file paths, headers and references inside HTML and
+// CSS bodies are rewritten; recorded checksums are updated for rewritten files. Every change is
+// planned before any file is touched, and the files already rewritten or moved are restored when
+// a later step or saving inventory.json fails.
+func (pm *PersistenceManager) RewriteURLs(opts RewriteOptions) (*RewriteReport, error) {
+	if err := validateRewritePrefix(opts.From); err != nil {
+		return nil, fmt.Errorf("invalid --from: %w", err)
+	}
+	if err := validateRewritePrefix(opts.To); err != nil {
+		return nil, fmt.Errorf("invalid --to: %w", err)
+	}
+
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+	replacements := rewritePairs(opts.From, opts.To)
+
+	// Plan the URL changes first so a conflict leaves the inventory untouched
+	report := &RewriteReport{}
+	newURLs := make(map[int]string)
+	keys := make(map[string]bool, len(inventory.Resources))
+	for i := range inventory.Resources {
+		res := &inventory.Resources[i]
+		rawURL := res.URL
+		if hasURLPrefix(res.URL, opts.From) {
+			newURLs[i] = opts.To + strings.TrimPrefix(res.URL, opts.From)
+			rawURL = newURLs[i]
+		}
+		key := variantKey(res, rawURL)
+		if keys[key] {
+			return nil, fmt.Errorf("rewriting would leave two resources for %s", key)
+		}
+		keys[key] = true
+	}
+
+	var writes []contentWrite
+	var moves []contentMove
+	moved := make(map[string]bool)
+	for i := range inventory.Resources {
+		res := &inventory.Resources[i]
+
+		// References are rewritten at the current path, before the content file moves
+		references, write, err := pm.rewriteReferences(res, replacements, opts.DryRun)
+		if err != nil {
+			return report, fmt.Errorf("failed to rewrite %s: %w", res.URL, err)
+		}
+		if write != nil {
+			writes = append(writes, *write)
+		}
+		if references > 0 {
+			contentPath := ""
+			if res.ContentFilePath != nil {
+				contentPath = *res.ContentFilePath
+			}
+			report.Contents = append(report.Contents, ContentRewrite{URL: res.URL, Path: contentPath, References: references})
+		}
+
+		rewritten, ok := newURLs[i]
+		if !ok {
+			continue
+		}
+		change := URLRewrite{Before: res.URL, After: rewritten}
+		if res.ContentFilePath != nil {
+			change.BeforePath = *res.ContentFilePath
+			change.AfterPath, err = rewrittenContentPath(res, rewritten)
+			if err != nil {
+				return report, err
+			}
+			if !opts.DryRun && change.AfterPath != change.BeforePath {
+				if _, err := os.Stat(filepath.Join(pm.BaseDir, "contents", change.AfterPath)); err == nil || moved[change.AfterPath] {
+					return report, fmt.Errorf("content file %s already exists", change.AfterPath)
+				}
+				moved[change.AfterPath] = true
+				moves = append(moves, contentMove{from: change.BeforePath, to: change.AfterPath})
+			}
+			if !opts.DryRun {
+				res.ContentFilePath = &change.AfterPath
+			}
+		}
+		if !opts.DryRun {
+			res.URL = rewritten
+		}
+		report.Resources = append(report.Resources, change)
+	}
+
+	if inventory.EntryURL != nil && hasURLPrefix(*inventory.EntryURL, opts.From) && !opts.DryRun {
+		entryURL := opts.To + strings.TrimPrefix(*inventory.EntryURL, opts.From)
+		inventory.EntryURL = &entryURL
+	}
+
+	if !opts.DryRun && (len(report.Resources) > 0 || len(report.Contents) > 0) {
+		if err := pm.applyRewrite(inventory, writes, moves); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// contentWrite is a content file whose references are rewritten
+type contentWrite struct {
+	path          string
+	before, after []byte
+	perm          os.FileMode
+}
+
+// contentMove is a content file moving to the path of its new URL, relative to contents/
+type contentMove struct {
+	from, to string
+}
+
+// applyRewrite rewrites and moves the content files, then saves the inventory. When a step fails,
+// the steps already done are undone in reverse order, so inventory.json and the content files it
+// references stay consistent.
+func (pm *PersistenceManager) applyRewrite(inventory *types.Inventory, writes []contentWrite, moves []contentMove) (err error) {
+	var undo []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(undo) - 1; i >= 0; i-- {
+			if undoErr := undo[i](); undoErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to roll back: %w", undoErr))
+			}
+		}
+	}()
+
+	for _, write := range writes {
+		if err := pm.writeContent(write.path, write.after, write.perm); err != nil {
+			return fmt.Errorf("failed to write content file: %w", err)
+		}
+		undo = append(undo, func() error {
+			return pm.writeContent(write.path, write.before, write.perm)
+		})
+	}
+	for _, move := range moves {
+		if err := pm.moveContentFile(move.from, move.to); err != nil {
+			return err
+		}
+		undo = append(undo, func() error {
+			return pm.moveContentFile(move.to, move.from)
+		})
+	}
+	return pm.SaveInventory(inventory)
+}
+
+// validateRewritePrefix requires an absolute http(s) URL
+func validateRewritePrefix(prefix string) error {
+	parsed, err := url.Parse(prefix)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", prefix)
+	}
+	return nil
+}
+
+// rewritePairs returns the absolute and protocol-relative forms of the rewrite
+func rewritePairs(from, to string) [][2]string {
+	pairs := [][2]string{{from, to}}
+	fromRelative := from[strings.Index(from, "//"):]
+	toRelative := to[strings.Index(to, "//"):]
+	if fromRelative != toRelative {
+		pairs = append(pairs, [2]string{fromRelative, toRelative})
+	}
+	return pairs
+}
+
+// hasURLPrefix reports whether s starts with the URL prefix
+func hasURLPrefix(s, prefix string) bool {
+	return strings.HasPrefix(s, prefix) && prefixEnds(s, len(prefix), prefix)
+}
+
+// prefixEnds reports whether a match of prefix ending at end is not followed by more of a host
+// name or port, so https://cdn.com does not match https://cdn.com.example or https://cdn.com:8443
+func prefixEnds(s string, end int, prefix string) bool {
+	return strings.HasSuffix(prefix, "/") || end == len(s) || !continuesHost(s[end])
+}
+
+// replaceURLPrefix replaces every occurrence of the URL prefix from
+func replaceURLPrefix(s, from, to string) (string, int) {
+	var sb strings.Builder
+	count := 0
+	for {
+		i := strings.Index(s, from)
+		if i < 0 {
+			sb.WriteString(s)
+			break
+		}
+		end := i + len(from)
+		if prefixEnds(s, end, from) {
+			sb.WriteString(s[:i])
+			sb.WriteString(to)
+			count++
+		} else {
+			sb.WriteString(s[:end])
+		}
+		s = s[end:]
+	}
+	return sb.String(), count
+}
+
+// continuesHost reports whether c can continue a host name or start a port
+func continuesHost(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '.' || c == '-' || c == '_' || c == ':'
+}
+
+// rewriteReferences rewrites references in the headers and the HTML or CSS body of a resource. A
+// content file is not written; the rewrite is returned for applyRewrite instead.
+func (pm *PersistenceManager) rewriteReferences(res *types.Resource, pairs [][2]string, dryRun bool) (int, *contentWrite, error) {
+	references := 0
+	for name, value := range res.RawHeaders {
+		rewritten, n := replaceAll(value, pairs)
+		if n > 0 {
+			references += n
+			if !dryRun {
+				res.RawHeaders[name] = rewritten
+			}
+		}
+	}
+	for i, push := range res.Pushes {
+		if rewritten, n := replaceAll(push, pairs); n > 0 {
+			references += n
+			if !dryRun {
+				res.Pushes[i] = rewritten
+			}
+		}
+	}
+
+	mimeType := resourceMime(res)
+	if mimeType != "text/html" && mimeType != "application/xhtml+xml" && mimeType != "text/css" {
+		return references, nil, nil
+	}
+	// Content that could not be converted to UTF-8 is stored as-is and must not be rewritten
+	if res.ContentCharset != nil && strings.HasSuffix(*res.ContentCharset, "-failed") {
+		return references, nil, nil
+	}
+
+	switch {
+	case res.ContentUTF8 != nil:
+		rewritten, n := replaceAll(*res.ContentUTF8, pairs)
+		references += n
+		if n > 0 && !dryRun {
+			res.ContentUTF8 = &rewritten
+		}
+	case res.ContentFilePath != nil:
+		filePath := ContentFile(pm.BaseDir, *res.ContentFilePath)
+		data, err := os.ReadFile(filePath)
+		if os.IsNotExist(err) {
+			return references, nil, nil
+		}
+		if err != nil {
+			return references, nil, fmt.Errorf("failed to read content file: %w", err)
+		}
+		rewritten, n := replaceAll(string(data), pairs)
+		references += n
+		if n > 0 && !dryRun {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				return references, nil, fmt.Errorf("failed to stat content file: %w", err)
+			}
+			// Keep recorded checksums valid for intentionally rewritten files
+			if res.ContentSHA256 != nil {
+				setChecksum(res, []byte(rewritten))
+			}
+			return references, &contentWrite{path: filePath, before: data, after: []byte(rewritten), perm: info.Mode().Perm()}, nil
+		}
+	}
+	return references, nil, nil
+}
+
+// replaceAll applies every pair in order
+func replaceAll(s string, pairs [][2]string) (string, int) {
+	total := 0
+	for _, pair := range pairs {
+		var n int
+		s, n = replaceURLPrefix(s, pair[0], pair[1])
+		total += n
+	}
+	return s, total
+}
+
+// rewrittenContentPath returns where the content of a resource moves to under its new URL.
+// Paths that were not derived from the URL (edited by hand) are kept.
+func rewrittenContentPath(res *types.Resource, newURL string) (string, error) {
+	current := *res.ContentFilePath
+	oldPath, err := resource.GetResourceFilePath(res.Method, res.URL)
+	if err != nil {
+		return "", err
+	}
+	newPath, err := resource.GetResourceFilePath(res.Method, newURL)
+	if err != nil {
+		return "", err
+	}
+	// Prefetch, image and request body variants keep their content under a sub-directory of the derived path
+	if dir, ok := strings.CutSuffix(current, oldPath); ok && (dir == "" || strings.HasSuffix(dir, "/")) {
+		return dir + newPath, nil
+	}
+	return current, nil
+}
+
+// moveContentFile renames a content file and removes the directories it leaves empty
+func (pm *PersistenceManager) moveContentFile(from, to string) error {
+	contentsDir := filepath.Join(pm.BaseDir, "contents")
+	src := filepath.Join(contentsDir, from)
+	dst := filepath.Join(contentsDir, to)
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("content file %s already exists", to)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create content directory: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("failed to move content file: %w", err)
+	}
+	for dir := filepath.Dir(src); dir != contentsDir && strings.HasPrefix(dir, contentsDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"go-http-playback-proxy/pkg/match"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// RewriteRules rewrite the bodies of replayed responses, e.g. to point absolute production URLs at
+// the host a browser reaches the proxy with, or to inject a banner script
+type RewriteRules struct {
+	Rules []RewriteRule `json:"rules"`
+}
+
+// RewriteRule replaces the matches of a regular expression in the bodies of matching responses
+type RewriteRule struct {
+	// ContentTypes limits the rule to media types matching these globs, e.g. text/html; empty
+	// matches all
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// Hosts limits the rule to resources on hosts matching these globs; empty matches all
+	Hosts []string `json:"hosts,omitempty"`
+	// Pattern is the regular expression to replace
+	Pattern string `json:"pattern"`
+	// Replacement is a text/template executed for each resource, with .URL, .Origin, .Host and
+	// .Path of the resource and an env function; $1 then expands to submatches
+	Replacement string `json:"replacement"`
+	// Limit replaces only the first matches; 0 replaces all
+	Limit int `json:"limit,omitempty"`
+
+	contentTypes *match.Set
+	hosts        *match.Set
+	pattern      *regexp.Regexp
+	replacement  *template.Template
+}
+
+// rewriteData is what a replacement template sees of the resource it rewrites
+type rewriteData struct {
+	URL    string
+	Origin string
+	Host   string
+	Path   string
+}
+
+// rewriteFuncs are the functions available to replacement templates
+var rewriteFuncs = template.FuncMap{"env": os.Getenv}
+
+// NewRewriteRules checks and compiles rewrite rules
+func NewRewriteRules(r *RewriteRules) (*RewriteRules, error) {
+	for i := range r.Rules {
+		if err := r.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("invalid rewrite rule %d: %w", i+1, err)
+		}
+	}
+	return r, nil
+}
+
+// LoadRewriteRules reads a rewrite rules file, a JSON object with the list of rules
+func LoadRewriteRules(path string) (*RewriteRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rewrite rules file: %w", err)
+	}
+	var r RewriteRules
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse rewrite rules file: %w", err)
+	}
+	return NewRewriteRules(&r)
+}
+
+// compile checks and compiles a rewrite rule
+func (r *RewriteRule) compile() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("a rewrite rule needs a pattern")
+	}
+	if r.Limit < 0 {
+		return fmt.Errorf("limit must not be negative, got %d", r.Limit)
+	}
+	var err error
+	if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	lower := make([]string, len(r.ContentTypes))
+	for i, contentType := range r.ContentTypes {
+		lower[i] = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if r.contentTypes, err = match.CompileSet(lower); err != nil {
+		return fmt.Errorf("invalid content type pattern: %w", err)
+	}
+	if r.hosts, err = match.CompileSet(r.Hosts); err != nil {
+		return fmt.Errorf("invalid host pattern: %w", err)
+	}
+	if r.replacement, err = template.New("replacement").Funcs(rewriteFuncs).Parse(r.Replacement); err != nil {
+		return fmt.Errorf("invalid replacement: %w", err)
+	}
+	return nil
+}
+
+// applies reports whether the rule rewrites a resource of the media type on the host
+func (r *RewriteRule) applies(mediaType, host string) bool {
+	return (r.contentTypes.Len() == 0 || r.contentTypes.Match(mediaType)) &&
+		(r.hosts.Len() == 0 || r.hosts.Match(host))
+}
+
+// apply rewrites the decoded body of a resource. Streamed responses are replayed part by part as
+// recorded, so they are left as they are.
+func (r *RewriteRules) apply(resource *types.Resource, body []byte) []byte {
+	if r == nil || len(r.Rules) == 0 || len(body) == 0 || len(resource.Parts) > 0 {
+		return body
+	}
+	u, err := url.Parse(resource.URL)
+	if err != nil {
+		return body
+	}
+	mediaType := resourceMime(resource)
+	data := rewriteData{URL: resource.URL, Origin: u.Scheme + "://" + u.Host, Host: u.Host, Path: u.Path}
+
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		if !rule.applies(mediaType, u.Hostname()) {
+			continue
+		}
+		var replacement strings.Builder
+		if err := rule.replacement.Execute(&replacement, data); err != nil {
+			logger.Warn("Failed to expand rewrite replacement", "url", resource.URL, "error", err)
+			continue
+		}
+		body = rule.replace(body, replacement.String())
+	}
+	return body
+}
+
+// replace replaces the matches of the rule's pattern, up to its limit, expanding submatches
+func (r *RewriteRule) replace(body []byte, replacement string) []byte {
+	limit := r.Limit
+	if limit == 0 {
+		limit = -1
+	}
+	matches := r.pattern.FindAllSubmatchIndex(body, limit)
+	if len(matches) == 0 {
+		return body
+	}
+	rewritten := make([]byte, 0, len(body))
+	last := 0
+	for _, submatches := range matches {
+		rewritten = append(rewritten, body[last:submatches[0]]...)
+		rewritten = r.pattern.Expand(rewritten, []byte(replacement), body, submatches)
+		last = submatches[1]
+	}
+	return append(rewritten, body[last:]...)
+}
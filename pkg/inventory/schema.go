@@ -0,0 +1,136 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+const (
+	// SchemaVersion is the newest inventory.json format this build reads and writes
+	SchemaVersion = 2
+
+	// sharedHeaderMinLength is the value length from which a header repeated across resources is
+	// stored once in the header table; shorter values stay inline for hand editing
+	sharedHeaderMinLength = 64
+)
+
+// DecodeInventory parses inventory.json, moving the headers of the header table back into the
+// resources that refer to them
+func DecodeInventory(data []byte) (*types.Inventory, error) {
+	var inventory types.Inventory
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		return nil, err
+	}
+	if inventory.SchemaVersion > SchemaVersion {
+		return nil, fmt.Errorf("inventory schema version %d is newer than supported (%d); upgrade http-playback-proxy", inventory.SchemaVersion, SchemaVersion)
+	}
+
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		var err error
+		if resource.RawHeaders, err = expandSharedHeaders(resource, resource.RawHeaders, resource.SharedHeaders, inventory.Headers); err != nil {
+			return nil, err
+		}
+		if resource.RequestHeaders, err = expandSharedHeaders(resource, resource.RequestHeaders, resource.SharedRequestHeaders, inventory.Headers); err != nil {
+			return nil, err
+		}
+		resource.SharedHeaders = nil
+		resource.SharedRequestHeaders = nil
+	}
+	inventory.Headers = nil
+	inventory.SchemaVersion = 0
+	// Inventories written on Windows by hand or by older builds may use backslashes
+	normalizeContentPaths(inventory.Resources)
+	return &inventory, nil
+}
+
+// expandSharedHeaders adds the table headers a resource refers to to its inline headers
+func expandSharedHeaders(resource *types.Resource, headers types.HttpHeaders, refs []int, table []types.SharedHeader) (types.HttpHeaders, error) {
+	for _, index := range refs {
+		if index < 0 || index >= len(table) {
+			return nil, fmt.Errorf("resource %s refers to header %d of %d", resource.URL, index, len(table))
+		}
+		if headers == nil {
+			headers = make(types.HttpHeaders)
+		}
+		// A header edited into rawHeaders or requestHeaders overrides the shared one
+		header := table[index]
+		if _, ok := headers[header.Name]; !ok {
+			headers[header.Name] = header.Value
+		}
+	}
+	return headers, nil
+}
+
+// EncodeInventory formats inventory.json, storing long header values that several resources share
+// once in the header table. The inventory itself is not modified.
+func EncodeInventory(inventory *types.Inventory) ([]byte, error) {
+	stored := *inventory
+	stored.Resources = make([]types.Resource, len(inventory.Resources))
+	copy(stored.Resources, inventory.Resources)
+	stored.Headers = nil
+	normalizeContentPaths(stored.Resources)
+
+	// Count the resources carrying each long header; request headers such as User-Agent and
+	// Cookie repeat as much as response headers
+	counts := make(map[types.SharedHeader]int)
+	count := func(headers types.HttpHeaders) {
+		for name, value := range headers {
+			if len(value) >= sharedHeaderMinLength {
+				counts[types.SharedHeader{Name: name, Value: value}]++
+			}
+		}
+	}
+	for _, resource := range inventory.Resources {
+		count(resource.RawHeaders)
+		count(resource.RequestHeaders)
+	}
+
+	// Table entries are numbered in order of first use, so re-saving gives the same file
+	indexes := make(map[types.SharedHeader]int)
+	share := func(headers types.HttpHeaders) (types.HttpHeaders, []int) {
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var inline types.HttpHeaders
+		var refs []int
+		for _, name := range names {
+			header := types.SharedHeader{Name: name, Value: headers[name]}
+			if counts[header] < 2 {
+				if inline == nil {
+					inline = make(types.HttpHeaders)
+				}
+				inline[name] = header.Value
+				continue
+			}
+			index, ok := indexes[header]
+			if !ok {
+				index = len(stored.Headers)
+				indexes[header] = index
+				stored.Headers = append(stored.Headers, header)
+			}
+			refs = append(refs, index)
+		}
+		if len(refs) == 0 {
+			return headers, nil
+		}
+		return inline, refs
+	}
+	for i := range stored.Resources {
+		resource := &stored.Resources[i]
+		resource.RawHeaders, resource.SharedHeaders = share(resource.RawHeaders)
+		resource.RequestHeaders, resource.SharedRequestHeaders = share(resource.RequestHeaders)
+	}
+
+	stored.SchemaVersion = 0
+	if len(stored.Headers) > 0 {
+		stored.SchemaVersion = SchemaVersion
+	}
+	return json.MarshalIndent(&stored, "", "  ")
+}
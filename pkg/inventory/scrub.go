@@ -0,0 +1,249 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// defaultScrubReplacement replaces scrubbed values when a rule sets no replacement
+const defaultScrubReplacement = "REDACTED"
+
+// BodyRule scrubs secrets from the request and response bodies of matching media types before
+// they are saved
+type BodyRule struct {
+	// ContentTypes limits the rule to media types matching these globs, e.g. application/json;
+	// empty matches all
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// Pattern is a regular expression whose matches are replaced, with $1 expanding to submatches
+	Pattern string `json:"pattern,omitempty"`
+	// JSONPaths select the values of JSON bodies to replace, e.g. $.access_token, $.users[*].email
+	// or $..password
+	JSONPaths []string `json:"jsonPaths,omitempty"`
+	// Replacement replaces matches and selected values (default: REDACTED)
+	Replacement string `json:"replacement,omitempty"`
+
+	contentTypes *match.Set
+	pattern      *regexp.Regexp
+	paths        [][]pathStep
+}
+
+// pathStep is a step of a JSONPath: a member name, an array index (index >= 0), or any member or
+// element (wildcard), optionally at any depth (recursive)
+type pathStep struct {
+	name      string
+	index     int
+	wildcard  bool
+	recursive bool
+}
+
+// selects reports whether the step selects the member or element of an object key or array index
+func (s pathStep) selects(key string, index int) bool {
+	switch {
+	case s.wildcard:
+		return true
+	case s.index >= 0:
+		return index == s.index
+	default:
+		return index < 0 && key == s.name
+	}
+}
+
+// compile checks and compiles a body rule
+func (r *BodyRule) compile() error {
+	if r.Pattern == "" && len(r.JSONPaths) == 0 {
+		return fmt.Errorf("a body rule needs a pattern or jsonPaths")
+	}
+	lower := make([]string, len(r.ContentTypes))
+	for i, contentType := range r.ContentTypes {
+		lower[i] = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	var err error
+	if r.contentTypes, err = match.CompileSet(lower); err != nil {
+		return fmt.Errorf("invalid content type pattern: %w", err)
+	}
+	if r.Pattern != "" {
+		if r.pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	for _, path := range r.JSONPaths {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			return err
+		}
+		r.paths = append(r.paths, steps)
+	}
+	if r.Replacement == "" {
+		r.Replacement = defaultScrubReplacement
+	}
+	return nil
+}
+
+// parseJSONPath parses the supported subset of JSONPath: $ followed by .name, .*, [n], [*] and
+// ['name'] steps, each of which may be preceded by .. to apply at any depth
+func parseJSONPath(path string) ([]pathStep, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", path)
+	}
+	var steps []pathStep
+	for rest != "" {
+		step := pathStep{index: -1}
+		if after, ok := strings.CutPrefix(rest, ".."); ok {
+			step.recursive = true
+			rest = after
+			if !strings.HasPrefix(rest, "[") {
+				rest = "." + rest
+			}
+		}
+		switch {
+		case strings.HasPrefix(rest, "["):
+			inner, after, ok := strings.Cut(rest[1:], "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid JSONPath %q: unclosed [", path)
+			}
+			rest = after
+			switch {
+			case inner == "*":
+				step.wildcard = true
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				step.name = inner[1 : len(inner)-1]
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid JSONPath %q: bad index [%s]", path, inner)
+				}
+				step.index = index
+			}
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			name := rest[1:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("invalid JSONPath %q: empty name", path)
+			case "*":
+				step.wildcard = true
+			default:
+				step.name = name
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q", path, rest)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("invalid JSONPath %q: selects the whole document", path)
+	}
+	return steps, nil
+}
+
+// applies reports whether the rule scrubs bodies of the media type
+func (r *BodyRule) applies(mediaType string) bool {
+	return r.contentTypes.Len() == 0 || r.contentTypes.Match(mediaType)
+}
+
+// scrubBody applies the body rules to a decoded body of the Content-Type, returning the body and
+// whether it changed
+func (r *Redaction) scrubBody(contentType string, body []byte) ([]byte, bool) {
+	if r == nil || len(r.Bodies) == 0 || len(body) == 0 {
+		return body, false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	changed := false
+	for i := range r.Bodies {
+		rule := &r.Bodies[i]
+		if !rule.applies(mediaType) {
+			continue
+		}
+		if len(rule.paths) > 0 {
+			if scrubbed, ok := scrubJSON(body, rule.paths, rule.Replacement); ok {
+				body, changed = scrubbed, true
+			}
+		}
+		if rule.pattern != nil && rule.pattern.Match(body) {
+			body, changed = rule.pattern.ReplaceAll(body, []byte(rule.Replacement)), true
+		}
+	}
+	return body, changed
+}
+
+// scrubJSON replaces the values selected by the paths in a JSON document. The document is only
+// re-encoded, with two-space indentation, when a value was replaced.
+func scrubJSON(body []byte, paths [][]pathStep, replacement string) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, false
+	}
+	replaced := false
+	for _, steps := range paths {
+		document = replaceJSON(document, steps, replacement, &replaced)
+	}
+	if !replaced {
+		return nil, false
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return nil, false
+	}
+	return buffer.Bytes(), true
+}
+
+// replaceJSON replaces the values the steps select under value, returning the updated value
+func replaceJSON(value any, steps []pathStep, replacement string, replaced *bool) any {
+	if len(steps) == 0 {
+		*replaced = true
+		return replacement
+	}
+	step := steps[0]
+
+	// A recursive step also applies below every member and element
+	if step.recursive {
+		switch container := value.(type) {
+		case map[string]any:
+			for key, child := range container {
+				container[key] = replaceJSON(child, steps, replacement, replaced)
+			}
+		case []any:
+			for i, child := range container {
+				container[i] = replaceJSON(child, steps, replacement, replaced)
+			}
+		}
+	}
+
+	switch container := value.(type) {
+	case map[string]any:
+		for key, child := range container {
+			if step.selects(key, -1) {
+				container[key] = replaceJSON(child, steps[1:], replacement, replaced)
+			}
+		}
+	case []any:
+		for i, child := range container {
+			if step.selects("", i) {
+				container[i] = replaceJSON(child, steps[1:], replacement, replaced)
+			}
+		}
+	}
+	return value
+}
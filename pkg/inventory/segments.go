@@ -0,0 +1,69 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// SegmentManifestFile lists the segments of a rotated recording, in the inventory directory
+const SegmentManifestFile = "segments.json"
+
+// SegmentsDir holds the segments of a rotated recording, each a complete inventory
+const SegmentsDir = "segments"
+
+// SegmentManifest links the segments of a recording rotated by time or size
+type SegmentManifest struct {
+	EntryURL string    `json:"entryUrl"`
+	Segments []Segment `json:"segments"`
+}
+
+// Segment is one part of a rotated recording, replayable on its own
+type Segment struct {
+	// Dir is the inventory directory of the segment, relative to the manifest
+	Dir        string    `json:"dir"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Requests   int       `json:"requests"`
+	Bytes      int64     `json:"bytes"`
+}
+
+// SegmentDir returns the directory of the segment with the given number, from 1
+func SegmentDir(number int) string {
+	return path.Join(SegmentsDir, fmt.Sprintf("%04d", number))
+}
+
+// LoadSegmentManifest reads segments.json from the base directory; it returns an empty manifest
+// when the recording was never rotated
+func LoadSegmentManifest(baseDir string) (*SegmentManifest, error) {
+	data, err := os.ReadFile(filepath.Join(baseDir, SegmentManifestFile))
+	if os.IsNotExist(err) {
+		return &SegmentManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read segment manifest: %w", err)
+	}
+	var manifest SegmentManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse segment manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// WriteSegmentManifest writes segments.json to the base directory
+func (pm *PersistenceManager) WriteSegmentManifest(manifest *SegmentManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal segment manifest: %w", err)
+	}
+	if err := os.MkdirAll(pm.BaseDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := pm.writeMetadata(filepath.Join(pm.BaseDir, SegmentManifestFile), data); err != nil {
+		return fmt.Errorf("failed to write segment manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// PlaybackSettingsFile is the file next to inventory.json that overrides its playback section,
+// so the settings can be changed without editing the recorded inventory
+const PlaybackSettingsFile = "playback.json"
+
+// LoadSettings returns the playback settings of the inventory: playback.json when it exists, else
+// the playback section of inventory.json. It returns nil when neither configures playback.
+func (pm *PlaybackManager) LoadSettings() (*types.PlaybackSettings, error) {
+	data, err := pm.readFile(PlaybackSettingsFile)
+	if err == nil {
+		var settings types.PlaybackSettings
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", PlaybackSettingsFile, err)
+		}
+		return &settings, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", PlaybackSettingsFile, err)
+	}
+
+	if !pm.HasInventory() {
+		return nil, nil
+	}
+	inventory, err := pm.loadInventory()
+	if err != nil {
+		return nil, err
+	}
+	return inventory.Playback, nil
+}
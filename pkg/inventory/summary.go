@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// SummaryFile is the file name of the recording summary written next to inventory.json
+const SummaryFile = "summary.json"
+
+// RecordingSummary holds the key numbers of a finished recording
+type RecordingSummary struct {
+	EntryURL   string         `json:"entryUrl"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt time.Time      `json:"finishedAt"`
+	ElapsedMS  int64          `json:"elapsedMs"`
+	Requests   int            `json:"requests"`
+	Domains    map[string]int `json:"domains"`
+	Bytes      int64          `json:"bytes"`
+	Failures   int            `json:"failures"`
+	Truncated  int            `json:"truncated"`
+	SampledOut int            `json:"sampledOut"`
+	CacheHits  int            `json:"cacheHits"`
+	Origin     int            `json:"origin"`
+	// LargeHeaders counts exchanges with headers over common client limits
+	LargeHeaders int `json:"largeHeaders"`
+	// Omitted counts the responses recorded without their bodies (--max-body-size, --skip-content-types)
+	Omitted int `json:"omitted,omitempty"`
+	// ProxyOverheadAvgMS and ProxyOverheadMaxMS describe the time the proxy itself added before the
+	// responses started, which the recorded TTFBs leave out
+	ProxyOverheadAvgMS float64 `json:"proxyOverheadAvgMs,omitempty"`
+	ProxyOverheadMaxMS float64 `json:"proxyOverheadMaxMs,omitempty"`
+	// TLSHandshakes counts the upstream TLS connections opened, TLSResumed those that resumed a session
+	TLSHandshakes int `json:"tlsHandshakes"`
+	TLSResumed    int `json:"tlsResumed"`
+	// Languages counts the responses by language (Content-Language or the lang of HTML documents)
+	Languages map[string]int `json:"languages,omitempty"`
+	// StoppedLowDisk is set when recording stopped early because free disk space ran low
+	StoppedLowDisk bool `json:"stoppedLowDisk,omitempty"`
+	// Filled in while saving
+	Resources  int `json:"resources"`
+	Duplicates int `json:"duplicates"`
+	Beautified int `json:"beautified"`
+	// Normalized counts the JSON content files saved in normalized form
+	Normalized int `json:"normalized,omitempty"`
+	// Scrubbed counts the content files the body rules of the redaction changed
+	Scrubbed int `json:"scrubbed,omitempty"`
+	// Kept counts the resources of the previous inventory an appending save kept
+	Kept int `json:"kept,omitempty"`
+}
+
+// NewRecordingSummary summarizes the recorded transactions; the save counters are filled in
+// when the summary is attached to a PersistenceManager that saves them
+func NewRecordingSummary(transactions []types.RecordingTransaction, entryURL string, startedAt time.Time) *RecordingSummary {
+	finishedAt := time.Now()
+	summary := &RecordingSummary{
+		EntryURL:   entryURL,
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+		ElapsedMS:  finishedAt.Sub(startedAt).Milliseconds(),
+		Requests:   len(transactions),
+		Domains:    make(map[string]int),
+	}
+
+	var overhead time.Duration
+	for _, transaction := range transactions {
+		if u, err := url.Parse(transaction.URL); err == nil {
+			summary.Domains[u.Host]++
+		}
+		overhead += transaction.ProxyOverhead
+		if ms := float64(transaction.ProxyOverhead.Microseconds()) / 1000; ms > summary.ProxyOverheadMaxMS {
+			summary.ProxyOverheadMaxMS = ms
+		}
+		summary.Bytes += int64(len(transaction.Body))
+		if transaction.StatusCode == nil || *transaction.StatusCode >= 400 || transaction.ErrorMessage != nil {
+			summary.Failures++
+		}
+		if transaction.Truncated {
+			summary.Truncated++
+		}
+		if transaction.BodyOmitted {
+			summary.Omitted++
+		}
+		if len(transaction.HeaderWarnings) > 0 {
+			summary.LargeHeaders++
+		}
+		if transaction.TLSSession != nil {
+			summary.TLSHandshakes++
+			if transaction.TLSSession.Resumed {
+				summary.TLSResumed++
+			}
+		}
+		if language := transactionLanguage(&transaction); language != "" {
+			if summary.Languages == nil {
+				summary.Languages = make(map[string]int)
+			}
+			summary.Languages[language]++
+		}
+		switch DetectCacheStatus(transaction.RawHeaders) {
+		case types.CacheStatusHit:
+			summary.CacheHits++
+		case types.CacheStatusOrigin:
+			summary.Origin++
+		}
+	}
+	if len(transactions) > 0 {
+		summary.ProxyOverheadAvgMS = float64((overhead / time.Duration(len(transactions))).Microseconds()) / 1000
+	}
+
+	return summary
+}
+
+// WriteSummary writes summary.json to the base directory
+func (pm *PersistenceManager) WriteSummary(summary *RecordingSummary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal summary: %w", err)
+	}
+	if err := os.MkdirAll(pm.BaseDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := pm.writeMetadata(filepath.Join(pm.BaseDir, SummaryFile), data); err != nil {
+		return fmt.Errorf("failed to write summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package inventory
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// minTimingSamples is the number of resources a domain needs before its percentiles are trusted
+const minTimingSamples = 5
+
+// TimingOptions configures NormalizeTiming
+type TimingOptions struct {
+	// Percentile clamps TTFB above this percentile and Mbps below (100 - Percentile) per domain; 0 disables clamping
+	Percentile float64
+	// TTFB sets an explicit TTFB in milliseconds per content type pattern (e.g. "image/*")
+	TTFB map[string]int64
+	// MBPS sets an explicit Mbps per content type pattern
+	MBPS map[string]float64
+	// DryRun reports changes without saving the inventory
+	DryRun bool
+}
+
+// TimingChange describes one rewritten timing value
+type TimingChange struct {
+	URL    string
+	Field  string // "ttfbMs" or "mbps"
+	Before float64
+	After  float64
+}
+
+// ParseTTFBOverrides parses "type=ms" pairs
+func ParseTTFBOverrides(pairs []string) (map[string]int64, error) {
+	result := make(map[string]int64)
+	for _, pair := range pairs {
+		pattern, value, err := splitOverride(pair)
+		if err != nil {
+			return nil, err
+		}
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid TTFB %q, expected milliseconds", value)
+		}
+		result[pattern] = ms
+	}
+	return result, nil
+}
+
+// ParseMBPSOverrides parses "type=mbps" pairs
+func ParseMBPSOverrides(pairs []string) (map[string]float64, error) {
+	result := make(map[string]float64)
+	for _, pair := range pairs {
+		pattern, value, err := splitOverride(pair)
+		if err != nil {
+			return nil, err
+		}
+		mbps, err := strconv.ParseFloat(value, 64)
+		if err != nil || mbps <= 0 {
+			return nil, fmt.Errorf("invalid Mbps %q, expected a positive number", value)
+		}
+		result[pattern] = mbps
+	}
+	return result, nil
+}
+
+// splitOverride splits "pattern=value" and validates the content type pattern
+func splitOverride(pair string) (string, string, error) {
+	pattern, value, ok := strings.Cut(pair, "=")
+	if !ok || pattern == "" {
+		return "", "", fmt.Errorf("invalid override %q, expected type=value", pair)
+	}
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", "", fmt.Errorf("invalid content type pattern %q: %w", pattern, err)
+	}
+	return pattern, strings.TrimSpace(value), nil
+}
+
+// NormalizeTiming rewrites outlier TTFB and Mbps values so a recording taken on a flaky network
+// can become a stable fixture. Explicit per content type values take precedence over clamping.
+func (pm *PersistenceManager) NormalizeTiming(opts TimingOptions) ([]TimingChange, error) {
+	inventory, err := pm.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+
+	ttfbLimits, mbpsFloors := domainTimingLimits(inventory.Resources, opts.Percentile)
+	ttfbPatterns := make([]string, 0, len(opts.TTFB))
+	for pattern := range opts.TTFB {
+		ttfbPatterns = append(ttfbPatterns, pattern)
+	}
+	mbpsPatterns := make([]string, 0, len(opts.MBPS))
+	for pattern := range opts.MBPS {
+		mbpsPatterns = append(mbpsPatterns, pattern)
+	}
+
+	var changes []TimingChange
+	for i := range inventory.Resources {
+		resource := &inventory.Resources[i]
+		host := resourceHost(resource)
+		mimeType := ""
+		if resource.ContentTypeMime != nil {
+			mimeType = strings.ToLower(*resource.ContentTypeMime)
+		}
+
+		ttfb := resource.TTFBMS
+		if pattern, ok := bestPattern(mimeType, ttfbPatterns); ok {
+			ttfb = opts.TTFB[pattern]
+		} else if limit, ok := ttfbLimits[host]; ok && ttfb > limit {
+			ttfb = limit
+		}
+		if ttfb != resource.TTFBMS {
+			changes = append(changes, TimingChange{URL: resource.URL, Field: "ttfbMs", Before: float64(resource.TTFBMS), After: float64(ttfb)})
+			resource.TTFBMS = ttfb
+		}
+
+		mbps := 0.0
+		if resource.MBPS != nil {
+			mbps = *resource.MBPS
+		}
+		newMBPS := mbps
+		if pattern, ok := bestPattern(mimeType, mbpsPatterns); ok {
+			newMBPS = opts.MBPS[pattern]
+		} else if floor, ok := mbpsFloors[host]; ok && mbps > 0 && mbps < floor {
+			newMBPS = floor
+		}
+		if newMBPS != mbps {
+			changes = append(changes, TimingChange{URL: resource.URL, Field: "mbps", Before: mbps, After: newMBPS})
+			resource.MBPS = &newMBPS
+		}
+	}
+
+	if !opts.DryRun && len(changes) > 0 {
+		if err := pm.SaveInventory(inventory); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// domainTimingLimits returns the TTFB ceiling and Mbps floor of each domain with enough samples
+func domainTimingLimits(resources []types.Resource, percentile float64) (map[string]int64, map[string]float64) {
+	ttfbLimits := make(map[string]int64)
+	mbpsFloors := make(map[string]float64)
+	if percentile <= 0 || percentile >= 100 {
+		return ttfbLimits, mbpsFloors
+	}
+
+	ttfbs := make(map[string][]float64)
+	mbpss := make(map[string][]float64)
+	for i := range resources {
+		host := resourceHost(&resources[i])
+		if resources[i].TTFBMS > 0 {
+			ttfbs[host] = append(ttfbs[host], float64(resources[i].TTFBMS))
+		}
+		if resources[i].MBPS != nil && *resources[i].MBPS > 0 {
+			mbpss[host] = append(mbpss[host], *resources[i].MBPS)
+		}
+	}
+
+	for host, values := range ttfbs {
+		if len(values) >= minTimingSamples {
+			ttfbLimits[host] = int64(nearestRank(values, percentile))
+		}
+	}
+	// Slow transfers are the outliers for throughput, so the floor mirrors the TTFB percentile
+	for host, values := range mbpss {
+		if len(values) >= minTimingSamples {
+			mbpsFloors[host] = nearestRank(values, 100-percentile)
+		}
+	}
+	return ttfbLimits, mbpsFloors
+}
+
+// nearestRank returns the nearest-rank percentile of values
+func nearestRank(values []float64, percentile float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// bestPattern returns the most specific (longest) pattern matching mimeType
+func bestPattern(mimeType string, patterns []string) (string, bool) {
+	best := ""
+	found := false
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mimeType); ok && (!found || len(pattern) > len(best)) {
+			best, found = pattern, true
+		}
+	}
+	return best, found
+}
+
+func resourceHost(resource *types.Resource) string {
+	u, err := url.Parse(resource.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
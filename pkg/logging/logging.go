@@ -0,0 +1,271 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/MatusOllah/slogcolor"
+)
+
+// Modules with independently configurable log levels
+const (
+	ModulePlayback  = "playback"
+	ModuleRecording = "recording"
+	ModuleInventory = "inventory"
+	ModuleEncoding  = "encoding"
+	ModuleProxy     = "proxy"
+)
+
+// Output formats
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// DefaultModule is the key used for the level of loggers without a module
+const DefaultModule = "default"
+
+// Modules lists the known modules
+var Modules = []string{ModulePlayback, ModuleRecording, ModuleInventory, ModuleEncoding, ModuleProxy}
+
+// Options configures the logging backend
+type Options struct {
+	// Level is the default level (debug, info, warn, error)
+	Level string
+	// ModuleLevels overrides the level per module
+	ModuleLevels map[string]string
+	// Format is console (colored) or json
+	Format string
+	// Writer defaults to os.Stderr
+	Writer io.Writer
+	// AccessLog is the file the access log is written to (empty disables it)
+	AccessLog string
+	// AccessLogRotation controls rotation of the access log
+	AccessLogRotation RotateOptions
+}
+
+// levelSet holds the default level and per-module overrides
+type levelSet struct {
+	defaultLevel slog.LevelVar
+	modules      map[string]*slog.LevelVar
+	mutex        sync.RWMutex
+}
+
+var (
+	levels    = &levelSet{modules: make(map[string]*slog.LevelVar)}
+	backend   atomic.Pointer[slog.Handler]
+	accessLog atomic.Pointer[RotatingFile]
+)
+
+func init() {
+	// Until Setup is called, log everything at info level in text format
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})
+	backend.Store(&handler)
+}
+
+// Setup configures the backend and levels and installs the facade as slog's default logger
+func Setup(opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	for module, value := range opts.ModuleLevels {
+		if _, err := ParseLevel(value); err != nil {
+			return fmt.Errorf("module %s: %w", module, err)
+		}
+	}
+
+	writer := opts.Writer
+	if writer == nil {
+		writer = os.Stderr
+	}
+
+	// The backend accepts everything; filtering is done per module by the facade
+	var handler slog.Handler
+	switch opts.Format {
+	case "", FormatConsole:
+		handler = slogcolor.NewHandler(writer, &slogcolor.Options{
+			Level:       slog.LevelDebug,
+			TimeFormat:  "15:04:05",
+			SrcFileMode: slogcolor.ShortFile,
+		})
+	case FormatJSON:
+		handler = slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true})
+	default:
+		return fmt.Errorf("unknown log format: %s", opts.Format)
+	}
+	if err := setupAccessLog(opts); err != nil {
+		return err
+	}
+	backend.Store(&handler)
+
+	levels.defaultLevel.Set(level)
+	levels.mutex.Lock()
+	levels.modules = make(map[string]*slog.LevelVar)
+	levels.mutex.Unlock()
+	for module, value := range opts.ModuleLevels {
+		moduleLevel, _ := ParseLevel(value)
+		SetLevel(module, moduleLevel)
+	}
+
+	slog.SetDefault(For(""))
+	return nil
+}
+
+// setupAccessLog opens the access log file, closing the previously configured one
+func setupAccessLog(opts Options) error {
+	var file *RotatingFile
+	if opts.AccessLog != "" {
+		var err error
+		if file, err = OpenRotatingFile(opts.AccessLog, opts.AccessLogRotation); err != nil {
+			return fmt.Errorf("access log: %w", err)
+		}
+	}
+	if previous := accessLog.Swap(file); previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// AccessLog returns the configured access log file, or nil if the access log is disabled
+func AccessLog() io.Writer {
+	if file := accessLog.Load(); file != nil {
+		return file
+	}
+	return nil
+}
+
+// For returns a logger for the module. Loggers obtained before Setup follow later configuration.
+func For(module string) *slog.Logger {
+	return slog.New(&moduleHandler{module: module})
+}
+
+// ParseLevel parses a level name
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return slog.LevelInfo, fmt.Errorf("unknown log level: %s", s)
+	}
+}
+
+// ParseModuleLevels parses "module=level" pairs
+func ParseModuleLevels(pairs []string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range pairs {
+		module, level, ok := strings.Cut(pair, "=")
+		if !ok || module == "" {
+			return nil, fmt.Errorf("invalid module level %q, expected module=level", pair)
+		}
+		if _, err := ParseLevel(level); err != nil {
+			return nil, err
+		}
+		result[strings.ToLower(module)] = level
+	}
+	return result, nil
+}
+
+// SetLevel changes the level of a module at runtime; DefaultModule or "" changes the default level
+func SetLevel(module string, level slog.Level) {
+	if module == "" || module == DefaultModule {
+		levels.defaultLevel.Set(level)
+		return
+	}
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+	v, ok := levels.modules[module]
+	if !ok {
+		v = new(slog.LevelVar)
+		levels.modules[module] = v
+	}
+	v.Set(level)
+}
+
+// ResetLevel removes a module override so it follows the default level again
+func ResetLevel(module string) {
+	levels.mutex.Lock()
+	defer levels.mutex.Unlock()
+	delete(levels.modules, module)
+}
+
+// Level returns the effective level of a module
+func Level(module string) slog.Level {
+	levels.mutex.RLock()
+	v, ok := levels.modules[module]
+	levels.mutex.RUnlock()
+	if ok {
+		return v.Level()
+	}
+	return levels.defaultLevel.Level()
+}
+
+// Levels returns the default level and all module overrides as level names
+func Levels() map[string]string {
+	result := map[string]string{DefaultModule: levelName(levels.defaultLevel.Level())}
+	levels.mutex.RLock()
+	defer levels.mutex.RUnlock()
+	names := make([]string, 0, len(levels.modules))
+	for module := range levels.modules {
+		names = append(names, module)
+	}
+	sort.Strings(names)
+	for _, module := range names {
+		result[module] = levelName(levels.modules[module].Level())
+	}
+	return result
+}
+
+// levelName returns the lower-case name used in config for a level
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// moduleHandler filters records by module level and forwards them to the current backend
+type moduleHandler struct {
+	module string
+	// ops replays WithAttrs/WithGroup calls on the backend, which may be replaced after creation
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *moduleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= Level(h.module)
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, record slog.Record) error {
+	handler := *backend.Load()
+	if h.module != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("module", h.module)})
+	}
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *moduleHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &moduleHandler{module: h.module, ops: append(ops, op)}
+}
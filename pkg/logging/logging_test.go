@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestModuleLevels(t *testing.T) {
+	var buf bytes.Buffer
+	err := Setup(Options{
+		Level:        "warn",
+		ModuleLevels: map[string]string{ModulePlayback: "debug"},
+		Format:       FormatJSON,
+		Writer:       &buf,
+	})
+	if err != nil {
+		t.Fatalf("Failed to setup logging: %v", err)
+	}
+
+	For(ModulePlayback).Debug("playback debug")
+	For(ModuleInventory).Info("inventory info")
+	For(ModuleInventory).Warn("inventory warn")
+
+	output := buf.String()
+	if !strings.Contains(output, "playback debug") {
+		t.Error("Expected playback debug log to be written")
+	}
+	if strings.Contains(output, "inventory info") {
+		t.Error("Expected inventory info log to be filtered")
+	}
+	if !strings.Contains(output, "inventory warn") {
+		t.Error("Expected inventory warn log to be written")
+	}
+
+	// Each record carries its module
+	line := strings.Split(strings.TrimSpace(output), "\n")[0]
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("Failed to parse JSON log: %v", err)
+	}
+	if record["module"] != ModulePlayback {
+		t.Errorf("Expected module %s, got %v", ModulePlayback, record["module"])
+	}
+}
+
+func TestSetLevel_Runtime(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(Options{Level: "info", Format: FormatJSON, Writer: &buf}); err != nil {
+		t.Fatalf("Failed to setup logging: %v", err)
+	}
+
+	// Loggers created before a level change follow it
+	logger := For(ModuleEncoding).With("key", "value")
+	logger.Debug("before")
+	SetLevel(ModuleEncoding, slog.LevelDebug)
+	logger.Debug("after")
+
+	output := buf.String()
+	if strings.Contains(output, "before") {
+		t.Error("Expected debug log before level change to be filtered")
+	}
+	if !strings.Contains(output, "after") || !strings.Contains(output, `"key":"value"`) {
+		t.Errorf("Expected debug log with attrs after level change, got %s", output)
+	}
+
+	if Levels()[ModuleEncoding] != "debug" {
+		t.Errorf("Expected encoding level debug, got %v", Levels())
+	}
+	ResetLevel(ModuleEncoding)
+	if Level(ModuleEncoding) != slog.LevelInfo {
+		t.Error("Expected reset module to follow the default level")
+	}
+}
+
+func TestParseModuleLevels(t *testing.T) {
+	levels, err := ParseModuleLevels([]string{"playback=debug", "Inventory=warn"})
+	if err != nil {
+		t.Fatalf("Failed to parse module levels: %v", err)
+	}
+	if levels["playback"] != "debug" || levels["inventory"] != "warn" {
+		t.Errorf("Unexpected levels: %v", levels)
+	}
+
+	for _, invalid := range []string{"playback", "=debug", "playback=verbose"} {
+		if _, err := ParseModuleLevels([]string{invalid}); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestRotatingFile_SizeCompressKeep(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.jsonl")
+	file, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, Keep: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "line-4\n" {
+		t.Errorf("Expected current file to hold the last line, got %q", current)
+	}
+
+	rotated, _ := filepath.Glob(path + ".*")
+	sort.Strings(rotated)
+	if len(rotated) != 2 {
+		t.Fatalf("Expected 2 rotated files to be kept, got %v", rotated)
+	}
+	for i, name := range rotated {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("Expected rotated file to be compressed: %s", name)
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("Failed to read gzip %s: %v", name, err)
+		}
+		data, _ := io.ReadAll(gz)
+		f.Close()
+		// The oldest rotation (line-1) was pruned
+		if expected := []string{"line-2\n", "line-3\n"}[i]; string(data) != expected {
+			t.Errorf("Expected %q in %s, got %q", expected, name, data)
+		}
+	}
+}
+
+// TestRotatingFile_KeepSiblings tests that pruning leaves files that only share the log's name
+func TestRotatingFile_KeepSiblings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.jsonl")
+	siblings := []string{"access.jsonl.bak", "access.jsonl.map", "access.jsonl.20240101.gz"}
+	for _, name := range siblings {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("keep\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, err := OpenRotatingFile(path, RotateOptions{MaxSize: 10, Keep: 1})
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	defer file.Close()
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+	}
+
+	for _, name := range siblings {
+		if !exists(filepath.Join(dir, name)) {
+			t.Errorf("Expected %s to be kept", name)
+		}
+	}
+	rotated, err := file.rotatedFiles()
+	if err != nil {
+		t.Fatalf("Failed to list rotated files: %v", err)
+	}
+	if len(rotated) != 1 {
+		t.Errorf("Expected 1 rotated file to be kept, got %v", rotated)
+	}
+}
+
+func TestRotatingFile_Append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.jsonl")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Existing content counts towards the size limit
+	file, err := OpenRotatingFile(path, RotateOptions{MaxSize: 6})
+	if err != nil {
+		t.Fatalf("Failed to open rotating file: %v", err)
+	}
+	file.Write([]byte("new\n"))
+	file.Close()
+
+	current, _ := os.ReadFile(path)
+	if string(current) != "new\n" {
+		t.Errorf("Expected rotation before appending past the limit, got %q", current)
+	}
+	rotated, _ := filepath.Glob(path + ".*")
+	if len(rotated) != 1 {
+		t.Errorf("Expected 1 uncompressed rotated file, got %v", rotated)
+	}
+}
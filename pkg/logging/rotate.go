@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is appended to the file name of rotated files; fixed width so names sort by time
+const rotatedTimeFormat = "20060102-150405.000000000"
+
+// RotateOptions controls when a log file is rotated and how many rotated files are kept
+type RotateOptions struct {
+	// MaxSize rotates the file once it reaches this many bytes (0 disables)
+	MaxSize int64
+	// MaxAge rotates the file once it was opened this long ago (0 disables)
+	MaxAge time.Duration
+	// Keep is the number of rotated files to retain (0 keeps all)
+	Keep int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// RotatingFile is an append-only file that rotates itself by size and age
+type RotatingFile struct {
+	path     string
+	opts     RotateOptions
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	mutex    sync.Mutex
+}
+
+// OpenRotatingFile opens (or creates) the file at path for appending
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	return nil
+}
+
+// Write appends p, rotating first when the file is full or too old
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.due(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n more bytes
+func (r *RotatingFile) due(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.opts.MaxSize > 0 && r.size+int64(n) > r.opts.MaxSize {
+		return true
+	}
+	return r.opts.MaxAge > 0 && time.Since(r.openedAt) >= r.opts.MaxAge
+}
+
+// rotate renames the current file, optionally compresses it, prunes old files and reopens
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	r.file = nil
+
+	rotated := r.rotatedPath(time.Now())
+	if err := os.Rename(r.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if r.opts.Compress {
+		if err := compressFile(rotated); err != nil {
+			// Keep the uncompressed file rather than losing it
+			For(ModuleProxy).Warn("Failed to compress rotated log", "path", rotated, "error", err)
+		}
+	}
+	r.prune()
+	return r.open()
+}
+
+// rotatedPath names a rotated file after t, moving past names already taken
+func (r *RotatingFile) rotatedPath(t time.Time) string {
+	for {
+		path := r.path + "." + t.Format(rotatedTimeFormat)
+		if !exists(path) && !exists(path+".gz") {
+			return path
+		}
+		t = t.Add(time.Nanosecond)
+	}
+}
+
+// prune removes the oldest rotated files beyond the retention count
+func (r *RotatingFile) prune() {
+	if r.opts.Keep <= 0 {
+		return
+	}
+	rotated, err := r.rotatedFiles()
+	if err != nil {
+		return
+	}
+	for len(rotated) > r.opts.Keep {
+		if err := os.Remove(rotated[0]); err != nil {
+			For(ModuleProxy).Warn("Failed to remove rotated log", "path", rotated[0], "error", err)
+		}
+		rotated = rotated[1:]
+	}
+}
+
+// rotatedFiles returns the rotated files of the log oldest first, as their timestamps sort
+// chronologically; other files sharing its name as a prefix, such as access.jsonl.bak, are left out
+func (r *RotatingFile) rotatedFiles() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(r.path) + "."
+	var rotated []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil || len(stamp) != len(rotatedTimeFormat) {
+			continue
+		}
+		rotated = append(rotated, filepath.Join(filepath.Dir(r.path), name))
+	}
+	sort.Strings(rotated)
+	return rotated, nil
+}
+
+// Close closes the current file
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// compressFile gzips path to path.gz and removes the original
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return err
+	}
+	src.Close()
+	return os.Remove(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
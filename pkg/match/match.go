@@ -0,0 +1,249 @@
+// Package match compiles the patterns of rules once, so rules evaluated on every request do not
+// parse them again. Patterns are globs as matched by path.Match ('*' does not cross '/'), or
+// regular expressions when prefixed with "re:".
+package match
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RegexpPrefix marks a pattern as a regular expression
+const RegexpPrefix = "re:"
+
+// cacheSize bounds the results a Cache remembers; it is cleared when it is full
+const cacheSize = 4096
+
+// cacheThreshold is the number of non-literal patterns from which a Set remembers its results
+const cacheThreshold = 8
+
+type kind int
+
+const (
+	kindLiteral kind = iota // no wildcard: the value equals the pattern
+	kindAny                 // "*": any value without '/'
+	kindPrefix              // "text*"
+	kindSuffix              // "*text"
+	kindGlob                // any other glob
+	kindRegexp              // "re:expression"
+)
+
+// Pattern is a compiled glob or regular expression
+type Pattern struct {
+	source string
+	kind   kind
+	// text is the literal of literal, prefix and suffix patterns, and the literal start of other globs
+	text   string
+	regexp *regexp.Regexp
+}
+
+// Compile compiles a glob, or a regular expression prefixed with "re:"
+func Compile(pattern string) (*Pattern, error) {
+	p := &Pattern{source: pattern}
+
+	if expression, ok := strings.CutPrefix(pattern, RegexpPrefix); ok {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", expression, err)
+		}
+		p.kind = kindRegexp
+		p.regexp = re
+		return p, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	meta := strings.IndexAny(pattern, `*?[\`)
+	switch {
+	case meta < 0:
+		p.kind = kindLiteral
+		p.text = pattern
+	case pattern == "*":
+		p.kind = kindAny
+	case meta == len(pattern)-1 && pattern[meta] == '*':
+		p.kind = kindPrefix
+		p.text = pattern[:meta]
+	case meta == 0 && pattern[0] == '*' && !strings.ContainsAny(pattern[1:], `*?[\`):
+		p.kind = kindSuffix
+		p.text = pattern[1:]
+	default:
+		p.kind = kindGlob
+		p.text = pattern[:meta]
+	}
+	return p, nil
+}
+
+// MustCompile is like Compile but panics on invalid patterns
+func MustCompile(pattern string) *Pattern {
+	p, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the pattern as written
+func (p *Pattern) String() string {
+	return p.source
+}
+
+// Literal reports whether the pattern matches only the value equal to it
+func (p *Pattern) Literal() bool {
+	return p.kind == kindLiteral
+}
+
+// Match reports whether the value matches the pattern
+func (p *Pattern) Match(value string) bool {
+	switch p.kind {
+	case kindLiteral:
+		return value == p.text
+	case kindAny:
+		return !strings.Contains(value, "/")
+	case kindPrefix:
+		return strings.HasPrefix(value, p.text) && !strings.Contains(value[len(p.text):], "/")
+	case kindSuffix:
+		return strings.HasSuffix(value, p.text) && !strings.Contains(value[:len(value)-len(p.text)], "/")
+	case kindRegexp:
+		return p.regexp.MatchString(value)
+	default:
+		if !strings.HasPrefix(value, p.text) {
+			return false
+		}
+		ok, _ := path.Match(p.source, value)
+		return ok
+	}
+}
+
+// Set is a list of compiled patterns matched in order
+type Set struct {
+	patterns []*Pattern
+	// exact maps the literal patterns to their first index
+	exact map[string]int
+	// others are the indexes of the other patterns, in order
+	others []int
+
+	// cache is set for sets whose patterns take long to match
+	cache *Cache[int]
+}
+
+// CompileSet compiles the patterns of a set
+func CompileSet(patterns []string) (*Set, error) {
+	s := &Set{exact: make(map[string]int)}
+	for i, pattern := range patterns {
+		p, err := Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		s.patterns = append(s.patterns, p)
+		if p.Literal() {
+			if _, exists := s.exact[pattern]; !exists {
+				s.exact[pattern] = i
+			}
+		} else {
+			s.others = append(s.others, i)
+		}
+	}
+	if len(s.others) >= cacheThreshold {
+		s.cache = &Cache[int]{}
+	}
+	return s, nil
+}
+
+// MustCompileSet is like CompileSet but panics on invalid patterns
+func MustCompileSet(patterns ...string) *Set {
+	s, err := CompileSet(patterns)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Len returns the number of patterns; a nil Set has none
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.patterns)
+}
+
+// Index returns the index of the first pattern matching the value, or -1
+func (s *Set) Index(value string) int {
+	if s.Len() == 0 {
+		return -1
+	}
+
+	if index, ok := s.cache.Get(value); ok {
+		return index
+	}
+
+	index := -1
+	if len(s.exact) > 0 {
+		if i, ok := s.exact[value]; ok {
+			index = i
+		}
+	}
+	for _, i := range s.others {
+		if index >= 0 && i > index {
+			break
+		}
+		if s.patterns[i].Match(value) {
+			index = i
+			break
+		}
+	}
+
+	s.cache.Put(value, index)
+	return index
+}
+
+// Match reports whether any pattern matches the value
+func (s *Set) Match(value string) bool {
+	return s.Index(value) >= 0
+}
+
+// Cache remembers the results of matching keys against rules; requests repeat during playback, so
+// most are matched once. The zero value is ready to use and a nil Cache remembers nothing.
+type Cache[V any] struct {
+	entries map[string]V
+	mutex   sync.RWMutex
+}
+
+// Get returns the result remembered for the key
+func (c *Cache[V]) Get(key string) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	value, ok := c.entries[key]
+	return value, ok
+}
+
+// Put remembers the result for the key
+func (c *Cache[V]) Put(key string, value V) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil || len(c.entries) >= cacheSize {
+		c.entries = make(map[string]V)
+	}
+	c.entries[key] = value
+}
+
+// Len returns the number of remembered results
+func (c *Cache[V]) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.entries)
+}
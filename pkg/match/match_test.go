@@ -0,0 +1,144 @@
+package match
+
+import (
+	"fmt"
+	"path"
+	"testing"
+)
+
+// TestPattern_MatchesLikePathMatch checks the fast paths against path.Match
+func TestPattern_MatchesLikePathMatch(t *testing.T) {
+	patterns := []string{
+		"example.com", "*", "*.example.com", "/api/*", "/api/*/items", "img?.png",
+		"/static/[a-c]*", `/a\*b`, "*.js", "cdn.*.net", "", "/",
+	}
+	values := []string{
+		"example.com", "www.example.com", "a.b.example.com", "/api/users", "/api/users/1",
+		"/api/v1/items", "img1.png", "img10.png", "/static/app.js", "/static/dir/x", `/a*b`,
+		"app.js", "lib/app.js", "cdn.jsdelivr.net", "", "/",
+	}
+
+	for _, pattern := range patterns {
+		compiled := MustCompile(pattern)
+		for _, value := range values {
+			expected, _ := path.Match(pattern, value)
+			if got := compiled.Match(value); got != expected {
+				t.Errorf("Match(%q, %q) = %v, path.Match says %v", pattern, value, got, expected)
+			}
+		}
+	}
+}
+
+func TestPattern_Regexp(t *testing.T) {
+	p := MustCompile(`re:^/api/v[0-9]+/`)
+	if !p.Match("/api/v2/users") || p.Match("/api/beta/users") {
+		t.Error("Regular expression did not match as expected")
+	}
+	if _, err := Compile("re:("); err == nil {
+		t.Error("Expected an error for an invalid regular expression")
+	}
+	if _, err := Compile("[a-"); err == nil {
+		t.Error("Expected an error for an invalid glob")
+	}
+}
+
+func TestSet_Index(t *testing.T) {
+	s := MustCompileSet("/api/*", "/api/users", "re:^/api/", "/static/*")
+
+	tests := []struct {
+		value    string
+		expected int
+	}{
+		{"/api/users", 0},   // the glob comes before the literal
+		{"/api/users/1", 2}, // only the regular expression crosses '/'
+		{"/static/app.js", 3},
+		{"/other", -1},
+	}
+	for _, tt := range tests {
+		if got := s.Index(tt.value); got != tt.expected {
+			t.Errorf("Index(%q) = %d, want %d", tt.value, got, tt.expected)
+		}
+	}
+
+	// Results remembered by the cache are the same
+	s.cache = &Cache[int]{}
+	for i := 0; i < 2; i++ {
+		for _, tt := range tests {
+			if got := s.Index(tt.value); got != tt.expected {
+				t.Errorf("Cached Index(%q) = %d, want %d", tt.value, got, tt.expected)
+			}
+		}
+	}
+
+	literalFirst := MustCompileSet("/exact", "/*")
+	if got := literalFirst.Index("/exact"); got != 0 {
+		t.Errorf("Expected the literal pattern to win, got %d", got)
+	}
+
+	var empty *Set
+	if empty.Match("anything") || empty.Len() != 0 {
+		t.Error("Expected a nil set to match nothing")
+	}
+}
+
+func TestSet_CacheIsBounded(t *testing.T) {
+	patterns := make([]string, cacheThreshold)
+	for i := range patterns {
+		patterns[i] = fmt.Sprintf("/p%d/*", i)
+	}
+	s := MustCompileSet(patterns...)
+	for i := 0; i < cacheSize+10; i++ {
+		s.Index(fmt.Sprintf("/value/%d", i))
+	}
+	if s.cache.Len() > cacheSize {
+		t.Errorf("Cache grew to %d entries", s.cache.Len())
+	}
+}
+
+// benchmarkPatterns returns n host and path rules of the kinds found in configs
+func benchmarkPatterns(n int) []string {
+	patterns := make([]string, 0, n)
+	for i := 0; len(patterns) < n; i++ {
+		patterns = append(patterns,
+			fmt.Sprintf("/api/v%d/*", i),
+			fmt.Sprintf("*.cdn%d.example.com", i),
+			fmt.Sprintf("/static/%d/[a-f]*.js", i),
+			fmt.Sprintf("/exact/path/%d", i),
+		)
+	}
+	return patterns[:n]
+}
+
+func BenchmarkSet_Index(b *testing.B) {
+	for _, n := range []int{10, 100, 500} {
+		s := MustCompileSet(benchmarkPatterns(n)...)
+		b.Run(fmt.Sprintf("%d patterns cached", n), func(b *testing.B) {
+			values := make([]string, 1024)
+			for i := range values {
+				values[i] = fmt.Sprintf("/assets/%d/app.css", i)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Index(values[i%len(values)])
+			}
+		})
+		b.Run(fmt.Sprintf("%d patterns uncached", n), func(b *testing.B) {
+			s.cache = nil
+			for i := 0; i < b.N; i++ {
+				s.Index(fmt.Sprintf("/static/%d/b.js", i%n))
+			}
+		})
+	}
+}
+
+func BenchmarkPathMatch(b *testing.B) {
+	patterns := benchmarkPatterns(500)
+	for i := 0; i < b.N; i++ {
+		value := "/assets/app.css"
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				break
+			}
+		}
+	}
+}
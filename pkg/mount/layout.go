@@ -0,0 +1,139 @@
+// Package mount exposes a recorded inventory as a read-only file tree organized by host and path,
+// so standard tools (grep, diff, image viewers) can explore a recording.
+package mount
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"go-http-playback-proxy/pkg/resource"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// HeadersSuffix is appended to the path of a resource for its headers sidecar
+const HeadersSuffix = ".headers"
+
+// XattrPrefix is the namespace of the extended attributes describing a resource
+const XattrPrefix = "user.http."
+
+// Options configures a mount
+type Options struct {
+	// Sidecars adds a <file>.headers file with the status and headers of each resource
+	Sidecars bool
+	// Debug logs every FUSE request
+	Debug bool
+}
+
+// ContentReader returns the stored (decoded) body of a resource
+type ContentReader func(resource *types.Resource) ([]byte, error)
+
+// Entry is a file of the tree
+type Entry struct {
+	// Path is slash-separated: <host>/<path> for GET requests and _<method>/<host>/<path> otherwise
+	Path     string
+	Resource *types.Resource
+	// Headers marks the sidecar holding the status and headers of Resource instead of its body
+	Headers bool
+}
+
+// Layout places the resources of an inventory in the tree. Resources that would land on the same
+// path, or on a directory of another resource, get "_n" before their extension; the first recorded
+// one keeps the plain name.
+func Layout(inventory *types.Inventory, opts Options) []Entry {
+	var entries []Entry
+	for i := range inventory.Resources {
+		res := &inventory.Resources[i]
+		p, err := resourcePath(res)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{Path: p, Resource: res})
+	}
+
+	dirs := make(map[string]bool)
+	for _, entry := range entries {
+		for dir := path.Dir(entry.Path); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	taken := make(map[string]bool)
+	claim := func(p string) string {
+		claimed := p
+		for n := 1; taken[claimed] || dirs[claimed]; n++ {
+			claimed = resource.DisambiguateFilePath(p, n)
+		}
+		taken[claimed] = true
+		return claimed
+	}
+
+	for i := range entries {
+		entries[i].Path = claim(entries[i].Path)
+	}
+	if opts.Sidecars {
+		for _, entry := range entries {
+			entries = append(entries, Entry{Path: claim(entry.Path + HeadersSuffix), Resource: entry.Resource, Headers: true})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// resourcePath returns the path of a resource before collisions are resolved
+func resourcePath(res *types.Resource) (string, error) {
+	filePath, err := resource.GetResourceFilePath(res.Method, res.URL)
+	if err != nil {
+		return "", err
+	}
+	// Drop the method and protocol directories; only other methods than GET get their own tree
+	parts := strings.SplitN(filePath, "/", 3)
+	if len(parts) < 3 {
+		return "", fmt.Errorf("unexpected resource path %q", filePath)
+	}
+	if parts[0] != "get" {
+		return "_" + parts[0] + "/" + parts[2], nil
+	}
+	return parts[2], nil
+}
+
+// FormatHeaders returns the contents of a headers sidecar: the request, the status and the
+// response headers sorted by name
+func FormatHeaders(res *types.Resource) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", res.Method, res.URL)
+	if res.StatusCode != nil {
+		fmt.Fprintf(&b, "%d %s\n", *res.StatusCode, http.StatusText(*res.StatusCode))
+	}
+	for _, name := range sortedHeaderNames(res.RawHeaders) {
+		fmt.Fprintf(&b, "%s: %s\n", name, res.RawHeaders[name])
+	}
+	return []byte(b.String())
+}
+
+// Xattrs returns the extended attributes of a resource's file: its method, URL, status and
+// each response header as user.http.header.<lower-case name>
+func Xattrs(res *types.Resource) map[string]string {
+	attrs := map[string]string{
+		XattrPrefix + "method": res.Method,
+		XattrPrefix + "url":    res.URL,
+	}
+	if res.StatusCode != nil {
+		attrs[XattrPrefix+"status"] = fmt.Sprint(*res.StatusCode)
+	}
+	for name, value := range res.RawHeaders {
+		attrs[XattrPrefix+"header."+strings.ToLower(name)] = value
+	}
+	return attrs
+}
+
+func sortedHeaderNames(headers types.HttpHeaders) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
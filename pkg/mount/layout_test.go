@@ -0,0 +1,70 @@
+package mount
+
+import (
+	"testing"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+func TestLayout(t *testing.T) {
+	status := 200
+	inventory := &types.Inventory{Resources: []types.Resource{
+		{Method: "GET", URL: "https://example.com/"},
+		{Method: "GET", URL: "https://example.com/css/style.css"},
+		{Method: "GET", URL: "http://example.com/css/style.css"},
+		{Method: "POST", URL: "https://api.example.com/login.json"},
+		{Method: "GET", URL: "https://example.com/docs.txt", StatusCode: &status},
+		{Method: "GET", URL: "https://example.com/docs.txt/intro.txt"},
+	}}
+
+	entries := Layout(inventory, Options{Sidecars: true})
+	paths := make(map[string]string)
+	for _, entry := range entries {
+		if !entry.Headers {
+			paths[entry.Resource.Method+" "+entry.Resource.URL] = entry.Path
+		}
+	}
+
+	expected := map[string]string{
+		"GET https://example.com/":                   "example.com/index.html",
+		"GET https://example.com/css/style.css":      "example.com/css/style.css",
+		"GET http://example.com/css/style.css":       "example.com/css/style_1.css",
+		"POST https://api.example.com/login.json":    "_post/api.example.com/login.json",
+		"GET https://example.com/docs.txt":           "example.com/docs_1.txt",
+		"GET https://example.com/docs.txt/intro.txt": "example.com/docs.txt/intro.txt",
+	}
+	for key, want := range expected {
+		if got := paths[key]; got != want {
+			t.Errorf("%s: expected %q, got %q", key, want, got)
+		}
+	}
+
+	if len(entries) != 2*len(expected) {
+		t.Fatalf("Expected a sidecar per resource, got %d entries", len(entries))
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i-1].Path >= entries[i].Path {
+			t.Errorf("Expected unique sorted paths, got %q before %q", entries[i-1].Path, entries[i].Path)
+		}
+	}
+}
+
+func TestFormatHeadersAndXattrs(t *testing.T) {
+	status := 404
+	res := &types.Resource{
+		Method:     "GET",
+		URL:        "https://example.com/missing.png",
+		StatusCode: &status,
+		RawHeaders: types.HttpHeaders{"Content-Type": "text/html", "Cache-Control": "no-store"},
+	}
+
+	expected := "GET https://example.com/missing.png\n404 Not Found\nCache-Control: no-store\nContent-Type: text/html\n"
+	if got := string(FormatHeaders(res)); got != expected {
+		t.Errorf("Expected headers %q, got %q", expected, got)
+	}
+
+	attrs := Xattrs(res)
+	if attrs["user.http.status"] != "404" || attrs["user.http.header.content-type"] != "text/html" {
+		t.Errorf("Unexpected xattrs: %v", attrs)
+	}
+}
@@ -0,0 +1,188 @@
+//go:build linux || darwin
+
+package mount
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Mount exposes the resources of an inventory read-only at mountpoint and blocks until ctx is done
+// or the file system is unmounted externally (e.g. with fusermount -u)
+func Mount(ctx context.Context, inventory *types.Inventory, readContent ContentReader, mountpoint string, opts Options) error {
+	root := &dirNode{}
+	server, err := fs.Mount(mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: "http-playback-proxy",
+			Name:   "inventory",
+			Debug:  opts.Debug,
+			// Mount directly when running as root, e.g. in containers without fusermount
+			DirectMount: true,
+		},
+		OnAdd: func(ctx context.Context) {
+			for _, entry := range Layout(inventory, opts) {
+				addEntry(ctx, &root.Inode, entry, readContent)
+			}
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mount %s: %w", mountpoint, err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		server.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	if err := server.Unmount(); err != nil {
+		return fmt.Errorf("failed to unmount %s: %w", mountpoint, err)
+	}
+	<-done
+	return nil
+}
+
+// addEntry adds the file of an entry below root, creating its directories
+func addEntry(ctx context.Context, root *fs.Inode, entry Entry, readContent ContentReader) {
+	parent := root
+	parts := strings.Split(entry.Path, "/")
+	for _, name := range parts[:len(parts)-1] {
+		child := parent.GetChild(name)
+		if child == nil {
+			child = parent.NewPersistentInode(ctx, &dirNode{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+			parent.AddChild(name, child, true)
+		}
+		parent = child
+	}
+	file := &fileNode{entry: entry, readContent: readContent}
+	parent.AddChild(parts[len(parts)-1], parent.NewPersistentInode(ctx, file, fs.StableAttr{}), true)
+}
+
+// dirNode is a read-only directory
+type dirNode struct {
+	fs.Inode
+}
+
+var _ = (fs.NodeGetattrer)((*dirNode)(nil))
+
+func (d *dirNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = fuse.S_IFDIR | 0555
+	return fs.OK
+}
+
+// fileNode is the body or headers sidecar of a resource; the body is read on first use
+type fileNode struct {
+	fs.Inode
+	entry       Entry
+	readContent ContentReader
+
+	mu     sync.Mutex
+	data   []byte
+	loaded bool
+}
+
+var _ = (fs.NodeGetattrer)((*fileNode)(nil))
+var _ = (fs.NodeOpener)((*fileNode)(nil))
+var _ = (fs.NodeReader)((*fileNode)(nil))
+var _ = (fs.NodeGetxattrer)((*fileNode)(nil))
+var _ = (fs.NodeListxattrer)((*fileNode)(nil))
+
+func (n *fileNode) content() ([]byte, syscall.Errno) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.loaded {
+		if n.entry.Headers {
+			n.data = FormatHeaders(n.entry.Resource)
+		} else {
+			data, err := n.readContent(n.entry.Resource)
+			if err != nil {
+				return nil, syscall.EIO
+			}
+			n.data = data
+		}
+		n.loaded = true
+	}
+	return n.data, fs.OK
+}
+
+func (n *fileNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	data, errno := n.content()
+	if errno != fs.OK {
+		return errno
+	}
+	out.Mode = fuse.S_IFREG | 0444
+	out.Size = uint64(len(data))
+	if !n.entry.Resource.Timestamp.IsZero() {
+		out.SetTimes(nil, &n.entry.Resource.Timestamp, &n.entry.Resource.Timestamp)
+	}
+	return fs.OK
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	if _, errno := n.content(); errno != fs.OK {
+		return nil, 0, errno
+	}
+	// The content never changes, so the kernel may keep it cached
+	return nil, fuse.FOPEN_KEEP_CACHE, fs.OK
+}
+
+func (n *fileNode) Read(ctx context.Context, f fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	data, errno := n.content()
+	if errno != fs.OK {
+		return nil, errno
+	}
+	if off >= int64(len(data)) {
+		return fuse.ReadResultData(nil), fs.OK
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(data)) {
+		end = int64(len(data))
+	}
+	return fuse.ReadResultData(data[off:end]), fs.OK
+}
+
+func (n *fileNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	value, ok := Xattrs(n.entry.Resource)[attr]
+	if !ok {
+		return 0, fs.ENOATTR
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), fs.OK
+}
+
+func (n *fileNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	attrs := Xattrs(n.entry.Resource)
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var list []byte
+	for _, name := range names {
+		list = append(list, name...)
+		list = append(list, 0)
+	}
+	if len(dest) < len(list) {
+		return uint32(len(list)), syscall.ERANGE
+	}
+	return uint32(copy(dest, list)), fs.OK
+}
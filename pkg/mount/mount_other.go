@@ -0,0 +1,16 @@
+//go:build !linux && !darwin
+
+package mount
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Mount is not available without FUSE
+func Mount(ctx context.Context, inventory *types.Inventory, readContent ContentReader, mountpoint string, opts Options) error {
+	return fmt.Errorf("mounting an inventory is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,128 @@
+package network
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMaxCompensation caps how much of the measured overhead is subtracted from a schedule.
+// Writing very large bodies to slow clients is not proxy overhead and must not shorten TTFB.
+const DefaultMaxCompensation = 50 * time.Millisecond
+
+// calibrationWeight is the weight of the newest sample in the moving averages
+const calibrationWeight = 0.2
+
+// Calibrator measures the proxy's own per-response overhead so the pacing schedule
+// can be shifted earlier and the intended timing is met at the client
+type Calibrator struct {
+	// MaxCompensation caps the compensation applied to a schedule
+	MaxCompensation time.Duration
+
+	samples          int64
+	requestSamples   int64
+	requestOverhead  float64 // moving average in nanoseconds
+	responseOverhead float64 // moving average in nanoseconds
+	maxResponse      time.Duration
+	mutex            sync.Mutex
+}
+
+// CalibrationStats is a snapshot of the calibration measurements
+type CalibrationStats struct {
+	Samples int64 `json:"samples"`
+	// RequestOverheadMS is the average time between receiving request headers and starting playback
+	RequestOverheadMS float64 `json:"requestOverheadMs"`
+	// ResponseOverheadMS is the average time spent writing a finished response
+	ResponseOverheadMS float64 `json:"responseOverheadMs"`
+	// MaxResponseOverheadMS is the largest response overhead observed
+	MaxResponseOverheadMS float64 `json:"maxResponseOverheadMs"`
+	// CompensationMS is what is currently subtracted from each schedule
+	CompensationMS float64 `json:"compensationMs"`
+}
+
+// NewCalibrator creates a calibrator with the default compensation cap
+func NewCalibrator() *Calibrator {
+	return &Calibrator{MaxCompensation: DefaultMaxCompensation}
+}
+
+// ObserveRequest records the time spent before playback started (reading the request, addon hooks)
+func (c *Calibrator) ObserveRequest(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.requestOverhead = movingAverage(c.requestOverhead, d, c.requestSamples == 0)
+	c.requestSamples++
+}
+
+// ObserveResponse records the time between handing over a response and finishing writing it
+func (c *Calibrator) ObserveResponse(d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.responseOverhead = movingAverage(c.responseOverhead, d, c.samples == 0)
+	if d > c.maxResponse {
+		c.maxResponse = d
+	}
+	c.samples++
+}
+
+// Compensation returns the duration to subtract from scheduled send offsets
+func (c *Calibrator) Compensation() time.Duration {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.compensation()
+}
+
+func (c *Calibrator) compensation() time.Duration {
+	compensation := time.Duration(c.responseOverhead)
+	if compensation > c.MaxCompensation {
+		compensation = c.MaxCompensation
+	}
+	return compensation
+}
+
+// Compensate shifts the offsets earlier by the measured overhead, never below zero
+func (c *Calibrator) Compensate(offsets []time.Duration) []time.Duration {
+	compensation := c.Compensation()
+	if compensation <= 0 {
+		return offsets
+	}
+	adjusted := make([]time.Duration, len(offsets))
+	for i, offset := range offsets {
+		adjusted[i] = offset - compensation
+		if adjusted[i] < 0 {
+			adjusted[i] = 0
+		}
+	}
+	return adjusted
+}
+
+// Stats returns a snapshot of the calibration measurements
+func (c *Calibrator) Stats() CalibrationStats {
+	if c == nil {
+		return CalibrationStats{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return CalibrationStats{
+		Samples:               c.samples,
+		RequestOverheadMS:     c.requestOverhead / float64(time.Millisecond),
+		ResponseOverheadMS:    c.responseOverhead / float64(time.Millisecond),
+		MaxResponseOverheadMS: float64(c.maxResponse) / float64(time.Millisecond),
+		CompensationMS:        float64(c.compensation()) / float64(time.Millisecond),
+	}
+}
+
+// movingAverage folds a sample into an exponential moving average
+func movingAverage(current float64, sample time.Duration, first bool) float64 {
+	if first {
+		return float64(sample)
+	}
+	return current*(1-calibrationWeight) + float64(sample)*calibrationWeight
+}
@@ -0,0 +1,50 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalibrator_Compensate(t *testing.T) {
+	c := NewCalibrator()
+	offsets := []time.Duration{5 * time.Millisecond, 100 * time.Millisecond}
+
+	// No samples yet: schedule is unchanged
+	if result := c.Compensate(offsets); result[1] != offsets[1] {
+		t.Errorf("Expected unchanged schedule without samples, got %v", result)
+	}
+
+	c.ObserveResponse(10 * time.Millisecond)
+	result := c.Compensate(offsets)
+	if result[0] != 0 {
+		t.Errorf("Expected offset to be clamped at 0, got %v", result[0])
+	}
+	if result[1] != 90*time.Millisecond {
+		t.Errorf("Expected 90ms, got %v", result[1])
+	}
+
+	// Moving average: 10ms * 0.8 + 20ms * 0.2 = 12ms
+	c.ObserveResponse(20 * time.Millisecond)
+	if compensation := c.Compensation(); compensation != 12*time.Millisecond {
+		t.Errorf("Expected 12ms compensation, got %v", compensation)
+	}
+
+	stats := c.Stats()
+	if stats.Samples != 2 || stats.MaxResponseOverheadMS != 20 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCalibrator_MaxCompensation(t *testing.T) {
+	c := NewCalibrator()
+	c.ObserveResponse(2 * time.Second)
+	if compensation := c.Compensation(); compensation != DefaultMaxCompensation {
+		t.Errorf("Expected compensation capped at %v, got %v", DefaultMaxCompensation, compensation)
+	}
+
+	var nilCalibrator *Calibrator
+	nilCalibrator.ObserveResponse(time.Second)
+	if nilCalibrator.Compensation() != 0 {
+		t.Error("Expected nil calibrator to apply no compensation")
+	}
+}
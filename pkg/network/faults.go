@@ -0,0 +1,71 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FaultPreset is a named set of faults simulating a common incident
+type FaultPreset struct {
+	Name        string
+	Description string
+	Faults      []FaultRule
+}
+
+// faultPresets are the built-in fault presets
+var faultPresets = []FaultPreset{
+	{
+		Name:        "cdn-outage",
+		Description: "All requests fail with 503 and Retry-After: 30",
+		Faults:      []FaultRule{{Rate: 1, Status: http.StatusServiceUnavailable, RetryAfterSeconds: 30}},
+	},
+	{
+		Name:        "origin-slow",
+		Description: "HTML responses start 2s later",
+		Faults:      []FaultRule{{Rate: 1, DelayMS: 2000, ContentTypes: []string{"text/html"}}},
+	},
+}
+
+// FaultPresets returns the built-in fault presets
+func FaultPresets() []FaultPreset {
+	return append([]FaultPreset(nil), faultPresets...)
+}
+
+// ParseFaultPreset returns the faults of a preset given as NAME or NAME@HOST,HOST... where the
+// hosts (globs) limit the faults to those hosts instead of all hosts
+func ParseFaultPreset(spec string) ([]FaultRule, error) {
+	name, hostList, limited := strings.Cut(strings.TrimSpace(spec), "@")
+	var hosts []string
+	if limited {
+		for _, host := range strings.Split(hostList, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, strings.ToLower(host))
+			}
+		}
+		if len(hosts) == 0 {
+			return nil, fmt.Errorf("fault preset %q has no hosts after @", name)
+		}
+	}
+
+	names := make([]string, 0, len(faultPresets))
+	for _, preset := range faultPresets {
+		if preset.Name != name {
+			names = append(names, preset.Name)
+			continue
+		}
+		faults := make([]FaultRule, len(preset.Faults))
+		for i, fault := range preset.Faults {
+			if hosts != nil {
+				fault.Hosts = hosts
+			}
+			faults[i] = fault
+		}
+		conditions := Conditions{SpeedFactor: 1, Faults: faults}
+		if err := conditions.Validate(); err != nil {
+			return nil, fmt.Errorf("fault preset %q: %w", name, err)
+		}
+		return faults, nil
+	}
+	return nil, fmt.Errorf("unknown fault preset %q (available: %s)", name, strings.Join(names, ", "))
+}
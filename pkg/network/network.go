@@ -0,0 +1,308 @@
+package network
+
+import (
+	"fmt"
+	"math/rand"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-http-playback-proxy/pkg/match"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Profile describes simulated network characteristics applied on top of recorded timing
+type Profile struct {
+	Name string `json:"name"`
+	// LatencyMS is added to every response's TTFB
+	LatencyMS int64 `json:"latencyMs"`
+	// DownloadMbps caps the transfer speed (0 means unlimited)
+	DownloadMbps float64 `json:"downloadMbps"`
+	// CacheHitLatencyMS and OriginLatencyMS replace LatencyMS for resources recorded as CDN cache
+	// hits or as served by the origin server
+	CacheHitLatencyMS *int64 `json:"cacheHitLatencyMs,omitempty"`
+	OriginLatencyMS   *int64 `json:"originLatencyMs,omitempty"`
+	// Offline fails every request as if the network were unplugged
+	Offline bool `json:"offline,omitempty"`
+}
+
+// FaultRule injects error responses for a fraction of requests, or delays their responses
+type FaultRule struct {
+	// Hosts limits the rule to matching hosts (glob); empty matches all hosts
+	Hosts []string `json:"hosts,omitempty"`
+	// Rate is the probability (0-1) that a matching request fails
+	Rate float64 `json:"rate"`
+	// Status is the HTTP status returned for injected faults (default: 503)
+	Status int `json:"status,omitempty"`
+	// RetryAfterSeconds is sent as Retry-After with injected faults; 0 sends none
+	RetryAfterSeconds int `json:"retryAfterSeconds,omitempty"`
+	// DelayMS makes the rule add this much to the TTFB of matching responses instead of failing them
+	DelayMS int64 `json:"delayMs,omitempty"`
+	// ContentTypes limits a delay to recorded responses of matching media types (glob, e.g.
+	// text/html); empty matches all
+	ContentTypes []string `json:"contentTypes,omitempty"`
+}
+
+// Delay reports whether the rule delays responses rather than failing requests
+func (r FaultRule) Delay() bool {
+	return r.DelayMS > 0
+}
+
+// Conditions is the set of network conditions active during playback
+type Conditions struct {
+	Profile *Profile `json:"profile,omitempty"`
+	// SpeedFactor scales all timing; 2 replays twice as fast, 0.5 twice as slow
+	SpeedFactor float64     `json:"speedFactor"`
+	Faults      []FaultRule `json:"faults,omitempty"`
+}
+
+// DefaultConditions returns conditions that reproduce the recording as-is
+func DefaultConditions() Conditions {
+	return Conditions{SpeedFactor: 1}
+}
+
+// Validate checks that the conditions are usable
+func (c *Conditions) Validate() error {
+	if c.SpeedFactor <= 0 {
+		return fmt.Errorf("speedFactor must be positive, got %v", c.SpeedFactor)
+	}
+	if c.Profile != nil {
+		if c.Profile.LatencyMS < 0 {
+			return fmt.Errorf("profile latencyMs must not be negative")
+		}
+		if c.Profile.DownloadMbps < 0 {
+			return fmt.Errorf("profile downloadMbps must not be negative")
+		}
+		if (c.Profile.CacheHitLatencyMS != nil && *c.Profile.CacheHitLatencyMS < 0) ||
+			(c.Profile.OriginLatencyMS != nil && *c.Profile.OriginLatencyMS < 0) {
+			return fmt.Errorf("profile cacheHitLatencyMs and originLatencyMs must not be negative")
+		}
+	}
+	for i, fault := range c.Faults {
+		if fault.Rate < 0 || fault.Rate > 1 {
+			return fmt.Errorf("fault %d: rate must be between 0 and 1", i)
+		}
+		if fault.Status != 0 && (fault.Status < 100 || fault.Status > 599) {
+			return fmt.Errorf("fault %d: invalid status %d", i, fault.Status)
+		}
+		if fault.RetryAfterSeconds < 0 || fault.DelayMS < 0 {
+			return fmt.Errorf("fault %d: retryAfterSeconds and delayMs must not be negative", i)
+		}
+		if len(fault.ContentTypes) > 0 && !fault.Delay() {
+			return fmt.Errorf("fault %d: contentTypes only apply to delays (delayMs)", i)
+		}
+		if _, err := match.CompileSet(fault.ContentTypes); err != nil {
+			return fmt.Errorf("fault %d: invalid content type pattern: %w", i, err)
+		}
+		if _, err := compileHosts(fault.Hosts); err != nil {
+			return fmt.Errorf("fault %d: invalid host pattern: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Offline reports whether the profile cuts the client off from the network
+func (c Conditions) Offline() bool {
+	return c.Profile != nil && c.Profile.Offline
+}
+
+// ForCacheStatus returns the conditions for a resource recorded with the given cache status,
+// applying the profile's cache hit or origin latency in place of its default latency
+func (c Conditions) ForCacheStatus(status types.CacheStatus) Conditions {
+	if c.Profile == nil {
+		return c
+	}
+	var latency *int64
+	switch status {
+	case types.CacheStatusHit:
+		latency = c.Profile.CacheHitLatencyMS
+	case types.CacheStatusOrigin:
+		latency = c.Profile.OriginLatencyMS
+	}
+	if latency == nil {
+		return c
+	}
+	profile := *c.Profile
+	profile.LatencyMS = *latency
+	c.Profile = &profile
+	return c
+}
+
+// Schedule adjusts recorded chunk send offsets for the conditions.
+// offsets are the recorded send offsets from request start and sizes the chunk sizes in bytes.
+func (c *Conditions) Schedule(ttfb time.Duration, offsets []time.Duration, sizes []int) []time.Duration {
+	adjusted := make([]time.Duration, len(offsets))
+
+	newTTFB := ttfb
+	var bitsPerSecond float64
+	if c.Profile != nil {
+		newTTFB += time.Duration(c.Profile.LatencyMS) * time.Millisecond
+		bitsPerSecond = c.Profile.DownloadMbps * 1024 * 1024
+	}
+
+	speedFactor := c.SpeedFactor
+	if speedFactor <= 0 {
+		speedFactor = 1
+	}
+
+	var sentBytes int
+	for i, offset := range offsets {
+		sentBytes += sizes[i]
+
+		transfer := offset - ttfb
+		if transfer < 0 {
+			transfer = 0
+		}
+		if bitsPerSecond > 0 {
+			// The profile can only slow the transfer down, never speed it up
+			capped := time.Duration(float64(sentBytes*8) / bitsPerSecond * float64(time.Second))
+			if capped > transfer {
+				transfer = capped
+			}
+		}
+
+		adjusted[i] = time.Duration(float64(newTTFB+transfer) / speedFactor)
+	}
+
+	return adjusted
+}
+
+// AdjustTTFB returns the TTFB adjusted for the conditions
+func (c *Conditions) AdjustTTFB(ttfb time.Duration) time.Duration {
+	return c.Schedule(ttfb, []time.Duration{ttfb}, []int{0})[0]
+}
+
+// Controller holds the active conditions and allows changing them at runtime
+type Controller struct {
+	current Conditions
+	// faultHosts and faultContentTypes are the compiled patterns of the current faults
+	faultHosts        []*match.Set
+	faultContentTypes []*match.Set
+	random            *rand.Rand
+	mutex             sync.RWMutex
+}
+
+// NewController creates a controller with the given initial conditions
+func NewController(initial Conditions) (*Controller, error) {
+	if err := initial.Validate(); err != nil {
+		return nil, err
+	}
+	return &Controller{
+		current:           initial,
+		faultHosts:        compileFaultHosts(initial.Faults),
+		faultContentTypes: compileFaultContentTypes(initial.Faults),
+		random:            rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Get returns a copy of the active conditions
+func (c *Controller) Get() Conditions {
+	if c == nil {
+		return DefaultConditions()
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.current
+}
+
+// Set replaces the active conditions
+func (c *Controller) Set(conditions Conditions) error {
+	if err := conditions.Validate(); err != nil {
+		return err
+	}
+	faultHosts := compileFaultHosts(conditions.Faults)
+	faultContentTypes := compileFaultContentTypes(conditions.Faults)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = conditions
+	c.faultHosts = faultHosts
+	c.faultContentTypes = faultContentTypes
+	return nil
+}
+
+// Fault decides whether a request to host should fail and returns the rule that failed it, with
+// its status filled in
+func (c *Controller) Fault(host string) (FaultRule, bool) {
+	if c == nil {
+		return FaultRule{}, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	host = strings.ToLower(host)
+	for i, fault := range c.current.Faults {
+		if fault.Delay() {
+			continue
+		}
+		if hosts := c.faultHosts[i]; hosts.Len() > 0 && !hosts.Match(host) {
+			continue
+		}
+		if fault.Rate > 0 && c.random.Float64() < fault.Rate {
+			if fault.Status == 0 {
+				fault.Status = http.StatusServiceUnavailable
+			}
+			return fault, true
+		}
+	}
+	return FaultRule{}, false
+}
+
+// Delay returns how much the delay rules add to the TTFB of a response to host with the recorded
+// Content-Type; the delays of several matching rules add up
+func (c *Controller) Delay(host, contentType string) time.Duration {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	host = strings.ToLower(host)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	var delay time.Duration
+	for i, fault := range c.current.Faults {
+		if !fault.Delay() {
+			continue
+		}
+		if hosts := c.faultHosts[i]; hosts.Len() > 0 && !hosts.Match(host) {
+			continue
+		}
+		if types := c.faultContentTypes[i]; types.Len() > 0 && !types.Match(mediaType) {
+			continue
+		}
+		if fault.Rate > 0 && c.random.Float64() < fault.Rate {
+			delay += time.Duration(fault.DelayMS) * time.Millisecond
+		}
+	}
+	return delay
+}
+
+// compileHosts compiles host patterns, which match hosts case-insensitively
+func compileHosts(patterns []string) (*match.Set, error) {
+	lower := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		lower[i] = strings.ToLower(pattern)
+	}
+	return match.CompileSet(lower)
+}
+
+// compileFaultHosts compiles the host patterns of validated faults
+func compileFaultHosts(faults []FaultRule) []*match.Set {
+	sets := make([]*match.Set, len(faults))
+	for i, fault := range faults {
+		sets[i], _ = compileHosts(fault.Hosts)
+	}
+	return sets
+}
+
+// compileFaultContentTypes compiles the content type patterns of validated faults
+func compileFaultContentTypes(faults []FaultRule) []*match.Set {
+	sets := make([]*match.Set, len(faults))
+	for i, fault := range faults {
+		sets[i], _ = match.CompileSet(fault.ContentTypes)
+	}
+	return sets
+}
@@ -0,0 +1,281 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+func TestConditions_Schedule(t *testing.T) {
+	ttfb := 100 * time.Millisecond
+	offsets := []time.Duration{150 * time.Millisecond, 200 * time.Millisecond}
+	sizes := []int{1024, 1024}
+
+	testCases := []struct {
+		name       string
+		conditions Conditions
+		expected   []time.Duration
+	}{
+		{
+			name:       "Default reproduces recording",
+			conditions: DefaultConditions(),
+			expected:   offsets,
+		},
+		{
+			name:       "Speed factor halves timing",
+			conditions: Conditions{SpeedFactor: 2},
+			expected:   []time.Duration{75 * time.Millisecond, 100 * time.Millisecond},
+		},
+		{
+			name:       "Profile latency is added",
+			conditions: Conditions{SpeedFactor: 1, Profile: &Profile{Name: "lat", LatencyMS: 300}},
+			expected:   []time.Duration{450 * time.Millisecond, 500 * time.Millisecond},
+		},
+		{
+			// 1 Mbps => 1024 bytes take 1/128 s = 7.8125ms, 2048 bytes 15.625ms; recorded is slower
+			name:       "Fast profile does not speed up recording",
+			conditions: Conditions{SpeedFactor: 1, Profile: &Profile{Name: "fast", DownloadMbps: 1}},
+			expected:   offsets,
+		},
+		{
+			// 0.01 Mbps => 1024 bytes take 781.25ms
+			name:       "Slow profile caps throughput",
+			conditions: Conditions{SpeedFactor: 1, Profile: &Profile{Name: "slow", DownloadMbps: 0.01}},
+			expected:   []time.Duration{100*time.Millisecond + 781250*time.Microsecond, 100*time.Millisecond + 1562500*time.Microsecond},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.conditions.Schedule(ttfb, offsets, sizes)
+			for i := range tc.expected {
+				diff := result[i] - tc.expected[i]
+				if diff < -time.Microsecond || diff > time.Microsecond {
+					t.Errorf("Chunk %d: expected %v, got %v", i, tc.expected[i], result[i])
+				}
+			}
+		})
+	}
+}
+
+func TestController_Fault(t *testing.T) {
+	controller, err := NewController(Conditions{
+		SpeedFactor: 1,
+		Faults: []FaultRule{
+			{Hosts: []string{"api.example.com"}, Rate: 1, Status: 500},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	if fault, ok := controller.Fault("api.example.com"); !ok || fault.Status != 500 {
+		t.Errorf("Expected fault 500, got %d (%v)", fault.Status, ok)
+	}
+	if _, ok := controller.Fault("www.example.com"); ok {
+		t.Error("Expected no fault for non-matching host")
+	}
+
+	// Change conditions at runtime
+	if err := controller.Set(Conditions{SpeedFactor: 1, Faults: []FaultRule{{Rate: 1}}}); err != nil {
+		t.Fatalf("Failed to set conditions: %v", err)
+	}
+	if fault, ok := controller.Fault("www.example.com"); !ok || fault.Status != 503 {
+		t.Errorf("Expected default fault 503, got %d (%v)", fault.Status, ok)
+	}
+
+	var nilController *Controller
+	if _, ok := nilController.Fault("www.example.com"); ok {
+		t.Error("Expected nil controller to inject no faults")
+	}
+}
+
+func TestParseFaultPreset(t *testing.T) {
+	controller, err := NewController(DefaultConditions())
+	if err != nil {
+		t.Fatalf("Failed to create controller: %v", err)
+	}
+
+	outage, err := ParseFaultPreset("cdn-outage@cdn.example.com, *.akamai.net")
+	if err != nil {
+		t.Fatalf("Failed to parse cdn-outage: %v", err)
+	}
+	slow, err := ParseFaultPreset("origin-slow")
+	if err != nil {
+		t.Fatalf("Failed to parse origin-slow: %v", err)
+	}
+	if err := controller.Set(Conditions{SpeedFactor: 1, Faults: append(outage, slow...)}); err != nil {
+		t.Fatalf("Failed to set conditions: %v", err)
+	}
+
+	if fault, ok := controller.Fault("img.akamai.net"); !ok || fault.Status != 503 || fault.RetryAfterSeconds != 30 {
+		t.Errorf("Expected 503 with Retry-After 30, got %+v (%v)", fault, ok)
+	}
+	if _, ok := controller.Fault("www.example.com"); ok {
+		t.Error("Expected no fault outside the outage hosts, nor from the delay")
+	}
+	if delay := controller.Delay("www.example.com", "text/html; charset=utf-8"); delay != 2*time.Second {
+		t.Errorf("Expected HTML to be delayed by 2s, got %v", delay)
+	}
+	if delay := controller.Delay("www.example.com", "image/png"); delay != 0 {
+		t.Errorf("Expected images not to be delayed, got %v", delay)
+	}
+
+	for _, spec := range []string{"unknown", "cdn-outage@"} {
+		if _, err := ParseFaultPreset(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+	conditions := Conditions{SpeedFactor: 1, Faults: []FaultRule{{Rate: 1, ContentTypes: []string{"text/html"}}}}
+	if err := conditions.Validate(); err == nil {
+		t.Error("Expected content types without a delay to be rejected")
+	}
+}
+
+func TestConditions_Validate(t *testing.T) {
+	invalid := []Conditions{
+		{SpeedFactor: 0},
+		{SpeedFactor: 1, Faults: []FaultRule{{Rate: 1.5}}},
+		{SpeedFactor: 1, Faults: []FaultRule{{Rate: 0.5, Status: 42}}},
+		{SpeedFactor: 1, Profile: &Profile{LatencyMS: -1}},
+	}
+	for i, conditions := range invalid {
+		if err := conditions.Validate(); err == nil {
+			t.Errorf("Case %d: expected validation error", i)
+		}
+	}
+}
+
+func TestConditions_ForCacheStatus(t *testing.T) {
+	hitLatency, originLatency := int64(20), int64(400)
+	conditions := Conditions{SpeedFactor: 1, Profile: &Profile{
+		Name:              "cdn",
+		LatencyMS:         100,
+		CacheHitLatencyMS: &hitLatency,
+		OriginLatencyMS:   &originLatency,
+	}}
+	ttfb := 50 * time.Millisecond
+
+	testCases := []struct {
+		status   types.CacheStatus
+		expected time.Duration
+	}{
+		{types.CacheStatusHit, 70 * time.Millisecond},
+		{types.CacheStatusOrigin, 450 * time.Millisecond},
+		{"", 150 * time.Millisecond},
+	}
+	for _, tc := range testCases {
+		adjusted := conditions.ForCacheStatus(tc.status)
+		if got := adjusted.AdjustTTFB(ttfb); got != tc.expected {
+			t.Errorf("status %q: expected TTFB %v, got %v", tc.status, tc.expected, got)
+		}
+	}
+
+	if conditions.Profile.LatencyMS != 100 {
+		t.Errorf("Expected the shared profile to be unchanged, got latency %d", conditions.Profile.LatencyMS)
+	}
+}
+
+func TestPresets(t *testing.T) {
+	presets := Presets()
+	if len(presets) == 0 {
+		t.Fatal("Expected built-in presets")
+	}
+	for _, preset := range presets {
+		conditions := Conditions{SpeedFactor: 1, Profile: &preset.Profile}
+		if err := conditions.Validate(); err != nil || (!preset.Offline && (preset.LatencyMS == 0 || preset.DownloadMbps == 0)) {
+			t.Errorf("Invalid preset %+v: %v", preset, err)
+		}
+	}
+
+	profile, err := LookupPreset("good-3g")
+	if err != nil || profile.LatencyMS != 150 || profile.DownloadMbps != 1.6 {
+		t.Errorf("Unexpected good-3g profile %+v (%v)", profile, err)
+	}
+	if _, err := LookupPreset("5g"); err == nil {
+		t.Error("Expected an error for an unknown preset")
+	}
+
+	// A name alone selects the preset; explicit values are kept as given
+	conditions := Conditions{SpeedFactor: 1, Profile: &Profile{Name: "wifi"}}
+	if err := conditions.ResolvePreset(); err != nil || conditions.Profile.DownloadMbps != 30 {
+		t.Errorf("Expected the wifi preset, got %+v (%v)", conditions.Profile, err)
+	}
+	custom := Conditions{SpeedFactor: 1, Profile: &Profile{Name: "wifi", LatencyMS: 500}}
+	if err := custom.ResolvePreset(); err != nil || custom.Profile.LatencyMS != 500 || custom.Profile.DownloadMbps != 0 {
+		t.Errorf("Expected the custom profile to be kept, got %+v (%v)", custom.Profile, err)
+	}
+}
+
+func TestPresets_Offline(t *testing.T) {
+	conditions := Conditions{SpeedFactor: 1, Profile: &Profile{Name: "offline"}}
+	if err := conditions.ResolvePreset(); err != nil || !conditions.Offline() {
+		t.Errorf("Expected the offline preset, got %+v (%v)", conditions.Profile, err)
+	}
+	if (Conditions{SpeedFactor: 1, Profile: &Profile{Name: "4g"}}).Offline() || DefaultConditions().Offline() {
+		t.Error("Expected only the offline profile to be offline")
+	}
+}
+
+func TestLoadPresets(t *testing.T) {
+	t.Cleanup(func() {
+		customPresetsMutex.Lock()
+		customPresets = nil
+		customPresetsMutex.Unlock()
+	})
+
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	content := `[
+  {"name": "satellite", "description": "Geostationary satellite link", "latencyMs": 600, "downloadMbps": 10},
+  {"name": "wifi", "description": "Congested office Wi-Fi", "latencyMs": 40, "downloadMbps": 5}
+]`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPresets(path); err != nil {
+		t.Fatalf("LoadPresets failed: %v", err)
+	}
+
+	profile, err := LookupPreset("satellite")
+	if err != nil || profile.LatencyMS != 600 {
+		t.Errorf("Expected the custom satellite profile, got %+v (%v)", profile, err)
+	}
+	if profile, err := LookupPreset("wifi"); err != nil || profile.LatencyMS != 40 {
+		t.Errorf("Expected the custom profile to replace the built-in wifi, got %+v (%v)", profile, err)
+	}
+
+	presets := Presets()
+	if presets[len(presets)-1].Name != "satellite" {
+		t.Errorf("Expected new custom profiles after the built-in ones, got %s last", presets[len(presets)-1].Name)
+	}
+	count := 0
+	for _, preset := range presets {
+		if preset.Name == "wifi" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Expected one wifi profile, got %d", count)
+	}
+
+	invalid := []string{
+		`[{"latencyMs": 100}]`,
+		`[{"name": "a"}, {"name": "a"}]`,
+		`[{"name": "a", "latencyMs": -1}]`,
+		`{"name": "a"}`,
+	}
+	for _, content := range invalid {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadPresets(path); err == nil {
+			t.Errorf("Expected an error for %s", content)
+		}
+	}
+	if _, err := LookupPreset("satellite"); err != nil {
+		t.Error("Expected a failed load to keep the profiles loaded before")
+	}
+}
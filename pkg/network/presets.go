@@ -0,0 +1,117 @@
+package network
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// presetsJSON holds the built-in profiles, with latencies as round-trip times
+//
+//go:embed presets.json
+var presetsJSON []byte
+
+// Preset is a named profile shipped with the binary
+type Preset struct {
+	Profile
+	Description string `json:"description"`
+}
+
+var (
+	presets     []Preset
+	presetsOnce sync.Once
+
+	// customPresets are the profiles loaded by LoadPresets
+	customPresets      []Preset
+	customPresetsMutex sync.RWMutex
+)
+
+// Presets returns the built-in profiles, from the slowest to the fastest, followed by the custom
+// profiles. A custom profile named like a built-in one takes its place.
+func Presets() []Preset {
+	presetsOnce.Do(func() {
+		if err := json.Unmarshal(presetsJSON, &presets); err != nil {
+			panic(fmt.Sprintf("invalid built-in presets: %v", err))
+		}
+	})
+	result := append([]Preset(nil), presets...)
+
+	customPresetsMutex.RLock()
+	defer customPresetsMutex.RUnlock()
+	for _, custom := range customPresets {
+		replaced := false
+		for i := range result {
+			if result[i].Name == custom.Name {
+				result[i] = custom
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			result = append(result, custom)
+		}
+	}
+	return result
+}
+
+// LoadPresets reads custom profiles from a JSON array in the format of the built-in presets and
+// makes them available by name, replacing the custom profiles loaded before
+func LoadPresets(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read profiles file: %w", err)
+	}
+	var loaded []Preset
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("failed to parse profiles file: %w", err)
+	}
+
+	names := make(map[string]bool, len(loaded))
+	for i, preset := range loaded {
+		if preset.Name == "" {
+			return fmt.Errorf("profile %d: name is required", i)
+		}
+		if names[preset.Name] {
+			return fmt.Errorf("profile %d: duplicate name %q", i, preset.Name)
+		}
+		names[preset.Name] = true
+		conditions := Conditions{SpeedFactor: 1, Profile: &loaded[i].Profile}
+		if err := conditions.Validate(); err != nil {
+			return fmt.Errorf("profile %q: %w", preset.Name, err)
+		}
+	}
+
+	customPresetsMutex.Lock()
+	defer customPresetsMutex.Unlock()
+	customPresets = loaded
+	return nil
+}
+
+// LookupPreset returns the profile of a built-in or custom preset
+func LookupPreset(name string) (Profile, error) {
+	names := make([]string, 0, len(Presets()))
+	for _, preset := range Presets() {
+		if preset.Name == name {
+			return preset.Profile, nil
+		}
+		names = append(names, preset.Name)
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// ResolvePreset fills in a profile given by name only from the preset of that name
+func (c *Conditions) ResolvePreset() error {
+	if c.Profile == nil || c.Profile.Offline || c.Profile.LatencyMS != 0 || c.Profile.DownloadMbps != 0 ||
+		c.Profile.CacheHitLatencyMS != nil || c.Profile.OriginLatencyMS != nil {
+		return nil
+	}
+	profile, err := LookupPreset(c.Profile.Name)
+	if err != nil {
+		return err
+	}
+	c.Profile = &profile
+	return nil
+}
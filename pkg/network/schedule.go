@@ -0,0 +1,168 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Schedule changes the network conditions over the course of a playback session,
+// e.g. to degrade the network or inject faults a minute into a demo
+type Schedule struct {
+	Steps []Step `json:"steps"`
+	// RepeatSeconds restarts the schedule after this many seconds (0: run once)
+	RepeatSeconds float64 `json:"repeatSeconds,omitempty"`
+}
+
+// Step changes the conditions from AtSeconds after the session starts, for DurationSeconds
+// (0: until the end). Steps active at the same time apply in order: later profiles and speed
+// factors win, faults add up.
+type Step struct {
+	Name            string  `json:"name,omitempty"`
+	AtSeconds       float64 `json:"atSeconds"`
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	// Profile replaces the profile; a profile given by name only is a built-in preset
+	Profile     *Profile    `json:"profile,omitempty"`
+	SpeedFactor float64     `json:"speedFactor,omitempty"`
+	Faults      []FaultRule `json:"faults,omitempty"`
+}
+
+// LoadSchedule reads and validates a schedule file
+func LoadSchedule(path string) (*Schedule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule file: %w", err)
+	}
+	var schedule Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule file: %w", err)
+	}
+	if err := schedule.Validate(); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// Validate checks the steps, resolves preset profiles and sorts the steps by start time
+func (s *Schedule) Validate() error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("schedule has no steps")
+	}
+	if s.RepeatSeconds < 0 {
+		return fmt.Errorf("repeatSeconds must not be negative")
+	}
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if step.AtSeconds < 0 || step.DurationSeconds < 0 {
+			return fmt.Errorf("step %d: atSeconds and durationSeconds must not be negative", i)
+		}
+		if step.SpeedFactor < 0 {
+			return fmt.Errorf("step %d: speedFactor must not be negative", i)
+		}
+		if s.RepeatSeconds > 0 && step.AtSeconds >= s.RepeatSeconds {
+			return fmt.Errorf("step %d: starts after the schedule repeats", i)
+		}
+		conditions := DefaultConditions()
+		step.apply(&conditions)
+		if err := conditions.ResolvePreset(); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+		step.Profile = conditions.Profile
+		if err := conditions.Validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+	}
+	sort.SliceStable(s.Steps, func(i, j int) bool {
+		return s.Steps[i].AtSeconds < s.Steps[j].AtSeconds
+	})
+	return nil
+}
+
+// apply changes the conditions as the step describes
+func (step *Step) apply(conditions *Conditions) {
+	if step.Profile != nil {
+		profile := *step.Profile
+		conditions.Profile = &profile
+	}
+	if step.SpeedFactor > 0 {
+		conditions.SpeedFactor = step.SpeedFactor
+	}
+	if len(step.Faults) > 0 {
+		faults := make([]FaultRule, 0, len(conditions.Faults)+len(step.Faults))
+		faults = append(faults, conditions.Faults...)
+		conditions.Faults = append(faults, step.Faults...)
+	}
+}
+
+func (step *Step) start() time.Duration {
+	return seconds(step.AtSeconds)
+}
+
+// end returns when the step stops applying, or 0 if it never does
+func (step *Step) end() time.Duration {
+	if step.DurationSeconds == 0 {
+		return 0
+	}
+	return seconds(step.AtSeconds + step.DurationSeconds)
+}
+
+// position maps the time since the session started onto the schedule's timeline
+func (s *Schedule) position(elapsed time.Duration) time.Duration {
+	if repeat := seconds(s.RepeatSeconds); repeat > 0 {
+		return elapsed % repeat
+	}
+	return elapsed
+}
+
+// At returns the conditions elapsed after the session started, given the conditions the
+// session started with
+func (s *Schedule) At(base Conditions, elapsed time.Duration) (Conditions, []string) {
+	position := s.position(elapsed)
+	conditions := base
+	var active []string
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if position < step.start() || (step.end() > 0 && position >= step.end()) {
+			continue
+		}
+		step.apply(&conditions)
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step %d", i)
+		}
+		active = append(active, name)
+	}
+	return conditions, active
+}
+
+// Next returns how long after the session started the conditions change next, or false if they never do
+func (s *Schedule) Next(elapsed time.Duration) (time.Duration, bool) {
+	position := s.position(elapsed)
+	cycleStart := elapsed - position
+
+	var next time.Duration
+	found := false
+	for i := range s.Steps {
+		for _, boundary := range []time.Duration{s.Steps[i].start(), s.Steps[i].end()} {
+			if boundary > position && (!found || boundary < next) {
+				next, found = boundary, true
+			}
+		}
+	}
+	if repeat := seconds(s.RepeatSeconds); repeat > 0 {
+		// Steps running past the end of the cycle are cut off when it restarts
+		if !found || next > repeat {
+			next, found = repeat, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return cycleStart + next, true
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,101 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedule_At(t *testing.T) {
+	schedule := &Schedule{
+		Steps: []Step{
+			{Name: "api errors", AtSeconds: 120, DurationSeconds: 30, Faults: []FaultRule{{Hosts: []string{"api.example.com"}, Rate: 0.1, Status: 503}}},
+			{Name: "slow network", AtSeconds: 60, DurationSeconds: 90, Profile: &Profile{Name: "good-3g"}},
+		},
+	}
+	if err := schedule.Validate(); err != nil {
+		t.Fatalf("Failed to validate schedule: %v", err)
+	}
+	if schedule.Steps[0].Name != "slow network" || schedule.Steps[0].Profile.LatencyMS != 150 {
+		t.Fatalf("Expected steps sorted by start with the preset resolved, got %+v", schedule.Steps[0])
+	}
+
+	base := Conditions{SpeedFactor: 2, Faults: []FaultRule{{Rate: 0.01}}}
+	testCases := []struct {
+		elapsed time.Duration
+		active  int
+		profile string
+		faults  int
+	}{
+		{elapsed: 30 * time.Second, active: 0, faults: 1},
+		{elapsed: 60 * time.Second, active: 1, profile: "good-3g", faults: 1},
+		{elapsed: 130 * time.Second, active: 2, profile: "good-3g", faults: 2},
+		{elapsed: 150 * time.Second, active: 0, faults: 1},
+	}
+	for _, tc := range testCases {
+		conditions, active := schedule.At(base, tc.elapsed)
+		if len(active) != tc.active {
+			t.Errorf("At %v: expected %d active steps, got %v", tc.elapsed, tc.active, active)
+		}
+		profile := ""
+		if conditions.Profile != nil {
+			profile = conditions.Profile.Name
+		}
+		if profile != tc.profile || len(conditions.Faults) != tc.faults || conditions.SpeedFactor != 2 {
+			t.Errorf("At %v: unexpected conditions %+v", tc.elapsed, conditions)
+		}
+	}
+	if len(base.Faults) != 1 {
+		t.Errorf("Expected the base conditions to be left unchanged, got %+v", base.Faults)
+	}
+
+	next, ok := schedule.Next(61 * time.Second)
+	if !ok || next != 120*time.Second {
+		t.Errorf("Expected the next change at 120s, got %v %v", next, ok)
+	}
+	if _, ok := schedule.Next(150 * time.Second); ok {
+		t.Error("Expected no change after the last step")
+	}
+}
+
+func TestSchedule_Repeat(t *testing.T) {
+	schedule := &Schedule{
+		RepeatSeconds: 60,
+		Steps:         []Step{{AtSeconds: 40, SpeedFactor: 0.5}},
+	}
+	if err := schedule.Validate(); err != nil {
+		t.Fatalf("Failed to validate schedule: %v", err)
+	}
+
+	if conditions, _ := schedule.At(DefaultConditions(), 100*time.Second); conditions.SpeedFactor != 0.5 {
+		t.Errorf("Expected the step to apply in the second cycle, got %v", conditions.SpeedFactor)
+	}
+	if conditions, _ := schedule.At(DefaultConditions(), 130*time.Second); conditions.SpeedFactor != 1 {
+		t.Errorf("Expected the step to end when the cycle restarts, got %v", conditions.SpeedFactor)
+	}
+	if next, ok := schedule.Next(100 * time.Second); !ok || next != 120*time.Second {
+		t.Errorf("Expected the next change at 120s, got %v %v", next, ok)
+	}
+	if next, ok := schedule.Next(120 * time.Second); !ok || next != 160*time.Second {
+		t.Errorf("Expected the next change at 160s, got %v %v", next, ok)
+	}
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule Schedule
+	}{
+		{name: "No steps", schedule: Schedule{}},
+		{name: "Negative start", schedule: Schedule{Steps: []Step{{AtSeconds: -1}}}},
+		{name: "Unknown preset", schedule: Schedule{Steps: []Step{{Profile: &Profile{Name: "dial-up"}}}}},
+		{name: "Invalid fault", schedule: Schedule{Steps: []Step{{Faults: []FaultRule{{Rate: 2}}}}}},
+		{name: "Step after repeat", schedule: Schedule{RepeatSeconds: 10, Steps: []Step{{AtSeconds: 10}}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.schedule.Validate(); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// autosave adds the transactions finished since the last autosave to the inventory every interval
+// or count transactions, so a crash loses at most the latest of them. The final save still writes
+// the whole recording.
+type autosave struct {
+	interval time.Duration
+	count    int
+	// due is signaled when count transactions finished since the last autosave
+	due      chan struct{}
+	finished atomic.Int64
+
+	// mutex serializes the autosaves with the final save and guards the fields below
+	mutex sync.Mutex
+	// saved marks the autosaved transactions by index
+	saved []bool
+	// wrote is set once an autosave replaced the inventory of an earlier run
+	wrote  bool
+	closed bool
+}
+
+func newAutosave(interval time.Duration, count int) *autosave {
+	return &autosave{interval: interval, count: count, due: make(chan struct{}, 1)}
+}
+
+// transactionFinished counts a finished transaction towards the next autosave
+func (a *autosave) transactionFinished() {
+	if a == nil || a.count <= 0 {
+		return
+	}
+	if a.finished.Add(1) >= int64(a.count) {
+		select {
+		case a.due <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// watchAutosave autosaves whenever the interval elapses or enough transactions finished, until the
+// final save
+func (p *RecordingPlugin) watchAutosave() {
+	defer p.recoverPanic("autosave")
+	var tick <-chan time.Time
+	if p.autosave.interval > 0 {
+		ticker := time.NewTicker(p.autosave.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+		case <-p.autosave.due:
+		case <-p.stopped:
+			return
+		}
+		if err := p.Autosave(); err != nil {
+			recordingLogger.Error("Failed to autosave recording", "error", err)
+		}
+	}
+}
+
+// Autosave adds the transactions finished since the last autosave to the inventory. The first
+// autosave replaces the inventory of an earlier run unless RecordingOptions.Append is set.
+func (p *RecordingPlugin) Autosave() error {
+	a := p.autosave
+	if a == nil {
+		return nil
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.closed {
+		return nil
+	}
+
+	// A previous save's content files must not be rewritten while they are beautified
+	p.beautifier.Wait()
+
+	p.mutex.RLock()
+	open := make(map[int]bool, len(p.webSockets))
+	for session := range p.webSockets {
+		open[*session] = true
+	}
+	var indexes []int
+	var transactions []types.RecordingTransaction
+	for i, transaction := range p.transactions {
+		if (i < len(a.saved) && a.saved[i]) || open[i] || transaction.ResponseStarted.IsZero() {
+			continue
+		}
+		indexes = append(indexes, i)
+		transactions = append(transactions, transaction)
+	}
+	total := len(p.transactions)
+	p.mutex.RUnlock()
+	a.finished.Add(-int64(len(transactions)))
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	for i := range transactions {
+		transactions[i].Samples = p.sampler.Stats(transactions[i].SamplePattern)
+	}
+	if len(p.postProcess) > 0 {
+		processed, err := p.postProcess.Run(transactions)
+		if err != nil {
+			return fmt.Errorf("failed to post-process recording: %w", err)
+		}
+		transactions = processed
+	}
+
+	if len(transactions) > 0 {
+		pm := p.persistence(p.inventoryDir)
+		pm.Append = p.appendInventory || a.wrote
+		var err error
+		if p.splitDomains {
+			_, err = pm.SaveRecordedTransactionsByDomain(transactions, p.targetURL, p.noBeautify)
+		} else {
+			err = pm.SaveRecordedTransactionsWithOptions(transactions, p.targetURL, p.noBeautify)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save inventory: %w", err)
+		}
+		a.wrote = true
+	}
+
+	if len(a.saved) < total {
+		a.saved = append(a.saved, make([]bool, total-len(a.saved))...)
+	}
+	for _, i := range indexes {
+		a.saved[i] = true
+	}
+	recordingLogger.Info("Recording autosaved", "transactions", len(transactions), "directory", p.inventoryDir)
+	return nil
+}
+
+// closeAutosave stops autosaving before the final save and returns the function that lets the
+// final save finish first; autosaves waiting for it are then skipped
+func (p *RecordingPlugin) closeAutosave() func() {
+	if p.autosave == nil {
+		return func() {}
+	}
+	p.autosave.mutex.Lock()
+	p.autosave.closed = true
+	return p.autosave.mutex.Unlock
+}
@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// bodyLimit leaves the bodies of responses larger than maxSize or of skipped media types out of the
+// recording, keeping only their size
+type bodyLimit struct {
+	maxSize      int64
+	contentTypes *match.Set
+}
+
+// newBodyLimit compiles the skipped media types (globs, e.g. video/*); nil when nothing is skipped
+func newBodyLimit(maxSize int64, contentTypes []string) (*bodyLimit, error) {
+	if maxSize <= 0 && len(contentTypes) == 0 {
+		return nil, nil
+	}
+	lower := make([]string, len(contentTypes))
+	for i, contentType := range contentTypes {
+		lower[i] = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	set, err := match.CompileSet(lower)
+	if err != nil {
+		return nil, fmt.Errorf("invalid skipped content type: %w", err)
+	}
+	return &bodyLimit{maxSize: maxSize, contentTypes: set}, nil
+}
+
+// skipsType reports whether bodies of the Content-Type are never recorded
+func (l *bodyLimit) skipsType(contentType string) bool {
+	if l == nil || l.contentTypes.Len() == 0 {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return l.contentTypes.Match(mediaType)
+}
+
+// omits reports whether a body of the Content-Type and size is left out of the recording
+func (l *bodyLimit) omits(contentType string, size int64) bool {
+	if l == nil {
+		return false
+	}
+	return l.skipsType(contentType) || (l.maxSize > 0 && size > l.maxSize)
+}
+
+// capture returns a reader capturing a streamed body, which only counts the bytes of bodies the
+// limit leaves out
+func (l *bodyLimit) capture(in io.Reader, contentType string) *captureReader {
+	if l == nil {
+		return &captureReader{reader: in}
+	}
+	return &captureReader{reader: in, limit: l.maxSize, discard: l.skipsType(contentType)}
+}
@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// builtinFallback returns the status to answer locally for an unrecorded request that browsers make
+// on their own, or 0. Such requests would otherwise reach the upstream on every page load:
+// /favicon.ico is answered with 204 so no broken icon is shown, touch icons and /.well-known/*
+// with 404.
+func builtinFallback(r *proxy.Request) int {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return 0
+	}
+	switch path := r.URL.Path; {
+	case path == "/favicon.ico":
+		return http.StatusNoContent
+	case strings.HasPrefix(path, "/apple-touch-icon") && strings.HasSuffix(path, ".png"):
+		return http.StatusNotFound
+	case strings.HasPrefix(path, "/.well-known/"):
+		return http.StatusNotFound
+	default:
+		return 0
+	}
+}
+
+// createBuiltinResponse answers a request with an empty built-in fallback response
+func (p *PlaybackPlugin) createBuiltinResponse(f *proxy.Flow, statusCode int) {
+	f.Response = &proxy.Response{
+		StatusCode: statusCode,
+		Header:     make(http.Header),
+	}
+	f.Response.Header.Set("Cache-Control", "no-store")
+	f.Response.Header.Set("x-playback-proxy", "1")
+	finalizeResponse(f, 0, "")
+	playbackLogger.Debug("Built-in fallback response", "url", f.Request.URL.String(), "status", statusCode)
+}
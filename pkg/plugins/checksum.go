@@ -0,0 +1,66 @@
+package plugins
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go-http-playback-proxy/pkg/inventory"
+)
+
+// contentCheck tells whether the content file of a transaction still matches its recorded checksum
+// while playback runs. The file is hashed again only when its size or modification time changed
+// since it was last checked, so unchanged fixtures cost one stat per serve.
+type contentCheck struct {
+	mutex    sync.Mutex
+	size     int64
+	modTime  time.Time
+	missing  bool
+	mismatch bool
+}
+
+// newContentCheck starts from the file as it was loaded
+func newContentCheck(path string, mismatch bool) *contentCheck {
+	check := &contentCheck{mismatch: mismatch}
+	if info, err := os.Stat(path); err == nil {
+		check.size = info.Size()
+		check.modTime = info.ModTime()
+	} else {
+		check.missing = true
+	}
+	return check
+}
+
+// checksumMismatch reports whether the content file no longer matches its recorded checksum, now
+// rather than when the inventory was loaded. The body served is still the one loaded at startup.
+func (s *transactionState) checksumMismatch() bool {
+	if s.contentCheck == nil {
+		return s.ChecksumMismatch
+	}
+	check := s.contentCheck
+	info, err := os.Stat(s.ContentFile)
+
+	check.mutex.Lock()
+	defer check.mutex.Unlock()
+	if err != nil {
+		if !check.missing {
+			playbackLogger.Warn("Content file was removed during playback", "url", s.URL, "path", s.ContentFile)
+		}
+		check.missing = true
+		check.mismatch = true
+		return true
+	}
+	if !check.missing && info.Size() == check.size && info.ModTime().Equal(check.modTime) {
+		return check.mismatch
+	}
+
+	data, err := os.ReadFile(s.ContentFile)
+	check.missing = false
+	check.size = info.Size()
+	check.modTime = info.ModTime()
+	check.mismatch = err != nil || inventory.ContentChecksum(data) != s.ContentSHA256
+	if check.mismatch {
+		playbackLogger.Warn("Content file was modified during playback", "url", s.URL, "path", s.ContentFile)
+	}
+	return check.mismatch
+}
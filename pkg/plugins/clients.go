@@ -0,0 +1,68 @@
+package plugins
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// clientTagger identifies the client of a flow by its proxy auth user or source IP.
+// For HTTPS the Proxy-Authorization header is only sent with CONNECT, so the user is
+// remembered per client connection before the hop-by-hop header is removed.
+type clientTagger struct {
+	users sync.Map // client connection id -> proxy auth user
+}
+
+// observe remembers the proxy auth user of the connection and strips the hop-by-hop header
+func (t *clientTagger) observe(f *proxy.Flow) {
+	user := proxyAuthUser(f.Request.Header)
+	if user == "" || f.ConnContext == nil || f.ConnContext.ClientConn == nil {
+		return
+	}
+	t.users.Store(f.ConnContext.ClientConn.Id, user)
+	f.Request.Header.Del("Proxy-Authorization")
+}
+
+// forget drops the user remembered for a closed client connection
+func (t *clientTagger) forget(clientConn *proxy.ClientConn) {
+	if clientConn != nil {
+		t.users.Delete(clientConn.Id)
+	}
+}
+
+// clientID returns the identifier of the client that sent the flow
+func (t *clientTagger) clientID(f *proxy.Flow) string {
+	if user := proxyAuthUser(f.Request.Header); user != "" {
+		return user
+	}
+	if f.ConnContext == nil || f.ConnContext.ClientConn == nil {
+		return ""
+	}
+	if user, ok := t.users.Load(f.ConnContext.ClientConn.Id); ok {
+		return user.(string)
+	}
+	if conn := f.ConnContext.ClientConn.Conn; conn != nil {
+		if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			return host
+		}
+	}
+	return ""
+}
+
+// proxyAuthUser returns the user name of a Basic Proxy-Authorization header
+func proxyAuthUser(header http.Header) string {
+	scheme, credentials, ok := strings.Cut(header.Get("Proxy-Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return ""
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(credentials))
+	if err != nil {
+		return ""
+	}
+	user, _, _ := strings.Cut(string(decoded), ":")
+	return user
+}
@@ -0,0 +1,47 @@
+package plugins
+
+import (
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// concurrencyLimiter holds the replays to each host to the concurrency observed while recording,
+// so requests over the limit queue as they did at the original server
+type concurrencyLimiter struct {
+	slots map[string]chan struct{}
+}
+
+func newConcurrencyLimiter(limits map[string]int) *concurrencyLimiter {
+	l := &concurrencyLimiter{slots: make(map[string]chan struct{}, len(limits))}
+	for host, limit := range limits {
+		if limit > 0 {
+			l.slots[host] = make(chan struct{}, limit)
+		}
+	}
+	return l
+}
+
+// acquire waits for a free slot of the flow's host and returns the function releasing it, and
+// whether the flow had to queue. Hosts without a recorded limit are not held, and a client that
+// disconnects stops waiting.
+func (l *concurrencyLimiter) acquire(f *proxy.Flow) (func(), bool) {
+	if l == nil || f.Request == nil {
+		return func() {}, false
+	}
+	slots, ok := l.slots[f.Request.URL.Host]
+	if !ok {
+		return func() {}, false
+	}
+	release := func() { <-slots }
+
+	select {
+	case slots <- struct{}{}:
+		return release, false
+	default:
+	}
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	case <-f.Done():
+		return func() {}, true
+	}
+}
@@ -0,0 +1,52 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// connectEmulator delays the first response from each host by the connection setup the recording
+// traced for it, like the first visit of a browser: the DNS lookup, connect and, unless handshakes
+// are emulated per connection, the TLS handshake
+type connectEmulator struct {
+	hosts map[string]time.Duration
+	seen  sync.Map // host names replayed before
+	// withTLS adds the recorded handshake, left to the tlsEmulator when it runs
+	withTLS bool
+}
+
+func newConnectEmulator(withTLS bool) *connectEmulator {
+	return &connectEmulator{hosts: make(map[string]time.Duration), withTLS: withTLS}
+}
+
+// add takes in the traced phases of a resource; the first that opened a connection to the host
+// is kept
+func (e *connectEmulator) add(host string, timings *types.Timings) {
+	if _, ok := e.hosts[host]; ok || timings.DNSMS == 0 && timings.ConnectMS == 0 && timings.TLSMS == 0 {
+		return
+	}
+	setup := timings.DNSMS + timings.ConnectMS
+	if e.withTLS {
+		setup += timings.TLSMS
+	}
+	e.hosts[host] = time.Duration(setup) * time.Millisecond
+}
+
+// delay returns the connection setup to add to the flow's response, once per host
+func (e *connectEmulator) delay(f *proxy.Flow) time.Duration {
+	if e == nil || f.Request == nil {
+		return 0
+	}
+	host := f.Request.URL.Hostname()
+	setup, ok := e.hosts[host]
+	if !ok {
+		return 0
+	}
+	if _, repeat := e.seen.LoadOrStore(host, struct{}{}); repeat {
+		return 0
+	}
+	return setup
+}
@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"sort"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/accesslog"
+	"go-http-playback-proxy/pkg/dump"
+	"go-http-playback-proxy/pkg/scenario"
+)
+
+const (
+	// recentRequests is how many handled requests are kept for diagnostic bundles
+	recentRequests = 50
+	// nearestKeyCount is how many similar recorded keys a miss bundle lists
+	nearestKeyCount = 5
+)
+
+// logAccess remembers a handled request for diagnostic bundles and writes it to the access log
+func (p *PlaybackPlugin) logAccess(f *proxy.Flow, source string) {
+	entry := accesslog.Entry{
+		Time:   time.Now(),
+		Method: f.Request.Method,
+		URL:    f.Request.URL.String(),
+		Source: source,
+	}
+	if f.Response != nil {
+		entry.Status = f.Response.StatusCode
+	}
+	p.writeAccess(entry)
+}
+
+// writeAccess remembers an access log entry and writes it to the access log
+func (p *PlaybackPlugin) writeAccess(entry accesslog.Entry) {
+	p.recent.Add(entry)
+	if err := p.accessLog.Log(entry); err != nil {
+		playbackLogger.Warn("Failed to write access log", "error", err)
+	}
+}
+
+// RecentRequests returns the most recently handled requests, oldest first
+func (p *PlaybackPlugin) RecentRequests() []accesslog.Entry {
+	return p.recent.Entries()
+}
+
+// dumpMiss writes a diagnostic bundle for a request that was not recorded and could not go upstream
+func (p *PlaybackPlugin) dumpMiss(f *proxy.Flow, detail string) {
+	if p.dumps == nil {
+		return
+	}
+
+	bundle := &dump.Bundle{
+		Reason:      dump.ReasonMiss,
+		Detail:      detail,
+		Request:     dump.NewRequest(f.Request.Method, f.Request.URL.String(), f.Request.Header.Clone(), f.Request.Body),
+		NearestKeys: p.nearestKeys(f.Request.Method, f.Request.URL.String(), nearestKeyCount),
+		Recent:      p.recent.Entries(),
+	}
+	if p.scenarioTracker != nil {
+		report := p.scenarioTracker.Report()
+		bundle.Scenario = &report
+	}
+
+	path, err := p.dumps.Write(bundle)
+	if err != nil {
+		playbackLogger.Error("Failed to write diagnostic bundle", "error", err)
+		return
+	}
+	playbackLogger.Warn("Diagnostic bundle written", "reason", bundle.Reason, "url", bundle.Request.URL, "path", path)
+}
+
+// DumpScenarioFailure writes a diagnostic bundle for a failed scenario and returns its path,
+// or "" when no dump directory is configured
+func (p *PlaybackPlugin) DumpScenarioFailure(report scenario.Report) (string, error) {
+	if p.dumps == nil {
+		return "", nil
+	}
+	return p.dumps.Write(&dump.Bundle{
+		Reason:   dump.ReasonScenario,
+		Detail:   "scenario verification failed",
+		Scenario: &report,
+		Recent:   p.recent.Entries(),
+	})
+}
+
+// nearestKeys returns up to n recorded keys that share the longest prefix with the request,
+// preferring keys with the same method
+func (p *PlaybackPlugin) nearestKeys(method, url string, n int) []string {
+	type candidate struct {
+		key        string
+		sameMethod bool
+		prefix     int
+	}
+
+	p.mutex.RLock()
+	candidates := make([]candidate, 0, len(p.transactionMap))
+	for key, transaction := range p.transactionMap {
+		candidates = append(candidates, candidate{
+			key:        key,
+			sameMethod: transaction.Method == method,
+			prefix:     commonPrefix(transaction.URL, url),
+		})
+	}
+	p.mutex.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.sameMethod != b.sameMethod {
+			return a.sameMethod
+		}
+		if a.prefix != b.prefix {
+			return a.prefix > b.prefix
+		}
+		return a.key < b.key
+	})
+
+	keys := make([]string, 0, n)
+	for i := 0; i < len(candidates) && i < n; i++ {
+		keys = append(keys, candidates[i].key)
+	}
+	return keys
+}
+
+// commonPrefix returns the length of the common prefix of two strings
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
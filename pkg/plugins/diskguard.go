@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-http-playback-proxy/pkg/diskspace"
+)
+
+// diskCheckInterval is how often free space is checked while recording
+const diskCheckInterval = 5 * time.Second
+
+// diskGuard stops recording before the inventory's filesystem runs out of space, so the
+// inventory can still be saved instead of being cut off mid-write
+type diskGuard struct {
+	dir     string
+	minFree uint64
+	low     chan struct{}
+	once    sync.Once
+	tripped atomic.Bool
+}
+
+func newDiskGuard(dir string, minFree uint64) *diskGuard {
+	return &diskGuard{dir: dir, minFree: minFree, low: make(chan struct{})}
+}
+
+// check trips the guard when free space is below the threshold and reports whether it is tripped
+func (g *diskGuard) check() bool {
+	free, err := diskspace.Available(g.dir)
+	if err != nil {
+		recordingLogger.Warn("Failed to check free disk space", "directory", g.dir, "error", err)
+		return g.tripped.Load()
+	}
+	if free < g.minFree {
+		g.once.Do(func() {
+			recordingLogger.Warn("Free disk space below the limit, recording stopped", "directory", g.dir, "free", free, "limit", g.minFree)
+			g.tripped.Store(true)
+			close(g.low)
+		})
+	}
+	return g.tripped.Load()
+}
+
+// watch checks free space periodically until the guard trips
+func (g *diskGuard) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if g.check() {
+			return
+		}
+	}
+}
+
+// stopped reports whether recording was stopped for lack of space
+func (g *diskGuard) stopped() bool {
+	return g != nil && g.tripped.Load()
+}
@@ -0,0 +1,77 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+)
+
+// ChunkEvent reports a body chunk handed to the client during playback, for live replay waterfalls
+type ChunkEvent struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Index is the position of the chunk in the body, from 0
+	Index int `json:"index"`
+	// Count is the number of chunks in the body
+	Count int `json:"count"`
+	// Size is the number of body bytes in the chunk
+	Size int `json:"size"`
+	// Started is when the schedule of the response started
+	Started time.Time `json:"started"`
+	// Scheduled is when the chunk was due
+	Scheduled time.Time `json:"scheduled"`
+	// Sent is when the client took the last byte of the chunk; later than Scheduled when it read slowly
+	Sent time.Time `json:"sent"`
+}
+
+// chunkSubscribers fans chunk events out to subscribers. The zero value has none.
+type chunkSubscribers struct {
+	mutex       sync.RWMutex
+	nextID      int
+	subscribers map[int]func(ChunkEvent)
+}
+
+// subscribe adds a subscriber and returns the function that removes it
+func (s *chunkSubscribers) subscribe(fn func(ChunkEvent)) func() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[int]func(ChunkEvent))
+	}
+	id := s.nextID
+	s.nextID++
+	s.subscribers[id] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			delete(s.subscribers, id)
+		})
+	}
+}
+
+// active reports whether anyone listens, so events are not built for nobody
+func (s *chunkSubscribers) active() bool {
+	if s == nil {
+		return false
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.subscribers) > 0
+}
+
+// publish calls every subscriber with the event
+func (s *chunkSubscribers) publish(event ChunkEvent) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, fn := range s.subscribers {
+		fn(event)
+	}
+}
+
+// SubscribeChunks calls fn for every body chunk sent during playback and returns the function that
+// stops the calls. fn runs on the goroutine sending the response, so it must return quickly.
+func (p *PlaybackPlugin) SubscribeChunks(fn func(ChunkEvent)) func() {
+	return p.chunkEvents.subscribe(fn)
+}
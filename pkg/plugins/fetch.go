@@ -0,0 +1,26 @@
+package plugins
+
+import (
+	"net/http"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// fetchMetadata returns the fetch metadata a browser sent with a request, or nil if it sent none
+func fetchMetadata(header http.Header) *types.FetchMetadata {
+	metadata := &types.FetchMetadata{
+		Dest:    header.Get("Sec-Fetch-Dest"),
+		Mode:    header.Get("Sec-Fetch-Mode"),
+		Site:    header.Get("Sec-Fetch-Site"),
+		User:    header.Get("Sec-Fetch-User") == "?1",
+		Purpose: header.Get("Sec-Purpose"),
+	}
+	if metadata.Purpose == "" {
+		// Older browsers announce prefetches with the unprefixed header
+		metadata.Purpose = header.Get("Purpose")
+	}
+	if *metadata == (types.FetchMetadata{}) {
+		return nil
+	}
+	return metadata
+}
@@ -0,0 +1,70 @@
+package plugins
+
+import (
+	"bytes"
+	"mime"
+	"time"
+
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// flushGap is the pause in arrival that marks a flush by the origin rather than network jitter
+const flushGap = 50 * time.Millisecond
+
+// isHTMLMediaType reports whether a Content-Type is an HTML document, which is streamed through
+// the proxy while recording so the points where the origin flushed it are known
+func isHTMLMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// flushMark is where an HTML response paused: when, and how many '>' the decoded document had by then
+type flushMark struct {
+	at   time.Time
+	tags int
+}
+
+// flushedHTML is the arrival of an HTML body the origin flushed in parts
+type flushedHTML struct {
+	firstByte time.Time
+	flushes   []flushMark
+}
+
+// htmlFlushes finds the flushes of an HTML body from when its bytes arrived, or nil if it arrived in
+// one go. A flush must add at least one tag and leave some of the document for later.
+func htmlFlushes(body []byte, contentEncoding string, marks []readMark) *flushedHTML {
+	if len(marks) < 2 {
+		return nil
+	}
+	if contentEncoding == "" {
+		contentEncoding = string(types.ContentEncodingIdentity)
+	}
+	coding := types.ContentEncodingType(contentEncoding)
+	total := bytes.Count(encoding.DecodePrefix(body, coding), []byte(">"))
+
+	var flushes []flushMark
+	for i := 0; i+1 < len(marks); i++ {
+		if marks[i+1].at.Sub(marks[i].at) < flushGap || marks[i].end > len(body) {
+			continue
+		}
+		tags := bytes.Count(encoding.DecodePrefix(body[:marks[i].end], coding), []byte(">"))
+		if tags == 0 || tags >= total || (len(flushes) > 0 && tags <= flushes[len(flushes)-1].tags) {
+			continue
+		}
+		flushes = append(flushes, flushMark{at: marks[i].at, tags: tags})
+	}
+	if len(flushes) == 0 {
+		return nil
+	}
+	return &flushedHTML{firstByte: marks[0].at, flushes: flushes}
+}
+
+// points converts the flushes to offsets from the request start
+func (h *flushedHTML) points(started time.Time) []types.FlushPoint {
+	points := make([]types.FlushPoint, len(h.flushes))
+	for i, flush := range h.flushes {
+		points[i] = types.FlushPoint{OffsetMS: flush.at.Sub(started).Milliseconds(), Tags: flush.tags}
+	}
+	return points
+}
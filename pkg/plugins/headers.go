@@ -0,0 +1,55 @@
+package plugins
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// clientHeaderLimit is the header block size many clients and servers refuse beyond
+	// (Node.js, and common nginx and load balancer settings)
+	clientHeaderLimit = 16 * 1024
+	// cookieLimit is the largest cookie browsers are required to store (RFC 6265)
+	cookieLimit = 4096
+)
+
+// headerBlockSize returns the size of the header lines as sent on the wire in HTTP/1.1
+func headerBlockSize(header http.Header) int {
+	size := 0
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+	return size
+}
+
+// recordedHeaderValue returns the value a response header is recorded with. Only the first value
+// of most headers is kept, but every Link header is joined so preload hints are kept as sent.
+func recordedHeaderValue(name string, values []string) string {
+	if http.CanonicalHeaderKey(name) == "Link" {
+		return strings.Join(values, ", ")
+	}
+	return values[0]
+}
+
+// headerWarnings describes the headers of an exchange that exceed common client limits,
+// which may break clients or servers when the recording is replayed
+func headerWarnings(request, response http.Header) []string {
+	var warnings []string
+	if size := headerBlockSize(request); size > clientHeaderLimit {
+		warnings = append(warnings, fmt.Sprintf("request headers are %d bytes, over %d", size, clientHeaderLimit))
+	}
+	if size := headerBlockSize(response); size > clientHeaderLimit {
+		warnings = append(warnings, fmt.Sprintf("response headers are %d bytes, over %d", size, clientHeaderLimit))
+	}
+	for _, cookie := range response.Values("Set-Cookie") {
+		// The limit covers the name, value and attributes
+		if len(cookie) > cookieLimit {
+			name, _, _ := strings.Cut(cookie, "=")
+			warnings = append(warnings, fmt.Sprintf("cookie %s is %d bytes, over %d", strings.TrimSpace(name), len(cookie), cookieLimit))
+		}
+	}
+	return warnings
+}
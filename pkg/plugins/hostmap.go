@@ -0,0 +1,59 @@
+package plugins
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// remapHeaders points the headers of a response recorded under another host back at the requested
+// host: absolute Location and Content-Location URLs on the recorded host, and the Domain of the
+// cookies set for it
+func remapHeaders(header http.Header, recordedURL string, requested *url.URL) {
+	recorded, err := url.Parse(recordedURL)
+	if err != nil || strings.EqualFold(recorded.Hostname(), requested.Hostname()) {
+		return
+	}
+
+	for _, name := range []string{"Location", "Content-Location"} {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		u, err := url.Parse(value)
+		if err != nil || !strings.EqualFold(u.Hostname(), recorded.Hostname()) {
+			continue
+		}
+		if u.Scheme == recorded.Scheme {
+			u.Scheme = requested.Scheme
+		}
+		u.Host = requested.Host
+		header.Set(name, u.String())
+	}
+
+	cookies := header.Values("Set-Cookie")
+	header.Del("Set-Cookie")
+	for _, cookie := range cookies {
+		header.Add("Set-Cookie", remapCookieDomain(cookie, recorded.Hostname(), requested.Hostname()))
+	}
+}
+
+// remapCookieDomain replaces the Domain attribute of a Set-Cookie value when it names the recorded
+// host; a parent domain covering both hosts is kept
+func remapCookieDomain(cookie, recorded, requested string) string {
+	attributes := strings.Split(cookie, ";")
+	for i, attribute := range attributes {
+		name, value, ok := strings.Cut(strings.TrimSpace(attribute), "=")
+		if !ok || !strings.EqualFold(name, "Domain") {
+			continue
+		}
+		dot := ""
+		if strings.HasPrefix(value, ".") {
+			dot = "."
+		}
+		if strings.EqualFold(strings.TrimPrefix(value, "."), recorded) {
+			attributes[i] = " " + name + "=" + dot + requested
+		}
+	}
+	return strings.Join(attributes, ";")
+}
@@ -0,0 +1,100 @@
+package plugins
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/httputil"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// informationalResponse is an interim 1xx response and when it arrived
+type informationalResponse struct {
+	at         time.Time
+	statusCode int
+	headers    types.HttpHeaders
+}
+
+// informationalLog collects the interim responses of one flow
+type informationalLog struct {
+	responses []informationalResponse
+	mutex     sync.Mutex
+}
+
+func (l *informationalLog) add(statusCode int, header textproto.MIMEHeader) error {
+	headers := make(types.HttpHeaders, len(header))
+	for name, values := range header {
+		// Early Hints usually carry several Link headers; keep them all
+		headers[name] = strings.Join(values, ", ")
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.responses = append(l.responses, informationalResponse{at: time.Now(), statusCode: statusCode, headers: headers})
+	return nil
+}
+
+// since returns the collected responses with offsets from the request start
+func (l *informationalLog) since(started time.Time) []types.Informational {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var result []types.Informational
+	for _, response := range l.responses {
+		result = append(result, types.Informational{
+			StatusCode: response.statusCode,
+			OffsetMS:   response.at.Sub(started).Milliseconds(),
+			RawHeaders: response.headers,
+		})
+	}
+	return result
+}
+
+// traceInformational collects the interim responses the upstream sends for the flow.
+// go-mitmproxy derives the upstream request's context from the client request, so the trace is
+// attached by replacing the client request's context in place.
+func (p *RecordingPlugin) traceInformational(f *proxy.Flow) {
+	raw := f.Request.Raw()
+	if raw == nil {
+		return
+	}
+
+	log := &informationalLog{}
+	trace := &httptrace.ClientTrace{Got1xxResponse: log.add}
+	*raw = *raw.WithContext(httptrace.WithClientTrace(raw.Context(), trace))
+	p.informational.Store(f, log)
+}
+
+// takeInformational returns and forgets the interim responses collected for the flow
+func (p *RecordingPlugin) takeInformational(f *proxy.Flow, started time.Time) []types.Informational {
+	v, ok := p.informational.LoadAndDelete(f)
+	if !ok {
+		return nil
+	}
+	return v.(*informationalLog).since(started)
+}
+
+// writeInformational sends the recorded interim responses of a transaction to the client at their
+// offsets from start. A 100 Continue the client asked for is skipped, as net/http already sent it
+// when go-mitmproxy read the request body.
+func (p *PlaybackPlugin) writeInformational(f *proxy.Flow, transaction *types.PlaybackTransaction, start time.Time, immediate bool) {
+	expectsContinue := strings.EqualFold(f.Request.Header.Get("Expect"), "100-continue")
+	for _, response := range transaction.Informational {
+		if response.StatusCode < 100 || response.StatusCode > 199 || response.StatusCode == http.StatusSwitchingProtocols ||
+			(response.StatusCode == http.StatusContinue && expectsContinue) {
+			continue
+		}
+		if !immediate {
+			time.Sleep(time.Until(start.Add(time.Duration(response.OffsetMS) * time.Millisecond)))
+		}
+		if !httputil.WriteInterim(f.Request.Raw(), response.StatusCode, response.RawHeaders) {
+			playbackLogger.Debug("Interim responses not sent", "url", transaction.URL, "count", len(transaction.Informational))
+			return
+		}
+	}
+}
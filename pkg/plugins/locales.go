@@ -0,0 +1,42 @@
+package plugins
+
+import (
+	"sort"
+	"strings"
+)
+
+// primaryLanguage returns the language subtag of a language tag (ja for ja-JP)
+func primaryLanguage(tag string) string {
+	language, _, _ := strings.Cut(tag, "-")
+	return strings.ToLower(language)
+}
+
+// selectLocale picks the language to answer a request with from a language preference list in the
+// form of Accept-Language: the recorded language the list names with the highest quality (the first
+// listed on a tie), matching a language to its regional variants (ja to ja-JP) when no tag matches
+// exactly. It returns nil when the list names none of the languages.
+func selectLocale(locales []*transactionState, preferred string) *transactionState {
+	var best *transactionState
+	bestQuality, bestExact := 0.0, false
+	for _, accepted := range parseAccept(preferred) {
+		for _, locale := range locales {
+			exact := strings.EqualFold(locale.Language, accepted.mediaType)
+			if !exact && (locale.Language == "" || primaryLanguage(locale.Language) != primaryLanguage(accepted.mediaType)) {
+				continue
+			}
+			if accepted.quality > bestQuality || (accepted.quality == bestQuality && exact && !bestExact) {
+				best, bestQuality, bestExact = locale, accepted.quality, exact
+			}
+		}
+	}
+	return best
+}
+
+// fallbackLocale returns the response for requests accepting none of the recorded languages: the
+// first by language tag, so it does not depend on the order of the inventory
+func fallbackLocale(locales []*transactionState) *transactionState {
+	sort.Slice(locales, func(i, j int) bool {
+		return locales[i].Language < locales[j].Language
+	})
+	return locales[0]
+}
@@ -0,0 +1,148 @@
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/resolver"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// missRecorder appends the responses of requests missing from the inventory to it during playback,
+// so a recording grows by browsing through the playback proxy
+type missRecorder struct {
+	persistence *inventory.PersistenceManager
+	// mutex serializes the appends, which rewrite inventory.json
+	mutex    sync.Mutex
+	recorded atomic.Int64
+}
+
+// newMissRecorder appends to the inventory in inventoryDir, redacted like the inventory was saved
+func newMissRecorder(inventoryDir string) (*missRecorder, error) {
+	persistence := inventory.NewPersistenceManager(inventoryDir)
+	redaction, err := persistence.SavedRedaction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the redaction of the inventory: %w", err)
+	}
+	persistence.Redaction = redaction
+	return &missRecorder{persistence: persistence}, nil
+}
+
+// pendingMiss is an unrecorded request on its way upstream
+type pendingMiss struct {
+	transaction types.RecordingTransaction
+	remoteAddr  string
+	body        *captureReader
+}
+
+// start begins recording a miss and returns the upstream request traced for its server address
+func (r *missRecorder) start(f *proxy.Flow, req *http.Request, startTime time.Time) (*pendingMiss, *http.Request) {
+	miss := &pendingMiss{
+		transaction: types.RecordingTransaction{
+			Method:            f.Request.Method,
+			URL:               f.Request.URL.String(),
+			RequestStarted:    startTime,
+			RawHeaders:        make(types.HttpHeaders),
+			Fetch:             fetchMetadata(f.Request.Header),
+			Accept:            f.Request.Header.Get("Accept"),
+			RequestHeaders:    requestHeaders(f.Request.Header, nil),
+			RequestBody:       recordedRequestBody(f.Request),
+			RequestBodySHA256: requestBodyHash(f.Request),
+		},
+	}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			miss.remoteAddr = info.Conn.RemoteAddr().String()
+		},
+	}
+	return miss, req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// capture records the status and headers of the upstream response and returns its body, copied as
+// the client reads it
+func (m *pendingMiss) capture(resp *http.Response) io.ReadCloser {
+	m.transaction.ResponseStarted = time.Now()
+	statusCode := resp.StatusCode
+	m.transaction.StatusCode = &statusCode
+	for name, values := range resp.Header {
+		if len(values) > 0 {
+			m.transaction.RawHeaders[name] = recordedHeaderValue(name, values)
+		}
+	}
+	m.body = &captureReader{reader: resp.Body}
+	return struct {
+		io.Reader
+		io.Closer
+	}{m.body, resp.Body}
+}
+
+// recordMiss appends a miss to the inventory once its response has been passed on, and replays it
+// for the requests that follow
+func (p *PlaybackPlugin) recordMiss(f *proxy.Flow, miss *pendingMiss) {
+	transaction := &miss.transaction
+	body, eof := miss.body.result()
+	transaction.Body = body
+	transaction.ResponseFinished = time.Now()
+	transaction.ExpectedLength = expectedBodyLength(f)
+	transaction.Truncated = !eof ||
+		(transaction.ExpectedLength != nil && int64(len(body)) < *transaction.ExpectedLength)
+	if host, _, err := net.SplitHostPort(miss.remoteAddr); err == nil {
+		transaction.IPAddress = host
+		transaction.Resolver = resolver.System
+	}
+
+	if err := p.misses.append(transaction); err != nil {
+		playbackLogger.Error("Failed to record unrecorded request", "url", transaction.URL, "error", err)
+		return
+	}
+	playbackLogger.Info("Recorded unrecorded request", "method", transaction.Method, "url", transaction.URL, "truncated", transaction.Truncated)
+
+	if transaction.Truncated && p.playbackManager.SkipTruncated {
+		return
+	}
+	recorded, err := p.playbackManager.LoadPlaybackTransaction(transaction.Method, transaction.URL, transaction.RequestBodySHA256)
+	if err != nil || recorded == nil {
+		playbackLogger.Warn("Recorded request is not replayed until restart", "url", transaction.URL, "error", err)
+		return
+	}
+
+	key := fmt.Sprintf("%s:%s", recorded.Method, recorded.URL)
+	state := newTransactionState(recorded)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, exists := p.transactionMap[key]; !exists {
+		p.transactionMap[key] = state
+	}
+	if bodies, ok := p.requestBodies[key]; ok {
+		if _, exists := bodies[recorded.RequestBodySHA256]; !exists {
+			bodies[recorded.RequestBodySHA256] = state
+		}
+	}
+}
+
+// append adds a transaction to the inventory
+func (r *missRecorder) append(transaction *types.RecordingTransaction) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.persistence.AppendRecordedTransaction(transaction); err != nil {
+		return err
+	}
+	r.recorded.Add(1)
+	return nil
+}
+
+// RecordedMisses returns how many unrecorded requests were appended to the inventory
+func (p *PlaybackPlugin) RecordedMisses() int64 {
+	if p.misses == nil {
+		return 0
+	}
+	return p.misses.recorded.Load()
+}
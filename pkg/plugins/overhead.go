@@ -0,0 +1,35 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// proxyOverhead accumulates the time the recording plugin's hooks spend between the start of a
+// request and the start of its response. The measured TTFB includes it, though the origin had
+// nothing to do with it.
+type proxyOverhead struct {
+	flows sync.Map // *proxy.Flow -> time.Duration
+}
+
+// start counts the time since a request started, from within the hook that started it
+func (o *proxyOverhead) start(f *proxy.Flow, since time.Time) {
+	o.flows.Store(f, time.Since(since))
+}
+
+// add counts the time since a hook began, for requests whose start was counted
+func (o *proxyOverhead) add(f *proxy.Flow, since time.Time) {
+	if total, ok := o.flows.Load(f); ok {
+		o.flows.Store(f, total.(time.Duration)+time.Since(since))
+	}
+}
+
+// take returns and forgets the overhead counted for a request
+func (o *proxyOverhead) take(f *proxy.Flow) time.Duration {
+	if total, ok := o.flows.LoadAndDelete(f); ok {
+		return total.(time.Duration)
+	}
+	return 0
+}
@@ -0,0 +1,173 @@
+package plugins
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// pacedBody streams recorded chunks at their scheduled offsets from the request start.
+// The proxy pulls it only as fast as the client accepts data, so a slow reader delays the
+// schedule instead of piling up buffered bytes: at most one chunk is in flight per flow and
+// the chunk data is shared with the loaded transaction rather than copied. Each chunk is flushed
+// to the client, so small ones (e.g. server-sent events) do not wait in the server's write buffer.
+type pacedBody struct {
+	method    string
+	url       string
+	chunks    []types.BodyChunk
+	offsets   []time.Duration
+	start     time.Time
+	immediate bool
+
+	next    int
+	pending []byte
+
+	mutex      sync.Mutex
+	handedOver time.Time
+
+	// events receives a ChunkEvent as each chunk is sent, if set
+	events *chunkSubscribers
+}
+
+func newPacedBody(transaction *types.PlaybackTransaction, offsets []time.Duration, start time.Time, immediate bool) *pacedBody {
+	return &pacedBody{
+		method:    transaction.Method,
+		url:       transaction.URL,
+		chunks:    transaction.Chunks,
+		offsets:   offsets,
+		start:     start,
+		immediate: immediate,
+	}
+}
+
+// waitFirstChunk blocks until the first chunk is due, so response headers leave at the recorded TTFB
+func (b *pacedBody) waitFirstChunk() {
+	if len(b.chunks) > 0 {
+		b.wait(0)
+	}
+}
+
+// waitOpen blocks until a stream is due to open, so its headers leave before its first part
+func (b *pacedBody) waitOpen(offset time.Duration) {
+	if !b.immediate {
+		time.Sleep(time.Until(b.start.Add(offset)))
+	}
+}
+
+func (b *pacedBody) Read(p []byte) (int, error) {
+	if !b.fill() {
+		return 0, io.EOF
+	}
+
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	b.handOver()
+	if len(b.pending) == 0 {
+		b.sent(b.next - 1)
+	}
+	return n, nil
+}
+
+// WriteTo writes the chunks as they are due and flushes each one; io.Copy uses it instead of Read
+func (b *pacedBody) WriteTo(w io.Writer) (int64, error) {
+	flusher, _ := w.(http.Flusher)
+	var written int64
+	for b.fill() {
+		n, err := w.Write(b.pending)
+		written += int64(n)
+		b.pending = b.pending[n:]
+		if err != nil {
+			return written, err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		b.handOver()
+		b.sent(b.next - 1)
+	}
+	return written, nil
+}
+
+// fill waits for the next chunk once the pending one is consumed; it returns false at the end of the body
+func (b *pacedBody) fill() bool {
+	if len(b.pending) == 0 {
+		if b.next >= len(b.chunks) {
+			return false
+		}
+		b.wait(b.next)
+		b.pending = b.chunks[b.next].Chunk
+		b.next++
+	}
+	return true
+}
+
+func (b *pacedBody) handOver() {
+	b.mutex.Lock()
+	b.handedOver = time.Now()
+	b.mutex.Unlock()
+}
+
+// sent publishes the event of chunk i, whose last byte was just handed over
+func (b *pacedBody) sent(i int) {
+	if !b.events.active() {
+		return
+	}
+	scheduled := b.start
+	if !b.immediate {
+		scheduled = b.start.Add(b.offsets[i])
+	}
+	b.events.publish(ChunkEvent{
+		Method:    b.method,
+		URL:       b.url,
+		Index:     i,
+		Count:     len(b.chunks),
+		Size:      len(b.chunks[i].Chunk),
+		Started:   b.start,
+		Scheduled: scheduled,
+		Sent:      time.Now(),
+	})
+}
+
+// wait sleeps until chunk i is due; chunks that are late because the client read slowly are sent at once
+func (b *pacedBody) wait(i int) {
+	if b.immediate {
+		return
+	}
+	target := b.start.Add(b.offsets[i])
+	now := time.Now()
+	if now.Before(target) {
+		waitTime := target.Sub(now)
+		playbackLogger.Debug("Waiting for chunk",
+			"wait_time", waitTime,
+			"chunk", fmt.Sprintf("%d/%d", i+1, len(b.chunks)),
+			"url", b.url,
+			"offset", b.offsets[i])
+		time.Sleep(waitTime)
+	} else {
+		playbackLogger.Debug("Target time already passed",
+			"chunk", fmt.Sprintf("%d/%d", i+1, len(b.chunks)),
+			"url", b.url,
+			"behind_by", now.Sub(target),
+			"offset", b.offsets[i])
+	}
+}
+
+// lastHandover returns when the proxy last took data from the body
+func (b *pacedBody) lastHandover() time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.handedOver
+}
+
+// size returns the total number of body bytes
+func (b *pacedBody) size() int {
+	total := 0
+	for _, chunk := range b.chunks {
+		total += len(chunk.Chunk)
+	}
+	return total
+}
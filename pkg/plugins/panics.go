@@ -0,0 +1,20 @@
+package plugins
+
+import (
+	"runtime/debug"
+)
+
+// recoverPanic recovers a panic in a hook or goroutine of the recording, which go-mitmproxy would
+// only log (or which would crash the process in a goroutine of ours), and reports it on Panicked
+// so the recording can be saved before a broken process loses it
+func (p *RecordingPlugin) recoverPanic(where string) {
+	if v := recover(); v != nil {
+		recordingLogger.Error("Recovered panic while recording", "in", where, "panic", v, "stack", string(debug.Stack()))
+		p.panicOnce.Do(func() { close(p.panicked) })
+	}
+}
+
+// Panicked is closed once a panic was recovered while recording
+func (p *RecordingPlugin) Panicked() <-chan struct{} {
+	return p.panicked
+}
@@ -0,0 +1,124 @@
+package plugins
+
+import (
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// phaseTrace collects when the phases of one upstream request started and ended
+type phaseTrace struct {
+	mutex        sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	gotConn      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// mark sets the time of a phase boundary once; retries and fallback addresses keep the first
+func (t *phaseTrace) mark(at *time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+func (t *phaseTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart:         func(string, string) { t.mark(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.connectDone) },
+		GotConn:              func(httptrace.GotConnInfo) { t.mark(&t.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// timings returns the traced phases of a request that finished at finished. handshake is the TLS
+// handshake of the connection the request opened, which go-mitmproxy performs outside the trace.
+func (t *phaseTrace) timings(handshake *types.TLSSession, finished time.Time) *types.Timings {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.wroteRequest.IsZero() || t.firstByte.IsZero() {
+		return nil
+	}
+
+	timings := &types.Timings{
+		SendMS:    milliseconds(t.gotConn, t.wroteRequest),
+		WaitMS:    milliseconds(t.wroteRequest, t.firstByte),
+		ReceiveMS: milliseconds(t.firstByte, finished),
+	}
+	timings.DNSMS = milliseconds(t.dnsStart, t.dnsDone)
+	timings.ConnectMS = milliseconds(t.connectStart, t.connectDone)
+	if handshake != nil {
+		timings.TLSMS = handshake.HandshakeMS
+	}
+	return timings
+}
+
+// dial returns how long the DNS lookup and connect took
+func (t *phaseTrace) dial() (dnsMS, connectMS int64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return milliseconds(t.dnsStart, t.dnsDone), milliseconds(t.connectStart, t.connectDone)
+}
+
+// milliseconds returns the time from start to end, or 0 unless both happened in order
+func milliseconds(start, end time.Time) int64 {
+	if start.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start).Milliseconds()
+}
+
+// tracePhases traces the DNS lookup, connect, request write and first byte of the flow's upstream
+// request. go-mitmproxy dials new upstream connections with the context of the client request, so
+// lookups and connects are traced for the requests that open a connection on demand.
+func (p *RecordingPlugin) tracePhases(f *proxy.Flow) {
+	raw := f.Request.Raw()
+	if raw == nil {
+		return
+	}
+
+	trace := &phaseTrace{}
+	*raw = *raw.WithContext(httptrace.WithClientTrace(raw.Context(), trace.clientTrace()))
+	p.phases.Store(f, trace)
+}
+
+// traceTunnel traces the DNS lookup and connect of a CONNECT request: go-mitmproxy dials HTTPS
+// hosts while setting up the tunnel, before the first request on it
+func (p *RecordingPlugin) traceTunnel(f *proxy.Flow) {
+	raw := f.Request.Raw()
+	if raw == nil || f.ConnContext == nil || f.ConnContext.ClientConn == nil {
+		return
+	}
+
+	trace := &phaseTrace{}
+	*raw = *raw.WithContext(httptrace.WithClientTrace(raw.Context(), trace.clientTrace()))
+	p.tunnels.Store(f.ConnContext.ClientConn, trace)
+}
+
+// takeTimings returns and forgets the phases traced for the flow. The request that opened a TLS
+// connection through a tunnel takes the lookup and connect of the tunnel.
+func (p *RecordingPlugin) takeTimings(f *proxy.Flow, handshake *types.TLSSession, finished time.Time) *types.Timings {
+	v, ok := p.phases.LoadAndDelete(f)
+	if !ok {
+		return nil
+	}
+	timings := v.(*phaseTrace).timings(handshake, finished)
+	if timings == nil || handshake == nil || f.ConnContext == nil || f.ConnContext.ClientConn == nil {
+		return timings
+	}
+	if v, ok := p.tunnels.LoadAndDelete(f.ConnContext.ClientConn); ok && timings.DNSMS == 0 && timings.ConnectMS == 0 {
+		timings.DNSMS, timings.ConnectMS = v.(*phaseTrace).dial()
+	}
+	return timings
+}
@@ -0,0 +1,100 @@
+package plugins
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"go-http-playback-proxy/pkg/classify"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Route describes how a recorded resource will be replayed
+type Route struct {
+	Method string
+	URL    string
+	Status int
+	Bytes  int
+	// Policy is the classification policy resolved for the resource
+	Policy string
+	Timing string
+	// TTFB is the first-byte delay after the initial network conditions are applied
+	TTFB time.Duration
+	// CacheStatus is where the recorded response came from, if known
+	CacheStatus types.CacheStatus
+	// ChecksumMismatch is set when the content file no longer matches its recorded checksum
+	ChecksumMismatch bool
+}
+
+// Routes resolves the policy and effective timing of every loaded transaction, sorted by URL and method
+func (p *PlaybackPlugin) Routes() []Route {
+	conditions := p.networkController.Get()
+
+	p.mutex.RLock()
+	routes := make([]Route, 0, len(p.transactionMap))
+	for _, transaction := range p.transactionMap {
+		u, _ := url.Parse(transaction.URL)
+		policy := p.classifier.Classify(classify.Input{
+			Method:      transaction.Method,
+			URL:         u,
+			Header:      http.Header{},
+			ContentType: transaction.RawHeaders["Content-Type"],
+		})
+
+		resourceConditions := conditions.ForCacheStatus(transaction.CacheStatus)
+		route := Route{
+			Method:           transaction.Method,
+			URL:              transaction.URL,
+			Status:           http.StatusOK,
+			Policy:           policy.Name,
+			Timing:           policy.Timing,
+			TTFB:             resourceConditions.AdjustTTFB(transaction.TTFB),
+			CacheStatus:      transaction.CacheStatus,
+			ChecksumMismatch: transaction.ChecksumMismatch,
+		}
+		if transaction.StatusCode != nil {
+			route.Status = *transaction.StatusCode
+		}
+		if policy.Timing == classify.TimingImmediate {
+			route.TTFB = 0
+		}
+		for _, chunk := range transaction.Chunks {
+			route.Bytes += len(chunk.Chunk)
+		}
+		routes = append(routes, route)
+	}
+	p.mutex.RUnlock()
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].URL != routes[j].URL {
+			return routes[i].URL < routes[j].URL
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// TLSHosts returns the host names of the loaded HTTPS transactions, sorted
+func (p *PlaybackPlugin) TLSHosts() []string {
+	p.mutex.RLock()
+	seen := make(map[string]bool)
+	for _, transaction := range p.transactionMap {
+		if u, err := url.Parse(transaction.URL); err == nil && u.Scheme == "https" {
+			seen[u.Hostname()] = true
+		}
+	}
+	p.mutex.RUnlock()
+
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// GetClassifier returns the configured classifier, or nil if none is configured
+func (p *PlaybackPlugin) GetClassifier() *classify.Classifier {
+	return p.classifier
+}
@@ -4,25 +4,77 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/accesslog"
+	"go-http-playback-proxy/pkg/classify"
+	"go-http-playback-proxy/pkg/dump"
+	"go-http-playback-proxy/pkg/httputil"
 	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/logging"
+	"go-http-playback-proxy/pkg/network"
+	"go-http-playback-proxy/pkg/scenario"
 	"go-http-playback-proxy/pkg/types"
+	"go-http-playback-proxy/pkg/urlmatch"
 )
 
+// playbackLogger is the logger for the playback module
+var playbackLogger = logging.For(logging.ModulePlayback)
+
 // PlaybackPlugin handles playback mode functionality
 type PlaybackPlugin struct {
 	BaseLogPlugin
 	inventoryDir      string
-	transactionMap    map[string]*types.PlaybackTransaction
+	transactionMap    map[string]*transactionState
+	prefetchMap       map[string]*transactionState
+	variantMap        map[string][]*transactionState
+	// requestBodies holds the transactions of keys recorded with request bodies, by body hash
+	requestBodies     map[string]map[string]*transactionState
+	// localeMap holds the transactions of keys recorded in several languages
+	localeMap         map[string][]*transactionState
+	// repeats holds the responses kept for the same request, by the state of the first
+	repeats           map[*transactionState]*repeatCycle
+	// roundRobin starts the responses kept for a request over after the last
+	roundRobin        bool
+	language          string
+	matchRequestBody  bool
+	// matchedKeys maps the normalized keys of the recorded transactions to their keys
+	matchedKeys       map[string]string
+	urlMatcher        *urlmatch.Matcher
+	// hostMap serves requests to mapped hosts from the resources recorded under others
+	hostMap           *urlmatch.HostMap
+	matchPrefetch     bool
+	maxHeaderBytes    int
+	completeAtHeader  bool
+	builtinFallbacks  bool
+	// strictStatus answers every unrecorded request with this status instead of going upstream; 0
+	// leaves the decision to the policies
+	strictStatus      int
+	// misses appends the responses of unrecorded requests proxied upstream to the inventory
+	misses            *missRecorder
+	tlsEmulator       *tlsEmulator
+	connectEmulator   *connectEmulator
+	concurrency       *concurrencyLimiter
 	upstreamTransport *http.Transport
 	playbackManager   *inventory.PlaybackManager
+	scenarioTracker   *scenario.Tracker
+	classifier        *classify.Classifier
+	// domainFallbacks are the fallbacks of the inventory's playback settings, by host
+	domainFallbacks   *classify.DomainFallbacks
+	networkController *network.Controller
+	calibrator        *network.Calibrator
+	checksumMode      string
+	recent            *accesslog.Ring
+	accessLog         *accesslog.Logger
+	dumps             *dump.Writer
+	requestStarts     sync.Map // *proxy.Flow -> time.Time when request headers arrived
+	chunkEvents       chunkSubscribers
 	mutex             sync.RWMutex
 }
 
@@ -31,22 +83,204 @@ func NewPlaybackPlugin() (*PlaybackPlugin, error) {
 	return NewPlaybackPluginWithInventoryDir("./inventory")
 }
 
+// PlaybackOptions holds options applied when the inventory is loaded
+type PlaybackOptions struct {
+	// SkipTruncated excludes resources whose recorded body was truncated
+	SkipTruncated bool
+	// DisableCalibration turns off compensation for the proxy's own overhead
+	DisableCalibration bool
+	// Checksum is inventory.ChecksumOff (default), ChecksumWarn or ChecksumFail
+	Checksum string
+	// DumpDir receives a diagnostic bundle for every blocked miss and failed scenario
+	DumpDir string
+	// AccessLog receives every handled request as a JSON line
+	AccessLog io.Writer
+	// PadToWireSize pads re-encoded bodies to the size they were recorded with
+	PadToWireSize bool
+	// MatchPrefetch answers prefetch requests with the recorded prefetch response of a URL
+	// instead of the response recorded for its use
+	MatchPrefetch bool
+	// MaxHeaderBytes refuses requests whose header block is larger with 431; 0 leaves only the
+	// listener's built-in limit of 1MB
+	MaxHeaderBytes int
+	// Profile is the network profile playback starts with, if any
+	Profile *network.Profile
+	// Faults are the faults playback starts with, like those of fault presets
+	Faults []network.FaultRule
+	// CompleteAtHeader adds the CompleteAtHeader header to replayed responses
+	CompleteAtHeader bool
+	// EmulateTLSHandshakes delays the first response on each client connection by the recorded
+	// upstream handshake, at resumption speed for repeat connections to a host
+	EmulateTLSHandshakes bool
+	// EmulateConnections delays the first response from each host by the recorded DNS lookup,
+	// connect and TLS handshake (unless EmulateTLSHandshakes adds it per connection)
+	EmulateConnections bool
+	// DisableBuiltinFallbacks sends unrecorded favicon and /.well-known/ requests to the upstream
+	// (or blocks them by policy) instead of answering them locally
+	DisableBuiltinFallbacks bool
+	// MatchConcurrency queues replays to each host beyond the most requests it had in flight at
+	// once while recording
+	MatchConcurrency bool
+	// MatchProtocol queues replays to each host recorded over HTTP/1.1 only beyond the connections
+	// a browser opens to it, since they were not multiplexed like those over HTTP/2 and HTTP/3
+	MatchProtocol bool
+	// URLMatcher answers requests without a recording of their exact URL with the recording whose
+	// URL is the same once normalized, e.g. without cache-busting query parameters
+	URLMatcher *urlmatch.Matcher
+	// HostMap serves requests to some hosts from the resources recorded under others, pointing the
+	// Location and Set-Cookie headers of the responses back at the requested host
+	HostMap *urlmatch.HostMap
+	// MatchRequestBody answers requests to URLs recorded with request bodies only with the response
+	// recorded for the same normalized body; other bodies are handled like unrecorded requests
+	MatchRequestBody bool
+	// Language answers requests to URLs recorded in several languages with the response in this
+	// language, whatever their Accept-Language; empty negotiates by Accept-Language
+	Language string
+	// Strict answers every request missing from the inventory with StrictStatus and a JSON body
+	// instead of proxying it upstream, whatever the policies say
+	Strict bool
+	// StrictStatus is the status of unrecorded requests in strict mode; DefaultStrictStatus when 0
+	StrictStatus int
+	// RecordMisses appends the responses of unrecorded requests proxied upstream to the inventory
+	// and replays them from then on
+	RecordMisses bool
+	// LinkRules strip the Link hints of replayed responses by relation, or delay the responses of
+	// the resources they hint at
+	LinkRules []inventory.LinkRule
+	// Rewrites rewrite the bodies of replayed responses, e.g. production hostnames in HTML and scripts
+	Rewrites *inventory.RewriteRules
+	// Files holds the inventory in memory; the inventory directory is not read when it is set
+	Files inventory.MemoryFiles
+	// Repeats is the order the responses kept for the same request are replayed in:
+	// RepeatsSequence (default) or RepeatsRoundRobin
+	Repeats string
+}
+
+// DefaultStrictStatus is the status strict mode answers unrecorded requests with
+const DefaultStrictStatus = http.StatusGatewayTimeout
+
+// CompleteAtHeader carries when a replayed response is scheduled to finish (RFC 3339, UTC), so test
+// harnesses can wait for the replay timeline instead of sleeping fixed durations
+const CompleteAtHeader = "x-playback-complete-at"
+
 // NewPlaybackPluginWithInventoryDir creates a new playback plugin with custom inventory directory
 func NewPlaybackPluginWithInventoryDir(inventoryDir string) (*PlaybackPlugin, error) {
+	return NewPlaybackPluginWithOptions(inventoryDir, PlaybackOptions{})
+}
+
+// NewPlaybackPluginWithOptions creates a new playback plugin with custom inventory directory and options
+func NewPlaybackPluginWithOptions(inventoryDir string, opts PlaybackOptions) (*PlaybackPlugin, error) {
+	playbackManager := inventory.NewPlaybackManager(inventoryDir)
+	playbackManager.SkipTruncated = opts.SkipTruncated
+	playbackManager.VerifyChecksums = opts.Checksum == inventory.ChecksumWarn || opts.Checksum == inventory.ChecksumFail
+	playbackManager.PadToWireSize = opts.PadToWireSize
+	playbackManager.LinkRules = opts.LinkRules
+	playbackManager.Rewrites = opts.Rewrites
+	playbackManager.Files = opts.Files
+
 	plugin := &PlaybackPlugin{
 		inventoryDir:   inventoryDir,
-		transactionMap: make(map[string]*types.PlaybackTransaction),
-		playbackManager: inventory.NewPlaybackManager(inventoryDir),
+		checksumMode:   opts.Checksum,
+		recent:         accesslog.NewRing(recentRequests),
+		transactionMap: make(map[string]*transactionState),
+		prefetchMap:    make(map[string]*transactionState),
+		variantMap:     make(map[string][]*transactionState),
+		matchPrefetch:  opts.MatchPrefetch,
+		maxHeaderBytes: opts.MaxHeaderBytes,
+		urlMatcher:     opts.URLMatcher,
+		hostMap:        opts.HostMap,
+		matchRequestBody: opts.MatchRequestBody,
+		language:         inventory.NormalizeLanguage(opts.Language),
+		completeAtHeader: opts.CompleteAtHeader,
+		builtinFallbacks: !opts.DisableBuiltinFallbacks,
+		roundRobin:       opts.Repeats == RepeatsRoundRobin,
+		playbackManager: playbackManager,
 		upstreamTransport: &http.Transport{
-			MaxIdleConns:       100,
-			IdleConnTimeout:    90 * time.Second,
-			DisableCompression: true, // 圧縮を無効化してオリジナルの状態を保持
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			DisableCompression:    true, // 圧縮を無効化してオリジナルの状態を保持
 		},
 	}
 
+	conditions := network.DefaultConditions()
+	conditions.Profile = opts.Profile
+	conditions.Faults = opts.Faults
+	networkController, err := network.NewController(conditions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network controller: %w", err)
+	}
+	plugin.networkController = networkController
+
+	if !opts.DisableCalibration {
+		plugin.calibrator = network.NewCalibrator()
+	}
+	if opts.DumpDir != "" {
+		plugin.dumps = dump.NewWriter(opts.DumpDir)
+		// Bundles are redacted like the inventory was saved, so they can be kept as CI artifacts
+		if plugin.dumps.Redaction, err = inventory.NewPersistenceManager(inventoryDir).SavedRedaction(); err != nil {
+			return nil, fmt.Errorf("failed to load the redaction of the inventory: %w", err)
+		}
+	}
+	if opts.AccessLog != nil {
+		plugin.accessLog = accesslog.NewLogger(opts.AccessLog)
+	}
+	if opts.EmulateTLSHandshakes {
+		plugin.tlsEmulator = newTLSEmulator()
+	}
+	if opts.EmulateConnections {
+		plugin.connectEmulator = newConnectEmulator(!opts.EmulateTLSHandshakes)
+	}
+	if opts.Strict {
+		plugin.strictStatus = opts.StrictStatus
+		if plugin.strictStatus == 0 {
+			plugin.strictStatus = DefaultStrictStatus
+		}
+	}
+
+	if opts.RecordMisses {
+		if plugin.misses, err = newMissRecorder(inventoryDir); err != nil {
+			return nil, err
+		}
+	}
+
 	if err := plugin.loadInventory(); err != nil {
 		return nil, fmt.Errorf("failed to load inventory: %w", err)
 	}
+	settings, err := playbackManager.LoadSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load playback settings: %w", err)
+	}
+	if settings != nil {
+		if plugin.domainFallbacks, err = classify.NewDomainFallbacks(settings.Fallback, settings.Domains); err != nil {
+			return nil, fmt.Errorf("invalid playback settings: %w", err)
+		}
+	}
+
+	if (opts.MatchConcurrency || opts.MatchProtocol) && len(plugin.transactionMap) > 0 {
+		limits := make(map[string]int)
+		if opts.MatchConcurrency {
+			if limits, err = playbackManager.LoadConcurrency(); err != nil {
+				return nil, fmt.Errorf("failed to load recorded concurrency: %w", err)
+			}
+		}
+		if opts.MatchProtocol {
+			protocolLimits, err := playbackManager.LoadProtocolConcurrency()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load recorded protocols: %w", err)
+			}
+			// The lower limit wins where both apply
+			for host, limit := range protocolLimits {
+				if recorded, ok := limits[host]; !ok || limit < recorded {
+					limits[host] = limit
+				}
+			}
+		}
+		for host, limit := range limits {
+			playbackLogger.Debug("Recorded concurrency", "host", host, "limit", limit)
+		}
+		plugin.concurrency = newConcurrencyLimiter(limits)
+	}
 
 	return plugin, nil
 }
@@ -56,8 +290,8 @@ func (p *PlaybackPlugin) loadInventory() error {
 	inventoryPath := filepath.Join(p.inventoryDir, "inventory.json")
 	
 	// Check if inventory exists
-	if _, err := os.Stat(inventoryPath); os.IsNotExist(err) {
-		slog.Warn("No inventory found, will proxy all requests upstream", "path", inventoryPath)
+	if !p.playbackManager.HasInventory() {
+		playbackLogger.Warn("No inventory found, will proxy all requests upstream", "path", inventoryPath)
 		return nil
 	}
 
@@ -67,77 +301,420 @@ func (p *PlaybackPlugin) loadInventory() error {
 		return fmt.Errorf("failed to load playback transactions: %w", err)
 	}
 
-	slog.Debug("PlaybackManager loaded transactions", "transactions", len(transactions))
+	playbackLogger.Debug("PlaybackManager loaded transactions", "transactions", len(transactions))
 
 	// Convert transactions to map for fast lookup
+	p.requestBodies = make(map[string]map[string]*transactionState)
+	p.localeMap = make(map[string][]*transactionState)
+	mismatches := 0
+	bodyOrder := make(map[string][]string)
+	var prefetches, repeated []types.PlaybackTransaction
 	for _, transaction := range transactions {
+		if transaction.ChecksumMismatch {
+			mismatches++
+		}
+		if transaction.TLSSession != nil && p.tlsEmulator != nil {
+			if u, err := url.Parse(transaction.URL); err == nil {
+				p.tlsEmulator.add(u.Hostname(), transaction.TLSSession)
+			}
+		}
+		if transaction.Timings != nil && p.connectEmulator != nil {
+			if u, err := url.Parse(transaction.URL); err == nil {
+				p.connectEmulator.add(u.Hostname(), transaction.Timings)
+			}
+		}
+		if transaction.Repeat > 0 {
+			repeated = append(repeated, transaction)
+			continue
+		}
+		if transaction.Fetch.IsPrefetch() {
+			prefetches = append(prefetches, transaction)
+			continue
+		}
+
 		key := fmt.Sprintf("%s:%s", transaction.Method, transaction.URL)
+
+		// Image formats negotiated by Accept are chosen per request below
+		if transaction.Accept != "" {
+			transactionCopy := transaction
+			p.variantMap[key] = append(p.variantMap[key], newTransactionState(&transactionCopy))
+			continue
+		}
 		
-		// Check for duplicate keys
-		if _, exists := p.transactionMap[key]; exists {
-			slog.Warn("Duplicate key detected", "key", key)
+		// Check for duplicate keys; requests with other bodies are told apart below
+		bodies, exists := p.requestBodies[key]
+		if !exists {
+			bodies = make(map[string]*transactionState)
+			p.requestBodies[key] = bodies
 		}
 		
 		// Create a copy to store in the map
 		transactionCopy := transaction
-		p.transactionMap[key] = &transactionCopy
+		if existing, exists := bodies[transaction.RequestBodySHA256]; exists {
+			// Responses in other languages are chosen per request below
+			locales := p.localeMap[key]
+			if transaction.Language != existing.Language && (len(locales) == 0 || locales[0].RequestBodySHA256 == transaction.RequestBodySHA256) {
+				if len(locales) == 0 {
+					locales = []*transactionState{existing}
+				}
+				p.localeMap[key] = append(locales, newTransactionState(&transactionCopy))
+				continue
+			}
+			playbackLogger.Warn("Duplicate key detected", "key", key)
+		} else {
+			bodyOrder[key] = append(bodyOrder[key], transaction.RequestBodySHA256)
+		}
+		bodies[transaction.RequestBodySHA256] = newTransactionState(&transactionCopy)
+	}
+
+	// Requests accepting none of the languages of a URL get the first one by language tag
+	for key, locales := range p.localeMap {
+		p.requestBodies[key][locales[0].RequestBodySHA256] = fallbackLocale(locales)
+	}
+
+	// A URL recorded with several request bodies answers with the response to no body, else to the
+	// first body recorded, unless bodies are matched per request
+	for key, bodies := range p.requestBodies {
+		p.transactionMap[key] = defaultBodyVariant(bodies, bodyOrder[key])
+		if _, withoutBody := bodies[""]; withoutBody && len(bodies) == 1 {
+			delete(p.requestBodies, key)
+		}
+	}
+
+	// Requests naming none of the formats of an image get the one served to any client
+	for key, variants := range p.variantMap {
+		if _, exists := p.transactionMap[key]; exists {
+			playbackLogger.Warn("Duplicate key detected", "key", key)
+		}
+		p.transactionMap[key] = fallbackVariant(variants)
+		if len(variants) == 1 {
+			delete(p.variantMap, key)
+		}
+	}
+
+	// Prefetch responses also answer other requests for URLs only recorded as prefetches
+	for i := range prefetches {
+		key := fmt.Sprintf("%s:%s", prefetches[i].Method, prefetches[i].URL)
+		state := newTransactionState(&prefetches[i])
+		p.prefetchMap[key] = state
+		if _, exists := p.transactionMap[key]; !exists {
+			p.transactionMap[key] = state
+		}
+	}
+
+	// Responses kept after the first for a request answer the requests that follow in turn
+	p.attachRepeats(repeated)
+
+	// The first recording of a normalized URL answers the requests that normalize to it
+	if p.urlMatcher != nil {
+		p.matchedKeys = make(map[string]string)
+		for _, transaction := range transactions {
+			key := fmt.Sprintf("%s:%s", transaction.Method, transaction.URL)
+			matchedKey := p.urlMatcher.Key(transaction.Method, transaction.URL)
+			if recorded, exists := p.matchedKeys[matchedKey]; exists {
+				if recorded != key {
+					playbackLogger.Debug("Recordings match the same normalized URL", "key", matchedKey, "used", recorded, "ignored", key)
+				}
+				continue
+			}
+			p.matchedKeys[matchedKey] = key
+		}
 	}
 
 	// Check for specific URL
 	gtmKey := "GET:https://www.googletagmanager.com/gtag/js?id=G-VDRYPM3MEG"
 	if transaction, exists := p.transactionMap[gtmKey]; exists {
-		slog.Debug("Google Tag Manager found", "chunks", len(transaction.Chunks))
+		playbackLogger.Debug("Google Tag Manager found", "chunks", len(transaction.Chunks))
 	} else {
-		slog.Debug("Google Tag Manager NOT found in transaction map")
+		playbackLogger.Debug("Google Tag Manager NOT found in transaction map")
+	}
+
+	if mismatches > 0 {
+		playbackLogger.Error("Content files were modified after recording", "resources", mismatches, "mode", p.checksumMode)
+	}
+	if fallbacks := p.playbackManager.EncodingFallbacks(); len(fallbacks) > 0 {
+		playbackLogger.Warn("Resources are served uncompressed because their recorded encoding is unavailable", "resources", len(fallbacks))
 	}
 
-	slog.Debug("Loaded transactions from inventory", "transactions", len(p.transactionMap))
+	playbackLogger.Debug("Loaded transactions from inventory", "transactions", len(p.transactionMap))
 	return nil
 }
 
 
+// EncodingFallbacks returns the resources served uncompressed because their recorded content
+// encoding could not be reproduced
+func (p *PlaybackPlugin) EncodingFallbacks() []inventory.EncodingFallback {
+	return p.playbackManager.EncodingFallbacks()
+}
+
+// SetScenarioTracker sets the tracker used to verify scenario expectations
+func (p *PlaybackPlugin) SetScenarioTracker(tracker *scenario.Tracker) {
+	p.scenarioTracker = tracker
+}
+
+// GetScenarioTracker returns the scenario tracker, or nil if none is configured
+func (p *PlaybackPlugin) GetScenarioTracker() *scenario.Tracker {
+	return p.scenarioTracker
+}
+
+// SetClassifier sets the classifier that routes requests to policy bundles
+func (p *PlaybackPlugin) SetClassifier(classifier *classify.Classifier) {
+	p.classifier = classifier
+}
+
+// classify resolves the policy for a request, using the recorded Content-Type when available
+func (p *PlaybackPlugin) classify(f *proxy.Flow, transaction *types.PlaybackTransaction) *classify.Policy {
+	input := classify.Input{
+		Method: f.Request.Method,
+		URL:    f.Request.URL,
+		Header: f.Request.Header,
+	}
+	if transaction != nil {
+		input.ContentType = transaction.RawHeaders["Content-Type"]
+	}
+	return p.classifier.Classify(input)
+}
+
+// fallback returns how an unrecorded request to host is handled, and what decided it: the fallback
+// of its domain in the playback settings, else that of its policy
+func (p *PlaybackPlugin) fallback(host string, policy *classify.Policy) (string, string) {
+	if fallback := p.domainFallbacks.Fallback(host); fallback != "" {
+		return fallback, "the playback settings of " + host
+	}
+	return policy.Fallback, fmt.Sprintf("policy %q", policy.Name)
+}
+
+// GetNetworkController returns the controller of the active network conditions
+func (p *PlaybackPlugin) GetNetworkController() *network.Controller {
+	return p.networkController
+}
+
+// GetCalibrator returns the overhead calibrator, or nil if calibration is disabled
+func (p *PlaybackPlugin) GetCalibrator() *network.Calibrator {
+	return p.calibrator
+}
+
+func (p *PlaybackPlugin) ClientDisconnected(clientConn *proxy.ClientConn) {
+	p.tlsEmulator.forget(clientConn)
+}
+
+// Requestheaders remembers when the request arrived so pacing starts from there
+func (p *PlaybackPlugin) Requestheaders(f *proxy.Flow) {
+	p.requestStarts.Store(f, time.Now())
+
+	// Flows that never reach Request (e.g. streamed request bodies) must not leak
+	if done := f.Done(); done != nil {
+		go func() {
+			<-done
+			p.requestStarts.Delete(f)
+		}()
+	}
+}
+
+// requestStart returns when the request headers arrived, or now if unknown
+func (p *PlaybackPlugin) requestStart(f *proxy.Flow) time.Time {
+	now := time.Now()
+	value, ok := p.requestStarts.LoadAndDelete(f)
+	if !ok {
+		return now
+	}
+	start := value.(time.Time)
+	p.calibrator.ObserveRequest(now.Sub(start))
+	return start
+}
+
 func (p *PlaybackPlugin) Request(f *proxy.Flow) {
 	p.BaseLogPlugin.Request(f)
 
+	startTime := p.requestStart(f)
+
 	if f.Request == nil {
 		return
 	}
 
-	key := fmt.Sprintf("%s:%s", f.Request.Method, f.Request.URL.String())
-	
+	if p.maxHeaderBytes > 0 {
+		if size := headerBlockSize(f.Request.Header); size > p.maxHeaderBytes {
+			playbackLogger.Warn("Request headers over the limit", "url", f.Request.URL.String(), "size", size, "limit", p.maxHeaderBytes)
+			p.createErrorResponse(f, http.StatusRequestHeaderFieldsTooLarge, fmt.Sprintf("Request headers are %d bytes, over the limit of %d", size, p.maxHeaderBytes))
+			p.logAccess(f, accesslog.SourceHeaders)
+			return
+		}
+	}
+
+	if p.scenarioTracker != nil {
+		p.scenarioTracker.Observe(f.Request.Method, f.Request.URL, f.Request.Body)
+	}
+
+	// An offline profile drops every request with the connection, like an unplugged network
+	if p.networkController.Get().Offline() {
+		p.createErrorResponse(f, http.StatusServiceUnavailable, "Network is offline in the playback proxy profile")
+		p.logAccess(f, accesslog.SourceFault)
+		dropClientConnection(f)
+		return
+	}
+
+	// Inject faults configured in the active network conditions
+	if fault, ok := p.networkController.Fault(f.Request.URL.Hostname()); ok {
+		p.createErrorResponse(f, fault.Status, fmt.Sprintf("Fault injected by playback proxy (status %d)", fault.Status))
+		if fault.RetryAfterSeconds > 0 {
+			f.Response.Header.Set("Retry-After", strconv.Itoa(fault.RetryAfterSeconds))
+		}
+		p.logAccess(f, accesslog.SourceFault)
+		return
+	}
+
+	requestURL := f.Request.URL.String()
+	if recorded, ok := p.hostMap.Recorded(requestURL); ok {
+		requestURL = recorded
+	}
+
 	p.mutex.RLock()
-	transaction, exists := p.transactionMap[key]
+	key := p.recordedKey(f.Request.Method, requestURL)
+	state, exists := p.transactionMap[key]
+	if bodies, ok := p.requestBodies[key]; ok && p.matchRequestBody {
+		state, exists = bodies[requestBodyHash(f.Request)]
+	}
+	if locales, ok := p.localeMap[key]; ok && exists && state.RequestBodySHA256 == locales[0].RequestBodySHA256 {
+		preferred := p.language
+		if preferred == "" {
+			preferred = f.Request.Header.Get("Accept-Language")
+		}
+		if locale := selectLocale(locales, preferred); locale != nil {
+			state = locale
+		}
+	}
+	if variants, ok := p.variantMap[key]; ok {
+		if variant := selectVariant(variants, f.Request.Header.Get("Accept")); variant != nil {
+			state = variant
+		}
+	}
+	if p.matchPrefetch && fetchMetadata(f.Request.Header).IsPrefetch() {
+		if prefetch, ok := p.prefetchMap[key]; ok {
+			state, exists = prefetch, true
+		}
+	}
+	if cycle, ok := p.repeats[state]; ok && exists {
+		state = cycle.next(p.roundRobin)
+	}
 	p.mutex.RUnlock()
 
+	var transaction *types.PlaybackTransaction
 	if exists {
-		slog.Debug("Found matching transaction", "key", key)
+		transaction = state.PlaybackTransaction
+	}
+
+	policy := p.classify(f, transaction)
+
+	if exists && state.checksumMismatch() {
+		if p.checksumMode == inventory.ChecksumFail {
+			p.createErrorResponse(f, http.StatusInternalServerError, fmt.Sprintf("Content of %s does not match its recorded checksum", transaction.URL))
+			p.logAccess(f, accesslog.SourceChecksum)
+			return
+		}
+		playbackLogger.Warn("Serving content that does not match its recorded checksum", "url", transaction.URL)
+	}
+
+	if exists {
+		playbackLogger.Debug("Found matching transaction", "key", key, "policy", policy.Name)
 		// Playback from recorded transaction
-		p.playbackTransaction(f, transaction)
+		p.playbackTransaction(f, state, policy, startTime)
+		p.logAccess(f, accesslog.SourceInventory)
+	} else if status := builtinFallback(f.Request); status != 0 && p.builtinFallbacks {
+		p.createBuiltinResponse(f, status)
+		p.logAccess(f, accesslog.SourceBuiltin)
+	} else if p.strictStatus != 0 {
+		playbackLogger.Warn("Request not recorded, refused in strict mode", "method", f.Request.Method, "url", f.Request.URL.String())
+		p.createStrictResponse(f, "strict mode")
+		p.logAccess(f, accesslog.SourceBlocked)
+		p.dumpMiss(f, "request not recorded and upstream disabled by strict mode")
+	} else if fallback, source := p.fallback(f.Request.URL.Hostname(), policy); fallback == classify.FallbackReplayOnly {
+		playbackLogger.Warn("Request not recorded, refused as replay-only", "method", f.Request.Method, "url", f.Request.URL.String(), "by", source)
+		p.createStrictResponse(f, classify.FallbackReplayOnly)
+		p.logAccess(f, accesslog.SourceBlocked)
+		p.dumpMiss(f, "request not recorded and upstream disabled by "+source)
+	} else if fallback == classify.FallbackBlock {
+		playbackLogger.Debug("No matching transaction, upstream blocked", "key", key, "by", source)
+		p.createErrorResponse(f, http.StatusGatewayTimeout, "Request not recorded and upstream blocked by "+source)
+		p.logAccess(f, accesslog.SourceBlocked)
+		p.dumpMiss(f, "request not recorded and upstream blocked by "+source)
 	} else {
-		slog.Debug("No matching transaction, proxying upstream", "key", key)
+		playbackLogger.Debug("No matching transaction, proxying upstream", "key", key)
 		// Also log some available keys for debugging
 		p.mutex.RLock()
 		count := 0
 		for availableKey := range p.transactionMap {
 			if count < 3 { // Show first 3 keys for debugging
-				slog.Debug("Available key", "key", availableKey)
+				playbackLogger.Debug("Available key", "key", availableKey)
 				count++
 			}
 		}
 		p.mutex.RUnlock()
 		// Proxy to upstream server
 		p.proxyUpstream(f)
+		p.logAccess(f, accesslog.SourceUpstream)
 	}
 }
 
+// recordedKey returns the key of the recorded transaction answering a request: the request's own
+// key, or that of the recording whose URL normalizes to the same. The caller holds the mutex.
+func (p *PlaybackPlugin) recordedKey(method, rawURL string) string {
+	key := fmt.Sprintf("%s:%s", method, rawURL)
+	if _, exists := p.transactionMap[key]; exists || p.urlMatcher == nil {
+		return key
+	}
+	if recorded, ok := p.matchedKeys[p.urlMatcher.Key(method, rawURL)]; ok {
+		playbackLogger.Debug("Matched a recording by normalized URL", "url", rawURL, "recorded", recorded)
+		return recorded
+	}
+	return key
+}
+
 // playbackTransaction replays a recorded transaction with timing control
-func (p *PlaybackPlugin) playbackTransaction(f *proxy.Flow, transaction *types.PlaybackTransaction) {
-	startTime := time.Now()
+// startTime is when the request arrived; the proxy's own overhead is compensated by the calibrator.
+func (p *PlaybackPlugin) playbackTransaction(f *proxy.Flow, state *transactionState, policy *classify.Policy, startTime time.Time) {
+	transaction := state.PlaybackTransaction
+	immediate := policy != nil && policy.Timing == classify.TimingImmediate
+	if policy != nil && policy.Templating {
+		transaction = p.templated(f, state)
+	}
 	
-	slog.Debug("Replaying",
+	playbackLogger.Debug("Replaying",
 		"method", transaction.Method,
 		"url", transaction.URL,
-		"ttfb", transaction.TTFB)
+		"ttfb", transaction.TTFB,
+		"immediate", immediate,
+		"hit", state.begin())
+	if client := inventory.ParseProtocol(f.Request.Proto); client != "" && transaction.Protocol != "" && client != transaction.Protocol {
+		// go-mitmproxy offers clients the protocol it negotiated upstream; the recorded protocol is not reproduced
+		playbackLogger.Debug("Client protocol differs from the recording", "url", transaction.URL, "client", client, "recorded", transaction.Protocol)
+	}
+
+	// Requests over the recorded concurrency of the host wait for a slot; the recorded timing
+	// starts once they get one
+	release := func() {}
+	scheduleStart := startTime
+	if !immediate {
+		var queued bool
+		release, queued = p.concurrency.acquire(f)
+		if queued {
+			scheduleStart = time.Now()
+		}
+	}
+
+	// The connection setup the origin needed delays everything the response sends, bodyless or not
+	conditions := p.networkController.Get().ForCacheStatus(transaction.CacheStatus)
+	setup := p.tlsEmulator.delay(f) + p.connectEmulator.delay(f)
+	if immediate {
+		setup = 0
+	}
+	setup = time.Duration(float64(setup) / conditions.SpeedFactor)
+	// Fault delays (e.g. the origin-slow preset) hold back the first byte of every matching response
+	if delay := p.networkController.Delay(f.Request.URL.Hostname(), transaction.RawHeaders["Content-Type"]); delay > 0 && !immediate {
+		setup += delay
+	}
+
+	// Interim responses precede the final response at their recorded offsets
+	p.writeInformational(f, transaction, scheduleStart.Add(setup), immediate)
 
 	// Create response
 	response := &proxy.Response{
@@ -154,95 +731,144 @@ func (p *PlaybackPlugin) playbackTransaction(f *proxy.Flow, transaction *types.P
 		response.Header.Set(name, value)
 	}
 
+	// Responses recorded under a mapped host point back at the requested one
+	if p.hostMap != nil {
+		remapHeaders(response.Header, transaction.URL, f.Request.URL)
+	}
+
 	// Add playback indicator header
 	response.Header.Set("x-playback-proxy", "1")
 
-	// Handle response body with timing
+	// Stream the body with timing; the first chunk is awaited here so headers leave at the recorded TTFB.
+	// Streams open at their TTFB instead, and their parts follow as they were received.
+	var body *pacedBody
+	completeAt := time.Now()
 	if len(transaction.Chunks) > 0 {
-		// Process chunks with timing consideration (TTFB timing is handled per chunk)
-		var bodyBuffer bytes.Buffer
-		requestStartTime := startTime // リクエスト開始時刻
-		
-		for i, chunk := range transaction.Chunks {
-			// Calculate when this chunk should be sent based on request start time
-			var targetSendTime time.Time
-			if chunk.TargetOffset > 0 {
-				// Use TargetOffset for precise timing from request start
-				targetSendTime = requestStartTime.Add(chunk.TargetOffset)
-			} else {
-				// Fallback: use TTFB for first chunk, or proportional timing for others
-				if i == 0 {
-					targetSendTime = requestStartTime.Add(transaction.TTFB)
-				} else {
-					// For backward compatibility, calculate proportional timing
-					proportionalDelay := transaction.TTFB + time.Duration(i)*50*time.Millisecond
-					targetSendTime = requestStartTime.Add(proportionalDelay)
-				}
-			}
-			
-			// Check if we need to wait
-			now := time.Now()
-			if now.Before(targetSendTime) {
-				waitTime := targetSendTime.Sub(now)
-				slog.Debug("Waiting for chunk",
-					"wait_time", waitTime,
-					"chunk", fmt.Sprintf("%d/%d", i+1, len(transaction.Chunks)),
-					"url", transaction.URL,
-					"offset", chunk.TargetOffset)
-				time.Sleep(waitTime)
-			} else {
-				slog.Debug("Target time already passed",
-					"chunk", fmt.Sprintf("%d/%d", i+1, len(transaction.Chunks)),
-					"url", transaction.URL,
-					"behind_by", now.Sub(targetSendTime),
-					"offset", chunk.TargetOffset)
+		// Apply the active network conditions to the recorded schedule
+		recordedOffsets, sizes := chunkSchedule(transaction)
+		streamed := transaction.Streamed
+		if streamed {
+			recordedOffsets = append([]time.Duration{transaction.TTFB}, recordedOffsets...)
+			sizes = append([]int{0}, sizes...)
+		}
+		offsets := p.calibrator.Compensate(conditions.Schedule(transaction.TTFB, recordedOffsets, sizes))
+		if setup > 0 {
+			for i := range offsets {
+				offsets[i] += setup
 			}
-			
-			// Add chunk to body buffer
-			bodyBuffer.Write(chunk.Chunk)
+		}
+		var opened time.Duration
+		if streamed {
+			opened, offsets = offsets[0], offsets[1:]
+		}
+		if scheduled := scheduleStart.Add(offsets[len(offsets)-1]); !immediate && scheduled.After(completeAt) {
+			completeAt = scheduled
 		}
 
-		response.Body = bodyBuffer.Bytes()
-		slog.Debug("Combined chunks",
-			"chunks", len(transaction.Chunks),
-			"bytes", bodyBuffer.Len(),
-			"url", transaction.URL)
-	} else {
-		response.Body = []byte{}
+		body = newPacedBody(transaction, offsets, scheduleStart, immediate)
+		body.events = &p.chunkEvents
+		if streamed {
+			body.waitOpen(opened)
+		} else {
+			body.waitFirstChunk()
+		}
+		response.BodyReader = body
+	} else if setup > 0 {
+		completeAt = scheduleStart.Add(setup)
+		time.Sleep(time.Until(completeAt))
+	}
+	if p.completeAtHeader {
+		response.Header.Set(CompleteAtHeader, completeAt.UTC().Format(time.RFC3339Nano))
 	}
 
 	// Set the response
 	f.Response = response
+	var length int64
+	for _, chunk := range transaction.Chunks {
+		length += int64(len(chunk.Chunk))
+	}
+	finalizeResponse(f, length, string(transaction.ContentEncoding))
+	p.finishReplay(f, state, body, startTime, release)
+}
 
-	elapsed := time.Since(startTime)
-	
-	// Record metrics
-	if globalMetrics != nil {
-		globalMetrics.RecordRequest(transaction.Method, transaction.URL, elapsed, transaction.StatusCode != nil && *transaction.StatusCode < 400)
-		if len(transaction.Chunks) > 0 {
-			totalBytes := 0
-			for _, chunk := range transaction.Chunks {
-				totalBytes += len(chunk.Chunk)
+// finishReplay records metrics and the proxy's own overhead once the response has been written,
+// then releases the concurrency slot of the replay. The overhead is measured from the last body
+// hand-over, so time spent pacing or waiting for a slow client is not counted.
+func (p *PlaybackPlugin) finishReplay(f *proxy.Flow, state *transactionState, body *pacedBody, startTime time.Time, release func()) {
+	transaction := state.PlaybackTransaction
+	handedOver := time.Now()
+	finish := func() {
+		release()
+		elapsed := time.Since(startTime)
+
+		var played int64
+		if body != nil {
+			played = int64(body.size())
+		}
+		state.end(played)
+
+		if globalMetrics != nil {
+			globalMetrics.RecordRequest(transaction.Method, transaction.URL, elapsed, transaction.StatusCode != nil && *transaction.StatusCode < 400)
+			if body != nil {
+				globalMetrics.RecordBytesPlayed(played)
 			}
-			globalMetrics.RecordBytesPlayed(int64(totalBytes))
 		}
+
+		playbackLogger.Debug("Completed replay",
+			"method", transaction.Method,
+			"url", transaction.URL,
+			"duration", elapsed)
 	}
-	
-	slog.Debug("Completed replay",
-		"method", transaction.Method,
-		"url", transaction.URL,
-		"duration", elapsed)
+
+	done := f.Done()
+	if done == nil {
+		finish()
+		return
+	}
+	go func() {
+		<-done
+		if p.calibrator != nil {
+			if body != nil {
+				if last := body.lastHandover(); !last.IsZero() {
+					handedOver = last
+				}
+			}
+			p.calibrator.ObserveResponse(time.Since(handedOver))
+		}
+		finish()
+	}()
+}
+
+// chunkSchedule returns the recorded send offset and size of each chunk
+func chunkSchedule(transaction *types.PlaybackTransaction) ([]time.Duration, []int) {
+	offsets := make([]time.Duration, len(transaction.Chunks))
+	sizes := make([]int, len(transaction.Chunks))
+
+	for i, chunk := range transaction.Chunks {
+		sizes[i] = len(chunk.Chunk)
+		if chunk.TargetOffset > 0 {
+			// Use TargetOffset for precise timing from request start
+			offsets[i] = chunk.TargetOffset
+		} else if i == 0 {
+			// Fallback: use TTFB for first chunk
+			offsets[i] = transaction.TTFB
+		} else {
+			// For backward compatibility, calculate proportional timing
+			offsets[i] = transaction.TTFB + time.Duration(i)*50*time.Millisecond
+		}
+	}
+
+	return offsets, sizes
 }
 
 // proxyUpstream forwards the request to the upstream server
 func (p *PlaybackPlugin) proxyUpstream(f *proxy.Flow) {
 	startTime := time.Now()
-	slog.Debug("Proxying upstream", "method", f.Request.Method, "url", f.Request.URL.String())
+	playbackLogger.Debug("Proxying upstream", "method", f.Request.Method, "url", f.Request.URL.String())
 
-	// Create HTTP client with our transport
+	// Create HTTP client with our transport; the body is streamed, so only the headers have a deadline
 	client := &http.Client{
 		Transport: p.upstreamTransport,
-		Timeout:   30 * time.Second,
 	}
 
 	// Create request body reader
@@ -265,6 +891,11 @@ func (p *PlaybackPlugin) proxyUpstream(f *proxy.Flow) {
 		}
 	}
 
+	var miss *pendingMiss
+	if p.misses != nil {
+		miss, req = p.misses.start(f, req, startTime)
+	}
+
 	// Send request
 	resp, err := client.Do(req)
 	if err != nil {
@@ -275,33 +906,45 @@ func (p *PlaybackPlugin) proxyUpstream(f *proxy.Flow) {
 		return
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
-	resp.Body.Close()
-	if err != nil {
-		p.createErrorResponse(f, 502, fmt.Sprintf("Failed to read upstream response: %v", err))
-		return
-	}
-
-	// Create proxy response
+	// Pass the body on as it arrives, so streams and slow origins reach the client as they do without the proxy
 	response := &proxy.Response{
 		StatusCode: resp.StatusCode,
 		Header:     resp.Header,
-		Body:       body,
+		BodyReader: &flushedBody{body: resp.Body},
+	}
+	if miss != nil {
+		response.BodyReader = &flushedBody{body: miss.capture(resp)}
 	}
 
 	// Set response
 	f.Response = response
-	
-	// Record metrics for upstream requests
-	if globalMetrics != nil {
-		globalMetrics.RecordRequest(f.Request.Method, f.Request.URL.String(), time.Since(startTime), resp.StatusCode < 400)
-	}
-	
-	slog.Debug("Upstream response",
+	finalizeResponse(f, resp.ContentLength, resp.Header.Get("Content-Encoding"))
+
+	playbackLogger.Debug("Upstream response",
 		"method", f.Request.Method,
 		"url", f.Request.URL.String(),
 		"status", resp.StatusCode)
+
+	// Record metrics for upstream requests once the body is passed on
+	record := func() {
+		if globalMetrics != nil {
+			globalMetrics.RecordRequest(f.Request.Method, f.Request.URL.String(), time.Since(startTime), resp.StatusCode < 400)
+		}
+	}
+	done := f.Done()
+	if done == nil {
+		// Without a flow to wait for, the body closes itself once read to the end
+		record()
+		return
+	}
+	go func() {
+		<-done
+		resp.Body.Close()
+		record()
+		if miss != nil {
+			p.recordMiss(f, miss)
+		}
+	}()
 }
 
 // createErrorResponse creates an error response
@@ -314,8 +957,32 @@ func (p *PlaybackPlugin) createErrorResponse(f *proxy.Flow, statusCode int, mess
 
 	response.Header.Set("Content-Type", "text/plain")
 	f.Response = response
+	finalizeResponse(f, int64(len(response.Body)), "")
+
+	playbackLogger.Error("Error response", "status", statusCode, "message", message)
+}
+
+// dropClientConnection closes the connection of the client, so the request fails with a network
+// error; the response set on the flow is only seen if the connection cannot be closed
+func dropClientConnection(f *proxy.Flow) {
+	if f.ConnContext == nil || f.ConnContext.ClientConn == nil || f.ConnContext.ClientConn.Conn == nil {
+		return
+	}
+	f.ConnContext.ClientConn.Conn.Close()
+}
 
-	slog.Error("Error response", "status", statusCode, "message", message)
+// finalizeResponse makes the framing headers agree with the body after all header rewrites,
+// logging every header that disagreed
+func finalizeResponse(f *proxy.Flow, length int64, encoding string) {
+	violations := httputil.Finalize(f.Response.Header, httputil.Framing{
+		Method:   f.Request.Method,
+		Status:   f.Response.StatusCode,
+		Length:   length,
+		Encoding: encoding,
+	})
+	for _, violation := range violations {
+		playbackLogger.Warn("Inconsistent response headers", "url", f.Request.URL.String(), "fix", violation)
+	}
 }
 
 // GetTransactionCount returns the number of loaded transactions
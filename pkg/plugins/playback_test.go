@@ -1,17 +1,33 @@
 package plugins
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 	
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/accesslog"
+	"go-http-playback-proxy/pkg/classify"
+	"go-http-playback-proxy/pkg/dump"
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/httputil"
 	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/network"
 	"go-http-playback-proxy/pkg/testutil"
 	"go-http-playback-proxy/pkg/types"
+	"go-http-playback-proxy/pkg/urlmatch"
+	"go-http-playback-proxy/pkg/websocket"
 )
 
 // TestPlaybackPlugin_LoadInventory tests loading inventory from file
@@ -60,7 +76,7 @@ func TestPlaybackPlugin_LoadInventory(t *testing.T) {
 	// Create playback plugin
 	plugin := &PlaybackPlugin{
 		inventoryDir:      tempDir,
-		transactionMap:    make(map[string]*types.PlaybackTransaction),
+		transactionMap:    make(map[string]*transactionState),
 		playbackManager:   inventory.NewPlaybackManager(tempDir),
 		upstreamTransport: &http.Transport{},
 	}
@@ -113,7 +129,7 @@ func TestPlaybackPlugin_NoInventory(t *testing.T) {
 	// Create playback plugin - no inventory exists
 	plugin := &PlaybackPlugin{
 		inventoryDir:      tempDir,
-		transactionMap:    make(map[string]*types.PlaybackTransaction),
+		transactionMap:    make(map[string]*transactionState),
 		playbackManager:   inventory.NewPlaybackManager(tempDir),
 		upstreamTransport: &http.Transport{},
 	}
@@ -130,3 +146,1745 @@ func TestPlaybackPlugin_NoInventory(t *testing.T) {
 	}
 }
 
+
+// TestPlaybackPlugin_PolicyBlocksFallback tests that a blocking policy answers unrecorded requests locally
+func TestPlaybackPlugin_PolicyBlocksFallback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	classifier, err := classify.New(classify.Config{
+		Policies: []classify.Policy{{Name: "api", Fallback: classify.FallbackBlock}},
+		Rules:    []classify.Rule{{Policy: "api", Paths: []string{"/api/*"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	plugin := &PlaybackPlugin{
+		inventoryDir:      tempDir,
+		transactionMap:    make(map[string]*transactionState),
+		playbackManager:   inventory.NewPlaybackManager(tempDir),
+		upstreamTransport: &http.Transport{},
+	}
+	plugin.SetClassifier(classifier)
+
+	flow := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "GET",
+			URL:    parseURL(t, "https://example.com/api/missing"),
+			Header: make(http.Header),
+		},
+	}
+	plugin.Request(flow)
+
+	if flow.Response == nil {
+		t.Fatal("Expected a local response for blocked request")
+	}
+	if flow.Response.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, flow.Response.StatusCode)
+	}
+}
+
+// TestPlaybackPlugin_Templating tests that templating policies execute recorded bodies with the request
+func TestPlaybackPlugin_Templating(t *testing.T) {
+	body, err := encoding.EncodeData([]byte(`{"id": "{{.Query.Get "id"}}", "method": "{{.Method}}", "user": "{{.Header.Get "X-User"}}"}`), types.ContentEncodingGzip, 6)
+	if err != nil {
+		t.Fatalf("Failed to encode body: %v", err)
+	}
+	half := len(body) / 2
+	state := newTransactionState(&types.PlaybackTransaction{
+		Method: "GET",
+		URL:    "https://example.com/api/item",
+		Chunks: []types.BodyChunk{
+			{Chunk: body[:half], TargetOffset: 10 * time.Millisecond},
+			{Chunk: body[half:], TargetOffset: 30 * time.Millisecond},
+		},
+		ContentEncoding: types.ContentEncodingGzip,
+	})
+	flow := &proxy.Flow{Request: &proxy.Request{
+		Method: "GET",
+		URL:    parseURL(t, "https://example.com/api/item?id=42"),
+		Header: http.Header{"X-User": {"alice"}},
+	}}
+
+	plugin := &PlaybackPlugin{}
+	templated := plugin.templated(flow, state)
+	if len(templated.Chunks) != 2 || templated.Chunks[1].TargetOffset != 30*time.Millisecond {
+		t.Fatalf("Expected the recorded chunk timing to be kept, got %+v", templated.Chunks)
+	}
+	var rendered []byte
+	for _, chunk := range templated.Chunks {
+		rendered = append(rendered, chunk.Chunk...)
+	}
+	decoded, err := encoding.DecodeData(rendered, types.ContentEncodingGzip)
+	if err != nil {
+		t.Fatalf("Failed to decode templated body: %v", err)
+	}
+	if string(decoded) != `{"id": "42", "method": "GET", "user": "alice"}` {
+		t.Errorf("Unexpected templated body: %s", decoded)
+	}
+	if state.Chunks[0].TargetOffset != 10*time.Millisecond || len(state.Chunks[0].Chunk) != half {
+		t.Error("Expected the loaded transaction to be left untouched")
+	}
+
+	// A body that is not a template is served as recorded
+	broken := newTransactionState(&types.PlaybackTransaction{
+		Method: "GET",
+		URL:    "https://example.com/api/broken",
+		Chunks: []types.BodyChunk{{Chunk: []byte(`{"a": "{{"}`)}},
+	})
+	if plugin.templated(flow, broken) != broken.PlaybackTransaction {
+		t.Error("Expected an invalid template to be served as recorded")
+	}
+}
+
+// TestPlaybackPlugin_DumpsBlockedMiss tests that a blocked miss writes a diagnostic bundle
+func TestPlaybackPlugin_DumpsBlockedMiss(t *testing.T) {
+	tempDir := t.TempDir()
+	dumpDir := filepath.Join(tempDir, "dumps")
+
+	classifier, err := classify.New(classify.Config{
+		Default:  "strict",
+		Policies: []classify.Policy{{Name: "strict", Fallback: classify.FallbackBlock}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	plugin := &PlaybackPlugin{
+		transactionMap: map[string]*transactionState{
+			"GET:https://example.com/api/items?page=1": newTransactionState(&types.PlaybackTransaction{Method: "GET", URL: "https://example.com/api/items?page=1"}),
+			"GET:https://example.com/style.css":        newTransactionState(&types.PlaybackTransaction{Method: "GET", URL: "https://example.com/style.css"}),
+		},
+		recent: accesslog.NewRing(10),
+		dumps:  dump.NewWriter(dumpDir),
+	}
+	plugin.SetClassifier(classifier)
+
+	flow := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "POST",
+			URL:    parseURL(t, "https://example.com/api/items?page=2"),
+			Header: http.Header{"Content-Type": []string{"application/json"}},
+			Body:   []byte(`{"q":"shoes"}`),
+		},
+	}
+	plugin.Request(flow)
+
+	files, err := filepath.Glob(filepath.Join(dumpDir, "*-miss.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one miss bundle, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	var bundle dump.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("Failed to parse bundle: %v", err)
+	}
+
+	if bundle.Request == nil || bundle.Request.Body != `{"q":"shoes"}` {
+		t.Errorf("Expected the request body in the bundle, got %+v", bundle.Request)
+	}
+	if len(bundle.NearestKeys) == 0 || bundle.NearestKeys[0] != "GET:https://example.com/api/items?page=1" {
+		t.Errorf("Expected the most similar key first, got %v", bundle.NearestKeys)
+	}
+	if len(bundle.Recent) != 1 || bundle.Recent[0].Source != accesslog.SourceBlocked || bundle.Recent[0].Status != http.StatusGatewayTimeout {
+		t.Errorf("Expected the blocked request in the recent requests, got %+v", bundle.Recent)
+	}
+}
+
+// TestPlaybackPlugin_DumpRedaction tests that diagnostic bundles are redacted like the inventory
+func TestPlaybackPlugin_DumpRedaction(t *testing.T) {
+	tempDir := t.TempDir()
+	redaction, err := inventory.NewRedaction(&inventory.Redaction{
+		QueryParams: []string{"token"},
+		Bodies:      []inventory.BodyRule{{JSONPaths: []string{"$.password"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create redaction: %v", err)
+	}
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true, Redaction: redaction})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}}}
+	recorder.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+	recorder.Response(flow)
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	dumpDir := filepath.Join(tempDir, "dumps")
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{Strict: true, DumpDir: dumpDir})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	plugin.Request(&proxy.Flow{Request: &proxy.Request{
+		Method: "POST",
+		URL:    parseURL(t, "https://example.com/login?token=secret&next=home"),
+		Header: http.Header{"Content-Type": {"application/json"}, "Authorization": {"Bearer secret"}},
+		Body:   []byte(`{"user":"alice","password":"secret"}`),
+	}})
+
+	files, err := filepath.Glob(filepath.Join(dumpDir, "*-miss.json"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one miss bundle, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("Expected the credentials to be redacted from the bundle:\n%s", data)
+	}
+	var bundle dump.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("Failed to parse bundle: %v", err)
+	}
+	if bundle.Request == nil || bundle.Request.URL != "https://example.com/login?next=home" || !strings.Contains(bundle.Request.Body, "alice") {
+		t.Errorf("Expected the rest of the request to be kept, got %+v", bundle.Request)
+	}
+}
+
+// TestPlaybackPlugin_TimingFromRequestHeaders tests that pacing starts when request headers arrive
+func TestPlaybackPlugin_TimingFromRequestHeaders(t *testing.T) {
+	plugin := &PlaybackPlugin{
+		transactionMap: map[string]*transactionState{
+			"GET:https://example.com/slow": newTransactionState(&types.PlaybackTransaction{
+				Method: "GET",
+				URL:    "https://example.com/slow",
+				TTFB:   100 * time.Millisecond,
+				Chunks: []types.BodyChunk{{Chunk: []byte("ok"), TargetOffset: 100 * time.Millisecond}},
+			}),
+		},
+		calibrator: network.NewCalibrator(),
+	}
+
+	flow := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "GET",
+			URL:    parseURL(t, "https://example.com/slow"),
+			Header: make(http.Header),
+		},
+	}
+
+	start := time.Now()
+	plugin.Requestheaders(flow)
+	// Simulate time spent reading the request body before the Request hook
+	time.Sleep(40 * time.Millisecond)
+	plugin.Request(flow)
+	elapsed := time.Since(start)
+
+	if flow.Response == nil {
+		t.Fatal("Expected a replayed response")
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 130*time.Millisecond {
+		t.Errorf("Expected response about 100ms after request headers, got %v", elapsed)
+	}
+	if stats := plugin.GetCalibrator().Stats(); stats.RequestOverheadMS < 40 {
+		t.Errorf("Expected request overhead of at least 40ms, got %v", stats.RequestOverheadMS)
+	}
+}
+
+// TestPlaybackPlugin_FaultDelayBodyless tests that a fault delay holds back HTML responses without a
+// body, such as redirects, like those with one
+func TestPlaybackPlugin_FaultDelayBodyless(t *testing.T) {
+	controller, err := network.NewController(network.Conditions{
+		SpeedFactor: 1,
+		Faults:      []network.FaultRule{{Rate: 1, DelayMS: 100, ContentTypes: []string{"text/html"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create network controller: %v", err)
+	}
+	status := http.StatusFound
+	plugin := &PlaybackPlugin{
+		transactionMap: map[string]*transactionState{
+			"GET:https://example.com/login": newTransactionState(&types.PlaybackTransaction{
+				Method:     "GET",
+				URL:        "https://example.com/login",
+				StatusCode: &status,
+				RawHeaders: types.HttpHeaders{"Content-Type": "text/html; charset=utf-8", "Location": "/home"},
+			}),
+		},
+		networkController: controller,
+	}
+
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/login"), Header: make(http.Header)}}
+	start := time.Now()
+	plugin.Request(flow)
+	elapsed := time.Since(start)
+
+	if flow.Response == nil || flow.Response.StatusCode != http.StatusFound {
+		t.Fatalf("Expected the recorded redirect, got %+v", flow.Response)
+	}
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("Expected the redirect to be delayed by 100ms, got %v", elapsed)
+	}
+}
+
+// TestPlaybackPlugin_Routes tests that the plan resolves policies and timing per resource
+func TestPlaybackPlugin_Routes(t *testing.T) {
+	classifier, err := classify.New(classify.Config{
+		Policies: []classify.Policy{{Name: "images", Timing: classify.TimingImmediate}},
+		Rules:    []classify.Rule{{Policy: "images", ContentTypes: []string{"image/*"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	plugin := &PlaybackPlugin{
+		transactionMap: map[string]*transactionState{
+			"GET:https://example.com/logo.png": newTransactionState(&types.PlaybackTransaction{
+				Method:     "GET",
+				URL:        "https://example.com/logo.png",
+				TTFB:       80 * time.Millisecond,
+				RawHeaders: types.HttpHeaders{"Content-Type": "image/png"},
+				Chunks:     []types.BodyChunk{{Chunk: []byte("png")}},
+			}),
+			"GET:https://example.com/": newTransactionState(&types.PlaybackTransaction{
+				Method:     "GET",
+				URL:        "https://example.com/",
+				TTFB:       120 * time.Millisecond,
+				StatusCode: testutil.IntPtr(404),
+				RawHeaders: types.HttpHeaders{"Content-Type": "text/html"},
+			}),
+		},
+	}
+	plugin.SetClassifier(classifier)
+
+	routes := plugin.Routes()
+	if len(routes) != 2 {
+		t.Fatalf("Expected 2 routes, got %d", len(routes))
+	}
+	if routes[0].URL != "https://example.com/" || routes[0].Policy != classify.DefaultPolicyName || routes[0].TTFB != 120*time.Millisecond || routes[0].Status != 404 {
+		t.Errorf("Unexpected route for page: %+v", routes[0])
+	}
+	if routes[1].Policy != "images" || routes[1].TTFB != 0 || routes[1].Bytes != 3 || routes[1].Status != 200 {
+		t.Errorf("Unexpected route for image: %+v", routes[1])
+	}
+}
+
+// TestPacedBody_SlowReader tests that a slow client delays the schedule instead of buffering chunks
+func TestPacedBody_SlowReader(t *testing.T) {
+	transaction := &types.PlaybackTransaction{
+		URL: "https://example.com/large",
+		Chunks: []types.BodyChunk{
+			{Chunk: []byte("aaaa")},
+			{Chunk: []byte("bbbb")},
+			{Chunk: []byte("cccc")},
+		},
+	}
+	offsets := []time.Duration{0, 20 * time.Millisecond, 40 * time.Millisecond}
+	start := time.Now()
+	body := newPacedBody(transaction, offsets, start, false)
+
+	// Reads smaller than a chunk never hold more than the rest of the current chunk
+	buf := make([]byte, 2)
+	if n, err := body.Read(buf); n != 2 || err != nil || string(buf) != "aa" {
+		t.Fatalf("Expected first 2 bytes, got %q (%v)", buf[:n], err)
+	}
+
+	// A client that stalls past the schedule receives the late chunks without further waiting
+	time.Sleep(60 * time.Millisecond)
+	rest, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	if string(rest) != "aabbbbcccc" {
+		t.Errorf("Expected remaining body, got %q", rest)
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Errorf("Expected late chunks to be sent immediately, took %v", elapsed)
+	}
+
+	// A fast reader is held back by the schedule
+	start = time.Now()
+	body = newPacedBody(transaction, offsets, start, false)
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected the schedule to take at least 40ms, took %v", elapsed)
+	}
+}
+
+// TestPacedBody_FlushesEvents tests that small chunks reach the client when due rather than when the
+// response ends
+func TestPacedBody_FlushesEvents(t *testing.T) {
+	transaction := &types.PlaybackTransaction{
+		URL: "https://example.com/events",
+		Chunks: []types.BodyChunk{
+			{Chunk: []byte("data: first\n\n")},
+			{Chunk: []byte("data: second\n\n")},
+		},
+	}
+	offsets := []time.Duration{0, 300 * time.Millisecond}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.Copy(w, newPacedBody(transaction, offsets, time.Now(), false))
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "data: first\n" {
+		t.Fatalf("Unexpected first event: %q (%v)", line, err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected the first event before the second was due, got it after %v", elapsed)
+	}
+
+	rest, _ := io.ReadAll(reader)
+	if string(rest) != "\ndata: second\n\n" {
+		t.Errorf("Unexpected rest of the stream: %q", rest)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("Expected the second event at its offset, got it after %v", elapsed)
+	}
+}
+
+// TestPlaybackPlugin_StreamsThroughProxy tests that replayed chunks reach a client of the proxy at
+// their offsets instead of all at once when the response ends, and that upstream responses are passed
+// on as they arrive
+func TestPlaybackPlugin_StreamsThroughProxy(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "first\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(400 * time.Millisecond)
+		fmt.Fprint(w, "second\n")
+	}))
+	defer origin.Close()
+
+	const target = "http://example.com/slow.txt"
+	plugin := &PlaybackPlugin{transactionMap: make(map[string]*transactionState), upstreamTransport: &http.Transport{}}
+	plugin.transactionMap["GET:"+target] = newTransactionState(&types.PlaybackTransaction{
+		Method:     "GET",
+		URL:        target,
+		RawHeaders: types.HttpHeaders{"Content-Type": "text/plain"},
+		Chunks: []types.BodyChunk{
+			{Chunk: []byte("first\n"), TargetOffset: 10 * time.Millisecond},
+			{Chunk: []byte("second\n"), TargetOffset: 400 * time.Millisecond},
+		},
+	})
+
+	addr, err := httputil.FreeLoopbackAddr()
+	if err != nil {
+		t.Fatalf("Failed to allocate address: %v", err)
+	}
+	p, err := httputil.CreateProxy(&httputil.ProxyOptions{Addr: addr, SslInsecure: true, CaRootPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	p.AddAddon(plugin)
+	go p.Start()
+	defer p.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(parseURL(t, "http://"+addr))}}
+	for _, u := range []string{target, origin.URL + "/unrecorded"} {
+		var resp *http.Response
+		start := time.Now()
+		for i := 0; i < 50; i++ {
+			if resp, err = client.Get(u); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+			start = time.Now()
+		}
+		if err != nil {
+			t.Fatalf("Request through the proxy failed: %v", err)
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		if line, err := reader.ReadString('\n'); err != nil || line != "first\n" {
+			t.Fatalf("%s: unexpected first chunk: %q (%v)", u, line, err)
+		}
+		if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+			t.Errorf("%s: expected the first chunk before the second was due, got it after %v", u, elapsed)
+		}
+		if line, err := reader.ReadString('\n'); err != nil || line != "second\n" {
+			t.Fatalf("%s: unexpected second chunk: %q (%v)", u, line, err)
+		}
+		if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+			t.Errorf("%s: expected the second chunk at its offset, got it after %v", u, elapsed)
+		}
+		resp.Body.Close()
+	}
+}
+
+// TestPacedBody_ChunkEvents tests that subscribers see each chunk with its scheduled and sent times
+func TestPacedBody_ChunkEvents(t *testing.T) {
+	plugin := &PlaybackPlugin{}
+	var events []ChunkEvent
+	unsubscribe := plugin.SubscribeChunks(func(event ChunkEvent) {
+		events = append(events, event)
+	})
+
+	transaction := &types.PlaybackTransaction{
+		Method: "GET",
+		URL:    "https://example.com/app.js",
+		Chunks: []types.BodyChunk{{Chunk: []byte("aaaa")}, {Chunk: []byte("bb")}},
+	}
+	offsets := []time.Duration{10 * time.Millisecond, 30 * time.Millisecond}
+	start := time.Now()
+	body := newPacedBody(transaction, offsets, start, false)
+	body.events = &plugin.chunkEvents
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 chunk events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.URL != transaction.URL || event.Method != "GET" || event.Index != i || event.Count != 2 ||
+			event.Size != len(transaction.Chunks[i].Chunk) {
+			t.Errorf("Unexpected event %d: %+v", i, event)
+		}
+		if !event.Scheduled.Equal(start.Add(offsets[i])) || event.Sent.Before(event.Scheduled) {
+			t.Errorf("Event %d scheduled at %v, sent at %v", i, event.Scheduled.Sub(start), event.Sent.Sub(start))
+		}
+	}
+
+	// Unsubscribed functions are no longer called
+	unsubscribe()
+	body = newPacedBody(transaction, offsets, time.Now(), true)
+	body.events = &plugin.chunkEvents
+	io.ReadAll(body)
+	if len(events) != 2 {
+		t.Errorf("Expected no events after unsubscribing, got %d", len(events)-2)
+	}
+}
+
+// TestPlaybackPlugin_MatchPrefetch tests that prefetch and navigation responses of a URL are kept apart
+func TestPlaybackPlugin_MatchPrefetch(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	record := func(path string, header http.Header, body string) {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: header},
+		}
+		recorder.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte(body)}
+		recorder.Response(flow)
+	}
+	record("/next", http.Header{"Sec-Purpose": {"prefetch"}, "Sec-Fetch-Dest": {"empty"}}, "prefetched")
+	record("/next", http.Header{"Sec-Fetch-Dest": {"document"}, "Sec-Fetch-Mode": {"navigate"}, "Sec-Fetch-User": {"?1"}}, "navigated")
+	record("/later", http.Header{"Sec-Purpose": {"prefetch"}}, "only prefetched")
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{MatchPrefetch: true})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+
+	body := func(transaction *transactionState) string {
+		var buf bytes.Buffer
+		for _, chunk := range transaction.Chunks {
+			buf.Write(chunk.Chunk)
+		}
+		return buf.String()
+	}
+	navigation := plugin.transactionMap["GET:https://example.com/next"]
+	if navigation == nil || body(navigation) != "navigated" {
+		t.Fatalf("Expected the navigation response for /next, got %+v", navigation)
+	}
+	if navigation.Fetch == nil || navigation.Fetch.Dest != "document" || !navigation.Fetch.User {
+		t.Errorf("Expected the navigation fetch metadata, got %+v", navigation.Fetch)
+	}
+	prefetch := plugin.prefetchMap["GET:https://example.com/next"]
+	if prefetch == nil || body(prefetch) != "prefetched" {
+		t.Fatalf("Expected the prefetch response for /next, got %+v", prefetch)
+	}
+
+	// URLs only recorded as prefetches answer every request
+	if later := plugin.transactionMap["GET:https://example.com/later"]; later == nil || body(later) != "only prefetched" {
+		t.Errorf("Expected the prefetch response to answer /later, got %+v", later)
+	}
+}
+
+// TestPlaybackPlugin_ImageVariants tests that images negotiated by Accept replay the format the request asks for
+func TestPlaybackPlugin_ImageVariants(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	const (
+		chrome = "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8"
+		safari = "image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5"
+	)
+	record := func(accept, contentType string) {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/logo.png"), Header: http.Header{"Accept": {accept}}},
+		}
+		recorder.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {contentType}, "Vary": {"Accept"}}, Body: []byte(contentType)}
+		recorder.Response(flow)
+	}
+	record("*/*", "image/jpeg")
+	record(chrome, "image/avif")
+	record(safari, "image/webp")
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "contents", "variants", "image", "avif", "get", "https", "example.com", "logo.png")); err != nil {
+		t.Errorf("Expected the AVIF variant under contents/variants: %v", err)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	key := "GET:https://example.com/logo.png"
+	variants := plugin.variantMap[key]
+	if len(variants) != 3 {
+		t.Fatalf("Expected 3 variants, got %d", len(variants))
+	}
+
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{chrome, "image/avif"},
+		{safari, "image/webp"},
+		{"*/*", "image/jpeg"},
+		{"image/webp,*/*;q=0.8", "image/webp"},
+		{"image/jpeg;q=0.5,image/avif", "image/avif"},
+		{"image/png", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		selected := ""
+		if variant := selectVariant(variants, tt.accept); variant != nil {
+			selected = variantType(variant)
+		}
+		if selected != tt.expected {
+			t.Errorf("Accept %q: expected %q, got %q", tt.accept, tt.expected, selected)
+		}
+	}
+
+	// Requests naming none of the formats get the one served to any client
+	if fallback := plugin.transactionMap[key]; fallback == nil || variantType(fallback) != "image/jpeg" {
+		t.Errorf("Expected the JPEG as fallback, got %+v", fallback)
+	}
+}
+
+// TestPlaybackPlugin_ConcurrentReplay replays shared transactions from many goroutines at once;
+// run with -race to check that replays never write to the loaded transactions
+func TestPlaybackPlugin_ConcurrentReplay(t *testing.T) {
+	const (
+		workers  = 64
+		requests = 50
+	)
+	urls := []string{"https://example.com/", "https://example.com/app.js", "https://example.com/logo.png"}
+
+	plugin := &PlaybackPlugin{
+		transactionMap: make(map[string]*transactionState),
+		calibrator:     network.NewCalibrator(),
+	}
+	for _, u := range urls {
+		plugin.transactionMap["GET:"+u] = newTransactionState(&types.PlaybackTransaction{
+			Method:     "GET",
+			URL:        u,
+			RawHeaders: types.HttpHeaders{"Content-Type": "text/plain"},
+			Chunks:     []types.BodyChunk{{Chunk: []byte("hello ")}, {Chunk: []byte("world")}},
+		})
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	// Read-only views of the inventory run alongside the replays
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				plugin.Routes()
+				plugin.TransactionStats()
+				plugin.nearestKeys("GET", "https://example.com/app.css", 3)
+			}
+		}
+	}()
+
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				flow := &proxy.Flow{
+					Request: &proxy.Request{
+						Method: "GET",
+						URL:    parseURL(t, urls[(w+i)%len(urls)]),
+						Header: make(http.Header),
+					},
+				}
+				plugin.Request(flow)
+				if flow.Response == nil || flow.Response.BodyReader == nil {
+					errs <- fmt.Errorf("no replayed body for %s", flow.Request.URL)
+					return
+				}
+				body, err := io.ReadAll(flow.Response.BodyReader)
+				if err != nil || string(body) != "hello world" {
+					errs <- fmt.Errorf("unexpected body %q (%v)", body, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	// Every replay is counted against its own transaction
+	expected := make(map[string]int64)
+	for w := 0; w < workers; w++ {
+		for i := 0; i < requests; i++ {
+			expected[urls[(w+i)%len(urls)]]++
+		}
+	}
+	var hits, bytesServed int64
+	for _, stats := range plugin.TransactionStats() {
+		if stats.Hits != expected[stats.URL] {
+			t.Errorf("Expected %d hits for %s, got %d", expected[stats.URL], stats.URL, stats.Hits)
+		}
+		if stats.Active != 0 {
+			t.Errorf("Expected no active replays of %s, got %d", stats.URL, stats.Active)
+		}
+		hits += stats.Hits
+		bytesServed += stats.BytesServed
+	}
+	if hits != workers*requests {
+		t.Errorf("Expected %d hits, got %d", workers*requests, hits)
+	}
+	if bytesServed != workers*requests*int64(len("hello world")) {
+		t.Errorf("Expected %d bytes served, got %d", workers*requests*len("hello world"), bytesServed)
+	}
+}
+
+// TestPlaybackPlugin_MaxHeaderBytes tests that requests over the header limit are refused with 431
+func TestPlaybackPlugin_MaxHeaderBytes(t *testing.T) {
+	plugin := &PlaybackPlugin{
+		transactionMap: map[string]*transactionState{
+			"GET:https://example.com/": newTransactionState(&types.PlaybackTransaction{Method: "GET", URL: "https://example.com/"}),
+		},
+		maxHeaderBytes: 1024,
+	}
+
+	request := func(cookie string) *proxy.Flow {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{
+				Method: "GET",
+				URL:    parseURL(t, "https://example.com/"),
+				Header: http.Header{"Cookie": []string{cookie}},
+			},
+		}
+		plugin.Request(flow)
+		return flow
+	}
+
+	if flow := request("sid=" + string(bytes.Repeat([]byte("a"), 2048))); flow.Response == nil || flow.Response.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected 431 for oversized headers, got %+v", flow.Response)
+	}
+	if flow := request("sid=a"); flow.Response == nil || flow.Response.StatusCode != http.StatusOK {
+		t.Errorf("Expected the recorded response within the limit, got %+v", flow.Response)
+	}
+}
+
+// TestPlaybackPlugin_CompleteAtHeader tests that replayed responses announce when their paced body finishes
+func TestPlaybackPlugin_CompleteAtHeader(t *testing.T) {
+	state := newTransactionState(&types.PlaybackTransaction{
+		Method: "GET",
+		URL:    "https://example.com/",
+		TTFB:   20 * time.Millisecond,
+		Chunks: []types.BodyChunk{
+			{Chunk: []byte("hello "), TargetOffset: 20 * time.Millisecond},
+			{Chunk: []byte("world"), TargetOffset: 300 * time.Millisecond},
+		},
+	})
+	plugin := &PlaybackPlugin{calibrator: network.NewCalibrator(), completeAtHeader: true}
+
+	start := time.Now()
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}}}
+	plugin.playbackTransaction(flow, state, nil, start)
+	completeAt, err := time.Parse(time.RFC3339Nano, flow.Response.Header.Get(CompleteAtHeader))
+	if err != nil {
+		t.Fatalf("Expected an RFC 3339 completion time, got %q", flow.Response.Header.Get(CompleteAtHeader))
+	}
+	if offset := completeAt.Sub(start); offset < 250*time.Millisecond || offset > 350*time.Millisecond {
+		t.Errorf("Expected completion about 300ms after the request, got %v", offset)
+	}
+
+	// Immediate policies send everything at once
+	flow = &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}}}
+	plugin.playbackTransaction(flow, state, &classify.Policy{Timing: classify.TimingImmediate}, time.Now())
+	if completeAt, _ := time.Parse(time.RFC3339Nano, flow.Response.Header.Get(CompleteAtHeader)); time.Until(completeAt) > 50*time.Millisecond {
+		t.Errorf("Expected an immediate response to complete now, got %v", completeAt)
+	}
+
+	plugin.completeAtHeader = false
+	flow = &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}}}
+	plugin.playbackTransaction(flow, state, nil, time.Now())
+	if flow.Response.Header.Get(CompleteAtHeader) != "" {
+		t.Error("Expected no completion header unless enabled")
+	}
+}
+
+// TestPlaybackPlugin_TLSHosts tests that preloading covers every HTTPS host once
+func TestPlaybackPlugin_TLSHosts(t *testing.T) {
+	plugin := &PlaybackPlugin{transactionMap: make(map[string]*transactionState)}
+	for _, u := range []string{"https://example.com/", "https://example.com/app.js", "https://cdn.example.com:8443/logo.png", "http://plain.example.com/"} {
+		plugin.transactionMap["GET:"+u] = newTransactionState(&types.PlaybackTransaction{Method: "GET", URL: u})
+	}
+
+	hosts := plugin.TLSHosts()
+	if len(hosts) != 2 || hosts[0] != "cdn.example.com" || hosts[1] != "example.com" {
+		t.Errorf("Expected the HTTPS host names, got %v", hosts)
+	}
+}
+
+// TestPlaybackPlugin_EmulateTLSHandshakes tests that new connections wait for the recorded handshake,
+// at resumption speed once the host was connected to
+func TestPlaybackPlugin_EmulateTLSHandshakes(t *testing.T) {
+	state := newTransactionState(&types.PlaybackTransaction{
+		Method: "GET",
+		URL:    "https://example.com/",
+		TTFB:   10 * time.Millisecond,
+		Chunks: []types.BodyChunk{{Chunk: []byte("hello"), TargetOffset: 10 * time.Millisecond}},
+	})
+	emulator := newTLSEmulator()
+	emulator.add("example.com", &types.TLSSession{Version: "TLS 1.2", HandshakeMS: 200})
+	controller, _ := network.NewController(network.DefaultConditions())
+	plugin := &PlaybackPlugin{networkController: controller, completeAtHeader: true, tlsEmulator: emulator}
+
+	replay := func(clientConn *proxy.ClientConn) time.Duration {
+		start := time.Now()
+		flow := &proxy.Flow{
+			Request:     &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}},
+			ConnContext: &proxy.ConnContext{ClientConn: clientConn},
+		}
+		plugin.playbackTransaction(flow, state, nil, start)
+		completeAt, err := time.Parse(time.RFC3339Nano, flow.Response.Header.Get(CompleteAtHeader))
+		if err != nil {
+			t.Fatalf("Expected a completion time, got %q", flow.Response.Header.Get(CompleteAtHeader))
+		}
+		return completeAt.Sub(start).Round(10 * time.Millisecond)
+	}
+
+	first := &proxy.ClientConn{}
+	if offset := replay(first); offset != 210*time.Millisecond {
+		t.Errorf("Expected a full handshake on the first connection, got %v", offset)
+	}
+	if offset := replay(first); offset != 10*time.Millisecond {
+		t.Errorf("Expected no handshake on the same connection, got %v", offset)
+	}
+	// No resumed handshake was recorded: TLS 1.2 resumes in one round trip instead of two
+	if offset := replay(&proxy.ClientConn{}); offset != 110*time.Millisecond {
+		t.Errorf("Expected a resumed handshake on a repeat connection, got %v", offset)
+	}
+
+	// TLS 1.3 resumes in one round trip like its full handshake, and bodyless responses wait as well
+	noContent := http.StatusNoContent
+	state = newTransactionState(&types.PlaybackTransaction{Method: "GET", URL: "https://example.com/", StatusCode: &noContent})
+	plugin.tlsEmulator = newTLSEmulator()
+	plugin.tlsEmulator.add("example.com", &types.TLSSession{Version: "TLS 1.3", HandshakeMS: 100})
+	if offset := replay(&proxy.ClientConn{}); offset != 100*time.Millisecond {
+		t.Errorf("Expected a full TLS 1.3 handshake on the first connection, got %v", offset)
+	}
+	if offset := replay(&proxy.ClientConn{}); offset != 100*time.Millisecond {
+		t.Errorf("Expected a one round trip TLS 1.3 resumption on a repeat connection, got %v", offset)
+	}
+}
+
+// TestPlaybackPlugin_EmulateConnections tests that the first response from each host waits for the
+// recorded connection setup
+func TestPlaybackPlugin_EmulateConnections(t *testing.T) {
+	state := newTransactionState(&types.PlaybackTransaction{
+		Method: "GET",
+		URL:    "https://example.com/",
+		TTFB:   10 * time.Millisecond,
+		Chunks: []types.BodyChunk{{Chunk: []byte("hello"), TargetOffset: 10 * time.Millisecond}},
+	})
+	controller, _ := network.NewController(network.DefaultConditions())
+
+	replay := func(plugin *PlaybackPlugin) time.Duration {
+		start := time.Now()
+		flow := &proxy.Flow{
+			Request:     &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}},
+			ConnContext: &proxy.ConnContext{ClientConn: &proxy.ClientConn{}},
+		}
+		plugin.playbackTransaction(flow, state, nil, start)
+		completeAt, err := time.Parse(time.RFC3339Nano, flow.Response.Header.Get(CompleteAtHeader))
+		if err != nil {
+			t.Fatalf("Expected a completion time, got %q", flow.Response.Header.Get(CompleteAtHeader))
+		}
+		return completeAt.Sub(start).Round(10 * time.Millisecond)
+	}
+
+	timings := &types.Timings{DNSMS: 30, ConnectMS: 40, TLSMS: 100}
+	emulator := newConnectEmulator(true)
+	emulator.add("example.com", timings)
+	plugin := &PlaybackPlugin{networkController: controller, completeAtHeader: true, connectEmulator: emulator}
+	if offset := replay(plugin); offset != 180*time.Millisecond {
+		t.Errorf("Expected the lookup, connect and handshake on the first request, got %v", offset)
+	}
+	if offset := replay(plugin); offset != 10*time.Millisecond {
+		t.Errorf("Expected no setup once the host was replayed, got %v", offset)
+	}
+
+	// The handshake is left to the TLS emulation when both run
+	emulator = newConnectEmulator(false)
+	emulator.add("example.com", timings)
+	tlsEmulator := newTLSEmulator()
+	tlsEmulator.add("example.com", &types.TLSSession{Version: "TLS 1.3", HandshakeMS: 100})
+	plugin = &PlaybackPlugin{networkController: controller, completeAtHeader: true, connectEmulator: emulator, tlsEmulator: tlsEmulator}
+	if offset := replay(plugin); offset != 180*time.Millisecond {
+		t.Errorf("Expected the handshake to be added once, got %v", offset)
+	}
+
+	// Bodyless responses wait for the setup as well
+	noContent := http.StatusNoContent
+	state = newTransactionState(&types.PlaybackTransaction{Method: "GET", URL: "https://example.com/", StatusCode: &noContent})
+	emulator = newConnectEmulator(true)
+	emulator.add("example.com", timings)
+	plugin = &PlaybackPlugin{networkController: controller, completeAtHeader: true, connectEmulator: emulator}
+	if offset := replay(plugin); offset != 170*time.Millisecond {
+		t.Errorf("Expected the setup before a bodyless response, got %v", offset)
+	}
+}
+
+func TestPlaybackPlugin_BuiltinFallbacks(t *testing.T) {
+	classifier, err := classify.New(classify.Config{
+		Default:  "strict",
+		Policies: []classify.Policy{{Name: "strict", Fallback: classify.FallbackBlock}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+	plugin := &PlaybackPlugin{
+		transactionMap: map[string]*transactionState{
+			"GET:https://example.com/favicon.ico": newTransactionState(&types.PlaybackTransaction{
+				Method:     "GET",
+				URL:        "https://example.com/favicon.ico",
+				RawHeaders: types.HttpHeaders{"Content-Type": "image/x-icon"},
+				Chunks:     []types.BodyChunk{{Chunk: []byte("icon")}},
+			}),
+		},
+		recent:           accesslog.NewRing(10),
+		builtinFallbacks: true,
+	}
+	plugin.SetClassifier(classifier)
+
+	request := func(method, rawURL string) *proxy.Flow {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: method, URL: parseURL(t, rawURL), Header: http.Header{}}}
+		plugin.Request(flow)
+		return flow
+	}
+
+	tests := []struct {
+		method string
+		url    string
+		status int
+	}{
+		{"GET", "https://example.com/favicon.ico", http.StatusOK},
+		{"GET", "https://cdn.example.com/favicon.ico", http.StatusNoContent},
+		{"GET", "https://example.com/apple-touch-icon-precomposed.png", http.StatusNotFound},
+		{"GET", "https://example.com/.well-known/appspecific/com.chrome.devtools.json", http.StatusNotFound},
+		{"POST", "https://example.com/.well-known/report", http.StatusGatewayTimeout},
+		{"GET", "https://example.com/missing.png", http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		flow := request(tt.method, tt.url)
+		if flow.Response == nil || flow.Response.StatusCode != tt.status {
+			t.Errorf("%s %s: expected status %d, got %+v", tt.method, tt.url, tt.status, flow.Response)
+		}
+	}
+
+	plugin.builtinFallbacks = false
+	if flow := request("GET", "https://cdn.example.com/favicon.ico"); flow.Response.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("Expected the policy to apply with built-in fallbacks disabled, got %d", flow.Response.StatusCode)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := newConcurrencyLimiter(map[string]int{"example.com": 1})
+	flow := func(rawURL string) *proxy.Flow {
+		return &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, rawURL), Header: http.Header{}}}
+	}
+
+	release, queued := limiter.acquire(flow("https://example.com/a.js"))
+	if queued {
+		t.Fatal("First request should not queue")
+	}
+
+	// Hosts without a recorded limit are not held
+	if _, queued := limiter.acquire(flow("https://cdn.example.com/b.js")); queued {
+		t.Error("Hosts without a limit should not queue")
+	}
+
+	acquired := make(chan bool)
+	go func() {
+		_, queued := limiter.acquire(flow("https://example.com/c.js"))
+		acquired <- queued
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Second request should wait for the slot")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	select {
+	case queued := <-acquired:
+		if !queued {
+			t.Error("Second request should report that it queued")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Second request did not get the released slot")
+	}
+}
+
+// TestWebSocket_RecordAndReplay records a session through the recording plugin and replays it
+func TestWebSocket_RecordAndReplay(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+			websocket.AcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+		websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpText, Payload: []byte("welcome")})
+		frame, err := websocket.ReadFrame(buf)
+		if err != nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+		websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpText, Payload: append([]byte("echo: "), frame.Payload...)})
+		websocket.WriteFrame(conn, websocket.CloseFrame(1000))
+		websocket.ReadFrame(buf)
+	}))
+	defer origin.Close()
+	sessionURL := origin.URL + "/ws"
+
+	// serve routes requests to the plugin as the proxy does, with absolute URLs
+	serve := func(handler interface {
+		ServeWebSocket(http.ResponseWriter, *http.Request) bool
+	}) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL = parseURL(t, sessionURL)
+			if !handler.ServeWebSocket(w, r) {
+				http.Error(w, "not handled", http.StatusNotFound)
+			}
+		}))
+	}
+
+	// open connects to the server and returns the text payloads received until the close frame
+	open := func(server *httptest.Server, message string) ([]string, time.Duration) {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		started := time.Now()
+		key := "dGhlIHNhbXBsZSBub25jZQ=="
+		fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("Failed to read handshake: %v", err)
+		}
+		if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != websocket.AcceptKey(key) {
+			t.Fatalf("Unexpected handshake: %d %v", resp.StatusCode, resp.Header)
+		}
+
+		var texts []string
+		for {
+			frame, err := websocket.ReadFrame(reader)
+			if err != nil {
+				t.Fatalf("Failed to read frame: %v", err)
+			}
+			if frame.Opcode == websocket.OpClose {
+				websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpClose, Masked: true, Payload: frame.Payload})
+				return texts, time.Since(started)
+			}
+			texts = append(texts, string(frame.Payload))
+			if len(texts) == 1 {
+				websocket.WriteFrame(conn, &websocket.Frame{Fin: true, Opcode: websocket.OpText, Masked: true, Payload: []byte(message)})
+			}
+		}
+	}
+
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions(origin.URL, tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	recording := serve(recorder)
+	texts, _ := open(recording, "hi")
+	recording.Close()
+	if strings.Join(texts, "|") != "welcome|echo: hi" {
+		t.Fatalf("Unexpected recorded session: %q", texts)
+	}
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	state := plugin.transactionMap["GET:"+sessionURL]
+	if state == nil || len(state.WebSocket) < 4 || !state.WebSocket[1].FromClient {
+		t.Fatalf("Expected the recorded frames in the inventory, got %+v", state)
+	}
+
+	// The replay sends the recorded frames, whatever the client says, at the recorded pace
+	playback := serve(plugin)
+	defer playback.Close()
+	texts, elapsed := open(playback, "something else")
+	if strings.Join(texts, "|") != "welcome|echo: hi" {
+		t.Errorf("Unexpected replayed session: %q", texts)
+	}
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("Replay did not keep the recorded timing: %v", elapsed)
+	}
+}
+
+func TestPlaybackPlugin_OfflineDropsConnection(t *testing.T) {
+	offline, err := network.LookupPreset("offline")
+	if err != nil {
+		t.Fatalf("LookupPreset failed: %v", err)
+	}
+	controller, _ := network.NewController(network.Conditions{SpeedFactor: 1, Profile: &offline})
+	plugin := &PlaybackPlugin{networkController: controller}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	flow := &proxy.Flow{
+		Request:     &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}},
+		ConnContext: &proxy.ConnContext{ClientConn: &proxy.ClientConn{Conn: server}},
+	}
+	plugin.Request(flow)
+
+	if flow.Response == nil || flow.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected a response in place of the upstream, got %+v", flow.Response)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected the client connection to be closed, got %v", err)
+	}
+}
+
+// TestPlaybackPlugin_URLMatcher tests that requests differing from a recording only by ignored query
+// parameters replay it, while exact recordings still take precedence
+func TestPlaybackPlugin_URLMatcher(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	for _, path := range []string{"/app.js?v=100", "/app.js?v=200", "/api?id=1&_=1700000000"} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: http.Header{}}}
+		recorder.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte(path)}
+		recorder.Response(flow)
+	}
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	matcher, err := urlmatch.New(urlmatch.Options{IgnoreParams: []string{"v", "_"}})
+	if err != nil {
+		t.Fatalf("Failed to create URL matcher: %v", err)
+	}
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{URLMatcher: matcher})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://example.com/app.js?v=200", "GET:https://example.com/app.js?v=200"},
+		{"https://example.com/app.js?v=999", "GET:https://example.com/app.js?v=100"},
+		{"https://example.com/app.js", "GET:https://example.com/app.js?v=100"},
+		{"https://example.com/api?_=1800000000&id=1", "GET:https://example.com/api?id=1&_=1700000000"},
+		{"https://example.com/api?id=2", "GET:https://example.com/api?id=2"},
+	}
+	for _, tt := range tests {
+		plugin.mutex.RLock()
+		key := plugin.recordedKey("GET", tt.url)
+		plugin.mutex.RUnlock()
+		if key != tt.expected {
+			t.Errorf("recordedKey(%q) = %q, want %q", tt.url, key, tt.expected)
+		}
+	}
+}
+
+// TestPlaybackPlugin_HostMap tests that requests to a mapped host replay the recording of another,
+// with redirects and cookies pointing back at the requested host
+func TestPlaybackPlugin_HostMap(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://staging.example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://staging.example.com/login"), Header: http.Header{}}}
+	recorder.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 302, Header: http.Header{
+		"Location":   {"https://staging.example.com/home?from=login"},
+		"Set-Cookie": {"session=abc; Domain=.staging.example.com; Path=/; HttpOnly"},
+	}}
+	recorder.Response(flow)
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	hostMap, err := urlmatch.ParseHostMap([]string{"www.example.com=>staging.example.com"})
+	if err != nil {
+		t.Fatalf("Failed to parse host map: %v", err)
+	}
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{HostMap: hostMap})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+
+	flow = &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://www.example.com/login"), Header: http.Header{}}}
+	plugin.Request(flow)
+	if flow.Response == nil || flow.Response.StatusCode != 302 {
+		t.Fatalf("Expected the recorded redirect, got %+v", flow.Response)
+	}
+	if location := flow.Response.Header.Get("Location"); location != "https://www.example.com/home?from=login" {
+		t.Errorf("Expected the redirect to point at the requested host, got %s", location)
+	}
+	if cookie := flow.Response.Header.Get("Set-Cookie"); cookie != "session=abc; Domain=.www.example.com; Path=/; HttpOnly" {
+		t.Errorf("Expected the cookie domain to be the requested host, got %s", cookie)
+	}
+
+	// The recorded host is still served as recorded
+	flow = &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://staging.example.com/login"), Header: http.Header{}}}
+	plugin.Request(flow)
+	if location := flow.Response.Header.Get("Location"); location != "https://staging.example.com/home?from=login" {
+		t.Errorf("Expected the recorded redirect, got %s", location)
+	}
+}
+
+// TestPlaybackPlugin_MatchRequestBody tests that POSTs to one URL replay the response recorded for
+// their body, regardless of JSON formatting, and that unrecorded bodies are misses
+func TestPlaybackPlugin_MatchRequestBody(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	request := func(body string) *proxy.Flow {
+		return &proxy.Flow{Request: &proxy.Request{
+			Method: "POST",
+			URL:    parseURL(t, "https://example.com/api/search"),
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   []byte(body),
+		}}
+	}
+	for _, q := range []string{"shoes", "hats"} {
+		flow := request(`{"q":"` + q + `","page":1}`)
+		recorder.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`["` + q + `"]`)}
+		recorder.Response(flow)
+	}
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	classifier, err := classify.New(classify.Config{
+		Policies: []classify.Policy{{Name: "api", Fallback: classify.FallbackBlock}},
+		Rules:    []classify.Rule{{Policy: "api", Paths: []string{"/api/*"}}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+	replay := func(plugin *PlaybackPlugin, body string) string {
+		flow := request(body)
+		plugin.Request(flow)
+		if flow.Response == nil {
+			t.Fatalf("No response for %s", body)
+		}
+		if flow.Response.BodyReader == nil {
+			return fmt.Sprint(flow.Response.StatusCode)
+		}
+		replayed, _ := io.ReadAll(flow.Response.BodyReader)
+		return string(replayed)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{MatchRequestBody: true})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	plugin.SetClassifier(classifier)
+	tests := []struct {
+		body     string
+		expected string
+	}{
+		{`{"q":"hats","page":1}`, `["hats"]`},
+		{`{ "page": 1, "q": "shoes" }`, `["shoes"]`},
+		{`{"q":"socks","page":1}`, "504"},
+	}
+	for _, tt := range tests {
+		if got := replay(plugin, tt.body); got != tt.expected {
+			t.Errorf("Body %s: expected %s, got %s", tt.body, tt.expected, got)
+		}
+	}
+
+	// Without body matching, every body gets the first body recorded, whatever the hashes
+	plugin, err = NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	for _, body := range []string{`{"q":"hats","page":1}`, `{"q":"socks"}`} {
+		if got := replay(plugin, body); got != `["shoes"]` {
+			t.Errorf("Body %s: expected the first recording, got %s", body, got)
+		}
+	}
+}
+
+func TestPlaybackPlugin_Strict(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/app.js?v=1"), Header: make(http.Header)}}
+	recorder.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/javascript"}}, Body: []byte("app()")}
+	recorder.Response(flow)
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{Strict: true, StrictStatus: http.StatusNotFound})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+
+	// The default policy would proxy the miss upstream; strict mode answers it locally
+	miss := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/app.js?v=2"), Header: make(http.Header)}}
+	plugin.Request(miss)
+	if miss.Response == nil || miss.Response.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected a 404 for the unrecorded request, got %+v", miss.Response)
+	}
+	if got := miss.Response.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected a JSON explanation, got %s", got)
+	}
+	var body struct {
+		URL     string   `json:"url"`
+		Nearest []string `json:"nearest"`
+	}
+	if err := json.Unmarshal(miss.Response.Body, &body); err != nil {
+		t.Fatalf("Failed to parse body %s: %v", miss.Response.Body, err)
+	}
+	if body.URL != "https://example.com/app.js?v=2" || len(body.Nearest) != 1 || body.Nearest[0] != "GET:https://example.com/app.js?v=1" {
+		t.Errorf("Unexpected explanation: %+v", body)
+	}
+
+	// Recorded requests are still replayed
+	hit := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/app.js?v=1"), Header: make(http.Header)}}
+	plugin.Request(hit)
+	if hit.Response == nil || hit.Response.StatusCode != http.StatusOK {
+		t.Errorf("Expected the recording to be replayed, got %+v", hit.Response)
+	}
+
+	plugin, err = NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	miss.Response = nil
+	plugin.Request(miss)
+	if miss.Response == nil || miss.Response.StatusCode != DefaultStrictStatus {
+		t.Errorf("Expected the default strict status, got %+v", miss.Response)
+	}
+}
+
+func TestPlaybackPlugin_DomainFallbacks(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/app.js"), Header: make(http.Header)}}
+	recorder.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/javascript"}}, Body: []byte("app()")}
+	recorder.Response(flow)
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	pm := inventory.NewPersistenceManager(tempDir)
+	inv, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	inv.Playback = &types.PlaybackSettings{Domains: map[string]string{"example.com": "replay-only", "*.example.com": "block"}}
+	if err := pm.SaveInventory(inv); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	// Recording again keeps the settings
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	miss := func(plugin *PlaybackPlugin, u string) *proxy.Response {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, u), Header: make(http.Header)}}
+		plugin.Request(flow)
+		if flow.Response == nil {
+			t.Fatalf("Expected %s to be answered locally", u)
+		}
+		return flow.Response
+	}
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	if response := miss(plugin, "https://example.com/missing.js"); response.StatusCode != DefaultStrictStatus || !strings.Contains(string(response.Body), "replay-only") {
+		t.Errorf("Expected a replay-only explanation, got %d %s", response.StatusCode, response.Body)
+	}
+	if response := miss(plugin, "https://api.example.com/users"); response.StatusCode != http.StatusGatewayTimeout || response.Header.Get("Content-Type") == "application/json" {
+		t.Errorf("Expected the request to be blocked, got %d %s", response.StatusCode, response.Body)
+	}
+
+	// playback.json overrides the settings of the inventory
+	if err := os.WriteFile(filepath.Join(tempDir, inventory.PlaybackSettingsFile), []byte(`{"fallback": "block"}`), 0644); err != nil {
+		t.Fatalf("Failed to write settings: %v", err)
+	}
+	plugin, err = NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	if response := miss(plugin, "https://example.com/missing.js"); strings.Contains(string(response.Body), "replay-only") {
+		t.Errorf("Expected the request to be blocked, got %d %s", response.StatusCode, response.Body)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, inventory.PlaybackSettingsFile), []byte(`{"fallback": "drop"}`), 0644); err != nil {
+		t.Fatalf("Failed to write settings: %v", err)
+	}
+	if _, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{}); err == nil {
+		t.Errorf("Expected an unknown fallback to be rejected")
+	}
+}
+
+func TestPlaybackPlugin_Locales(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	record := func(acceptLanguage string, header http.Header, body string) {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{"Accept-Language": {acceptLanguage}}},
+		}
+		recorder.Request(flow)
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		flow.Response = &proxy.Response{StatusCode: 200, Header: header, Body: []byte(body)}
+		recorder.Response(flow)
+	}
+	record("en-US", http.Header{"Content-Language": {"en-US"}}, "<html><body>hello</body></html>")
+	record("ja", http.Header{}, `<html lang="ja"><body>こんにちは</body></html>`)
+	record("fr", http.Header{"Content-Language": {"fr"}}, "<html><body>bonjour</body></html>")
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	replay := func(plugin *PlaybackPlugin, acceptLanguage string) string {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{"Accept-Language": {acceptLanguage}}},
+		}
+		plugin.Request(flow)
+		if flow.Response == nil || flow.Response.BodyReader == nil {
+			t.Fatalf("No response for Accept-Language %q", acceptLanguage)
+		}
+		replayed, _ := io.ReadAll(flow.Response.BodyReader)
+		return string(replayed)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	if locales := plugin.localeMap["GET:https://example.com/"]; len(locales) != 3 {
+		t.Fatalf("Expected 3 locales, got %d", len(locales))
+	}
+	tests := []struct {
+		acceptLanguage string
+		expected       string
+	}{
+		{"ja-JP,ja;q=0.9,en;q=0.8", "こんにちは"},
+		{"en-GB,en;q=0.9", "hello"},
+		{"de;q=0.9,fr;q=0.5", "bonjour"},
+		// Requests accepting none of the languages get the first by tag
+		{"de", "hello"},
+		{"", "hello"},
+	}
+	for _, tt := range tests {
+		if got := replay(plugin, tt.acceptLanguage); !strings.Contains(got, tt.expected) {
+			t.Errorf("Accept-Language %q: expected %s, got %s", tt.acceptLanguage, tt.expected, got)
+		}
+	}
+	if stats := plugin.TransactionStats(); len(stats) != 3 {
+		t.Errorf("Expected stats for every locale, got %d", len(stats))
+	}
+
+	// A chosen language overrides Accept-Language
+	plugin, err = NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{Language: "JA"})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	if got := replay(plugin, "en-US"); !strings.Contains(got, "こんにちは") {
+		t.Errorf("Expected the Japanese page with --language ja, got %s", got)
+	}
+}
+
+// TestPlaybackPlugin_Repeats tests that the responses kept for a polled URL are replayed in
+// recorded order, sticking on the last or starting over
+func TestPlaybackPlugin_Repeats(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true, KeepRepeats: []string{`/poll$`}})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	for _, body := range []string{"first", "second", "third"} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/poll"), Header: http.Header{}}}
+		recorder.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte(body)}
+		recorder.Response(flow)
+	}
+	if err := recorder.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	replay := func(plugin *PlaybackPlugin) string {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/poll"), Header: http.Header{}}}
+		plugin.Request(flow)
+		if flow.Response == nil || flow.Response.BodyReader == nil {
+			t.Fatal("No response for the polled URL")
+		}
+		replayed, _ := io.ReadAll(flow.Response.BodyReader)
+		return string(replayed)
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{RepeatsSequence, []string{"first", "second", "third", "third"}},
+		{RepeatsRoundRobin, []string{"first", "second", "third", "first"}},
+	}
+	for _, tt := range tests {
+		plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{DisableCalibration: true, Repeats: tt.order})
+		if err != nil {
+			t.Fatalf("Failed to create playback plugin: %v", err)
+		}
+		for i, expected := range tt.expected {
+			if got := replay(plugin); got != expected {
+				t.Errorf("%s: expected %s for request %d, got %s", tt.order, expected, i+1, got)
+			}
+		}
+		if stats := plugin.TransactionStats(); len(stats) != 3 {
+			t.Errorf("%s: expected stats for every response, got %d", tt.order, len(stats))
+		}
+	}
+}
+
+// TestPlaybackPlugin_RecordMisses tests that an unrecorded request is proxied upstream once, appended
+// to the inventory and replayed from then on
+func TestPlaybackPlugin_RecordMisses(t *testing.T) {
+	var hits sync.Map
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count, _ := hits.LoadOrStore(r.URL.Path, new(int))
+		*count.(*int)++
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, "fresh from the origin")
+	}))
+	defer origin.Close()
+
+	inventoryDir := t.TempDir()
+	plugin, err := NewPlaybackPluginWithOptions(inventoryDir, PlaybackOptions{DisableCalibration: true, RecordMisses: true})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+
+	addr, err := httputil.FreeLoopbackAddr()
+	if err != nil {
+		t.Fatalf("Failed to allocate address: %v", err)
+	}
+	p, err := httputil.CreateProxy(&httputil.ProxyOptions{Addr: addr, SslInsecure: true, CaRootPath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create proxy: %v", err)
+	}
+	p.AddAddon(plugin)
+	go p.Start()
+	defer p.Close()
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(parseURL(t, "http://"+addr))}}
+	get := func() string {
+		var resp *http.Response
+		for i := 0; i < 50; i++ {
+			if resp, err = client.Get(origin.URL + "/new.txt"); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("Request through the proxy failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if body := get(); body != "fresh from the origin" {
+		t.Fatalf("Expected the upstream response, got %q", body)
+	}
+	for i := 0; i < 50 && plugin.RecordedMisses() == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if plugin.RecordedMisses() != 1 {
+		t.Fatalf("Expected the miss to be recorded, got %d", plugin.RecordedMisses())
+	}
+
+	if body := get(); body != "fresh from the origin" {
+		t.Errorf("Expected the recorded response, got %q", body)
+	}
+	if count, _ := hits.Load("/new.txt"); *count.(*int) != 1 {
+		t.Errorf("Expected the second request to be replayed, origin hit %d times", *count.(*int))
+	}
+
+	transactions, err := inventory.NewPlaybackManager(inventoryDir).LoadPlaybackTransactions()
+	if err != nil || len(transactions) != 1 || transactions[0].URL != origin.URL+"/new.txt" {
+		t.Errorf("Expected the miss in the inventory, got %d transactions (%v)", len(transactions), err)
+	}
+}
+
+// TestMissRecorder_Redaction tests that misses are redacted like the inventory they are appended to
+func TestMissRecorder_Redaction(t *testing.T) {
+	inventoryDir := t.TempDir()
+	redaction, err := inventory.NewRedaction(nil)
+	if err != nil {
+		t.Fatalf("Failed to create redaction: %v", err)
+	}
+	pm := inventory.NewPersistenceManager(inventoryDir)
+	pm.Redaction = redaction
+	status := 200
+	now := time.Now()
+	recorded := types.RecordingTransaction{
+		Method:           "GET",
+		URL:              "https://example.com/",
+		StatusCode:       &status,
+		RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+		Body:             []byte("recorded"),
+		RequestStarted:   now,
+		ResponseStarted:  now,
+		ResponseFinished: now,
+	}
+	if err := pm.SaveRecordedTransactionsWithOptions([]types.RecordingTransaction{recorded}, recorded.URL, true); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	recorder, err := newMissRecorder(inventoryDir)
+	if err != nil {
+		t.Fatalf("Failed to create miss recorder: %v", err)
+	}
+	miss := recorded
+	miss.URL = "https://example.com/login"
+	miss.RawHeaders = types.HttpHeaders{"Content-Type": "text/plain", "Set-Cookie": "session=secret"}
+	if err := recorder.persistence.AppendRecordedTransaction(&miss); err != nil {
+		t.Fatalf("Failed to append miss: %v", err)
+	}
+
+	saved, err := pm.LoadInventory()
+	if err != nil {
+		t.Fatalf("Failed to load inventory: %v", err)
+	}
+	for _, resource := range saved.Resources {
+		if resource.URL != miss.URL {
+			continue
+		}
+		if _, ok := resource.RawHeaders["Set-Cookie"]; ok {
+			t.Errorf("Expected the miss to be redacted, got %v", resource.RawHeaders)
+		}
+		return
+	}
+	t.Fatalf("Expected the miss in the inventory")
+}
+
+// TestPlaybackPlugin_ChecksumOnServe tests that content files edited while playback runs are caught on serve
+func TestPlaybackPlugin_ChecksumOnServe(t *testing.T) {
+	tempDir := t.TempDir()
+	statusCode := 200
+	now := time.Now()
+	pm := inventory.NewPersistenceManager(tempDir)
+	err := pm.SaveRecordedTransactions([]types.RecordingTransaction{{
+		Method:           "GET",
+		URL:              "https://example.com/data.txt",
+		RequestStarted:   now,
+		ResponseStarted:  now.Add(10 * time.Millisecond),
+		ResponseFinished: now.Add(20 * time.Millisecond),
+		StatusCode:       &statusCode,
+		RawHeaders:       types.HttpHeaders{"Content-Type": "text/plain"},
+		Body:             []byte("fixture"),
+	}}, "https://example.com/")
+	if err != nil {
+		t.Fatalf("Failed to save transactions: %v", err)
+	}
+
+	plugin, err := NewPlaybackPluginWithOptions(tempDir, PlaybackOptions{Checksum: inventory.ChecksumFail})
+	if err != nil {
+		t.Fatalf("Failed to create playback plugin: %v", err)
+	}
+	state := plugin.transactionMap["GET:https://example.com/data.txt"]
+	if state == nil || state.ContentFile == "" {
+		t.Fatalf("Expected the content file to be followed, got %+v", state)
+	}
+	if state.checksumMismatch() {
+		t.Error("Expected the untouched content file to match")
+	}
+
+	if err := os.WriteFile(state.ContentFile, []byte("tampered"), 0644); err != nil {
+		t.Fatalf("Failed to modify content: %v", err)
+	}
+	if !state.checksumMismatch() {
+		t.Error("Expected the content file edited after loading to be caught")
+	}
+
+	// Reverting the edit makes it match again
+	if err := os.WriteFile(state.ContentFile, []byte("fixture"), 0644); err != nil {
+		t.Fatalf("Failed to restore content: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(state.ContentFile, later, later)
+	if state.checksumMismatch() {
+		t.Error("Expected the restored content file to match")
+	}
+}
@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// upstreamProtocol returns the HTTP version the origin served a flow with: the protocol negotiated
+// on its TLS connection, else the version of the request, which go-mitmproxy keeps in step with it
+func upstreamProtocol(f *proxy.Flow) types.Protocol {
+	if f.ConnContext != nil && f.ConnContext.ServerConn != nil {
+		if state := f.ConnContext.ServerConn.TlsState(); state != nil && state.NegotiatedProtocol != "" {
+			if protocol := inventory.ParseProtocol(state.NegotiatedProtocol); protocol != "" {
+				return protocol
+			}
+		}
+	}
+	if f.Request == nil {
+		return ""
+	}
+	return inventory.ParseProtocol(f.Request.Proto)
+}
+
+// advertisesHTTP3 reports whether the Alt-Svc header of a response offers HTTP/3, e.g.
+// h3=":443"; ma=86400, including the drafts (h3-29)
+func advertisesHTTP3(header http.Header) bool {
+	for _, value := range header.Values("Alt-Svc") {
+		for _, service := range strings.Split(value, ",") {
+			id, _, _ := strings.Cut(strings.TrimSpace(service), "=")
+			if id == "h3" || strings.HasPrefix(id, "h3-") {
+				return true
+			}
+		}
+	}
+	return false
+}
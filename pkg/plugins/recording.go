@@ -1,29 +1,95 @@
 package plugins
 
 import (
+	"bytes"
 	"fmt"
-	"log/slog"
+	"io"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/credentials"
 	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/logging"
+	"go-http-playback-proxy/pkg/postprocess"
+	"go-http-playback-proxy/pkg/resolver"
+	"go-http-playback-proxy/pkg/sampling"
 	"go-http-playback-proxy/pkg/types"
 )
 
+// recordingLogger is the logger for the recording module
+var recordingLogger = logging.For(logging.ModuleRecording)
+
 // RecordingPlugin handles recording mode functionality
 type RecordingPlugin struct {
 	BaseLogPlugin
-	targetURL    string
-	targetDomain string
-	transactions []types.RecordingTransaction
-	mutex        sync.RWMutex
-	inventoryDir string
-	noBeautify   bool
+	targetURL       string
+	targetDomain    string
+	transactions    []types.RecordingTransaction
+	mutex           sync.RWMutex
+	inventoryDir    string
+	noBeautify      bool
+	splitDomains    bool
+	credentials     *credentials.Injector
+	scope           *recordingScope
+	bodyLimit       *bodyLimit
+	clients         *clientTagger
+	sampler         *sampling.Sampler
+	skipped         sync.Map // *proxy.Flow -> *types.RecordingTransaction whose body is not recorded
+	informational   sync.Map // *proxy.Flow -> *informationalLog
+	phases          sync.Map // *proxy.Flow -> *phaseTrace
+	tunnels         sync.Map // *proxy.ClientConn -> *phaseTrace of the CONNECT that dialed upstream
+	injected        sync.Map // *proxy.Flow -> []string names of the injected credential headers
+	omittedBodies   sync.Map // *proxy.Flow -> int64 size of the body left out by the body limit
+	overhead        proxyOverhead
+	tlsSessions     tlsSessions
+	startedAt       time.Time
+	summary         *inventory.RecordingSummary
+	postProcess     postprocess.Pipeline
+	followRedirects bool
+	beautifier      *inventory.BeautifyQueue
+	diskGuard       *diskGuard
+	sync            inventory.SyncPolicy
+	rotation        *rotation
+	autosave        *autosave
+	resolver        string
+	normalizeJSON   bool
+	keepOriginals   bool
+	appendInventory bool
+	redaction       *inventory.Redaction
+	stripAltSvc     bool
+	// keepRepeats are the URLs every response to which is kept
+	keepRepeats []*regexp.Regexp
+	// http3 holds the flows whose stripped Alt-Svc header advertised HTTP/3
+	http3 sync.Map // *proxy.Flow -> struct{}
+	// paused stops capturing new requests, which are still proxied
+	paused atomic.Bool
+	// pausedRequests counts the requests proxied but not recorded while paused
+	pausedRequests atomic.Int64
+	// outOfScopeRequests counts the requests proxied but not recorded because of the scope
+	outOfScopeRequests atomic.Int64
+	// webSockets holds the transaction indexes of the open WebSocket sessions
+	webSockets map[*int]struct{}
+	// beautifiedBefore is the beautifier's count when the last save started
+	beautifiedBefore int
+	// summaryDir is where the summary of the last save was written
+	summaryDir string
+	// panicked is closed once a panic was recovered while recording
+	panicked  chan struct{}
+	panicOnce sync.Once
+	// stopped is closed by the final save to stop the rotation and autosave watchers
+	stopped  chan struct{}
+	stopOnce sync.Once
 }
 
 // NewRecordingPlugin creates a new recording plugin
@@ -31,19 +97,130 @@ func NewRecordingPlugin(targetURL string) (*RecordingPlugin, error) {
 	return NewRecordingPluginWithInventoryDir(targetURL, "./inventory", false)
 }
 
+// RecordingOptions holds options applied when the inventory is saved
+type RecordingOptions struct {
+	// NoBeautify disables HTML/CSS/JavaScript beautification
+	NoBeautify bool
+	// SplitByDomain writes one inventory per domain under domains/<host>
+	SplitByDomain bool
+	// Credentials are injected into upstream requests for matching domains
+	Credentials *credentials.Injector
+	// TagClients records which client (proxy auth user or source IP) requested each resource
+	TagClients bool
+	// Sampling limits the recorded responses of chatty endpoints
+	Sampling []sampling.Rule
+	// PostProcess transforms the recorded transactions before the inventory is written
+	PostProcess postprocess.Pipeline
+	// FollowRedirects fetches and records redirect targets the client never requested
+	FollowRedirects bool
+	// MinFreeBytes stops recording new requests when the inventory's filesystem has less free
+	// space; 0 disables the check
+	MinFreeBytes uint64
+	// Sync is the fsync policy for the saved inventory
+	Sync inventory.SyncPolicy
+	// RotateInterval saves the finished transactions as a new segment of the inventory this often;
+	// 0 disables rotation by time
+	RotateInterval time.Duration
+	// RotateBytes saves the finished transactions as a new segment once their bodies reach this
+	// size; 0 disables rotation by size
+	RotateBytes int64
+	// Resolver names the DNS resolver upstream hosts are resolved with, recorded with their
+	// addresses; resolver.System when empty
+	Resolver string
+	// NormalizeJSON saves JSON content files in a stable form for minimal diffs between recordings
+	NormalizeJSON bool
+	// KeepOriginals keeps the received content of normalized files for exact playback
+	KeepOriginals bool
+	// Append adds the recorded transactions to the existing inventory instead of replacing it
+	Append bool
+	// AutosaveInterval adds the transactions finished since the last autosave to the inventory this
+	// often; 0 disables autosaving by time. Autosaving cannot be combined with rotation.
+	AutosaveInterval time.Duration
+	// AutosaveCount autosaves once this many transactions finished since the last autosave; 0
+	// disables autosaving by count
+	AutosaveCount int
+	// IncludeDomains records only the requests to hosts matching these globs, e.g. *.example.com;
+	// all hosts when empty
+	IncludeDomains []string
+	// ExcludeDomains leaves the requests to hosts matching these globs unrecorded
+	ExcludeDomains []string
+	// IncludeURLs records only the requests whose URL matches one of these regular expressions; all
+	// URLs when empty
+	IncludeURLs []string
+	// ExcludeURLs leaves the requests whose URL matches one of these regular expressions unrecorded,
+	// e.g. /health$
+	ExcludeURLs []string
+	// MaxBodySize records only the metadata and size of larger response bodies; 0 records them all
+	MaxBodySize int64
+	// SkipContentTypes records only the metadata and size of the response bodies of media types
+	// matching these globs, e.g. video/*
+	SkipContentTypes []string
+	// Redaction strips or hashes credentials in the saved headers and URLs; nil saves them as recorded
+	Redaction *inventory.Redaction
+	// StripAltSvc removes Alt-Svc headers from responses, so browsers keep using the proxy instead
+	// of switching to HTTP/3 over QUIC, which it cannot carry
+	StripAltSvc bool
+	// KeepRepeats keeps every response to the requests whose URL matches one of these regular
+	// expressions, e.g. of polling endpoints, instead of only the newest
+	KeepRepeats []string
+}
+
 // NewRecordingPluginWithInventoryDir creates a new recording plugin with custom inventory directory
 func NewRecordingPluginWithInventoryDir(targetURL string, inventoryDir string, noBeautify bool) (*RecordingPlugin, error) {
+	return NewRecordingPluginWithOptions(targetURL, inventoryDir, RecordingOptions{NoBeautify: noBeautify})
+}
+
+// NewRecordingPluginWithOptions creates a new recording plugin with custom inventory directory and options
+func NewRecordingPluginWithOptions(targetURL string, inventoryDir string, opts RecordingOptions) (*RecordingPlugin, error) {
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse target URL: %w", err)
 	}
+	if (opts.AutosaveInterval > 0 || opts.AutosaveCount > 0) && (opts.RotateInterval > 0 || opts.RotateBytes > 0) {
+		return nil, fmt.Errorf("autosave cannot be combined with rotation: rotated recordings are saved segment by segment")
+	}
 
 	plugin := &RecordingPlugin{
-		targetURL:    targetURL,
-		targetDomain: parsedURL.Host,
-		transactions: make([]types.RecordingTransaction, 0),
-		inventoryDir: inventoryDir,
-		noBeautify:   noBeautify,
+		targetURL:       targetURL,
+		targetDomain:    parsedURL.Host,
+		transactions:    make([]types.RecordingTransaction, 0),
+		inventoryDir:    inventoryDir,
+		noBeautify:      opts.NoBeautify,
+		splitDomains:    opts.SplitByDomain,
+		credentials:     opts.Credentials,
+		startedAt:       time.Now(),
+		postProcess:     opts.PostProcess,
+		followRedirects: opts.FollowRedirects,
+		sync:            opts.Sync,
+		resolver:        opts.Resolver,
+		normalizeJSON:   opts.NormalizeJSON,
+		keepOriginals:   opts.KeepOriginals,
+		appendInventory: opts.Append,
+		redaction:       opts.Redaction,
+		stripAltSvc:     opts.StripAltSvc,
+		panicked:        make(chan struct{}),
+		stopped:         make(chan struct{}),
+	}
+	if plugin.scope, err = newRecordingScope(opts.IncludeDomains, opts.ExcludeDomains, opts.IncludeURLs, opts.ExcludeURLs); err != nil {
+		return nil, err
+	}
+	if plugin.keepRepeats, err = compileURLPatterns(opts.KeepRepeats); err != nil {
+		return nil, fmt.Errorf("invalid repeated URL: %w", err)
+	}
+	if plugin.bodyLimit, err = newBodyLimit(opts.MaxBodySize, opts.SkipContentTypes); err != nil {
+		return nil, err
+	}
+	if plugin.resolver == "" {
+		plugin.resolver = resolver.System
+	}
+	if !opts.NoBeautify {
+		plugin.beautifier = inventory.NewBeautifyQueue(runtime.NumCPU())
+	}
+	if opts.TagClients {
+		plugin.clients = &clientTagger{}
+	}
+	if len(opts.Sampling) > 0 {
+		plugin.sampler = sampling.NewSampler(opts.Sampling)
 	}
 
 	// Create inventory directory if it doesn't exist
@@ -51,127 +228,642 @@ func NewRecordingPluginWithInventoryDir(targetURL string, inventoryDir string, n
 		return nil, fmt.Errorf("failed to create inventory directory: %w", err)
 	}
 
+	if opts.MinFreeBytes > 0 {
+		plugin.diskGuard = newDiskGuard(plugin.inventoryDir, opts.MinFreeBytes)
+		if !plugin.diskGuard.check() {
+			go plugin.diskGuard.watch(diskCheckInterval)
+		}
+	}
+
+	if opts.RotateInterval > 0 || opts.RotateBytes > 0 {
+		// Segments of an earlier run are kept, and numbering continues after them
+		manifest, err := inventory.LoadSegmentManifest(plugin.inventoryDir)
+		if err != nil {
+			return nil, err
+		}
+		manifest.EntryURL = targetURL
+		plugin.rotation = &rotation{
+			interval: opts.RotateInterval,
+			maxBytes: opts.RotateBytes,
+			started:  plugin.startedAt,
+			manifest: manifest,
+		}
+		go plugin.watchRotation(rotationCheckInterval)
+	}
+
+	if opts.AutosaveInterval > 0 || opts.AutosaveCount > 0 {
+		plugin.autosave = newAutosave(opts.AutosaveInterval, opts.AutosaveCount)
+		go plugin.watchAutosave()
+	}
+
 	return plugin, nil
 }
 
 func (p *RecordingPlugin) ServerConnected(connCtx *proxy.ConnContext) {
 	p.BaseLogPlugin.ServerConnected(connCtx)
+	p.tlsSessions.connected(connCtx.ServerConn)
+}
+
+func (p *RecordingPlugin) TlsEstablishedServer(connCtx *proxy.ConnContext) {
+	if connCtx.ServerConn != nil {
+		p.tlsSessions.established(connCtx.ServerConn, connCtx.ServerConn.TlsState())
+	}
+}
+
+func (p *RecordingPlugin) ServerDisconnected(connCtx *proxy.ConnContext) {
+	p.tlsSessions.disconnected(connCtx.ServerConn)
+}
+
+func (p *RecordingPlugin) ClientDisconnected(clientConn *proxy.ClientConn) {
+	p.tunnels.Delete(clientConn)
+	if p.clients != nil {
+		p.clients.forget(clientConn)
+	}
+}
+
+// Requestheaders injects configured credentials before the request is sent upstream
+func (p *RecordingPlugin) Requestheaders(f *proxy.Flow) {
+	defer p.recoverPanic("Requestheaders")
+	if f == nil || f.Request == nil {
+		return
+	}
+	if f.Request.Method == http.MethodConnect {
+		p.traceTunnel(f)
+	}
+	if p.clients != nil {
+		p.clients.observe(f)
+	}
+	if injected := p.credentials.Apply(f.Request.URL.Hostname(), f.Request.Header); len(injected) > 0 {
+		recordingLogger.Debug("Injected credentials", "url", f.Request.URL.String(), "headers", injected)
+		p.injected.Store(f, injected)
+	}
 }
 
 func (p *RecordingPlugin) Request(f *proxy.Flow) {
+	defer p.recoverPanic("Request")
 	p.BaseLogPlugin.Request(f)
 
-	if f != nil && f.Request != nil {
-		// Start recording transaction
-		transaction := types.RecordingTransaction{
-			Method:         f.Request.Method,
-			URL:            f.Request.URL.String(),
-			RequestStarted: time.Now(),
-			RawHeaders:     make(types.HttpHeaders),
-		}
+	var injected []string
+	if value, ok := p.injected.LoadAndDelete(f); ok {
+		injected = value.([]string)
+	}
 
-		// Store transaction for later retrieval
-		p.mutex.Lock()
-		if len(p.transactions) < 10000 { // Prevent memory issues
-			p.transactions = append(p.transactions, transaction)
-			slog.Debug("Transaction started", "method", transaction.Method, "url", transaction.URL, "count", len(p.transactions))
-		}
-		p.mutex.Unlock()
+	if f == nil || f.Request == nil || p.outOfScope(f.Request.URL) {
+		return
+	}
+	if p.diskGuard.stopped() || p.skipPaused() {
+		return
+	}
+
+	// Start recording transaction
+	transaction := types.RecordingTransaction{
+		Method:         f.Request.Method,
+		URL:            f.Request.URL.String(),
+		RequestStarted: time.Now(),
+		RawHeaders:     make(types.HttpHeaders),
+		ClientID:       p.clientID(f),
+		Fetch:          fetchMetadata(f.Request.Header),
+		Accept:         f.Request.Header.Get("Accept"),
+		RequestHeaders: requestHeaders(f.Request.Header, injected),
+		RequestBody:    recordedRequestBody(f.Request),
+		// Requests to the same URL with other bodies are recorded as separate resources
+		RequestBodySHA256: requestBodyHash(f.Request),
+	}
+	defer p.overhead.start(f, transaction.RequestStarted)
+	p.traceInformational(f)
+	p.tracePhases(f)
+
+	// Sampled-out responses only contribute to the timing statistics
+	pattern, keep := p.sampler.Sample(f.Request.URL)
+	transaction.SamplePattern = pattern
+	if !keep {
+		p.skipped.Store(f, &transaction)
+		recordingLogger.Debug("Response not sampled", "url", transaction.URL, "pattern", pattern)
+		return
+	}
+
+	// Store transaction for later retrieval
+	p.mutex.Lock()
+	if len(p.transactions) < 10000 { // Prevent memory issues
+		p.transactions = append(p.transactions, transaction)
+		recordingLogger.Debug("Transaction started", "method", transaction.Method, "url", transaction.URL, "count", len(p.transactions))
 	}
+	p.mutex.Unlock()
 }
 
 func (p *RecordingPlugin) Response(f *proxy.Flow) {
+	defer p.recoverPanic("Response")
 	p.BaseLogPlugin.Response(f)
 
-	slog.Debug("Response called", "hasFlow", f != nil, "hasResponse", f != nil && f.Response != nil, "hasRequest", f != nil && f.Request != nil)
+	recordingLogger.Debug("Response called", "hasFlow", f != nil, "hasResponse", f != nil && f.Response != nil, "hasRequest", f != nil && f.Request != nil)
 
 	if f != nil && f.Response != nil && f.Request != nil {
-		// Find the most recent transaction for this request
-		p.mutex.Lock()
-		for i := len(p.transactions) - 1; i >= 0; i-- {
-			transaction := &p.transactions[i]
-			if transaction.Method == f.Request.Method && transaction.URL == f.Request.URL.String() && transaction.ResponseStarted.IsZero() {
-				responseStartTime := time.Now()
-				transaction.ResponseStarted = responseStartTime
-
-				// Record response details
-				transaction.StatusCode = &f.Response.StatusCode
-
-				// Copy headers
-				for name, values := range f.Response.Header {
-					if len(values) > 0 {
-						transaction.RawHeaders[name] = values[0]
-					}
-				}
+		body := f.Response.Body
+		if p.bodyLimit.omits(f.Response.Header.Get("Content-Type"), int64(len(body))) {
+			p.omittedBodies.Store(f, int64(len(body)))
+			body = nil
+		}
+		p.recordResponse(f, body, true, nil, nil)
+	}
+}
 
-				// Record body
-				if f.Response.Body != nil {
-					transaction.Body = f.Response.Body
-				}
+// Responseheaders streams responses of streaming MIME types, which would otherwise be buffered until they end,
+// HTML documents, whose flushes are lost when buffered, and bodies the body limit leaves out
+func (p *RecordingPlugin) Responseheaders(f *proxy.Flow) {
+	if f == nil || f.Response == nil {
+		return
+	}
+	defer p.overhead.add(f, time.Now())
+	if v, skipped := p.skipped.Load(f); skipped {
+		v.(*types.RecordingTransaction).ResponseStarted = time.Now()
+	}
+	if p.stripAltSvc {
+		if advertisesHTTP3(f.Response.Header) {
+			p.http3.Store(f, struct{}{})
+		}
+		f.Response.Header.Del("Alt-Svc")
+	}
+	contentType := f.Response.Header.Get("Content-Type")
+	if isStreamingMediaType(contentType) || isHTMLMediaType(contentType) {
+		f.Stream = true
+	}
+	if f.Request != nil && p.bodyLimit != nil {
+		var length int64
+		if expected := expectedBodyLength(f); expected != nil {
+			length = *expected
+		}
+		if p.bodyLimit.omits(contentType, length) {
+			f.Stream = true
+		}
+	}
+}
+
+// StreamResponseModifier captures the body of streamed (large) responses, which never reach Response.
+// The transaction is completed once the flow finishes, including when the client aborts mid-transfer.
+func (p *RecordingPlugin) StreamResponseModifier(f *proxy.Flow, in io.Reader) io.Reader {
+	if f == nil || !f.Stream || f.Response == nil || f.Request == nil || !p.scope.records(f.Request.URL) {
+		return in
+	}
+
+	if _, skipped := p.skipped.Load(f); skipped {
+		counted := &countingReader{Reader: in}
+		go func() {
+			defer p.recoverPanic("StreamResponseModifier")
+			<-f.Done()
+			p.omittedBodies.Store(f, counted.n.Load())
+			p.recordResponse(f, nil, true, nil, nil)
+		}()
+		return counted
+	}
+
+	// The body is read as soon as the headers arrive
+	opened := time.Now()
+	capture := p.bodyLimit.capture(in, f.Response.Header.Get("Content-Type"))
+	go func() {
+		defer p.recoverPanic("StreamResponseModifier")
+		<-f.Done()
+		body, eof := capture.result()
+		if size, omitted := capture.omitted(); omitted {
+			p.omittedBodies.Store(f, size)
+			p.recordResponse(f, nil, eof, nil, nil)
+			return
+		}
+
+		// Streaming types are kept part by part; an unfinished last part is dropped
+		var stream *timedStream
+		var flushed *flushedHTML
+		if contentType := f.Response.Header.Get("Content-Type"); isStreamingMediaType(contentType) {
+			parts, complete := splitStream(contentType, f.Response.Header.Get("Content-Encoding"), body, capture.readMarks())
+			stream = &timedStream{opened: opened, parts: parts}
+			body = body[:complete]
+		} else if isHTMLMediaType(contentType) && eof {
+			flushed = htmlFlushes(body, f.Response.Header.Get("Content-Encoding"), capture.readMarks())
+		}
+		p.recordResponse(f, body, eof, stream, flushed)
+	}()
+
+	return capture
+}
+
+// countingReader counts the bytes of a body passed through without being kept
+type countingReader struct {
+	io.Reader
+	n atomic.Int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// recordResponse completes the pending transaction for the flow with the received body.
+// complete reports whether the body was read to the end; stream is set for streaming responses and
+// flushed for HTML documents the origin flushed in parts.
+func (p *RecordingPlugin) recordResponse(f *proxy.Flow, body []byte, complete bool, stream *timedStream, flushed *flushedHTML) {
+	omittedSize, omitted := p.omittedBodies.LoadAndDelete(f)
+	overhead := p.overhead.take(f)
+	if v, skipped := p.skipped.LoadAndDelete(f); skipped {
+		p.informational.Delete(f)
+		p.http3.Delete(f)
+		p.phases.Delete(f)
+		transaction := v.(*types.RecordingTransaction)
+		if transaction.ResponseStarted.IsZero() {
+			// No response headers arrived, so there is no timing to observe
+			return
+		}
+		transaction.ProxyOverhead = overhead
+		transaction.BodyOmitted = true
+		transaction.BodySize = int64(len(body))
+		if omitted {
+			transaction.BodySize = omittedSize.(int64)
+		}
+		transaction.ResponseFinished = time.Now()
+		ttfbMS, mbps := inventory.TransactionTiming(transaction)
+		p.sampler.Observe(transaction.SamplePattern, ttfbMS, mbps)
+		return
+	}
+
+	clientID := p.clientID(f)
+	bodyHash := requestBodyHash(f.Request)
+
+	// Find the most recent transaction for this request
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 
-				// Record response finish time
-				transaction.ResponseFinished = time.Now()
+	for i := len(p.transactions) - 1; i >= 0; i-- {
+		transaction := &p.transactions[i]
+		if transaction.Method == f.Request.Method && transaction.URL == f.Request.URL.String() &&
+			transaction.ClientID == clientID && transaction.RequestBodySHA256 == bodyHash && transaction.ResponseStarted.IsZero() {
+			responseStartTime := time.Now()
+			if stream != nil {
+				// Streams open before their first part, which may come much later
+				responseStartTime = stream.opened
+			} else if flushed != nil {
+				// The first flush arrives before the rest of the document is generated
+				responseStartTime = flushed.firstByte
+			}
+			transaction.ResponseStarted = responseStartTime
+			transaction.ProxyOverhead = overhead
+
+			// Record response details
+			statusCode := f.Response.StatusCode
+			transaction.StatusCode = &statusCode
 
-				// Track metrics
-				duration := transaction.ResponseFinished.Sub(transaction.RequestStarted)
-				success := transaction.StatusCode != nil && *transaction.StatusCode < 400
-				
-				if globalMetrics != nil {
-					globalMetrics.RecordRequest(transaction.Method, transaction.URL, duration, success)
-					globalMetrics.RecordBytesRecorded(int64(len(transaction.Body)))
+			// Copy headers
+			for name, values := range f.Response.Header {
+				if len(values) > 0 {
+					transaction.RawHeaders[name] = recordedHeaderValue(name, values)
 				}
+			}
 
-				// Log transaction
-				statusCode := "N/A"
-				if transaction.StatusCode != nil {
-					statusCode = fmt.Sprintf("%d", *transaction.StatusCode)
+			transaction.HeaderWarnings = headerWarnings(f.Request.Header, f.Response.Header)
+			for _, warning := range transaction.HeaderWarnings {
+				recordingLogger.Warn("Oversized headers may break clients on replay", "url", transaction.URL, "warning", warning)
+			}
+
+			// Record body
+			if body != nil {
+				transaction.Body = body
+			}
+			if omitted {
+				transaction.BodyOmitted = true
+				transaction.BodySize = omittedSize.(int64)
+				recordingLogger.Debug("Response body not recorded", "url", transaction.URL, "size", transaction.BodySize)
+			}
+
+			transaction.Informational = p.takeInformational(f, transaction.RequestStarted)
+			transaction.TLSSession, transaction.DomainTLS = p.tlsSessions.take(f)
+			transaction.Protocol = upstreamProtocol(f)
+			_, stripped := p.http3.LoadAndDelete(f)
+			transaction.AdvertisedHTTP3 = stripped || advertisesHTTP3(f.Response.Header)
+			if transaction.IPAddress = upstreamAddress(f); transaction.IPAddress != "" {
+				transaction.Resolver = p.resolver
+			}
+
+			// Streams end when the client stops reading, so only their complete parts are kept
+			if stream != nil {
+				for _, part := range stream.parts {
+					transaction.Parts = append(transaction.Parts, types.StreamPart{
+						OffsetMS: part.at.Sub(transaction.RequestStarted).Milliseconds(),
+						Size:     part.size,
+					})
+				}
+				if len(stream.parts) > 0 {
+					complete = true
 				}
-				slog.Debug("RECORDED", 
-					"method", transaction.Method,
+			}
+			if flushed != nil {
+				transaction.Flushes = flushed.points(transaction.RequestStarted)
+			}
+
+			// Detect partially received bodies
+			transaction.ExpectedLength = expectedBodyLength(f)
+			transaction.Truncated = !complete ||
+				(transaction.ExpectedLength != nil && transaction.BodyLength() < *transaction.ExpectedLength)
+			if transaction.Truncated {
+				recordingLogger.Warn("Response body truncated",
 					"url", transaction.URL,
-					"status", statusCode,
-					"duration_ms", duration.Milliseconds(),
-					"body_size", len(transaction.Body),
-				)
-				break
+					"bytes_received", transaction.BodyLength(),
+					"content_length", transaction.ExpectedLength)
+			}
+
+			// Record response finish time
+			transaction.ResponseFinished = time.Now()
+			transaction.Timings = p.takeTimings(f, transaction.TLSSession, transaction.ResponseFinished)
+			p.autosave.transactionFinished()
+
+			if transaction.SamplePattern != "" {
+				ttfbMS, mbps := inventory.TransactionTiming(transaction)
+				p.sampler.Observe(transaction.SamplePattern, ttfbMS, mbps)
+			}
+
+			// Track metrics
+			duration := transaction.ResponseFinished.Sub(transaction.RequestStarted)
+			success := transaction.StatusCode != nil && *transaction.StatusCode < 400
+			
+			if globalMetrics != nil {
+				globalMetrics.RecordRequest(transaction.Method, transaction.URL, duration, success)
+				globalMetrics.RecordBytesRecorded(int64(len(transaction.Body)))
 			}
+
+			// Log transaction
+			statusCodeText := "N/A"
+			if transaction.StatusCode != nil {
+				statusCodeText = fmt.Sprintf("%d", *transaction.StatusCode)
+			}
+			recordingLogger.Debug("RECORDED", 
+				"method", transaction.Method,
+				"url", transaction.URL,
+				"status", statusCodeText,
+				"duration_ms", duration.Milliseconds(),
+				"body_size", transaction.BodyLength(),
+				"truncated", transaction.Truncated,
+			)
+			return
 		}
-		p.mutex.Unlock()
 	}
 }
 
-// SaveInventory saves the recorded transactions to inventory
+// clientID returns the client identifier of the flow, or "" when clients are not tagged
+func (p *RecordingPlugin) clientID(f *proxy.Flow) string {
+	if p.clients == nil {
+		return ""
+	}
+	return p.clients.clientID(f)
+}
+
+// expectedBodyLength returns the Content-Length announced for a response that should carry a body
+func expectedBodyLength(f *proxy.Flow) *int64 {
+	if f.Request.Method == http.MethodHead ||
+		f.Response.StatusCode == http.StatusNoContent ||
+		f.Response.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	value := f.Response.Header.Get("Content-Length")
+	if value == "" {
+		return nil
+	}
+
+	length, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || length < 0 {
+		return nil
+	}
+	return &length
+}
+
+// captureReader copies everything read through it so a streamed body can be recorded
+type captureReader struct {
+	reader io.Reader
+	buffer bytes.Buffer
+	marks  []readMark
+	eof    bool
+	mutex  sync.Mutex
+	// limit makes larger bodies discarded; 0 keeps them all
+	limit int64
+	// discard only counts the bytes read, in size
+	discard bool
+	size    int64
+}
+
+func (r *captureReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+
+	r.mutex.Lock()
+	r.size += int64(n)
+	if !r.discard && r.limit > 0 && r.size > r.limit {
+		r.discard = true
+		r.buffer = bytes.Buffer{}
+		r.marks = nil
+	}
+	if !r.discard {
+		r.buffer.Write(b[:n])
+		if n > 0 {
+			r.marks = append(r.marks, readMark{at: time.Now(), end: r.buffer.Len()})
+		}
+	}
+	if err == io.EOF {
+		r.eof = true
+	}
+	r.mutex.Unlock()
+
+	return n, err
+}
+
+// result returns the captured bytes and whether the underlying reader was fully consumed
+func (r *captureReader) result() ([]byte, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.buffer.Bytes(), r.eof
+}
+
+// omitted returns the size of a body that was discarded instead of captured
+func (r *captureReader) omitted() (int64, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.size, r.discard
+}
+
+// readMarks returns when each read arrived
+func (r *captureReader) readMarks() []readMark {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.marks
+}
+
+// SaveInventory saves the recorded transactions to inventory and writes summary.json. A rotated
+// recording saves them as its last segment instead. It stops the rotation and autosave watchers.
+// HTML/CSS/JavaScript content is beautified in the background; see WaitBeautified.
 func (p *RecordingPlugin) SaveInventory() error {
+	if skipped := p.outOfScopeRequests.Load(); skipped > 0 {
+		recordingLogger.Info("Requests outside the recording scope were not recorded", "count", skipped)
+	}
+	p.stopOnce.Do(func() { close(p.stopped) })
+	if p.rotation != nil {
+		return p.rotate(true)
+	}
+	defer p.closeAutosave()()
+
+	// A previous save's content files must not be rewritten while they are beautified
+	p.beautifier.Wait()
+
 	p.mutex.RLock()
 	transactions := make([]types.RecordingTransaction, len(p.transactions))
 	copy(transactions, p.transactions)
 	p.mutex.RUnlock()
 
+	_, err := p.saveTransactions(p.inventoryDir, transactions, p.startedAt)
+	return err
+}
+
+// saveTransactions saves transactions as the inventory in dir with its summary.json, and returns
+// the summary. When nothing is left to save, only the empty summary is written.
+func (p *RecordingPlugin) saveTransactions(dir string, transactions []types.RecordingTransaction, startedAt time.Time) (*inventory.RecordingSummary, error) {
 	if len(transactions) == 0 {
-		slog.Warn("No transactions recorded to save")
+		recordingLogger.Warn("No transactions recorded to save")
+		return p.saveSummary(dir, transactions, startedAt)
+	}
+
+	if p.followRedirects {
+		transactions = p.fetchRedirectTargets(transactions)
+	}
+
+	for i := range transactions {
+		transactions[i].Samples = p.sampler.Stats(transactions[i].SamplePattern)
+	}
+
+	if len(p.postProcess) > 0 {
+		recorded := len(transactions)
+		processed, err := p.postProcess.Run(transactions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to post-process recording: %w", err)
+		}
+		transactions = processed
+		recordingLogger.Info("Recording post-processed", "hooks", len(p.postProcess), "transactions", len(transactions), "dropped", recorded-len(transactions))
+		if len(transactions) == 0 {
+			recordingLogger.Warn("Post-processing dropped every transaction")
+			return p.saveSummary(dir, transactions, startedAt)
+		}
+	}
+
+	summary := p.newSummary(transactions, startedAt)
+	pm := p.persistence(dir)
+	pm.Summary = summary
+	p.beautifiedBefore = p.beautifier.Beautified()
+	if p.splitDomains {
+		dirs, err := pm.SaveRecordedTransactionsByDomain(transactions, p.targetURL, p.noBeautify)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save inventory: %w", err)
+		}
+		recordingLogger.Info("Inventory saved per domain", "transactions", len(transactions), "domains", len(dirs), "directory", dir)
+	} else {
+		err := pm.SaveRecordedTransactionsWithOptions(transactions, p.targetURL, p.noBeautify)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save inventory: %w", err)
+		}
+		recordingLogger.Info("Inventory saved", "transactions", len(transactions), "directory", dir)
+	}
+
+	if err := pm.WriteSummary(summary); err != nil {
+		return nil, err
+	}
+	p.setSummary(summary, dir)
+	return summary, nil
+}
+
+// saveSummary writes only summary.json in dir, for a recording with no inventory to save, so
+// that it is still reported with its warning
+func (p *RecordingPlugin) saveSummary(dir string, transactions []types.RecordingTransaction, startedAt time.Time) (*inventory.RecordingSummary, error) {
+	summary := p.newSummary(transactions, startedAt)
+	if err := p.persistence(dir).WriteSummary(summary); err != nil {
+		return nil, err
+	}
+	p.setSummary(summary, dir)
+	return summary, nil
+}
+
+// newSummary summarizes the transactions saved for the recording started at startedAt
+func (p *RecordingPlugin) newSummary(transactions []types.RecordingTransaction, startedAt time.Time) *inventory.RecordingSummary {
+	summary := inventory.NewRecordingSummary(transactions, p.redaction.RedactURL(p.targetURL), startedAt)
+	summary.SampledOut = p.sampler.Skipped()
+	summary.StoppedLowDisk = p.diskGuard.stopped()
+	return summary
+}
+
+// setSummary keeps the summary saved in dir for Summary and WaitBeautified
+func (p *RecordingPlugin) setSummary(summary *inventory.RecordingSummary, dir string) {
+	p.mutex.Lock()
+	p.summary = summary
+	p.summaryDir = dir
+	p.mutex.Unlock()
+}
+
+// persistence returns the persistence manager saving the recording in dir with its options
+func (p *RecordingPlugin) persistence(dir string) *inventory.PersistenceManager {
+	pm := inventory.NewPersistenceManager(dir)
+	pm.Beautifier = p.beautifier
+	pm.Sync = p.sync
+	pm.NormalizeJSON = p.normalizeJSON
+	pm.KeepOriginals = p.keepOriginals
+	pm.Append = p.appendInventory
+	pm.Redaction = p.redaction
+	pm.KeepRepeats = p.keepRepeats
+	return pm
+}
+
+// WaitBeautified waits until the content saved by SaveInventory is beautified, then completes
+// summary.json with the number of beautified files
+func (p *RecordingPlugin) WaitBeautified() error {
+	if p.beautifier == nil {
 		return nil
 	}
+	p.beautifier.Wait()
 
-	pm := inventory.NewPersistenceManager(p.inventoryDir)
-	err := pm.SaveRecordedTransactionsWithOptions(transactions, p.targetURL, p.noBeautify)
-	if err != nil {
-		return fmt.Errorf("failed to save inventory: %w", err)
+	p.mutex.Lock()
+	summary := p.summary
+	dir := p.summaryDir
+	if summary != nil {
+		summary.Beautified += p.beautifier.Beautified() - p.beautifiedBefore
+		p.beautifiedBefore = p.beautifier.Beautified()
+	}
+	p.mutex.Unlock()
+	if summary == nil {
+		return nil
 	}
+	pm := inventory.NewPersistenceManager(dir)
+	pm.Sync = p.sync
+	return pm.WriteSummary(summary)
+}
+
+// Summary returns the summary of the last saved inventory, or nil
+func (p *RecordingPlugin) Summary() *inventory.RecordingSummary {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.summary
+}
 
-	slog.Info("Inventory saved", "transactions", len(transactions), "directory", p.inventoryDir)
-	return nil
+// DiskLow is closed when recording stops because free disk space fell below
+// RecordingOptions.MinFreeBytes; it is nil (never ready) when the check is disabled
+func (p *RecordingPlugin) DiskLow() <-chan struct{} {
+	if p.diskGuard == nil {
+		return nil
+	}
+	return p.diskGuard.low
 }
 
 // SetupSignalHandling sets up signal handling for graceful shutdown
 func (p *RecordingPlugin) SetupSignalHandling() {
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	go func() {
 		<-sigChan
-		slog.Info("Received interrupt signal, saving inventory...")
+		recordingLogger.Info("Received interrupt signal, saving inventory...")
 		if err := p.SaveInventory(); err != nil {
-			slog.Error("Failed to save inventory on shutdown", "error", err)
+			recordingLogger.Error("Failed to save inventory on shutdown", "error", err)
+		} else if err := p.WaitBeautified(); err != nil {
+			recordingLogger.Error("Failed to complete beautification on shutdown", "error", err)
 		}
 		os.Exit(0)
 	}()
@@ -182,4 +874,62 @@ func (p *RecordingPlugin) GetTransactionCount() int {
 	p.mutex.RLock()
 	defer p.mutex.RUnlock()
 	return len(p.transactions)
-}
\ No newline at end of file
+}
+
+// RecordingState is the capture state reported by the admin API
+type RecordingState struct {
+	Paused bool `json:"paused"`
+	// Transactions counts the recorded transactions, including those not finished yet
+	Transactions int `json:"transactions"`
+	// PausedRequests counts the requests proxied but not recorded while paused
+	PausedRequests int64 `json:"pausedRequests"`
+	// OutOfScopeRequests counts the requests proxied but not recorded because their host or URL is
+	// outside the recording scope
+	OutOfScopeRequests int64 `json:"outOfScopeRequests"`
+}
+
+// Pause stops recording new requests; they are still proxied upstream. Requests already in
+// flight are recorded when they finish.
+func (p *RecordingPlugin) Pause() {
+	if !p.paused.Swap(true) {
+		recordingLogger.Info("Recording paused")
+	}
+}
+
+// Resume records new requests again after Pause
+func (p *RecordingPlugin) Resume() {
+	if p.paused.Swap(false) {
+		recordingLogger.Info("Recording resumed", "not_recorded", p.pausedRequests.Load())
+	}
+}
+
+// State returns whether recording is paused and how many requests were recorded or passed over
+func (p *RecordingPlugin) State() RecordingState {
+	return RecordingState{
+		Paused:             p.paused.Load(),
+		Transactions:       p.GetTransactionCount(),
+		PausedRequests:     p.pausedRequests.Load(),
+		OutOfScopeRequests: p.outOfScopeRequests.Load(),
+	}
+}
+
+// skipPaused reports whether a new request goes unrecorded because recording is paused
+func (p *RecordingPlugin) skipPaused() bool {
+	if !p.paused.Load() {
+		return false
+	}
+	p.pausedRequests.Add(1)
+	return true
+}
+
+// upstreamAddress returns the IP address of the server connection a flow was answered on, if any
+func upstreamAddress(f *proxy.Flow) string {
+	if f.ConnContext == nil || f.ConnContext.ServerConn == nil || f.ConnContext.ServerConn.Conn == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(f.ConnContext.ServerConn.Conn.RemoteAddr().String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
@@ -1,15 +1,27 @@
 package plugins
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/credentials"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/postprocess"
+	"go-http-playback-proxy/pkg/sampling"
 	"go-http-playback-proxy/pkg/types"
 )
 
@@ -188,6 +200,57 @@ func TestRecordingPlugin_MultipleTransactions(t *testing.T) {
 	}
 }
 
+func TestRecordingPlugin_TruncatedBody(t *testing.T) {
+	tempDir := t.TempDir()
+
+	plugin, err := NewRecordingPluginWithInventoryDir("https://example.com", tempDir, true)
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	flow := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "GET",
+			URL:    parseURL(t, "https://example.com/video.mp4"),
+			Header: make(http.Header),
+		},
+	}
+	plugin.Request(flow)
+
+	flow.Response = &proxy.Response{
+		StatusCode: 200,
+		Header:     make(http.Header),
+		Body:       []byte("partial"),
+	}
+	flow.Response.Header.Set("Content-Length", "1000")
+	plugin.Response(flow)
+
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if err != nil {
+		t.Fatalf("Failed to read inventory: %v", err)
+	}
+
+	var inventory types.Inventory
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		t.Fatalf("Failed to unmarshal inventory: %v", err)
+	}
+
+	resource := inventory.Resources[0]
+	if resource.Truncated == nil || !*resource.Truncated {
+		t.Fatal("Expected resource to be marked truncated")
+	}
+	if resource.BytesReceived == nil || *resource.BytesReceived != 7 {
+		t.Errorf("Expected 7 bytes received, got %v", resource.BytesReceived)
+	}
+	if resource.ContentLength == nil || *resource.ContentLength != 1000 {
+		t.Errorf("Expected content length 1000, got %v", resource.ContentLength)
+	}
+}
+
 // Helper function to parse URL
 func parseURL(t *testing.T, urlStr string) *url.URL {
 	u, err := url.Parse(urlStr)
@@ -195,4 +258,1127 @@ func parseURL(t *testing.T, urlStr string) *url.URL {
 		t.Fatalf("Failed to parse URL %s: %v", urlStr, err)
 	}
 	return u
-}
\ No newline at end of file
+}
+func TestRecordingPlugin_InjectsCredentials(t *testing.T) {
+	rule, err := credentials.ParseBasicAuth("user:pass", "staging.example.com")
+	if err != nil {
+		t.Fatalf("Failed to parse credentials: %v", err)
+	}
+	plugin, err := NewRecordingPluginWithOptions("https://staging.example.com", t.TempDir(), RecordingOptions{
+		Credentials: credentials.NewInjector([]credentials.Rule{rule}),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	flow := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "POST",
+			URL:    parseURL(t, "https://staging.example.com/"),
+			Header: http.Header{"Cookie": {"a=1", "b=2"}, "Content-Type": {"application/x-www-form-urlencoded"}},
+			Body:   []byte("q=shoes"),
+		},
+	}
+	plugin.Requestheaders(flow)
+	if got := flow.Request.Header.Get("Authorization"); got != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Expected Basic authorization header, got %q", got)
+	}
+
+	// The request is recorded as the client sent it, without the injected credentials
+	plugin.Request(flow)
+	transaction := plugin.transactions[0]
+	if _, ok := transaction.RequestHeaders["Authorization"]; ok {
+		t.Error("Expected injected credentials to be left out of the recorded request headers")
+	}
+	if transaction.RequestHeaders["Cookie"] != "a=1; b=2" || string(transaction.RequestBody) != "q=shoes" {
+		t.Errorf("Unexpected recorded request: %v %q", transaction.RequestHeaders, transaction.RequestBody)
+	}
+
+	// Credentials must not leak to other hosts
+	other := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "GET",
+			URL:    parseURL(t, "https://cdn.example.net/app.js"),
+			Header: make(http.Header),
+		},
+	}
+	plugin.Requestheaders(other)
+	if got := other.Request.Header.Get("Authorization"); got != "" {
+		t.Errorf("Expected no authorization header for other host, got %q", got)
+	}
+}
+
+func TestRecordingPlugin_TagClients(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{TagClients: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	clientConn := &proxy.ClientConn{}
+	connCtx := &proxy.ConnContext{ClientConn: clientConn}
+
+	// The proxy auth user of a CONNECT applies to every request on the tunnel
+	connect := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: http.MethodConnect,
+			URL:    parseURL(t, "https://example.com:443"),
+			Header: make(http.Header),
+		},
+		ConnContext: connCtx,
+	}
+	connect.Request.Header.Set("Proxy-Authorization", "Basic YWxpY2U6c2VjcmV0") // alice:secret
+	plugin.Requestheaders(connect)
+
+	flow := &proxy.Flow{
+		Request: &proxy.Request{
+			Method: "GET",
+			URL:    parseURL(t, "https://example.com/"),
+			Header: make(http.Header),
+		},
+		ConnContext: connCtx,
+	}
+	plugin.Requestheaders(flow)
+	plugin.Request(flow)
+
+	plugin.mutex.RLock()
+	clientID := plugin.transactions[0].ClientID
+	plugin.mutex.RUnlock()
+	if clientID != "alice" {
+		t.Errorf("Expected client alice, got %q", clientID)
+	}
+	if connect.Request.Header.Get("Proxy-Authorization") != "" {
+		t.Error("Expected Proxy-Authorization to be removed")
+	}
+
+	plugin.ClientDisconnected(clientConn)
+	if _, ok := plugin.clients.users.Load(clientConn.Id); ok {
+		t.Error("Expected the user to be forgotten after disconnect")
+	}
+}
+
+func TestRecordingPlugin_Sampling(t *testing.T) {
+	tempDir := t.TempDir()
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{
+		Sampling: []sampling.Rule{{Pattern: "example.com/poll", Every: 5}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{
+				Method: "GET",
+				URL:    parseURL(t, "https://example.com/poll?t="+strconv.Itoa(i)),
+				Header: make(http.Header),
+			},
+		}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: make(http.Header), Body: []byte("{}")}
+		plugin.Responseheaders(flow)
+		plugin.Response(flow)
+	}
+
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if err != nil {
+		t.Fatalf("Failed to read inventory: %v", err)
+	}
+	var inventory types.Inventory
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		t.Fatalf("Failed to unmarshal inventory: %v", err)
+	}
+
+	if len(inventory.Resources) != 2 {
+		t.Fatalf("Expected 2 sampled resources, got %d", len(inventory.Resources))
+	}
+	samples := inventory.Resources[0].Samples
+	if samples == nil || samples.Observed != 10 || samples.Recorded != 2 {
+		t.Errorf("Expected statistics over all 10 responses, got %+v", samples)
+	}
+}
+
+func TestSplitStream_Multipart(t *testing.T) {
+	start := time.Now()
+	frame1 := "--frame\r\nContent-Type: image/jpeg\r\n\r\nAAAA"
+	frame2 := "\r\n--frame\r\nContent-Type: image/jpeg\r\n\r\nBBBB"
+	partial := "\r\n--frame\r\nContent-Type: image/jpeg\r\n\r\nCC"
+	body := []byte(frame1 + frame2 + partial)
+
+	// Each frame arrives in two reads, 100ms apart
+	marks := []readMark{
+		{at: start.Add(50 * time.Millisecond), end: 10},
+		{at: start.Add(100 * time.Millisecond), end: len(frame1)},
+		{at: start.Add(150 * time.Millisecond), end: len(frame1) + 10},
+		{at: start.Add(200 * time.Millisecond), end: len(frame1) + len(frame2)},
+		{at: start.Add(300 * time.Millisecond), end: len(body)},
+	}
+
+	parts, complete := splitStream("multipart/x-mixed-replace; boundary=frame", "", body, marks)
+	if complete != len(frame1)+len(frame2) {
+		t.Fatalf("Expected the unfinished frame to be dropped, got %d complete bytes", complete)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 parts, got %d", len(parts))
+	}
+	if parts[0].size != len(frame1) || !parts[0].at.Equal(start.Add(100*time.Millisecond)) {
+		t.Errorf("Unexpected first part: size=%d at=%v", parts[0].size, parts[0].at.Sub(start))
+	}
+	if parts[1].size != len(frame2) || !parts[1].at.Equal(start.Add(200*time.Millisecond)) {
+		t.Errorf("Unexpected second part: size=%d at=%v", parts[1].size, parts[1].at.Sub(start))
+	}
+
+	// The close delimiter completes the stream
+	closed := append(append([]byte{}, body[:complete]...), "\r\n--frame--\r\n"...)
+	marks = append(marks[:4], readMark{at: start.Add(250 * time.Millisecond), end: len(closed)})
+	if _, complete := splitStream("multipart/x-mixed-replace; boundary=frame", "", closed, marks); complete != len(closed) {
+		t.Errorf("Expected the closed stream to be complete, got %d of %d bytes", complete, len(closed))
+	}
+
+	// Boundaries cannot be found in a compressed body
+	if parts, complete := splitStream("multipart/x-mixed-replace; boundary=frame", "gzip", closed, marks); len(parts) != len(marks) || complete != len(closed) {
+		t.Errorf("Expected a gzip body to be split where data arrived, got %d parts and %d complete bytes", len(parts), complete)
+	}
+}
+
+func TestSplitStream_EventStream(t *testing.T) {
+	start := time.Now()
+	event1 := ": connected\n\n"
+	event2 := "event: update\r\ndata: {\"n\":1}\r\n\r\n"
+	event3 := "\ndata: second\ndata: line\n\n"
+	partial := "data: unfin"
+	body := []byte(event1 + event2 + event3 + partial)
+
+	// The first two events arrive in one read, the third in two reads
+	marks := []readMark{
+		{at: start.Add(10 * time.Millisecond), end: len(event1) + len(event2)},
+		{at: start.Add(100 * time.Millisecond), end: len(event1) + len(event2) + 8},
+		{at: start.Add(150 * time.Millisecond), end: len(event1) + len(event2) + len(event3)},
+		{at: start.Add(200 * time.Millisecond), end: len(body)},
+	}
+
+	parts, complete := splitStream("text/event-stream; charset=utf-8", "", body, marks)
+	if complete != len(event1)+len(event2)+len(event3) {
+		t.Fatalf("Expected the unfinished event to be dropped, got %d complete bytes", complete)
+	}
+	expected := []struct {
+		size int
+		at   time.Duration
+	}{
+		{len(event1), 10 * time.Millisecond},
+		{len(event2), 10 * time.Millisecond},
+		{len(event3), 150 * time.Millisecond},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("Expected %d events, got %d", len(expected), len(parts))
+	}
+	for i, e := range expected {
+		if parts[i].size != e.size || parts[i].at.Sub(start) != e.at {
+			t.Errorf("Event %d: size=%d at=%v, want size=%d at=%v", i, parts[i].size, parts[i].at.Sub(start), e.size, e.at)
+		}
+	}
+}
+
+func TestSplitStream_NDJSON(t *testing.T) {
+	start := time.Now()
+	line1 := "{\"token\":\"Hel\"}\n"
+	line2 := "{\"token\":\"lo\"}\r\n"
+	line3 := "\n{\"done\":true}\n"
+	partial := "{\"tok"
+	body := []byte(line1 + line2 + line3 + partial)
+
+	// The first two lines arrive in one read, the third in two reads
+	marks := []readMark{
+		{at: start.Add(10 * time.Millisecond), end: len(line1) + len(line2)},
+		{at: start.Add(80 * time.Millisecond), end: len(line1) + len(line2) + 4},
+		{at: start.Add(120 * time.Millisecond), end: len(line1) + len(line2) + len(line3) + 2},
+		{at: start.Add(200 * time.Millisecond), end: len(body)},
+	}
+
+	parts, complete := splitStream("application/x-ndjson", "", body, marks)
+	if complete != len(line1)+len(line2)+len(line3) {
+		t.Fatalf("Expected the unfinished line to be dropped, got %d complete bytes", complete)
+	}
+	expected := []struct {
+		size int
+		at   time.Duration
+	}{
+		{len(line1), 10 * time.Millisecond},
+		{len(line2), 10 * time.Millisecond},
+		{len(line3), 120 * time.Millisecond},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(parts))
+	}
+	for i, e := range expected {
+		if parts[i].size != e.size || parts[i].at.Sub(start) != e.at {
+			t.Errorf("Line %d: size=%d at=%v, want size=%d at=%v", i, parts[i].size, parts[i].at.Sub(start), e.size, e.at)
+		}
+	}
+
+	// Lines cannot be told apart in a compressed body
+	if parts, complete := splitStream("application/x-ndjson", "gzip", body, marks); len(parts) != len(marks) || complete != len(body) {
+		t.Errorf("Expected a gzip body to be split where data arrived, got %d parts and %d complete bytes", len(parts), complete)
+	}
+}
+
+func TestHTMLFlushes(t *testing.T) {
+	start := time.Now()
+	head := "<html><head><title>Flushed</title></head>"
+	body := []byte(head + "<body><p>later</p></body></html>")
+
+	// The head arrives in two quick reads, the body 300ms later
+	marks := []readMark{
+		{at: start.Add(20 * time.Millisecond), end: 10},
+		{at: start.Add(30 * time.Millisecond), end: len(head)},
+		{at: start.Add(330 * time.Millisecond), end: len(body)},
+	}
+
+	flushed := htmlFlushes(body, "", marks)
+	if flushed == nil || len(flushed.flushes) != 1 {
+		t.Fatalf("Expected one flush, got %+v", flushed)
+	}
+	points := flushed.points(start)
+	if points[0].OffsetMS != 30 || points[0].Tags != 5 {
+		t.Errorf("Expected a flush of 5 tags at 30ms, got %+v", points[0])
+	}
+	if !flushed.firstByte.Equal(marks[0].at) {
+		t.Errorf("Expected the first byte at the first read, got %v", flushed.firstByte.Sub(start))
+	}
+
+	// A document that arrives without a pause has no flushes
+	marks[2].at = start.Add(40 * time.Millisecond)
+	if flushed := htmlFlushes(body, "", marks); flushed != nil {
+		t.Errorf("Expected no flushes, got %+v", flushed.flushes)
+	}
+}
+
+func TestInformationalLog_CollectsInterimResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload; as=style")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Del("Link")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	started := time.Now()
+	log := &informationalLog{}
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{Got1xxResponse: log.add}))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	responses := log.since(started)
+	if len(responses) != 1 {
+		t.Fatalf("Expected 1 interim response, got %+v", responses)
+	}
+	if responses[0].StatusCode != http.StatusEarlyHints || responses[0].RawHeaders["Link"] != "</app.css>; rel=preload; as=style" {
+		t.Errorf("Unexpected interim response: %+v", responses[0])
+	}
+	if responses[0].OffsetMS < 0 {
+		t.Errorf("Expected a non-negative offset, got %d", responses[0].OffsetMS)
+	}
+}
+
+func TestPhaseTrace_Timings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// localhost is looked up, so the request goes through every phase of a new connection
+	trace := &phaseTrace{}
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	req, _ := http.NewRequest("GET", url, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+	client := &http.Client{Transport: &http.Transport{}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	timings := trace.timings(&types.TLSSession{HandshakeMS: 30}, time.Now())
+	if timings == nil {
+		t.Fatal("Expected timings")
+	}
+	if trace.dnsStart.IsZero() || trace.connectStart.IsZero() {
+		t.Error("Expected the lookup and connect to be traced")
+	}
+	if timings.WaitMS < 40 || timings.TLSMS != 30 || timings.SendMS < 0 || timings.ReceiveMS < 0 {
+		t.Errorf("Unexpected timings: %+v", timings)
+	}
+
+	// A request that never got a response has no timings
+	if timings := (&phaseTrace{}).timings(nil, time.Now()); timings != nil {
+		t.Errorf("Expected no timings, got %+v", timings)
+	}
+}
+
+func TestRecordingPlugin_PostProcess(t *testing.T) {
+	tempDir := t.TempDir()
+	dropAPI := postprocess.Func{Label: "drop-api", Fn: func(transactions []types.RecordingTransaction) ([]types.RecordingTransaction, error) {
+		var kept []types.RecordingTransaction
+		for _, transaction := range transactions {
+			if strings.Contains(transaction.URL, "/api/") {
+				continue
+			}
+			transaction.Tags = append(transaction.Tags, "page")
+			kept = append(kept, transaction)
+		}
+		return kept, nil
+	}}
+
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{
+		NoBeautify:  true,
+		PostProcess: postprocess.Pipeline{dropAPI},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	for _, rawURL := range []string{"https://example.com/", "https://example.com/api/data"} {
+		flow := &proxy.Flow{
+			Request: &proxy.Request{Method: "GET", URL: parseURL(t, rawURL), Header: make(http.Header)},
+		}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: make(http.Header), Body: []byte("body")}
+		plugin.Response(flow)
+	}
+
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if err != nil {
+		t.Fatalf("Failed to read inventory: %v", err)
+	}
+	var inv types.Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		t.Fatalf("Failed to parse inventory: %v", err)
+	}
+	if len(inv.Resources) != 1 || inv.Resources[0].URL != "https://example.com/" {
+		t.Fatalf("Expected only the page to be saved, got %+v", inv.Resources)
+	}
+	if len(inv.Resources[0].Tags) != 1 || inv.Resources[0].Tags[0] != "page" {
+		t.Errorf("Expected the page tag, got %v", inv.Resources[0].Tags)
+	}
+}
+
+func TestRecordingPlugin_FollowRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/middle":
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+		case "/final":
+			w.Write([]byte("done"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tempDir := t.TempDir()
+	plugin, err := NewRecordingPluginWithOptions(server.URL, tempDir, RecordingOptions{NoBeautify: true, FollowRedirects: true})
+	if err != nil {
+		t.Fatalf("Failed to create plugin: %v", err)
+	}
+
+	// The client stopped at the first redirect
+	flow := &proxy.Flow{
+		Request: &proxy.Request{Method: "GET", URL: parseURL(t, server.URL+"/start"), Header: make(http.Header)},
+	}
+	plugin.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 302, Header: http.Header{"Location": {"/middle#top"}}}
+	plugin.Response(flow)
+
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+	if err != nil {
+		t.Fatalf("Failed to read inventory: %v", err)
+	}
+	var inv types.Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		t.Fatalf("Failed to parse inventory: %v", err)
+	}
+
+	statuses := make(map[string]int)
+	for _, resource := range inv.Resources {
+		if resource.StatusCode != nil {
+			statuses[resource.URL] = *resource.StatusCode
+		}
+	}
+	expected := map[string]int{
+		server.URL + "/start":  302,
+		server.URL + "/middle": 301,
+		server.URL + "/final":  200,
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected the whole redirect chain to be recorded, got %v", statuses)
+	}
+	for rawURL, status := range expected {
+		if statuses[rawURL] != status {
+			t.Errorf("Expected %s to be recorded with %d, got %d", rawURL, status, statuses[rawURL])
+		}
+	}
+}
+
+// TestHeaderWarnings tests that headers and cookies over common client limits are flagged
+func TestHeaderWarnings(t *testing.T) {
+	request := http.Header{"Cookie": []string{"sid=" + strings.Repeat("a", 20*1024)}}
+	response := http.Header{
+		"Content-Type": []string{"text/html"},
+		"Set-Cookie":   []string{"small=1; Path=/", " big=" + strings.Repeat("b", 5000) + "; Path=/"},
+	}
+
+	warnings := headerWarnings(request, response)
+	if len(warnings) != 2 {
+		t.Fatalf("Expected 2 warnings, got %v", warnings)
+	}
+	if !strings.HasPrefix(warnings[0], "request headers are ") {
+		t.Errorf("Expected a request header warning, got %q", warnings[0])
+	}
+	if !strings.HasPrefix(warnings[1], "cookie big is ") {
+		t.Errorf("Expected a cookie warning for big, got %q", warnings[1])
+	}
+
+	if warnings := headerWarnings(http.Header{}, http.Header{"Content-Type": []string{"text/html"}}); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for small headers, got %v", warnings)
+	}
+}
+
+// TestRecordingPlugin_DiskGuard tests that recording stops, and the inventory is still saved, when free space runs low
+func TestRecordingPlugin_DiskGuard(t *testing.T) {
+	tempDir := t.TempDir()
+	// The guard is disabled by default
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	if plugin.DiskLow() != nil {
+		t.Error("Expected no disk guard without MinFreeBytes")
+	}
+
+	guard := newDiskGuard(tempDir, 1)
+	plugin.diskGuard = guard
+	record := func(path string) {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: http.Header{}}}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+	if guard.check() {
+		t.Fatal("Expected more than one free byte")
+	}
+	record("/before")
+
+	// No filesystem has this much room
+	guard.minFree = 1 << 62
+	if !guard.check() {
+		t.Fatal("Expected the guard to trip")
+	}
+	select {
+	case <-plugin.DiskLow():
+	default:
+		t.Error("Expected DiskLow to be closed")
+	}
+	record("/after")
+	if count := plugin.GetTransactionCount(); count != 1 {
+		t.Errorf("Expected recording to stop after the guard tripped, got %d transactions", count)
+	}
+
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	if summary := plugin.Summary(); summary == nil || !summary.StoppedLowDisk {
+		t.Errorf("Expected the summary to note the early stop, got %+v", summary)
+	}
+}
+
+// TestRecordingPlugin_EmptySummary tests that a recording without transactions still writes its summary
+func TestRecordingPlugin_EmptySummary(t *testing.T) {
+	tempDir := t.TempDir()
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	if summary := plugin.Summary(); summary == nil || summary.Requests != 0 {
+		t.Fatalf("Expected an empty summary, got %+v", summary)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, inventory.SummaryFile)); err != nil {
+		t.Errorf("Expected summary.json to be written: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "inventory.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected no inventory.json without transactions, got %v", err)
+	}
+}
+
+// TestRecordingPlugin_Pause tests that requests made while paused are proxied but left out of the inventory
+func TestRecordingPlugin_Pause(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	record := func(path string) {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: http.Header{}}}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+
+	record("/before")
+	plugin.Pause()
+	record("/login")
+	record("/login/callback")
+	if state := plugin.State(); !state.Paused || state.Transactions != 1 || state.PausedRequests != 2 {
+		t.Errorf("Expected 1 transaction and 2 requests passed over while paused, got %+v", state)
+	}
+	plugin.Resume()
+	record("/after")
+
+	var urls []string
+	for _, transaction := range plugin.transactions {
+		urls = append(urls, transaction.URL)
+	}
+	if strings.Join(urls, " ") != "https://example.com/before https://example.com/after" {
+		t.Errorf("Expected only the requests outside the pause to be recorded, got %v", urls)
+	}
+	if state := plugin.State(); state.Paused {
+		t.Error("Expected recording to be resumed")
+	}
+}
+
+func TestRecordingPlugin_TLSSessions(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	serverConn := &proxy.ServerConn{}
+	connCtx := &proxy.ConnContext{ServerConn: serverConn}
+	plugin.ServerConnected(connCtx)
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	plugin.tlsSessions.established(serverConn, &tls.ConnectionState{
+		Version:     tls.VersionTLS13,
+		CipherSuite: tls.TLS_AES_128_GCM_SHA256,
+		DidResume:   true,
+		PeerCertificates: []*x509.Certificate{{
+			Subject:  pkix.Name{CommonName: "example.com"},
+			Issuer:   pkix.Name{CommonName: "Example CA"},
+			NotAfter: expires,
+		}},
+	})
+
+	// Only the first response on the connection opened it
+	for _, path := range []string{"/", "/app.js"} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: http.Header{}}, ConnContext: connCtx}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+
+	plugin.mutex.RLock()
+	first, second := plugin.transactions[0].TLSSession, plugin.transactions[1].TLSSession
+	summary := inventory.NewRecordingSummary(plugin.transactions, "https://example.com", time.Now())
+	plugin.mutex.RUnlock()
+	if first == nil || first.Version != "TLS 1.3" || !first.Resumed {
+		t.Errorf("Expected a resumed TLS 1.3 handshake on the first request, got %+v", first)
+	}
+	if second != nil {
+		t.Errorf("Expected no handshake on the reused connection, got %+v", second)
+	}
+	domains := inventory.RecordedDomains(plugin.transactions)
+	if len(domains) != 1 || domains[0].TLS == nil {
+		t.Fatalf("Expected the TLS details on the domain, got %+v", domains)
+	}
+	details := domains[0].TLS
+	if details.CipherSuite != "TLS_AES_128_GCM_SHA256" || !details.Resumed || len(details.Certificates) != 1 {
+		t.Errorf("Unexpected TLS details: %+v", details)
+	}
+	if certificate := details.Certificates[0]; certificate.Subject != "CN=example.com" || certificate.Issuer != "CN=Example CA" || !certificate.NotAfter.Equal(expires) {
+		t.Errorf("Unexpected certificate: %+v", certificate)
+	}
+	if summary.TLSHandshakes != 1 || summary.TLSResumed != 1 {
+		t.Errorf("Expected 1 resumed handshake in the summary, got %d/%d", summary.TLSHandshakes, summary.TLSResumed)
+	}
+
+	plugin.ServerDisconnected(connCtx)
+	if _, ok := plugin.tlsSessions.connections.Load(serverConn); ok {
+		t.Error("Expected the connection to be forgotten after disconnect")
+	}
+}
+
+// TestRecordingPlugin_Rotation tests that finished transactions are saved as replayable segments
+// listed in the manifest, while unfinished ones wait for a later segment
+func TestRecordingPlugin_Rotation(t *testing.T) {
+	tempDir := t.TempDir()
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{
+		NoBeautify:  true,
+		RotateBytes: 1 << 40,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	request := func(path string) *proxy.Flow {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: http.Header{}}}
+		plugin.Request(flow)
+		return flow
+	}
+	respond := func(flow *proxy.Flow) {
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("segment body")}
+		plugin.Response(flow)
+	}
+
+	respond(request("/first"))
+	pending := request("/pending")
+	if plugin.rotationDue() {
+		t.Error("Expected no rotation below the size limit")
+	}
+	plugin.rotation.maxBytes = 10
+	if !plugin.rotationDue() {
+		t.Error("Expected a rotation once the finished bodies reach the limit")
+	}
+	if err := plugin.rotate(false); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if count := plugin.GetTransactionCount(); count != 1 {
+		t.Errorf("Expected the pending transaction to stay in memory, got %d transactions", count)
+	}
+
+	respond(pending)
+	respond(request("/second"))
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	manifest, err := inventory.LoadSegmentManifest(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if len(manifest.Segments) != 2 || manifest.Segments[0].Requests != 1 || manifest.Segments[1].Requests != 2 {
+		t.Fatalf("Unexpected segments: %+v", manifest.Segments)
+	}
+	if manifest.Segments[1].Dir != "segments/0002" || manifest.EntryURL != "https://example.com" {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+
+	// Every segment is an inventory of its own
+	for i, segment := range manifest.Segments {
+		data, err := os.ReadFile(filepath.Join(tempDir, filepath.FromSlash(segment.Dir), "inventory.json"))
+		if err != nil {
+			t.Fatalf("Failed to read segment %d: %v", i+1, err)
+		}
+		inv, err := inventory.DecodeInventory(data)
+		if err != nil {
+			t.Fatalf("Failed to load segment %d: %v", i+1, err)
+		}
+		if len(inv.Resources) != segment.Requests {
+			t.Errorf("Segment %d: expected %d resources, got %d", i+1, segment.Requests, len(inv.Resources))
+		}
+	}
+
+	// A new recording continues the numbering
+	next, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{NoBeautify: true, RotateInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	if segments := next.Segments(); len(segments.Segments) != 2 {
+		t.Errorf("Expected the earlier segments to be kept, got %+v", segments)
+	}
+}
+
+// TestRecordingPlugin_Autosave tests that finished transactions are added to the inventory while
+// recording, and that the final save still writes the whole recording
+func TestRecordingPlugin_Autosave(t *testing.T) {
+	tempDir := t.TempDir()
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", tempDir, RecordingOptions{
+		NoBeautify:    true,
+		AutosaveCount: 2,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+
+	request := func(path string) *proxy.Flow {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com"+path), Header: http.Header{}}}
+		plugin.Request(flow)
+		return flow
+	}
+	respond := func(flow *proxy.Flow) {
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+	resources := func() int {
+		data, err := os.ReadFile(filepath.Join(tempDir, "inventory.json"))
+		if err != nil {
+			return 0
+		}
+		inv, err := inventory.DecodeInventory(data)
+		if err != nil {
+			return 0
+		}
+		return len(inv.Resources)
+	}
+
+	respond(request("/first"))
+	pending := request("/pending")
+	respond(request("/second"))
+	deadline := time.Now().Add(5 * time.Second)
+	for resources() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := resources(); count != 2 {
+		t.Fatalf("Expected the 2 finished transactions to be autosaved, got %d resources", count)
+	}
+
+	// The next autosave adds only what finished since
+	respond(pending)
+	if err := plugin.Autosave(); err != nil {
+		t.Fatalf("Failed to autosave: %v", err)
+	}
+	if count := resources(); count != 3 {
+		t.Errorf("Expected the pending transaction to be added, got %d resources", count)
+	}
+
+	respond(request("/third"))
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+	if count := resources(); count != 4 {
+		t.Errorf("Expected the final save to write every transaction, got %d resources", count)
+	}
+	if err := plugin.Autosave(); err != nil {
+		t.Errorf("Expected autosaves after the final save to be skipped, got %v", err)
+	}
+}
+
+// TestRecordingPlugin_StopWatchers tests that the final save stops the rotation and autosave
+// watchers, and that autosaving is refused for a rotated recording
+func TestRecordingPlugin_StopWatchers(t *testing.T) {
+	if _, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{
+		NoBeautify:       true,
+		AutosaveInterval: time.Minute,
+		RotateInterval:   time.Hour,
+	}); err == nil {
+		t.Error("Expected autosaving a rotated recording to be refused")
+	}
+
+	for _, opts := range []RecordingOptions{
+		{NoBeautify: true, AutosaveInterval: time.Hour},
+		{NoBeautify: true, RotateInterval: time.Hour},
+	} {
+		plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), opts)
+		if err != nil {
+			t.Fatalf("Failed to create recording plugin: %v", err)
+		}
+		if err := plugin.SaveInventory(); err != nil {
+			t.Fatalf("Failed to save inventory: %v", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if opts.AutosaveInterval > 0 {
+				plugin.watchAutosave()
+			} else {
+				plugin.watchRotation(time.Hour)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected the watcher to stop after the final save with %+v", opts)
+		}
+	}
+}
+
+// TestRecordingPlugin_LinkHeaders tests that every Link header of a response is recorded
+func TestRecordingPlugin_LinkHeaders(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}}}
+	plugin.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{
+		"Content-Type": {"text/html"},
+		"Link":         {"</app.css>; rel=preload; as=style", "<https://cdn.example.com>; rel=preconnect"},
+		"Vary":         {"Accept-Encoding", "Cookie"},
+	}, Body: []byte("<html></html>")}
+	plugin.Response(flow)
+
+	plugin.mutex.RLock()
+	headers := plugin.transactions[0].RawHeaders
+	plugin.mutex.RUnlock()
+	if headers["Link"] != "</app.css>; rel=preload; as=style, <https://cdn.example.com>; rel=preconnect" {
+		t.Errorf("Expected both Link headers, got %q", headers["Link"])
+	}
+	if headers["Vary"] != "Accept-Encoding" {
+		t.Errorf("Expected other headers to keep their first value, got %q", headers["Vary"])
+	}
+}
+
+// TestRecordingPlugin_RecoverPanic tests that a recovered panic is reported so the recording is saved
+func TestRecordingPlugin_RecoverPanic(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	select {
+	case <-plugin.Panicked():
+		t.Fatal("Expected no panic yet")
+	default:
+	}
+
+	for i := 0; i < 2; i++ {
+		func() {
+			defer plugin.recoverPanic("test")
+			panic("boom")
+		}()
+	}
+	select {
+	case <-plugin.Panicked():
+	default:
+		t.Error("Expected Panicked to be closed")
+	}
+}
+
+func TestRecordingPlugin_DomainScope(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{
+		NoBeautify:     true,
+		IncludeDomains: []string{"example.com", "*.example.com"},
+		ExcludeDomains: []string{"ads.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	for _, target := range []string{
+		"https://example.com/",
+		"https://CDN.example.com/app.js",
+		"https://ads.example.com/banner.js",
+		"https://www.google-analytics.com/collect",
+		"https://example.com.evil.test/",
+	} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, target), Header: http.Header{}}}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+
+	var urls []string
+	for _, transaction := range plugin.transactions {
+		urls = append(urls, transaction.URL)
+	}
+	if strings.Join(urls, " ") != "https://example.com/ https://CDN.example.com/app.js" {
+		t.Errorf("Expected only the requests in the domain scope to be recorded, got %v", urls)
+	}
+	if state := plugin.State(); state.OutOfScopeRequests != 3 {
+		t.Errorf("Expected 3 requests outside the scope, got %d", state.OutOfScopeRequests)
+	}
+
+	if _, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{IncludeDomains: []string{"[example.com"}}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
+
+func TestRecordingPlugin_URLScope(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{
+		NoBeautify:  true,
+		IncludeURLs: []string{`^https://example\.com/`},
+		ExcludeURLs: []string{`/health$`, `/beacon\?`},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	for _, target := range []string{
+		"https://example.com/",
+		"https://example.com/health",
+		"https://example.com/beacon?event=view",
+		"https://example.com/api/items?page=2",
+		"https://cdn.example.net/app.js",
+	} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, target), Header: http.Header{}}}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+
+	var urls []string
+	for _, transaction := range plugin.transactions {
+		urls = append(urls, transaction.URL)
+	}
+	if strings.Join(urls, " ") != "https://example.com/ https://example.com/api/items?page=2" {
+		t.Errorf("Expected only the URLs in scope to be recorded, got %v", urls)
+	}
+	if state := plugin.State(); state.OutOfScopeRequests != 3 {
+		t.Errorf("Expected 3 requests outside the scope, got %d", state.OutOfScopeRequests)
+	}
+
+	if _, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{ExcludeURLs: []string{"("}}); err == nil {
+		t.Error("Expected an invalid expression to be rejected")
+	}
+}
+
+func TestRecordingPlugin_BodyLimit(t *testing.T) {
+	dir := t.TempDir()
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", dir, RecordingOptions{
+		NoBeautify:       true,
+		MaxBodySize:      16,
+		SkipContentTypes: []string{"video/*"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	for _, response := range []struct {
+		target      string
+		contentType string
+		body        string
+	}{
+		{"https://example.com/", "text/plain", "ok"},
+		{"https://example.com/large.txt", "text/plain", strings.Repeat("x", 100)},
+		{"https://example.com/clip.mp4", "video/mp4", "tiny video"},
+	} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, response.target), Header: http.Header{}}}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {response.contentType}}, Body: []byte(response.body)}
+		plugin.Response(flow)
+	}
+	if err := plugin.SaveInventory(); err != nil {
+		t.Fatalf("Failed to save inventory: %v", err)
+	}
+
+	manager := inventory.NewPlaybackManager(dir)
+	manager.ChunkSize = 32
+	transactions, err := manager.LoadPlaybackTransactions()
+	if err != nil {
+		t.Fatalf("Failed to load playback transactions: %v", err)
+	}
+	sizes := map[string]int{}
+	for _, transaction := range transactions {
+		var body []byte
+		for _, chunk := range transaction.Chunks {
+			body = append(body, chunk.Chunk...)
+		}
+		sizes[transaction.URL] = len(body)
+		if strings.HasSuffix(transaction.URL, "/large.txt") && strings.Trim(string(body), "\x00") != "" {
+			t.Errorf("Expected the omitted body to be padding, got %q", body)
+		}
+		if transaction.RawHeaders["Content-Length"] != strconv.Itoa(len(body)) {
+			t.Errorf("Expected Content-Length %d for %s, got %q", len(body), transaction.URL, transaction.RawHeaders["Content-Length"])
+		}
+	}
+	if sizes["https://example.com/"] != 2 || sizes["https://example.com/large.txt"] != 100 || sizes["https://example.com/clip.mp4"] != 10 {
+		t.Errorf("Expected bodies of the recorded sizes, got %v", sizes)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "contents", "get", "https", "example.com", "index.html")); err != nil {
+		t.Errorf("Expected a content file for the recorded body: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "contents", "get", "https", "example.com", "large.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no content file for the omitted body, got %v", err)
+	}
+
+	capture := plugin.bodyLimit.capture(strings.NewReader(strings.Repeat("y", 40)), "text/plain")
+	if _, err := io.ReadAll(capture); err != nil {
+		t.Fatalf("Failed to read through the capture: %v", err)
+	}
+	if size, omitted := capture.omitted(); !omitted || size != 40 {
+		t.Errorf("Expected a streamed body over the limit to be counted only, got %d (%v)", size, omitted)
+	}
+}
+
+func TestRecordingPlugin_ProxyOverhead(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Header: http.Header{}}}
+	plugin.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+	plugin.Responseheaders(flow)
+	plugin.Response(flow)
+
+	if overhead := plugin.transactions[0].ProxyOverhead; overhead <= 0 {
+		t.Errorf("Expected the time spent in the hooks to be counted, got %v", overhead)
+	}
+	if _, counted := plugin.overhead.flows.Load(flow); counted {
+		t.Error("Expected the overhead of a recorded flow to be forgotten")
+	}
+
+	// The overhead is left out of the TTFB
+	started := time.Now()
+	transaction := &types.RecordingTransaction{
+		RequestStarted:  started,
+		ResponseStarted: started.Add(100 * time.Millisecond),
+		ProxyOverhead:   30 * time.Millisecond,
+	}
+	if ttfbMS, _ := inventory.TransactionTiming(transaction); ttfbMS != 70 {
+		t.Errorf("Expected a TTFB of 70ms, got %d", ttfbMS)
+	}
+}
+
+func TestRecordingPlugin_Protocol(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	for _, proto := range []string{"HTTP/2.0", "HTTP/1.1"} {
+		flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"+proto), Proto: proto, Header: http.Header{}}}
+		plugin.Request(flow)
+		flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{"Content-Type": {"text/plain"}}, Body: []byte("ok")}
+		plugin.Response(flow)
+	}
+
+	if protocol := plugin.transactions[0].Protocol; protocol != types.ProtocolHTTP2 {
+		t.Errorf("Expected HTTP/2, got %q", protocol)
+	}
+	if protocol := plugin.transactions[1].Protocol; protocol != types.ProtocolHTTP1 {
+		t.Errorf("Expected HTTP/1.1, got %q", protocol)
+	}
+}
+
+func TestRecordingPlugin_StripAltSvc(t *testing.T) {
+	plugin, err := NewRecordingPluginWithOptions("https://example.com", t.TempDir(), RecordingOptions{NoBeautify: true, StripAltSvc: true})
+	if err != nil {
+		t.Fatalf("Failed to create recording plugin: %v", err)
+	}
+	flow := &proxy.Flow{Request: &proxy.Request{Method: "GET", URL: parseURL(t, "https://example.com/"), Proto: "HTTP/2.0", Header: http.Header{}}}
+	plugin.Request(flow)
+	flow.Response = &proxy.Response{StatusCode: 200, Header: http.Header{
+		"Content-Type": {"text/plain"},
+		"Alt-Svc":      {`h3=":443"; ma=86400, h3-29=":443"; ma=86400`},
+	}, Body: []byte("ok")}
+	plugin.Responseheaders(flow)
+	if value := flow.Response.Header.Get("Alt-Svc"); value != "" {
+		t.Errorf("Expected Alt-Svc to be stripped, got %q", value)
+	}
+	plugin.Response(flow)
+
+	transaction := plugin.transactions[0]
+	if !transaction.AdvertisedHTTP3 {
+		t.Error("Expected the HTTP/3 advertisement to be recorded")
+	}
+	if _, ok := transaction.RawHeaders["Alt-Svc"]; ok {
+		t.Error("Expected Alt-Svc to be left out of the recorded headers")
+	}
+	domains := inventory.RecordedDomains(plugin.transactions)
+	if len(domains) != 1 || domains[0].Name != "example.com" || !domains[0].HTTP3 {
+		t.Errorf("Expected example.com to be marked as advertising HTTP/3, got %+v", domains)
+	}
+}
@@ -0,0 +1,161 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+const (
+	// maxRedirectHops bounds how far a redirect chain is followed after recording
+	maxRedirectHops = 10
+	// redirectFetchTimeout bounds each fetch of a redirect target
+	redirectFetchTimeout = 30 * time.Second
+)
+
+// redirectTarget returns the request a client makes to follow a recorded redirect
+func redirectTarget(transaction *types.RecordingTransaction) (method, target string, ok bool) {
+	if transaction.StatusCode == nil {
+		return "", "", false
+	}
+	switch *transaction.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		method = http.MethodGet
+		if transaction.Method == http.MethodHead {
+			method = http.MethodHead
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		// The method is kept, and bodies of other methods are not recorded
+		if transaction.Method != http.MethodGet && transaction.Method != http.MethodHead {
+			return "", "", false
+		}
+		method = transaction.Method
+	default:
+		return "", "", false
+	}
+
+	location := transaction.RawHeaders["Location"]
+	if location == "" {
+		return "", "", false
+	}
+	base, err := url.Parse(transaction.URL)
+	if err != nil {
+		return "", "", false
+	}
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", "", false
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", "", false
+	}
+	resolved.Fragment = ""
+	return method, resolved.String(), true
+}
+
+// fetchRedirectTargets fetches and appends the targets of recorded redirects the client never
+// requested, so every redirect chain in the inventory ends in a recorded response
+func (p *RecordingPlugin) fetchRedirectTargets(transactions []types.RecordingTransaction) []types.RecordingTransaction {
+	recorded := make(map[string]bool, len(transactions))
+	for _, transaction := range transactions {
+		recorded[transaction.Method+" "+transaction.URL] = true
+	}
+
+	client := &http.Client{
+		Timeout: redirectFetchTimeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			// Matches the proxy, which does not verify upstream certificates either
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		// Each hop is recorded as its own transaction
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// hops counts the redirects that led to each fetched transaction, by index
+	hops := make(map[int]int)
+	fetched := 0
+	for i := 0; i < len(transactions); i++ {
+		method, target, ok := redirectTarget(&transactions[i])
+		if !ok || recorded[method+" "+target] {
+			continue
+		}
+		if targetURL, err := url.Parse(target); err == nil && !p.scope.records(targetURL) {
+			continue
+		}
+		recorded[method+" "+target] = true
+
+		if hops[i]+1 > maxRedirectHops {
+			recordingLogger.Warn("Redirect chain too long, not following", "url", target, "hops", hops[i]+1)
+			continue
+		}
+
+		transaction, err := p.fetchRedirectTarget(client, method, target, transactions[i].ClientID)
+		if err != nil {
+			recordingLogger.Warn("Failed to fetch redirect target", "url", target, "error", err)
+			continue
+		}
+		hops[len(transactions)] = hops[i] + 1
+		// Appended transactions are visited by this loop, so the chain is followed to its end
+		transactions = append(transactions, transaction)
+		fetched++
+		recordingLogger.Debug("RECORDED redirect target", "method", method, "url", target, "status", *transaction.StatusCode)
+	}
+
+	if fetched > 0 {
+		recordingLogger.Info("Recorded unvisited redirect targets", "count", fetched)
+	}
+	return transactions
+}
+
+// fetchRedirectTarget requests a redirect target directly and records the response as received
+func (p *RecordingPlugin) fetchRedirectTarget(client *http.Client, method, target, clientID string) (types.RecordingTransaction, error) {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return types.RecordingTransaction{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Setting Accept-Encoding keeps the body encoded as the server sent it, like proxied responses
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	p.credentials.Apply(req.URL.Hostname(), req.Header)
+
+	transaction := types.RecordingTransaction{
+		Method:         method,
+		URL:            target,
+		RequestStarted: time.Now(),
+		RawHeaders:     make(types.HttpHeaders),
+		ClientID:       clientID,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return types.RecordingTransaction{}, err
+	}
+	defer resp.Body.Close()
+	transaction.ResponseStarted = time.Now()
+
+	statusCode := resp.StatusCode
+	transaction.StatusCode = &statusCode
+	for name, values := range resp.Header {
+		if len(values) > 0 {
+			transaction.RawHeaders[name] = recordedHeaderValue(name, values)
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	transaction.Body = body
+	if resp.ContentLength >= 0 {
+		expected := resp.ContentLength
+		transaction.ExpectedLength = &expected
+	}
+	transaction.Truncated = err != nil ||
+		(transaction.ExpectedLength != nil && int64(len(body)) < *transaction.ExpectedLength)
+	transaction.ResponseFinished = time.Now()
+	return transaction, nil
+}
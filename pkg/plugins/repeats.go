@@ -0,0 +1,67 @@
+package plugins
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Orders the responses kept for the same request are replayed in
+const (
+	// RepeatsSequence replays the responses in recorded order, then keeps answering with the last
+	RepeatsSequence = "sequence"
+	// RepeatsRoundRobin replays the responses in recorded order and starts over after the last
+	RepeatsRoundRobin = "round-robin"
+)
+
+// repeatCycle holds the responses kept for the same request, in recorded order
+type repeatCycle struct {
+	states []*transactionState
+	served atomic.Int64
+}
+
+// next returns the response answering the next request
+func (c *repeatCycle) next(roundRobin bool) *transactionState {
+	n := int(c.served.Add(1) - 1)
+	if roundRobin {
+		return c.states[n%len(c.states)]
+	}
+	return c.states[min(n, len(c.states)-1)]
+}
+
+// repeatKey tells apart the requests responses are kept for, including their variants
+func repeatKey(transaction *types.PlaybackTransaction) string {
+	return fmt.Sprintf("%s:%s %t %s %s %s", transaction.Method, transaction.URL, transaction.Fetch.IsPrefetch(),
+		transaction.Accept, transaction.Language, transaction.RequestBodySHA256)
+}
+
+// attachRepeats replays the responses kept after the first for a request in turn with the first
+func (p *PlaybackPlugin) attachRepeats(repeated []types.PlaybackTransaction) {
+	p.repeats = make(map[*transactionState]*repeatCycle)
+	if len(repeated) == 0 {
+		return
+	}
+
+	firsts := make(map[string]*transactionState)
+	p.eachState(func(state *transactionState) {
+		firsts[repeatKey(state.PlaybackTransaction)] = state
+	})
+	sort.SliceStable(repeated, func(i, j int) bool {
+		return repeated[i].Repeat < repeated[j].Repeat
+	})
+	for i := range repeated {
+		first, ok := firsts[repeatKey(&repeated[i])]
+		if !ok {
+			playbackLogger.Warn("Repeated response without its first response", "method", repeated[i].Method, "url", repeated[i].URL, "repeat", repeated[i].Repeat)
+			continue
+		}
+		cycle, ok := p.repeats[first]
+		if !ok {
+			cycle = &repeatCycle{states: []*transactionState{first}}
+			p.repeats[first] = cycle
+		}
+		cycle.states = append(cycle.states, newTransactionState(&repeated[i]))
+	}
+}
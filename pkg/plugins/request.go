@@ -0,0 +1,51 @@
+package plugins
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// requestHeaders returns the headers a client sent, leaving out the proxy's own headers and the
+// credentials injected from the command line so they never end up in an inventory
+func requestHeaders(header http.Header, injected []string) types.HttpHeaders {
+	headers := make(types.HttpHeaders, len(header))
+	for name, values := range header {
+		if len(values) == 0 || name == "Proxy-Authorization" || name == "Proxy-Connection" {
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+		if name == "Cookie" {
+			headers[name] = strings.Join(values, "; ")
+		}
+	}
+	for _, name := range injected {
+		delete(headers, name)
+	}
+	return headers
+}
+
+// recordedRequestBody returns the body of a request to record, or nil if it is empty or too large
+func recordedRequestBody(req *proxy.Request) []byte {
+	if len(req.Body) == 0 || len(req.Body) > inventory.MaxRequestBodySize {
+		return nil
+	}
+	return req.Body
+}
+
+// requestBodyHash returns the hash of the normalized body of a request, or "" if it has none
+func requestBodyHash(req *proxy.Request) string {
+	return inventory.RequestBodyHash(req.Header.Get("Content-Type"), req.Body)
+}
+
+// defaultBodyVariant returns the transaction answering requests whose body is not matched: the one
+// recorded without a body, else the first body recorded. order lists the body hashes in recorded order
+func defaultBodyVariant(bodies map[string]*transactionState, order []string) *transactionState {
+	if state, exists := bodies[""]; exists {
+		return state
+	}
+	return bodies[order[0]]
+}
@@ -0,0 +1,182 @@
+package plugins
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go-http-playback-proxy/pkg/inventory"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// rotationCheckInterval is how often a rotated recording checks whether its segment is due
+const rotationCheckInterval = time.Second
+
+// rotation splits a long recording into segments by time or size, so finished transactions are
+// saved and released instead of accumulating until the recording ends
+type rotation struct {
+	interval time.Duration
+	maxBytes int64
+
+	// mutex serializes the segment saves and guards the fields below
+	mutex sync.Mutex
+	// started is when the current segment started
+	started  time.Time
+	manifest *inventory.SegmentManifest
+	// closed is set once the last segment is saved
+	closed bool
+}
+
+// watchRotation saves a segment whenever one is due, until the final save
+func (p *RecordingPlugin) watchRotation(interval time.Duration) {
+	defer p.recoverPanic("rotation")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stopped:
+			return
+		}
+		if !p.rotationDue() {
+			continue
+		}
+		if err := p.rotate(false); err != nil {
+			recordingLogger.Error("Failed to rotate recording", "error", err)
+		}
+	}
+}
+
+// rotationDue reports whether the current segment reached its duration or size
+func (p *RecordingPlugin) rotationDue() bool {
+	r := p.rotation
+	r.mutex.Lock()
+	started := r.started
+	r.mutex.Unlock()
+	if r.interval > 0 && time.Since(started) >= r.interval {
+		return true
+	}
+	if r.maxBytes <= 0 {
+		return false
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	var size int64
+	for _, transaction := range p.transactions {
+		if !transaction.ResponseStarted.IsZero() {
+			size += int64(len(transaction.Body))
+		}
+	}
+	return size >= r.maxBytes
+}
+
+// rotate saves the finished transactions as the next segment and lists it in segments.json. The
+// last segment takes every transaction, finished or not.
+func (p *RecordingPlugin) rotate(last bool) error {
+	r := p.rotation
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = last
+
+	// A previous segment's content files must not be rewritten while they are beautified
+	p.beautifier.Wait()
+
+	transactions := p.takeTransactions(last)
+	started := r.started
+	r.started = time.Now()
+	if len(transactions) == 0 {
+		return nil
+	}
+
+	number := len(r.manifest.Segments) + 1
+	dir := inventory.SegmentDir(number)
+	summary, err := p.saveTransactions(filepath.Join(p.inventoryDir, filepath.FromSlash(dir)), transactions, started)
+	if err != nil {
+		if !last {
+			// Try again with the next segment
+			p.restoreTransactions(transactions)
+			r.started = started
+		}
+		return fmt.Errorf("failed to save segment %d: %w", number, err)
+	}
+	if summary.Requests == 0 {
+		return nil
+	}
+
+	r.manifest.Segments = append(r.manifest.Segments, inventory.Segment{
+		Dir:        dir,
+		StartedAt:  started,
+		FinishedAt: summary.FinishedAt,
+		Requests:   summary.Requests,
+		Bytes:      summary.Bytes,
+	})
+	pm := inventory.NewPersistenceManager(p.inventoryDir)
+	pm.Sync = p.sync
+	if err := pm.WriteSegmentManifest(r.manifest); err != nil {
+		return err
+	}
+	recordingLogger.Info("Recording segment saved", "segment", number, "requests", summary.Requests, "bytes", summary.Bytes, "directory", dir)
+
+	// The last segment is completed by the caller, like an unrotated inventory
+	if !last {
+		return p.WaitBeautified()
+	}
+	return nil
+}
+
+// takeTransactions removes the finished transactions and returns them. Open WebSocket sessions stay
+// for the segment in which they end; with all, they are returned as well, along with the
+// transactions still waiting for their response.
+func (p *RecordingPlugin) takeTransactions(all bool) []types.RecordingTransaction {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	open := make(map[int]*int, len(p.webSockets))
+	for session := range p.webSockets {
+		open[*session] = session
+	}
+
+	var taken []types.RecordingTransaction
+	kept := make([]types.RecordingTransaction, 0)
+	for i, transaction := range p.transactions {
+		session, isOpen := open[i]
+		if all || (!isOpen && !transaction.ResponseStarted.IsZero()) {
+			taken = append(taken, transaction)
+		}
+		if isOpen || (!all && transaction.ResponseStarted.IsZero()) {
+			if isOpen {
+				*session = len(kept)
+			}
+			kept = append(kept, transaction)
+		}
+	}
+	p.transactions = kept
+	return taken
+}
+
+// restoreTransactions puts transactions that could not be saved back before the current ones
+func (p *RecordingPlugin) restoreTransactions(transactions []types.RecordingTransaction) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for session := range p.webSockets {
+		*session += len(transactions)
+	}
+	p.transactions = append(transactions, p.transactions...)
+}
+
+// Segments returns the manifest of a rotated recording, or nil when rotation is disabled
+func (p *RecordingPlugin) Segments() *inventory.SegmentManifest {
+	if p.rotation == nil {
+		return nil
+	}
+	p.rotation.mutex.Lock()
+	defer p.rotation.mutex.Unlock()
+	manifest := *p.rotation.manifest
+	manifest.Segments = append([]inventory.Segment(nil), manifest.Segments...)
+	return &manifest
+}
@@ -0,0 +1,102 @@
+package plugins
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// recordingScope limits recording to the requests whose host matches an include pattern and whose
+// URL matches an include expression, if there are any, and that match no exclude pattern or
+// expression. Other requests are proxied without being recorded.
+type recordingScope struct {
+	includeHosts *match.Set
+	excludeHosts *match.Set
+	includeURLs  []*regexp.Regexp
+	excludeURLs  []*regexp.Regexp
+}
+
+// newRecordingScope compiles the patterns of a scope; nil when there are none
+func newRecordingScope(includeDomains, excludeDomains, includeURLs, excludeURLs []string) (*recordingScope, error) {
+	if len(includeDomains) == 0 && len(excludeDomains) == 0 && len(includeURLs) == 0 && len(excludeURLs) == 0 {
+		return nil, nil
+	}
+	s := &recordingScope{}
+	var err error
+	if s.includeHosts, err = compileHostPatterns(includeDomains); err != nil {
+		return nil, fmt.Errorf("invalid include domain: %w", err)
+	}
+	if s.excludeHosts, err = compileHostPatterns(excludeDomains); err != nil {
+		return nil, fmt.Errorf("invalid exclude domain: %w", err)
+	}
+	if s.includeURLs, err = compileURLPatterns(includeURLs); err != nil {
+		return nil, fmt.Errorf("invalid include URL: %w", err)
+	}
+	if s.excludeURLs, err = compileURLPatterns(excludeURLs); err != nil {
+		return nil, fmt.Errorf("invalid exclude URL: %w", err)
+	}
+	return s, nil
+}
+
+// compileHostPatterns compiles host patterns, which match hosts case-insensitively
+func compileHostPatterns(patterns []string) (*match.Set, error) {
+	lower := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		lower[i] = strings.ToLower(strings.TrimSpace(pattern))
+	}
+	return match.CompileSet(lower)
+}
+
+// compileURLPatterns compiles regular expressions matched against whole URLs
+func compileURLPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// records reports whether requests to u are recorded
+func (s *recordingScope) records(u *url.URL) bool {
+	if s == nil {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	if s.includeHosts.Len() > 0 && !s.includeHosts.Match(host) {
+		return false
+	}
+	if s.excludeHosts.Match(host) {
+		return false
+	}
+	rawURL := u.String()
+	if len(s.includeURLs) > 0 && !matchesAny(s.includeURLs, rawURL) {
+		return false
+	}
+	return !matchesAny(s.excludeURLs, rawURL)
+}
+
+// matchesAny reports whether any of the expressions matches s
+func matchesAny(expressions []*regexp.Regexp, s string) bool {
+	for _, re := range expressions {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// outOfScope reports whether a request to u is left unrecorded by the scope, counting it
+func (p *RecordingPlugin) outOfScope(u *url.URL) bool {
+	if p.scope.records(u) {
+		return false
+	}
+	p.outOfScopeRequests.Add(1)
+	return true
+}
@@ -0,0 +1,119 @@
+package plugins
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// transactionState wraps a loaded transaction with the state that changes while it is replayed.
+// The transaction and its chunks are shared by concurrent replays and must never be modified;
+// anything that changes per request belongs here and is updated atomically.
+type transactionState struct {
+	*types.PlaybackTransaction
+
+	hits   atomic.Int64
+	active atomic.Int64
+	bytes  atomic.Int64
+	// contentCheck follows the content file when checksums are verified, otherwise it is nil
+	contentCheck *contentCheck
+	// template is the body parsed for policies with templating
+	template responseTemplate
+}
+
+// newTransactionState wraps a transaction that is no longer modified
+func newTransactionState(transaction *types.PlaybackTransaction) *transactionState {
+	state := &transactionState{PlaybackTransaction: transaction}
+	if transaction.ContentFile != "" {
+		state.contentCheck = newContentCheck(transaction.ContentFile, transaction.ChecksumMismatch)
+	}
+	return state
+}
+
+// begin records the start of a replay and returns its 1-based sequence number
+func (s *transactionState) begin() int64 {
+	s.active.Add(1)
+	return s.hits.Add(1)
+}
+
+// end records the end of a replay that served n body bytes
+func (s *transactionState) end(n int64) {
+	s.bytes.Add(n)
+	s.active.Add(-1)
+}
+
+// TransactionStats is a snapshot of the replay counters of one recorded transaction
+type TransactionStats struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Hits counts the replays started, Active those still in progress
+	Hits        int64 `json:"hits"`
+	Active      int64 `json:"active"`
+	BytesServed int64 `json:"bytesServed"`
+}
+
+func (s *transactionState) stats() TransactionStats {
+	return TransactionStats{
+		Method:      s.Method,
+		URL:         s.URL,
+		Hits:        s.hits.Load(),
+		Active:      s.active.Load(),
+		BytesServed: s.bytes.Load(),
+	}
+}
+
+// TransactionStats returns the replay counters of every loaded transaction, sorted by URL and method
+func (p *PlaybackPlugin) TransactionStats() []TransactionStats {
+	p.mutex.RLock()
+	stats := make([]TransactionStats, 0, len(p.transactionMap)+len(p.prefetchMap))
+	p.eachState(func(state *transactionState) {
+		stats = append(stats, state.stats())
+	})
+	p.mutex.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].URL != stats[j].URL {
+			return stats[i].URL < stats[j].URL
+		}
+		return stats[i].Method < stats[j].Method
+	})
+	return stats
+}
+
+// eachState calls fn once for every loaded transaction. The caller holds the mutex.
+func (p *PlaybackPlugin) eachState(fn func(*transactionState)) {
+	seen := make(map[*transactionState]bool, len(p.transactionMap)+len(p.prefetchMap))
+	add := func(state *transactionState) {
+		// URLs only recorded as prefetches share one state between both maps
+		if !seen[state] {
+			seen[state] = true
+			fn(state)
+		}
+	}
+	for _, states := range []map[string]*transactionState{p.transactionMap, p.prefetchMap} {
+		for _, state := range states {
+			add(state)
+		}
+	}
+	for _, variants := range p.variantMap {
+		for _, state := range variants {
+			add(state)
+		}
+	}
+	for _, locales := range p.localeMap {
+		for _, state := range locales {
+			add(state)
+		}
+	}
+	for _, bodies := range p.requestBodies {
+		for _, state := range bodies {
+			add(state)
+		}
+	}
+	for _, cycle := range p.repeats {
+		for _, state := range cycle.states {
+			add(state)
+		}
+	}
+}
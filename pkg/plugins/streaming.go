@@ -0,0 +1,244 @@
+package plugins
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// streamingMediaTypes are response types that do not end on their own; they are streamed through
+// the proxy while recording and replayed part by part with their recorded timing
+var streamingMediaTypes = []string{
+	"multipart/x-mixed-replace",
+	"text/event-stream",
+	"application/x-ndjson",
+	"application/ndjson",
+	"application/jsonl",
+	"application/stream+json",
+}
+
+// lineDelimitedMediaTypes are the streaming types that send one JSON value per line
+var lineDelimitedMediaTypes = []string{
+	"application/x-ndjson",
+	"application/ndjson",
+	"application/jsonl",
+	"application/stream+json",
+}
+
+// isStreamingMediaType reports whether a Content-Type is a streaming MIME type
+func isStreamingMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, streaming := range streamingMediaTypes {
+		if mediaType == streaming {
+			return true
+		}
+	}
+	return false
+}
+
+// isLineDelimitedMediaType reports whether a media type sends one JSON value per line
+func isLineDelimitedMediaType(mediaType string) bool {
+	for _, lineDelimited := range lineDelimitedMediaTypes {
+		if mediaType == lineDelimited {
+			return true
+		}
+	}
+	return false
+}
+
+// readMark records when a streamed body had grown to end bytes
+type readMark struct {
+	at  time.Time
+	end int
+}
+
+// timedPart is a segment of a streamed body and when it was completely received
+type timedPart struct {
+	at   time.Time
+	size int
+}
+
+// timedStream is a streamed body split into parts, with when its headers arrived
+type timedStream struct {
+	opened time.Time
+	parts  []timedPart
+}
+
+// splitStream splits a streamed body into timed parts and returns them with the length of the
+// complete parts. Multipart bodies are split at their boundaries, event streams after each event and
+// newline-delimited JSON after each line, so each part is replayed whole and an unfinished last part
+// is dropped; other streaming types and encoded bodies are split where data arrived.
+func splitStream(contentType, contentEncoding string, body []byte, marks []readMark) ([]timedPart, int) {
+	if len(body) == 0 || len(marks) == 0 {
+		return nil, len(body)
+	}
+
+	ends := arrivalEnds(marks)
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	switch {
+	case err != nil:
+	case contentEncoding != "" && !strings.EqualFold(contentEncoding, "identity"):
+		// Boundaries cannot be found in compressed data
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		ends = multipartEnds(body, params["boundary"])
+	case mediaType == "text/event-stream":
+		ends = eventStreamEnds(body)
+	case isLineDelimitedMediaType(mediaType):
+		ends = lineEnds(body)
+	}
+
+	var parts []timedPart
+	start := 0
+	for _, end := range ends {
+		if end <= start || end > len(body) {
+			continue
+		}
+		parts = append(parts, timedPart{at: arrivalTime(marks, end), size: end - start})
+		start = end
+	}
+	return parts, start
+}
+
+// arrivalEnds returns the body length after each read
+func arrivalEnds(marks []readMark) []int {
+	ends := make([]int, len(marks))
+	for i, mark := range marks {
+		ends[i] = mark.end
+	}
+	return ends
+}
+
+// multipartEnds returns where each complete part ends, i.e. where the next delimiter starts.
+// The close delimiter completes the body.
+func multipartEnds(body []byte, boundary string) []int {
+	delimiter := []byte("--" + boundary)
+	var ends []int
+	for offset := 0; offset < len(body); {
+		i := bytes.Index(body[offset:], delimiter)
+		if i < 0 {
+			break
+		}
+		pos := offset + i
+		// Delimiters start a line; the first part may be preceded by a preamble
+		if pos == 0 || body[pos-1] == '\n' {
+			if pos > 0 {
+				ends = append(ends, lineStart(body, pos))
+			}
+			if bytes.HasPrefix(body[pos+len(delimiter):], []byte("--")) {
+				ends = append(ends, len(body))
+				break
+			}
+		}
+		offset = pos + len(delimiter)
+	}
+	return ends
+}
+
+// eventStreamEnds returns where each event of a text/event-stream body ends, i.e. after the blank
+// line that dispatches it. Lines end with CRLF, LF or CR; blank lines between events join the next one.
+func eventStreamEnds(body []byte) []int {
+	var ends []int
+	lineStart := true
+	pending := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != '\r' && c != '\n' {
+			lineStart = false
+			pending = true
+			continue
+		}
+		if c == '\r' && i+1 < len(body) && body[i+1] == '\n' {
+			i++
+		}
+		if lineStart && pending {
+			ends = append(ends, i+1)
+			pending = false
+		}
+		lineStart = true
+	}
+	return ends
+}
+
+// lineEnds returns where each line of a newline-delimited body ends, after its LF. Blank lines join
+// the next one.
+func lineEnds(body []byte) []int {
+	var ends []int
+	pending := false
+	for i, c := range body {
+		switch c {
+		case '\n':
+			if pending {
+				ends = append(ends, i+1)
+				pending = false
+			}
+		case '\r', ' ', '\t':
+		default:
+			pending = true
+		}
+	}
+	return ends
+}
+
+// lineStart moves a delimiter position before the CRLF that belongs to it
+func lineStart(body []byte, pos int) int {
+	if pos >= 2 && body[pos-2] == '\r' {
+		return pos - 2
+	}
+	return pos - 1
+}
+
+// arrivalTime returns when the body had grown to at least end bytes
+func arrivalTime(marks []readMark, end int) time.Time {
+	for _, mark := range marks {
+		if mark.end >= end {
+			return mark.at
+		}
+	}
+	return marks[len(marks)-1].at
+}
+
+// flushedBody passes a body on as it arrives: io.Copy uses its WriteTo, which flushes every read to
+// the client instead of letting it wait in the server's write buffer. The body is closed at its end.
+type flushedBody struct {
+	body io.ReadCloser
+}
+
+func (b *flushedBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err != nil {
+		b.body.Close()
+	}
+	return n, err
+}
+
+func (b *flushedBody) WriteTo(w io.Writer) (int64, error) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, err := b.Read(buf)
+		if n > 0 {
+			m, writeErr := w.Write(buf[:n])
+			written += int64(m)
+			if writeErr != nil {
+				b.body.Close()
+				return written, writeErr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package plugins
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+)
+
+// strictMiss is the body of the response to an unrecorded request in strict mode
+type strictMiss struct {
+	Error  string `json:"error"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Nearest lists the recorded keys most similar to the request, to spot a changed query or path
+	Nearest []string `json:"nearest,omitempty"`
+}
+
+// strictMissBody explains in JSON that a request is not in the inventory; mode is what keeps it from
+// the upstream (strict mode or replay-only)
+func (p *PlaybackPlugin) strictMissBody(method, url, mode string) []byte {
+	body, _ := json.MarshalIndent(strictMiss{
+		Error:   "request not recorded in the inventory (" + mode + ")",
+		Method:  method,
+		URL:     url,
+		Nearest: p.nearestKeys(method, url, nearestKeyCount),
+	}, "", "  ")
+	return append(body, '\n')
+}
+
+// createStrictResponse answers an unrecorded request in strict mode, or to a replay-only domain
+func (p *PlaybackPlugin) createStrictResponse(f *proxy.Flow, mode string) {
+	response := &proxy.Response{
+		StatusCode: p.missStatus(),
+		Header:     make(http.Header),
+		Body:       p.strictMissBody(f.Request.Method, f.Request.URL.String(), mode),
+	}
+	response.Header.Set("Content-Type", "application/json")
+	f.Response = response
+	finalizeResponse(f, int64(len(response.Body)), "")
+}
+
+// missStatus is the status of unrecorded requests answered locally: --strict-status, which also
+// applies to replay-only domains, else DefaultStrictStatus
+func (p *PlaybackPlugin) missStatus() int {
+	if p.strictStatus != 0 {
+		return p.strictStatus
+	}
+	return DefaultStrictStatus
+}
@@ -0,0 +1,101 @@
+package plugins
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/encoding"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// templateRequest is what a templated response body sees of the request it answers
+type templateRequest struct {
+	Method string
+	URL    string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   string
+	Now    time.Time
+}
+
+// responseTemplate is the recorded body of a transaction parsed as a text/template, once
+type responseTemplate struct {
+	once     sync.Once
+	template *template.Template
+	err      error
+}
+
+// parse decodes the recorded body and parses it as a template
+func (t *responseTemplate) parse(transaction *types.PlaybackTransaction) (*template.Template, error) {
+	t.once.Do(func() {
+		var body []byte
+		for _, chunk := range transaction.Chunks {
+			body = append(body, chunk.Chunk...)
+		}
+		if body, t.err = encoding.DecodeData(body, bodyEncoding(transaction)); t.err != nil {
+			return
+		}
+		t.template, t.err = template.New(transaction.URL).Option("missingkey=zero").Parse(string(body))
+	})
+	return t.template, t.err
+}
+
+// templated returns the transaction with its body executed as a template for the flow's request,
+// or the transaction itself when the body cannot be templated. The chunks keep their recorded
+// timing; the rendered body is spread over them in proportion.
+func (p *PlaybackPlugin) templated(f *proxy.Flow, state *transactionState) *types.PlaybackTransaction {
+	transaction := state.PlaybackTransaction
+	if len(transaction.Chunks) == 0 || transaction.Streamed || len(transaction.WebSocket) > 0 {
+		return transaction
+	}
+	tmpl, err := state.template.parse(transaction)
+	if err != nil {
+		playbackLogger.Warn("Response body is not a template, serving it as recorded", "url", transaction.URL, "error", err)
+		return transaction
+	}
+
+	request := templateRequest{
+		Method: f.Request.Method,
+		URL:    f.Request.URL.String(),
+		Path:   f.Request.URL.Path,
+		Query:  f.Request.URL.Query(),
+		Header: f.Request.Header,
+		Body:   string(f.Request.Body),
+		Now:    time.Now(),
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, request); err != nil {
+		playbackLogger.Warn("Failed to execute response template, serving it as recorded", "url", transaction.URL, "error", err)
+		return transaction
+	}
+	body, err := encoding.EncodeData(rendered.Bytes(), bodyEncoding(transaction), 6)
+	if err != nil {
+		playbackLogger.Warn("Failed to encode templated response, serving it as recorded", "url", transaction.URL, "error", err)
+		return transaction
+	}
+
+	templated := *transaction
+	templated.Chunks = make([]types.BodyChunk, len(transaction.Chunks))
+	start := 0
+	for i, chunk := range transaction.Chunks {
+		end := len(body) * (i + 1) / len(transaction.Chunks)
+		chunk.Chunk = body[start:end]
+		templated.Chunks[i] = chunk
+		start = end
+	}
+	return &templated
+}
+
+// bodyEncoding returns the coding of the replayed body
+func bodyEncoding(transaction *types.PlaybackTransaction) types.ContentEncodingType {
+	if transaction.ContentEncoding == "" {
+		return types.ContentEncodingIdentity
+	}
+	return transaction.ContentEncoding
+}
@@ -0,0 +1,167 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lqqyt2423/go-mitmproxy/proxy"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// tlsSessions tracks the TLS handshakes of upstream connections, so the first response on each
+// connection records how the connection was set up
+type tlsSessions struct {
+	connections sync.Map // *proxy.ServerConn -> *tlsConnection
+}
+
+type tlsConnection struct {
+	connected time.Time
+	handshake atomic.Pointer[tlsHandshake]
+}
+
+// tlsHandshake is what a completed handshake records: the session on the first resource and the
+// details on its domain
+type tlsHandshake struct {
+	session *types.TLSSession
+	details *types.DomainTLS
+}
+
+// connected starts timing the handshake of a new upstream connection
+func (t *tlsSessions) connected(conn *proxy.ServerConn) {
+	if conn == nil {
+		return
+	}
+	t.connections.Store(conn, &tlsConnection{connected: time.Now()})
+}
+
+// established records the completed handshake of an upstream connection
+func (t *tlsSessions) established(conn *proxy.ServerConn, state *tls.ConnectionState) {
+	v, ok := t.connections.Load(conn)
+	if !ok || state == nil {
+		return
+	}
+	tracked := v.(*tlsConnection)
+	handshake := time.Since(tracked.connected).Milliseconds()
+	details := &types.DomainTLS{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		HandshakeMS: handshake,
+		Resumed:     state.DidResume,
+	}
+	for _, certificate := range state.PeerCertificates {
+		details.Certificates = append(details.Certificates, types.CertificateInfo{
+			Subject:  certificate.Subject.String(),
+			Issuer:   certificate.Issuer.String(),
+			NotAfter: certificate.NotAfter.UTC(),
+		})
+	}
+	tracked.handshake.Store(&tlsHandshake{
+		session: &types.TLSSession{
+			Version:     details.Version,
+			Resumed:     state.DidResume,
+			HandshakeMS: handshake,
+		},
+		details: details,
+	})
+}
+
+// take returns the handshake of the flow's upstream connection and its details, once per connection
+func (t *tlsSessions) take(f *proxy.Flow) (*types.TLSSession, *types.DomainTLS) {
+	if f.ConnContext == nil || f.ConnContext.ServerConn == nil {
+		return nil, nil
+	}
+	v, ok := t.connections.Load(f.ConnContext.ServerConn)
+	if !ok {
+		return nil, nil
+	}
+	handshake := v.(*tlsConnection).handshake.Swap(nil)
+	if handshake == nil {
+		return nil, nil
+	}
+	return handshake.session, handshake.details
+}
+
+func (t *tlsSessions) disconnected(conn *proxy.ServerConn) {
+	if conn == nil {
+		return
+	}
+	t.connections.Delete(conn)
+}
+
+// hostHandshakes holds the handshake times recorded for a host
+type hostHandshakes struct {
+	version string
+	full    time.Duration
+	resumed *time.Duration
+}
+
+// resumption returns how long a resumed handshake with the host takes: as recorded if the
+// recording resumed a session, else one round trip, which is the whole full handshake for TLS 1.3
+// and half of it before (one round trip instead of two)
+func (h *hostHandshakes) resumption() time.Duration {
+	if h.resumed != nil {
+		return *h.resumed
+	}
+	if h.version == tls.VersionName(tls.VersionTLS13) {
+		return h.full
+	}
+	return h.full / 2
+}
+
+// tlsEmulator delays the first response on each client connection by the upstream handshake the
+// recorded origin needed: a full handshake on the first connection to a host, a resumed one after
+type tlsEmulator struct {
+	hosts   map[string]*hostHandshakes
+	clients sync.Map // *proxy.ClientConn that already waited for its handshake
+	seen    sync.Map // host names connected to before
+}
+
+func newTLSEmulator() *tlsEmulator {
+	return &tlsEmulator{hosts: make(map[string]*hostHandshakes)}
+}
+
+// add takes in the recorded handshake of a resource; the first of each kind per host is kept
+func (e *tlsEmulator) add(host string, session *types.TLSSession) {
+	h, ok := e.hosts[host]
+	if !ok {
+		h = &hostHandshakes{}
+		e.hosts[host] = h
+	}
+	handshake := time.Duration(session.HandshakeMS) * time.Millisecond
+	if session.Resumed {
+		if h.resumed == nil {
+			h.resumed = &handshake
+		}
+		return
+	}
+	if h.version == "" {
+		h.version, h.full = session.Version, handshake
+	}
+}
+
+// delay returns the handshake time to add to the flow's response, once per client connection
+func (e *tlsEmulator) delay(f *proxy.Flow) time.Duration {
+	if e == nil || f.Request == nil || f.Request.URL.Scheme != "https" || f.ConnContext == nil || f.ConnContext.ClientConn == nil {
+		return 0
+	}
+	if _, waited := e.clients.LoadOrStore(f.ConnContext.ClientConn, struct{}{}); waited {
+		return 0
+	}
+	host := f.Request.URL.Hostname()
+	h, ok := e.hosts[host]
+	if !ok || h.version == "" {
+		return 0
+	}
+	if _, repeat := e.seen.LoadOrStore(host, struct{}{}); repeat {
+		return h.resumption()
+	}
+	return h.full
+}
+
+func (e *tlsEmulator) forget(conn *proxy.ClientConn) {
+	if e != nil {
+		e.clients.Delete(conn)
+	}
+}
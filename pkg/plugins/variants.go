@@ -0,0 +1,100 @@
+package plugins
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptedType is one media range of an Accept header
+type acceptedType struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of an Accept header in the order the client listed them
+func parseAccept(accept string) []acceptedType {
+	var types []acceptedType
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		types = append(types, acceptedType{mediaType: mediaType, quality: quality})
+	}
+	return types
+}
+
+// variantType returns the media type a recorded variant was served as
+func variantType(state *transactionState) string {
+	mediaType, _, err := mime.ParseMediaType(state.RawHeaders["Content-Type"])
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// explicitlyAccepts reports whether an Accept header names the media type itself, not only through a wildcard
+func explicitlyAccepts(accept, mediaType string) bool {
+	for _, accepted := range parseAccept(accept) {
+		if accepted.mediaType == mediaType && accepted.quality > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// selectVariant picks the image format to answer a request with, like a CDN negotiating by Accept:
+// the variant recorded for the same Accept header, else the format the header names with the highest
+// quality (the first listed on a tie). It returns nil when the header names none of the formats.
+func selectVariant(variants []*transactionState, accept string) *transactionState {
+	if accept == "" {
+		return nil
+	}
+	for _, variant := range variants {
+		if variant.Accept == accept {
+			return variant
+		}
+	}
+
+	var best *transactionState
+	bestQuality := 0.0
+	for _, accepted := range parseAccept(accept) {
+		if accepted.quality <= bestQuality {
+			continue
+		}
+		for _, variant := range variants {
+			if variantType(variant) == accepted.mediaType {
+				best, bestQuality = variant, accepted.quality
+				break
+			}
+		}
+	}
+	return best
+}
+
+// fallbackVariant returns the variant for requests whose Accept header names none of the formats:
+// one that was served without being asked for by name (the format for any client), else the
+// first by media type
+func fallbackVariant(variants []*transactionState) *transactionState {
+	sort.Slice(variants, func(i, j int) bool {
+		return variantType(variants[i]) < variantType(variants[j])
+	})
+	for _, variant := range variants {
+		if !explicitlyAccepts(variant.Accept, variantType(variant)) {
+			return variant
+		}
+	}
+	return variants[0]
+}
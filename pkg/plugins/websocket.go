@@ -0,0 +1,326 @@
+package plugins
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go-http-playback-proxy/pkg/accesslog"
+	"go-http-playback-proxy/pkg/classify"
+	"go-http-playback-proxy/pkg/types"
+	"go-http-playback-proxy/pkg/websocket"
+)
+
+const (
+	// webSocketDialTimeout bounds connecting to the origin of a WebSocket session
+	webSocketDialTimeout = 30 * time.Second
+	// webSocketCloseTimeout is how long a replayed session waits for the client to answer its close frame
+	webSocketCloseTimeout = 5 * time.Second
+)
+
+// ServeWebSocket relays a WebSocket session to the origin and records its handshake and frames.
+// Compression extensions are not offered to the origin, so payloads are recorded as sent.
+func (p *RecordingPlugin) ServeWebSocket(w http.ResponseWriter, req *http.Request) bool {
+	if p.outOfScope(req.URL) || p.diskGuard.stopped() || p.skipPaused() {
+		return false
+	}
+
+	transaction := types.RecordingTransaction{
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestStarted: time.Now(),
+		RawHeaders:     make(types.HttpHeaders),
+		Fetch:          fetchMetadata(req.Header),
+		RequestHeaders: requestHeaders(req.Header, nil),
+	}
+
+	req.Header.Del("Sec-WebSocket-Extensions")
+	req.Header.Del("Proxy-Connection")
+	req.Header.Del("Proxy-Authorization")
+	p.credentials.Apply(req.URL.Hostname(), req.Header)
+
+	upstream, err := dialWebSocketOrigin(req.URL)
+	if err != nil {
+		recordingLogger.Warn("Failed to connect to WebSocket origin", "url", transaction.URL, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to connect to %s", req.URL.Host), http.StatusBadGateway)
+		return true
+	}
+	defer upstream.Close()
+	if host, _, err := net.SplitHostPort(upstream.RemoteAddr().String()); err == nil {
+		transaction.IPAddress, transaction.Resolver = host, p.resolver
+	}
+
+	upstreamReader := bufio.NewReader(upstream)
+	if err := req.Write(upstream); err != nil {
+		http.Error(w, "Failed to send WebSocket handshake", http.StatusBadGateway)
+		return true
+	}
+	resp, err := http.ReadResponse(upstreamReader, req)
+	if err != nil {
+		recordingLogger.Warn("Failed to read WebSocket handshake", "url", transaction.URL, "error", err)
+		http.Error(w, "Failed to read WebSocket handshake", http.StatusBadGateway)
+		return true
+	}
+	defer resp.Body.Close()
+
+	transaction.ResponseStarted = time.Now()
+	statusCode := resp.StatusCode
+	transaction.StatusCode = &statusCode
+	for name, values := range resp.Header {
+		if len(values) > 0 {
+			transaction.RawHeaders[name] = values[0]
+		}
+	}
+
+	client, clientBuf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		recordingLogger.Warn("Failed to take over WebSocket connection", "url", transaction.URL, "error", err)
+		return true
+	}
+	defer client.Close()
+
+	// A refused upgrade is an ordinary response
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.Write(client)
+		transaction.Body = body
+		transaction.ResponseFinished = time.Now()
+		p.addTransaction(transaction)
+		return true
+	}
+
+	if err := writeHandshake(client, resp.Header); err != nil {
+		return true
+	}
+	transaction.ResponseFinished = transaction.ResponseStarted
+	session := p.openWebSocket(transaction)
+	defer p.closeWebSocket(session)
+	recordingLogger.Debug("WebSocket session started", "url", transaction.URL)
+
+	handshake := time.Now()
+	record := func(frame *websocket.Frame, fromClient bool) {
+		if session == nil {
+			return
+		}
+		// The session is kept in the transaction as it goes, so saving while it is open keeps its frames
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		recorded := &p.transactions[*session]
+		recorded.WebSocket = append(recorded.WebSocket, websocket.Record(frame, fromClient, time.Since(handshake)))
+	}
+
+	done := make(chan struct{}, 2)
+	relay := func(src io.Reader, dst io.Writer, fromClient bool) {
+		defer func() { done <- struct{}{} }()
+		for {
+			frame, err := websocket.ReadFrame(src)
+			if err != nil {
+				return
+			}
+			record(frame, fromClient)
+			if err := websocket.WriteFrame(dst, frame); err != nil {
+				return
+			}
+		}
+	}
+	go relay(clientBuf.Reader, upstream, true)
+	go relay(upstreamReader, client, false)
+
+	// Either side ending the session ends the other
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+
+	recordingLogger.Debug("WebSocket session ended", "url", transaction.URL, "duration_ms", time.Since(handshake).Milliseconds())
+	return true
+}
+
+// addTransaction stores a completed transaction and returns its index, or -1 once the limit is reached
+func (p *RecordingPlugin) addTransaction(transaction types.RecordingTransaction) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.transactions) >= 10000 {
+		return -1
+	}
+	p.transactions = append(p.transactions, transaction)
+	return len(p.transactions) - 1
+}
+
+// openWebSocket stores the transaction of a WebSocket session and returns its index, which
+// rotation moves while the session is open, or nil once the limit is reached
+func (p *RecordingPlugin) openWebSocket(transaction types.RecordingTransaction) *int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.transactions) >= 10000 {
+		return nil
+	}
+	p.transactions = append(p.transactions, transaction)
+	index := len(p.transactions) - 1
+	if p.webSockets == nil {
+		p.webSockets = make(map[*int]struct{})
+	}
+	p.webSockets[&index] = struct{}{}
+	return &index
+}
+
+// closeWebSocket marks the session as ended, so rotation saves it with the next segment
+func (p *RecordingPlugin) closeWebSocket(session *int) {
+	if session == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.webSockets, session)
+}
+
+// dialWebSocketOrigin connects to the origin of a WebSocket URL (http or https, as proxied)
+func dialWebSocketOrigin(u *url.URL) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: webSocketDialTimeout}
+	port := u.Port()
+	if u.Scheme == "https" {
+		if port == "" {
+			port = "443"
+		}
+		// Like the proxy, the origin's certificate is not verified; HTTP/2 cannot carry the upgrade
+		config := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}}
+		return tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(u.Hostname(), port), config)
+	}
+	if port == "" {
+		port = "80"
+	}
+	return dialer.Dial("tcp", net.JoinHostPort(u.Hostname(), port))
+}
+
+// writeHandshake writes the 101 response that switches the connection to the WebSocket protocol
+func writeHandshake(w io.Writer, header http.Header) error {
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(&b)
+	b.WriteString("\r\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ServeWebSocket replays a recorded WebSocket session: the handshake after its recorded TTFB, then
+// the frames the server sent at their recorded offsets. Frames from the client are read and dropped.
+// Sessions not in the inventory are left to go-mitmproxy, which forwards them upstream, except in
+// strict mode and for domains the playback settings keep off the upstream.
+func (p *PlaybackPlugin) ServeWebSocket(w http.ResponseWriter, req *http.Request) bool {
+	startTime := time.Now()
+	p.mutex.RLock()
+	key := p.recordedKey(req.Method, req.URL.String())
+	state, exists := p.transactionMap[key]
+	p.mutex.RUnlock()
+	if !exists || state.StatusCode == nil || *state.StatusCode != http.StatusSwitchingProtocols {
+		mode := ""
+		if p.strictStatus != 0 {
+			mode = "strict mode"
+		} else if fallback := p.domainFallbacks.Fallback(req.URL.Hostname()); fallback == classify.FallbackReplayOnly || fallback == classify.FallbackBlock {
+			mode = fallback
+		}
+		if mode != "" {
+			playbackLogger.Warn("WebSocket session not recorded, refused", "url", req.URL.String(), "mode", mode)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(p.missStatus())
+			w.Write(p.strictMissBody(req.Method, req.URL.String(), mode))
+			p.writeAccess(accesslog.Entry{Time: time.Now(), Method: req.Method, URL: req.URL.String(), Status: p.missStatus(), Source: accesslog.SourceBlocked})
+			return true
+		}
+		playbackLogger.Debug("No matching WebSocket session, proxying upstream", "key", key)
+		p.writeAccess(accesslog.Entry{Time: time.Now(), Method: req.Method, URL: req.URL.String(), Source: accesslog.SourceUpstream})
+		return false
+	}
+	transaction := state.PlaybackTransaction
+
+	time.Sleep(time.Until(startTime.Add(transaction.TTFB)))
+
+	client, clientBuf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		playbackLogger.Warn("Failed to take over WebSocket connection", "url", transaction.URL, "error", err)
+		return true
+	}
+	defer client.Close()
+
+	header := make(http.Header)
+	for name, value := range transaction.RawHeaders {
+		header.Set(name, value)
+	}
+	// The accept key answers the key of this client; extensions were not negotiated when recording
+	header.Set("Sec-WebSocket-Accept", websocket.AcceptKey(req.Header.Get("Sec-WebSocket-Key")))
+	header.Del("Sec-WebSocket-Extensions")
+	if err := writeHandshake(client, header); err != nil {
+		return true
+	}
+	p.writeAccess(accesslog.Entry{Time: time.Now(), Method: req.Method, URL: req.URL.String(), Status: http.StatusSwitchingProtocols, Source: accesslog.SourceInventory})
+
+	handshake := time.Now()
+	var writeMutex sync.Mutex
+	serverClosed := false
+	clientClosed := make(chan struct{})
+	go func() {
+		defer close(clientClosed)
+		for {
+			frame, err := websocket.ReadFrame(clientBuf.Reader)
+			if err != nil {
+				return
+			}
+			if frame.Opcode == websocket.OpClose {
+				// Answer the client's close unless the replay closed first
+				writeMutex.Lock()
+				if !serverClosed {
+					websocket.WriteFrame(client, &websocket.Frame{Fin: true, Opcode: websocket.OpClose, Payload: frame.Payload})
+				}
+				writeMutex.Unlock()
+				return
+			}
+		}
+	}()
+
+	for i := range transaction.WebSocket {
+		recorded := &transaction.WebSocket[i]
+		if recorded.FromClient {
+			continue
+		}
+		frame, err := websocket.Replayed(recorded)
+		if err != nil {
+			playbackLogger.Warn("Skipping invalid WebSocket frame", "url", transaction.URL, "error", err)
+			continue
+		}
+
+		select {
+		case <-clientClosed:
+			return true
+		case <-time.After(time.Until(handshake.Add(time.Duration(recorded.OffsetMS) * time.Millisecond))):
+		}
+
+		writeMutex.Lock()
+		err = websocket.WriteFrame(client, frame)
+		if frame.Opcode == websocket.OpClose {
+			serverClosed = true
+		}
+		writeMutex.Unlock()
+		if err != nil {
+			return true
+		}
+	}
+
+	// The origin kept the session open until the client left
+	if serverClosed {
+		select {
+		case <-clientClosed:
+		case <-time.After(webSocketCloseTimeout):
+		}
+	} else {
+		<-clientClosed
+	}
+	return true
+}
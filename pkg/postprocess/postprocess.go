@@ -0,0 +1,221 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// DefaultCommandTimeout bounds how long an external command may run
+const DefaultCommandTimeout = 5 * time.Minute
+
+// Hook transforms the recorded transactions after recording finishes and before the inventory is
+// written. It may drop transactions, rewrite them or add tags.
+type Hook interface {
+	Name() string
+	Process(transactions []types.RecordingTransaction) ([]types.RecordingTransaction, error)
+}
+
+// Func adapts a function to a Hook
+type Func struct {
+	Label string
+	Fn    func([]types.RecordingTransaction) ([]types.RecordingTransaction, error)
+}
+
+// Name returns the hook's label
+func (f Func) Name() string {
+	return f.Label
+}
+
+// Process calls the function
+func (f Func) Process(transactions []types.RecordingTransaction) ([]types.RecordingTransaction, error) {
+	return f.Fn(transactions)
+}
+
+// Pipeline runs hooks in order, each receiving the output of the previous one
+type Pipeline []Hook
+
+// Run passes the transactions through every hook
+func (p Pipeline) Run(transactions []types.RecordingTransaction) ([]types.RecordingTransaction, error) {
+	for _, hook := range p {
+		processed, err := hook.Process(transactions)
+		if err != nil {
+			return nil, fmt.Errorf("post-process %s: %w", hook.Name(), err)
+		}
+		transactions = processed
+	}
+	return transactions, nil
+}
+
+// Transaction is how a recorded transaction is exchanged with external commands
+type Transaction struct {
+	// ID identifies the recorded transaction; commands must keep it to keep the transaction
+	ID         int               `json:"id"`
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	StatusCode *int              `json:"statusCode,omitempty"`
+	RawHeaders types.HttpHeaders `json:"rawHeaders,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// Body is base64 encoded in JSON
+	Body []byte `json:"body,omitempty"`
+}
+
+// Command runs an external program that reads the transactions as a JSON array on stdin and writes
+// the transactions to keep, in the same format, to stdout. Transactions are matched by ID; omitted
+// ones are dropped and method, URL, status, headers, tags, metadata and body are taken from the output.
+type Command struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+// ParseCommand splits a command line into arguments like a POSIX shell does, without expanding
+// anything: single quotes keep everything literally, double quotes keep everything but \", \\, \$
+// and \` escapes, and a backslash outside quotes escapes the next character
+func ParseCommand(line string) (Command, error) {
+	args, err := splitWords(line)
+	if err != nil {
+		return Command{}, fmt.Errorf("invalid post-process command: %w", err)
+	}
+	if len(args) == 0 {
+		return Command{}, fmt.Errorf("empty post-process command")
+	}
+	return Command{Args: args, Timeout: DefaultCommandTimeout}, nil
+}
+
+// splitWords splits a command line into shell words
+func splitWords(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			// Inside double quotes a backslash only escapes the characters the shell treats specially
+			if quote == '"' && !strings.ContainsRune("\"$`\\", r) {
+				word.WriteRune('\\')
+			}
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// Name returns the command line
+func (c Command) Name() string {
+	return strings.Join(c.Args, " ")
+}
+
+// Process runs the command
+func (c Command) Process(transactions []types.RecordingTransaction) ([]types.RecordingTransaction, error) {
+	input := make([]Transaction, len(transactions))
+	for i, transaction := range transactions {
+		input[i] = Transaction{
+			ID:         i,
+			Method:     transaction.Method,
+			URL:        transaction.URL,
+			StatusCode: transaction.StatusCode,
+			RawHeaders: transaction.RawHeaders,
+			Tags:       transaction.Tags,
+			Metadata:   transaction.Metadata,
+			Body:       transaction.Body,
+		}
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode transactions: %w", err)
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = DefaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.Args[0], c.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("command failed: %w", err)
+	}
+
+	var output []Transaction
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("failed to parse command output: %w", err)
+	}
+
+	result := make([]types.RecordingTransaction, 0, len(output))
+	seen := make(map[int]bool, len(output))
+	for _, out := range output {
+		if out.ID < 0 || out.ID >= len(transactions) {
+			return nil, fmt.Errorf("unknown transaction id %d in command output", out.ID)
+		}
+		if seen[out.ID] {
+			return nil, fmt.Errorf("duplicate transaction id %d in command output", out.ID)
+		}
+		seen[out.ID] = true
+
+		transaction := transactions[out.ID]
+		transaction.Method = out.Method
+		transaction.URL = out.URL
+		transaction.StatusCode = out.StatusCode
+		transaction.RawHeaders = out.RawHeaders
+		if transaction.RawHeaders == nil {
+			transaction.RawHeaders = make(types.HttpHeaders)
+		}
+		transaction.Tags = out.Tags
+		transaction.Metadata = out.Metadata
+		transaction.Body = out.Body
+		result = append(result, transaction)
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package postprocess
+
+import (
+	"reflect"
+	"testing"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+func TestCommand_RoundTrip(t *testing.T) {
+	status := 200
+	transactions := []types.RecordingTransaction{
+		{Method: "GET", URL: "https://example.com/", StatusCode: &status, RawHeaders: types.HttpHeaders{"Content-Type": "text/html"}, Body: []byte("<html>"), ClientID: "alice", Metadata: map[string]string{"owner": "web"}},
+	}
+
+	// cat returns its input unchanged
+	command, err := ParseCommand("cat")
+	if err != nil {
+		t.Fatalf("Failed to parse command: %v", err)
+	}
+	result, err := command.Process(transactions)
+	if err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("Expected 1 transaction, got %d", len(result))
+	}
+	got := result[0]
+	if got.URL != "https://example.com/" || string(got.Body) != "<html>" || got.RawHeaders["Content-Type"] != "text/html" || got.Metadata["owner"] != "web" {
+		t.Errorf("Transaction changed in round trip: %+v", got)
+	}
+	// Fields not exchanged with the command are kept
+	if got.ClientID != "alice" {
+		t.Errorf("Expected the client ID to be kept, got %q", got.ClientID)
+	}
+}
+
+func TestCommand_RejectsUnknownID(t *testing.T) {
+	command := Command{Args: []string{"echo", `[{"id": 5}]`}}
+	if _, err := command.Process([]types.RecordingTransaction{{Method: "GET"}}); err == nil {
+		t.Error("Expected an error for an unknown transaction id")
+	}
+}
+
+func TestPipeline_StopsOnError(t *testing.T) {
+	calls := 0
+	count := Func{Label: "count", Fn: func(transactions []types.RecordingTransaction) ([]types.RecordingTransaction, error) {
+		calls++
+		return transactions[:len(transactions)-1], nil
+	}}
+	failing := Command{Args: []string{"false"}}
+
+	result, err := Pipeline{count, count}.Run(make([]types.RecordingTransaction, 3))
+	if err != nil || len(result) != 1 || calls != 2 {
+		t.Fatalf("Expected both hooks to run, got %d transactions, %d calls, error %v", len(result), calls, err)
+	}
+	if _, err := (Pipeline{failing, count}).Run(result); err == nil || calls != 2 {
+		t.Errorf("Expected the pipeline to stop at the failing hook, got %d calls, error %v", calls, err)
+	}
+}
+
+func TestParseCommand_Quoting(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{"cat", []string{"cat"}},
+		{"  jq  -c  . ", []string{"jq", "-c", "."}},
+		{`jq 'map(select(.url | test("/analytics/") | not))'`, []string{"jq", `map(select(.url | test("/analytics/") | not))`}},
+		{`grep -v "a b" file`, []string{"grep", "-v", "a b", "file"}},
+		{`echo "say \"hi\" \n"`, []string{"echo", `say "hi" \n`}},
+		{`echo a\ b ''`, []string{"echo", "a b", ""}},
+		{`echo pre'fix'"ed"`, []string{"echo", "prefixed"}},
+	}
+	for _, tt := range tests {
+		command, err := ParseCommand(tt.line)
+		if err != nil {
+			t.Errorf("ParseCommand(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(command.Args, tt.args) {
+			t.Errorf("ParseCommand(%q) = %q, want %q", tt.line, command.Args, tt.args)
+		}
+	}
+
+	for _, line := range []string{"", "   ", `echo 'open`, `echo "open`, `echo \`} {
+		if _, err := ParseCommand(line); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package remote
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveEntry is a regular file of an archive
+type archiveEntry struct {
+	name string
+	size int64
+}
+
+// estimateMemory returns how much memory playing back the files of an archive takes when they are
+// held in memory: the files themselves, plus the response bodies prepared from the content files
+func estimateMemory(files map[string]int64) int64 {
+	var estimate int64
+	for name, size := range files {
+		estimate += size
+		if strings.HasPrefix(name, "contents/") || strings.HasPrefix(name, "originals/") {
+			estimate += size
+		}
+	}
+	return estimate
+}
+
+// load reads the files of the inventory in an archive into memory, by slash-separated path from
+// the inventory root. It fails without reading them when the estimate exceeds budget (if positive).
+func load(archive string, budget int64) (map[string][]byte, int64, error) {
+	var entries []archiveEntry
+	err := walkArchive(archive, func(name string, size int64, _ io.Reader) error {
+		entries = append(entries, archiveEntry{name: name, size: size})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	root, err := archiveRoot(entries)
+	if err != nil {
+		return nil, 0, err
+	}
+	sizes := make(map[string]int64)
+	for _, entry := range entries {
+		if name, ok := strings.CutPrefix(entry.name, root); ok {
+			sizes[name] = entry.size
+		}
+	}
+	estimate := estimateMemory(sizes)
+	if budget > 0 && estimate > budget {
+		return nil, estimate, fmt.Errorf("packed inventory needs about %d MB of memory, more than the budget of %d MB", mb(estimate), mb(budget))
+	}
+
+	files := make(map[string][]byte, len(sizes))
+	err = walkArchive(archive, func(name string, size int64, r io.Reader) error {
+		name, ok := strings.CutPrefix(name, root)
+		if !ok {
+			return nil
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		files[name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, estimate, err
+	}
+	return files, estimate, nil
+}
+
+// walkArchive calls fn with the cleaned slash-separated name, size and content of each regular file
+// of a tar.gz archive
+func walkArchive(archive string, fn func(name string, size int64, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("invalid packed inventory: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid packed inventory: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid path %q in packed inventory", header.Name)
+		}
+		if err := fn(name, header.Size, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// archiveRoot returns the prefix of the files of the inventory in an archive: "" when inventory.json
+// is at its root, or the single top-level folder holding it, like inventoryRoot
+func archiveRoot(entries []archiveEntry) (string, error) {
+	var root string
+	for _, entry := range entries {
+		if entry.name == "inventory.json" {
+			return "", nil
+		}
+		if dir, file, ok := strings.Cut(entry.name, "/"); ok && file == "inventory.json" {
+			root = dir + "/"
+		}
+	}
+	if root == "" {
+		return "", fmt.Errorf("packed inventory has no inventory.json")
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.name, root) {
+			return "", fmt.Errorf("packed inventory has no inventory.json")
+		}
+	}
+	return root, nil
+}
+
+// mb rounds a size up to whole megabytes
+func mb(size int64) int64 {
+	return (size + 1<<20 - 1) >> 20
+}
@@ -0,0 +1,431 @@
+// Package remote fetches packed inventories (tar.gz archives of an inventory directory) over HTTP.
+// Downloads are cached and revalidated with ETags, interrupted downloads resume where they
+// stopped, and archives can be verified against a SHA-256 checksum or a minisign signature.
+package remote
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-http-playback-proxy/pkg/logging"
+)
+
+// logger is the logger for inventory fetching
+var logger = logging.For(logging.ModuleInventory)
+
+// SourceFile is written into an unpacked inventory to record where it came from
+const SourceFile = ".inventory-source.json"
+
+// Options configures Sync
+type Options struct {
+	// URL is the packed inventory to fetch
+	URL string
+	// Dir receives the unpacked inventory; it must be empty, missing or unpacked by Sync before
+	Dir string
+	// CacheDir keeps downloads between runs; empty uses the user cache directory
+	CacheDir string
+	// Checksum is the expected SHA-256 of the archive, or the URL of a sha256sum file
+	Checksum string
+	// PublicKey, if set, requires a minisign signature at URL + ".minisig"
+	PublicKey *MinisignKey
+	// Attempts is how often a failed download is tried (default: 3)
+	Attempts int
+	// Client is used for all requests; nil uses a client that honors proxy environment variables
+	Client *http.Client
+	// InMemory reads the inventory into Result.Files instead of unpacking it into Dir
+	InMemory bool
+	// MemoryBudget refuses an in-memory inventory estimated to need more bytes; 0 is unlimited
+	MemoryBudget int64
+}
+
+// Result describes what Sync did
+type Result struct {
+	Archive string
+	SHA256  string
+	// Downloaded is false when the cached archive was still current or the server was unreachable
+	Downloaded bool
+	// Unpacked is false when Dir already held this archive
+	Unpacked bool
+	// Files holds the files of the inventory by slash-separated path with Options.InMemory
+	Files map[string][]byte
+	// MemoryEstimate is the memory the in-memory inventory is estimated to need during playback
+	MemoryEstimate int64
+}
+
+// cacheMeta is stored next to a cached archive
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	// PartialETag is the validator of the response a .part file was started from
+	PartialETag string `json:"partialEtag,omitempty"`
+}
+
+// source is the content of SourceFile
+type source struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// Sync downloads the packed inventory if it changed, verifies it and unpacks it into Dir, or reads
+// it into memory with Options.InMemory
+func Sync(opts Options) (*Result, error) {
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+	}
+	if opts.CacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate cache directory: %w", err)
+		}
+		opts.CacheDir = filepath.Join(userCache, "http-playback-proxy", "inventories")
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	name := sha256.Sum256([]byte(opts.URL))
+	base := filepath.Join(opts.CacheDir, hex.EncodeToString(name[:8]))
+	result := &Result{Archive: base + ".tar.gz"}
+
+	downloaded, err := download(opts, result.Archive, base+".json")
+	if err != nil {
+		if _, statErr := os.Stat(result.Archive); statErr != nil {
+			return nil, err
+		}
+		// A flaky network should not fail a run that has everything it needs
+		logger.Warn("Failed to refresh packed inventory, using cached copy", "url", opts.URL, "error", err)
+	}
+	result.Downloaded = downloaded
+
+	result.SHA256, err = fileSHA256(result.Archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash archive: %w", err)
+	}
+	if err := verify(opts, result); err != nil {
+		// Never reuse an archive that failed verification
+		os.Remove(result.Archive)
+		os.Remove(base + ".json")
+		return nil, err
+	}
+
+	if opts.InMemory {
+		result.Files, result.MemoryEstimate, err = load(result.Archive, opts.MemoryBudget)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	result.Unpacked, err = unpack(result.Archive, opts.Dir, source{URL: opts.URL, SHA256: result.SHA256})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// verify checks the archive against the configured checksum and signature
+func verify(opts Options, result *Result) error {
+	if opts.Checksum != "" {
+		text := opts.Checksum
+		if strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://") {
+			data, err := fetchSmall(opts, text)
+			if err != nil {
+				return fmt.Errorf("failed to fetch checksum: %w", err)
+			}
+			text = string(data)
+		}
+		expected, err := parseChecksum(text)
+		if err != nil {
+			return err
+		}
+		if expected != result.SHA256 {
+			return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", opts.URL, expected, result.SHA256)
+		}
+	}
+	if opts.PublicKey != nil {
+		signature, err := fetchSmall(opts, opts.URL+".minisig")
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature: %w", err)
+		}
+		if err := opts.PublicKey.Verify(result.Archive, signature); err != nil {
+			return fmt.Errorf("invalid signature for %s: %w", opts.URL, err)
+		}
+	}
+	return nil
+}
+
+// download refreshes the cached archive and reports whether a new copy was downloaded
+func download(opts Options, archive, metaPath string) (bool, error) {
+	var meta cacheMeta
+	if data, err := os.ReadFile(metaPath); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	if meta.URL != opts.URL {
+		meta = cacheMeta{URL: opts.URL}
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= opts.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+		downloaded, err := downloadOnce(opts, archive, metaPath, &meta)
+		if err == nil {
+			return downloaded, nil
+		}
+		lastErr = err
+		logger.Warn("Packed inventory download failed", "url", opts.URL, "attempt", attempt, "error", err)
+	}
+	return false, lastErr
+}
+
+func downloadOnce(opts Options, archive, metaPath string, meta *cacheMeta) (bool, error) {
+	part := archive + ".part"
+	req, err := http.NewRequest(http.MethodGet, opts.URL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Resume an interrupted download, unless it cannot be validated against the same response
+	var offset int64
+	if info, err := os.Stat(part); err == nil && info.Size() > 0 && meta.PartialETag != "" {
+		offset = info.Size()
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+		req.Header.Set("If-Range", meta.PartialETag)
+	} else if _, err := os.Stat(archive); err == nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), "bytes "+strconv.FormatInt(offset, 10)+"-") {
+			return false, fmt.Errorf("unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+		flags |= os.O_APPEND
+		logger.Info("Resuming packed inventory download", "url", opts.URL, "offset", offset)
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		meta.PartialETag = resp.Header.Get("ETag")
+		if err := writeMeta(metaPath, meta); err != nil {
+			return false, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is useless; start over on the next attempt
+		os.Remove(part)
+		meta.PartialETag = ""
+		return false, fmt.Errorf("server rejected resuming at byte %d", offset)
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to open download file: %w", err)
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		// The partial file is kept so the next attempt resumes
+		return false, fmt.Errorf("download interrupted: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return false, fmt.Errorf("failed to write download file: %w", err)
+	}
+	if err := os.Rename(part, archive); err != nil {
+		return false, fmt.Errorf("failed to store download: %w", err)
+	}
+
+	meta.ETag = resp.Header.Get("ETag")
+	if meta.ETag == "" {
+		meta.ETag = meta.PartialETag
+	}
+	meta.LastModified = resp.Header.Get("Last-Modified")
+	meta.PartialETag = ""
+	return true, writeMeta(metaPath, meta)
+}
+
+func writeMeta(path string, meta *cacheMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache metadata: %w", err)
+	}
+	return nil
+}
+
+// fetchSmall downloads a checksum or signature file
+func fetchSmall(opts Options, url string) ([]byte, error) {
+	var lastErr error
+	for attempt := 1; attempt <= opts.Attempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * time.Second)
+		}
+		resp, err := opts.Client.Get(url)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			// Missing files do not appear on retry
+			return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+		}
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// unpack extracts the archive into dir unless dir already holds it
+func unpack(archive, dir string, src source) (bool, error) {
+	if data, err := os.ReadFile(filepath.Join(dir, SourceFile)); err == nil {
+		var current source
+		if json.Unmarshal(data, &current) == nil && current == src {
+			return false, nil
+		}
+	} else if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return false, fmt.Errorf("refusing to replace %s: it is not empty and was not unpacked from a packed inventory", dir)
+	}
+
+	parent := filepath.Dir(filepath.Clean(dir))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extract(archive, tmp); err != nil {
+		return false, err
+	}
+	root, err := inventoryRoot(tmp)
+	if err != nil {
+		return false, err
+	}
+	data, err := json.MarshalIndent(src, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(filepath.Join(root, SourceFile), data, 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", SourceFile, err)
+	}
+
+	// The previous copy is only removed once the new one is complete
+	if err := os.RemoveAll(dir); err != nil {
+		return false, fmt.Errorf("failed to remove previous inventory: %w", err)
+	}
+	if err := os.Rename(root, dir); err != nil {
+		return false, fmt.Errorf("failed to move inventory into place: %w", err)
+	}
+	return true, nil
+}
+
+// extract writes the regular files and directories of a tar.gz archive below dir
+func extract(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("invalid packed inventory: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid packed inventory: %w", err)
+		}
+
+		name := filepath.FromSlash(strings.TrimPrefix(header.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		target := filepath.Join(dir, name)
+		if filepath.IsAbs(name) || !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path %q in packed inventory", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("failed to extract %s: %w", header.Name, err)
+			}
+		default:
+			// Links and devices have no place in an inventory
+			logger.Debug("Skipping archive entry", "name", header.Name, "type", header.Typeflag)
+		}
+	}
+}
+
+// inventoryRoot returns the directory holding inventory.json: the extraction directory itself, or
+// the single directory in it when the archive was packed with a top-level folder
+func inventoryRoot(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "inventory.json")); err == nil {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		nested := filepath.Join(dir, entries[0].Name())
+		if _, err := os.Stat(filepath.Join(nested, "inventory.json")); err == nil {
+			return nested, nil
+		}
+	}
+	return "", fmt.Errorf("packed inventory has no inventory.json")
+}
@@ -0,0 +1,259 @@
+package remote
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// packInventory returns a tar.gz holding an inventory.json and one content file
+func packInventory(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	files := []struct{ name, content string }{
+		{"inventory.json", `{"resources":[]}`},
+		{"contents/get/index.html", body},
+	}
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		tw.Write([]byte(file.content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// archiveServer serves an archive with ETag and Range support and records the requests it saw
+type archiveServer struct {
+	mutex     sync.Mutex
+	archive   []byte
+	files     map[string][]byte
+	requests  []http.Header
+	interrupt bool
+}
+
+func (s *archiveServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if data, ok := s.files[r.URL.Path]; ok {
+		w.Write(data)
+		return
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.Header.Clone())
+	archive := s.archive
+	interrupt := s.interrupt
+	s.interrupt = false
+	s.mutex.Unlock()
+
+	sum := sha256.Sum256(archive)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:4])+`"`)
+	if interrupt {
+		// Announce the whole archive but drop the connection halfway
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(archive[:len(archive)/2])
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	http.ServeContent(w, r, "inventory.tar.gz", time.Time{}, bytes.NewReader(archive))
+}
+
+func (s *archiveServer) lastRequest() http.Header {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func TestSync_CachesWithETag(t *testing.T) {
+	server := &archiveServer{archive: packInventory(t, "<html>v1</html>")}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "inventory")
+	opts := Options{URL: ts.URL + "/inventory.tar.gz", Dir: dir, CacheDir: t.TempDir()}
+
+	result, err := Sync(opts)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !result.Downloaded || !result.Unpacked {
+		t.Errorf("Expected the first sync to download and unpack, got %+v", result)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "contents", "get", "index.html")); err != nil || string(data) != "<html>v1</html>" {
+		t.Errorf("Expected unpacked content, got %q (%v)", data, err)
+	}
+
+	result, err = Sync(opts)
+	if err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if result.Downloaded || result.Unpacked {
+		t.Errorf("Expected the cached copy to be reused, got %+v", result)
+	}
+	if server.lastRequest().Get("If-None-Match") == "" {
+		t.Error("Expected the second request to be conditional")
+	}
+
+	// A new archive replaces the inventory it unpacked before
+	server.mutex.Lock()
+	server.archive = packInventory(t, "<html>v2</html>")
+	server.mutex.Unlock()
+	if result, err = Sync(opts); err != nil || !result.Downloaded || !result.Unpacked {
+		t.Fatalf("Expected the changed archive to be unpacked, got %+v (%v)", result, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "contents", "get", "index.html")); string(data) != "<html>v2</html>" {
+		t.Errorf("Expected the new content, got %q", data)
+	}
+}
+
+func TestSync_ResumesInterruptedDownload(t *testing.T) {
+	server := &archiveServer{archive: packInventory(t, "<html>resumed</html>"), interrupt: true}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "inventory")
+	result, err := Sync(Options{URL: ts.URL + "/inventory.tar.gz", Dir: dir, CacheDir: t.TempDir(), Attempts: 2})
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if !result.Downloaded {
+		t.Errorf("Expected a download, got %+v", result)
+	}
+	last := server.lastRequest()
+	if last.Get("Range") != "bytes="+strconv.Itoa(len(server.archive)/2)+"-" || last.Get("If-Range") == "" {
+		t.Errorf("Expected the retry to resume, got Range %q If-Range %q", last.Get("Range"), last.Get("If-Range"))
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "contents", "get", "index.html")); string(data) != "<html>resumed</html>" {
+		t.Errorf("Expected the resumed content, got %q", data)
+	}
+}
+
+func TestSync_VerifiesChecksum(t *testing.T) {
+	archive := packInventory(t, "<html></html>")
+	sum := sha256.Sum256(archive)
+	digest := hex.EncodeToString(sum[:])
+	server := &archiveServer{archive: archive, files: map[string][]byte{
+		"/inventory.tar.gz.sha256": []byte(digest + "  inventory.tar.gz\n"),
+	}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	url := ts.URL + "/inventory.tar.gz"
+	if _, err := Sync(Options{URL: url, Dir: filepath.Join(t.TempDir(), "a"), CacheDir: t.TempDir(), Checksum: url + ".sha256"}); err != nil {
+		t.Errorf("Expected the checksum file to match: %v", err)
+	}
+
+	cacheDir := t.TempDir()
+	wrong := hex.EncodeToString(make([]byte, sha256.Size))
+	if _, err := Sync(Options{URL: url, Dir: filepath.Join(t.TempDir(), "b"), CacheDir: cacheDir, Checksum: wrong}); err == nil {
+		t.Error("Expected a checksum mismatch")
+	}
+	if archives, _ := filepath.Glob(filepath.Join(cacheDir, "*.tar.gz")); len(archives) != 0 {
+		t.Errorf("Expected the rejected archive to be removed, got %v", archives)
+	}
+}
+
+func TestSync_VerifiesMinisignSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	keyID := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	pubkey := "untrusted comment: minisign public key\n" +
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), public...)) + "\n"
+
+	// Signs like minisign -S: the BLAKE2b-512 of the file, then the signature and trusted comment
+	sign := func(archive []byte) []byte {
+		digest := blake2b.Sum512(archive)
+		signature := ed25519.Sign(private, digest[:])
+		comment := "timestamp:1700000000\tfile:inventory.tar.gz"
+		global := ed25519.Sign(private, append(append([]byte{}, signature...), comment...))
+		return []byte("untrusted comment: signature\n" +
+			base64.StdEncoding.EncodeToString(append(append([]byte("ED"), keyID...), signature...)) + "\n" +
+			"trusted comment: " + comment + "\n" +
+			base64.StdEncoding.EncodeToString(global) + "\n")
+	}
+
+	archive := packInventory(t, "<html>signed</html>")
+	server := &archiveServer{archive: archive, files: map[string][]byte{"/inventory.tar.gz.minisig": sign(archive)}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	key, err := ParseMinisignKey(pubkey)
+	if err != nil {
+		t.Fatalf("Failed to parse key: %v", err)
+	}
+	opts := Options{URL: ts.URL + "/inventory.tar.gz", Dir: filepath.Join(t.TempDir(), "inventory"), CacheDir: t.TempDir(), PublicKey: key}
+	if _, err := Sync(opts); err != nil {
+		t.Fatalf("Expected a valid signature: %v", err)
+	}
+
+	// An archive swapped on the server no longer matches its signature
+	server.mutex.Lock()
+	server.archive = packInventory(t, "<html>tampered</html>")
+	server.mutex.Unlock()
+	if _, err := Sync(opts); err == nil {
+		t.Error("Expected the tampered archive to be rejected")
+	}
+}
+
+func TestSync_RefusesForeignDirectory(t *testing.T) {
+	ts := httptest.NewServer(&archiveServer{archive: packInventory(t, "")})
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "inventory.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatalf("Failed to write inventory: %v", err)
+	}
+	if _, err := Sync(Options{URL: ts.URL + "/inventory.tar.gz", Dir: dir, CacheDir: t.TempDir()}); err == nil {
+		t.Error("Expected a hand-made inventory to be left alone")
+	}
+}
+
+func TestSync_InMemory(t *testing.T) {
+	ts := httptest.NewServer(&archiveServer{archive: packInventory(t, "<html>in memory</html>")})
+	defer ts.Close()
+
+	dir := filepath.Join(t.TempDir(), "inventory")
+	opts := Options{URL: ts.URL + "/inventory.tar.gz", Dir: dir, CacheDir: t.TempDir(), InMemory: true}
+	result, err := Sync(opts)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if string(result.Files["contents/get/index.html"]) != "<html>in memory</html>" || result.Files["inventory.json"] == nil {
+		t.Errorf("Expected the inventory files in memory, got %v", result.Files)
+	}
+	// The content file counts twice: as a file and as the response prepared from it
+	if expected := int64(len(`{"resources":[]}`) + 2*len("<html>in memory</html>")); result.MemoryEstimate != expected {
+		t.Errorf("Expected a memory estimate of %d bytes, got %d", expected, result.MemoryEstimate)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing to be unpacked, got %v", err)
+	}
+
+	opts.MemoryBudget = 10
+	if _, err := Sync(opts); err == nil {
+		t.Error("Expected an inventory over the memory budget to be refused")
+	}
+}
@@ -0,0 +1,158 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// fileSHA256 returns the hex SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseChecksum returns the hex digest from a bare digest or a sha256sum line ("<digest>  <name>")
+func parseChecksum(text string) (string, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum")
+	}
+	digest := strings.ToLower(fields[0])
+	if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("%q is not a SHA-256 digest", fields[0])
+	}
+	return digest, nil
+}
+
+// minisign signature algorithms: Ed signs the file itself, ED its BLAKE2b-512 hash
+const (
+	minisignLegacy    = "Ed"
+	minisignPrehashed = "ED"
+)
+
+// MinisignKey is a minisign public key
+type MinisignKey struct {
+	id  [8]byte
+	key ed25519.PublicKey
+}
+
+// ParseMinisignKey parses a public key given as its base64 line or as the contents of a
+// minisign.pub file
+func ParseMinisignKey(text string) (*MinisignKey, error) {
+	line := lastLine(text)
+	data, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minisign public key: %w", err)
+	}
+	if len(data) != 2+8+ed25519.PublicKeySize || string(data[:2]) != minisignLegacy {
+		return nil, fmt.Errorf("invalid minisign public key")
+	}
+	key := &MinisignKey{key: ed25519.PublicKey(data[10:])}
+	copy(key.id[:], data[2:10])
+	return key, nil
+}
+
+// Verify checks a .minisig signature of the file at path
+func (k *MinisignKey) Verify(path string, signature []byte) error {
+	lines := nonEmptyLines(string(signature))
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("malformed minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("malformed minisign signature")
+	}
+	if !bytes.Equal(sig[2:10], k.id[:]) {
+		return fmt.Errorf("signature was made with key %X, not %X", reverse(sig[2:10]), reverse(k.id[:]))
+	}
+
+	var message []byte
+	switch string(sig[:2]) {
+	case minisignLegacy:
+		message, err = os.ReadFile(path)
+	case minisignPrehashed:
+		message, err = fileBlake2b(path)
+	default:
+		return fmt.Errorf("unsupported minisign algorithm %q", sig[:2])
+	}
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(k.key, message, sig[10:]) {
+		return fmt.Errorf("signature verification failed")
+	}
+
+	// The global signature covers the signature and the trusted comment
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return fmt.Errorf("malformed minisign global signature")
+	}
+	trusted := append(append([]byte{}, sig[10:]...), strings.TrimPrefix(lines[2], "trusted comment: ")...)
+	if !ed25519.Verify(k.key, trusted, global) {
+		return fmt.Errorf("trusted comment verification failed")
+	}
+	return nil
+}
+
+func fileBlake2b(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// lastLine returns the last non-empty line, skipping minisign's "untrusted comment" header
+func lastLine(text string) string {
+	lines := nonEmptyLines(text)
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[len(lines)-1]
+}
+
+func nonEmptyLines(text string) []string {
+	var lines []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// reverse returns the key ID in the byte order minisign prints it
+func reverse(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
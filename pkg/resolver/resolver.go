@@ -0,0 +1,182 @@
+// Package resolver resolves upstream host names with a chosen DNS server or DNS-over-HTTPS
+// endpoint instead of the host's resolver, so recordings do not depend on the machine they are
+// made on.
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// System names the resolver of the host, used when none is configured
+const System = "system"
+
+// DefaultTimeout bounds each query to a configured resolver
+const DefaultTimeout = 5 * time.Second
+
+// dnsMessageType is the media type of DNS-over-HTTPS queries and answers (RFC 8484)
+const dnsMessageType = "application/dns-message"
+
+// maxMessageSize is the largest DNS message over TCP or HTTPS
+const maxMessageSize = 65535
+
+// New returns a resolver querying spec, a DNS server (1.1.1.1, 1.1.1.1:53, [2606:4700::1111]:53)
+// or a DNS-over-HTTPS URL (https://cloudflare-dns.com/dns-query), and the name recordings refer to
+// it by
+func New(spec string) (*net.Resolver, string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, "", fmt.Errorf("no resolver given")
+	}
+
+	if strings.Contains(spec, "://") {
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid DNS-over-HTTPS URL: %w", err)
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return nil, "", fmt.Errorf("DNS-over-HTTPS URL must be https://HOST/PATH, got %s", spec)
+		}
+		// The endpoint itself is resolved by the host, or given as an IP address
+		client := &http.Client{
+			Timeout: DefaultTimeout,
+			Transport: &http.Transport{
+				Proxy:       http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{Timeout: DefaultTimeout, Resolver: &net.Resolver{}}).DialContext,
+			},
+		}
+		return newDoHResolver(u.String(), client), u.String(), nil
+	}
+
+	server := spec
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil || net.ParseIP(host) == nil {
+		return nil, "", fmt.Errorf("DNS server must be an IP address with an optional port, got %s", spec)
+	}
+	dialer := &net.Dialer{Timeout: DefaultTimeout}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}, server, nil
+}
+
+// Install makes the resolver of spec the default of the process, which the proxy dials upstream
+// hosts with, and returns its name
+func Install(spec string) (string, error) {
+	r, name, err := New(spec)
+	if err != nil {
+		return "", err
+	}
+	net.DefaultResolver = r
+	return name, nil
+}
+
+// newDoHResolver returns a resolver sending its queries to a DNS-over-HTTPS endpoint with client
+func newDoHResolver(endpoint string, client *http.Client) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, endpoint: endpoint, client: client}, nil
+		},
+	}
+}
+
+// dohConn carries the DNS messages of the Go resolver over HTTPS. It is not a net.PacketConn, so the
+// resolver frames messages as over TCP, each prefixed with its length; every complete query is
+// posted when written and its answer is read back with the same framing.
+type dohConn struct {
+	ctx      context.Context
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	written bytes.Buffer
+	answers bytes.Buffer
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written.Write(b)
+	for c.written.Len() >= 2 {
+		size := int(binary.BigEndian.Uint16(c.written.Bytes()[:2]))
+		if c.written.Len() < 2+size {
+			break
+		}
+		query := make([]byte, size)
+		copy(query, c.written.Bytes()[2:2+size])
+		c.written.Next(2 + size)
+
+		answer, err := c.exchange(query)
+		if err != nil {
+			return 0, err
+		}
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(answer)))
+		c.answers.Write(length[:])
+		c.answers.Write(answer)
+	}
+	return len(b), nil
+}
+
+// exchange posts a query to the endpoint and returns the answer
+func (c *dohConn) exchange(query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodPost, c.endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNS-over-HTTPS request: %w", err)
+	}
+	req.Header.Set("Content-Type", dnsMessageType)
+	req.Header.Set("Accept", dnsMessageType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", c.endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query %s: status %d", c.endpoint, resp.StatusCode)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read answer from %s: %w", c.endpoint, err)
+	}
+	if len(answer) > maxMessageSize {
+		return nil, fmt.Errorf("answer from %s is too large", c.endpoint)
+	}
+	return answer, nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.answers.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.answers.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr(c.endpoint) }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr(c.endpoint) }
+func (c *dohConn) SetDeadline(t time.Time) error      { return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// dohAddr is the address of a DNS-over-HTTPS endpoint
+type dohAddr string
+
+func (a dohAddr) Network() string { return "https" }
+func (a dohAddr) String() string  { return string(a) }
@@ -0,0 +1,102 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// answerA answers a DNS query with address for A questions and no records for others
+func answerA(query []byte, address net.IP) []byte {
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		end += int(query[end]) + 1
+	}
+	question := query[12 : end+5]
+	qtype := binary.BigEndian.Uint16(query[end+1 : end+3])
+
+	answer := append([]byte(nil), query[:12]...)
+	answer[2], answer[3] = 0x81, 0x80 // response, recursion desired and available
+	binary.BigEndian.PutUint16(answer[4:], 1)
+	binary.BigEndian.PutUint16(answer[6:], 0)
+	binary.BigEndian.PutUint16(answer[8:], 0)
+	binary.BigEndian.PutUint16(answer[10:], 0)
+	answer = append(answer, question...)
+	if qtype == 1 {
+		binary.BigEndian.PutUint16(answer[6:], 1)
+		answer = append(answer, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		answer = append(answer, address.To4()...)
+	}
+	return answer
+}
+
+func TestNew_Server(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(answerA(buf[:n], net.IPv4(10, 1, 2, 3)), addr)
+		}
+	}()
+
+	r, name, err := New(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	if name != conn.LocalAddr().String() {
+		t.Errorf("Expected the server as name, got %s", name)
+	}
+	addrs, err := r.LookupHost(context.Background(), "recorded.example")
+	if err != nil || len(addrs) != 1 || addrs[0] != "10.1.2.3" {
+		t.Errorf("Expected 10.1.2.3, got %v (%v)", addrs, err)
+	}
+}
+
+func TestNew_DoH(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dnsMessageType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(answerA(query, net.IPv4(10, 4, 5, 6)))
+	}))
+	defer server.Close()
+
+	r := newDoHResolver(server.URL+"/dns-query", server.Client())
+	addrs, err := r.LookupHost(context.Background(), "recorded.example")
+	if err != nil || len(addrs) != 1 || addrs[0] != "10.4.5.6" {
+		t.Errorf("Expected 10.4.5.6, got %v (%v)", addrs, err)
+	}
+}
+
+func TestNew_Validation(t *testing.T) {
+	for _, spec := range []string{"", "dns.example.com", "http://1.1.1.1/dns-query", "https:///dns-query"} {
+		if _, _, err := New(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+	for spec, expected := range map[string]string{
+		"1.1.1.1":                              "1.1.1.1:53",
+		"1.1.1.1:5353":                         "1.1.1.1:5353",
+		"2606:4700::1111":                      "[2606:4700::1111]:53",
+		"https://cloudflare-dns.com/dns-query": "https://cloudflare-dns.com/dns-query",
+	} {
+		if _, name, err := New(spec); err != nil || name != expected {
+			t.Errorf("%s: expected %s, got %s (%v)", spec, expected, name, err)
+		}
+	}
+}
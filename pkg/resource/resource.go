@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/url"
+	"path"
 	"strings"
 )
 
@@ -86,6 +87,7 @@ func MethodURLToFilePathWithOptions(method, rawURL string, options ResourcePathO
 	if hostname == "" {
 		return "", fmt.Errorf("hostname is required in URL: %s", rawURL)
 	}
+	hostname = hostDirName(hostname)
 
 	// Get path
 	path := parsedURL.Path
@@ -107,6 +109,23 @@ func MethodURLToFilePathWithOptions(method, rawURL string, options ResourcePathO
 	return filePath, nil
 }
 
+// hostDirName makes a host usable as a directory name. IPv6 literals keep their brackets and
+// have their colons, which Windows does not allow in file names, replaced with underscores.
+func hostDirName(hostname string) string {
+	if strings.Contains(hostname, ":") {
+		return "[" + strings.ReplaceAll(hostname, ":", "_") + "]"
+	}
+	return hostname
+}
+
+// hostFromDirName reverses hostDirName; IPv6 literals are returned bracketed for use in URLs
+func hostFromDirName(name string) string {
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		return strings.ReplaceAll(name, "_", ":")
+	}
+	return name
+}
+
 // normalizeResourcePath handles directory paths and missing extensions
 func normalizeResourcePath(path string) string {
 	// If path ends with / or has no extension, append index.html
@@ -244,7 +263,7 @@ func FilePathToMethodURL(filePath string) (method, urlString string, err error)
 
 	method = strings.ToUpper(parts[0])
 	protocol := parts[1]
-	hostname := parts[2]
+	hostname := hostFromDirName(parts[2])
 
 	// Reconstruct the path
 	var pathParts []string
@@ -333,6 +352,26 @@ func SanitizeFilePath(path string) string {
 	return strings.Join(parts, "/")
 }
 
+// NormalizeFilePath returns a content file path in the form inventories store it: relative, with
+// forward slashes whatever platform wrote it
+func NormalizeFilePath(filePath string) string {
+	filePath = path.Clean("/" + strings.ReplaceAll(filePath, "\\", "/"))
+	return strings.TrimPrefix(filePath, "/")
+}
+
+// FoldFilePath returns the key under which case-insensitive file systems (Windows, macOS) see a
+// content file path, so paths that only differ in case can be told apart before they collide
+func FoldFilePath(filePath string) string {
+	return strings.ToLower(NormalizeFilePath(filePath))
+}
+
+// DisambiguateFilePath returns the n-th alternative of a content file path, with "_n" before its
+// extension, for a path that collides with another one on case-insensitive file systems
+func DisambiguateFilePath(filePath string, n int) string {
+	ext := getFileExt(filePath)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(filePath, ext), n, ext)
+}
+
 // GetResourceFilePath is a convenience function that combines path conversion and sanitization
 func GetResourceFilePath(method, rawURL string) (string, error) {
 	path, err := MethodURLToFilePath(method, rawURL)
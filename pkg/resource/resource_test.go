@@ -293,6 +293,27 @@ func TestRoundTripConversion(t *testing.T) {
 	}
 }
 
+func TestIPv6HostRoundTrip(t *testing.T) {
+	filePath, err := MethodURLToFilePath("GET", "http://[2001:db8::1]:8080/app.js")
+	if err != nil {
+		t.Fatalf("MethodURLToFilePath error: %v", err)
+	}
+	if filePath != "get/http/[2001_db8__1]/app.js" {
+		t.Errorf("Unexpected file path: %s", filePath)
+	}
+	if strings.Contains(filePath, ":") {
+		t.Errorf("File path must not contain colons: %s", filePath)
+	}
+
+	_, url, err := FilePathToMethodURL(filePath)
+	if err != nil {
+		t.Fatalf("FilePathToMethodURL error: %v", err)
+	}
+	if url != "http://[2001:db8::1]/app.js" {
+		t.Errorf("Expected a bracketed IPv6 URL, got %s", url)
+	}
+}
+
 func TestSanitizeFilePath(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -389,4 +410,28 @@ func TestCustomOptions(t *testing.T) {
 	if !strings.Contains(result, "~") {
 		t.Error("Expected result to contain ~ separator")
 	}
-}
\ No newline at end of file
+}
+func TestNormalizeFilePath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"get/https/example.com/index.html", "get/https/example.com/index.html"},
+		{`get\https\example.com\app.js`, "get/https/example.com/app.js"},
+		{"./get//https/example.com/", "get/https/example.com"},
+		{"/get/https/example.com/a.css", "get/https/example.com/a.css"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeFilePath(tt.input); got != tt.expected {
+			t.Errorf("NormalizeFilePath(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+
+	if FoldFilePath(`get\https\example.com\Logo.PNG`) != FoldFilePath("get/https/example.com/logo.png") {
+		t.Error("Expected paths differing in case and separators to fold to the same key")
+	}
+	if got := DisambiguateFilePath("get/https/example.com/logo.png", 2); got != "get/https/example.com/logo_2.png" {
+		t.Errorf("DisambiguateFilePath = %q", got)
+	}
+}
@@ -0,0 +1,164 @@
+package sampling
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-http-playback-proxy/pkg/match"
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Rule limits how many responses matching a URL pattern are recorded
+type Rule struct {
+	// Pattern is a glob matched against "host/path" (without scheme and query)
+	Pattern string
+	// Every records 1 in Every matching responses (0 disables)
+	Every int
+	// Max records at most Max matching responses (0 disables)
+	Max int
+}
+
+// ParseRule parses "pattern=1/N" or "pattern=max:M"
+func ParseRule(spec string) (Rule, error) {
+	pattern, value, ok := strings.Cut(spec, "=")
+	pattern = strings.TrimSpace(pattern)
+	if !ok || pattern == "" {
+		return Rule{}, fmt.Errorf("invalid sampling rule %q, expected pattern=1/N or pattern=max:M", spec)
+	}
+	if _, err := match.Compile(pattern); err != nil {
+		return Rule{}, err
+	}
+
+	rule := Rule{Pattern: pattern}
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, "1/"):
+		n, err := strconv.Atoi(strings.TrimPrefix(value, "1/"))
+		if err != nil || n < 1 {
+			return Rule{}, fmt.Errorf("invalid sampling rate %q", value)
+		}
+		rule.Every = n
+	case strings.HasPrefix(value, "max:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(value, "max:"))
+		if err != nil || n < 1 {
+			return Rule{}, fmt.Errorf("invalid sampling limit %q", value)
+		}
+		rule.Max = n
+	default:
+		return Rule{}, fmt.Errorf("invalid sampling rule %q, expected pattern=1/N or pattern=max:M", spec)
+	}
+	return rule, nil
+}
+
+// Sampler decides which responses of chatty endpoints are recorded and aggregates the timing of all of them
+type Sampler struct {
+	rules []Rule
+	// patterns are the compiled patterns of the rules; nil for invalid patterns, which match nothing
+	patterns []*match.Pattern
+	seen     []int
+	stats    []types.SampleStats
+	mutex    sync.Mutex
+}
+
+// NewSampler creates a sampler; the first matching rule applies
+func NewSampler(rules []Rule) *Sampler {
+	s := &Sampler{
+		rules: rules,
+		seen:  make([]int, len(rules)),
+		stats: make([]types.SampleStats, len(rules)),
+	}
+	for i, rule := range rules {
+		s.stats[i].Pattern = rule.Pattern
+		pattern, _ := match.Compile(rule.Pattern)
+		s.patterns = append(s.patterns, pattern)
+	}
+	return s
+}
+
+// Sample returns the pattern of the matching rule ("" if none) and whether the response should be recorded
+func (s *Sampler) Sample(u *url.URL) (string, bool) {
+	if s == nil || u == nil {
+		return "", true
+	}
+	target := strings.ToLower(u.Host) + u.Path
+	for i, rule := range s.rules {
+		if s.patterns[i] == nil || !s.patterns[i].Match(target) {
+			continue
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		n := s.seen[i]
+		s.seen[i]++
+		keep := (rule.Every == 0 || n%rule.Every == 0) && (rule.Max == 0 || s.stats[i].Recorded < rule.Max)
+		if keep {
+			s.stats[i].Recorded++
+		}
+		return rule.Pattern, keep
+	}
+	return "", true
+}
+
+// index returns the rule index of a pattern, or -1
+func (s *Sampler) index(pattern string) int {
+	if s == nil || pattern == "" {
+		return -1
+	}
+	for i, rule := range s.rules {
+		if rule.Pattern == pattern {
+			return i
+		}
+	}
+	return -1
+}
+
+// Observe adds the timing of a response matched by pattern to its statistics, whether or not it was recorded
+func (s *Sampler) Observe(pattern string, ttfbMS int64, mbps float64) {
+	rule := s.index(pattern)
+	if rule < 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stats := &s.stats[rule]
+	if stats.Observed == 0 || ttfbMS < stats.TTFBMinMS {
+		stats.TTFBMinMS = ttfbMS
+	}
+	if ttfbMS > stats.TTFBMaxMS {
+		stats.TTFBMaxMS = ttfbMS
+	}
+	// Running averages over every observed response
+	n := float64(stats.Observed)
+	stats.TTFBAvgMS = (stats.TTFBAvgMS*n + float64(ttfbMS)) / (n + 1)
+	stats.MBPSAvg = (stats.MBPSAvg*n + mbps) / (n + 1)
+	stats.Observed++
+}
+
+// Skipped returns how many responses were not recorded across all rules
+func (s *Sampler) Skipped() int {
+	if s == nil {
+		return 0
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	skipped := 0
+	for i := range s.rules {
+		skipped += s.seen[i] - s.stats[i].Recorded
+	}
+	return skipped
+}
+
+// Stats returns a copy of the statistics of a pattern, or nil
+func (s *Sampler) Stats(pattern string) *types.SampleStats {
+	rule := s.index(pattern)
+	if rule < 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	stats := s.stats[rule]
+	return &stats
+}
@@ -0,0 +1,65 @@
+package sampling
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("api.example.com/poll*=1/10")
+	if err != nil || rule.Pattern != "api.example.com/poll*" || rule.Every != 10 {
+		t.Errorf("Unexpected rule %+v (%v)", rule, err)
+	}
+	rule, err = ParseRule("*/status=max:3")
+	if err != nil || rule.Max != 3 {
+		t.Errorf("Unexpected rule %+v (%v)", rule, err)
+	}
+	for _, spec := range []string{"api.example.com/poll", "x=1/0", "x=max:", "[=1/2", "x=every"} {
+		if _, err := ParseRule(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	sampler := NewSampler([]Rule{
+		{Pattern: "example.com/poll", Every: 3},
+		{Pattern: "example.com/status", Max: 2},
+	})
+
+	poll, _ := url.Parse("https://example.com/poll?t=1")
+	var kept int
+	for i := 0; i < 9; i++ {
+		pattern, keep := sampler.Sample(poll)
+		if pattern != "example.com/poll" {
+			t.Fatalf("Expected poll pattern, got %q", pattern)
+		}
+		if keep {
+			kept++
+		}
+		sampler.Observe(pattern, int64(10*(i+1)), 1)
+	}
+	if kept != 3 {
+		t.Errorf("Expected 1 in 3 to be kept, got %d of 9", kept)
+	}
+
+	status, _ := url.Parse("https://example.com/status")
+	kept = 0
+	for i := 0; i < 5; i++ {
+		if _, keep := sampler.Sample(status); keep {
+			kept++
+		}
+	}
+	if kept != 2 {
+		t.Errorf("Expected at most 2 to be kept, got %d", kept)
+	}
+
+	if pattern, keep := sampler.Sample(&url.URL{Host: "example.com", Path: "/other"}); pattern != "" || !keep {
+		t.Errorf("Expected unmatched URLs to be kept, got %q %v", pattern, keep)
+	}
+
+	stats := sampler.Stats("example.com/poll")
+	if stats.Observed != 9 || stats.Recorded != 3 || stats.TTFBMinMS != 10 || stats.TTFBMaxMS != 90 || stats.TTFBAvgMS != 50 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
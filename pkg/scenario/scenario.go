@@ -0,0 +1,250 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Expectation describes a request that must (or must not) be observed during playback
+type Expectation struct {
+	Name       string                 `json:"name,omitempty"`
+	Method     string                 `json:"method,omitempty"`
+	URL        string                 `json:"url,omitempty"`
+	Host       string                 `json:"host,omitempty"`
+	Path       string                 `json:"path,omitempty"`
+	JSONFields map[string]interface{} `json:"jsonFields,omitempty"`
+	Times      *int                   `json:"times,omitempty"`
+	AtLeast    *int                   `json:"atLeast,omitempty"`
+	AtMost     *int                   `json:"atMost,omitempty"`
+}
+
+// Scenario is the declarative verification config loaded from a JSON file
+type Scenario struct {
+	Expectations []Expectation `json:"expectations"`
+}
+
+// Result is the evaluated outcome of a single expectation
+type Result struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Count    int    `json:"count"`
+	Passed   bool   `json:"passed"`
+}
+
+// Report summarizes all expectation results
+type Report struct {
+	Passed  bool     `json:"passed"`
+	Results []Result `json:"results"`
+}
+
+// Load reads a scenario file
+func Load(filePath string) (*Scenario, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario file: %w", err)
+	}
+
+	var s Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario file: %w", err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Validate checks that every expectation is well-formed
+func (s *Scenario) Validate() error {
+	for i, e := range s.Expectations {
+		if e.URL == "" && e.Path == "" && e.Host == "" {
+			return fmt.Errorf("expectation %d: one of url, host or path is required", i)
+		}
+		if e.Path != "" {
+			if _, err := path.Match(e.Path, "/"); err != nil {
+				return fmt.Errorf("expectation %d: invalid path pattern %q: %w", i, e.Path, err)
+			}
+		}
+		if e.Times != nil && (e.AtLeast != nil || e.AtMost != nil) {
+			return fmt.Errorf("expectation %d: times cannot be combined with atLeast/atMost", i)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a request satisfies the expectation's request criteria
+func (e *Expectation) Matches(method string, u *url.URL, body []byte) bool {
+	if e.Method != "" && !strings.EqualFold(e.Method, method) {
+		return false
+	}
+	if e.URL != "" && e.URL != u.String() {
+		return false
+	}
+	if e.Host != "" && !strings.EqualFold(e.Host, u.Host) {
+		return false
+	}
+	if e.Path != "" {
+		if ok, _ := path.Match(e.Path, u.Path); !ok {
+			return false
+		}
+	}
+	if len(e.JSONFields) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return false
+		}
+		for field, expected := range e.JSONFields {
+			actual, ok := lookupField(doc, field)
+			if !ok || !reflect.DeepEqual(normalizeJSON(expected), actual) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// describe returns a human readable description of the expected call count
+func (e *Expectation) describe() string {
+	switch {
+	case e.Times != nil:
+		return fmt.Sprintf("exactly %d", *e.Times)
+	case e.AtLeast != nil && e.AtMost != nil:
+		return fmt.Sprintf("between %d and %d", *e.AtLeast, *e.AtMost)
+	case e.AtLeast != nil:
+		return fmt.Sprintf("at least %d", *e.AtLeast)
+	case e.AtMost != nil:
+		return fmt.Sprintf("at most %d", *e.AtMost)
+	default:
+		return "at least 1"
+	}
+}
+
+// satisfied reports whether count meets the expected call count
+func (e *Expectation) satisfied(count int) bool {
+	switch {
+	case e.Times != nil:
+		return count == *e.Times
+	case e.AtLeast != nil || e.AtMost != nil:
+		if e.AtLeast != nil && count < *e.AtLeast {
+			return false
+		}
+		if e.AtMost != nil && count > *e.AtMost {
+			return false
+		}
+		return true
+	default:
+		return count >= 1
+	}
+}
+
+// name returns the display name of the expectation
+func (e *Expectation) name() string {
+	if e.Name != "" {
+		return e.Name
+	}
+	target := e.URL
+	if target == "" {
+		target = e.Host + e.Path
+	}
+	if e.Method != "" {
+		return strings.ToUpper(e.Method) + " " + target
+	}
+	return target
+}
+
+// lookupField resolves a dotted field path (e.g. "order.qty") in a decoded JSON document
+func lookupField(doc interface{}, field string) (interface{}, bool) {
+	current := doc
+	for _, part := range strings.Split(field, ".") {
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// normalizeJSON round-trips a value through JSON so numbers compare as float64
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+// Tracker counts requests matching each expectation during playback
+type Tracker struct {
+	scenario *Scenario
+	counts   []int
+	mutex    sync.Mutex
+}
+
+// NewTracker creates a tracker for the given scenario
+func NewTracker(s *Scenario) *Tracker {
+	return &Tracker{
+		scenario: s,
+		counts:   make([]int, len(s.Expectations)),
+	}
+}
+
+// Observe records a request against all matching expectations
+func (t *Tracker) Observe(method string, u *url.URL, body []byte) {
+	if u == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i := range t.scenario.Expectations {
+		if t.scenario.Expectations[i].Matches(method, u, body) {
+			t.counts[i]++
+		}
+	}
+}
+
+// Report evaluates all expectations against the observed requests
+func (t *Tracker) Report() Report {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	report := Report{Passed: true, Results: make([]Result, 0, len(t.counts))}
+	for i := range t.scenario.Expectations {
+		e := &t.scenario.Expectations[i]
+		passed := e.satisfied(t.counts[i])
+		if !passed {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, Result{
+			Name:     e.name(),
+			Expected: e.describe(),
+			Count:    t.counts[i],
+			Passed:   passed,
+		})
+	}
+	return report
+}
+
+// Reset clears all observed counts
+func (t *Tracker) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.counts = make([]int, len(t.scenario.Expectations))
+}
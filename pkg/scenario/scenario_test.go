@@ -0,0 +1,134 @@
+package scenario
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL %s: %v", rawURL, err)
+	}
+	return u
+}
+
+func TestTracker_ExactlyOnceWithJSONField(t *testing.T) {
+	s := &Scenario{
+		Expectations: []Expectation{
+			{
+				Method:     "POST",
+				Path:       "/api/order",
+				Times:      intPtr(1),
+				JSONFields: map[string]interface{}{"qty": 2},
+			},
+		},
+	}
+	tracker := NewTracker(s)
+
+	orderURL := mustParseURL(t, "https://example.com/api/order")
+	tracker.Observe("POST", orderURL, []byte(`{"qty": 1}`))
+	tracker.Observe("GET", orderURL, nil)
+
+	report := tracker.Report()
+	if report.Passed {
+		t.Fatal("Expected report to fail before matching request is observed")
+	}
+
+	tracker.Observe("POST", orderURL, []byte(`{"qty": 2, "sku": "abc"}`))
+	report = tracker.Report()
+	if !report.Passed {
+		t.Fatalf("Expected report to pass, got %+v", report)
+	}
+	if report.Results[0].Count != 1 {
+		t.Errorf("Expected count 1, got %d", report.Results[0].Count)
+	}
+
+	tracker.Observe("POST", orderURL, []byte(`{"qty": 2}`))
+	if tracker.Report().Passed {
+		t.Error("Expected report to fail when called more than once")
+	}
+}
+
+func TestExpectation_Matches(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expectation Expectation
+		method      string
+		url         string
+		body        string
+		expected    bool
+	}{
+		{
+			name:        "Path glob",
+			expectation: Expectation{Path: "/api/*"},
+			method:      "GET",
+			url:         "https://example.com/api/users",
+			expected:    true,
+		},
+		{
+			name:        "Host mismatch",
+			expectation: Expectation{Host: "api.example.com"},
+			method:      "GET",
+			url:         "https://www.example.com/",
+			expected:    false,
+		},
+		{
+			name:        "Nested JSON field",
+			expectation: Expectation{URL: "https://example.com/cart", JSONFields: map[string]interface{}{"item.id": "x1"}},
+			method:      "PUT",
+			url:         "https://example.com/cart",
+			body:        `{"item": {"id": "x1"}}`,
+			expected:    true,
+		},
+		{
+			name:        "Non JSON body",
+			expectation: Expectation{Path: "/cart", JSONFields: map[string]interface{}{"id": "x1"}},
+			method:      "PUT",
+			url:         "https://example.com/cart",
+			body:        `id=x1`,
+			expected:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.expectation.Matches(tc.method, mustParseURL(t, tc.url), []byte(tc.body))
+			if result != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestLoad_Validation(t *testing.T) {
+	tempDir := t.TempDir()
+
+	validPath := filepath.Join(tempDir, "valid.json")
+	valid := `{"expectations": [{"method": "GET", "path": "/", "atLeast": 1, "atMost": 3}]}`
+	if err := os.WriteFile(validPath, []byte(valid), 0644); err != nil {
+		t.Fatalf("Failed to write scenario: %v", err)
+	}
+	s, err := Load(validPath)
+	if err != nil {
+		t.Fatalf("Failed to load valid scenario: %v", err)
+	}
+	if len(s.Expectations) != 1 {
+		t.Errorf("Expected 1 expectation, got %d", len(s.Expectations))
+	}
+
+	invalidPath := filepath.Join(tempDir, "invalid.json")
+	invalid := `{"expectations": [{"method": "GET", "times": 1}]}`
+	if err := os.WriteFile(invalidPath, []byte(invalid), 0644); err != nil {
+		t.Fatalf("Failed to write scenario: %v", err)
+	}
+	if _, err := Load(invalidPath); err == nil {
+		t.Error("Expected error for expectation without url/host/path")
+	}
+}
@@ -0,0 +1,69 @@
+package trust
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lqqyt2423/go-mitmproxy/cert"
+)
+
+// CA certificate formats
+const (
+	FormatPEM = "pem"
+	FormatDER = "der"
+)
+
+// caFiles are the files go-mitmproxy keeps the CA in: the key with the certificate, and the
+// certificate alone in PEM (.pem and .cer)
+var caFiles = []string{"mitmproxy-ca.pem", "mitmproxy-ca-cert.pem", "mitmproxy-ca-cert.cer"}
+
+// loadCA loads the CA from dir (~/.mitmproxy when empty), generating it if it does not exist yet
+func loadCA(dir string) (*cert.SelfSignCA, error) {
+	ca, err := cert.NewSelfSignCA(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load or create CA: %w", err)
+	}
+	return ca.(*cert.SelfSignCA), nil
+}
+
+// ExportCA writes the CA certificate in dir (~/.mitmproxy when empty) to w as PEM or DER,
+// generating the CA if it does not exist yet. The private key is never written.
+func ExportCA(w io.Writer, dir, format string) error {
+	ca, err := loadCA(dir)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatPEM, "":
+		err = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: ca.RootCert.Raw})
+	case FormatDER:
+		_, err = w.Write(ca.RootCert.Raw)
+	default:
+		return fmt.Errorf("unknown certificate format %q, expected pem or der", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	return nil
+}
+
+// RegenerateCA replaces the CA in dir (~/.mitmproxy when empty) with a new one and returns the
+// path of its certificate. Trust stores the old CA was installed into no longer accept the proxy.
+func RegenerateCA(dir string) (string, error) {
+	ca, err := loadCA(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range caFiles {
+		if err := os.Remove(filepath.Join(ca.StorePath, name)); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to remove CA: %w", err)
+		}
+	}
+	if ca, err = loadCA(ca.StorePath); err != nil {
+		return "", err
+	}
+	return filepath.Join(ca.StorePath, "mitmproxy-ca-cert.pem"), nil
+}
@@ -0,0 +1,281 @@
+package trust
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/lqqyt2423/go-mitmproxy/cert"
+)
+
+// Nickname is the name the CA is installed under in NSS databases and Java keystores
+const Nickname = "http-playback-proxy"
+
+// Trust stores
+const (
+	StoreSystem = "system"
+	StoreNSS    = "nss"
+	StoreJava   = "java"
+)
+
+// Options selects the trust stores to install the CA into
+type Options struct {
+	System bool
+	NSS    bool
+	Java   bool
+	// NSSDatabases overrides the detected NSS database directories
+	NSSDatabases []string
+	// JavaKeystore overrides the JDK's cacerts keystore
+	JavaKeystore  string
+	JavaStorePass string
+}
+
+// Environment is what the installer looks at to find the trust stores
+type Environment struct {
+	GOOS     string
+	Home     string
+	JavaHome string
+	LookPath func(file string) (string, error)
+}
+
+// DefaultEnvironment returns the environment of the current process
+func DefaultEnvironment() Environment {
+	home, _ := os.UserHomeDir()
+	return Environment{
+		GOOS:     runtime.GOOS,
+		Home:     home,
+		JavaHome: os.Getenv("JAVA_HOME"),
+		LookPath: exec.LookPath,
+	}
+}
+
+// Step is a single installation action
+type Step struct {
+	Store string
+	// MkdirAll creates this directory
+	MkdirAll string
+	// CopyTo copies the CA certificate to this path
+	CopyTo string
+	// Command is run after the directory and copy actions
+	Command []string
+	// IgnoreError continues when the step fails (e.g. removing an alias that does not exist)
+	IgnoreError bool
+}
+
+// String renders the step as a shell command
+func (s Step) String() string {
+	var parts []string
+	if s.MkdirAll != "" {
+		parts = append(parts, "mkdir -p "+s.MkdirAll)
+	}
+	if s.CopyTo != "" {
+		parts = append(parts, "cp <ca> "+s.CopyTo)
+	}
+	if len(s.Command) > 0 {
+		parts = append(parts, strings.Join(s.Command, " "))
+	}
+	return strings.Join(parts, " && ")
+}
+
+// EnsureCA returns the path of the proxy's CA certificate, generating the CA if it does not exist yet
+func EnsureCA() (string, error) {
+	ca, err := cert.NewSelfSignCA("")
+	if err != nil {
+		return "", fmt.Errorf("failed to load or create CA: %w", err)
+	}
+	return filepath.Join(ca.(*cert.SelfSignCA).StorePath, "mitmproxy-ca-cert.pem"), nil
+}
+
+// Validate checks that at least one trust store is selected
+func (o Options) Validate() error {
+	if !o.System && !o.NSS && !o.Java {
+		return fmt.Errorf("no trust store selected, use --system, --nss or --java")
+	}
+	return nil
+}
+
+// Plan returns the steps that install the CA certificate into the selected trust stores
+func Plan(certPath string, opts Options, env Environment) ([]Step, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	var steps []Step
+	if opts.System {
+		system, err := systemSteps(env)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, system...)
+	}
+	if opts.NSS {
+		nss, err := nssSteps(certPath, opts.NSSDatabases, env)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, nss...)
+	}
+	if opts.Java {
+		java, err := javaSteps(certPath, opts.JavaKeystore, opts.JavaStorePass, env)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, java...)
+	}
+	return steps, nil
+}
+
+// systemSteps installs the CA into the distribution's system bundle
+func systemSteps(env Environment) ([]Step, error) {
+	if env.GOOS != "linux" {
+		return nil, fmt.Errorf("--system is only supported on Linux, install the CA manually on %s", env.GOOS)
+	}
+
+	switch {
+	case found(env, "update-ca-certificates"):
+		// Debian, Ubuntu, Alpine, SUSE
+		return []Step{{
+			Store:    StoreSystem,
+			MkdirAll: "/usr/local/share/ca-certificates",
+			CopyTo:   "/usr/local/share/ca-certificates/" + Nickname + ".crt",
+			Command:  []string{"update-ca-certificates"},
+		}}, nil
+	case found(env, "update-ca-trust"):
+		// Fedora, RHEL, CentOS, Amazon Linux
+		return []Step{{
+			Store:    StoreSystem,
+			MkdirAll: "/etc/pki/ca-trust/source/anchors",
+			CopyTo:   "/etc/pki/ca-trust/source/anchors/" + Nickname + ".pem",
+			Command:  []string{"update-ca-trust", "extract"},
+		}}, nil
+	default:
+		return nil, fmt.Errorf("no system trust store tool found (update-ca-certificates or update-ca-trust)")
+	}
+}
+
+// nssSteps installs the CA into NSS databases used by Chromium and Firefox
+func nssSteps(certPath string, databases []string, env Environment) ([]Step, error) {
+	if !found(env, "certutil") {
+		return nil, fmt.Errorf("certutil not found, install libnss3-tools (Debian/Ubuntu) or nss-tools (Fedora/RHEL)")
+	}
+
+	var steps []Step
+	if len(databases) == 0 {
+		// Chromium's shared database is created if missing; Firefox profiles are used as found
+		shared := filepath.Join(env.Home, ".pki", "nssdb")
+		if _, err := os.Stat(filepath.Join(shared, "cert9.db")); err != nil {
+			steps = append(steps, Step{
+				Store:    StoreNSS,
+				MkdirAll: shared,
+				Command:  []string{"certutil", "-d", "sql:" + shared, "-N", "--empty-password"},
+			})
+		}
+		databases = append(databases, shared)
+
+		profiles, _ := filepath.Glob(filepath.Join(env.Home, ".mozilla", "firefox", "*", "cert9.db"))
+		for _, profile := range profiles {
+			databases = append(databases, filepath.Dir(profile))
+		}
+	}
+
+	for _, database := range databases {
+		steps = append(steps, Step{
+			Store:   StoreNSS,
+			Command: []string{"certutil", "-d", "sql:" + database, "-A", "-t", "C,,", "-n", Nickname, "-i", certPath},
+		})
+	}
+	return steps, nil
+}
+
+// javaSteps imports the CA into the JDK's cacerts (or the given keystore), replacing an earlier import
+func javaSteps(certPath, keystore, storePass string, env Environment) ([]Step, error) {
+	keytool := ""
+	if env.JavaHome != "" {
+		if candidate := filepath.Join(env.JavaHome, "bin", "keytool"); fileExists(candidate) {
+			keytool = candidate
+		}
+	}
+	if keytool == "" {
+		path, err := env.LookPath("keytool")
+		if err != nil {
+			return nil, fmt.Errorf("keytool not found, set JAVA_HOME or add the JDK to PATH")
+		}
+		keytool = path
+	}
+
+	if storePass == "" {
+		storePass = "changeit"
+	}
+	store := []string{"-cacerts"}
+	if keystore != "" {
+		store = []string{"-keystore", keystore}
+	}
+
+	remove := append([]string{keytool, "-delete", "-noprompt", "-alias", Nickname, "-storepass", storePass}, store...)
+	install := append([]string{keytool, "-importcert", "-noprompt", "-alias", Nickname, "-file", certPath, "-storepass", storePass}, store...)
+	return []Step{
+		{Store: StoreJava, Command: remove, IgnoreError: true},
+		{Store: StoreJava, Command: install},
+	}, nil
+}
+
+// Run executes the steps, writing progress and command output to out
+func Run(steps []Step, certPath string, out io.Writer) error {
+	for _, step := range steps {
+		fmt.Fprintf(out, "[%s] %s\n", step.Store, step)
+		stepOut := out
+		if step.IgnoreError {
+			stepOut = io.Discard
+		}
+		err := runStep(step, certPath, stepOut)
+		if err != nil && !step.IgnoreError {
+			if errors.Is(err, os.ErrPermission) {
+				return fmt.Errorf("%s: %w (run as root, e.g. with sudo)", step.Store, err)
+			}
+			return fmt.Errorf("%s: %w", step.Store, err)
+		}
+	}
+	return nil
+}
+
+func runStep(step Step, certPath string, out io.Writer) error {
+	if step.MkdirAll != "" {
+		if err := os.MkdirAll(step.MkdirAll, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	if step.CopyTo != "" {
+		data, err := os.ReadFile(certPath)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		if err := os.WriteFile(step.CopyTo, data, 0644); err != nil {
+			return fmt.Errorf("failed to copy CA certificate: %w", err)
+		}
+	}
+	if len(step.Command) > 0 {
+		cmd := exec.Command(step.Command[0], step.Command[1:]...)
+		cmd.Stdout = out
+		cmd.Stderr = out
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", filepath.Base(step.Command[0]), err)
+		}
+	}
+	return nil
+}
+
+// found reports whether a command is available
+func found(env Environment, file string) bool {
+	_, err := env.LookPath(file)
+	return err == nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
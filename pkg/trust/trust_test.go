@@ -0,0 +1,134 @@
+package trust
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fakeEnvironment returns a Linux environment where only the given commands exist
+func fakeEnvironment(t *testing.T, commands ...string) Environment {
+	return Environment{
+		GOOS: "linux",
+		Home: t.TempDir(),
+		LookPath: func(file string) (string, error) {
+			for _, command := range commands {
+				if command == file {
+					return "/usr/bin/" + file, nil
+				}
+			}
+			return "", fmt.Errorf("%s not found", file)
+		},
+	}
+}
+
+func TestPlan_System(t *testing.T) {
+	steps, err := Plan("/ca.pem", Options{System: true}, fakeEnvironment(t, "update-ca-trust"))
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(steps) != 1 || steps[0].CopyTo != "/etc/pki/ca-trust/source/anchors/http-playback-proxy.pem" ||
+		strings.Join(steps[0].Command, " ") != "update-ca-trust extract" {
+		t.Errorf("Unexpected system steps: %+v", steps)
+	}
+
+	if _, err := Plan("/ca.pem", Options{System: true}, fakeEnvironment(t)); err == nil {
+		t.Error("Expected an error without a trust store tool")
+	}
+
+	env := fakeEnvironment(t, "update-ca-certificates")
+	env.GOOS = "darwin"
+	if _, err := Plan("/ca.pem", Options{System: true}, env); err == nil {
+		t.Error("Expected an error outside Linux")
+	}
+}
+
+func TestPlan_NSS(t *testing.T) {
+	env := fakeEnvironment(t, "certutil")
+
+	// The shared database is created when it does not exist yet
+	steps, err := Plan("/ca.pem", Options{NSS: true}, env)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(steps) != 2 || !strings.Contains(steps[0].String(), "-N --empty-password") ||
+		!strings.Contains(steps[1].String(), "-A -t C,, -n http-playback-proxy -i /ca.pem") {
+		t.Errorf("Unexpected NSS steps: %v", steps)
+	}
+
+	steps, err = Plan("/ca.pem", Options{NSS: true, NSSDatabases: []string{"/db1", "/db2"}}, env)
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(steps) != 2 || steps[1].Command[2] != "sql:/db2" {
+		t.Errorf("Unexpected NSS steps for explicit databases: %v", steps)
+	}
+}
+
+func TestPlan_Java(t *testing.T) {
+	steps, err := Plan("/ca.pem", Options{Java: true, JavaKeystore: "/cacerts"}, fakeEnvironment(t, "keytool"))
+	if err != nil {
+		t.Fatalf("Plan failed: %v", err)
+	}
+	if len(steps) != 2 || !steps[0].IgnoreError {
+		t.Fatalf("Expected removal of an earlier import followed by the import, got %v", steps)
+	}
+	expected := "/usr/bin/keytool -importcert -noprompt -alias http-playback-proxy -file /ca.pem -storepass changeit -keystore /cacerts"
+	if steps[1].String() != expected {
+		t.Errorf("Expected %q, got %q", expected, steps[1].String())
+	}
+}
+
+func TestPlan_NoStore(t *testing.T) {
+	if _, err := Plan("/ca.pem", Options{}, fakeEnvironment(t)); err == nil {
+		t.Error("Expected an error when no trust store is selected")
+	}
+}
+
+func TestExportCA(t *testing.T) {
+	dir := t.TempDir()
+	var pemOut, derOut strings.Builder
+	if err := ExportCA(&pemOut, dir, FormatPEM); err != nil {
+		t.Fatalf("ExportCA failed: %v", err)
+	}
+	block, _ := pem.Decode([]byte(pemOut.String()))
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("Expected a PEM certificate, got %q", pemOut.String())
+	}
+	if strings.Contains(pemOut.String(), "PRIVATE KEY") {
+		t.Error("Expected the private key to be left out")
+	}
+
+	if err := ExportCA(&derOut, dir, FormatDER); err != nil {
+		t.Fatalf("ExportCA failed: %v", err)
+	}
+	if derOut.String() != string(block.Bytes) {
+		t.Error("Expected the DER export to be the same certificate")
+	}
+	if err := ExportCA(io.Discard, dir, "p12"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestRegenerateCA(t *testing.T) {
+	dir := t.TempDir()
+	var before strings.Builder
+	if err := ExportCA(&before, dir, FormatPEM); err != nil {
+		t.Fatalf("ExportCA failed: %v", err)
+	}
+
+	certPath, err := RegenerateCA(dir)
+	if err != nil {
+		t.Fatalf("RegenerateCA failed: %v", err)
+	}
+	after, err := os.ReadFile(certPath)
+	if err != nil {
+		t.Fatalf("Failed to read the new certificate: %v", err)
+	}
+	if len(after) == 0 || string(after) == before.String() {
+		t.Error("Expected a new CA certificate")
+	}
+}
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -27,31 +29,230 @@ const (
 	DeviceTypeMobile  DeviceType = "mobile"
 )
 
+// CacheStatus tells whether a recorded response was served by a CDN edge cache or the origin server
+type CacheStatus string
+
+const (
+	CacheStatusHit    CacheStatus = "hit"
+	CacheStatusOrigin CacheStatus = "origin"
+)
+
+// Protocol is the HTTP version a recorded response was served with
+type Protocol string
+
+const (
+	ProtocolHTTP1 Protocol = "HTTP/1.1"
+	ProtocolHTTP2 Protocol = "HTTP/2"
+	ProtocolHTTP3 Protocol = "HTTP/3"
+)
+
 // Resource represents an HTTP resource with all its metadata
 type Resource struct {
-	Method             string               `json:"method"`
-	URL                string               `json:"url"`
-	TTFBMS             int64                `json:"ttfbMs"`
-	MBPS               *float64             `json:"mbps,omitempty"`
-	StatusCode         *int                 `json:"statusCode,omitempty"`
-	ErrorMessage       *string              `json:"errorMessage,omitempty"`
-	RawHeaders         HttpHeaders          `json:"rawHeaders,omitempty"`
-	ContentEncoding    *ContentEncodingType `json:"contentEncoding,omitempty"`
-	ContentTypeMime    *string              `json:"contentTypeMime,omitempty"`
-	ContentTypeCharset *string              `json:"contentTypeCharset,omitempty"`
-	ContentCharset     *string              `json:"contentCharset,omitempty"`
-	ContentFilePath    *string              `json:"contentFilePath,omitempty"`
-	ContentUTF8        *string              `json:"contentUtf8,omitempty"`
-	ContentBase64      *string              `json:"contentBase64,omitempty"`
-	Minify             *bool                `json:"minify,omitempty"`
-	Timestamp          time.Time            `json:"timestamp"`
+	Method               string               `json:"method"`
+	URL                  string               `json:"url"`
+	TTFBMS               int64                `json:"ttfbMs"`
+	MBPS                 *float64             `json:"mbps,omitempty"`
+	StatusCode           *int                 `json:"statusCode,omitempty"`
+	ErrorMessage         *string              `json:"errorMessage,omitempty"`
+	RawHeaders           HttpHeaders          `json:"rawHeaders,omitempty"`
+	SharedHeaders        []int                `json:"sharedHeaders,omitempty"`
+	ContentEncoding      *ContentEncodingType `json:"contentEncoding,omitempty"`
+	ContentTypeMime      *string              `json:"contentTypeMime,omitempty"`
+	ContentTypeCharset   *string              `json:"contentTypeCharset,omitempty"`
+	ContentCharset       *string              `json:"contentCharset,omitempty"`
+	ContentFilePath      *string              `json:"contentFilePath,omitempty"`
+	ContentUTF8          *string              `json:"contentUtf8,omitempty"`
+	ContentBase64        *string              `json:"contentBase64,omitempty"`
+	ContentSHA256        *string              `json:"contentSha256,omitempty"`
+	OriginalFilePath     *string              `json:"originalFilePath,omitempty"`
+	CacheStatus          *CacheStatus         `json:"cacheStatus,omitempty"`
+	Clients              []string             `json:"clients,omitempty"`
+	Tags                 []string             `json:"tags,omitempty"`
+	Metadata             map[string]string    `json:"metadata,omitempty"`
+	Samples              *SampleStats         `json:"samples,omitempty"`
+	Minify               *bool                `json:"minify,omitempty"`
+	Pushes               []string             `json:"pushes,omitempty"`
+	Parts                []StreamPart         `json:"parts,omitempty"`
+	Flushes              []FlushPoint         `json:"flushes,omitempty"`
+	Informational        []Informational      `json:"informational,omitempty"`
+	Truncated            *bool                `json:"truncated,omitempty"`
+	BytesReceived        *int64               `json:"bytesReceived,omitempty"`
+	ContentLength        *int64               `json:"contentLength,omitempty"`
+	WireSize             *int64               `json:"wireSize,omitempty"`
+	BodyOmitted          *bool                `json:"bodyOmitted,omitempty"`
+	ProxyOverheadMS      *float64             `json:"proxyOverheadMs,omitempty"`
+	Fetch                *FetchMetadata       `json:"fetch,omitempty"`
+	Accept               *string              `json:"accept,omitempty"`
+	Language             *string              `json:"language,omitempty"`
+	Repeat               *int                 `json:"repeat,omitempty"`
+	RequestHeaders       HttpHeaders          `json:"requestHeaders,omitempty"`
+	SharedRequestHeaders []int                `json:"sharedRequestHeaders,omitempty"`
+	RequestBodyUTF8      *string              `json:"requestBodyUtf8,omitempty"`
+	RequestBodyBase64    *string              `json:"requestBodyBase64,omitempty"`
+	RequestBodySHA256    *string              `json:"requestBodySha256,omitempty"`
+	TLSSession           *TLSSession          `json:"tlsSession,omitempty"`
+	Timings              *Timings             `json:"timings,omitempty"`
+	Protocol             *Protocol            `json:"protocol,omitempty"`
+	WebSocket            []WebSocketFrame     `json:"webSocket,omitempty"`
+	HeaderWarnings       []string             `json:"headerWarnings,omitempty"`
+	Timestamp            time.Time            `json:"timestamp"`
+}
+
+// SampleStats aggregates the timing of every response matching a sampling rule,
+// including the responses whose bodies were not recorded
+type SampleStats struct {
+	Pattern   string  `json:"pattern"`
+	Observed  int     `json:"observed"`
+	Recorded  int     `json:"recorded"`
+	TTFBMinMS int64   `json:"ttfbMinMs"`
+	TTFBAvgMS float64 `json:"ttfbAvgMs"`
+	TTFBMaxMS int64   `json:"ttfbMaxMs"`
+	MBPSAvg   float64 `json:"mbpsAvg"`
+}
+
+// StreamPart is one part of a streaming response (e.g. a frame of multipart/x-mixed-replace)
+// in the order it was received
+type StreamPart struct {
+	// OffsetMS is when the part was complete, from request start
+	OffsetMS int64 `json:"offsetMs"`
+	// Size is the number of body bytes in the part
+	Size int `json:"size"`
+}
+
+// FlushPoint is where an HTML response paused because the origin flushed part of the document
+// (e.g. the <head>) before generating the rest
+type FlushPoint struct {
+	// OffsetMS is when the flushed part was complete, from request start
+	OffsetMS int64 `json:"offsetMs"`
+	// Tags is the number of '>' characters of the decoded document received by then, which
+	// locates the flush regardless of compression, beautification or charset
+	Tags int `json:"tags"`
+}
+
+// Informational is an interim 1xx response (e.g. 103 Early Hints) received before the final response
+type Informational struct {
+	StatusCode int `json:"statusCode"`
+	// OffsetMS is when the response was received, from request start
+	OffsetMS   int64       `json:"offsetMs"`
+	RawHeaders HttpHeaders `json:"rawHeaders,omitempty"`
+}
+
+// FetchMetadata is the context a browser requested a resource in, from the Sec-Fetch-* and
+// Sec-Purpose request headers
+type FetchMetadata struct {
+	Dest string `json:"dest,omitempty"`
+	Mode string `json:"mode,omitempty"`
+	Site string `json:"site,omitempty"`
+	// User is set for navigations triggered by the user
+	User    bool   `json:"user,omitempty"`
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// IsPrefetch reports whether the resource was fetched ahead of use (prefetch or prerender)
+func (m *FetchMetadata) IsPrefetch() bool {
+	return m != nil && strings.Contains(m.Purpose, "prefetch")
+}
+
+// TLSSession is the TLS handshake of the upstream connection a resource was the first request on
+type TLSSession struct {
+	Version string `json:"version"`
+	// Resumed is set when the handshake resumed an earlier session instead of a full handshake
+	Resumed     bool  `json:"resumed"`
+	HandshakeMS int64 `json:"handshakeMs"`
+}
+
+// Timings splits the time of a request into the phases traced while recording, in milliseconds, like
+// the timings of a HAR entry. DNS, Connect and TLS are only set on requests that opened a connection.
+type Timings struct {
+	DNSMS     int64 `json:"dnsMs,omitempty"`
+	ConnectMS int64 `json:"connectMs,omitempty"`
+	TLSMS     int64 `json:"tlsMs,omitempty"`
+	// SendMS is writing the request, WaitMS waiting for the first byte of the response and
+	// ReceiveMS reading the rest of it
+	SendMS    int64 `json:"sendMs"`
+	WaitMS    int64 `json:"waitMs"`
+	ReceiveMS int64 `json:"receiveMs"`
+}
+
+// WebSocketFrame is a frame of a WebSocket session, recorded after the handshake (the resource's
+// 101 response)
+type WebSocketFrame struct {
+	// OffsetMS is when the frame was sent, from the end of the handshake
+	OffsetMS int64 `json:"offsetMs"`
+	// FromClient is set for frames the client sent; playback only sends the others
+	FromClient bool `json:"fromClient,omitempty"`
+	Opcode     int  `json:"opcode"`
+	// Partial is set for frames followed by continuation frames of the same message
+	Partial bool `json:"partial,omitempty"`
+	// PayloadUTF8 holds payloads that are valid UTF-8 and PayloadBase64 the others
+	PayloadUTF8   *string `json:"payloadUtf8,omitempty"`
+	PayloadBase64 *string `json:"payloadBase64,omitempty"`
+}
+
+// SharedHeader is a response header stored once in the inventory's header table
+type SharedHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 // Inventory represents a collection of resources
 type Inventory struct {
-	EntryURL   *string     `json:"entryUrl,omitempty"`
-	DeviceType *DeviceType `json:"deviceType,omitempty"`
-	Resources  []Resource  `json:"resources"`
+	// SchemaVersion is 2 when resources refer to the header table; omitted for version 1
+	SchemaVersion int         `json:"schemaVersion,omitempty"`
+	EntryURL      *string     `json:"entryUrl,omitempty"`
+	DeviceType    *DeviceType `json:"deviceType,omitempty"`
+	// Playback configures how the inventory is played back, unless playback.json overrides it
+	Playback *PlaybackSettings `json:"playback,omitempty"`
+	// Domains lists the hosts the recording connected to, with the address they resolved to
+	Domains   []Domain   `json:"domains,omitempty"`
+	Resources []Resource `json:"resources"`
+	// Headers is the table of long header values repeated across resources, which refer to them by
+	// index in SharedHeaders and SharedRequestHeaders. It is only used in stored files: loading an
+	// inventory moves the headers back into RawHeaders and RequestHeaders.
+	Headers []SharedHeader `json:"headers,omitempty"`
+	// Redaction is the redaction config the recording was saved with, so responses appended to it
+	// later, e.g. by playback --record-misses, are redacted alike
+	Redaction json.RawMessage `json:"redaction,omitempty"`
+}
+
+// Domain is a host a recording connected to
+type Domain struct {
+	Name string `json:"name"`
+	// IPAddress is the address of the first connection to the host
+	IPAddress string `json:"ipAddress,omitempty"`
+	// Resolver is the DNS resolver that produced IPAddress: "system", or the server or
+	// DNS-over-HTTPS URL given with --dns
+	Resolver string `json:"resolver,omitempty"`
+	// HTTP3 is set when the host advertised HTTP/3 in an Alt-Svc header; it was recorded over TCP
+	HTTP3 bool `json:"http3,omitempty"`
+	// TLS describes the TLS connection to the host, preferring a full handshake over a resumed one
+	TLS *DomainTLS `json:"tls,omitempty"`
+}
+
+// DomainTLS is the TLS setup of a connection to a recorded host
+type DomainTLS struct {
+	Version     string `json:"version"`
+	CipherSuite string `json:"cipherSuite"`
+	HandshakeMS int64  `json:"handshakeMs"`
+	Resumed     bool   `json:"resumed,omitempty"`
+	// Certificates is the chain the host presented, its own certificate first
+	Certificates []CertificateInfo `json:"certificates,omitempty"`
+}
+
+// CertificateInfo identifies a certificate of a TLS chain
+type CertificateInfo struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// PlaybackSettings configures playback from the inventory itself, so every run of it behaves alike
+type PlaybackSettings struct {
+	// Fallback handles unrecorded requests to hosts matching none of Domains (passthrough,
+	// replay-only or block); empty leaves it to the policies
+	Fallback string `json:"fallback,omitempty"`
+	// Domains maps host patterns (globs such as *.example.com) to the fallback of their unrecorded requests
+	Domains map[string]string `json:"domains,omitempty"`
 }
 
 // BodyChunk represents a chunk of response body with timing information
@@ -84,6 +285,71 @@ type RecordingTransaction struct {
 	ErrorMessage     *string
 	RawHeaders       HttpHeaders
 	Body             []byte
+	// Truncated is set when fewer body bytes were received than announced
+	Truncated bool
+	// ExpectedLength is the announced Content-Length, if any
+	ExpectedLength *int64
+	// BodyOmitted is set when the body was left out of the recording, keeping only its size
+	BodyOmitted bool
+	// BodySize is the size of an omitted body as received
+	BodySize int64
+	// ProxyOverhead is the time the proxy itself spent on the request before its response started,
+	// which the measured TTFB includes
+	ProxyOverhead time.Duration
+	// ClientID identifies the client (proxy auth user or source IP) when clients are tagged
+	ClientID string
+	// SamplePattern is the sampling rule the request matched, if any
+	SamplePattern string
+	// Samples holds the timing aggregated over every response of the sampling rule
+	Samples *SampleStats
+	// Parts holds the timing of each part of a streaming response
+	Parts []StreamPart
+	// Flushes holds where an HTML response paused, in order
+	Flushes []FlushPoint
+	// Informational holds the interim responses that preceded the final response, in order
+	Informational []Informational
+	// Pushes holds the URLs the origin pushed with the response (HTTP/2 server push)
+	Pushes []string
+	// Tags are free-form labels added by recording post-processing
+	Tags []string
+	// Metadata holds key-value annotations added by recording post-processing
+	Metadata map[string]string
+	// Fetch is the fetch metadata the client sent with the request, if any
+	Fetch *FetchMetadata
+	// Accept is the Accept header of the request, which selects the format of negotiated images
+	Accept string
+	// RequestHeaders are the headers the client sent, without the credentials injected by the proxy
+	RequestHeaders HttpHeaders
+	// RequestBody is the body the client sent, unless it exceeded the recorded size limit
+	RequestBody []byte
+	// IPAddress is the address of the upstream server the response came from, if known
+	IPAddress string
+	// Resolver is the DNS resolver that produced IPAddress
+	Resolver string
+	// RequestBodySHA256 is the hash of the normalized request body, if the request had one
+	RequestBodySHA256 string
+	// HeaderWarnings lists request and response headers that exceed common client limits
+	HeaderWarnings []string
+	// TLSSession is the handshake of the upstream connection, if the request opened one
+	TLSSession *TLSSession
+	// DomainTLS details the TLS connection the request opened, for the inventory's domains
+	DomainTLS *DomainTLS
+	// Timings are the traced phases of the request
+	Timings *Timings
+	// Protocol is the HTTP version the origin served the response with
+	Protocol Protocol
+	// AdvertisedHTTP3 is set when the response advertised HTTP/3 in an Alt-Svc header
+	AdvertisedHTTP3 bool
+	// WebSocket holds the frames of a WebSocket session, in order
+	WebSocket []WebSocketFrame
+}
+
+// BodyLength returns the size of the received body, including a body left out of the recording
+func (t *RecordingTransaction) BodyLength() int64 {
+	if t.BodyOmitted {
+		return t.BodySize
+	}
+	return int64(len(t.Body))
 }
 
 // PlaybackTransaction represents a complete HTTP transaction for playback with all data
@@ -95,4 +361,42 @@ type PlaybackTransaction struct {
 	ErrorMessage *string
 	RawHeaders   HttpHeaders
 	Chunks       []BodyChunk
+	// ChecksumMismatch is set when the content file no longer matches its recorded checksum
+	ChecksumMismatch bool
+	// ContentFile is the content file checked again while playback runs when checksums are
+	// verified, with its recorded ContentSHA256; empty otherwise
+	ContentFile   string
+	ContentSHA256 string
+	// CacheStatus is where the recorded response came from, if known
+	CacheStatus CacheStatus
+	// ContentEncoding is the coding the replayed body actually carries (identity if re-compression failed)
+	ContentEncoding ContentEncodingType
+	// Informational holds the recorded interim responses, in order
+	Informational []Informational
+	// Fetch is the fetch metadata of the recorded request, if any
+	Fetch *FetchMetadata
+	// Accept is the Accept header an image response was recorded for, if any
+	Accept string
+	// Language is the language of the recorded response, from Content-Language or the lang of an
+	// HTML document, if known
+	Language string
+	// RequestHeaders are the headers of the recorded request, if they were recorded
+	RequestHeaders HttpHeaders
+	// RequestBodySHA256 is the hash of the normalized body of the recorded request, if it had one
+	RequestBodySHA256 string
+	// Repeat is the position of the response among those kept for the same request, in recorded
+	// order; 0 for the first
+	Repeat int
+	// Metadata holds the key-value annotations of the resource, for tooling built on playback
+	Metadata map[string]string
+	// TLSSession is the recorded handshake of the upstream connection the request opened, if any
+	TLSSession *TLSSession
+	// Timings are the phases of the request traced while recording, if any
+	Timings *Timings
+	// Protocol is the HTTP version the response was recorded over, if known
+	Protocol Protocol
+	// WebSocket holds the recorded frames of a WebSocket session, in order
+	WebSocket []WebSocketFrame
+	// Streamed is set for streaming responses, whose headers leave at the TTFB ahead of their parts
+	Streamed bool
 }
\ No newline at end of file
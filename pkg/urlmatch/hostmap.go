@@ -0,0 +1,62 @@
+package urlmatch
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// HostMap serves requests to some hosts from the resources recorded under others, e.g. requests to
+// www.example.com from a recording of staging.example.com
+type HostMap struct {
+	// recorded maps requested hostnames to the hostnames their resources were recorded under
+	recorded map[string]string
+}
+
+// ParseHostMap parses "REQUESTED=>RECORDED" hostname mappings; it returns nil, which maps nothing,
+// when there are none
+func ParseHostMap(specs []string) (*HostMap, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	m := &HostMap{recorded: make(map[string]string, len(specs))}
+	for _, spec := range specs {
+		requested, recorded, ok := strings.Cut(spec, "=>")
+		requested = strings.ToLower(strings.TrimSpace(requested))
+		recorded = strings.ToLower(strings.TrimSpace(recorded))
+		if !ok || requested == "" || recorded == "" {
+			return nil, fmt.Errorf("invalid host mapping %q, expected REQUESTED=>RECORDED", spec)
+		}
+		if strings.ContainsAny(requested+recorded, ":/") {
+			return nil, fmt.Errorf("invalid host mapping %q, expected hostnames without scheme or port", spec)
+		}
+		if _, exists := m.recorded[requested]; exists {
+			return nil, fmt.Errorf("host %s is mapped more than once", requested)
+		}
+		m.recorded[requested] = recorded
+	}
+	return m, nil
+}
+
+// Recorded returns the URL with its hostname replaced by the one it was recorded under, and
+// whether it was mapped. The port is kept.
+func (m *HostMap) Recorded(rawURL string) (string, bool) {
+	if m == nil {
+		return rawURL, false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL, false
+	}
+	recorded, ok := m.recorded[strings.ToLower(u.Hostname())]
+	if !ok {
+		return rawURL, false
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(recorded, port)
+	} else {
+		u.Host = recorded
+	}
+	return u.String(), true
+}
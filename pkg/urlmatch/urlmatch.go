@@ -0,0 +1,101 @@
+// Package urlmatch normalizes URLs so playback can answer requests that differ from the recorded
+// ones only by cache-busting query parameters or other parts that do not select the content.
+package urlmatch
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go-http-playback-proxy/pkg/match"
+)
+
+// Options selects what is ignored when request URLs are compared with recorded ones
+type Options struct {
+	// IgnoreParams are the names (globs) of query parameters left out, e.g. "v" or "utm_*"
+	IgnoreParams []string
+	// IgnoreQuery leaves out the whole query string
+	IgnoreQuery bool
+	// Rewrites are applied to the URLs, in order, before the query is normalized
+	Rewrites []Rewrite
+}
+
+// Rewrite replaces the matches of a regular expression in URLs
+type Rewrite struct {
+	Pattern *regexp.Regexp
+	// Replacement may refer to groups of the pattern as $1 or ${name}
+	Replacement string
+}
+
+// ParseRewrite parses "REGEXP=>REPLACEMENT"
+func ParseRewrite(spec string) (Rewrite, error) {
+	pattern, replacement, ok := strings.Cut(spec, "=>")
+	if !ok || pattern == "" {
+		return Rewrite{}, fmt.Errorf("invalid rewrite %q, expected REGEXP=>REPLACEMENT", spec)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rewrite{}, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+	}
+	return Rewrite{Pattern: re, Replacement: replacement}, nil
+}
+
+// Matcher computes the keys under which URLs that should match are equal
+type Matcher struct {
+	ignoreParams *match.Set
+	ignoreQuery  bool
+	rewrites     []Rewrite
+}
+
+// New creates a matcher; it returns nil, which leaves URLs as they are, when nothing is ignored
+func New(opts Options) (*Matcher, error) {
+	if len(opts.IgnoreParams) == 0 && !opts.IgnoreQuery && len(opts.Rewrites) == 0 {
+		return nil, nil
+	}
+	ignoreParams, err := match.CompileSet(opts.IgnoreParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query parameter pattern: %w", err)
+	}
+	return &Matcher{ignoreParams: ignoreParams, ignoreQuery: opts.IgnoreQuery, rewrites: opts.Rewrites}, nil
+}
+
+// Normalize returns the URL with the rewrites applied and the ignored query parameters removed.
+// The remaining parameters are sorted, so their order does not matter either.
+func (m *Matcher) Normalize(rawURL string) string {
+	if m == nil {
+		return rawURL
+	}
+	for _, rewrite := range m.rewrites {
+		rawURL = rewrite.Pattern.ReplaceAllString(rawURL, rewrite.Replacement)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Fragment = ""
+	if m.ignoreQuery {
+		u.RawQuery = ""
+		return u.String()
+	}
+	if u.RawQuery == "" {
+		return u.String()
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return u.String()
+	}
+	for name := range query {
+		if m.ignoreParams.Match(name) {
+			delete(query, name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Key returns the key of a request for comparison with recorded ones
+func (m *Matcher) Key(method, rawURL string) string {
+	return method + ":" + m.Normalize(rawURL)
+}
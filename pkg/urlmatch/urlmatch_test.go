@@ -0,0 +1,107 @@
+package urlmatch
+
+import "testing"
+
+func TestMatcher_Normalize(t *testing.T) {
+	rewrite, err := ParseRewrite(`/build-[0-9a-f]+/=>/build/`)
+	if err != nil {
+		t.Fatalf("ParseRewrite failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		url      string
+		expected string
+	}{
+		{
+			name:     "ignored parameters",
+			opts:     Options{IgnoreParams: []string{"v", "_", "utm_*"}},
+			url:      "https://example.com/app.js?v=12345&id=1&_=1700000000&utm_source=mail",
+			expected: "https://example.com/app.js?id=1",
+		},
+		{
+			name:     "parameter order",
+			opts:     Options{IgnoreParams: []string{"v"}},
+			url:      "https://example.com/search?q=a&page=2",
+			expected: "https://example.com/search?page=2&q=a",
+		},
+		{
+			name:     "whole query",
+			opts:     Options{IgnoreQuery: true},
+			url:      "https://example.com/style.css?v=2#top",
+			expected: "https://example.com/style.css",
+		},
+		{
+			name:     "rewrite",
+			opts:     Options{Rewrites: []Rewrite{rewrite}},
+			url:      "https://cdn.example.com/build-3fa9c1/main.js",
+			expected: "https://cdn.example.com/build/main.js",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(tt.opts)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			if got := m.Normalize(tt.url); got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.url, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNew_Disabled(t *testing.T) {
+	m, err := New(Options{})
+	if err != nil || m != nil {
+		t.Fatalf("Expected no matcher without options, got %v (%v)", m, err)
+	}
+	if got := m.Key("GET", "https://example.com/?b=1&a=2"); got != "GET:https://example.com/?b=1&a=2" {
+		t.Errorf("Expected a nil matcher to keep URLs, got %q", got)
+	}
+}
+
+func TestParseRewrite_Invalid(t *testing.T) {
+	for _, spec := range []string{"no-separator", "=>replacement", "(=>x"} {
+		if _, err := ParseRewrite(spec); err == nil {
+			t.Errorf("Expected an error for %q", spec)
+		}
+	}
+	if _, err := New(Options{IgnoreParams: []string{"[a-"}}); err == nil {
+		t.Error("Expected an error for an invalid parameter pattern")
+	}
+}
+
+func TestHostMap_Recorded(t *testing.T) {
+	m, err := ParseHostMap([]string{"www.example.com=>staging.example.com", " Shop.Example.com => shop-staging.example.com "})
+	if err != nil {
+		t.Fatalf("ParseHostMap failed: %v", err)
+	}
+	tests := []struct {
+		url      string
+		expected string
+		mapped   bool
+	}{
+		{"https://www.example.com/a?b=1", "https://staging.example.com/a?b=1", true},
+		{"http://WWW.example.com:8080/", "http://staging.example.com:8080/", true},
+		{"https://shop.example.com/", "https://shop-staging.example.com/", true},
+		{"https://cdn.example.com/app.js", "https://cdn.example.com/app.js", false},
+	}
+	for _, tt := range tests {
+		if got, mapped := m.Recorded(tt.url); got != tt.expected || mapped != tt.mapped {
+			t.Errorf("Recorded(%q) = %q, %v, want %q, %v", tt.url, got, mapped, tt.expected, tt.mapped)
+		}
+	}
+
+	var none *HostMap
+	if got, mapped := none.Recorded("https://www.example.com/"); got != "https://www.example.com/" || mapped {
+		t.Errorf("Expected a nil host map to keep URLs, got %q", got)
+	}
+	for _, specs := range [][]string{{"www.example.com"}, {"=>staging.example.com"}, {"www.example.com=>https://staging.example.com"}, {"a.com=>b.com", "A.com=>c.com"}} {
+		if _, err := ParseHostMap(specs); err == nil {
+			t.Errorf("Expected an error for %q", specs)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Package websocket reads and writes WebSocket frames (RFC 6455), so sessions can be recorded and replayed
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-http-playback-proxy/pkg/types"
+)
+
+// Opcodes of the frames
+const (
+	OpContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	OpClose        = 0x8
+	OpPing         = 0x9
+	OpPong         = 0xA
+)
+
+// MaxPayload bounds the payload of a frame read, so a corrupt length cannot exhaust memory
+const MaxPayload = 64 * 1024 * 1024
+
+// acceptGUID is appended to the client's key to compute Sec-WebSocket-Accept
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame is a WebSocket frame with its payload unmasked
+type Frame struct {
+	Fin    bool
+	Opcode byte
+	// Masked is set for frames sent by clients, which mask their payload on the wire
+	Masked  bool
+	Payload []byte
+}
+
+// IsUpgrade reports whether the request headers ask to switch to the WebSocket protocol
+func IsUpgrade(header http.Header) bool {
+	if !strings.EqualFold(header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	// Firefox sends "Connection: keep-alive, Upgrade"
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AcceptKey returns the Sec-WebSocket-Accept value answering the client's Sec-WebSocket-Key
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Accept completes the opening handshake of a WebSocket request served locally and returns the
+// connection with a reader for the frames the client sends
+func Accept(w http.ResponseWriter, req *http.Request) (net.Conn, *bufio.Reader, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if !IsUpgrade(req.Header) || key == "" {
+		http.Error(w, "WebSocket upgrade required", http.StatusUpgradeRequired)
+		return nil, nil, fmt.Errorf("not a WebSocket upgrade request")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, nil, fmt.Errorf("connection cannot be taken over")
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to take over connection: %w", err)
+	}
+
+	handshake := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + AcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to write handshake: %w", err)
+	}
+	return conn, buf.Reader, nil
+}
+
+// ReadFrame reads a frame
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	frame := &Frame{
+		Fin:    header[0]&0x80 != 0,
+		Opcode: header[0] & 0x0F,
+		Masked: header[1]&0x80 != 0,
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > MaxPayload {
+		return nil, fmt.Errorf("frame payload of %d bytes exceeds the limit of %d", length, MaxPayload)
+	}
+
+	var mask [4]byte
+	if frame.Masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return nil, err
+		}
+	}
+
+	frame.Payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.Payload); err != nil {
+		return nil, err
+	}
+	if frame.Masked {
+		applyMask(frame.Payload, mask)
+	}
+	return frame, nil
+}
+
+// WriteFrame writes a frame, masking its payload with a fresh key when the frame is masked
+func WriteFrame(w io.Writer, frame *Frame) error {
+	header := make([]byte, 0, 14)
+	first := frame.Opcode & 0x0F
+	if frame.Fin {
+		first |= 0x80
+	}
+	header = append(header, first)
+
+	var maskBit byte
+	if frame.Masked {
+		maskBit = 0x80
+	}
+	length := len(frame.Payload)
+	switch {
+	case length < 126:
+		header = append(header, maskBit|byte(length))
+	case length <= 0xFFFF:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	payload := frame.Payload
+	if frame.Masked {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return fmt.Errorf("failed to generate mask: %w", err)
+		}
+		header = append(header, mask[:]...)
+		payload = append([]byte(nil), payload...)
+		applyMask(payload, mask)
+	}
+
+	if _, err := w.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CloseFrame returns a close frame with the status code
+func CloseFrame(code uint16) *Frame {
+	return &Frame{Fin: true, Opcode: OpClose, Payload: binary.BigEndian.AppendUint16(nil, code)}
+}
+
+func applyMask(payload []byte, mask [4]byte) {
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+}
+
+// Record converts a frame into its inventory form; offset is the time since the handshake
+func Record(frame *Frame, fromClient bool, offset time.Duration) types.WebSocketFrame {
+	recorded := types.WebSocketFrame{
+		OffsetMS:   offset.Milliseconds(),
+		FromClient: fromClient,
+		Opcode:     int(frame.Opcode),
+		Partial:    !frame.Fin,
+	}
+	if utf8.Valid(frame.Payload) {
+		payload := string(frame.Payload)
+		recorded.PayloadUTF8 = &payload
+	} else {
+		payload := base64.StdEncoding.EncodeToString(frame.Payload)
+		recorded.PayloadBase64 = &payload
+	}
+	return recorded
+}
+
+// Replayed converts a recorded frame back into a frame
+func Replayed(recorded *types.WebSocketFrame) (*Frame, error) {
+	// Frames are replayed to clients, so they are never masked
+	frame := &Frame{Fin: !recorded.Partial, Opcode: byte(recorded.Opcode)}
+	switch {
+	case recorded.PayloadUTF8 != nil:
+		frame.Payload = []byte(*recorded.PayloadUTF8)
+	case recorded.PayloadBase64 != nil:
+		payload, err := base64.StdEncoding.DecodeString(*recorded.PayloadBase64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 payload: %w", err)
+		}
+		frame.Payload = payload
+	}
+	return frame, nil
+}
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame Frame
+	}{
+		{name: "short text", frame: Frame{Fin: true, Opcode: OpText, Payload: []byte("hello")}},
+		{name: "masked by client", frame: Frame{Fin: true, Opcode: OpText, Masked: true, Payload: []byte("from client")}},
+		{name: "16-bit length", frame: Frame{Fin: true, Opcode: OpBinary, Payload: bytes.Repeat([]byte{0xFF}, 300)}},
+		{name: "64-bit length", frame: Frame{Opcode: OpBinary, Payload: bytes.Repeat([]byte("x"), 70000)}},
+		{name: "empty close", frame: Frame{Fin: true, Opcode: OpClose}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteFrame(&buf, &tt.frame); err != nil {
+				t.Fatalf("WriteFrame failed: %v", err)
+			}
+			if tt.frame.Masked && bytes.Contains(buf.Bytes(), tt.frame.Payload) {
+				t.Error("Masked payload written in the clear")
+			}
+
+			frame, err := ReadFrame(&buf)
+			if err != nil {
+				t.Fatalf("ReadFrame failed: %v", err)
+			}
+			if frame.Fin != tt.frame.Fin || frame.Opcode != tt.frame.Opcode || frame.Masked != tt.frame.Masked {
+				t.Errorf("Unexpected frame header: %+v", frame)
+			}
+			if !bytes.Equal(frame.Payload, tt.frame.Payload) {
+				t.Errorf("Payload changed: got %d bytes, want %d", len(frame.Payload), len(tt.frame.Payload))
+			}
+		})
+	}
+}
+
+func TestReadFrame_TooLarge(t *testing.T) {
+	header := []byte{0x82, 127, 0xFF, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := ReadFrame(bytes.NewReader(header)); err == nil {
+		t.Error("Expected an error for an oversized frame")
+	}
+}
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection string
+		upgrade    string
+		expected   bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, Upgrade", "websocket", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "h2c", false},
+	}
+
+	for _, tt := range tests {
+		header := http.Header{"Connection": {tt.connection}, "Upgrade": {tt.upgrade}}
+		if got := IsUpgrade(header); got != tt.expected {
+			t.Errorf("IsUpgrade(%q, %q) = %v, want %v", tt.connection, tt.upgrade, got, tt.expected)
+		}
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example of RFC 6455 section 1.3
+	if got := AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey = %q", got)
+	}
+}
+
+func TestAccept(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, reader, err := Accept(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		frame, err := ReadFrame(reader)
+		if err != nil {
+			return
+		}
+		WriteFrame(conn, &Frame{Fin: true, Opcode: OpText, Payload: frame.Payload})
+	}))
+	defer server.Close()
+
+	// Plain requests are refused
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Errorf("Expected 426 for a plain request, got %d", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", key)
+	reader := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("Failed to read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey(key) {
+		t.Fatalf("Unexpected handshake: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	WriteFrame(conn, &Frame{Fin: true, Opcode: OpText, Masked: true, Payload: []byte("ping")})
+	frame, err := ReadFrame(reader)
+	if err != nil || string(frame.Payload) != "ping" {
+		t.Errorf("Expected the echoed frame, got %+v (%v)", frame, err)
+	}
+}
+
+func TestRecordReplayed(t *testing.T) {
+	text := Record(&Frame{Fin: true, Opcode: OpText, Payload: []byte("héllo")}, false, 1500*time.Millisecond)
+	if text.OffsetMS != 1500 || text.PayloadUTF8 == nil || *text.PayloadUTF8 != "héllo" || text.Partial {
+		t.Errorf("Unexpected text frame: %+v", text)
+	}
+
+	binary := Record(&Frame{Opcode: OpBinary, Masked: true, Payload: []byte{0xFF, 0x00}}, true, 0)
+	if binary.PayloadBase64 == nil || !binary.FromClient || !binary.Partial {
+		t.Errorf("Unexpected binary frame: %+v", binary)
+	}
+
+	frame, err := Replayed(&binary)
+	if err != nil {
+		t.Fatalf("Replayed failed: %v", err)
+	}
+	if frame.Masked || frame.Fin || frame.Opcode != OpBinary || !bytes.Equal(frame.Payload, []byte{0xFF, 0x00}) {
+		t.Errorf("Unexpected replayed frame: %+v", frame)
+	}
+
+	invalid := "not base64!"
+	binary.PayloadBase64 = &invalid
+	if _, err := Replayed(&binary); err == nil {
+		t.Error("Expected an error for an invalid payload")
+	}
+}